@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/config"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/database"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/export"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/phone"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// bulkActions are the actions of the bulk subcommand
+var bulkActions = []string{"delete", "restore", "tag", "untag", "enrich"}
+
+// bulkOptions are the flags of the bulk subcommand
+type bulkOptions struct {
+	from, to, number, tagged, tag string
+	all, yes                      bool
+}
+
+// runBulk implements the bulk subcommand, which deletes, restores, tags,
+// untags or re-enriches the stored calls selected by a filter, and returns
+// the exit code. Without -yes it only reports the number of selected calls.
+func runBulk(args []string) int {
+	flags := flag.NewFlagSet("bulk", flag.ContinueOnError)
+	var opts bulkOptions
+	flags.StringVar(&opts.from, "from", "", "Select calls started at or after this date or time")
+	flags.StringVar(&opts.to, "to", "", "Select calls started before this date or time")
+	flags.StringVar(&opts.number, "number", "", "Select calls from or to this number, * matches any digits")
+	flags.StringVar(&opts.tagged, "tagged", "", "Select calls with this tag")
+	flags.StringVar(&opts.tag, "tag", "", "Tag to add or remove (tag and untag)")
+	flags.BoolVar(&opts.all, "all", false, "Select all calls; required without any other filter")
+	flags.BoolVar(&opts.yes, "yes", false, "Apply the action instead of only counting the selected calls")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: fritz-callmonitor2mqtt bulk %s [flags]\n\n", strings.Join(bulkActions, "|"))
+		fmt.Fprintf(flags.Output(), "Changes the stored calls selected by the flags. Without -yes only the number of selected calls is shown.\n")
+		fmt.Fprintf(flags.Output(), "enrich normalizes the numbers and detects the MSNs again with the current configuration.\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	if len(args) > 0 && (args[0] == "-help" || args[0] == "-h") {
+		flags.Usage()
+		return 0
+	}
+	if len(args) == 0 || !slices.Contains(bulkActions, args[0]) {
+		flags.Usage()
+		return 2
+	}
+	action := args[0]
+	if err := flags.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if (action == "tag" || action == "untag") && strings.TrimSpace(opts.tag) == "" {
+		fmt.Fprintf(os.Stderr, "bulk %s requires -tag\n", action)
+		return 2
+	}
+
+	if err := bulkCalls(action, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "bulk %s failed: %v\n", action, err)
+		return 1
+	}
+	return 0
+}
+
+// bulkCalls applies the action to the selected calls in the configured database
+func bulkCalls(action string, opts bulkOptions) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	location, err := cfg.GetLocation()
+	if err != nil {
+		return err
+	}
+
+	filter := database.CallFilter{Number: opts.number, Tag: opts.tagged, Deleted: action == "restore", All: opts.all}
+	if opts.from != "" {
+		if filter.From, err = export.ParseTime(opts.from, location); err != nil {
+			return err
+		}
+	}
+	if opts.to != "" {
+		if filter.To, err = export.ParseTime(opts.to, location); err != nil {
+			return err
+		}
+	}
+
+	dbClient, err := newDatabaseClient(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create database client: %w", err)
+	}
+	ctx := context.Background()
+	if err := dbClient.Connect(ctx); err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer func() { _ = dbClient.Close() }()
+	if err := dbClient.RunEmbeddedMigrations(ctx); err != nil {
+		return fmt.Errorf("failed to run database migrations: %w", err)
+	}
+
+	matched, err := dbClient.CountCalls(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if filter.IsEmpty() {
+		return fmt.Errorf("%d calls selected without a filter, select them with -all", matched)
+	}
+	if !opts.yes {
+		fmt.Printf("%d calls selected, run again with -yes to %s them\n", matched, action)
+		return nil
+	}
+
+	var changed int64
+	switch action {
+	case "delete":
+		changed, err = dbClient.DeleteCalls(ctx, filter)
+	case "restore":
+		changed, err = dbClient.RestoreCalls(ctx, filter)
+	case "tag":
+		changed, err = dbClient.TagCalls(ctx, filter, opts.tag)
+	case "untag":
+		changed, err = dbClient.UntagCalls(ctx, filter, opts.tag)
+	case "enrich":
+		changed, err = dbClient.EnrichCalls(ctx, filter, newEnricher(cfg))
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d of %d selected calls changed\n", changed, matched)
+	return nil
+}
+
+// newEnricher returns the number normalization and MSN detection the
+// callmonitor applies to new calls, for re-enriching stored calls
+func newEnricher(cfg *config.Config) func(event *types.CallEvent) {
+	// An unknown region was rejected by Validate, without one numbers are kept as they are
+	normalizer, _ := phone.NewNormalizer(cfg.PBX.Region, cfg.PBX.CountryCode, cfg.PBX.LocalAreaCode)
+	// Invalid MSNs were rejected by Validate as well
+	msns, msnNames, _ := cfg.GetMSNs()
+	return func(event *types.CallEvent) {
+		if normalizer != nil {
+			event.Caller = normalizer.Normalize(event.Caller)
+			event.Called = normalizer.Normalize(event.Called)
+		}
+		event.EnrichWithMSNs(msns, msnNames)
+	}
+}
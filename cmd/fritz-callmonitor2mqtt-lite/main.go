@@ -0,0 +1,117 @@
+// Command fritz-callmonitor2mqtt-lite is the announce-only variant of the bridge
+// for constrained devices such as OpenWrt routers. It only parses callmonitor
+// events, runs them through the state machine and publishes them to MQTT;
+// database, health check server and TR-064 are left out of the binary.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/app"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/config"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/scheduler"
+)
+
+var (
+	version = "dev"
+	commit  = "none"
+	date    = "unknown"
+)
+
+func main() {
+	var (
+		showVersion = flag.Bool("version", false, "Show version information")
+		help        = flag.Bool("help", false, "Show help")
+		configTest  = flag.Bool("config-test", false, "Test configuration and exit")
+	)
+	flag.Parse()
+
+	if *showVersion {
+		fmt.Printf("fritz-callmonitor2mqtt-lite %s (commit: %s, built: %s)\n", version, commit, date)
+		os.Exit(0)
+	}
+
+	if *help {
+		printUsage()
+		os.Exit(0)
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	if *configTest {
+		fmt.Println("Configuration is valid")
+		os.Exit(0)
+	}
+
+	log.Printf("Starting fritz-callmonitor2mqtt-lite %s...", version)
+	if cfg.FritzBox.DNDControl {
+		log.Println("DND control is not available in the lite build, ignoring FRITZ_CALLMONITOR_FRITZBOX_DND_CONTROL")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Only the MQTT client receives call events, without any further sinks
+	application, err := app.New(ctx, cfg, app.Options{Version: version})
+	if err != nil {
+		log.Fatalf("Failed to initialize application: %v", err)
+	}
+
+	// Pick up rotated MQTT credentials, e.g. short-lived tokens written by a secrets agent or renewed via OAuth
+	jobs := scheduler.New()
+	if (cfg.HasMQTTCredentialFiles() || cfg.HasMQTTOAuth()) && cfg.MQTT.CredentialsCheckInterval > 0 {
+		jobs.Every("mqtt-credentials", cfg.MQTT.CredentialsCheckInterval, application.ReloadMQTTCredentials)
+	}
+	// Switch the publishing profile on its schedule, e.g. no ringing at night
+	if len(cfg.MQTT.ProfileSchedule) > 0 {
+		jobs.Every("profile", time.Minute, application.MQTTClient().ApplyProfileSchedule)
+	}
+	jobs.Start(ctx)
+
+	go func() {
+		if err := application.Run(); err != nil {
+			log.Printf("Application error: %v", err)
+			cancel()
+		}
+	}()
+
+	// Wait for shutdown signal, SIGHUP reloads the configuration and re-reads the MQTT credential files
+	application.WaitForShutdown(ctx)
+
+	cancel()
+	jobs.Wait()
+	application.Shutdown()
+	log.Println("fritz-callmonitor2mqtt-lite stopped")
+}
+
+func printUsage() {
+	fmt.Printf(`Usage: fritz-callmonitor2mqtt-lite [OPTIONS]
+
+Announce-only build of fritz-callmonitor2mqtt for constrained devices. Call
+events are published to MQTT; there is no database, no health check server
+and no DND control.
+
+Options:
+  -version       Show version information
+  -help          Show this help message
+  -config-test   Test configuration and exit
+
+Configuration uses the same FRITZ_CALLMONITOR_FRITZBOX_*, FRITZ_CALLMONITOR_PBX_*,
+FRITZ_CALLMONITOR_MQTT_*, FRITZ_CALLMONITOR_APP_* and FRITZ_CALLMONITOR_OUTPUT_*
+environment variables as
+fritz-callmonitor2mqtt (see fritz-callmonitor2mqtt -help); database, health
+check and DND settings are ignored. SIGHUP reloads MSNs, extension names, tag
+rules and the log level.
+`)
+}
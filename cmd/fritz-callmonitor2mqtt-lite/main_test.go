@@ -0,0 +1,34 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// TestLiteDependencies guards the lite build against pulling in the heavy packages
+func TestLiteDependencies(t *testing.T) {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go tool not available")
+	}
+
+	out, err := exec.Command(goBin, "list", "-deps", ".").Output()
+	if err != nil {
+		t.Fatalf("go list failed: %v", err)
+	}
+
+	forbidden := []string{
+		"github.com/akentner/fritz-callmonitor2mqtt/internal/database",
+		"github.com/akentner/fritz-callmonitor2mqtt/internal/health",
+		"github.com/akentner/fritz-callmonitor2mqtt/internal/tr064",
+		"modernc.org/sqlite",
+	}
+	for _, dep := range strings.Fields(string(out)) {
+		for _, pkg := range forbidden {
+			if dep == pkg || strings.HasPrefix(dep, pkg+"/") {
+				t.Errorf("Lite build depends on %s", dep)
+			}
+		}
+	}
+}
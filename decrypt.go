@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/config"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/seal"
+)
+
+// runDecrypt implements the decrypt subcommand, which opens payloads
+// encrypted with FRITZ_CALLMONITOR_MQTT_ENCRYPTION_KEY or generates a new
+// key, and returns the exit code
+func runDecrypt(args []string) int {
+	flags := flag.NewFlagSet("decrypt", flag.ContinueOnError)
+	var (
+		keyText  = flags.String("key", "", "Base64 key (default: FRITZ_CALLMONITOR_MQTT_ENCRYPTION_KEY or _KEY_FILE)")
+		raw      = flags.Bool("raw", false, "Read a single binary payload instead of one hex encoded payload per line")
+		generate = flags.Bool("generate", false, "Print a new random key and exit")
+	)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: fritz-callmonitor2mqtt decrypt [flags]\n\nDecrypts payloads read from stdin, one hex encoded payload per line as printed by\n'mosquitto_sub -F %%x', and writes one plain payload per line.\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	if *generate {
+		key, err := seal.GenerateKey()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Decrypt failed: %v\n", err)
+			return 1
+		}
+		fmt.Println(key)
+		return 0
+	}
+
+	if err := decryptPayloads(*keyText, *raw, os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Decrypt failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// decryptPayloads opens the payloads of r with the key, the configured one if keyText is empty, and writes them to w
+func decryptPayloads(keyText string, raw bool, r io.Reader, w io.Writer) error {
+	key, err := decryptionKey(keyText)
+	if err != nil {
+		return err
+	}
+
+	if raw {
+		payload, err := io.ReadAll(r)
+		if err != nil {
+			return fmt.Errorf("failed to read payload: %w", err)
+		}
+		plaintext, err := seal.Open(key, payload)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(plaintext)
+		return err
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		payload, err := hex.DecodeString(line)
+		if err != nil {
+			return fmt.Errorf("invalid hex payload: %w", err)
+		}
+		plaintext, err := seal.Open(key, payload)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", plaintext); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// decryptionKey parses keyText or, if it is empty, returns the configured key
+func decryptionKey(keyText string) (seal.Key, error) {
+	if keyText != "" {
+		return seal.ParseKey(keyText)
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return seal.Key{}, fmt.Errorf("failed to load configuration: %w", err)
+	}
+	key, err := cfg.GetMQTTEncryptionKey()
+	if err != nil {
+		return seal.Key{}, err
+	}
+	if key == nil {
+		return seal.Key{}, fmt.Errorf("no key given, set -key or FRITZ_CALLMONITOR_MQTT_ENCRYPTION_KEY")
+	}
+	return *key, nil
+}
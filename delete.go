@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/config"
+)
+
+// runDeleteCalls implements the delete-call and restore-call subcommands,
+// which delete stored calls by ID or restore deleted ones, and returns the exit code
+func runDeleteCalls(command string, args []string) int {
+	restore := command == "restore-call"
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	flags.Usage = func() {
+		if restore {
+			fmt.Fprintf(flags.Output(), "Usage: fritz-callmonitor2mqtt restore-call ID...\n\nRestores deleted calls.\n")
+		} else {
+			fmt.Fprintf(flags.Output(), "Usage: fritz-callmonitor2mqtt delete-call ID...\n\nDeletes calls from listings, exports and reports. They can be restored with restore-call.\n")
+		}
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	if err := deleteCalls(flags.Args(), restore); err != nil {
+		fmt.Fprintf(os.Stderr, "%s failed: %v\n", command, err)
+		return 1
+	}
+	return 0
+}
+
+// deleteCalls deletes or restores the calls in the configured database
+func deleteCalls(ids []string, restore bool) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	dbClient, err := newDatabaseClient(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create database client: %w", err)
+	}
+	ctx := context.Background()
+	if err := dbClient.Connect(ctx); err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer func() { _ = dbClient.Close() }()
+	if err := dbClient.RunEmbeddedMigrations(ctx); err != nil {
+		return fmt.Errorf("failed to run database migrations: %w", err)
+	}
+
+	change, done := dbClient.DeleteCall, "Deleted"
+	if restore {
+		change, done = dbClient.RestoreCall, "Restored"
+	}
+	for _, id := range ids {
+		if err := change(ctx, id); err != nil {
+			return err
+		}
+		fmt.Printf("%s call %s\n", done, id)
+	}
+	return nil
+}
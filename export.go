@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/config"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/export"
+)
+
+// runExport implements the export subcommand, which writes the stored calls
+// of a period as CSV or JSON, and returns the exit code
+func runExport(args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	var (
+		from     = flags.String("from", "", "Export calls started at or after this date or time (default: all)")
+		to       = flags.String("to", "", "Export calls started before this date or time (default: now)")
+		format   = flags.String("format", export.FormatCSV, "Output format: csv or json")
+		columns  = flags.String("columns", "", "Comma-separated columns to export (default: "+strings.Join(export.Columns(), ",")+")")
+		timezone = flags.String("timezone", "", "Timezone of dates and exported times (default: FRITZ_CALLMONITOR_APP_TIMEZONE)")
+		output   = flags.String("output", "", "Write to this file instead of stdout")
+	)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: fritz-callmonitor2mqtt export [flags]\n\nExports the calls stored in the database.\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	if err := exportCalls(*from, *to, *format, *columns, *timezone, *output); err != nil {
+		fmt.Fprintf(os.Stderr, "Export failed: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// exportCalls reads the calls of the period from the configured database and writes them
+func exportCalls(from, to, format, columns, timezone, output string) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if timezone != "" {
+		cfg.App.Timezone = timezone
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	location, err := cfg.GetLocation()
+	if err != nil {
+		return err
+	}
+
+	opts := export.Options{Format: format, Location: location}
+	if columns != "" {
+		opts.Columns = strings.Split(columns, ",")
+	}
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	start, end := time.Unix(0, 0), time.Now()
+	if from != "" {
+		if start, err = export.ParseTime(from, location); err != nil {
+			return err
+		}
+	}
+	if to != "" {
+		if end, err = export.ParseTime(to, location); err != nil {
+			return err
+		}
+	}
+
+	dbClient, err := newDatabaseClient(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create database client: %w", err)
+	}
+	ctx := context.Background()
+	if err := dbClient.Connect(ctx); err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer func() { _ = dbClient.Close() }()
+	if err := dbClient.RunEmbeddedMigrations(ctx); err != nil {
+		return fmt.Errorf("failed to run database migrations: %w", err)
+	}
+
+	calls, err := dbClient.ListCalls(ctx, start, end)
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		return export.Write(os.Stdout, calls, opts)
+	}
+	file, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	if err := export.Write(file, calls, opts); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/config"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/health"
+)
+
+// runHealthcheck implements the healthcheck subcommand, which queries the
+// health endpoint of the running instance, e.g. as Docker HEALTHCHECK, and
+// returns the exit code
+func runHealthcheck(args []string) int {
+	flags := flag.NewFlagSet("healthcheck", flag.ContinueOnError)
+	var (
+		url     = flags.String("url", "", "Health endpoint (default: /readyz on FRITZ_CALLMONITOR_APP_HEALTH_CHECK_PORT of localhost)")
+		live    = flags.Bool("live", false, "Check liveness (/healthz) instead of readiness (/readyz)")
+		timeout = flags.Duration("timeout", 5*time.Second, "Maximum duration of the request")
+	)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: fritz-callmonitor2mqtt healthcheck [flags]\n\nExits with 0 if the running instance is ready, i.e. connected to the MQTT broker,\nthe database and the Fritz!Box, and with 1 otherwise.\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	target := *url
+	if target == "" {
+		var err error
+		if target, err = healthURL(*live); err != nil {
+			fmt.Fprintf(os.Stderr, "Healthcheck failed: %v\n", err)
+			return 1
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	response, err := probeHealth(ctx, target)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Healthcheck failed: %v\n", err)
+		return 1
+	}
+	fmt.Printf("%s (uptime %s)\n", response.Status, response.Uptime)
+	return 0
+}
+
+// healthURL returns the health endpoint of the configured health check port on localhost
+func healthURL(live bool) (string, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return "", fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if cfg.App.HealthCheckPort == 0 {
+		return "", fmt.Errorf("the health check port is disabled, set FRITZ_CALLMONITOR_APP_HEALTH_CHECK_PORT")
+	}
+	path := "/readyz"
+	if live {
+		path = "/healthz"
+	}
+	return fmt.Sprintf("http://127.0.0.1:%d%s", cfg.App.HealthCheckPort, path), nil
+}
+
+// probeHealth requests the health endpoint and returns its response if the
+// status is ok, or an error naming the failed checks
+func probeHealth(ctx context.Context, url string) (health.Response, error) {
+	var response health.Response
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return response, fmt.Errorf("invalid health endpoint: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return response, fmt.Errorf("failed to reach %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return response, fmt.Errorf("invalid response of %s (status %d): %w", url, resp.StatusCode, err)
+	}
+	if resp.StatusCode == http.StatusOK && response.Status == "ok" {
+		return response, nil
+	}
+
+	var failed []string
+	for name, result := range response.Checks {
+		if result.Status != "up" {
+			failed = append(failed, name+": "+result.Error)
+		}
+	}
+	slices.Sort(failed)
+	return response, fmt.Errorf("%s (%s)", response.Status, strings.Join(failed, ", "))
+}
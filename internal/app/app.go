@@ -0,0 +1,986 @@
+// Package app wires the callmonitor, the call state machine and the MQTT client
+// into the event loop shared by fritz-callmonitor2mqtt and its lite build. The
+// full build adds database, health check server and further sinks through
+// Extend; the package itself must not depend on them, so the lite binary stays small.
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/config"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/enrich"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/mqtt"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/oauth"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/phone"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/systemd"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/callmonitor"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/codec"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/eventbus"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/pipeline"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// Options configures the parts of the shared wiring that differ between the builds
+type Options struct {
+	Version string // Published with the service status
+
+	// DND switches call deflections via {prefix}/command/dnd (nil = DND control disabled)
+	DND mqtt.DeflectionService
+
+	// Timezone returns the timezone of callmonitor timestamps, e.g. detected
+	// via TR-064, given the configured one (nil = configured timezone)
+	Timezone func(configured *time.Location) *time.Location
+}
+
+// Extensions are the components of the full build around the shared event loop
+type Extensions struct {
+	Sinks []types.CallEventSink // Receive processed call events besides the MQTT client
+
+	// OnEvent is called for every callmonitor event before it is processed, e.g. for health checks
+	OnEvent func(event types.CallEvent)
+
+	// OnUnparsed is called for every unparsable callmonitor line besides publishing it
+	OnUnparsed func(line callmonitor.Unparsed)
+
+	// OnStart is called once connected to the MQTT broker, before the sinks start
+	OnStart func(ctx context.Context)
+
+	// OnReady is called once the callmonitor connected for the first time. It
+	// must not block, long running work like the backfill goes to the background.
+	OnReady func(ctx context.Context)
+
+	// OnStop is called when the shutdown begins, e.g. to stop HTTP servers
+	OnStop func(ctx context.Context)
+
+	// OnClose is called after the sinks drained and MQTT disconnected, e.g. to close the database
+	OnClose func(ctx context.Context)
+
+	// OnIncident is called after the connections were restarted because the pipeline stalled
+	OnIncident func(incident Incident)
+
+	// OnReload is called with the reloaded configuration after the shared
+	// components applied it, e.g. to update notification rules and retention
+	OnReload func(ctx context.Context, cfg *config.Config)
+}
+
+// Application holds the components shared by both builds
+type Application struct {
+	config            *config.Config
+	mqttClient        *mqtt.Client
+	tenants           *tenantRouter // Routes call events to the MQTT clients of the tenants, the rest to mqttClient
+	mqttToken         *oauth.Client // Source of the MQTT password if OAuth is enabled
+	callmonitorClient *callmonitor.Client
+	callManager       *types.CallManager
+	outputs           []types.CallEventSink // Configured outputs besides MQTT, delivered to in both builds
+	numbers           *phone.Formatter      // Number format of the events published to MQTT and the outputs
+	enrichHook        *enrich.Hook          // Adds custom fields to the call events, nil if not configured
+	pipeline          *pipeline.Pipeline
+	timezone          *time.Location
+	notifier          *systemd.Notifier
+	ext               Extensions
+	ready             bool
+	ctx               context.Context
+	cancel            context.CancelFunc
+	sinkCtx           context.Context    // Passed to the sinks, outlives ctx until the queues are drained
+	stopSinks         context.CancelFunc // Abandons publishes still in flight
+	done              chan struct{}      // Closed when Run returns
+	reconnects        atomic.Uint64      // Reconnect attempts to the Fritz!Box since the start
+	failuresMu        sync.Mutex
+	failures          map[callmonitor.FailureKind]uint64 // Failed connects to the Fritz!Box by kind
+	lastFailure       *callmonitor.ConnectFailure        // Last failed connect to the Fritz!Box, nil once connected
+	restarts          atomic.Uint64                      // Restarts of the connections after a stall
+	restart           chan Incident                      // Stall reported to the event loop by watchStalls
+	progress          atomic.Int64                       // Unix nanoseconds of the last event handled by the event loop
+	graceUntil        time.Time                          // End of the startup grace period, errors are only logged before
+	inconsistencies   chan error                         // Inconsistencies found in strict mode, handled by the event loop
+}
+
+// ReconnectStats counts the reconnect attempts of both connections since the start
+type ReconnectStats struct {
+	Callmonitor uint64 `json:"callmonitor"`
+	MQTT        uint64 `json:"mqtt"`
+
+	// Failed connects to the Fritz!Box by kind, and the failure of the current outage
+	CallmonitorFailures    map[callmonitor.FailureKind]uint64 `json:"callmonitor_failures,omitempty"`
+	CallmonitorLastFailure *callmonitor.ConnectFailure        `json:"callmonitor_last_failure,omitempty"`
+}
+
+// New wires up MQTT, callmonitor and call manager from the configuration
+func New(ctx context.Context, cfg *config.Config, opts Options) (*Application, error) {
+	topics, err := mqtt.ParseTopics(mqtt.TopicTemplates(cfg.MQTT.Topics))
+	if err != nil {
+		return nil, fmt.Errorf("invalid MQTT topic configuration: %w", err)
+	}
+	if cfg.App.Strict {
+		if err := checkStrict(cfg); err != nil {
+			return nil, err
+		}
+	}
+	historyFilter, err := cfg.GetHistoryFilter()
+	if err != nil {
+		return nil, fmt.Errorf("invalid call history filter: %w", err)
+	}
+	boxName := cfg.MQTT.BoxName
+	if boxName == "" {
+		boxName = cfg.FritzBox.Host
+	}
+	dndDeflections, err := cfg.GetDNDDeflections()
+	if err != nil {
+		return nil, err
+	}
+	// Brokers with token authentication expect the access token as password
+	var mqttToken *oauth.Client
+	if cfg.HasMQTTOAuth() {
+		mqttToken = oauth.NewClient(oauth.Options{
+			TokenURL:      cfg.MQTT.OAuth.TokenURL,
+			ClientID:      cfg.MQTT.OAuth.ClientID,
+			ClientSecret:  cfg.MQTT.OAuth.ClientSecret,
+			Scope:         cfg.MQTT.OAuth.Scope,
+			Audience:      cfg.MQTT.OAuth.Audience,
+			RefreshBefore: cfg.MQTT.OAuth.RefreshBefore,
+			Timeout:       cfg.MQTT.ConnectTimeout,
+		})
+	}
+	mqttUsername, mqttPassword, err := mqttCredentials(ctx, cfg, mqttToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Event topics are plain JSON unless CloudEvents are enabled for MQTT
+	eventSource := ""
+	if cfg.MQTT.CloudEvents {
+		eventSource = cfg.App.CloudEventsSource
+	}
+	payloadFormat, err := codec.Parse(cfg.MQTT.PayloadFormat, cfg.App.CloudEventsSource)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MQTT payload format: %w", err)
+	}
+	payloadFormats, err := mqtt.ParsePayloadFormats(cfg.MQTT.PayloadFormats, cfg.App.CloudEventsSource)
+	if err != nil {
+		return nil, err
+	}
+	encryptionKey, err := cfg.GetMQTTEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+	location, err := cfg.GetLocation()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load timezone: %w", err)
+	}
+	profiles, err := mqtt.ParseProfiles(cfg.MQTT.Profiles, cfg.MQTT.ProfileSchedule, location)
+	if err != nil {
+		return nil, err
+	}
+	tenants, err := cfg.GetMQTTTenants()
+	if err != nil {
+		return nil, err
+	}
+	brokers, err := cfg.GetMQTTBrokers()
+	if err != nil {
+		return nil, err
+	}
+
+	// The reload command is offered only with a config file, the environment of the process cannot change
+	var application *Application
+	var onReload func(ctx context.Context) error
+	if cfg.App.ConfigFile != "" {
+		onReload = func(ctx context.Context) error { return application.Reload(ctx) }
+	}
+
+	clientID, err := mqtt.SuffixClientID(cfg.MQTT.ClientID, cfg.MQTT.ClientIDSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	mqttOptions := mqtt.Options{
+		Broker:         cfg.MQTT.Broker,
+		Port:           cfg.MQTT.Port,
+		Brokers:        brokers,
+		Mirror:         cfg.MQTT.BrokerMode == "mirror",
+		Username:       mqttUsername,
+		Password:       mqttPassword,
+		ClientID:       clientID,
+		TopicPrefix:    cfg.MQTT.TopicPrefix,
+		QoS:            cfg.MQTT.QoS,
+		Retain:         cfg.MQTT.Retain,
+		KeepAlive:      cfg.MQTT.KeepAlive,
+		ConnectTimeout: cfg.MQTT.ConnectTimeout,
+		PublishTimeout: cfg.MQTT.PublishTimeout,
+		LogLevel:       cfg.App.LogLevel,
+		Topics:         topics,
+		Box:            boxName,
+		CallTopicTTL:   cfg.MQTT.CallTopicTTL,
+		RetainTopics:   mqtt.TopicRetain(cfg.MQTT.RetainTopics),
+		PublishTopics:  mqtt.TopicEnabled(cfg.MQTT.PublishTopics),
+		Version:        opts.Version,
+
+		PublishRate:      cfg.MQTT.PublishRate,
+		PublishBurst:     cfg.MQTT.PublishBurst,
+		PublishQueueSize: cfg.MQTT.PublishQueueSize,
+
+		CallHistorySize: cfg.App.CallHistorySize,
+		HistoryFilter:   historyFilter,
+
+		MissedCallMergeWindow: cfg.App.MissedCallMergeWindow,
+
+		MissedCallAckTimeout:   cfg.MQTT.MissedCallAckTimeout,
+		MissedCallAckRecipient: cfg.MQTT.MissedCallAckRecipient,
+
+		DND:            opts.DND,
+		DNDDeflections: dndDeflections,
+
+		Profiles:      profiles,
+		ProfileTopics: true,
+
+		OnReload: onReload,
+		OnConnectionChange: func(online bool, cause error) {
+			application.logConnection("mqtt", online, cause)
+		},
+
+		ElapsedInterval: cfg.MQTT.ElapsedInterval,
+
+		Reconnect: cfg.GetReconnectPolicy(),
+
+		PayloadFormat:     payloadFormat,
+		PayloadFormats:    payloadFormats,
+		CloudEventsSource: eventSource,
+		EncryptionKey:     encryptionKey,
+		SchemaVersion:     cfg.MQTT.SchemaVersion,
+
+		ACLSelfTest: cfg.MQTT.ACLSelfTest,
+	}
+	mqttClient := mqtt.NewClient(mqttOptions)
+
+	// Calls of the tenants' MSNs are published by their own clients below {prefix}/{tenant}
+	router := newTenantRouter(mqttClient, tenants, mqttOptions, func(connection string, online bool, cause error) {
+		application.logConnection(connection, online, cause)
+	})
+	for _, tenant := range tenants {
+		log.Printf("Publishing calls of MSNs %v below %s/%s", tenant.MSNs, cfg.MQTT.TopicPrefix, tenant.Name)
+	}
+
+	timezone, err := cfg.GetLocation()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load timezone: %w", err)
+	}
+	if opts.Timezone != nil {
+		timezone = opts.Timezone(timezone)
+	}
+	msns, msnNames, err := cfg.GetMSNs()
+	if err != nil {
+		return nil, err
+	}
+	extensionNames, err := cfg.GetExtensionNames()
+	if err != nil {
+		return nil, err
+	}
+	trunkNames, err := cfg.GetTrunkNames()
+	if err != nil {
+		return nil, err
+	}
+	extensionFilter, err := cfg.GetExtensionFilter()
+	if err != nil {
+		return nil, err
+	}
+	tagger, err := cfg.GetTagger()
+	if err != nil {
+		return nil, err
+	}
+	vips, err := cfg.GetVIPList()
+	if err != nil {
+		return nil, err
+	}
+	numbers, err := cfg.GetNumberFormatter()
+	if err != nil {
+		return nil, err
+	}
+	callmonitorClient, err := callmonitor.NewClient(callmonitor.Options{
+		Host:            cfg.FritzBox.Host,
+		Port:            cfg.FritzBox.Port,
+		Timezone:        timezone,
+		CountryCode:     cfg.PBX.CountryCode,
+		LocalAreaCode:   cfg.PBX.LocalAreaCode,
+		Region:          cfg.PBX.Region,
+		MSNs:            msns,
+		MSNNames:        msnNames,
+		DoNotRecord:     cfg.PBX.DoNotRecord,
+		TAMExtensions:   cfg.PBX.TAMExtensions,
+		ExtensionNames:  extensionNames,
+		TrunkNames:      trunkNames,
+		TrunkFilter:     cfg.GetTrunkFilter(),
+		ExtensionFilter: extensionFilter,
+		IgnoreInternal:  cfg.PBX.IgnoreInternal,
+		Tagger:          tagger,
+		VIPs:            vips,
+		OnRing: func(event types.CallEvent) {
+			if suppressRepeatCall(cfg, event) {
+				log.Printf("Not announcing repeat call %s, attempt %d of the caller", event.ID, event.RepeatCount)
+				return
+			}
+			if err := router.clientFor(event).PublishRinging(numbers.Format(event)); err != nil {
+				log.Printf("Failed to publish ringing message: %v", err)
+			}
+		},
+
+		TimestampPivotYear: cfg.FritzBox.TimestampPivotYear,
+		StrictTimestamps:   cfg.FritzBox.StrictTimestamps,
+		MaxTimestampSkew:   cfg.FritzBox.MaxTimestampSkew,
+
+		RingGroupWindow:   cfg.FritzBox.RingGroupWindow,
+		ForwardWindow:     cfg.FritzBox.ForwardWindow,
+		ForwardExtensions: cfg.FritzBox.ForwardExtensions,
+		RepeatCallWindow:  cfg.PBX.RepeatCallWindow,
+
+		Strict: cfg.App.Strict,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure callmonitor: %w", err)
+	}
+
+	if len(cfg.PBX.DoNotRecord) > 0 {
+		log.Printf("Calls of %d MSNs/extensions will not be recorded", len(cfg.PBX.DoNotRecord))
+	}
+
+	callManager := types.NewCallManagerWithMQTT(mqttClient, func(line int, oldStatus, newStatus types.CallStatus, event *types.CallEvent) {
+		log.Printf("Line %d status changed: %s -> %s", line, oldStatus, newStatus)
+	})
+	lineFinishTimeouts, err := cfg.GetLineFinishTimeouts()
+	if err != nil {
+		return nil, err
+	}
+	callManager.SetFinishTimeouts(cfg.App.FinishTimeout, lineFinishTimeouts)
+	if cfg.App.Strict {
+		callManager.SetInvalidEventHandler(func(event *types.CallEvent, err error) {
+			application.reportInconsistency(err)
+		})
+	}
+
+	// Outputs besides MQTT are available in both builds
+	outputs, err := newOutputs(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var enrichHook *enrich.Hook
+	if cfg.App.EnrichHook != "" {
+		enrichHook, err = enrich.New(enrich.Options{Target: cfg.App.EnrichHook, Timeout: cfg.App.EnrichTimeout})
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Enriching call events with hook, timeout %s", cfg.App.EnrichTimeout)
+	}
+
+	// Sinks get their own context, so publishes in flight are not abandoned when the application stops
+	runCtx, stopRun := context.WithCancel(ctx)
+	sinkCtx, stopSinks := context.WithCancel(context.Background())
+
+	application = &Application{
+		config:            cfg,
+		mqttClient:        mqttClient,
+		tenants:           router,
+		mqttToken:         mqttToken,
+		callmonitorClient: callmonitorClient,
+		callManager:       callManager,
+		outputs:           outputs,
+		numbers:           numbers,
+		enrichHook:        enrichHook,
+		pipeline:          newPipeline(callManager, numbers, router, outputs, nil),
+		timezone:          timezone,
+		notifier:          systemd.NewNotifier(),
+		ctx:               runCtx,
+		cancel:            stopRun,
+		sinkCtx:           sinkCtx,
+		stopSinks:         stopSinks,
+		done:              make(chan struct{}),
+		restart:           make(chan Incident, 1),
+		inconsistencies:   make(chan error, 1),
+		graceUntil:        time.Now().Add(cfg.App.StartupGrace),
+	}
+	return application, nil
+}
+
+// Extend adds the components of the full build; it must be called before Run
+func (app *Application) Extend(ext Extensions) {
+	app.ext = ext
+	app.pipeline = newPipeline(app.callManager, app.numbers, app.tenants, app.outputs, ext.Sinks)
+}
+
+// newPipeline creates the pipeline delivering processed events to MQTT and the further sinks.
+// MQTT and the outputs get the numbers in the payload number format, the sinks of the full
+// build, like the database and the notifications, keep matching on E.164 numbers.
+func newPipeline(callManager *types.CallManager, numbers *phone.Formatter, mqttSink types.CallEventSink, outputs, sinks []types.CallEventSink) *pipeline.Pipeline {
+	options := []pipeline.Option{pipeline.WithCallManager(callManager), pipeline.WithSink(formatNumbers(mqttSink, numbers))}
+	for _, output := range outputs {
+		options = append(options, pipeline.WithSink(formatNumbers(output, numbers)))
+	}
+	for _, sink := range sinks {
+		options = append(options, pipeline.WithSink(sink))
+	}
+	return pipeline.New(options...)
+}
+
+// numberSink hands the events to a sink with their numbers in the payload number format
+type numberSink struct {
+	sink    types.CallEventSink
+	numbers *phone.Formatter
+}
+
+// formatNumbers wraps a sink in the number format, unless the numbers stay in E.164
+func formatNumbers(sink types.CallEventSink, numbers *phone.Formatter) types.CallEventSink {
+	if numbers == nil || numbers.Unchanged() {
+		return sink
+	}
+	return numberSink{sink: sink, numbers: numbers}
+}
+
+func (s numberSink) PublishCallEvent(ctx context.Context, event types.CallEvent) error {
+	return s.sink.PublishCallEvent(ctx, s.numbers.Format(event))
+}
+
+// Unwrap returns the wrapped sink, which names the queue of the sink
+func (s numberSink) Unwrap() types.CallEventSink {
+	return s.sink
+}
+
+// suppressRepeatCall reports whether a repeat call is not announced or
+// notified; calls of VIPs always are
+func suppressRepeatCall(cfg *config.Config, event types.CallEvent) bool {
+	return cfg.PBX.SuppressRepeatCalls && event.RepeatCall && !event.Priority
+}
+
+// repeatCallSink hands the events of all calls but suppressed repeat calls to a sink
+type repeatCallSink struct {
+	sink types.CallEventSink
+	cfg  *config.Config
+}
+
+// SkipRepeatCalls wraps a notifying sink, so repeat calls are not notified
+// if suppressed by the configuration
+func SkipRepeatCalls(sink types.CallEventSink, cfg *config.Config) types.CallEventSink {
+	if !cfg.PBX.SuppressRepeatCalls {
+		return sink
+	}
+	return repeatCallSink{sink: sink, cfg: cfg}
+}
+
+func (s repeatCallSink) PublishCallEvent(ctx context.Context, event types.CallEvent) error {
+	if suppressRepeatCall(s.cfg, event) {
+		return nil
+	}
+	return s.sink.PublishCallEvent(ctx, event)
+}
+
+// Unwrap returns the wrapped sink, which names the queue of the sink
+func (s repeatCallSink) Unwrap() types.CallEventSink {
+	return s.sink
+}
+
+// MQTTClient returns the MQTT client
+func (app *Application) MQTTClient() *mqtt.Client {
+	return app.mqttClient
+}
+
+// CallmonitorClient returns the callmonitor client
+func (app *Application) CallmonitorClient() *callmonitor.Client {
+	return app.callmonitorClient
+}
+
+// RestoreCalls continues the calls that were active when the bridge stopped,
+// in the callmonitor client and the FSMs, and saves the active calls in the
+// store from now on. It must be called before Run.
+func (app *Application) RestoreCalls(ctx context.Context, store callmonitor.CallStore) error {
+	calls, err := app.callmonitorClient.RestoreCalls(ctx, store)
+	if err != nil {
+		return err
+	}
+	for _, call := range calls {
+		// Filtered calls never reach the FSMs
+		if !call.Filtered {
+			app.callManager.RestoreCall(call)
+		}
+	}
+	return nil
+}
+
+// ReconnectStats returns the reconnect attempts to the Fritz!Box and the MQTT broker
+func (app *Application) ReconnectStats() ReconnectStats {
+	stats := ReconnectStats{Callmonitor: app.reconnects.Load(), MQTT: app.mqttClient.Reconnects()}
+	app.failuresMu.Lock()
+	defer app.failuresMu.Unlock()
+	stats.CallmonitorFailures = maps.Clone(app.failures)
+	stats.CallmonitorLastFailure = app.lastFailure
+	return stats
+}
+
+// connectFailed records a failed connect to the Fritz!Box and reports
+// whether its kind differs from the previous failure of the outage
+func (app *Application) connectFailed(failure callmonitor.ConnectFailure) bool {
+	app.failuresMu.Lock()
+	defer app.failuresMu.Unlock()
+	if app.failures == nil {
+		app.failures = make(map[callmonitor.FailureKind]uint64)
+	}
+	app.failures[failure.Kind]++
+	changed := app.lastFailure == nil || app.lastFailure.Kind != failure.Kind
+	app.lastFailure = &failure
+	return changed
+}
+
+// connected ends the outage of the Fritz!Box connection
+func (app *Application) connected() {
+	app.failuresMu.Lock()
+	defer app.failuresMu.Unlock()
+	app.lastFailure = nil
+}
+
+// SinkStats returns the queue counters of the call event sinks
+func (app *Application) SinkStats() []eventbus.Stats {
+	return app.pipeline.Stats()
+}
+
+// GraceRemaining returns the rest of the startup grace period, 0 once it is over
+func (app *Application) GraceRemaining() time.Duration {
+	return max(time.Until(app.graceUntil), 0)
+}
+
+// Timezone returns the timezone of callmonitor timestamps
+func (app *Application) Timezone() *time.Location {
+	return app.timezone
+}
+
+// Run connects to the MQTT broker and forwards callmonitor events until the context is cancelled
+func (app *Application) Run() error {
+	defer close(app.done)
+
+	// Connect to MQTT broker
+	log.Println("Connecting to MQTT broker...")
+	if err := app.mqttClient.Connect(app.ctx); err != nil {
+		return fmt.Errorf("failed to connect to MQTT broker: %w", err)
+	}
+	if err := app.tenants.connect(app.ctx); err != nil {
+		return err
+	}
+	log.Println("Connected to MQTT broker")
+
+	if app.ext.OnStart != nil {
+		app.ext.OnStart(app.ctx)
+	}
+
+	// Sinks consume processed events in the background
+	app.pipeline.Start(app.sinkCtx)
+
+	// Restart the connections instead of waiting for an external supervisor when the pipeline stalls
+	if timeout := app.config.App.StallTimeout; timeout > 0 {
+		go app.watchStalls(app.ctx, timeout)
+	}
+
+	// Main connection loop, retries back off until connected again
+	retry := newReconnectStrategy(app.config.GetReconnectPolicy())
+	for {
+		select {
+		case <-app.ctx.Done():
+			return nil
+		default:
+		}
+
+		log.Println("Connecting to Fritz!Box callmonitor...")
+		if err := app.connectCallmonitor(); err != nil {
+			failure := callmonitor.NewConnectFailure(err, time.Now())
+			log.Printf("Failed to connect to Fritz!Box (%s): %v", failure.Kind, err)
+			_ = app.notifier.Status(fmt.Sprintf("Fritz!Box unreachable: %v", err))
+			app.publishFritzBoxStatus(false, err)
+
+			// A new kind of failure is explained once instead of on every attempt
+			if app.connectFailed(failure) {
+				if failure.Hint != "" {
+					log.Printf("Hint: %s", failure.Hint)
+				}
+				if app.GraceRemaining() == 0 {
+					if err := app.mqttClient.PublishError(app.ctx, failure); err != nil {
+						log.Printf("Failed to publish callmonitor connect failure: %v", err)
+					}
+				}
+			}
+
+			delay, ok := retry.Next(failure.Kind)
+			if !ok {
+				return fmt.Errorf("giving up connecting to Fritz!Box after %d attempts: %w", retry.Attempts(), err)
+			}
+			log.Printf("Retrying in %v (attempt %d)...", delay.Round(time.Millisecond), retry.Attempts())
+			if !app.wait(delay) {
+				return nil
+			}
+			app.reconnects.Add(1)
+			continue
+		}
+
+		log.Println("Connected to Fritz!Box callmonitor")
+		app.connected()
+		app.publishFritzBoxStatus(true, nil)
+		retry.Reset()
+		app.notifyReady()
+
+		// Process events until connection is lost
+		err := app.processEvents()
+		var stall *stallError
+		var strict *strictError
+		if err != nil && !errors.As(err, &stall) && !errors.As(err, &strict) {
+			log.Printf("Event processing error: %v", err)
+		}
+
+		// Clean up connection
+		if err := app.callmonitorClient.Disconnect(); err != nil {
+			log.Printf("Error disconnecting callmonitor: %v", err)
+		}
+
+		if app.ctx.Err() != nil {
+			return nil
+		}
+		if strict != nil {
+			return strict
+		}
+
+		// After a stall both connections start over right away
+		if stall != nil {
+			app.restartConnections(stall.incident)
+			retry.Reset()
+			continue
+		}
+
+		if err == nil {
+			err = errors.New("connection lost")
+		}
+		app.publishFritzBoxStatus(false, err)
+
+		// The first retry after a working connection is always allowed
+		delay, _ := retry.Next(callmonitor.FailureOther)
+		log.Printf("Connection lost, reconnecting in %v...", delay.Round(time.Millisecond))
+		_ = app.notifier.Status("Reconnecting to Fritz!Box")
+		if !app.wait(delay) {
+			return nil
+		}
+		app.reconnects.Add(1)
+	}
+}
+
+// publishFritzBoxStatus publishes whether the callmonitor is connected, apart
+// from the status of the bridge itself
+func (app *Application) publishFritzBoxStatus(online bool, cause error) {
+	app.logConnection("callmonitor", online, cause)
+	if err := app.mqttClient.PublishFritzBoxStatus(app.ctx, online, app.reconnects.Load(), cause); err != nil {
+		log.Printf("Failed to publish Fritz!Box status: %v", err)
+	}
+	app.tenants.each(func(client *mqtt.Client) {
+		if err := client.PublishFritzBoxStatus(app.ctx, online, app.reconnects.Load(), cause); err != nil {
+			log.Printf("Failed to publish Fritz!Box status of a tenant: %v", err)
+		}
+	})
+}
+
+// connectCallmonitor connects to the Fritz!Box, giving up after the configured connect timeout
+func (app *Application) connectCallmonitor() error {
+	ctx, cancel := context.WithTimeout(app.ctx, app.config.FritzBox.ConnectTimeout)
+	defer cancel()
+	return app.callmonitorClient.Connect(ctx)
+}
+
+// notifyReady tells systemd that MQTT and callmonitor are connected
+func (app *Application) notifyReady() {
+	_ = app.notifier.Status("Connected to Fritz!Box and MQTT broker")
+	if app.ready {
+		return
+	}
+	app.ready = true
+	if err := app.notifier.Ready(); err != nil {
+		log.Printf("Failed to notify systemd: %v", err)
+	}
+	if app.ext.OnReady != nil {
+		app.ext.OnReady(app.ctx)
+	}
+}
+
+// watchdogTicker returns a channel for systemd watchdog pings (nil if the watchdog is disabled)
+func (app *Application) watchdogTicker() (<-chan time.Time, func()) {
+	interval := app.notifier.WatchdogInterval()
+	if interval <= 0 {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(interval)
+	return ticker.C, ticker.Stop
+}
+
+// wait blocks for the given duration while keeping the watchdog alive.
+// It returns false if the application is shutting down.
+func (app *Application) wait(d time.Duration) bool {
+	watchdog, stop := app.watchdogTicker()
+	defer stop()
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-timer.C:
+			return true
+		case <-watchdog:
+			_ = app.notifier.Watchdog()
+		case <-app.ctx.Done():
+			return false
+		}
+	}
+}
+
+// processEvents handles incoming call events
+func (app *Application) processEvents() error {
+	// Watchdog pings are sent from the event loop so a hanging loop gets restarted by systemd
+	watchdog, stop := app.watchdogTicker()
+	defer stop()
+
+	app.progress.Store(time.Now().UnixNano())
+	for {
+		select {
+		case <-app.ctx.Done():
+			return nil
+
+		case <-watchdog:
+			if err := app.notifier.Watchdog(); err != nil {
+				log.Printf("Failed to send watchdog ping: %v", err)
+			}
+
+		case incident := <-app.restart:
+			return &stallError{incident: incident}
+
+		case event := <-app.callmonitorClient.Events():
+			log.Printf("Received call event: %s - %s -> %s (ID: %s,Type: %s, Line: %d, Trunk: %s)",
+				event.Timestamp.Format("15:04:05"),
+				event.Caller,
+				event.Called,
+				event.ID,
+				event.Type,
+				event.Line,
+				event.Trunk)
+			// The event is published without new fields if the hook fails
+			if app.enrichHook != nil {
+				if err := app.enrichHook.Enrich(app.ctx, &event); err != nil {
+					log.Printf("Failed to enrich call event %s: %v", event.ID, err)
+				}
+			}
+			if app.ext.OnEvent != nil {
+				app.ext.OnEvent(event)
+			}
+
+			// Process through FSM and hand the event to the sinks without waiting for them
+			app.pipeline.Process(event)
+			app.progress.Store(time.Now().UnixNano())
+
+		case rejection := <-app.callmonitorClient.Rejected():
+			if app.GraceRemaining() > 0 {
+				log.Printf("Rejected callmonitor line during the startup grace period: %s", rejection.Reason)
+				continue
+			}
+			if err := app.mqttClient.PublishError(app.ctx, rejection); err != nil {
+				log.Printf("Failed to publish rejected callmonitor line: %v", err)
+			}
+
+		case unparsed := <-app.callmonitorClient.Unparsed():
+			if app.ext.OnUnparsed != nil {
+				app.ext.OnUnparsed(unparsed)
+			}
+			if err := app.mqttClient.PublishUnparsed(app.ctx, unparsed); err != nil {
+				log.Printf("Failed to publish unparsed callmonitor line: %v", err)
+			}
+
+		case err := <-app.inconsistencies:
+			if err := app.inconsistent(err); err != nil {
+				return err
+			}
+
+		case err := <-app.callmonitorClient.Errors():
+			if errors.Is(err, callmonitor.ErrUnknownCall) {
+				if err := app.inconsistent(err); err != nil {
+					return err
+				}
+				continue
+			}
+			return fmt.Errorf("callmonitor error: %w", err)
+		}
+	}
+}
+
+// ReloadMQTTCredentials re-reads the credential files, renews an expiring
+// access token and reconnects to the broker if the credentials changed
+func (app *Application) ReloadMQTTCredentials(ctx context.Context) error {
+	username, password, err := mqttCredentials(ctx, app.config, app.mqttToken)
+	if err != nil {
+		return err
+	}
+	if err := app.mqttClient.UpdateCredentials(ctx, username, password); err != nil {
+		return err
+	}
+	return app.tenants.updateCredentials(ctx, username, password)
+}
+
+// Reload loads the configuration again and applies the settings that can
+// change at runtime: MSNs, extension names, tag rules, VIPs and the log level, plus
+// whatever the OnReload extension applies. Other settings need a restart. An
+// invalid configuration is rejected as a whole.
+func (app *Application) Reload(ctx context.Context) error {
+	cfg, err := config.LoadConfig()
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reload configuration: %w", err)
+	}
+	msns, msnNames, err := cfg.GetMSNs()
+	if err != nil {
+		return err
+	}
+	extensionNames, err := cfg.GetExtensionNames()
+	if err != nil {
+		return err
+	}
+	tagger, err := cfg.GetTagger()
+	if err != nil {
+		return err
+	}
+	vips, err := cfg.GetVIPList()
+	if err != nil {
+		return err
+	}
+
+	app.callmonitorClient.Reload(callmonitor.Settings{MSNs: msns, MSNNames: msnNames, ExtensionNames: extensionNames, Tagger: tagger, VIPs: vips})
+	app.mqttClient.SetLogLevel(cfg.App.LogLevel)
+	app.tenants.each(func(client *mqtt.Client) { client.SetLogLevel(cfg.App.LogLevel) })
+	if app.ext.OnReload != nil {
+		app.ext.OnReload(ctx, cfg)
+	}
+	log.Printf("Configuration reloaded: %d MSNs, %d extension names, log level %s", len(msns), len(extensionNames), cfg.App.LogLevel)
+	return nil
+}
+
+// WaitForShutdown blocks until SIGINT or SIGTERM is received or ctx is done.
+// SIGHUP reloads the configuration and re-reads the MQTT credential files in the meantime.
+func (app *Application) WaitForShutdown(ctx context.Context) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	defer signal.Stop(sigChan)
+	defer signal.Stop(hupChan)
+
+	for {
+		select {
+		case <-hupChan:
+			log.Println("Received SIGHUP, reloading configuration and MQTT credentials...")
+			go func() {
+				if err := app.Reload(ctx); err != nil {
+					log.Printf("Failed to reload configuration: %v", err)
+				}
+				if err := app.ReloadMQTTCredentials(ctx); err != nil {
+					log.Printf("Failed to reload MQTT credentials: %v", err)
+				}
+			}()
+		case sig := <-sigChan:
+			log.Printf("Received signal %v, shutting down gracefully...", sig)
+			return
+		case <-ctx.Done():
+			log.Println("Context cancelled, shutting down...")
+			return
+		}
+	}
+}
+
+// mqttCredentials returns the configured MQTT credentials, with the access token as password if token is set
+func mqttCredentials(ctx context.Context, cfg *config.Config, token *oauth.Client) (string, string, error) {
+	username, password, err := cfg.GetMQTTCredentials()
+	if err != nil || token == nil {
+		return username, password, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.MQTT.ConnectTimeout)
+	defer cancel()
+	accessToken, err := token.Token(ctx)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to fetch MQTT access token: %w", err)
+	}
+	return username, accessToken.AccessToken, nil
+}
+
+// Shutdown stops accepting callmonitor events, flushes the queued events to the
+// sinks within the shutdown timeout and only then disconnects
+func (app *Application) Shutdown() {
+	log.Println("Shutting down application...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), app.config.App.ShutdownTimeout)
+	defer cancel()
+
+	_ = app.notifier.Stopping()
+	if app.ext.OnStop != nil {
+		app.ext.OnStop(ctx)
+	}
+
+	// Stop reading from the Fritz!Box and wait for the event loop to exit
+	if err := app.callmonitorClient.Disconnect(); err != nil {
+		log.Printf("Error disconnecting callmonitor: %v", err)
+	}
+	app.cancel()
+	select {
+	case <-app.done:
+	case <-ctx.Done():
+		log.Println("Event loop did not stop within the shutdown timeout")
+	}
+
+	// Events received before the disconnect are still processed
+	app.drainCallmonitor()
+	app.callManager.Cleanup()
+
+	// Let the sinks drain their queues while MQTT and database are still available
+	if err := app.pipeline.Shutdown(ctx); err != nil {
+		log.Printf("Sinks did not finish within the shutdown timeout: %v", err)
+	}
+	app.stopSinks()
+	closeOutputs(app.outputs)
+	for _, stats := range app.pipeline.Stats() {
+		if stats.Dropped > 0 {
+			log.Printf("Sink %s dropped %d of %d call events", stats.Name, stats.Dropped, stats.Delivered+stats.Dropped)
+		}
+	}
+
+	if err := app.mqttClient.Disconnect(); err != nil {
+		log.Printf("Error disconnecting MQTT: %v", err)
+	}
+	if err := app.tenants.disconnect(); err != nil {
+		log.Printf("Error disconnecting MQTT tenants: %v", err)
+	}
+	if stats := app.mqttClient.PublishStats(); stats.Queued > 0 || stats.Dropped > 0 {
+		log.Printf("MQTT publish rate limit delayed %d messages (%d coalesced, %d dropped)", stats.Queued, stats.Coalesced, stats.Dropped)
+	}
+
+	if app.ext.OnClose != nil {
+		app.ext.OnClose(ctx)
+	}
+}
+
+// drainCallmonitor processes the events still buffered by the callmonitor client
+func (app *Application) drainCallmonitor() {
+	for {
+		select {
+		case event := <-app.callmonitorClient.Events():
+			log.Printf("Processing buffered call event %s (ID: %s, Line: %d)", event.Type, event.ID, event.Line)
+			app.pipeline.Process(event)
+		default:
+			return
+		}
+	}
+}
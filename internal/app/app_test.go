@@ -0,0 +1,309 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/broker"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/config"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/simulator"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/callmonitor"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// recordingSink records the call events it receives
+type recordingSink struct {
+	mu     sync.Mutex
+	events []types.CallEvent
+}
+
+func (s *recordingSink) PublishCallEvent(_ context.Context, event types.CallEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+	return nil
+}
+
+func (s *recordingSink) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.events)
+}
+
+// testConfig returns the default configuration pointed to an embedded broker and a simulated Fritz!Box
+func testConfig(t *testing.T, steps []simulator.Step) *config.Config {
+	t.Helper()
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	b, err := broker.New()
+	if err != nil {
+		t.Fatalf("Failed to create broker: %v", err)
+	}
+	cfg.MQTT.Broker, cfg.MQTT.Port, err = b.Start()
+	if err != nil {
+		t.Fatalf("Failed to start broker: %v", err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+
+	server := simulator.NewServer(steps, 0)
+	cfg.FritzBox.Host, cfg.FritzBox.Port, err = server.Start()
+	if err != nil {
+		t.Fatalf("Failed to start simulation: %v", err)
+	}
+	t.Cleanup(func() { _ = server.Close() })
+	return cfg
+}
+
+func TestRunDeliversToExtensions(t *testing.T) {
+	cfg := testConfig(t, []simulator.Step{
+		{Message: "RING;0;01701234567;990133;SIP0;"},
+		{Message: "DISCONNECT;0;0;"},
+		{Message: "NOT A CALLMONITOR LINE"},
+	})
+
+	application, err := New(context.Background(), cfg, Options{Version: "test"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	sink := &recordingSink{}
+	var mu sync.Mutex
+	var seen, unparsed int
+	started, ready, stopped, closed := false, false, false, false
+	application.Extend(Extensions{
+		Sinks:      []types.CallEventSink{sink},
+		OnEvent:    func(types.CallEvent) { mu.Lock(); seen++; mu.Unlock() },
+		OnUnparsed: func(callmonitor.Unparsed) { mu.Lock(); unparsed++; mu.Unlock() },
+		OnStart:    func(context.Context) { started = true },
+		OnReady:    func(context.Context) { ready = true },
+		OnStop:     func(context.Context) { stopped = true },
+		OnClose:    func(context.Context) { closed = true },
+	})
+
+	go func() { _ = application.Run() }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for sink.count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	application.Shutdown()
+
+	if sink.count() != 2 {
+		t.Errorf("Expected 2 call events in the extension sink, got %d", sink.count())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if seen != 2 || unparsed != 1 {
+		t.Errorf("Expected 2 events and 1 unparsed line, got %d and %d", seen, unparsed)
+	}
+	if !started || !ready || !stopped || !closed {
+		t.Errorf("Expected all lifecycle hooks to run, got start=%v ready=%v stop=%v close=%v", started, ready, stopped, closed)
+	}
+}
+
+func TestShutdownWithoutRun(t *testing.T) {
+	cfg := testConfig(t, nil)
+	cfg.App.ShutdownTimeout = 100 * time.Millisecond
+
+	application, err := New(context.Background(), cfg, Options{})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	closed := false
+	application.Extend(Extensions{OnClose: func(context.Context) { closed = true }})
+
+	done := make(chan struct{})
+	go func() {
+		application.Shutdown()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown without Run did not return")
+	}
+	if !closed {
+		t.Error("Expected OnClose to run")
+	}
+}
+
+func TestReload(t *testing.T) {
+	cfg := testConfig(t, nil)
+
+	application, err := New(context.Background(), cfg, Options{})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	var reloaded *config.Config
+	application.Extend(Extensions{OnReload: func(_ context.Context, cfg *config.Config) { reloaded = cfg }})
+
+	t.Setenv("FRITZ_CALLMONITOR_PBX_MSN", "990133")
+	if err := application.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if reloaded == nil || len(reloaded.PBX.MSN) != 1 {
+		t.Fatalf("Expected OnReload with the reloaded MSNs, got %v", reloaded)
+	}
+
+	// An invalid configuration is rejected before anything is applied
+	reloaded = nil
+	t.Setenv("FRITZ_CALLMONITOR_PBX_TAG_RULES", "spam")
+	if err := application.Reload(context.Background()); err == nil {
+		t.Error("Expected an invalid configuration to be rejected")
+	}
+	if reloaded != nil {
+		t.Error("Expected OnReload not to run for an invalid configuration")
+	}
+}
+
+func TestReconnectAfterDroppedConnection(t *testing.T) {
+	cfg := testConfig(t, []simulator.Step{
+		{Message: "RING;0;01701234567;990133;SIP0;"},
+		{Message: "DISCONNECT;0;0;"},
+		{Disconnect: true},
+		{Message: "CALL;1;2;990133;01701234567;SIP0;"},
+		{Message: "DISCONNECT;1;0;"},
+	})
+	cfg.App.ReconnectDelay = 10 * time.Millisecond
+
+	application, err := New(context.Background(), cfg, Options{})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	sink := &recordingSink{}
+	application.Extend(Extensions{Sinks: []types.CallEventSink{sink}})
+
+	go func() { _ = application.Run() }()
+	defer application.Shutdown()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for sink.count() < 4 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if sink.count() != 4 {
+		t.Fatalf("Expected the 4 call events of both connections, got %d", sink.count())
+	}
+	if stats := application.ReconnectStats(); stats.Callmonitor == 0 {
+		t.Errorf("Expected a reconnect to the callmonitor, got %+v", stats)
+	}
+}
+
+func TestRestartAfterStall(t *testing.T) {
+	cfg := testConfig(t, []simulator.Step{
+		{Message: "RING;0;01701234567;990133;SIP0;"},
+		{Message: "DISCONNECT;0;0;"},
+	})
+	cfg.App.StallTimeout = 100 * time.Millisecond
+
+	application, err := New(context.Background(), cfg, Options{})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	// The first event blocks the event loop while the second one waits
+	release := make(chan struct{})
+	var once sync.Once
+	incidents := make(chan Incident, 10)
+	application.Extend(Extensions{
+		OnEvent:    func(types.CallEvent) { once.Do(func() { <-release }) },
+		OnIncident: func(incident Incident) { incidents <- incident },
+	})
+
+	go func() { _ = application.Run() }()
+	defer application.Shutdown()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(application.restart) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(application.restart) == 0 {
+		close(release)
+		t.Fatal("Expected the stall to be detected")
+	}
+	close(release)
+
+	select {
+	case incident := <-incidents:
+		if incident.Reason != IncidentStalledEvents || incident.PendingEvents != 1 || incident.Restarts != 1 {
+			t.Errorf("Expected the first restart after 1 waiting event, got %+v", incident)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the restart")
+	}
+	if application.Restarts() != 1 {
+		t.Errorf("Expected 1 restart, got %d", application.Restarts())
+	}
+}
+
+func TestStrictMode(t *testing.T) {
+	cfg := testConfig(t, []simulator.Step{
+		{Message: "RING;0;01701234567;990133;SIP0;"},
+		{Message: "DISCONNECT;0;0;"},
+		{Message: "DISCONNECT;3;0;"},
+	})
+	cfg.App.Strict = true
+
+	cfg.MQTT.Topics.Call = "{{.Prefix}}/{{.MSN}}/call/{{.ID}}"
+	if _, err := New(context.Background(), cfg, Options{}); err == nil {
+		t.Error("Expected MSN topics without MSNs to be rejected in strict mode")
+	}
+	cfg.MQTT.Topics.Call = ""
+
+	application, err := New(context.Background(), cfg, Options{})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	sink := &recordingSink{}
+	application.Extend(Extensions{Sinks: []types.CallEventSink{sink}})
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- application.Run() }()
+
+	select {
+	case err := <-runErr:
+		if !errors.Is(err, callmonitor.ErrUnknownCall) {
+			t.Errorf("Expected Run to stop on the unknown DISCONNECT, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for strict mode to stop the bridge")
+	}
+
+	// Events received before the inconsistency are still delivered
+	application.Shutdown()
+	if sink.count() != 2 {
+		t.Errorf("Expected the known call to be delivered, got %d events", sink.count())
+	}
+}
+
+func TestSkipRepeatCalls(t *testing.T) {
+	cfg := &config.Config{}
+	sink := &recordingSink{}
+	if SkipRepeatCalls(sink, cfg) != sink {
+		t.Error("Expected the sink to be used as is without suppression")
+	}
+
+	cfg.PBX.SuppressRepeatCalls = true
+	skipping := SkipRepeatCalls(sink, cfg)
+	events := []types.CallEvent{
+		{ID: "first", Type: types.CallTypeDisconnect},
+		{ID: "repeat", Type: types.CallTypeDisconnect, RepeatCall: true, RepeatCount: 2},
+		{ID: "vip", Type: types.CallTypeDisconnect, RepeatCall: true, RepeatCount: 3, Priority: true},
+	}
+	for _, event := range events {
+		if err := skipping.PublishCallEvent(context.Background(), event); err != nil {
+			t.Fatalf("PublishCallEvent failed: %v", err)
+		}
+	}
+	if sink.count() != 2 || sink.events[0].ID != "first" || sink.events[1].ID != "vip" {
+		t.Errorf("Expected the repeat call to be skipped except for VIPs, got %+v", sink.events)
+	}
+}
@@ -0,0 +1,109 @@
+package app
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/config"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/output"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// newOutputs creates the configured call event outputs besides MQTT
+func newOutputs(cfg *config.Config) ([]types.CallEventSink, error) {
+	var outputs []types.CallEventSink
+	if cfg.Output.Stdout {
+		outputs = append(outputs, output.NewWriter(os.Stdout))
+		log.Println("Writing call events as JSON lines to standard output")
+	}
+	if cfg.Output.File != "" {
+		file, err := output.NewFile(output.FileOptions{
+			Path:     cfg.Output.File,
+			MaxSize:  int64(cfg.Output.FileMaxSize) << 20,
+			MaxFiles: cfg.Output.FileMaxFiles,
+		})
+		if err != nil {
+			closeOutputs(outputs)
+			return nil, err
+		}
+		outputs = append(outputs, file)
+		log.Printf("Writing call events as JSON lines to %s", cfg.Output.File)
+	}
+	if cfg.Output.WebhookURL != "" {
+		webhook, err := output.NewWebhook(output.WebhookOptions{
+			URL:     cfg.Output.WebhookURL,
+			Token:   cfg.Output.WebhookToken,
+			Timeout: cfg.Output.WebhookTimeout,
+		})
+		if err != nil {
+			closeOutputs(outputs)
+			return nil, fmt.Errorf("failed to configure webhook output: %w", err)
+		}
+		outputs = append(outputs, webhook)
+		log.Printf("Posting call events to %s", cfg.Output.WebhookURL)
+	}
+	if cfg.Output.LogURL != "" {
+		labels, err := cfg.GetLogLabels()
+		if err != nil {
+			closeOutputs(outputs)
+			return nil, err
+		}
+		logs, err := output.NewLogs(output.LogsOptions{
+			URL:     cfg.Output.LogURL,
+			Format:  cfg.Output.LogFormat,
+			Labels:  labels,
+			Token:   cfg.Output.LogToken,
+			Tenant:  cfg.Output.LogTenant,
+			Timeout: cfg.Output.LogTimeout,
+		})
+		if err != nil {
+			closeOutputs(outputs)
+			return nil, fmt.Errorf("failed to configure log shipping: %w", err)
+		}
+		outputs = append(outputs, logs)
+		log.Printf("Shipping call and connection event logs to %s", cfg.Output.LogURL)
+	}
+	if cfg.Output.AMIPort > 0 {
+		ami, err := output.NewAMI(output.AMIOptions{
+			Address:  net.JoinHostPort("", strconv.Itoa(cfg.Output.AMIPort)),
+			Username: cfg.Output.AMIUsername,
+			Secret:   cfg.Output.AMISecret,
+		})
+		if err != nil {
+			closeOutputs(outputs)
+			return nil, fmt.Errorf("failed to configure AMI output: %w", err)
+		}
+		outputs = append(outputs, ami)
+		log.Printf("Serving call events to Asterisk Manager Interface clients on port %d", cfg.Output.AMIPort)
+	}
+	return outputs, nil
+}
+
+// connectionLogger is an output that also logs the connections to the Fritz!Box and the broker
+type connectionLogger interface {
+	LogConnection(connection string, online bool, cause error)
+}
+
+// logConnection passes a connection that was established or lost to the outputs logging connections
+func (app *Application) logConnection(connection string, online bool, cause error) {
+	for _, out := range app.outputs {
+		if logger, ok := out.(connectionLogger); ok {
+			logger.LogConnection(connection, online, cause)
+		}
+	}
+}
+
+// closeOutputs closes the outputs holding resources, e.g. files
+func closeOutputs(outputs []types.CallEventSink) {
+	for _, out := range outputs {
+		if closer, ok := out.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.Printf("Error closing output: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package app
+
+import (
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/backoff"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/callmonitor"
+)
+
+// reconnectStrategy hands out the delays between connects to the Fritz!Box
+// adapted to why the last connect failed. A refused connection will not
+// succeed until the callmonitor is enabled, so it waits the maximum delay; a
+// timeout, e.g. while the Fritz!Box reboots, is retried at the initial delay.
+// Other failures, including DNS errors, back off as configured. The maximum
+// number of attempts counts all failures together.
+type reconnectStrategy struct {
+	policy   backoff.Policy
+	retries  map[callmonitor.FailureKind]*backoff.Backoff
+	attempts int
+}
+
+// newReconnectStrategy creates a strategy at its first attempt
+func newReconnectStrategy(policy backoff.Policy) *reconnectStrategy {
+	return &reconnectStrategy{policy: policy, retries: make(map[callmonitor.FailureKind]*backoff.Backoff)}
+}
+
+// Next returns the delay before the next attempt after a failure of the
+// kind. It reports false once the maximum number of attempts is used up.
+func (s *reconnectStrategy) Next(kind callmonitor.FailureKind) (time.Duration, bool) {
+	if s.policy.MaxAttempts > 0 && s.attempts >= s.policy.MaxAttempts {
+		return 0, false
+	}
+	s.attempts++
+
+	retry, ok := s.retries[kind]
+	if !ok {
+		policy := s.policy
+		policy.MaxAttempts = 0
+		switch kind {
+		case callmonitor.FailureRefused:
+			policy.Initial = policy.Max
+		case callmonitor.FailureTimeout:
+			policy.Max = policy.Initial
+		}
+		retry = backoff.New(policy)
+		s.retries[kind] = retry
+	}
+	delay, _ := retry.Next()
+	return delay, true
+}
+
+// Reset starts over with the initial delays, e.g. after a successful connect
+func (s *reconnectStrategy) Reset() {
+	s.attempts = 0
+	clear(s.retries)
+}
+
+// Attempts returns the number of delays handed out since the last reset
+func (s *reconnectStrategy) Attempts() int {
+	return s.attempts
+}
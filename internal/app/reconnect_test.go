@@ -0,0 +1,38 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/backoff"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/callmonitor"
+)
+
+func TestReconnectStrategy(t *testing.T) {
+	retry := newReconnectStrategy(backoff.Policy{Initial: time.Second, Max: time.Minute, Multiplier: 2, MaxAttempts: 5})
+
+	steps := []struct {
+		kind  callmonitor.FailureKind
+		delay time.Duration
+	}{
+		{callmonitor.FailureTimeout, time.Second},
+		{callmonitor.FailureTimeout, time.Second}, // Timeouts are retried quickly
+		{callmonitor.FailureRefused, time.Minute}, // A closed callmonitor port waits long
+		{callmonitor.FailureDNS, time.Second},
+		{callmonitor.FailureDNS, 2 * time.Second}, // Others back off as configured
+	}
+	for i, step := range steps {
+		delay, ok := retry.Next(step.kind)
+		if !ok || delay != step.delay {
+			t.Errorf("Attempt %d (%s): expected %v, got %v (ok %v)", i+1, step.kind, step.delay, delay, ok)
+		}
+	}
+	if _, ok := retry.Next(callmonitor.FailureTimeout); ok {
+		t.Errorf("Expected to give up after 5 attempts of all kinds")
+	}
+
+	retry.Reset()
+	if delay, ok := retry.Next(callmonitor.FailureDNS); !ok || delay != time.Second {
+		t.Errorf("Expected the initial delay after a reset, got %v (ok %v)", delay, ok)
+	}
+}
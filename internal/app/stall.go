@@ -0,0 +1,118 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Reasons of an incident
+const (
+	IncidentStalledEvents    = "stalled_events"    // Call events waited unprocessed for the stall timeout
+	IncidentFailingPublishes = "failing_publishes" // No MQTT publish was acknowledged for the stall timeout
+)
+
+// Incident reports a restart of the connections by the stall watchdog
+type Incident struct {
+	Reason        string         `json:"reason"`         // IncidentStalledEvents or IncidentFailingPublishes
+	Since         time.Time      `json:"since"`          // Last progress of the event loop or first failed publish
+	Time          time.Time      `json:"time"`           // Start of the restart
+	PendingEvents int            `json:"pending_events"` // Call events waiting for the event loop
+	Restarts      uint64         `json:"restarts"`       // Restarts since the start, including this one
+	Reconnects    ReconnectStats `json:"reconnects"`
+}
+
+// stallError ends the event loop to restart the connections
+type stallError struct {
+	incident Incident
+}
+
+func (e *stallError) Error() string {
+	return fmt.Sprintf("pipeline stalled (%s since %s)", e.incident.Reason, e.incident.Since.Format(time.TimeOnly))
+}
+
+// watchStalls checks the pipeline until ctx is done and asks the event loop
+// to restart the connections when it stalled. An event loop that is stuck
+// for good cannot take the request; it stops the systemd watchdog pings instead.
+// Connections still settling in the startup grace period are not checked.
+func (app *Application) watchStalls(ctx context.Context, timeout time.Duration) {
+	ticker := time.NewTicker(timeout / 5)
+	defer ticker.Stop()
+
+	idle := time.Now() // Last check without waiting events
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if app.GraceRemaining() > 0 {
+				idle = now
+				continue
+			}
+			incident, stalled := app.checkStall(now, &idle, timeout)
+			if !stalled {
+				continue
+			}
+			select {
+			case app.restart <- incident:
+				log.Printf("Pipeline stalled (%s since %s), restarting the connections", incident.Reason, incident.Since.Format(time.DateTime))
+			default:
+				// A restart is already waiting for the event loop
+			}
+		}
+	}
+}
+
+// checkStall reports an incident if call events waited unprocessed or
+// publishes failed for the timeout. idle is the last check without waiting
+// events, so a call arriving after a quiet hour does not look stalled.
+func (app *Application) checkStall(now time.Time, idle *time.Time, timeout time.Duration) (Incident, bool) {
+	pending := app.callmonitorClient.Pending()
+	if pending == 0 {
+		*idle = now
+	}
+	since := time.Unix(0, app.progress.Load())
+	if idle.After(since) {
+		since = *idle
+	}
+	if pending > 0 && now.Sub(since) >= timeout {
+		return Incident{Reason: IncidentStalledEvents, Since: since, PendingEvents: pending}, true
+	}
+
+	if failing := app.mqttClient.PublishFailingSince(); !failing.IsZero() && now.Sub(failing) >= timeout {
+		return Incident{Reason: IncidentFailingPublishes, Since: failing, PendingEvents: pending}, true
+	}
+	return Incident{}, false
+}
+
+// restartConnections reconnects to the MQTT broker after a stall and
+// publishes the incident. The Fritz!Box connection was already closed by
+// the event loop and is opened again by Run; events it received meanwhile
+// stay queued and are processed after the restart.
+func (app *Application) restartConnections(incident Incident) {
+	incident.Time = time.Now()
+	incident.Restarts = app.restarts.Add(1)
+	_ = app.notifier.Status(fmt.Sprintf("Restarting after a stall: %s", incident.Reason))
+
+	ctx, cancel := context.WithTimeout(app.ctx, app.config.MQTT.ConnectTimeout)
+	defer cancel()
+	if err := app.mqttClient.Restart(ctx); err != nil {
+		log.Printf("Failed to restart the MQTT connection, reconnecting in the background: %v", err)
+	}
+	app.progress.Store(time.Now().UnixNano())
+
+	incident.Reconnects = app.ReconnectStats()
+	if err := app.mqttClient.PublishIncident(app.ctx, incident); err != nil {
+		log.Printf("Failed to publish incident: %v", err)
+	}
+	if app.ext.OnIncident != nil {
+		app.ext.OnIncident(incident)
+	}
+	log.Printf("Restart %d after a stall finished in %v", incident.Restarts, time.Since(incident.Time).Round(time.Millisecond))
+}
+
+// Restarts returns the number of restarts after a stall since the start
+func (app *Application) Restarts() uint64 {
+	return app.restarts.Load()
+}
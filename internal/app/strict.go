@@ -0,0 +1,65 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/config"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/mqtt"
+)
+
+// Inconsistency is published on the error topic before strict mode stops the bridge
+type Inconsistency struct {
+	Kind  string    `json:"kind"` // Always "inconsistency"
+	Error string    `json:"error"`
+	Time  time.Time `json:"time"`
+}
+
+// strictError ends the event loop on an inconsistency in strict mode
+type strictError struct {
+	err error
+}
+
+func (e *strictError) Error() string {
+	return fmt.Sprintf("strict mode: %v", e.err)
+}
+
+func (e *strictError) Unwrap() error {
+	return e.err
+}
+
+// checkStrict finds inconsistencies of the configuration that strict mode does not start with
+func checkStrict(cfg *config.Config) error {
+	if len(cfg.PBX.MSN) == 0 {
+		if names := mqtt.TopicTemplates(cfg.MQTT.Topics).UsingMSN(); len(names) > 0 {
+			return fmt.Errorf("strict mode: the topics %s use {{.MSN}}, but FRITZ_CALLMONITOR_PBX_MSN is empty, so it would always be empty", strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+// reportInconsistency hands an inconsistency found while processing an event
+// to the event loop; a second one before the loop ends adds nothing
+func (app *Application) reportInconsistency(err error) {
+	select {
+	case app.inconsistencies <- err:
+	default:
+	}
+}
+
+// inconsistent publishes the inconsistency and returns the error ending the
+// event loop. During the startup grace period, e.g. for the DISCONNECT of a
+// call started before the bridge, it is only logged and nil is returned.
+func (app *Application) inconsistent(err error) error {
+	if app.GraceRemaining() > 0 {
+		log.Printf("Strict mode: ignoring inconsistency during the startup grace period: %v", err)
+		return nil
+	}
+	inconsistency := Inconsistency{Kind: "inconsistency", Error: err.Error(), Time: time.Now()}
+	if err := app.mqttClient.PublishError(app.ctx, inconsistency); err != nil {
+		log.Printf("Failed to publish inconsistency: %v", err)
+	}
+	return &strictError{err: err}
+}
@@ -0,0 +1,120 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/config"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/mqtt"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// tenantClient is the MQTT client publishing the calls of a tenant below {prefix}/{tenant}
+type tenantClient struct {
+	name   string
+	client *mqtt.Client
+	shared bool // Connects with the main credentials, updated together with them
+}
+
+// tenantRouter is the MQTT sink of the pipeline. It hands each call event to
+// the client of the tenant owning the MSN of the call, and events of other
+// MSNs to the main client. Without tenants it is a plain pass-through.
+type tenantRouter struct {
+	main    *mqtt.Client
+	tenants []tenantClient
+	byMSN   map[string]*mqtt.Client
+}
+
+// newTenantRouter creates a client per tenant from the options of the main
+// client. The command topics, like DND and reload, stay with the main client.
+func newTenantRouter(main *mqtt.Client, tenants []config.MQTTTenant, opts mqtt.Options, onConnection func(connection string, online bool, cause error)) *tenantRouter {
+	r := &tenantRouter{main: main, byMSN: make(map[string]*mqtt.Client)}
+	for _, tenant := range tenants {
+		tenantOpts := opts
+		tenantOpts.TopicPrefix = opts.TopicPrefix + "/" + tenant.Name
+		tenantOpts.ClientID = opts.ClientID + "-" + tenant.Name
+		if tenant.Username != "" {
+			tenantOpts.Username, tenantOpts.Password = tenant.Username, tenant.Password
+		}
+		tenantOpts.DND = nil
+		tenantOpts.DNDDeflections = nil
+		tenantOpts.OnReload = nil
+		tenantOpts.ProfileTopics = false // The profile applies to the tenants, it is switched via the main client
+		connection := "mqtt/" + tenant.Name
+		tenantOpts.OnConnectionChange = func(online bool, cause error) {
+			onConnection(connection, online, cause)
+		}
+
+		client := mqtt.NewClient(tenantOpts)
+		r.tenants = append(r.tenants, tenantClient{name: tenant.Name, client: client, shared: tenant.Username == ""})
+		for _, msn := range tenant.MSNs {
+			r.byMSN[msn] = client
+		}
+	}
+	return r
+}
+
+// clientFor returns the client of the tenant owning the MSN of the call, the
+// MSN called for inbound calls and the MSN calling for outbound calls
+func (r *tenantRouter) clientFor(event types.CallEvent) *mqtt.Client {
+	msn := event.CalledMSN
+	if event.Direction == types.CallDirectionOutbound {
+		msn = event.CallerMSN
+	}
+	if client, ok := r.byMSN[msn]; ok {
+		return client
+	}
+	return r.main
+}
+
+func (r *tenantRouter) PublishCallEvent(ctx context.Context, event types.CallEvent) error {
+	return r.clientFor(event).PublishCallEvent(ctx, event)
+}
+
+// Unwrap returns the main client, which names the queue of the MQTT sink
+func (r *tenantRouter) Unwrap() types.CallEventSink {
+	return r.main
+}
+
+// connect connects the tenant clients; the main client is connected by Run
+func (r *tenantRouter) connect(ctx context.Context) error {
+	for _, tenant := range r.tenants {
+		if err := tenant.client.Connect(ctx); err != nil {
+			return fmt.Errorf("failed to connect MQTT tenant %s: %w", tenant.name, err)
+		}
+	}
+	return nil
+}
+
+// disconnect disconnects the tenant clients
+func (r *tenantRouter) disconnect() error {
+	var errs []error
+	for _, tenant := range r.tenants {
+		if err := tenant.client.Disconnect(); err != nil {
+			errs = append(errs, fmt.Errorf("tenant %s: %w", tenant.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// updateCredentials passes new main credentials on to the tenants without own credentials
+func (r *tenantRouter) updateCredentials(ctx context.Context, username, password string) error {
+	var errs []error
+	for _, tenant := range r.tenants {
+		if !tenant.shared {
+			continue
+		}
+		if err := tenant.client.UpdateCredentials(ctx, username, password); err != nil {
+			errs = append(errs, fmt.Errorf("tenant %s: %w", tenant.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// each calls fn with every tenant client
+func (r *tenantRouter) each(fn func(client *mqtt.Client)) {
+	for _, tenant := range r.tenants {
+		fn(tenant.client)
+	}
+}
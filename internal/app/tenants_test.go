@@ -0,0 +1,46 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/config"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/mqtt"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+func TestTenantRouter(t *testing.T) {
+	opts := mqtt.DefaultOptions()
+	main := mqtt.NewClient(opts)
+	router := newTenantRouter(main, []config.MQTTTenant{
+		{Name: "acme", MSNs: []string{"990133", "990134"}},
+		{Name: "beta", MSNs: []string{"990144"}, Username: "beta", Password: "secret"},
+	}, opts, func(string, bool, error) {})
+
+	if len(router.tenants) != 2 || !router.tenants[0].shared || router.tenants[1].shared {
+		t.Fatalf("Expected acme with the main and beta with own credentials, got %+v", router.tenants)
+	}
+	acme, beta := router.tenants[0].client, router.tenants[1].client
+
+	tests := []struct {
+		name     string
+		event    types.CallEvent
+		expected *mqtt.Client
+	}{
+		{"inbound to tenant MSN", types.CallEvent{Direction: types.CallDirectionInbound, CalledMSN: "990134"}, acme},
+		{"outbound from tenant MSN", types.CallEvent{Direction: types.CallDirectionOutbound, CallerMSN: "990144"}, beta},
+		{"outbound to tenant MSN", types.CallEvent{Direction: types.CallDirectionOutbound, CalledMSN: "990133"}, main},
+		{"MSN of no tenant", types.CallEvent{Direction: types.CallDirectionInbound, CalledMSN: "990155"}, main},
+		{"without MSN", types.CallEvent{Direction: types.CallDirectionInbound}, main},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := router.clientFor(tt.event); got != tt.expected {
+				t.Errorf("Event routed to the wrong client")
+			}
+		})
+	}
+
+	if router.Unwrap() != main {
+		t.Error("Expected the MQTT sink to be named after the main client")
+	}
+}
@@ -0,0 +1,240 @@
+// Package backfill imports the call list of the Fritz!Box on the first start,
+// so the call history is not empty until new calls arrive.
+package backfill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/database"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/phone"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/tr064"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// doneKey is the config key marking a completed backfill
+const doneKey = "backfill.call_list"
+
+// ErrTrunkFilter is returned by Run if a trunk filter is configured. The call
+// list does not name the trunk of a call, so the filter cannot be applied.
+var ErrTrunkFilter = errors.New("call list cannot be imported with a trunk filter, it does not name the trunks of the calls")
+
+// CallList provides the call list of the Fritz!Box
+type CallList interface {
+	GetCallList(ctx context.Context, location *time.Location) ([]tr064.CallListEntry, error)
+}
+
+// Store keeps the imported calls and the backfill marker
+type Store interface {
+	GetConfig(ctx context.Context, key string) (string, error)
+	SetConfig(ctx context.Context, key, value string) error
+	FirstCallTime(ctx context.Context) (time.Time, error)
+	InsertCalls(ctx context.Context, events []types.CallEvent) error
+}
+
+// History receives the imported calls for the call history topics
+type History interface {
+	BackfillHistory(ctx context.Context, events []types.CallEvent) error
+}
+
+// Options configures a backfill
+type Options struct {
+	CallList        CallList
+	Store           Store
+	History         History               // Optional
+	Location        *time.Location        // Timezone of the dates of the call list (default: time.Local)
+	CountryCode     string                // Own country calling code, e.g. "49"
+	LocalAreaCode   string                // Own area code, e.g. "30"
+	Region          string                // Region for number normalization (default: derived from CountryCode)
+	MSNs            []string              // Own MSNs for detection
+	MSNNames        map[string]string     // Names of the MSNs, see types.ParseMSNs
+	DoNotRecord     []string              // MSNs/extensions whose calls are not imported
+	ExtensionFilter types.ExtensionFilter // MSNs/extensions whose calls are imported (default: all)
+	TrunkFilter     types.TrunkFilter     // Trunks whose calls are processed; nothing is imported if set
+	Filter          types.HistoryFilter   // Calls stored in the database (default: all), the history applies its own
+	TAMExtensions   []string              // Ports of the answering machines
+}
+
+// Backfiller imports the call list once
+type Backfiller struct {
+	callList        CallList
+	store           Store
+	history         History
+	location        *time.Location
+	normalizer      *phone.Normalizer
+	msns            []string
+	msnNames        map[string]string
+	doNotRecord     []string
+	extensionFilter types.ExtensionFilter
+	trunkFilter     types.TrunkFilter
+	filter          types.HistoryFilter
+	tamExtensions   []string
+}
+
+// New creates a backfiller. It fails only if an explicitly configured region is unknown.
+func New(opts Options) (*Backfiller, error) {
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+	normalizer, err := phone.NewNormalizer(opts.Region, opts.CountryCode, opts.LocalAreaCode)
+	if err != nil && opts.Region != "" {
+		return nil, fmt.Errorf("failed to configure phone number normalization: %w", err)
+	}
+	return &Backfiller{
+		callList:        opts.CallList,
+		store:           opts.Store,
+		history:         opts.History,
+		location:        opts.Location,
+		normalizer:      normalizer,
+		msns:            opts.MSNs,
+		msnNames:        opts.MSNNames,
+		doNotRecord:     opts.DoNotRecord,
+		extensionFilter: opts.ExtensionFilter,
+		trunkFilter:     opts.TrunkFilter,
+		filter:          opts.Filter,
+		tamExtensions:   opts.TAMExtensions,
+	}, nil
+}
+
+// Run imports the call list unless an earlier run completed. Calls starting
+// at or after until, when the callmonitor connected, or the oldest stored call
+// are skipped, they are recorded by the callmonitor. Calls are stored through
+// the database filter and added to the history. It returns the number of
+// imported calls.
+func (b *Backfiller) Run(ctx context.Context, until time.Time) (int, error) {
+	if !b.trunkFilter.IsEmpty() {
+		return 0, ErrTrunkFilter
+	}
+	if _, err := b.store.GetConfig(ctx, doneKey); err == nil {
+		return 0, nil
+	} else if !errors.Is(err, database.ErrNotFound) {
+		return 0, err
+	}
+
+	entries, err := b.callList.GetCallList(ctx, b.location)
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch call list: %w", err)
+	}
+	first, err := b.store.FirstCallTime(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if first.IsZero() || until.Before(first) {
+		first = until
+	}
+
+	// The call list is newest first
+	var events, stored []types.CallEvent
+	gate := types.NewHistoryGate(b.filter)
+	calls := 0
+	for _, entry := range slices.Backward(entries) {
+		if !first.IsZero() && !entry.Date.Before(first) {
+			continue
+		}
+		callEvents, ok := b.convert(entry)
+		if !ok {
+			continue
+		}
+		events = append(events, callEvents...)
+		for _, event := range callEvents {
+			stored = append(stored, gate.Add(event)...)
+		}
+		calls++
+	}
+
+	if err := b.store.InsertCalls(ctx, stored); err != nil {
+		return 0, err
+	}
+	if b.history != nil {
+		if err := b.history.BackfillHistory(ctx, events); err != nil {
+			log.Printf("Failed to publish backfilled call history: %v", err)
+		}
+	}
+	if err := b.store.SetConfig(ctx, doneKey, time.Now().UTC().Format(time.RFC3339)); err != nil {
+		return calls, err
+	}
+	return calls, nil
+}
+
+// convert turns a call list entry into the events the callmonitor would have
+// reported. Running calls, calls of opted-out MSNs and calls dropped by the
+// extension filter are skipped.
+func (b *Backfiller) convert(entry tr064.CallListEntry) ([]types.CallEvent, bool) {
+	start := types.CallEvent{ID: types.NewCallID(), Timestamp: entry.Date}
+	var status types.CallStatus
+	answered := false
+	switch entry.Type {
+	case tr064.CallListIncoming, tr064.CallListMissed, tr064.CallListRejected:
+		start.Type = types.CallTypeRing
+		start.Direction = types.CallDirectionInbound
+		start.Status = types.CallStatusRinging
+		start.Caller = b.normalize(entry.Caller)
+		start.Called = b.normalize(firstNonEmpty(entry.CalledNumber, entry.Called))
+		status = types.CallStatusMissedCall
+		answered = entry.Type == tr064.CallListIncoming
+	case tr064.CallListOutgoing:
+		start.Type = types.CallTypeCall
+		start.Direction = types.CallDirectionOutbound
+		start.Status = types.CallStatusCalling
+		start.Extension = entry.Port
+		start.Caller = b.normalize(firstNonEmpty(entry.CallerNumber, entry.Caller))
+		start.Called = b.normalize(entry.Called)
+		status = types.CallStatusNotReached
+		answered = entry.Duration > 0
+	default:
+		return nil, false
+	}
+	start.EnrichWithMSNs(b.msns, b.msnNames)
+	if start.MatchesDoNotRecord(b.doNotRecord) || slices.Contains(b.doNotRecord, entry.Port) || !b.extensionFilter.Allows(&start) {
+		return nil, false
+	}
+	events := []types.CallEvent{start}
+
+	end := start
+	end.Type = types.CallTypeDisconnect
+	end.Timestamp = entry.Date.Add(entry.Duration)
+	end.Duration = int(entry.Duration.Seconds())
+	finish := status
+	if answered {
+		connect := start
+		connect.Type = types.CallTypeConnect
+		connect.Extension = entry.Port
+		connect.MessageBox = slices.Contains(b.tamExtensions, entry.Port)
+		connect.Status = types.CallStatusTalking
+		events = append(events, connect)
+
+		end.Extension = entry.Port
+		end.MessageBox = connect.MessageBox
+		finish = types.CallStatusFinished
+		if connect.MessageBox {
+			finish = types.CallStatusMessageBox
+		}
+	}
+	end.Status = finish
+	if finish == types.CallStatusMessageBox {
+		end.Status = types.CallStatusMissedCall
+	}
+	end.FinishState = &finish
+	return append(events, end), true
+}
+
+// normalize converts a number of the call list into E.164 format
+func (b *Backfiller) normalize(number string) string {
+	if b.normalizer == nil {
+		return number
+	}
+	return b.normalizer.Normalize(number)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,276 @@
+package backfill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/database"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/tr064"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+type fakeCallList struct {
+	entries []tr064.CallListEntry
+	calls   int
+}
+
+func (f *fakeCallList) GetCallList(ctx context.Context, location *time.Location) ([]tr064.CallListEntry, error) {
+	f.calls++
+	return f.entries, nil
+}
+
+type fakeStore struct {
+	config map[string]string
+	first  time.Time
+	events []types.CallEvent
+}
+
+func (f *fakeStore) GetConfig(ctx context.Context, key string) (string, error) {
+	value, ok := f.config[key]
+	if !ok {
+		return "", fmt.Errorf("config %s: %w", key, database.ErrNotFound)
+	}
+	return value, nil
+}
+
+func (f *fakeStore) SetConfig(ctx context.Context, key, value string) error {
+	f.config[key] = value
+	return nil
+}
+
+func (f *fakeStore) FirstCallTime(ctx context.Context) (time.Time, error) {
+	return f.first, nil
+}
+
+func (f *fakeStore) InsertCalls(ctx context.Context, events []types.CallEvent) error {
+	f.events = append(f.events, events...)
+	return nil
+}
+
+type fakeHistory struct {
+	events []types.CallEvent
+}
+
+func (f *fakeHistory) BackfillHistory(ctx context.Context, events []types.CallEvent) error {
+	f.events = append(f.events, events...)
+	return nil
+}
+
+var day = time.Date(2025, 9, 20, 0, 0, 0, 0, time.UTC)
+
+func newTestBackfiller(t *testing.T, list *fakeCallList, store *fakeStore, history *fakeHistory) *Backfiller {
+	t.Helper()
+	b, err := New(Options{
+		CallList:      list,
+		Store:         store,
+		History:       history,
+		Location:      time.UTC,
+		CountryCode:   "49",
+		LocalAreaCode: "30",
+		MSNs:          []string{"+4930111111"},
+		DoNotRecord:   []string{"+4930999999"},
+		TAMExtensions: []string{"40"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create backfiller: %v", err)
+	}
+	return b
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name      string
+		entry     tr064.CallListEntry
+		types     []types.CallType // Events of the call, in order
+		status    types.CallStatus // Status of the DISCONNECT
+		finish    types.CallStatus
+		caller    string
+		called    string
+		extension string
+		duration  int
+	}{
+		{
+			name:      "answered incoming",
+			entry:     tr064.CallListEntry{Type: tr064.CallListIncoming, Caller: "030123456", CalledNumber: "111111", Port: "1", Date: day.Add(10 * time.Hour), Duration: 5 * time.Minute},
+			types:     []types.CallType{types.CallTypeRing, types.CallTypeConnect, types.CallTypeDisconnect},
+			status:    types.CallStatusFinished,
+			finish:    types.CallStatusFinished,
+			caller:    "+4930123456",
+			called:    "+4930111111",
+			extension: "1",
+			duration:  300,
+		},
+		{
+			name:   "missed incoming",
+			entry:  tr064.CallListEntry{Type: tr064.CallListMissed, Caller: "030123456", CalledNumber: "111111", Date: day.Add(11 * time.Hour)},
+			types:  []types.CallType{types.CallTypeRing, types.CallTypeDisconnect},
+			status: types.CallStatusMissedCall,
+			finish: types.CallStatusMissedCall,
+			caller: "+4930123456",
+			called: "+4930111111",
+		},
+		{
+			name:      "answering machine",
+			entry:     tr064.CallListEntry{Type: tr064.CallListIncoming, Caller: "030123456", CalledNumber: "111111", Port: "40", Date: day.Add(12 * time.Hour), Duration: time.Minute},
+			types:     []types.CallType{types.CallTypeRing, types.CallTypeConnect, types.CallTypeDisconnect},
+			status:    types.CallStatusMissedCall,
+			finish:    types.CallStatusMessageBox,
+			caller:    "+4930123456",
+			called:    "+4930111111",
+			extension: "40",
+			duration:  60,
+		},
+		{
+			name:      "outgoing not reached",
+			entry:     tr064.CallListEntry{Type: tr064.CallListOutgoing, CallerNumber: "111111", Called: "0301234567", Port: "2", Date: day.Add(13 * time.Hour)},
+			types:     []types.CallType{types.CallTypeCall, types.CallTypeDisconnect},
+			status:    types.CallStatusNotReached,
+			finish:    types.CallStatusNotReached,
+			caller:    "+4930111111",
+			called:    "+49301234567",
+			extension: "2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBackfiller(t, &fakeCallList{}, &fakeStore{}, nil)
+
+			events, ok := b.convert(tt.entry)
+			if !ok {
+				t.Fatal("Expected the entry to be converted")
+			}
+			var got []types.CallType
+			for _, event := range events {
+				got = append(got, event.Type)
+				if event.ID != events[0].ID {
+					t.Errorf("Expected %s event to have call ID %s, got %s", event.Type, events[0].ID, event.ID)
+				}
+			}
+			if !slices.Equal(got, tt.types) {
+				t.Fatalf("Expected events %v, got %v", tt.types, got)
+			}
+
+			end := events[len(events)-1]
+			if end.Status != tt.status || end.FinishState == nil || *end.FinishState != tt.finish {
+				t.Errorf("Expected status %s with finish state %s, got %s with %v", tt.status, tt.finish, end.Status, end.FinishState)
+			}
+			if end.Caller != tt.caller || end.Called != tt.called {
+				t.Errorf("Expected call from %s to %s, got %s to %s", tt.caller, tt.called, end.Caller, end.Called)
+			}
+			if end.Extension != tt.extension || end.Duration != tt.duration {
+				t.Errorf("Expected extension %q after %ds, got %q after %ds", tt.extension, tt.duration, end.Extension, end.Duration)
+			}
+			if !end.Timestamp.Equal(tt.entry.Date.Add(tt.entry.Duration)) {
+				t.Errorf("Expected DISCONNECT at %v, got %v", tt.entry.Date.Add(tt.entry.Duration), end.Timestamp)
+			}
+		})
+	}
+}
+
+func TestConvertSkips(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry tr064.CallListEntry
+	}{
+		{"active call", tr064.CallListEntry{Type: tr064.CallListActiveIncoming, Caller: "030123456", CalledNumber: "111111", Date: day}},
+		{"do not record", tr064.CallListEntry{Type: tr064.CallListMissed, Caller: "030123456", CalledNumber: "999999", Date: day}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBackfiller(t, &fakeCallList{}, &fakeStore{}, nil)
+			if _, ok := b.convert(tt.entry); ok {
+				t.Error("Expected the entry to be skipped")
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	list := &fakeCallList{entries: []tr064.CallListEntry{
+		{Type: tr064.CallListMissed, Caller: "030123456", CalledNumber: "111111", Date: day.Add(12 * time.Hour)},
+		{Type: tr064.CallListOutgoing, CallerNumber: "111111", Called: "030654321", Date: day.Add(11 * time.Hour), Duration: time.Minute},
+		{Type: tr064.CallListIncoming, Caller: "030123456", CalledNumber: "111111", Date: day.Add(10 * time.Hour), Duration: time.Minute},
+	}}
+	// The newest call was already recorded by the callmonitor
+	store := &fakeStore{config: map[string]string{}, first: day.Add(12 * time.Hour)}
+	history := &fakeHistory{}
+	b := newTestBackfiller(t, list, store, history)
+
+	count, err := b.Run(context.Background(), day.Add(13*time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to run backfill: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 imported calls, got %d", count)
+	}
+	if len(store.events) != 6 || len(history.events) != 6 {
+		t.Fatalf("Expected 6 events in store and history, got %d and %d", len(store.events), len(history.events))
+	}
+	if !store.events[0].Timestamp.Equal(day.Add(10 * time.Hour)) {
+		t.Errorf("Expected the oldest call first, got %v", store.events[0].Timestamp)
+	}
+	if _, ok := store.config[doneKey]; !ok {
+		t.Error("Expected the backfill to be marked as done")
+	}
+
+	// A second run does not fetch the call list again
+	count, err = b.Run(context.Background(), day.Add(13*time.Hour))
+	if err != nil || count != 0 {
+		t.Errorf("Expected no import on the second run, got %d: %v", count, err)
+	}
+	if list.calls != 1 {
+		t.Errorf("Expected the call list to be fetched once, got %d", list.calls)
+	}
+}
+
+func TestRunFilters(t *testing.T) {
+	list := &fakeCallList{entries: []tr064.CallListEntry{
+		{Type: tr064.CallListMissed, Caller: "030123456", CalledNumber: "111111", Date: day.Add(12 * time.Hour)},
+		{Type: tr064.CallListOutgoing, CallerNumber: "111111", Called: "030654321", Date: day.Add(11 * time.Hour), Duration: time.Minute},
+		{Type: tr064.CallListMissed, Caller: "030123456", CalledNumber: "111111", Date: day.Add(10 * time.Hour)},
+	}}
+	store := &fakeStore{config: map[string]string{}}
+	history := &fakeHistory{}
+	b := newTestBackfiller(t, list, store, history)
+	b.filter = types.HistoryFilter{Directions: []types.CallDirection{types.CallDirectionOutbound}}
+
+	// The callmonitor connected before the newest call, so it recorded it
+	count, err := b.Run(context.Background(), day.Add(12*time.Hour))
+	if err != nil {
+		t.Fatalf("Failed to run backfill: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 imported calls, got %d", count)
+	}
+	if len(history.events) != 5 {
+		t.Errorf("Expected 5 events in the history, got %d", len(history.events))
+	}
+	if len(store.events) != 3 || store.events[0].Direction != types.CallDirectionOutbound {
+		t.Errorf("Expected only the 3 events of the outgoing call to be stored, got %+v", store.events)
+	}
+}
+
+func TestRunTrunkFilter(t *testing.T) {
+	list := &fakeCallList{entries: []tr064.CallListEntry{
+		{Type: tr064.CallListMissed, Caller: "030123456", CalledNumber: "111111", Date: day.Add(10 * time.Hour)},
+	}}
+	store := &fakeStore{config: map[string]string{}}
+	b := newTestBackfiller(t, list, store, &fakeHistory{})
+	b.trunkFilter = types.TrunkFilter{Deny: []string{"SIP1"}}
+
+	if _, err := b.Run(context.Background(), day.Add(13*time.Hour)); !errors.Is(err, ErrTrunkFilter) {
+		t.Errorf("Expected ErrTrunkFilter, got %v", err)
+	}
+	if list.calls != 0 || len(store.events) != 0 {
+		t.Errorf("Expected nothing to be imported, got %d events", len(store.events))
+	}
+	if _, ok := store.config[doneKey]; ok {
+		t.Error("Expected the backfill not to be marked as done")
+	}
+}
@@ -0,0 +1,215 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+)
+
+// Name prefix and suffix of the backup files; only files named like this are pruned
+const (
+	filePrefix = "fritz-callmonitor2mqtt-"
+	fileSuffix = ".db.gz"
+)
+
+// Target stores the backup files, e.g. in an S3 bucket or on a WebDAV share
+type Target interface {
+	Upload(ctx context.Context, name string, body io.ReadSeeker, size int64) error
+	List(ctx context.Context) ([]string, error) // Names of the stored files
+	Delete(ctx context.Context, name string) error
+	String() string // Location of the backups for logs
+}
+
+// Snapshotter writes a consistent copy of the database to a new file
+type Snapshotter interface {
+	Snapshot(ctx context.Context, path string) error
+}
+
+// Stats reports the backups since the start
+type Stats struct {
+	Backups    uint64     `json:"backups"`
+	Failed     uint64     `json:"failed"`
+	Pruned     uint64     `json:"pruned"` // Backups deleted by the retention
+	LastFile   string     `json:"last_file,omitempty"`
+	LastSize   int64      `json:"last_size_bytes,omitempty"` // Compressed size of the last backup
+	LastBackup *time.Time `json:"last_backup,omitempty"`
+	LastError  string     `json:"last_error,omitempty"` // Why the last run failed, empty once a run succeeded
+}
+
+// Job snapshots the database, compresses the snapshot with gzip, uploads it
+// to the target and deletes the oldest backups beyond the retention
+type Job struct {
+	db      Snapshotter
+	target  Target
+	keep    int
+	tempDir string
+	clock   clock.Clock
+
+	running sync.Mutex // Serializes runs
+	mu      sync.Mutex // Guards stats
+	stats   Stats
+}
+
+// Options configures a backup job
+type Options struct {
+	Keep    int         // Backups kept on the target, older ones are deleted; 0 keeps all
+	TempDir string      // Directory of the snapshot while it is compressed (default: os.TempDir())
+	Clock   clock.Clock // Source of the backup times (default: real time)
+}
+
+// NewJob creates a backup job of the database to the target
+func NewJob(db Snapshotter, target Target, opts Options) *Job {
+	if opts.Clock == nil {
+		opts.Clock = clock.Real()
+	}
+	return &Job{db: db, target: target, keep: max(opts.Keep, 0), tempDir: opts.TempDir, clock: opts.Clock}
+}
+
+// FileName returns the name of the backup taken at t, e.g.
+// fritz-callmonitor2mqtt-20250921T153000Z.db.gz, which sorts by time
+func FileName(t time.Time) string {
+	return filePrefix + t.UTC().Format("20060102T150405Z") + fileSuffix
+}
+
+// Run takes a backup and prunes the old ones. A failed prune is logged but
+// does not fail the run, the backup itself is stored.
+func (j *Job) Run(ctx context.Context) error {
+	j.running.Lock()
+	defer j.running.Unlock()
+
+	now := j.clock.Now()
+	name := FileName(now)
+	size, err := j.backup(ctx, name)
+	j.mu.Lock()
+	if err != nil {
+		j.stats.Failed++
+		j.stats.LastError = err.Error()
+	} else {
+		j.stats.Backups++
+		j.stats.LastFile, j.stats.LastSize, j.stats.LastBackup, j.stats.LastError = name, size, &now, ""
+	}
+	j.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	log.Printf("Uploaded database backup %s (%d bytes) to %s", name, size, j.target)
+
+	pruned, err := j.prune(ctx)
+	j.mu.Lock()
+	j.stats.Pruned += uint64(pruned)
+	j.mu.Unlock()
+	if err != nil {
+		log.Printf("Failed to delete old database backups: %v", err)
+	}
+	return nil
+}
+
+// backup uploads a compressed snapshot as name and returns its size
+func (j *Job) backup(ctx context.Context, name string) (int64, error) {
+	dir, err := os.MkdirTemp(j.tempDir, "backup-")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	snapshot := filepath.Join(dir, "snapshot.db")
+	if err := j.db.Snapshot(ctx, snapshot); err != nil {
+		return 0, err
+	}
+	compressed := filepath.Join(dir, name)
+	if err := compress(snapshot, compressed); err != nil {
+		return 0, fmt.Errorf("failed to compress backup: %w", err)
+	}
+
+	file, err := os.Open(compressed)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open backup: %w", err)
+	}
+	if err := j.target.Upload(ctx, name, file, info.Size()); err != nil {
+		return 0, fmt.Errorf("failed to upload backup %s: %w", name, err)
+	}
+	return info.Size(), nil
+}
+
+// compress writes the file gzip compressed to target
+func compress(source, target string) (err error) {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, out.Close()) }()
+
+	compressed := gzip.NewWriter(out)
+	if _, err := io.Copy(compressed, in); err != nil {
+		return err
+	}
+	return compressed.Close()
+}
+
+// prune deletes the oldest backups beyond the retention and returns how many
+// it deleted. Other files on the target are left alone.
+func (j *Job) prune(ctx context.Context) (int, error) {
+	if j.keep <= 0 {
+		return 0, nil
+	}
+	names, err := j.target.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+	names = slices.DeleteFunc(names, func(name string) bool {
+		return !strings.HasPrefix(name, filePrefix) || !strings.HasSuffix(name, fileSuffix)
+	})
+	if len(names) <= j.keep {
+		return 0, nil
+	}
+	slices.Sort(names)
+
+	deleted := 0
+	for _, name := range names[:len(names)-j.keep] {
+		if err := j.target.Delete(ctx, name); err != nil {
+			return deleted, fmt.Errorf("failed to delete backup %s: %w", name, err)
+		}
+		log.Printf("Deleted database backup %s beyond the last %d", name, j.keep)
+		deleted++
+	}
+	return deleted, nil
+}
+
+// Stats returns the counters of the backups
+func (j *Job) Stats() Stats {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.stats
+}
+
+// checkResponse turns a response outside 2xx into an error
+func checkResponse(resp *http.Response, action string) error {
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return fmt.Errorf("%s rejected with HTTP %d: %s", action, resp.StatusCode, bytes.TrimSpace(message))
+}
@@ -0,0 +1,143 @@
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+)
+
+// fakeDB writes its content as snapshot
+type fakeDB struct {
+	content string
+	err     error
+}
+
+func (f *fakeDB) Snapshot(ctx context.Context, path string) error {
+	if f.err != nil {
+		return f.err
+	}
+	return os.WriteFile(path, []byte(f.content), 0600)
+}
+
+// memoryTarget keeps the uploaded files in memory
+type memoryTarget struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func (m *memoryTarget) Upload(ctx context.Context, name string, body io.ReadSeeker, size int64) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) != size {
+		return errors.New("size mismatch")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.files[name] = data
+	return nil
+}
+
+func (m *memoryTarget) List(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var names []string
+	for name := range m.files {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (m *memoryTarget) Delete(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.files, name)
+	return nil
+}
+
+func (m *memoryTarget) String() string {
+	return "memory"
+}
+
+func (m *memoryTarget) names() []string {
+	names, _ := m.List(context.Background())
+	slices.Sort(names)
+	return names
+}
+
+func TestJobRun(t *testing.T) {
+	start := time.Date(2025, 9, 21, 15, 30, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	target := &memoryTarget{files: map[string][]byte{"notes.txt": []byte("keep me")}}
+	job := NewJob(&fakeDB{content: "SQLite format 3"}, target, Options{Keep: 2, TempDir: t.TempDir(), Clock: fake})
+
+	for range 3 {
+		if err := job.Run(context.Background()); err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+		fake.Advance(24 * time.Hour)
+	}
+
+	expected := []string{
+		"fritz-callmonitor2mqtt-20250922T153000Z.db.gz",
+		"fritz-callmonitor2mqtt-20250923T153000Z.db.gz",
+		"notes.txt",
+	}
+	if names := target.names(); !slices.Equal(names, expected) {
+		t.Errorf("Expected %v, got %v", expected, names)
+	}
+
+	reader, err := gzip.NewReader(strings.NewReader(string(target.files[expected[1]])))
+	if err != nil {
+		t.Fatalf("Backup is not gzip compressed: %v", err)
+	}
+	if content, _ := io.ReadAll(reader); string(content) != "SQLite format 3" {
+		t.Errorf("Expected the snapshot as content, got %q", content)
+	}
+
+	stats := job.Stats()
+	if stats.Backups != 3 || stats.Failed != 0 || stats.Pruned != 1 || stats.LastFile != expected[1] || stats.LastSize != int64(len(target.files[expected[1]])) {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if stats.LastBackup == nil || !stats.LastBackup.Equal(start.Add(48*time.Hour)) {
+		t.Errorf("Expected last backup at %v, got %v", start.Add(48*time.Hour), stats.LastBackup)
+	}
+}
+
+func TestJobRunFailure(t *testing.T) {
+	db := &fakeDB{err: errors.New("database is not connected")}
+	target := &memoryTarget{files: map[string][]byte{}}
+	job := NewJob(db, target, Options{TempDir: t.TempDir()})
+
+	if err := job.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "not connected") {
+		t.Errorf("Expected the snapshot error, got %v", err)
+	}
+	if stats := job.Stats(); stats.Failed != 1 || stats.LastError == "" || len(target.files) != 0 {
+		t.Errorf("Expected a failed run without upload, got %+v and %v", stats, target.names())
+	}
+
+	db.err = nil
+	if err := job.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if stats := job.Stats(); stats.Backups != 1 || stats.LastError != "" {
+		t.Errorf("Expected a successful run to clear the error, got %+v", stats)
+	}
+}
+
+func TestFileName(t *testing.T) {
+	berlin := time.FixedZone("CEST", 2*60*60)
+	if got := FileName(time.Date(2025, 9, 21, 17, 30, 5, 0, berlin)); got != "fritz-callmonitor2mqtt-20250921T153005Z.db.gz" {
+		t.Errorf("Expected the UTC time in the name, got %s", got)
+	}
+}
@@ -0,0 +1,197 @@
+package backup
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// WebDAV stores the backups in a folder of a WebDAV share, e.g. of a NAS or
+// a Nextcloud
+type WebDAV struct {
+	folderURL  *url.URL
+	username   string
+	password   string
+	httpClient *http.Client
+}
+
+// WebDAVOptions configures a WebDAV target
+type WebDAVOptions struct {
+	URL        string        // URL of the folder of the backups, created if missing
+	Username   string        // Sent via basic auth if set
+	Password   string        // Sent via basic auth if Username is set
+	Timeout    time.Duration // Upper bound for a single request (default: 5m)
+	HTTPClient *http.Client  // Overrides the client built from Timeout
+}
+
+// NewWebDAV creates a WebDAV target
+func NewWebDAV(opts WebDAVOptions) (*WebDAV, error) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Minute
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: opts.Timeout}
+	}
+
+	folderURL, err := url.Parse(opts.URL)
+	if err != nil || (folderURL.Scheme != "http" && folderURL.Scheme != "https") || folderURL.Host == "" {
+		return nil, fmt.Errorf("invalid WebDAV URL '%s'", opts.URL)
+	}
+	// Collections are addressed with a trailing slash
+	if !strings.HasSuffix(folderURL.Path, "/") {
+		folderURL.Path += "/"
+		folderURL.RawPath = ""
+	}
+
+	return &WebDAV{folderURL: folderURL, username: opts.Username, password: opts.Password, httpClient: opts.HTTPClient}, nil
+}
+
+// String returns the URL of the folder without credentials
+func (w *WebDAV) String() string {
+	return w.folderURL.Redacted()
+}
+
+// Upload stores the backup in the folder, creating the folder once if the
+// server reports it missing
+func (w *WebDAV) Upload(ctx context.Context, name string, body io.ReadSeeker, size int64) error {
+	status, err := w.put(ctx, name, body, size)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusConflict && status != http.StatusNotFound {
+		return nil
+	}
+	if err := w.createFolder(ctx); err != nil {
+		return err
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to rewind backup: %w", err)
+	}
+	status, err = w.put(ctx, name, body, size)
+	if err == nil && status != 0 {
+		err = fmt.Errorf("WebDAV upload rejected with HTTP %d", status)
+	}
+	return err
+}
+
+// put uploads the file and returns the status if the folder may be missing
+func (w *WebDAV) put(ctx context.Context, name string, body io.Reader, size int64) (int, error) {
+	req, err := w.request(ctx, http.MethodPut, name, io.NopCloser(body))
+	if err != nil {
+		return 0, err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/gzip")
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("WebDAV upload failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusConflict || resp.StatusCode == http.StatusNotFound {
+		return resp.StatusCode, nil
+	}
+	return 0, checkResponse(resp, "WebDAV upload")
+}
+
+// createFolder creates the folder of the backups; its parent must exist
+func (w *WebDAV) createFolder(ctx context.Context) error {
+	req, err := w.request(ctx, "MKCOL", "", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("WebDAV folder creation failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	// 405 Method Not Allowed: the folder exists already
+	if resp.StatusCode == http.StatusMethodNotAllowed {
+		return nil
+	}
+	return checkResponse(resp, "WebDAV folder creation")
+}
+
+// multistatus is the response of PROPFIND
+type multistatus struct {
+	Responses []struct {
+		Href string `xml:"href"`
+	} `xml:"DAV: response"`
+}
+
+// List returns the names of the files in the folder; a missing folder has none
+func (w *WebDAV) List(ctx context.Context) ([]string, error) {
+	body := `<?xml version="1.0" encoding="utf-8"?><d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/></d:prop></d:propfind>`
+	req, err := w.request(ctx, "PROPFIND", "", strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Depth", "1")
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("WebDAV listing failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if err := checkResponse(resp, "WebDAV listing"); err != nil {
+		return nil, err
+	}
+
+	var result multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid WebDAV listing response: %w", err)
+	}
+	var names []string
+	for _, response := range result.Responses {
+		// Hrefs are absolute paths or URLs; the folder itself ends with a slash
+		href, err := url.Parse(strings.TrimSpace(response.Href))
+		if err != nil || strings.HasSuffix(href.Path, "/") {
+			continue
+		}
+		names = append(names, path.Base(href.Path))
+	}
+	return names, nil
+}
+
+// Delete removes the file of a backup; a file that is gone already is fine
+func (w *WebDAV) Delete(ctx context.Context, name string) error {
+	req, err := w.request(ctx, http.MethodDelete, name, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("WebDAV delete failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return checkResponse(resp, "WebDAV delete")
+}
+
+// request creates a request for a file in the folder, or the folder itself for an empty name
+func (w *WebDAV) request(ctx context.Context, method, name string, body io.Reader) (*http.Request, error) {
+	target := w.folderURL
+	if name != "" {
+		target = w.folderURL.JoinPath(name)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create WebDAV request: %w", err)
+	}
+	if w.username != "" {
+		req.SetBasicAuth(w.username, w.password)
+	}
+	return req, nil
+}
@@ -0,0 +1,120 @@
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeWebDAV serves a single folder /nas/backups/ that does not exist yet
+type fakeWebDAV struct {
+	mu     sync.Mutex
+	folder bool
+	files  map[string][]byte
+}
+
+func (f *fakeWebDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if user, password, ok := r.BasicAuth(); !ok || user != "fritz" || password != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	name, inFolder := strings.CutPrefix(r.URL.Path, "/nas/backups/")
+	switch {
+	case r.Method == "MKCOL" && r.URL.Path == "/nas/backups/":
+		if f.folder {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		f.folder = true
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == "PROPFIND" && r.URL.Path == "/nas/backups/":
+		if !f.folder {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprint(w, `<?xml version="1.0"?><D:multistatus xmlns:D="DAV:"><D:response><D:href>/nas/backups/</D:href></D:response>`)
+		for name := range f.files {
+			fmt.Fprintf(w, "<D:response><D:href>http://%s/nas/backups/%s</D:href></D:response>", r.Host, name)
+		}
+		fmt.Fprint(w, "</D:multistatus>")
+	case r.Method == http.MethodPut && inFolder:
+		if !f.folder {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.files[name], _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodDelete && inFolder:
+		if _, exists := f.files[name]; !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(f.files, name)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestWebDAV(t *testing.T) {
+	share := &fakeWebDAV{files: map[string][]byte{}}
+	server := httptest.NewServer(share)
+	defer server.Close()
+
+	webdav, err := NewWebDAV(WebDAVOptions{URL: server.URL + "/nas/backups", Username: "fritz", Password: "secret"})
+	if err != nil {
+		t.Fatalf("NewWebDAV failed: %v", err)
+	}
+	ctx := context.Background()
+
+	names, err := webdav.List(ctx)
+	if err != nil || len(names) != 0 {
+		t.Errorf("Expected a missing folder to have no backups, got %v (%v)", names, err)
+	}
+
+	for _, name := range []string{"first.db.gz", "second.db.gz"} {
+		if err := webdav.Upload(ctx, name, strings.NewReader(name), int64(len(name))); err != nil {
+			t.Fatalf("Upload failed: %v", err)
+		}
+	}
+	if !share.folder || string(share.files["first.db.gz"]) != "first.db.gz" {
+		t.Errorf("Expected the upload to create the folder, got %v", share.files)
+	}
+
+	names, err = webdav.List(ctx)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	slices.Sort(names)
+	if !slices.Equal(names, []string{"first.db.gz", "second.db.gz"}) {
+		t.Errorf("Expected the files of the folder, got %v", names)
+	}
+
+	if err := webdav.Delete(ctx, "first.db.gz"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := webdav.Delete(ctx, "first.db.gz"); err != nil {
+		t.Errorf("Expected deleting a missing file to succeed, got %v", err)
+	}
+	if len(share.files) != 1 {
+		t.Errorf("Expected one file left, got %v", share.files)
+	}
+
+	unauthorized, err := NewWebDAV(WebDAVOptions{URL: server.URL + "/nas/backups/"})
+	if err != nil {
+		t.Fatalf("NewWebDAV failed: %v", err)
+	}
+	if err := unauthorized.Upload(ctx, "third.db.gz", strings.NewReader("x"), 1); err == nil || !strings.Contains(err.Error(), "HTTP 401") {
+		t.Errorf("Expected the upload without credentials to fail with HTTP 401, got %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+
+	mqtt "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+// Broker is an embedded MQTT broker for integration tests and the self-test mode
+type Broker struct {
+	server *mqtt.Server
+	auth   *credentialsHook
+	host   string
+	port   int
+	nextID int
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// Message is a message received by a broker subscription
+type Message struct {
+	Topic    string
+	Payload  []byte
+	Retained bool
+}
+
+// credentialsHook accepts all clients until credentials are set and allows
+// access to all topics until an ACL is set
+type credentialsHook struct {
+	auth.AllowHook
+	mu       sync.RWMutex
+	username string
+	password string
+	acl      func(topic string, write bool) bool
+}
+
+// ID returns the ID of the hook
+func (h *credentialsHook) ID() string {
+	return "credentials-auth"
+}
+
+// OnConnectAuthenticate checks the credentials of a connecting client
+func (h *credentialsHook) OnConnectAuthenticate(cl *mqtt.Client, pk packets.Packet) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.username == "" {
+		return true
+	}
+	return string(pk.Connect.Username) == h.username && string(pk.Connect.Password) == h.password
+}
+
+// OnACLCheck checks the access of a client to a topic or subscription filter
+func (h *credentialsHook) OnACLCheck(cl *mqtt.Client, topic string, write bool) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.acl == nil || h.acl(topic, write)
+}
+
+// New creates a new embedded broker accepting all clients
+func New() (*Broker, error) {
+	server := mqtt.New(&mqtt.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+
+	hook := new(credentialsHook)
+	if err := server.AddHook(hook, nil); err != nil {
+		return nil, fmt.Errorf("failed to configure broker auth: %w", err)
+	}
+
+	return &Broker{server: server, auth: hook}, nil
+}
+
+// SetCredentials restricts new connections to the given credentials, e.g. to
+// test credential rotation. An empty username accepts all clients again.
+func (b *Broker) SetCredentials(username, password string) {
+	b.auth.mu.Lock()
+	defer b.auth.mu.Unlock()
+	b.auth.username = username
+	b.auth.password = password
+}
+
+// SetACL restricts the access of network clients to topics, e.g. to test
+// misconfigured ACLs: allow is asked for each publish (write) and for each
+// subscription and delivery (read). Denied QoS 0 publishes are dropped
+// silently. A nil allow grants access to all topics again.
+func (b *Broker) SetACL(allow func(topic string, write bool) bool) {
+	b.auth.mu.Lock()
+	defer b.auth.mu.Unlock()
+	b.auth.acl = allow
+}
+
+// Start listens on a random local port and returns host and port to connect to
+func (b *Broker) Start() (string, int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to listen for MQTT clients: %w", err)
+	}
+
+	host, portStr, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		_ = listener.Close()
+		return "", 0, fmt.Errorf("failed to determine broker address: %w", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		_ = listener.Close()
+		return "", 0, fmt.Errorf("failed to determine broker port: %w", err)
+	}
+
+	if err := b.server.AddListener(listeners.NewNet("embedded", listener)); err != nil {
+		_ = listener.Close()
+		return "", 0, fmt.Errorf("failed to add broker listener: %w", err)
+	}
+
+	if err := b.server.Serve(); err != nil {
+		return "", 0, fmt.Errorf("failed to start broker: %w", err)
+	}
+
+	b.host = host
+	b.port = port
+	return host, port, nil
+}
+
+// Address returns host and port of the running broker
+func (b *Broker) Address() (string, int) {
+	return b.host, b.port
+}
+
+// Subscribe registers a handler for all messages matching the topic filter.
+// Retained messages matching the filter are delivered immediately.
+func (b *Broker) Subscribe(filter string, handler func(Message)) error {
+	b.nextID++
+	err := b.server.Subscribe(filter, b.nextID, func(_ *mqtt.Client, _ packets.Subscription, pk packets.Packet) {
+		handler(Message{
+			Topic:    pk.TopicName,
+			Payload:  pk.Payload,
+			Retained: pk.FixedHeader.Retain,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to '%s': %w", filter, err)
+	}
+	return nil
+}
+
+// Publish sends a message to all subscribed clients, e.g. a command in tests
+func (b *Broker) Publish(topic string, payload []byte, retain bool) error {
+	if err := b.server.Publish(topic, payload, retain, 1); err != nil {
+		return fmt.Errorf("failed to publish to '%s': %w", topic, err)
+	}
+	return nil
+}
+
+// Close stops the broker and disconnects all clients; closing it again does nothing
+func (b *Broker) Close() error {
+	b.closeOnce.Do(func() { b.closeErr = b.server.Close() })
+	return b.closeErr
+}
+
+// DropClients closes the connections of all network clients without a clean
+// disconnect, e.g. to test automatic reconnects
+func (b *Broker) DropClients() {
+	for _, cl := range b.server.Clients.GetAll() {
+		if !cl.Net.Inline {
+			cl.Stop(errors.New("connection dropped"))
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package broker
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+func TestBrokerDeliversPublishedMessages(t *testing.T) {
+	b, err := New()
+	if err != nil {
+		t.Fatalf("Failed to create broker: %v", err)
+	}
+	host, port, err := b.Start()
+	if err != nil {
+		t.Fatalf("Failed to start broker: %v", err)
+	}
+	defer b.Close()
+
+	received := make(chan Message, 1)
+	if err := b.Subscribe("test/#", func(msg Message) { received <- msg }); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	opts := paho.NewClientOptions().AddBroker(fmt.Sprintf("tcp://%s:%d", host, port)).SetClientID("broker-test")
+	client := paho.NewClient(opts)
+	if token := client.Connect(); token.Wait() && token.Error() != nil {
+		t.Fatalf("Failed to connect: %v", token.Error())
+	}
+	defer client.Disconnect(0)
+
+	if token := client.Publish("test/topic", 1, true, "hello"); token.Wait() && token.Error() != nil {
+		t.Fatalf("Failed to publish: %v", token.Error())
+	}
+
+	select {
+	case msg := <-received:
+		if msg.Topic != "test/topic" || string(msg.Payload) != "hello" {
+			t.Errorf("Unexpected message %s: %s", msg.Topic, msg.Payload)
+		}
+		if !msg.Retained {
+			t.Error("Expected retain flag to be kept")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for message")
+	}
+}
+
+func TestBrokerAddress(t *testing.T) {
+	b, err := New()
+	if err != nil {
+		t.Fatalf("Failed to create broker: %v", err)
+	}
+	host, port, err := b.Start()
+	if err != nil {
+		t.Fatalf("Failed to start broker: %v", err)
+	}
+	defer b.Close()
+
+	gotHost, gotPort := b.Address()
+	if gotHost != host || gotPort != port || port == 0 {
+		t.Errorf("Address() = %s:%d, expected %s:%d", gotHost, gotPort, host, port)
+	}
+}
@@ -0,0 +1,218 @@
+package caldav
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// Calendar creates a calendar entry on a CalDAV server for every answered call
+// that lasted at least the minimum duration, e.g. as a log of client calls
+type Calendar struct {
+	calendarURL *url.URL
+	username    string
+	password    string
+	minDuration time.Duration
+	contacts    map[string]string
+	httpClient  *http.Client
+}
+
+// Options configures a calendar
+type Options struct {
+	URL         string            // URL of the CalDAV calendar collection
+	Username    string            // Sent via basic auth if set
+	Password    string            // Sent via basic auth if Username is set
+	MinDuration time.Duration     // Shorter calls get no entry
+	Timeout     time.Duration     // Upper bound for creating a single entry
+	Contacts    map[string]string // Names of known numbers used in the entry title
+	HTTPClient  *http.Client      // Overrides the client built from Timeout
+}
+
+// DefaultOptions returns the options used when nothing else is configured
+func DefaultOptions() Options {
+	return Options{
+		MinDuration: time.Minute,
+		Timeout:     10 * time.Second,
+	}
+}
+
+// withDefaults fills unset fields from DefaultOptions; a MinDuration of 0 is valid and kept
+func (o Options) withDefaults() Options {
+	defaults := DefaultOptions()
+	if o.MinDuration < 0 {
+		o.MinDuration = defaults.MinDuration
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = defaults.Timeout
+	}
+	if o.HTTPClient == nil {
+		o.HTTPClient = &http.Client{Timeout: o.Timeout}
+	}
+	return o
+}
+
+// NewCalendar creates a new calendar
+func NewCalendar(opts Options) (*Calendar, error) {
+	opts = opts.withDefaults()
+
+	calendarURL, err := url.Parse(opts.URL)
+	if err != nil || (calendarURL.Scheme != "http" && calendarURL.Scheme != "https") || calendarURL.Host == "" {
+		return nil, fmt.Errorf("invalid CalDAV calendar URL '%s'", opts.URL)
+	}
+
+	return &Calendar{
+		calendarURL: calendarURL,
+		username:    opts.Username,
+		password:    opts.Password,
+		minDuration: opts.MinDuration,
+		contacts:    opts.Contacts,
+		httpClient:  opts.HTTPClient,
+	}, nil
+}
+
+// PublishCallEvent creates the entry once an answered call is finished.
+// Events flagged as do-not-record and calls taken by the answering machine are skipped.
+func (c *Calendar) PublishCallEvent(ctx context.Context, event types.CallEvent) error {
+	if event.DoNotRecord || event.Type != types.CallTypeDisconnect || event.FinishState == nil || *event.FinishState != types.CallStatusFinished {
+		return nil
+	}
+	if time.Duration(event.Duration)*time.Second < c.minDuration {
+		return nil
+	}
+	return c.CreateEntry(ctx, event)
+}
+
+// CreateEntry stores the call as calendar entry named after the call ID.
+// An entry that already exists, e.g. from a replayed event, is kept.
+func (c *Calendar) CreateEntry(ctx context.Context, event types.CallEvent) error {
+	entryURL := c.calendarURL.JoinPath(event.ID + ".ics")
+	body := Entry(event, c.Title(event), time.Now())
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, entryURL.String(), strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create calendar request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/calendar; charset=utf-8")
+	req.Header.Set("If-None-Match", "*")
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to create calendar entry: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusPreconditionFailed {
+		return nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("calendar entry rejected with HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+// Title returns the entry title with the contact name, or the number if it is unknown, and the duration
+func (c *Calendar) Title(event types.CallEvent) string {
+	number := Counterpart(event)
+	contact := c.contacts[number]
+	switch {
+	case contact != "":
+	case number != "":
+		contact = number
+	default:
+		contact = "unknown number"
+	}
+
+	minutes := (event.Duration + 59) / 60
+	if event.Direction == types.CallDirectionOutbound {
+		return fmt.Sprintf("Call to %s (%d min)", contact, minutes)
+	}
+	return fmt.Sprintf("Call from %s (%d min)", contact, minutes)
+}
+
+// Counterpart returns the number of the remote party of a call
+func Counterpart(event types.CallEvent) string {
+	if event.Direction == types.CallDirectionOutbound {
+		return event.Called
+	}
+	return event.Caller
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// Entry formats the disconnect event of an answered call as iCalendar
+// VEVENT. The call started talking duration seconds before the disconnect.
+func Entry(event types.CallEvent, title string, stamp time.Time) string {
+	end := event.Timestamp.UTC()
+	start := end.Add(-time.Duration(event.Duration) * time.Second)
+
+	description := []string{
+		"Direction: " + string(event.Direction),
+		"Number: " + Counterpart(event),
+	}
+	msn, msnName := event.CalledMSN, event.CalledMSNName
+	if event.Direction == types.CallDirectionOutbound {
+		msn, msnName = event.CallerMSN, event.CallerMSNName
+	}
+	if msnName != "" {
+		description = append(description, "MSN: "+msnName+" ("+msn+")")
+	} else if msn != "" {
+		description = append(description, "MSN: "+msn)
+	}
+	if event.ExtensionName != "" {
+		description = append(description, "Extension: "+event.ExtensionName+" ("+event.Extension+")")
+	} else if event.Extension != "" {
+		description = append(description, "Extension: "+event.Extension)
+	}
+
+	const layout = "20060102T150405Z"
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//fritz-callmonitor2mqtt//CalDAV//EN",
+		"BEGIN:VEVENT",
+		"UID:" + textEscaper.Replace(event.ID),
+		"DTSTAMP:" + stamp.UTC().Format(layout),
+		"DTSTART:" + start.Format(layout),
+		"DTEND:" + end.Format(layout),
+		"SUMMARY:" + textEscaper.Replace(title),
+		"DESCRIPTION:" + textEscaper.Replace(strings.Join(description, "\n")),
+		"TRANSP:TRANSPARENT",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}
+
+	var b strings.Builder
+	for _, line := range lines {
+		b.WriteString(fold(line))
+		b.WriteString("\r\n")
+	}
+	return b.String()
+}
+
+// fold splits content lines longer than 75 octets as required by RFC 5545,
+// without breaking UTF-8 sequences
+func fold(line string) string {
+	var b strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > 75 {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
@@ -0,0 +1,172 @@
+package caldav
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+func answeredCall(direction types.CallDirection, duration int) types.CallEvent {
+	finished := types.CallStatusFinished
+	return types.CallEvent{
+		ID:          "0199a8c4-0000-7000-8000-000000000001",
+		Timestamp:   time.Date(2025, 9, 21, 15, 35, 0, 0, time.UTC),
+		Type:        types.CallTypeDisconnect,
+		Direction:   direction,
+		Line:        2,
+		Trunk:       "SIP0",
+		Extension:   "1",
+		Caller:      "+4930123456",
+		Called:      "+4930990133",
+		CalledMSN:   "990133",
+		Duration:    duration,
+		Status:      types.CallStatusIdle,
+		FinishState: &finished,
+	}
+}
+
+func TestTitle(t *testing.T) {
+	calendar, err := NewCalendar(Options{URL: "https://dav.example.com/cal/", Contacts: map[string]string{"+4930123456": "ACME Corp"}})
+	if err != nil {
+		t.Fatalf("NewCalendar failed: %v", err)
+	}
+
+	anonymous := answeredCall(types.CallDirectionInbound, 60)
+	anonymous.Caller = ""
+
+	tests := []struct {
+		name     string
+		event    types.CallEvent
+		expected string
+	}{
+		{"known caller", answeredCall(types.CallDirectionInbound, 725), "Call from ACME Corp (13 min)"},
+		{"unknown callee", answeredCall(types.CallDirectionOutbound, 60), "Call to +4930990133 (1 min)"},
+		{"anonymous caller", anonymous, "Call from unknown number (1 min)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if title := calendar.Title(tt.event); title != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, title)
+			}
+		})
+	}
+}
+
+func TestEntry(t *testing.T) {
+	entry := Entry(answeredCall(types.CallDirectionInbound, 725), "Call from Müller, Schmidt & Partner; Rechtsanwälte und Notare (13 min)", time.Date(2025, 9, 21, 15, 35, 1, 0, time.UTC))
+
+	for _, expected := range []string{
+		"UID:0199a8c4-0000-7000-8000-000000000001\r\n",
+		"DTSTAMP:20250921T153501Z\r\n",
+		"DTSTART:20250921T152255Z\r\n",
+		"DTEND:20250921T153500Z\r\n",
+	} {
+		if !strings.Contains(entry, expected) {
+			t.Errorf("Expected entry to contain %q, got\n%s", expected, entry)
+		}
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(entry, "\r\n"), "\r\n") {
+		if len(line) > 75 {
+			t.Errorf("Line longer than 75 octets: %q", line)
+		}
+	}
+	unfolded := strings.ReplaceAll(entry, "\r\n ", "")
+	if !strings.Contains(unfolded, `SUMMARY:Call from Müller\, Schmidt & Partner\; Rechtsanwälte und Notare (13 min)`) {
+		t.Errorf("Expected escaped summary, got\n%s", unfolded)
+	}
+	if !strings.Contains(unfolded, `DESCRIPTION:Direction: inbound\nNumber: +4930123456\nMSN: 990133\nExtension: 1`+"\r\n") {
+		t.Errorf("Expected description with call details, got\n%s", unfolded)
+	}
+
+	named := answeredCall(types.CallDirectionInbound, 60)
+	named.CalledMSNName = "Office"
+	if unfolded := strings.ReplaceAll(Entry(named, "Call", time.Now()), "\r\n ", ""); !strings.Contains(unfolded, `\nMSN: Office (990133)\n`) {
+		t.Errorf("Expected the MSN with its name, got\n%s", unfolded)
+	}
+}
+
+func TestCalendar(t *testing.T) {
+	var requests []*http.Request
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+		if username, password, ok := r.BasicAuth(); !ok || username != "anna" || password != "secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if len(requests) > 1 {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	calendar, err := NewCalendar(Options{URL: server.URL + "/calendars/anna/calls/", Username: "anna", Password: "secret", MinDuration: 2 * time.Minute})
+	if err != nil {
+		t.Fatalf("NewCalendar failed: %v", err)
+	}
+
+	ring := answeredCall(types.CallDirectionInbound, 300)
+	ring.Type = types.CallTypeRing
+	optedOut := answeredCall(types.CallDirectionInbound, 300)
+	optedOut.DoNotRecord = true
+	messageBox := answeredCall(types.CallDirectionInbound, 300)
+	*messageBox.FinishState = types.CallStatusMessageBox
+
+	for _, event := range []types.CallEvent{
+		ring,
+		optedOut,
+		messageBox,
+		answeredCall(types.CallDirectionInbound, 90),
+		answeredCall(types.CallDirectionOutbound, 300),
+	} {
+		if err := calendar.PublishCallEvent(context.Background(), event); err != nil {
+			t.Fatalf("PublishCallEvent failed: %v", err)
+		}
+	}
+
+	if len(requests) != 1 {
+		t.Fatalf("Expected only the long answered call to be stored, got %d requests", len(requests))
+	}
+	if requests[0].Method != http.MethodPut || requests[0].URL.Path != "/calendars/anna/calls/0199a8c4-0000-7000-8000-000000000001.ics" {
+		t.Errorf("Unexpected request %s %s", requests[0].Method, requests[0].URL)
+	}
+	if requests[0].Header.Get("If-None-Match") != "*" {
+		t.Error("Expected existing entries not to be overwritten")
+	}
+	if !strings.Contains(bodies[0], "SUMMARY:Call to +4930990133 (5 min)") {
+		t.Errorf("Unexpected entry\n%s", bodies[0])
+	}
+
+	// Replayed events must not fail on the existing entry
+	if err := calendar.PublishCallEvent(context.Background(), answeredCall(types.CallDirectionOutbound, 300)); err != nil {
+		t.Errorf("Expected existing entry to be kept, got %v", err)
+	}
+
+	rejected, err := NewCalendar(Options{URL: server.URL, Username: "anna", Password: "wrong"})
+	if err != nil {
+		t.Fatalf("NewCalendar failed: %v", err)
+	}
+	if err := rejected.PublishCallEvent(context.Background(), answeredCall(types.CallDirectionOutbound, 300)); err == nil || !strings.Contains(err.Error(), "HTTP 401") {
+		t.Errorf("Expected HTTP 401 error, got %v", err)
+	}
+}
+
+func TestNewCalendarInvalidURL(t *testing.T) {
+	for _, calendarURL := range []string{"", "dav.example.com/cal", "ftp://dav.example.com/cal"} {
+		if _, err := NewCalendar(Options{URL: calendarURL}); err == nil {
+			t.Errorf("Expected error for URL %q", calendarURL)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package callquery
+
+import (
+	"context"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/database"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/mqtt"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// Store provides the stored calls
+type Store interface {
+	ListCalls(ctx context.Context, from, to time.Time) ([]database.CallRecord, error)
+}
+
+// Options configures a service
+type Options struct {
+	MaxCalls int           // Upper bound for the calls returned by one query, also used without limit
+	Period   time.Duration // Calls searched without from, back from to
+	Timeout  time.Duration // Upper bound for a single query
+}
+
+// DefaultOptions returns the options used when nothing else is configured
+func DefaultOptions() Options {
+	return Options{
+		MaxCalls: 100,
+		Period:   30 * 24 * time.Hour,
+		Timeout:  10 * time.Second,
+	}
+}
+
+// withDefaults fills unset fields from DefaultOptions
+func (o Options) withDefaults() Options {
+	defaults := DefaultOptions()
+	if o.MaxCalls <= 0 {
+		o.MaxCalls = defaults.MaxCalls
+	}
+	if o.Period <= 0 {
+		o.Period = defaults.Period
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = defaults.Timeout
+	}
+	return o
+}
+
+// Service answers the call queries of MQTT clients from the database, so
+// dashboards without access to the HTTP API can show the call log. It only
+// reads; deleted calls are never returned.
+type Service struct {
+	store Store
+	opts  Options
+	now   func() time.Time
+}
+
+// NewService creates a service
+func NewService(store Store, opts Options) *Service {
+	return &Service{store: store, opts: opts.withDefaults(), now: time.Now}
+}
+
+// QueryCalls returns the newest calls matching the query, see mqtt.CallQuery
+func (s *Service) QueryCalls(ctx context.Context, query mqtt.CallQuery) ([]mqtt.QueriedCall, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.opts.Timeout)
+	defer cancel()
+
+	to := query.To
+	if to.IsZero() {
+		// Calls starting right now are included
+		to = s.now().Add(time.Second)
+	}
+	from := query.From
+	if from.IsZero() {
+		from = to.Add(-s.opts.Period)
+	}
+	limit := s.opts.MaxCalls
+	if query.Limit > 0 {
+		limit = min(query.Limit, s.opts.MaxCalls)
+	}
+
+	records, err := s.store.ListCalls(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	calls := make([]mqtt.QueriedCall, 0)
+	for i := len(records) - 1; i >= 0 && len(calls) < limit; i-- {
+		record := records[i]
+		status := Status(record)
+		if query.Line != nil && record.Line != *query.Line {
+			continue
+		}
+		if query.Status != "" && status != query.Status {
+			continue
+		}
+		call := mqtt.QueriedCall{
+			ID:        record.CallID,
+			Direction: record.Direction,
+			Started:   record.Started,
+			Caller:    record.Caller,
+			Called:    record.Called,
+			CallerMSN: record.CallerMSN,
+			CalledMSN: record.CalledMSN,
+			Line:      record.Line,
+			Trunk:     record.Trunk,
+			Duration:  record.Duration,
+			Status:    status,
+			Tags:      record.Tags,
+		}
+		if !record.Ended.IsZero() {
+			call.Ended = &record.Ended
+		}
+		calls = append(calls, call)
+	}
+	return calls, nil
+}
+
+// Status returns the finish state of an ended call, as in the completed call
+// record, or active for a call that did not end yet
+func Status(record database.CallRecord) string {
+	switch {
+	case record.Ended.IsZero():
+		return mqtt.CallQueryStatusActive
+	case record.Duration > 0:
+		return string(types.CallStatusFinished)
+	case record.Direction == types.CallDirectionOutbound:
+		return string(types.CallStatusNotReached)
+	default:
+		return string(types.CallStatusMissedCall)
+	}
+}
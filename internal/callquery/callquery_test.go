@@ -0,0 +1,101 @@
+package callquery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/database"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/mqtt"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+type fakeStore struct {
+	calls    []database.CallRecord
+	from, to time.Time
+}
+
+func (s *fakeStore) ListCalls(_ context.Context, from, to time.Time) ([]database.CallRecord, error) {
+	s.from, s.to = from, to
+	var calls []database.CallRecord
+	for _, call := range s.calls {
+		if !call.Started.Before(from) && call.Started.Before(to) {
+			calls = append(calls, call)
+		}
+	}
+	return calls, nil
+}
+
+func TestQueryCalls(t *testing.T) {
+	start := time.Date(2025, 9, 21, 15, 0, 0, 0, time.UTC)
+	store := &fakeStore{calls: []database.CallRecord{
+		{CallID: "answered", Started: start, Ended: start.Add(time.Minute), Direction: types.CallDirectionInbound, Line: 1, Duration: 55},
+		{CallID: "missed", Started: start.Add(time.Hour), Ended: start.Add(time.Hour + 10*time.Second), Direction: types.CallDirectionInbound, Line: 1},
+		{CallID: "not-reached", Started: start.Add(2 * time.Hour), Ended: start.Add(2*time.Hour + 20*time.Second), Direction: types.CallDirectionOutbound, Line: 2},
+		{CallID: "active", Started: start.Add(3 * time.Hour), Direction: types.CallDirectionOutbound, Line: 2},
+	}}
+	service := NewService(store, Options{MaxCalls: 3})
+	service.now = func() time.Time { return start.Add(4 * time.Hour) }
+
+	line := 1
+	tests := []struct {
+		name     string
+		query    mqtt.CallQuery
+		expected []string
+	}{
+		{"newest first up to the maximum", mqtt.CallQuery{}, []string{"active", "not-reached", "missed"}},
+		{"limit", mqtt.CallQuery{Limit: 1}, []string{"active"}},
+		{"limit above the maximum", mqtt.CallQuery{Limit: 10}, []string{"active", "not-reached", "missed"}},
+		{"line", mqtt.CallQuery{Line: &line}, []string{"missed", "answered"}},
+		{"status", mqtt.CallQuery{Status: "missedCall"}, []string{"missed"}},
+		{"active", mqtt.CallQuery{Status: mqtt.CallQueryStatusActive}, []string{"active"}},
+		{"period", mqtt.CallQuery{From: start, To: start.Add(2 * time.Hour)}, []string{"missed", "answered"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls, err := service.QueryCalls(context.Background(), tt.query)
+			if err != nil {
+				t.Fatalf("QueryCalls failed: %v", err)
+			}
+			ids := make([]string, len(calls))
+			for i, call := range calls {
+				ids[i] = call.ID
+			}
+			if len(ids) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, ids)
+			}
+			for i := range ids {
+				if ids[i] != tt.expected[i] {
+					t.Errorf("Expected %v, got %v", tt.expected, ids)
+					break
+				}
+			}
+		})
+	}
+
+	// Without from the default period back from to is searched
+	if _, err := service.QueryCalls(context.Background(), mqtt.CallQuery{To: start}); err != nil {
+		t.Fatalf("QueryCalls failed: %v", err)
+	}
+	if !store.to.Equal(start) || !store.from.Equal(start.Add(-DefaultOptions().Period)) {
+		t.Errorf("Expected the default period before %v, got %v to %v", start, store.from, store.to)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	start := time.Date(2025, 9, 21, 15, 0, 0, 0, time.UTC)
+	tests := []struct {
+		record   database.CallRecord
+		expected string
+	}{
+		{database.CallRecord{Started: start, Direction: types.CallDirectionInbound}, "active"},
+		{database.CallRecord{Started: start, Ended: start.Add(time.Minute), Direction: types.CallDirectionInbound, Duration: 50}, "finished"},
+		{database.CallRecord{Started: start, Ended: start.Add(time.Minute), Direction: types.CallDirectionInbound}, "missedCall"},
+		{database.CallRecord{Started: start, Ended: start.Add(time.Minute), Direction: types.CallDirectionOutbound}, "notReached"},
+	}
+	for _, tt := range tests {
+		if status := Status(tt.record); status != tt.expected {
+			t.Errorf("Expected %s, got %s for %+v", tt.expected, status, tt.record)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package callrecord
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/database"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// Store provides the stored calls
+type Store interface {
+	GetCall(ctx context.Context, callID string) (database.CallRecord, error)
+}
+
+// Target receives the records, e.g. the MQTT client
+type Target interface {
+	PublishCompletedCall(ctx context.Context, v any) error
+}
+
+// Record is the consolidated record of a finished call, so consumers do not
+// have to stitch its events together
+type Record struct {
+	ID          string                      `json:"id"`
+	Direction   types.CallDirection         `json:"direction"`
+	Started     time.Time                   `json:"started"`             // RING or CALL
+	Connected   *time.Time                  `json:"connected,omitempty"` // CONNECT, only for answered calls
+	Ended       time.Time                   `json:"ended"`               // DISCONNECT
+	Duration    int                         `json:"duration"`            // Talk time in seconds
+	Caller      types.LineStatusParticipant `json:"caller"`
+	Called      types.LineStatusParticipant `json:"called"`
+	Extension   *types.LineStatusExtension  `json:"extension,omitempty"`
+	MSN         string                      `json:"msn,omitempty"`      // Own number: called MSN of inbound, caller MSN of outbound calls
+	MSNName     string                      `json:"msn_name,omitempty"` // Configured name of the MSN
+	Line        int                         `json:"line"`
+	Trunk       string                      `json:"trunk,omitempty"`
+	TrunkName   string                      `json:"trunk_name,omitempty"`
+	FinishState types.CallStatus            `json:"finish_state"` // missedCall, notReached or finished
+	MessageBox  bool                        `json:"message_box,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+}
+
+// Options configures a publisher
+type Options struct {
+	Contacts map[string]string // Names of known numbers
+	Timeout  time.Duration     // Upper bound for loading and publishing a single record
+}
+
+// DefaultOptions returns the options used when nothing else is configured
+func DefaultOptions() Options {
+	return Options{Timeout: 10 * time.Second}
+}
+
+// withDefaults fills unset fields from DefaultOptions
+func (o Options) withDefaults() Options {
+	if o.Timeout <= 0 {
+		o.Timeout = DefaultOptions().Timeout
+	}
+	return o
+}
+
+// Publisher publishes a record for every call whose disconnect was stored.
+// Records are assembled from the database row, so they match the call log.
+type Publisher struct {
+	store  Store
+	target Target
+	opts   Options
+}
+
+// NewPublisher creates a publisher
+func NewPublisher(store Store, target Target, opts Options) *Publisher {
+	return &Publisher{store: store, target: target, opts: opts.withDefaults()}
+}
+
+// Stored publishes the records of the finished calls in a stored batch of
+// call events. It is meant as database.WriterOptions.OnFlush.
+func (p *Publisher) Stored(events []types.CallEvent) {
+	for _, event := range events {
+		if event.Type != types.CallTypeDisconnect {
+			continue
+		}
+		if err := p.publish(event); err != nil {
+			log.Printf("Failed to publish completed call %s: %v", event.ID, err)
+		}
+	}
+}
+
+// publish loads the call of the disconnect event and publishes its record
+func (p *Publisher) publish(event types.CallEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.opts.Timeout)
+	defer cancel()
+
+	call, err := p.store.GetCall(ctx, event.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load call: %w", err)
+	}
+	return p.target.PublishCompletedCall(ctx, p.assemble(call, event))
+}
+
+// assemble builds the record of a stored call. The disconnect event adds
+// what the calls table does not keep: finish state, extension and names.
+func (p *Publisher) assemble(call database.CallRecord, event types.CallEvent) Record {
+	location := event.Timestamp.Location()
+	record := Record{
+		ID:         call.CallID,
+		Direction:  call.Direction,
+		Started:    call.Started.In(location),
+		Ended:      call.Ended.In(location),
+		Duration:   call.Duration,
+		Caller:     types.LineStatusParticipant{PhoneNumber: call.Caller, Name: p.opts.Contacts[call.Caller]},
+		Called:     types.LineStatusParticipant{PhoneNumber: call.Called, Name: p.opts.Contacts[call.Called]},
+		MSN:        call.CalledMSN,
+		MSNName:    event.CalledMSNName,
+		Line:       call.Line,
+		Trunk:      call.Trunk,
+		TrunkName:  event.TrunkName,
+		MessageBox: event.MessageBox,
+		Tags:       call.Tags,
+	}
+	if call.Ended.IsZero() {
+		record.Ended = event.Timestamp
+	}
+	if !call.Connected.IsZero() {
+		connected := call.Connected.In(location)
+		record.Connected = &connected
+	}
+	if call.Direction == types.CallDirectionOutbound {
+		record.MSN, record.MSNName = call.CallerMSN, event.CallerMSNName
+	}
+	if event.Extension != "" {
+		record.Extension = &types.LineStatusExtension{ID: event.Extension, Name: event.ExtensionName}
+	}
+	if event.FinishState != nil {
+		record.FinishState = *event.FinishState
+	}
+	return record
+}
@@ -0,0 +1,97 @@
+package callrecord
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/database"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+type fakeStore map[string]database.CallRecord
+
+func (s fakeStore) GetCall(_ context.Context, callID string) (database.CallRecord, error) {
+	call, ok := s[callID]
+	if !ok {
+		return database.CallRecord{}, database.ErrNotFound
+	}
+	return call, nil
+}
+
+type fakeTarget struct {
+	records []Record
+}
+
+func (t *fakeTarget) PublishCompletedCall(_ context.Context, v any) error {
+	t.records = append(t.records, v.(Record))
+	return nil
+}
+
+func TestStoredPublishesFinishedCalls(t *testing.T) {
+	start := time.Date(2025, 9, 21, 15, 30, 0, 0, time.UTC)
+	store := fakeStore{
+		"in": {
+			CallID:    "in",
+			Started:   start,
+			Connected: start.Add(5 * time.Second),
+			Ended:     start.Add(65 * time.Second),
+			Direction: types.CallDirectionInbound,
+			Caller:    "+4930123456",
+			Called:    "990133",
+			CalledMSN: "990133",
+			Line:      2,
+			Trunk:     "SIP0",
+			Duration:  60,
+			Tags:      []string{"work"},
+		},
+	}
+	target := &fakeTarget{}
+	publisher := NewPublisher(store, target, Options{Contacts: map[string]string{"+4930123456": "ACME Corp"}})
+
+	location := time.FixedZone("CEST", 2*60*60)
+	finished := types.CallStatusFinished
+	publisher.Stored([]types.CallEvent{
+		{ID: "in", Timestamp: start.Add(5 * time.Second).In(location), Type: types.CallTypeConnect, Extension: "1"},
+		{ID: "in", Timestamp: start.Add(65 * time.Second).In(location), Type: types.CallTypeDisconnect, Extension: "1", ExtensionName: "Office", TrunkName: "Telekom", FinishState: &finished},
+		{ID: "unknown", Timestamp: start, Type: types.CallTypeDisconnect},
+	})
+
+	if len(target.records) != 1 {
+		t.Fatalf("Expected 1 record, got %+v", target.records)
+	}
+	record := target.records[0]
+	if record.ID != "in" || record.Direction != types.CallDirectionInbound || record.Duration != 60 || record.FinishState != types.CallStatusFinished {
+		t.Errorf("Unexpected record %+v", record)
+	}
+	if record.Caller.Name != "ACME Corp" || record.Called.PhoneNumber != "990133" || record.MSN != "990133" {
+		t.Errorf("Unexpected participants %+v, %+v (MSN %s)", record.Caller, record.Called, record.MSN)
+	}
+	if record.Extension == nil || record.Extension.Name != "Office" || record.TrunkName != "Telekom" {
+		t.Errorf("Expected extension Office on Telekom, got %+v on %s", record.Extension, record.TrunkName)
+	}
+	if record.Connected == nil || !record.Connected.Equal(start.Add(5*time.Second)) || record.Started.Location() != location {
+		t.Errorf("Unexpected call times %v, %v, %v", record.Started, record.Connected, record.Ended)
+	}
+	if len(record.Tags) != 1 || record.Tags[0] != "work" {
+		t.Errorf("Expected tag work, got %v", record.Tags)
+	}
+}
+
+func TestAssembleUnansweredOutboundCall(t *testing.T) {
+	start := time.Date(2025, 9, 21, 15, 30, 0, 0, time.UTC)
+	call := database.CallRecord{CallID: "out", Started: start, Ended: start.Add(20 * time.Second), Direction: types.CallDirectionOutbound, Caller: "990133", Called: "01701234567", CallerMSN: "990133"}
+	notReached := types.CallStatusNotReached
+
+	record := NewPublisher(fakeStore{}, &fakeTarget{}, Options{}).assemble(call, types.CallEvent{ID: "out", Timestamp: start.Add(20 * time.Second), Type: types.CallTypeDisconnect, FinishState: &notReached})
+	if record.Connected != nil || record.Extension != nil {
+		t.Errorf("Expected no connect and extension, got %v and %+v", record.Connected, record.Extension)
+	}
+	if record.MSN != "990133" || record.FinishState != types.CallStatusNotReached {
+		t.Errorf("Unexpected record %+v", record)
+	}
+	if !errors.Is(NewPublisher(fakeStore{}, &fakeTarget{}, Options{}).publish(types.CallEvent{ID: "out"}), database.ErrNotFound) {
+		t.Error("Expected ErrNotFound for an unknown call")
+	}
+}
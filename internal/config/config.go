@@ -2,12 +2,27 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/phone"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/backoff"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/cloudevents"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/codec"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/seal"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
 )
 
+// logLabelName matches the label names accepted by Loki
+var logLabelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
 // Config holds all configuration for the application
 type Config struct {
 	// Fritz!Box settings
@@ -24,32 +39,218 @@ type Config struct {
 
 	// Database settings
 	Database DatabaseConfig `mapstructure:"database"`
+
+	// InfluxDB / line protocol export settings
+	Influx InfluxConfig `mapstructure:"influx"`
+
+	// CalDAV calendar entries for answered calls
+	CalDAV CalDAVConfig `mapstructure:"caldav"`
+
+	// Call event outputs besides MQTT
+	Output OutputConfig `mapstructure:"output"`
+
+	// Monthly call reports
+	Report ReportConfig `mapstructure:"report"`
+
+	// Push notifications via Telegram, Pushover and ntfy
+	Notify NotifyConfig `mapstructure:"notify"`
+
+	// Scheduled backups of the SQLite database to S3 or WebDAV
+	Backup BackupConfig `mapstructure:"backup"`
 }
 
 // FritzBoxConfig contains Fritz!Box connection settings
 type FritzBoxConfig struct {
-	Host string `mapstructure:"host"`
-	Port int    `mapstructure:"port"`
+	Host           string        `mapstructure:"host"`
+	Port           int           `mapstructure:"port"`
+	ConnectTimeout time.Duration `mapstructure:"connect_timeout"`
+
+	// TR-064 access for the DND command topic, timezone detection and the call list backfill
+	Username           string        `mapstructure:"username"`
+	Password           string        `mapstructure:"password"`
+	TR064Port          int           `mapstructure:"tr064_port"`
+	DNDControl         bool          `mapstructure:"dnd_control"`          // Enable the DND command and state topics
+	DNDDeflections     []string      `mapstructure:"dnd_deflections"`      // Deflection rule IDs switched by ON/OFF (empty = all)
+	DNDRefreshInterval time.Duration `mapstructure:"dnd_refresh_interval"` // How often the DND state is re-read from the Fritz!Box
+	DetectTimezone     bool          `mapstructure:"detect_timezone"`      // Parse timestamps in the timezone of the Fritz!Box instead of APP_TIMEZONE
+	BackfillCallList   bool          `mapstructure:"backfill_call_list"`   // Import the call list of the Fritz!Box into the empty history on the first start
+
+	// Callmonitor timestamps carry two-digit years
+	TimestampPivotYear int           `mapstructure:"timestamp_pivot_year"` // First year of the century window (0 = sliding window)
+	StrictTimestamps   bool          `mapstructure:"strict_timestamps"`    // Reject lines with implausible timestamps
+	MaxTimestampSkew   time.Duration `mapstructure:"max_timestamp_skew"`   // Tolerated difference to the local clock in strict mode
+
+	RingGroupWindow   time.Duration `mapstructure:"ring_group_window"`  // Window for grouping parallel RINGs of one call (negative disables)
+	ForwardWindow     time.Duration `mapstructure:"forward_window"`     // Window for linking a forwarding CALL to its RING (negative disables)
+	ForwardExtensions []string      `mapstructure:"forward_extensions"` // Extensions of forwarding CALLs from the called number
 }
 
+// PBXConfig contains telephony settings of the Fritz!Box
 type PBXConfig struct {
-	MSN           []string `mapstructure:"msn"`             // List of MSNs ["9876541","9876542",...]
-	CountryCode   string   `mapstructure:"country_code"`    // Country code
-	LocalAreaCode string   `mapstructure:"local_area_code"` // Local area code
+	MSN            []string `mapstructure:"msn"`             // List of MSNs ["9876541","9876542=Office",...], see GetMSNs
+	CountryCode    string   `mapstructure:"country_code"`    // Country code
+	Region         string   `mapstructure:"region"`          // ISO 3166-1 region code (derived from country code if empty)
+	LocalAreaCode  string   `mapstructure:"local_area_code"` // Local area code
+	NumberFormat   string   `mapstructure:"number_format"`   // Format of the numbers in published payloads: e164, national, raw or all
+	DoNotRecord    []string `mapstructure:"do_not_record"`   // MSNs/extensions whose calls are not logged
+	TAMExtensions  []string `mapstructure:"tam_extensions"`  // Extensions of the answering machines
+	Extensions     []string `mapstructure:"extensions"`      // Names of the extensions as extension=name
+	Trunks         []string `mapstructure:"trunks"`          // Names of the SIP lines as trunk=name
+	TrunkAllow     []string `mapstructure:"trunk_allow"`     // Process only calls on these trunks (empty = all)
+	TrunkDeny      []string `mapstructure:"trunk_deny"`      // Ignore calls on these trunks
+	ExtensionAllow []string `mapstructure:"extension_allow"` // Process only calls of these MSNs/extensions (empty = all)
+	ExtensionDeny  []string `mapstructure:"extension_deny"`  // Ignore calls of these MSNs/extensions
+	IgnoreInternal bool     `mapstructure:"ignore_internal"` // Ignore calls between extensions, dialed with **
+	TagRules       []string `mapstructure:"tag_rules"`       // Rules attaching tags to calls as tag:condition=value;...
+	ContactGroups  []string `mapstructure:"contact_groups"`  // Groups of known numbers for the tag rules as number=group
+	VIPNumbers     []string `mapstructure:"vip_numbers"`     // Callers whose calls get priority
+	VIPGroups      []string `mapstructure:"vip_groups"`      // Contact groups whose calls get priority
+
+	RepeatCallWindow    time.Duration `mapstructure:"repeat_call_window"`    // Calls of the same caller within this window are flagged as repeat calls (0 disables)
+	SuppressRepeatCalls bool          `mapstructure:"suppress_repeat_calls"` // Repeat calls are not announced on the ringing topics or notified
 }
 
 // MQTTConfig contains MQTT broker settings
 type MQTTConfig struct {
-	Broker         string        `mapstructure:"broker"`
-	Port           int           `mapstructure:"port"`
-	Username       string        `mapstructure:"username"`
-	Password       string        `mapstructure:"password"`
-	ClientID       string        `mapstructure:"client_id"`
-	TopicPrefix    string        `mapstructure:"topic_prefix"`
-	QoS            byte          `mapstructure:"qos"`
-	Retain         bool          `mapstructure:"retain"`
-	KeepAlive      time.Duration `mapstructure:"keep_alive"`
-	ConnectTimeout time.Duration `mapstructure:"connect_timeout"`
+	Broker                   string          `mapstructure:"broker"`
+	Port                     int             `mapstructure:"port"`
+	Username                 string          `mapstructure:"username"`
+	Password                 string          `mapstructure:"password"`
+	UsernameFile             string          `mapstructure:"username_file"` // Overrides Username, re-read to pick up rotated credentials
+	PasswordFile             string          `mapstructure:"password_file"` // Overrides Password, re-read to pick up rotated credentials
+	ClientID                 string          `mapstructure:"client_id"`
+	TopicPrefix              string          `mapstructure:"topic_prefix"`
+	QoS                      byte            `mapstructure:"qos"`
+	Retain                   bool            `mapstructure:"retain"`
+	KeepAlive                time.Duration   `mapstructure:"keep_alive"`
+	ConnectTimeout           time.Duration   `mapstructure:"connect_timeout"`
+	PublishTimeout           time.Duration   `mapstructure:"publish_timeout"`
+	CredentialsCheckInterval time.Duration   `mapstructure:"credentials_check_interval"` // Interval for re-reading the credential files, 0 only on SIGHUP
+	OAuth                    MQTTOAuthConfig `mapstructure:"oauth"`                      // Token used as MQTT password
+	CallTopicTTL             time.Duration   `mapstructure:"call_topic_ttl"`             // Retained call topics are removed this long after the call ended, 0 keeps them
+	BoxName                  string          `mapstructure:"box_name"`                   // Value of {{.Box}} in topic templates, defaults to the Fritz!Box host
+	Topics                   TopicsConfig    `mapstructure:"topics"`
+	RetainTopics             RetainConfig    `mapstructure:"retain_topics"`
+	PublishTopics            PublishConfig   `mapstructure:"publish_topics"`
+
+	ElapsedInterval time.Duration `mapstructure:"elapsed_interval"` // How often the elapsed time of a talking call is published, 0 disables
+
+	PublishRate      int `mapstructure:"publish_rate"`       // Messages per second sent to the broker, 0 = unlimited
+	PublishBurst     int `mapstructure:"publish_burst"`      // Messages sent at once before the rate applies
+	PublishQueueSize int `mapstructure:"publish_queue_size"` // Topics held back while the rate is exceeded, further messages are dropped
+
+	MissedCallAckTimeout   time.Duration `mapstructure:"missed_call_ack_timeout"`   // Escalate missed calls not acknowledged within this time, 0 disables
+	MissedCallAckRecipient string        `mapstructure:"missed_call_ack_recipient"` // Notification recipient of escalations
+
+	CloudEvents bool `mapstructure:"cloudevents"` // Wrap the payloads of event topics in CloudEvents envelopes
+
+	PayloadFormat  string   `mapstructure:"payload_format"`  // Payload format of all topics: json, msgpack, cloudevents or template:<file>
+	PayloadFormats []string `mapstructure:"payload_formats"` // Payload formats of single topics as topic=format
+	SchemaVersion  int      `mapstructure:"schema_version"`  // Layout of the payloads, 1 emits the layout without schema_version (0 = latest)
+
+	EncryptionKey     string `mapstructure:"encryption_key"`      // Base64 key encrypting the payloads for untrusted brokers (empty = plain)
+	EncryptionKeyFile string `mapstructure:"encryption_key_file"` // File containing the encryption key, overrides EncryptionKey
+
+	MetricsInterval time.Duration `mapstructure:"metrics_interval"` // Interval of the metrics published on the metrics topic, 0 disables
+	Metrics         []string      `mapstructure:"metrics"`          // Stats published as metrics, e.g. mqtt_publish (empty = all)
+
+	RetainedCheckInterval time.Duration `mapstructure:"retained_check_interval"` // Interval of comparing the retained topics on the broker with the published ones, 0 disables
+	RetainedRepair        bool          `mapstructure:"retained_repair"`         // Publish retained topics changed by other clients again
+
+	ACLSelfTest bool `mapstructure:"acl_self_test"` // Check on connect that the broker delivers messages below the topic prefix
+
+	Brokers    []string `mapstructure:"brokers"`     // Further brokers as host[:port], tried in order while the broker is unreachable
+	BrokerMode string   `mapstructure:"broker_mode"` // failover connects to one broker at a time, mirror publishes to all of them
+
+	Tenants           []string `mapstructure:"tenants"`            // Groups of MSNs whose calls are published below {prefix}/{tenant} as tenant=msn|msn
+	TenantCredentials []string `mapstructure:"tenant_credentials"` // Broker credentials of single tenants as tenant=username:password
+
+	ClientIDSuffix string `mapstructure:"client_id_suffix"` // Appended to the client ID: hostname or random (empty = none)
+
+	CallQuery      bool `mapstructure:"call_query"`       // Answer queries of the stored calls on {prefix}/query/calls
+	CallQueryLimit int  `mapstructure:"call_query_limit"` // Upper bound for the calls returned by one query
+
+	Profiles        []string `mapstructure:"profiles"`         // Publishing profiles as name=topic|topic, the event topics they mute
+	ProfileSchedule []string `mapstructure:"profile_schedule"` // Switches to a profile as profile=crontab schedule
+}
+
+// MQTTTenant is a group of MSNs whose calls are published below their own topic prefix
+type MQTTTenant struct {
+	Name     string
+	MSNs     []string
+	Username string // Broker credentials of the tenant, empty uses the main credentials
+	Password string
+}
+
+// MQTTOAuthConfig contains the OAuth2 client credentials for brokers expecting a JWT as password
+type MQTTOAuthConfig struct {
+	TokenURL      string        `mapstructure:"token_url"` // Token endpoint (empty = disabled)
+	ClientID      string        `mapstructure:"client_id"`
+	ClientSecret  string        `mapstructure:"client_secret"`
+	Scope         string        `mapstructure:"scope"`
+	Audience      string        `mapstructure:"audience"`
+	RefreshBefore time.Duration `mapstructure:"refresh_before"` // A new token is fetched this long before the current one expires
+}
+
+// RetainConfig overrides the retain flag per topic; nil keeps the global retain flag
+type RetainConfig struct {
+	Status          *bool `mapstructure:"status"`
+	LineStatus      *bool `mapstructure:"line_status"`
+	LineLastEvent   *bool `mapstructure:"line_last_event"`
+	Call            *bool `mapstructure:"call"`
+	MissedCall      *bool `mapstructure:"missed_call"` // Not retained unless enabled explicitly
+	MissedCalls     *bool `mapstructure:"missed_calls"`
+	History         *bool `mapstructure:"history"`
+	FSMStatus       *bool `mapstructure:"fsm_status"`
+	FSMStatusChange *bool `mapstructure:"fsm_status_change"`
+}
+
+// PublishConfig switches single topics off; nil publishes the topic, the FSM topics only at debug log level
+type PublishConfig struct {
+	LineStatus    *bool `mapstructure:"line_status"`
+	LineLastEvent *bool `mapstructure:"line_last_event"`
+	Call          *bool `mapstructure:"call"`
+	History       *bool `mapstructure:"history"`
+	FSM           *bool `mapstructure:"fsm"`     // fsm_status and fsm_status_change
+	Summary       *bool `mapstructure:"summary"` // summary/last_caller, summary/last_missed and summary/active_calls
+}
+
+// TopicsConfig contains text/template layouts of the published topics; empty values keep the built-in layout
+type TopicsConfig struct {
+	Status            string `mapstructure:"status"`
+	FritzBoxStatus    string `mapstructure:"fritzbox_status"`
+	LineStatus        string `mapstructure:"line_status"`
+	LineLastEvent     string `mapstructure:"line_last_event"`
+	LineElapsed       string `mapstructure:"line_elapsed"`
+	Ringing           string `mapstructure:"ringing"`
+	VIPRing           string `mapstructure:"vip_ring"`
+	Call              string `mapstructure:"call"`
+	CallCompleted     string `mapstructure:"call_completed"`
+	MissedCall        string `mapstructure:"missed_call"`
+	MissedCalls       string `mapstructure:"missed_calls"`
+	History           string `mapstructure:"history"`
+	FSMStatus         string `mapstructure:"fsm_status"`
+	FSMStatusChange   string `mapstructure:"fsm_status_change"`
+	DND               string `mapstructure:"dnd"`
+	DNDCommand        string `mapstructure:"dnd_command"`
+	MissedCallAck     string `mapstructure:"missed_call_ack"`
+	ReloadCommand     string `mapstructure:"reload_command"`
+	CallQuery         string `mapstructure:"call_query"`
+	CallQueryResponse string `mapstructure:"call_query_response"`
+	Profile           string `mapstructure:"profile"`
+	ProfileCommand    string `mapstructure:"profile_command"`
+	Notification      string `mapstructure:"notification"`
+	Error             string `mapstructure:"error"`
+	Unparsed          string `mapstructure:"unparsed"`
+	DatabaseHealth    string `mapstructure:"database_health"`
+	ACLTest           string `mapstructure:"acl_test"`
+	Incident          string `mapstructure:"incident"`
+	Metrics           string `mapstructure:"metrics"`
+	Description       string `mapstructure:"description"`
+
+	SummaryLastCaller  string `mapstructure:"summary_last_caller"`
+	SummaryLastMissed  string `mapstructure:"summary_last_missed"`
+	SummaryActiveCalls string `mapstructure:"summary_active_calls"`
 }
 
 // AppConfig contains general application settings
@@ -59,46 +260,485 @@ type AppConfig struct {
 	ReconnectDelay  time.Duration `mapstructure:"reconnect_delay"`
 	HealthCheckPort int           `mapstructure:"health_check_port"`
 	Timezone        string        `mapstructure:"timezone"`
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"` // Upper bound for flushing queued events on shutdown
+	WebUI           bool          `mapstructure:"web_ui"`           // Serve the dashboard on the health check port
+	APIToken        string        `mapstructure:"api_token"`        // Bearer token for changes through the APIs (empty = localhost only)
+
+	ReconnectMaxDelay    time.Duration `mapstructure:"reconnect_max_delay"`    // Cap of the reconnect delay, which doubles from ReconnectDelay
+	ReconnectJitter      int           `mapstructure:"reconnect_jitter"`       // Percentage of the reconnect delay that is randomized
+	ReconnectMaxAttempts int           `mapstructure:"reconnect_max_attempts"` // Reconnect attempts before giving up, 0 retries forever
+
+	// The connections are restarted when call events wait unprocessed or publishes fail for this long, 0 disables
+	StallTimeout time.Duration `mapstructure:"stall_timeout"`
+
+	// Errors are not published and readiness is not failed for this long after the start, 0 disables
+	StartupGrace time.Duration `mapstructure:"startup_grace"`
+
+	// Inconsistencies that are otherwise only logged stop the bridge with an error
+	Strict bool `mapstructure:"strict"`
+
+	// External command or http(s) URL adding fields to the call events, e.g. a CRM lookup (empty = disabled)
+	EnrichHook    string        `mapstructure:"enrich_hook"`
+	EnrichTimeout time.Duration `mapstructure:"enrich_timeout"` // Upper bound for a single run of the hook
+
+	CloudEventsSource string `mapstructure:"cloudevents_source"` // Source attribute of CloudEvents published by any sink
+
+	ConfigFile string `mapstructure:"config_file"` // File with settings overriding the environment, re-read on reload
+
+	// Calls kept in the call history, empty lists keep all calls
+	HistoryFinishStates []string `mapstructure:"history_finish_states"`
+	HistoryDirections   []string `mapstructure:"history_directions"`
+
+	// Redials of a missed caller within this time are merged into one missed call entry, 0 disables merging
+	MissedCallMergeWindow time.Duration `mapstructure:"missed_call_merge_window"`
+
+	// How long finish states are shown before the line returns to idle, 0 keeps them until the next call
+	FinishTimeout      time.Duration `mapstructure:"finish_timeout"`
+	LineFinishTimeouts []string      `mapstructure:"line_finish_timeouts"` // Finish timeouts of single lines as line=duration
 }
 
 // DatabaseConfig contains database settings
 type DatabaseConfig struct {
-	DataDir string `mapstructure:"data_dir"` // Data directory path
+	Driver          string        `mapstructure:"driver"`            // sqlite or postgres
+	DSN             string        `mapstructure:"dsn"`               // PostgreSQL connection string
+	DSNFile         string        `mapstructure:"dsn_file"`          // File containing the PostgreSQL connection string, overrides DSN
+	DataDir         string        `mapstructure:"data_dir"`          // Data directory path (SQLite)
+	RedactAfterDays int           `mapstructure:"redact_after_days"` // Redact stored numbers after this many days (0 = disabled)
+	RedactDigits    int           `mapstructure:"redact_digits"`     // Number of trailing digits to redact
+	RedactInterval  time.Duration `mapstructure:"redact_interval"`   // How often the redaction job runs
+	UnparsedDays    int           `mapstructure:"unparsed_days"`     // Keep unparsed callmonitor lines this many days (0 = forever)
+	RetentionDays   int           `mapstructure:"retention_days"`    // Keep calls this many days (0 = forever)
+	ArchiveFormat   string        `mapstructure:"archive_format"`    // Archive calls before deleting them: csv or none
+	ArchiveDir      string        `mapstructure:"archive_dir"`       // Directory of the monthly call archives (default: {data_dir}/archive)
+	QueryTimeout    time.Duration `mapstructure:"query_timeout"`     // Upper bound for a single database operation
+	QueueSize       int           `mapstructure:"queue_size"`        // Call events buffered for asynchronous writes
+	BatchSize       int           `mapstructure:"batch_size"`        // Maximum call events per write transaction
+	FlushInterval   time.Duration `mapstructure:"flush_interval"`    // Maximum delay before queued events are written
+	HealthInterval  time.Duration `mapstructure:"health_interval"`   // Interval of the size and latency snapshots, 0 disables
+	FinishStates    []string      `mapstructure:"finish_states"`     // Store only calls ending in these states (empty = all)
+	Directions      []string      `mapstructure:"directions"`        // Store only calls of these directions (empty = all)
+}
+
+// InfluxConfig contains the settings of the line protocol export of finished calls
+type InfluxConfig struct {
+	URL          string        `mapstructure:"url"`           // InfluxDB v2 server URL or generic write URL (empty = disabled)
+	Token        string        `mapstructure:"token"`         // API token
+	Org          string        `mapstructure:"org"`           // InfluxDB v2 organization
+	Bucket       string        `mapstructure:"bucket"`        // InfluxDB v2 bucket (empty = write to URL as is)
+	Measurement  string        `mapstructure:"measurement"`   // Name of the measurement
+	Timeout      time.Duration `mapstructure:"timeout"`       // Upper bound for a single write
+	FinishStates []string      `mapstructure:"finish_states"` // Export only calls ending in these states (empty = all)
+	Directions   []string      `mapstructure:"directions"`    // Export only calls of these directions (empty = all)
+}
+
+// CalDAVConfig contains the settings of the calendar entries created for answered calls
+type CalDAVConfig struct {
+	URL          string        `mapstructure:"url"`           // URL of the calendar collection (empty = disabled)
+	Username     string        `mapstructure:"username"`      // Basic auth username
+	Password     string        `mapstructure:"password"`      // Basic auth password
+	PasswordFile string        `mapstructure:"password_file"` // File containing the password, overrides Password
+	MinDuration  time.Duration `mapstructure:"min_duration"`  // Shorter calls get no entry
+	Timeout      time.Duration `mapstructure:"timeout"`       // Upper bound for creating a single entry
+	Contacts     []string      `mapstructure:"contacts"`      // Names of known numbers as number=name
+}
+
+// OutputConfig contains the settings of the call event outputs besides MQTT,
+// which can be enabled together
+type OutputConfig struct {
+	Stdout         bool          `mapstructure:"stdout"`          // Write call events as JSON lines to standard output
+	File           string        `mapstructure:"file"`            // Append call events as JSON lines to this file (empty = disabled)
+	FileMaxSize    int           `mapstructure:"file_max_size"`   // Size in MB at which the file is rotated
+	FileMaxFiles   int           `mapstructure:"file_max_files"`  // Rotated files kept
+	WebhookURL     string        `mapstructure:"webhook_url"`     // URL call events are posted to as JSON (empty = disabled)
+	WebhookToken   string        `mapstructure:"webhook_token"`   // Sent as bearer token
+	WebhookTimeout time.Duration `mapstructure:"webhook_timeout"` // Upper bound for a single request
+
+	LogURL     string        `mapstructure:"log_url"`     // Loki push or log collector URL call and connection event logs are shipped to (empty = disabled)
+	LogFormat  string        `mapstructure:"log_format"`  // loki or json
+	LogToken   string        `mapstructure:"log_token"`   // Sent as bearer token
+	LogTenant  string        `mapstructure:"log_tenant"`  // Sent as X-Scope-OrgID to multi-tenant Loki
+	LogLabels  []string      `mapstructure:"log_labels"`  // Labels of every entry as name=value
+	LogTimeout time.Duration `mapstructure:"log_timeout"` // Upper bound for a single request
+
+	AMIPort     int    `mapstructure:"ami_port"`     // TCP port of the Asterisk Manager Interface event server (0 = disabled)
+	AMIUsername string `mapstructure:"ami_username"` // Login of AMI clients (empty = any login is accepted)
+	AMISecret   string `mapstructure:"ami_secret"`   // Secret of the AMI login
+}
+
+// ReportConfig contains the settings of the monthly call reports
+type ReportConfig struct {
+	Enabled          bool          `mapstructure:"enabled"`            // Create a report of the answered calls of every month
+	Dir              string        `mapstructure:"dir"`                // Report directory (default: {data_dir}/reports)
+	Interval         time.Duration `mapstructure:"interval"`           // How often the report job checks for a finished month
+	Currency         string        `mapstructure:"currency"`           // Shown with the estimated costs
+	Tariffs          []string      `mapstructure:"tariffs"`            // Prices per started minute of outbound calls as prefix=price
+	Contacts         []string      `mapstructure:"contacts"`           // Names of known numbers as number=name (default: CalDAV contacts)
+	SMTPHost         string        `mapstructure:"smtp_host"`          // Mail server of sent reports (empty = reports are not mailed)
+	SMTPPort         int           `mapstructure:"smtp_port"`          // Mail server port, STARTTLS is used if offered
+	SMTPUsername     string        `mapstructure:"smtp_username"`      // Mail server username
+	SMTPPassword     string        `mapstructure:"smtp_password"`      // Mail server password
+	SMTPPasswordFile string        `mapstructure:"smtp_password_file"` // File containing the mail server password, overrides SMTPPassword
+	MailFrom         string        `mapstructure:"mail_from"`          // Sender address of report mails
+	MailTo           []string      `mapstructure:"mail_to"`            // Recipients of report mails
+}
+
+// NotifyConfig contains the settings of the push notification channels
+type NotifyConfig struct {
+	Triggers        []string      `mapstructure:"triggers"`         // missed_call, vip and/or long_call
+	VIPs            []string      `mapstructure:"vips"`             // VIP numbers as number=name
+	LongCall        time.Duration `mapstructure:"long_call"`        // Minimum talk time of a long call
+	TitleTemplate   string        `mapstructure:"title_template"`   // text/template of the title (empty = built-in)
+	MessageTemplate string        `mapstructure:"message_template"` // text/template of the message (empty = built-in)
+	Timeout         time.Duration `mapstructure:"timeout"`          // Upper bound for sending a single message
+	TelegramToken   string        `mapstructure:"telegram_token"`   // Bot token (empty = Telegram disabled)
+	TelegramChatID  string        `mapstructure:"telegram_chat_id"` // Chat the bot posts to
+	PushoverToken   string        `mapstructure:"pushover_token"`   // Application token (empty = Pushover disabled)
+	PushoverUser    string        `mapstructure:"pushover_user"`    // User or group key
+	NtfyURL         string        `mapstructure:"ntfy_url"`         // ntfy server URL
+	NtfyTopic       string        `mapstructure:"ntfy_topic"`       // Topic (empty = ntfy disabled)
+	NtfyToken       string        `mapstructure:"ntfy_token"`       // Access token of protected topics
 }
 
-// LoadConfig loads configuration from environment variables and defaults
+// BackupConfig contains the settings of the scheduled SQLite database backups,
+// stored either in an S3 bucket or on a WebDAV share
+type BackupConfig struct {
+	Interval           time.Duration `mapstructure:"interval"`             // How often a backup is taken
+	Keep               int           `mapstructure:"keep"`                 // Backups kept on the target (0 = all)
+	Timeout            time.Duration `mapstructure:"timeout"`              // Upper bound for a single backup including the upload
+	S3Endpoint         string        `mapstructure:"s3_endpoint"`          // URL of an S3 compatible storage (empty = AWS)
+	S3Region           string        `mapstructure:"s3_region"`            // Region of the bucket
+	S3Bucket           string        `mapstructure:"s3_bucket"`            // Bucket of the backups (empty = S3 disabled)
+	S3Prefix           string        `mapstructure:"s3_prefix"`            // Prepended to the file names, e.g. "fritz/"
+	S3AccessKey        string        `mapstructure:"s3_access_key"`        // Access key ID
+	S3SecretKey        string        `mapstructure:"s3_secret_key"`        // Secret access key
+	S3SecretKeyFile    string        `mapstructure:"s3_secret_key_file"`   // File containing the secret access key, overrides S3SecretKey
+	S3PathStyle        bool          `mapstructure:"s3_path_style"`        // Address the bucket in the path, as MinIO and most S3 compatible storages need
+	WebDAVURL          string        `mapstructure:"webdav_url"`           // URL of the folder of the backups (empty = WebDAV disabled)
+	WebDAVUsername     string        `mapstructure:"webdav_username"`      // Basic auth username
+	WebDAVPassword     string        `mapstructure:"webdav_password"`      // Basic auth password
+	WebDAVPasswordFile string        `mapstructure:"webdav_password_file"` // File containing the password, overrides WebDAVPassword
+}
+
+// LoadConfig loads configuration from environment variables and defaults.
+// Settings in the file named by FRITZ_CALLMONITOR_CONFIG_FILE take precedence
+// over the environment, so they can be changed and reloaded at runtime.
 func LoadConfig() (*Config, error) {
+	fileMu.Lock()
+	defer fileMu.Unlock()
+
+	configFile := os.Getenv(configFileEnv)
+	values, err := readConfigFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	fileValues = values
+	defer func() { fileValues = nil }()
+
 	config := &Config{
 		FritzBox: FritzBoxConfig{
-			Host: getEnvOrDefault("FRITZ_CALLMONITOR_FRITZBOX_HOST", "fritz.box"),
-			Port: getEnvIntOrDefault("FRITZ_CALLMONITOR_FRITZBOX_PORT", 1012),
+			Host:           getEnvOrDefault("FRITZ_CALLMONITOR_FRITZBOX_HOST", "fritz.box"),
+			Port:           getEnvIntOrDefault("FRITZ_CALLMONITOR_FRITZBOX_PORT", 1012),
+			ConnectTimeout: getEnvDurationOrDefault("FRITZ_CALLMONITOR_FRITZBOX_CONNECT_TIMEOUT", 10*time.Second),
+
+			Username:           getEnvOrDefault("FRITZ_CALLMONITOR_FRITZBOX_USERNAME", ""),
+			Password:           getEnvOrDefault("FRITZ_CALLMONITOR_FRITZBOX_PASSWORD", ""),
+			TR064Port:          getEnvIntOrDefault("FRITZ_CALLMONITOR_FRITZBOX_TR064_PORT", 49000),
+			DNDControl:         getEnvBoolOrDefault("FRITZ_CALLMONITOR_FRITZBOX_DND_CONTROL", false),
+			DNDDeflections:     getEnvListOrDefault("FRITZ_CALLMONITOR_FRITZBOX_DND_DEFLECTIONS", []string{}),
+			DNDRefreshInterval: getEnvDurationOrDefault("FRITZ_CALLMONITOR_FRITZBOX_DND_REFRESH_INTERVAL", 5*time.Minute),
+			DetectTimezone:     getEnvBoolOrDefault("FRITZ_CALLMONITOR_FRITZBOX_DETECT_TIMEZONE", false),
+			BackfillCallList:   getEnvBoolOrDefault("FRITZ_CALLMONITOR_FRITZBOX_BACKFILL_CALL_LIST", false),
+
+			TimestampPivotYear: getEnvIntOrDefault("FRITZ_CALLMONITOR_FRITZBOX_TIMESTAMP_PIVOT_YEAR", 0),
+			StrictTimestamps:   getEnvBoolOrDefault("FRITZ_CALLMONITOR_FRITZBOX_STRICT_TIMESTAMPS", false),
+			MaxTimestampSkew:   getEnvDurationOrDefault("FRITZ_CALLMONITOR_FRITZBOX_MAX_TIMESTAMP_SKEW", 24*time.Hour),
+
+			RingGroupWindow:   getEnvDurationOrDefault("FRITZ_CALLMONITOR_FRITZBOX_RING_GROUP_WINDOW", 2*time.Second),
+			ForwardWindow:     getEnvDurationOrDefault("FRITZ_CALLMONITOR_FRITZBOX_FORWARD_WINDOW", 5*time.Second),
+			ForwardExtensions: getEnvListOrDefault("FRITZ_CALLMONITOR_FRITZBOX_FORWARD_EXTENSIONS", []string{}),
 		},
 		PBX: PBXConfig{
-			MSN:           getEnvListOrDefault("FRITZ_CALLMONITOR_PBX_MSN", []string{}),
-			CountryCode:   getEnvOrDefault("FRITZ_CALLMONITOR_PBX_COUNTRY_CODE", "49"),
-			LocalAreaCode: getEnvOrDefault("FRITZ_CALLMONITOR_PBX_LOCAL_AREA_CODE", ""),
+			MSN:            getEnvListOrDefault("FRITZ_CALLMONITOR_PBX_MSN", []string{}),
+			CountryCode:    getEnvOrDefault("FRITZ_CALLMONITOR_PBX_COUNTRY_CODE", "49"),
+			Region:         getEnvOrDefault("FRITZ_CALLMONITOR_PBX_REGION", ""),
+			LocalAreaCode:  getEnvOrDefault("FRITZ_CALLMONITOR_PBX_LOCAL_AREA_CODE", ""),
+			NumberFormat:   getEnvOrDefault("FRITZ_CALLMONITOR_PBX_NUMBER_FORMAT", phone.FormatE164),
+			DoNotRecord:    getEnvListOrDefault("FRITZ_CALLMONITOR_PBX_DO_NOT_RECORD", []string{}),
+			TAMExtensions:  getEnvListOrDefault("FRITZ_CALLMONITOR_PBX_TAM_EXTENSIONS", []string{"40", "41", "42", "43", "44"}),
+			Extensions:     getEnvListOrDefault("FRITZ_CALLMONITOR_PBX_EXTENSIONS", []string{}),
+			Trunks:         getEnvListOrDefault("FRITZ_CALLMONITOR_PBX_TRUNKS", []string{}),
+			TrunkAllow:     getEnvListOrDefault("FRITZ_CALLMONITOR_PBX_TRUNK_ALLOW", []string{}),
+			TrunkDeny:      getEnvListOrDefault("FRITZ_CALLMONITOR_PBX_TRUNK_DENY", []string{}),
+			ExtensionAllow: getEnvListOrDefault("FRITZ_CALLMONITOR_PBX_EXTENSION_ALLOW", []string{}),
+			ExtensionDeny:  getEnvListOrDefault("FRITZ_CALLMONITOR_PBX_EXTENSION_DENY", []string{}),
+			IgnoreInternal: getEnvBoolOrDefault("FRITZ_CALLMONITOR_PBX_IGNORE_INTERNAL", false),
+			TagRules:       getEnvListOrDefault("FRITZ_CALLMONITOR_PBX_TAG_RULES", []string{}),
+			ContactGroups:  getEnvListOrDefault("FRITZ_CALLMONITOR_PBX_CONTACT_GROUPS", []string{}),
+			VIPNumbers:     getEnvListOrDefault("FRITZ_CALLMONITOR_PBX_VIP_NUMBERS", []string{}),
+			VIPGroups:      getEnvListOrDefault("FRITZ_CALLMONITOR_PBX_VIP_GROUPS", []string{}),
+
+			RepeatCallWindow:    getEnvDurationOrDefault("FRITZ_CALLMONITOR_PBX_REPEAT_CALL_WINDOW", 0),
+			SuppressRepeatCalls: getEnvBoolOrDefault("FRITZ_CALLMONITOR_PBX_SUPPRESS_REPEAT_CALLS", false),
 		},
 		MQTT: MQTTConfig{
-			Broker:         getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_BROKER", "localhost"),
-			Port:           getEnvIntOrDefault("FRITZ_CALLMONITOR_MQTT_PORT", 1883),
-			Username:       getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_USERNAME", ""),
-			Password:       getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_PASSWORD", ""),
+			Broker:                   getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_BROKER", "localhost"),
+			Port:                     getEnvIntOrDefault("FRITZ_CALLMONITOR_MQTT_PORT", 1883),
+			Username:                 getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_USERNAME", ""),
+			Password:                 getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_PASSWORD", ""),
+			UsernameFile:             getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_USERNAME_FILE", ""),
+			PasswordFile:             getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_PASSWORD_FILE", ""),
+			CredentialsCheckInterval: getEnvDurationOrDefault("FRITZ_CALLMONITOR_MQTT_CREDENTIALS_CHECK_INTERVAL", 30*time.Second),
+			OAuth: MQTTOAuthConfig{
+				TokenURL:      getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_OAUTH_TOKEN_URL", ""),
+				ClientID:      getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_OAUTH_CLIENT_ID", ""),
+				ClientSecret:  getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_OAUTH_CLIENT_SECRET", ""),
+				Scope:         getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_OAUTH_SCOPE", ""),
+				Audience:      getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_OAUTH_AUDIENCE", ""),
+				RefreshBefore: getEnvDurationOrDefault("FRITZ_CALLMONITOR_MQTT_OAUTH_REFRESH_BEFORE", 5*time.Minute),
+			},
 			ClientID:       getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_CLIENT_ID", "fritz-callmonitor2mqtt"),
+			ClientIDSuffix: getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_CLIENT_ID_SUFFIX", ""),
 			TopicPrefix:    getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_PREFIX", "fritz/callmonitor"),
 			QoS:            byte(getEnvIntOrDefault("FRITZ_CALLMONITOR_MQTT_QOS", 1)),
 			Retain:         getEnvBoolOrDefault("FRITZ_CALLMONITOR_MQTT_RETAIN", true),
 			KeepAlive:      getEnvDurationOrDefault("FRITZ_CALLMONITOR_MQTT_KEEP_ALIVE", 60*time.Second),
 			ConnectTimeout: getEnvDurationOrDefault("FRITZ_CALLMONITOR_MQTT_CONNECT_TIMEOUT", 30*time.Second),
+			PublishTimeout: getEnvDurationOrDefault("FRITZ_CALLMONITOR_MQTT_PUBLISH_TIMEOUT", 10*time.Second),
+			CallTopicTTL:   getEnvDurationOrDefault("FRITZ_CALLMONITOR_MQTT_CALL_TOPIC_TTL", 0),
+			BoxName:        getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_BOX_NAME", ""),
+			Topics: TopicsConfig{
+				Status:            getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_STATUS", ""),
+				FritzBoxStatus:    getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_FRITZBOX_STATUS", ""),
+				LineStatus:        getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_LINE_STATUS", ""),
+				LineLastEvent:     getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_LINE_LAST_EVENT", ""),
+				LineElapsed:       getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_LINE_ELAPSED", ""),
+				Ringing:           getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_RINGING", ""),
+				VIPRing:           getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_VIP_RING", ""),
+				Call:              getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_CALL", ""),
+				CallCompleted:     getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_CALL_COMPLETED", ""),
+				MissedCall:        getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_MISSED_CALL", ""),
+				MissedCalls:       getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_MISSED_CALLS", ""),
+				History:           getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_HISTORY", ""),
+				FSMStatus:         getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_FSM_STATUS", ""),
+				FSMStatusChange:   getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_FSM_STATUS_CHANGE", ""),
+				DND:               getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_DND", ""),
+				DNDCommand:        getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_DND_COMMAND", ""),
+				MissedCallAck:     getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_MISSED_CALL_ACK", ""),
+				ReloadCommand:     getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_RELOAD_COMMAND", ""),
+				CallQuery:         getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_CALL_QUERY", ""),
+				CallQueryResponse: getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_CALL_QUERY_RESPONSE", ""),
+				Profile:           getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_PROFILE", ""),
+				ProfileCommand:    getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_PROFILE_COMMAND", ""),
+				Notification:      getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_NOTIFICATION", ""),
+				Error:             getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_ERROR", ""),
+				Unparsed:          getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_UNPARSED", ""),
+				DatabaseHealth:    getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_DATABASE_HEALTH", ""),
+				ACLTest:           getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_ACL_TEST", ""),
+				Incident:          getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_INCIDENT", ""),
+				Metrics:           getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_METRICS", ""),
+				Description:       getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_DESCRIPTION", ""),
+
+				SummaryLastCaller:  getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_SUMMARY_LAST_CALLER", ""),
+				SummaryLastMissed:  getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_SUMMARY_LAST_MISSED", ""),
+				SummaryActiveCalls: getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_TOPIC_SUMMARY_ACTIVE_CALLS", ""),
+			},
+			RetainTopics: RetainConfig{
+				Status:          getEnvBoolOrNil("FRITZ_CALLMONITOR_MQTT_RETAIN_STATUS"),
+				LineStatus:      getEnvBoolOrNil("FRITZ_CALLMONITOR_MQTT_RETAIN_LINE_STATUS"),
+				LineLastEvent:   getEnvBoolOrNil("FRITZ_CALLMONITOR_MQTT_RETAIN_LINE_LAST_EVENT"),
+				Call:            getEnvBoolOrNil("FRITZ_CALLMONITOR_MQTT_RETAIN_CALL"),
+				MissedCall:      getEnvBoolOrNil("FRITZ_CALLMONITOR_MQTT_RETAIN_MISSED_CALL"),
+				MissedCalls:     getEnvBoolOrNil("FRITZ_CALLMONITOR_MQTT_RETAIN_MISSED_CALLS"),
+				History:         getEnvBoolOrNil("FRITZ_CALLMONITOR_MQTT_RETAIN_HISTORY"),
+				FSMStatus:       getEnvBoolOrNil("FRITZ_CALLMONITOR_MQTT_RETAIN_FSM_STATUS"),
+				FSMStatusChange: getEnvBoolOrNil("FRITZ_CALLMONITOR_MQTT_RETAIN_FSM_STATUS_CHANGE"),
+			},
+			PublishTopics: PublishConfig{
+				LineStatus:    getEnvBoolOrNil("FRITZ_CALLMONITOR_MQTT_PUBLISH_LINE_STATUS"),
+				LineLastEvent: getEnvBoolOrNil("FRITZ_CALLMONITOR_MQTT_PUBLISH_LINE_LAST_EVENT"),
+				Call:          getEnvBoolOrNil("FRITZ_CALLMONITOR_MQTT_PUBLISH_CALL"),
+				History:       getEnvBoolOrNil("FRITZ_CALLMONITOR_MQTT_PUBLISH_HISTORY"),
+				FSM:           getEnvBoolOrNil("FRITZ_CALLMONITOR_MQTT_PUBLISH_FSM"),
+				Summary:       getEnvBoolOrNil("FRITZ_CALLMONITOR_MQTT_PUBLISH_SUMMARY"),
+			},
+
+			ElapsedInterval: getEnvDurationOrDefault("FRITZ_CALLMONITOR_MQTT_ELAPSED_INTERVAL", 15*time.Second),
+
+			PublishRate:      getEnvIntOrDefault("FRITZ_CALLMONITOR_MQTT_PUBLISH_RATE", 0),
+			PublishBurst:     getEnvIntOrDefault("FRITZ_CALLMONITOR_MQTT_PUBLISH_BURST", 20),
+			PublishQueueSize: getEnvIntOrDefault("FRITZ_CALLMONITOR_MQTT_PUBLISH_QUEUE_SIZE", 100),
+
+			MissedCallAckTimeout:   getEnvDurationOrDefault("FRITZ_CALLMONITOR_MQTT_MISSED_CALL_ACK_TIMEOUT", 0),
+			MissedCallAckRecipient: getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_MISSED_CALL_ACK_RECIPIENT", "escalation"),
+
+			CloudEvents: getEnvBoolOrDefault("FRITZ_CALLMONITOR_MQTT_CLOUDEVENTS", false),
+
+			PayloadFormat:  getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_PAYLOAD_FORMAT", "json"),
+			PayloadFormats: getEnvListOrDefault("FRITZ_CALLMONITOR_MQTT_PAYLOAD_FORMATS", nil),
+			SchemaVersion:  getEnvIntOrDefault("FRITZ_CALLMONITOR_MQTT_SCHEMA_VERSION", types.SchemaVersion),
+
+			EncryptionKey:     getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_ENCRYPTION_KEY", ""),
+			EncryptionKeyFile: getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_ENCRYPTION_KEY_FILE", ""),
+
+			MetricsInterval: getEnvDurationOrDefault("FRITZ_CALLMONITOR_MQTT_METRICS_INTERVAL", 0),
+			Metrics:         getEnvListOrDefault("FRITZ_CALLMONITOR_MQTT_METRICS", nil),
+
+			RetainedCheckInterval: getEnvDurationOrDefault("FRITZ_CALLMONITOR_MQTT_RETAINED_CHECK_INTERVAL", 0),
+			RetainedRepair:        getEnvBoolOrDefault("FRITZ_CALLMONITOR_MQTT_RETAINED_REPAIR", false),
+
+			ACLSelfTest: getEnvBoolOrDefault("FRITZ_CALLMONITOR_MQTT_ACL_SELF_TEST", true),
+
+			Brokers:    getEnvListOrDefault("FRITZ_CALLMONITOR_MQTT_BROKERS", nil),
+			BrokerMode: getEnvOrDefault("FRITZ_CALLMONITOR_MQTT_BROKER_MODE", "failover"),
+
+			Tenants:           getEnvListOrDefault("FRITZ_CALLMONITOR_MQTT_TENANTS", []string{}),
+			TenantCredentials: getEnvListOrDefault("FRITZ_CALLMONITOR_MQTT_TENANT_CREDENTIALS", []string{}),
+
+			CallQuery:      getEnvBoolOrDefault("FRITZ_CALLMONITOR_MQTT_CALL_QUERY", false),
+			CallQueryLimit: getEnvIntOrDefault("FRITZ_CALLMONITOR_MQTT_CALL_QUERY_LIMIT", 100),
+
+			Profiles:        getEnvListOrDefault("FRITZ_CALLMONITOR_MQTT_PROFILES", nil),
+			ProfileSchedule: getEnvListOrDefault("FRITZ_CALLMONITOR_MQTT_PROFILE_SCHEDULE", nil),
 		},
 		App: AppConfig{
 			LogLevel:        getEnvOrDefault("FRITZ_CALLMONITOR_APP_LOG_LEVEL", "info"),
 			CallHistorySize: getEnvIntOrDefault("FRITZ_CALLMONITOR_APP_CALL_HISTORY_SIZE", 50),
 			ReconnectDelay:  getEnvDurationOrDefault("FRITZ_CALLMONITOR_APP_RECONNECT_DELAY", 10*time.Second),
+
+			ReconnectMaxDelay:    getEnvDurationOrDefault("FRITZ_CALLMONITOR_APP_RECONNECT_MAX_DELAY", 5*time.Minute),
+			ReconnectJitter:      getEnvIntOrDefault("FRITZ_CALLMONITOR_APP_RECONNECT_JITTER", 20),
+			ReconnectMaxAttempts: getEnvIntOrDefault("FRITZ_CALLMONITOR_APP_RECONNECT_MAX_ATTEMPTS", 0),
+
+			StallTimeout: getEnvDurationOrDefault("FRITZ_CALLMONITOR_APP_STALL_TIMEOUT", 5*time.Minute),
+			StartupGrace: getEnvDurationOrDefault("FRITZ_CALLMONITOR_APP_STARTUP_GRACE", 0),
+			Strict:       getEnvBoolOrDefault("FRITZ_CALLMONITOR_APP_STRICT", false),
+
+			EnrichHook:    getEnvOrDefault("FRITZ_CALLMONITOR_APP_ENRICH_HOOK", ""),
+			EnrichTimeout: getEnvDurationOrDefault("FRITZ_CALLMONITOR_APP_ENRICH_TIMEOUT", 2*time.Second),
+
 			HealthCheckPort: getEnvIntOrDefault("FRITZ_CALLMONITOR_APP_HEALTH_CHECK_PORT", 8080),
 			Timezone:        getEnvOrDefault("FRITZ_CALLMONITOR_APP_TIMEZONE", "Europe/Berlin"),
+			ShutdownTimeout: getEnvDurationOrDefault("FRITZ_CALLMONITOR_APP_SHUTDOWN_TIMEOUT", 10*time.Second),
+			WebUI:           getEnvBoolOrDefault("FRITZ_CALLMONITOR_APP_WEB_UI", true),
+			APIToken:        getEnvOrDefault("FRITZ_CALLMONITOR_APP_API_TOKEN", ""),
+
+			CloudEventsSource: getEnvOrDefault("FRITZ_CALLMONITOR_APP_CLOUDEVENTS_SOURCE", cloudevents.DefaultSource),
+
+			ConfigFile: configFile,
+
+			HistoryFinishStates: getEnvListOrDefault("FRITZ_CALLMONITOR_APP_HISTORY_FINISH_STATES", []string{}),
+			HistoryDirections:   getEnvListOrDefault("FRITZ_CALLMONITOR_APP_HISTORY_DIRECTIONS", []string{}),
+
+			MissedCallMergeWindow: getEnvDurationOrDefault("FRITZ_CALLMONITOR_APP_MISSED_CALL_MERGE_WINDOW", 0),
+
+			FinishTimeout:      getEnvDurationOrDefault("FRITZ_CALLMONITOR_APP_FINISH_TIMEOUT", time.Second),
+			LineFinishTimeouts: getEnvListOrDefault("FRITZ_CALLMONITOR_APP_LINE_FINISH_TIMEOUTS", []string{}),
 		},
 		Database: DatabaseConfig{
-			DataDir: getEnvOrDefault("FRITZ_CALLMONITOR_DATABASE_DATA_DIR", "./data"),
+			Driver:          getEnvOrDefault("FRITZ_CALLMONITOR_DATABASE_DRIVER", "sqlite"),
+			DSN:             getEnvOrDefault("FRITZ_CALLMONITOR_DATABASE_DSN", ""),
+			DSNFile:         getEnvOrDefault("FRITZ_CALLMONITOR_DATABASE_DSN_FILE", ""),
+			DataDir:         getEnvOrDefault("FRITZ_CALLMONITOR_DATABASE_DATA_DIR", "./data"),
+			RedactAfterDays: getEnvIntOrDefault("FRITZ_CALLMONITOR_DATABASE_REDACT_AFTER_DAYS", 0),
+			RedactDigits:    getEnvIntOrDefault("FRITZ_CALLMONITOR_DATABASE_REDACT_DIGITS", 3),
+			RedactInterval:  getEnvDurationOrDefault("FRITZ_CALLMONITOR_DATABASE_REDACT_INTERVAL", time.Hour),
+			UnparsedDays:    getEnvIntOrDefault("FRITZ_CALLMONITOR_DATABASE_UNPARSED_DAYS", 30),
+			RetentionDays:   getEnvIntOrDefault("FRITZ_CALLMONITOR_DATABASE_RETENTION_DAYS", 0),
+			ArchiveFormat:   getEnvOrDefault("FRITZ_CALLMONITOR_DATABASE_ARCHIVE_FORMAT", "csv"),
+			ArchiveDir:      getEnvOrDefault("FRITZ_CALLMONITOR_DATABASE_ARCHIVE_DIR", ""),
+			QueryTimeout:    getEnvDurationOrDefault("FRITZ_CALLMONITOR_DATABASE_QUERY_TIMEOUT", 30*time.Second),
+			QueueSize:       getEnvIntOrDefault("FRITZ_CALLMONITOR_DATABASE_QUEUE_SIZE", 1000),
+			BatchSize:       getEnvIntOrDefault("FRITZ_CALLMONITOR_DATABASE_BATCH_SIZE", 50),
+			FlushInterval:   getEnvDurationOrDefault("FRITZ_CALLMONITOR_DATABASE_FLUSH_INTERVAL", time.Second),
+			HealthInterval:  getEnvDurationOrDefault("FRITZ_CALLMONITOR_DATABASE_HEALTH_INTERVAL", 5*time.Minute),
+			FinishStates:    getEnvListOrDefault("FRITZ_CALLMONITOR_DATABASE_FINISH_STATES", []string{}),
+			Directions:      getEnvListOrDefault("FRITZ_CALLMONITOR_DATABASE_DIRECTIONS", []string{}),
+		},
+		Influx: InfluxConfig{
+			URL:          getEnvOrDefault("FRITZ_CALLMONITOR_INFLUX_URL", ""),
+			Token:        getEnvOrDefault("FRITZ_CALLMONITOR_INFLUX_TOKEN", ""),
+			Org:          getEnvOrDefault("FRITZ_CALLMONITOR_INFLUX_ORG", ""),
+			Bucket:       getEnvOrDefault("FRITZ_CALLMONITOR_INFLUX_BUCKET", ""),
+			Measurement:  getEnvOrDefault("FRITZ_CALLMONITOR_INFLUX_MEASUREMENT", "calls"),
+			Timeout:      getEnvDurationOrDefault("FRITZ_CALLMONITOR_INFLUX_TIMEOUT", 10*time.Second),
+			FinishStates: getEnvListOrDefault("FRITZ_CALLMONITOR_INFLUX_FINISH_STATES", []string{}),
+			Directions:   getEnvListOrDefault("FRITZ_CALLMONITOR_INFLUX_DIRECTIONS", []string{}),
+		},
+		Output: OutputConfig{
+			Stdout:         getEnvBoolOrDefault("FRITZ_CALLMONITOR_OUTPUT_STDOUT", false),
+			File:           getEnvOrDefault("FRITZ_CALLMONITOR_OUTPUT_FILE", ""),
+			FileMaxSize:    getEnvIntOrDefault("FRITZ_CALLMONITOR_OUTPUT_FILE_MAX_SIZE", 10),
+			FileMaxFiles:   getEnvIntOrDefault("FRITZ_CALLMONITOR_OUTPUT_FILE_MAX_FILES", 5),
+			WebhookURL:     getEnvOrDefault("FRITZ_CALLMONITOR_OUTPUT_WEBHOOK_URL", ""),
+			WebhookToken:   getEnvOrDefault("FRITZ_CALLMONITOR_OUTPUT_WEBHOOK_TOKEN", ""),
+			WebhookTimeout: getEnvDurationOrDefault("FRITZ_CALLMONITOR_OUTPUT_WEBHOOK_TIMEOUT", 10*time.Second),
+
+			LogURL:     getEnvOrDefault("FRITZ_CALLMONITOR_OUTPUT_LOG_URL", ""),
+			LogFormat:  getEnvOrDefault("FRITZ_CALLMONITOR_OUTPUT_LOG_FORMAT", "loki"),
+			LogToken:   getEnvOrDefault("FRITZ_CALLMONITOR_OUTPUT_LOG_TOKEN", ""),
+			LogTenant:  getEnvOrDefault("FRITZ_CALLMONITOR_OUTPUT_LOG_TENANT", ""),
+			LogLabels:  getEnvListOrDefault("FRITZ_CALLMONITOR_OUTPUT_LOG_LABELS", []string{"job=fritz-callmonitor2mqtt"}),
+			LogTimeout: getEnvDurationOrDefault("FRITZ_CALLMONITOR_OUTPUT_LOG_TIMEOUT", 10*time.Second),
+
+			AMIPort:     getEnvIntOrDefault("FRITZ_CALLMONITOR_OUTPUT_AMI_PORT", 0),
+			AMIUsername: getEnvOrDefault("FRITZ_CALLMONITOR_OUTPUT_AMI_USERNAME", ""),
+			AMISecret:   getEnvOrDefault("FRITZ_CALLMONITOR_OUTPUT_AMI_SECRET", ""),
+		},
+		CalDAV: CalDAVConfig{
+			URL:          getEnvOrDefault("FRITZ_CALLMONITOR_CALDAV_URL", ""),
+			Username:     getEnvOrDefault("FRITZ_CALLMONITOR_CALDAV_USERNAME", ""),
+			Password:     getEnvOrDefault("FRITZ_CALLMONITOR_CALDAV_PASSWORD", ""),
+			PasswordFile: getEnvOrDefault("FRITZ_CALLMONITOR_CALDAV_PASSWORD_FILE", ""),
+			MinDuration:  getEnvDurationOrDefault("FRITZ_CALLMONITOR_CALDAV_MIN_DURATION", time.Minute),
+			Timeout:      getEnvDurationOrDefault("FRITZ_CALLMONITOR_CALDAV_TIMEOUT", 10*time.Second),
+			Contacts:     getEnvListOrDefault("FRITZ_CALLMONITOR_CALDAV_CONTACTS", []string{}),
+		},
+		Report: ReportConfig{
+			Enabled:          getEnvBoolOrDefault("FRITZ_CALLMONITOR_REPORT_ENABLED", false),
+			Dir:              getEnvOrDefault("FRITZ_CALLMONITOR_REPORT_DIR", ""),
+			Interval:         getEnvDurationOrDefault("FRITZ_CALLMONITOR_REPORT_INTERVAL", time.Hour),
+			Currency:         getEnvOrDefault("FRITZ_CALLMONITOR_REPORT_CURRENCY", "EUR"),
+			Tariffs:          getEnvListOrDefault("FRITZ_CALLMONITOR_REPORT_TARIFFS", []string{}),
+			Contacts:         getEnvListOrDefault("FRITZ_CALLMONITOR_REPORT_CONTACTS", []string{}),
+			SMTPHost:         getEnvOrDefault("FRITZ_CALLMONITOR_REPORT_SMTP_HOST", ""),
+			SMTPPort:         getEnvIntOrDefault("FRITZ_CALLMONITOR_REPORT_SMTP_PORT", 587),
+			SMTPUsername:     getEnvOrDefault("FRITZ_CALLMONITOR_REPORT_SMTP_USERNAME", ""),
+			SMTPPassword:     getEnvOrDefault("FRITZ_CALLMONITOR_REPORT_SMTP_PASSWORD", ""),
+			SMTPPasswordFile: getEnvOrDefault("FRITZ_CALLMONITOR_REPORT_SMTP_PASSWORD_FILE", ""),
+			MailFrom:         getEnvOrDefault("FRITZ_CALLMONITOR_REPORT_MAIL_FROM", ""),
+			MailTo:           getEnvListOrDefault("FRITZ_CALLMONITOR_REPORT_MAIL_TO", []string{}),
+		},
+		Notify: NotifyConfig{
+			Triggers:        getEnvListOrDefault("FRITZ_CALLMONITOR_NOTIFY_TRIGGERS", []string{"missed_call"}),
+			VIPs:            getEnvListOrDefault("FRITZ_CALLMONITOR_NOTIFY_VIPS", []string{}),
+			LongCall:        getEnvDurationOrDefault("FRITZ_CALLMONITOR_NOTIFY_LONG_CALL", 30*time.Minute),
+			TitleTemplate:   getEnvOrDefault("FRITZ_CALLMONITOR_NOTIFY_TITLE_TEMPLATE", ""),
+			MessageTemplate: getEnvOrDefault("FRITZ_CALLMONITOR_NOTIFY_MESSAGE_TEMPLATE", ""),
+			Timeout:         getEnvDurationOrDefault("FRITZ_CALLMONITOR_NOTIFY_TIMEOUT", 10*time.Second),
+			TelegramToken:   getEnvOrDefault("FRITZ_CALLMONITOR_NOTIFY_TELEGRAM_TOKEN", ""),
+			TelegramChatID:  getEnvOrDefault("FRITZ_CALLMONITOR_NOTIFY_TELEGRAM_CHAT_ID", ""),
+			PushoverToken:   getEnvOrDefault("FRITZ_CALLMONITOR_NOTIFY_PUSHOVER_TOKEN", ""),
+			PushoverUser:    getEnvOrDefault("FRITZ_CALLMONITOR_NOTIFY_PUSHOVER_USER", ""),
+			NtfyURL:         getEnvOrDefault("FRITZ_CALLMONITOR_NOTIFY_NTFY_URL", "https://ntfy.sh"),
+			NtfyTopic:       getEnvOrDefault("FRITZ_CALLMONITOR_NOTIFY_NTFY_TOPIC", ""),
+			NtfyToken:       getEnvOrDefault("FRITZ_CALLMONITOR_NOTIFY_NTFY_TOKEN", ""),
+		},
+		Backup: BackupConfig{
+			Interval:           getEnvDurationOrDefault("FRITZ_CALLMONITOR_BACKUP_INTERVAL", 24*time.Hour),
+			Keep:               getEnvIntOrDefault("FRITZ_CALLMONITOR_BACKUP_KEEP", 7),
+			Timeout:            getEnvDurationOrDefault("FRITZ_CALLMONITOR_BACKUP_TIMEOUT", 5*time.Minute),
+			S3Endpoint:         getEnvOrDefault("FRITZ_CALLMONITOR_BACKUP_S3_ENDPOINT", ""),
+			S3Region:           getEnvOrDefault("FRITZ_CALLMONITOR_BACKUP_S3_REGION", "us-east-1"),
+			S3Bucket:           getEnvOrDefault("FRITZ_CALLMONITOR_BACKUP_S3_BUCKET", ""),
+			S3Prefix:           getEnvOrDefault("FRITZ_CALLMONITOR_BACKUP_S3_PREFIX", ""),
+			S3AccessKey:        getEnvOrDefault("FRITZ_CALLMONITOR_BACKUP_S3_ACCESS_KEY", ""),
+			S3SecretKey:        getEnvOrDefault("FRITZ_CALLMONITOR_BACKUP_S3_SECRET_KEY", ""),
+			S3SecretKeyFile:    getEnvOrDefault("FRITZ_CALLMONITOR_BACKUP_S3_SECRET_KEY_FILE", ""),
+			S3PathStyle:        getEnvBoolOrDefault("FRITZ_CALLMONITOR_BACKUP_S3_PATH_STYLE", false),
+			WebDAVURL:          getEnvOrDefault("FRITZ_CALLMONITOR_BACKUP_WEBDAV_URL", ""),
+			WebDAVUsername:     getEnvOrDefault("FRITZ_CALLMONITOR_BACKUP_WEBDAV_USERNAME", ""),
+			WebDAVPassword:     getEnvOrDefault("FRITZ_CALLMONITOR_BACKUP_WEBDAV_PASSWORD", ""),
+			WebDAVPasswordFile: getEnvOrDefault("FRITZ_CALLMONITOR_BACKUP_WEBDAV_PASSWORD_FILE", ""),
 		},
 	}
 
@@ -106,7 +746,7 @@ func LoadConfig() (*Config, error) {
 }
 
 func getEnvListOrDefault(key string, defaultValue []string) []string {
-	if value := os.Getenv(key); value != "" {
+	if value := lookupEnv(key); value != "" {
 		return strings.Split(value, ",")
 	}
 	return defaultValue
@@ -114,14 +754,14 @@ func getEnvListOrDefault(key string, defaultValue []string) []string {
 
 // Helper functions for environment variable handling
 func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
+	if value := lookupEnv(key); value != "" {
 		return value
 	}
 	return defaultValue
 }
 
 func getEnvIntOrDefault(key string, defaultValue int) int {
-	if value := os.Getenv(key); value != "" {
+	if value := lookupEnv(key); value != "" {
 		if intValue, err := strconv.Atoi(value); err == nil {
 			return intValue
 		}
@@ -130,7 +770,7 @@ func getEnvIntOrDefault(key string, defaultValue int) int {
 }
 
 func getEnvBoolOrDefault(key string, defaultValue bool) bool {
-	if value := os.Getenv(key); value != "" {
+	if value := lookupEnv(key); value != "" {
 		if boolValue, err := strconv.ParseBool(value); err == nil {
 			return boolValue
 		}
@@ -138,8 +778,18 @@ func getEnvBoolOrDefault(key string, defaultValue bool) bool {
 	return defaultValue
 }
 
+// getEnvBoolOrNil returns nil if the variable is unset or not a boolean
+func getEnvBoolOrNil(key string) *bool {
+	if value := lookupEnv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return &boolValue
+		}
+	}
+	return nil
+}
+
 func getEnvDurationOrDefault(key string, defaultValue time.Duration) time.Duration {
-	if value := os.Getenv(key); value != "" {
+	if value := lookupEnv(key); value != "" {
 		if duration, err := time.ParseDuration(value); err == nil {
 			return duration
 		}
@@ -157,6 +807,59 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("fritz.box port must be between 1 and 65535")
 	}
 
+	if c.FritzBox.ConnectTimeout <= 0 {
+		return fmt.Errorf("fritz.box connect timeout must be greater than 0")
+	}
+
+	if c.FritzBox.TimestampPivotYear != 0 && (c.FritzBox.TimestampPivotYear < 1900 || c.FritzBox.TimestampPivotYear > 2100) {
+		return fmt.Errorf("fritz.box timestamp pivot year must be 0 (sliding window) or between 1900 and 2100")
+	}
+
+	if c.FritzBox.DNDControl || c.FritzBox.DetectTimezone || c.FritzBox.BackfillCallList {
+		if c.FritzBox.TR064Port <= 0 || c.FritzBox.TR064Port > 65535 {
+			return fmt.Errorf("fritz.box TR-064 port must be between 1 and 65535")
+		}
+	}
+	if c.FritzBox.DNDControl {
+		if c.FritzBox.DNDRefreshInterval <= 0 {
+			return fmt.Errorf("fritz.box DND refresh interval must be greater than 0")
+		}
+		if _, err := c.GetDNDDeflections(); err != nil {
+			return err
+		}
+	}
+
+	if _, _, err := c.GetMSNs(); err != nil {
+		return err
+	}
+	if _, err := c.GetExtensionNames(); err != nil {
+		return err
+	}
+	if _, err := c.GetTrunkNames(); err != nil {
+		return err
+	}
+	if _, err := c.GetExtensionFilter(); err != nil {
+		return err
+	}
+	if _, err := c.GetTagger(); err != nil {
+		return err
+	}
+	if err := c.GetReconnectPolicy().Validate(); err != nil {
+		return fmt.Errorf("invalid reconnect settings: %w", err)
+	}
+	if _, err := codec.Parse(c.MQTT.PayloadFormat, c.App.CloudEventsSource); err != nil {
+		return fmt.Errorf("invalid MQTT payload format: %w", err)
+	}
+	if c.MQTT.SchemaVersion < 0 || c.MQTT.SchemaVersion > types.SchemaVersion {
+		return fmt.Errorf("MQTT schema version must be between %d and %d (0 = latest)", types.SchemaVersionLegacy, types.SchemaVersion)
+	}
+	if _, err := c.GetMQTTEncryptionKey(); err != nil {
+		return err
+	}
+	if _, err := c.GetMQTTTenants(); err != nil {
+		return err
+	}
+
 	if c.MQTT.Broker == "" {
 		return fmt.Errorf("MQTT broker cannot be empty")
 	}
@@ -165,6 +868,122 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("MQTT port must be between 1 and 65535")
 	}
 
+	switch c.MQTT.BrokerMode {
+	case "", "failover", "mirror":
+	default:
+		return fmt.Errorf("invalid MQTT broker mode '%s', expected failover or mirror", c.MQTT.BrokerMode)
+	}
+	if _, err := c.GetMQTTBrokers(); err != nil {
+		return err
+	}
+
+	if c.MQTT.PublishTimeout <= 0 {
+		return fmt.Errorf("MQTT publish timeout must be greater than 0")
+	}
+
+	switch c.MQTT.ClientIDSuffix {
+	case "", "hostname", "random":
+	default:
+		return fmt.Errorf("MQTT client ID suffix must be hostname or random")
+	}
+
+	if c.MQTT.CallTopicTTL < 0 {
+		return fmt.Errorf("MQTT call topic TTL cannot be negative")
+	}
+
+	if c.MQTT.ElapsedInterval < 0 {
+		return fmt.Errorf("MQTT elapsed interval cannot be negative")
+	}
+
+	if c.MQTT.MissedCallAckTimeout < 0 {
+		return fmt.Errorf("MQTT missed call ack timeout cannot be negative")
+	}
+
+	if c.MQTT.CallQuery && c.MQTT.CallQueryLimit <= 0 {
+		return fmt.Errorf("MQTT call query limit must be greater than 0")
+	}
+
+	if c.MQTT.PublishRate < 0 {
+		return fmt.Errorf("MQTT publish rate cannot be negative")
+	}
+
+	if c.MQTT.MetricsInterval < 0 {
+		return fmt.Errorf("MQTT metrics interval cannot be negative")
+	}
+
+	if c.MQTT.RetainedCheckInterval < 0 {
+		return fmt.Errorf("MQTT retained check interval cannot be negative")
+	}
+
+	if c.MQTT.PublishRate > 0 && (c.MQTT.PublishBurst <= 0 || c.MQTT.PublishQueueSize <= 0) {
+		return fmt.Errorf("MQTT publish burst and queue size must be greater than 0")
+	}
+
+	if c.MQTT.CredentialsCheckInterval < 0 {
+		return fmt.Errorf("MQTT credentials check interval cannot be negative")
+	}
+
+	if _, _, err := c.GetMQTTCredentials(); err != nil {
+		return err
+	}
+
+	if c.MQTT.OAuth.TokenURL != "" {
+		if u, err := url.Parse(c.MQTT.OAuth.TokenURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("MQTT OAuth token URL must be an http or https URL")
+		}
+		if c.MQTT.OAuth.ClientID == "" {
+			return fmt.Errorf("MQTT OAuth client ID cannot be empty")
+		}
+		if c.MQTT.PasswordFile != "" {
+			return fmt.Errorf("MQTT password file and OAuth token cannot be used together")
+		}
+		if c.MQTT.OAuth.RefreshBefore <= 0 {
+			return fmt.Errorf("MQTT OAuth refresh margin must be greater than 0")
+		}
+		// The token is renewed by the credentials check
+		if c.MQTT.CredentialsCheckInterval <= 0 || c.MQTT.CredentialsCheckInterval >= c.MQTT.OAuth.RefreshBefore {
+			return fmt.Errorf("MQTT credentials check interval must be greater than 0 and shorter than the OAuth refresh margin")
+		}
+	}
+
+	if c.PBX.CountryCode != "" || c.PBX.Region != "" {
+		if _, err := phone.NewNormalizer(c.PBX.Region, c.PBX.CountryCode, c.PBX.LocalAreaCode); err != nil {
+			return fmt.Errorf("invalid PBX number settings: %w", err)
+		}
+	}
+	if _, err := phone.ParseFormat(c.PBX.NumberFormat); err != nil {
+		return fmt.Errorf("invalid PBX number format: %w", err)
+	}
+	if c.PBX.RepeatCallWindow < 0 {
+		return fmt.Errorf("repeat call window cannot be negative")
+	}
+
+	if c.App.HealthCheckPort < 0 || c.App.HealthCheckPort > 65535 {
+		return fmt.Errorf("health check port must be between 0 (disabled) and 65535")
+	}
+
+	if c.App.ShutdownTimeout <= 0 {
+		return fmt.Errorf("shutdown timeout must be greater than 0")
+	}
+
+	if c.App.StallTimeout < 0 {
+		return fmt.Errorf("stall timeout must not be negative")
+	}
+
+	if c.App.StartupGrace < 0 {
+		return fmt.Errorf("startup grace period must not be negative")
+	}
+
+	if c.App.EnrichHook != "" {
+		if c.App.EnrichTimeout <= 0 {
+			return fmt.Errorf("enrichment hook timeout must be greater than 0")
+		}
+		// The hook runs in the event loop, which must not look stalled while waiting for it
+		if c.App.StallTimeout > 0 && c.App.EnrichTimeout >= c.App.StallTimeout {
+			return fmt.Errorf("enrichment hook timeout must be shorter than the stall timeout")
+		}
+	}
+
 	if c.App.CallHistorySize <= 0 {
 		return fmt.Errorf("call history size must be greater than 0")
 	}
@@ -175,10 +994,223 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	if _, err := c.GetHistoryFilter(); err != nil {
+		return fmt.Errorf("invalid call history filter: %w", err)
+	}
+
+	if c.App.MissedCallMergeWindow < 0 {
+		return fmt.Errorf("missed call merge window cannot be negative")
+	}
+
+	if c.App.FinishTimeout < 0 {
+		return fmt.Errorf("finish timeout cannot be negative")
+	}
+	if _, err := c.GetLineFinishTimeouts(); err != nil {
+		return err
+	}
+
+	switch c.Database.Driver {
+	case "", "sqlite":
+	case "postgres":
+		if !postgresSupported {
+			return fmt.Errorf("database driver postgres is not included in this build, build with -tags postgres")
+		}
+		if c.Database.DSN == "" && c.Database.DSNFile == "" {
+			return fmt.Errorf("database DSN is required for the postgres driver")
+		}
+	default:
+		return fmt.Errorf("invalid database driver '%s', expected sqlite or postgres", c.Database.Driver)
+	}
+
 	if c.Database.DataDir == "" {
 		return fmt.Errorf("database data directory cannot be empty")
 	}
 
+	if c.Database.QueryTimeout <= 0 {
+		return fmt.Errorf("database query timeout must be greater than 0")
+	}
+
+	if c.Database.QueueSize < 0 || c.Database.BatchSize < 0 || c.Database.FlushInterval < 0 {
+		return fmt.Errorf("database queue size, batch size and flush interval cannot be negative")
+	}
+
+	if c.Database.HealthInterval < 0 {
+		return fmt.Errorf("database health interval cannot be negative")
+	}
+
+	if _, err := c.GetDatabaseFilter(); err != nil {
+		return fmt.Errorf("invalid database filter: %w", err)
+	}
+
+	if c.Database.RedactAfterDays < 0 {
+		return fmt.Errorf("database redact after days cannot be negative")
+	}
+
+	if c.Database.UnparsedDays < 0 {
+		return fmt.Errorf("database unparsed days cannot be negative")
+	}
+
+	if c.Database.RetentionDays < 0 {
+		return fmt.Errorf("database retention days cannot be negative")
+	}
+
+	if c.Database.RetentionDays > 0 {
+		switch c.Database.ArchiveFormat {
+		case "csv", "none":
+		case "parquet":
+			return fmt.Errorf("database archive format parquet is not supported, use csv and convert the archives if needed")
+		default:
+			return fmt.Errorf("invalid database archive format '%s', expected csv or none", c.Database.ArchiveFormat)
+		}
+	}
+
+	if c.Database.RedactAfterDays > 0 {
+		if c.Database.RedactDigits <= 0 {
+			return fmt.Errorf("database redact digits must be greater than 0")
+		}
+		if c.Database.RedactInterval <= 0 {
+			return fmt.Errorf("database redact interval must be greater than 0")
+		}
+	}
+
+	if c.Influx.URL != "" {
+		if u, err := url.Parse(c.Influx.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("influx URL must be an http or https URL")
+		}
+		if c.Influx.Bucket != "" && c.Influx.Org == "" {
+			return fmt.Errorf("influx org is required when a bucket is set")
+		}
+		if c.Influx.Timeout <= 0 {
+			return fmt.Errorf("influx timeout must be greater than 0")
+		}
+		if _, err := c.GetInfluxFilter(); err != nil {
+			return err
+		}
+	}
+
+	if c.CalDAV.URL != "" {
+		if u, err := url.Parse(c.CalDAV.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("CalDAV URL must be an http or https URL")
+		}
+		if c.CalDAV.MinDuration < 0 {
+			return fmt.Errorf("CalDAV minimum duration cannot be negative")
+		}
+		if c.CalDAV.Timeout <= 0 {
+			return fmt.Errorf("CalDAV timeout must be greater than 0")
+		}
+		if _, err := c.GetCalDAVContacts(); err != nil {
+			return err
+		}
+	}
+
+	if c.Output.File != "" {
+		if c.Output.FileMaxSize <= 0 {
+			return fmt.Errorf("output file max size must be greater than 0")
+		}
+		if c.Output.FileMaxFiles < 0 {
+			return fmt.Errorf("output file max files cannot be negative")
+		}
+	}
+	if c.Output.WebhookURL != "" {
+		if u, err := url.Parse(c.Output.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("output webhook URL must be an http or https URL")
+		}
+		if c.Output.WebhookTimeout <= 0 {
+			return fmt.Errorf("output webhook timeout must be greater than 0")
+		}
+	}
+	if c.Output.LogURL != "" {
+		if u, err := url.Parse(c.Output.LogURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("output log URL must be an http or https URL")
+		}
+		if c.Output.LogFormat != "loki" && c.Output.LogFormat != "json" {
+			return fmt.Errorf("output log format must be loki or json")
+		}
+		if c.Output.LogTimeout <= 0 {
+			return fmt.Errorf("output log timeout must be greater than 0")
+		}
+		if _, err := c.GetLogLabels(); err != nil {
+			return err
+		}
+	}
+	if c.Output.AMIPort < 0 || c.Output.AMIPort > 65535 {
+		return fmt.Errorf("output AMI port must be between 0 (disabled) and 65535")
+	}
+	if c.Output.AMIPort > 0 && c.Output.AMIUsername == "" && c.Output.AMISecret != "" {
+		return fmt.Errorf("output AMI username is required when a secret is set")
+	}
+
+	if c.Report.Enabled {
+		if c.Report.Interval <= 0 {
+			return fmt.Errorf("report interval must be greater than 0")
+		}
+		if _, err := c.GetReportTariffs(); err != nil {
+			return err
+		}
+		if _, err := c.GetReportContacts(); err != nil {
+			return err
+		}
+		if c.Report.SMTPHost != "" {
+			if c.Report.SMTPPort <= 0 || c.Report.SMTPPort > 65535 {
+				return fmt.Errorf("report SMTP port must be between 1 and 65535")
+			}
+			if c.Report.MailFrom == "" || len(c.Report.MailTo) == 0 {
+				return fmt.Errorf("report mail sender and recipients are required when an SMTP host is set")
+			}
+		}
+	}
+
+	if c.BackupEnabled() {
+		if c.Backup.S3Bucket != "" && c.Backup.WebDAVURL != "" {
+			return fmt.Errorf("backup S3 bucket and WebDAV URL cannot be set together")
+		}
+		if c.Database.Driver != "sqlite" {
+			return fmt.Errorf("backups are only supported for SQLite, back up PostgreSQL with pg_dump")
+		}
+		if c.Backup.S3Endpoint != "" {
+			if u, err := url.Parse(c.Backup.S3Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("backup S3 endpoint must be an http or https URL")
+			}
+		}
+		if c.Backup.WebDAVURL != "" {
+			if u, err := url.Parse(c.Backup.WebDAVURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("backup WebDAV URL must be an http or https URL")
+			}
+		}
+		if c.Backup.Interval <= 0 {
+			return fmt.Errorf("backup interval must be greater than 0")
+		}
+		if c.Backup.Keep < 0 {
+			return fmt.Errorf("backup keep cannot be negative")
+		}
+		if c.Backup.Timeout <= 0 {
+			return fmt.Errorf("backup timeout must be greater than 0")
+		}
+	}
+
+	if c.NotifyEnabled() {
+		if c.Notify.TelegramToken != "" && c.Notify.TelegramChatID == "" {
+			return fmt.Errorf("notify Telegram chat ID is required when a Telegram token is set")
+		}
+		if c.Notify.PushoverToken != "" && c.Notify.PushoverUser == "" {
+			return fmt.Errorf("notify Pushover user is required when a Pushover token is set")
+		}
+		if c.Notify.NtfyTopic != "" {
+			if u, err := url.Parse(c.Notify.NtfyURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("notify ntfy URL must be an http or https URL")
+			}
+		}
+		if c.Notify.LongCall <= 0 {
+			return fmt.Errorf("notify long call duration must be greater than 0")
+		}
+		if c.Notify.Timeout <= 0 {
+			return fmt.Errorf("notify timeout must be greater than 0")
+		}
+		if _, err := c.GetNotifyVIPs(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -189,3 +1221,433 @@ func (c *Config) GetLocation() (*time.Location, error) {
 	}
 	return time.LoadLocation(c.App.Timezone)
 }
+
+// GetDNDDeflections returns the IDs of the deflection rules switched by the DND command
+func (c *Config) GetDNDDeflections() ([]int, error) {
+	ids := make([]int, 0, len(c.FritzBox.DNDDeflections))
+	for _, value := range c.FritzBox.DNDDeflections {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil || id < 0 {
+			return nil, fmt.Errorf("invalid DND deflection ID '%s'", value)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// GetMQTTCredentials returns the MQTT username and password, read from the
+// credential files if configured
+func (c *Config) GetMQTTCredentials() (username string, password string, err error) {
+	username, password = c.MQTT.Username, c.MQTT.Password
+	if c.MQTT.UsernameFile != "" {
+		if username, err = readSecretFile(c.MQTT.UsernameFile); err != nil {
+			return "", "", fmt.Errorf("failed to read MQTT username file: %w", err)
+		}
+	}
+	if c.MQTT.PasswordFile != "" {
+		if password, err = readSecretFile(c.MQTT.PasswordFile); err != nil {
+			return "", "", fmt.Errorf("failed to read MQTT password file: %w", err)
+		}
+	}
+	return username, password, nil
+}
+
+// GetMQTTTenants parses the tenants, e.g. "acme=030111|030112", with their
+// credentials, e.g. "acme=user:secret". Every MSN of a tenant must be one of
+// the configured MSNs and belongs to one tenant only.
+func (c *Config) GetMQTTTenants() ([]MQTTTenant, error) {
+	if len(c.MQTT.Tenants) == 0 && len(c.MQTT.TenantCredentials) == 0 {
+		return nil, nil
+	}
+
+	msns, _, err := c.GetMSNs()
+	if err != nil {
+		return nil, err
+	}
+	tenants := make([]MQTTTenant, 0, len(c.MQTT.Tenants))
+	index := make(map[string]int, len(c.MQTT.Tenants))
+	owners := make(map[string]string)
+	for _, entry := range c.MQTT.Tenants {
+		name, list, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" || strings.ContainsAny(name, "/+#") {
+			return nil, fmt.Errorf("invalid MQTT tenant '%s', expected tenant=msn|msn", entry)
+		}
+		if _, exists := index[name]; exists {
+			return nil, fmt.Errorf("MQTT tenant '%s' is configured twice", name)
+		}
+
+		tenant := MQTTTenant{Name: name}
+		for _, value := range strings.Split(list, "|") {
+			if strings.TrimSpace(value) == "" {
+				continue
+			}
+			msn, err := types.NormalizeMSN(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid MQTT tenant '%s': %w", name, err)
+			}
+			if !slices.Contains(msns, msn) {
+				return nil, fmt.Errorf("MSN '%s' of MQTT tenant '%s' is not a configured MSN", msn, name)
+			}
+			if owner, exists := owners[msn]; exists {
+				return nil, fmt.Errorf("MSN '%s' belongs to MQTT tenants '%s' and '%s'", msn, owner, name)
+			}
+			owners[msn] = name
+			tenant.MSNs = append(tenant.MSNs, msn)
+		}
+		if len(tenant.MSNs) == 0 {
+			return nil, fmt.Errorf("MQTT tenant '%s' has no MSNs", name)
+		}
+		index[name] = len(tenants)
+		tenants = append(tenants, tenant)
+	}
+
+	for _, entry := range c.MQTT.TenantCredentials {
+		name, credentials, ok := strings.Cut(entry, "=")
+		username, password, hasPassword := strings.Cut(credentials, ":")
+		name, username = strings.TrimSpace(name), strings.TrimSpace(username)
+		if !ok || !hasPassword || username == "" {
+			return nil, fmt.Errorf("invalid MQTT tenant credentials for '%s', expected tenant=username:password", name)
+		}
+		i, exists := index[name]
+		if !exists {
+			return nil, fmt.Errorf("MQTT tenant credentials for unknown tenant '%s'", name)
+		}
+		tenants[i].Username, tenants[i].Password = username, password
+	}
+	return tenants, nil
+}
+
+// GetMQTTBrokers returns the further brokers as host:port, with the MQTT
+// port where none is given. The main broker and duplicates are left out.
+func (c *Config) GetMQTTBrokers() ([]string, error) {
+	main := net.JoinHostPort(c.MQTT.Broker, strconv.Itoa(c.MQTT.Port))
+	var brokers []string
+	for _, entry := range c.MQTT.Brokers {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		host, port, err := net.SplitHostPort(entry)
+		if err != nil {
+			// No port, an IPv6 address may still be in brackets
+			host, port = strings.Trim(entry, "[]"), strconv.Itoa(c.MQTT.Port)
+		}
+		number, err := strconv.Atoi(port)
+		if host == "" || strings.ContainsAny(host, "/[] ") || err != nil || number <= 0 || number > 65535 {
+			return nil, fmt.Errorf("invalid MQTT broker '%s', expected host or host:port", entry)
+		}
+		broker := net.JoinHostPort(host, port)
+		if broker != main && !slices.Contains(brokers, broker) {
+			brokers = append(brokers, broker)
+		}
+	}
+	return brokers, nil
+}
+
+// GetMQTTEncryptionKey returns the key encrypting the MQTT payloads, read
+// from the key file if configured, or nil if payloads are not encrypted
+func (c *Config) GetMQTTEncryptionKey() (*seal.Key, error) {
+	text := c.MQTT.EncryptionKey
+	if c.MQTT.EncryptionKeyFile != "" {
+		var err error
+		if text, err = readSecretFile(c.MQTT.EncryptionKeyFile); err != nil {
+			return nil, fmt.Errorf("failed to read MQTT encryption key file: %w", err)
+		}
+	}
+	if text == "" {
+		return nil, nil
+	}
+	key, err := seal.ParseKey(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MQTT encryption key: %w", err)
+	}
+	return &key, nil
+}
+
+// HasMQTTCredentialFiles reports whether the MQTT credentials are read from files
+func (c *Config) HasMQTTCredentialFiles() bool {
+	return c.MQTT.UsernameFile != "" || c.MQTT.PasswordFile != ""
+}
+
+// HasMQTTOAuth reports whether the MQTT password is an OAuth2 access token
+func (c *Config) HasMQTTOAuth() bool {
+	return c.MQTT.OAuth.TokenURL != ""
+}
+
+// readSecretFile returns the file content without the trailing newline most secret stores write
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// GetDatabaseDSN returns the PostgreSQL connection string, read from the DSN file if configured
+func (c *Config) GetDatabaseDSN() (string, error) {
+	if c.Database.DSNFile == "" {
+		return c.Database.DSN, nil
+	}
+	dsn, err := readSecretFile(c.Database.DSNFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read database DSN file: %w", err)
+	}
+	return dsn, nil
+}
+
+// GetHistoryFilter returns the filter for the calls kept in the call history
+func (c *Config) GetHistoryFilter() (types.HistoryFilter, error) {
+	return types.ParseHistoryFilter(c.App.HistoryFinishStates, c.App.HistoryDirections)
+}
+
+// GetDatabaseFilter returns the filter for the calls stored in the database
+func (c *Config) GetDatabaseFilter() (types.HistoryFilter, error) {
+	return types.ParseHistoryFilter(c.Database.FinishStates, c.Database.Directions)
+}
+
+// GetCalDAVPassword returns the CalDAV password, read from the password file if configured
+func (c *Config) GetCalDAVPassword() (string, error) {
+	if c.CalDAV.PasswordFile == "" {
+		return c.CalDAV.Password, nil
+	}
+	password, err := readSecretFile(c.CalDAV.PasswordFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read CalDAV password file: %w", err)
+	}
+	return password, nil
+}
+
+// GetCalDAVContacts parses the contact names, e.g. "+4930123456=ACME Corp"
+func (c *Config) GetCalDAVContacts() (map[string]string, error) {
+	contacts := make(map[string]string, len(c.CalDAV.Contacts))
+	for _, entry := range c.CalDAV.Contacts {
+		number, name, ok := strings.Cut(entry, "=")
+		number, name = strings.TrimSpace(number), strings.TrimSpace(name)
+		if !ok || number == "" || name == "" {
+			return nil, fmt.Errorf("invalid CalDAV contact '%s', expected number=name", entry)
+		}
+		contacts[number] = name
+	}
+	return contacts, nil
+}
+
+// GetLogLabels parses the labels of the shipped logs, e.g. "job=fritz-callmonitor2mqtt"
+func (c *Config) GetLogLabels() (map[string]string, error) {
+	labels := make(map[string]string, len(c.Output.LogLabels))
+	for _, entry := range c.Output.LogLabels {
+		name, value, ok := strings.Cut(entry, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || !logLabelName.MatchString(name) || value == "" {
+			return nil, fmt.Errorf("invalid log label '%s', expected name=value", entry)
+		}
+		labels[name] = value
+	}
+	return labels, nil
+}
+
+// GetLineFinishTimeouts returns the finish timeouts configured for single lines by line
+func (c *Config) GetLineFinishTimeouts() (map[int]time.Duration, error) {
+	timeouts := make(map[int]time.Duration, len(c.App.LineFinishTimeouts))
+	for _, entry := range c.App.LineFinishTimeouts {
+		line, value, ok := strings.Cut(entry, "=")
+		number, err := strconv.Atoi(strings.TrimSpace(line))
+		if !ok || err != nil || number < 0 {
+			return nil, fmt.Errorf("invalid line finish timeout '%s', expected line=duration", entry)
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil || timeout < 0 {
+			return nil, fmt.Errorf("invalid line finish timeout '%s', expected line=duration", entry)
+		}
+		timeouts[number] = timeout
+	}
+	return timeouts, nil
+}
+
+// GetReportDir returns the directory of the monthly call reports
+func (c *Config) GetReportDir() string {
+	if c.Report.Dir != "" {
+		return c.Report.Dir
+	}
+	return filepath.Join(c.Database.DataDir, "reports")
+}
+
+// GetArchiveDir returns the directory of the monthly call archives
+func (d *DatabaseConfig) GetArchiveDir() string {
+	if d.ArchiveDir != "" {
+		return d.ArchiveDir
+	}
+	return filepath.Join(d.DataDir, "archive")
+}
+
+// GetMSNs returns the normalized MSNs without duplicates and the names of
+// the MSNs configured as msn=name
+func (c *Config) GetMSNs() ([]string, map[string]string, error) {
+	return types.ParseMSNs(c.PBX.MSN)
+}
+
+// GetExtensionNames returns the configured extension names by callmonitor extension ID
+func (c *Config) GetExtensionNames() (map[string]string, error) {
+	return types.ParseExtensionNames(c.PBX.Extensions)
+}
+
+// GetTrunkNames returns the configured names of the SIP lines
+func (c *Config) GetTrunkNames() (map[string]string, error) {
+	return types.ParseTrunkNames(c.PBX.Trunks)
+}
+
+// GetTrunkFilter returns the filter for the trunks whose calls are processed
+func (c *Config) GetTrunkFilter() types.TrunkFilter {
+	return types.NewTrunkFilter(c.PBX.TrunkAllow, c.PBX.TrunkDeny)
+}
+
+// GetReconnectPolicy returns the backoff between reconnects to the Fritz!Box
+// and the MQTT broker; unset delays are taken from backoff.DefaultPolicy
+func (c *Config) GetReconnectPolicy() backoff.Policy {
+	policy := backoff.Policy{
+		Initial:     c.App.ReconnectDelay,
+		Max:         c.App.ReconnectMaxDelay,
+		Multiplier:  2,
+		Jitter:      float64(c.App.ReconnectJitter) / 100,
+		MaxAttempts: c.App.ReconnectMaxAttempts,
+	}
+	defaults := backoff.DefaultPolicy()
+	if policy.Initial <= 0 {
+		policy.Initial = defaults.Initial
+	}
+	if policy.Max <= 0 {
+		policy.Max = max(defaults.Max, policy.Initial)
+	}
+	return policy
+}
+
+// GetTagger returns the tagger of the configured tag rules and contact groups
+func (c *Config) GetTagger() (*types.Tagger, error) {
+	rules, err := types.ParseTagRules(c.PBX.TagRules)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := types.ParseContactGroups(c.PBX.ContactGroups)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewTagger(rules, groups), nil
+}
+
+// GetVIPList returns the callers whose calls get priority, nil if none are configured
+func (c *Config) GetVIPList() (*types.VIPList, error) {
+	groups, err := types.ParseContactGroups(c.PBX.ContactGroups)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewVIPList(c.PBX.VIPNumbers, c.PBX.VIPGroups, groups), nil
+}
+
+// GetNumberFormatter returns the formatter of the numbers in published payloads
+func (c *Config) GetNumberFormatter() (*phone.Formatter, error) {
+	var normalizer *phone.Normalizer
+	if c.PBX.CountryCode != "" || c.PBX.Region != "" {
+		n, err := phone.NewNormalizer(c.PBX.Region, c.PBX.CountryCode, c.PBX.LocalAreaCode)
+		if err != nil {
+			return nil, fmt.Errorf("invalid PBX number settings: %w", err)
+		}
+		normalizer = n
+	}
+	return phone.NewFormatter(c.PBX.NumberFormat, normalizer)
+}
+
+// GetExtensionFilter returns the filter for the MSNs/extensions whose calls are processed
+func (c *Config) GetExtensionFilter() (types.ExtensionFilter, error) {
+	return types.NewExtensionFilter(c.PBX.ExtensionAllow, c.PBX.ExtensionDeny)
+}
+
+// GetReportTariffs parses the prices of outbound calls, e.g. "01=0.09"
+func (c *Config) GetReportTariffs() (types.Tariffs, error) {
+	return types.ParseTariffs(c.Report.Tariffs)
+}
+
+// GetReportContacts parses the contact names of the reports, falling back to the CalDAV contacts
+func (c *Config) GetReportContacts() (map[string]string, error) {
+	if len(c.Report.Contacts) == 0 {
+		return c.GetCalDAVContacts()
+	}
+	contacts := make(map[string]string, len(c.Report.Contacts))
+	for _, entry := range c.Report.Contacts {
+		number, name, ok := strings.Cut(entry, "=")
+		number, name = strings.TrimSpace(number), strings.TrimSpace(name)
+		if !ok || number == "" || name == "" {
+			return nil, fmt.Errorf("invalid report contact '%s', expected number=name", entry)
+		}
+		contacts[number] = name
+	}
+	return contacts, nil
+}
+
+// GetReportSMTPPassword returns the mail server password, read from the password file if configured
+func (c *Config) GetReportSMTPPassword() (string, error) {
+	if c.Report.SMTPPasswordFile == "" {
+		return c.Report.SMTPPassword, nil
+	}
+	password, err := readSecretFile(c.Report.SMTPPasswordFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read report SMTP password file: %w", err)
+	}
+	return password, nil
+}
+
+// BackupEnabled reports whether a target of the database backups is configured
+func (c *Config) BackupEnabled() bool {
+	return c.Backup.S3Bucket != "" || c.Backup.WebDAVURL != ""
+}
+
+// GetBackupS3SecretKey returns the S3 secret access key, read from the secret key file if configured
+func (c *Config) GetBackupS3SecretKey() (string, error) {
+	if c.Backup.S3SecretKeyFile == "" {
+		return c.Backup.S3SecretKey, nil
+	}
+	secretKey, err := readSecretFile(c.Backup.S3SecretKeyFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read backup S3 secret key file: %w", err)
+	}
+	return secretKey, nil
+}
+
+// GetBackupWebDAVPassword returns the WebDAV password, read from the password file if configured
+func (c *Config) GetBackupWebDAVPassword() (string, error) {
+	if c.Backup.WebDAVPasswordFile == "" {
+		return c.Backup.WebDAVPassword, nil
+	}
+	password, err := readSecretFile(c.Backup.WebDAVPasswordFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read backup WebDAV password file: %w", err)
+	}
+	return password, nil
+}
+
+// NotifyEnabled reports whether at least one push notification channel is configured
+func (c *Config) NotifyEnabled() bool {
+	return c.Notify.TelegramToken != "" || c.Notify.PushoverToken != "" || c.Notify.NtfyTopic != ""
+}
+
+// GetNotifyVIPs returns the names of the VIP numbers
+func (c *Config) GetNotifyVIPs() (map[string]string, error) {
+	vips := make(map[string]string, len(c.Notify.VIPs))
+	for _, entry := range c.Notify.VIPs {
+		number, name, ok := strings.Cut(entry, "=")
+		number, name = strings.TrimSpace(number), strings.TrimSpace(name)
+		if !ok || number == "" || name == "" {
+			return nil, fmt.Errorf("invalid notify VIP '%s', expected number=name", entry)
+		}
+		vips[number] = name
+	}
+	return vips, nil
+}
+
+// GetInfluxFilter returns the filter for the calls exported via line protocol
+func (c *Config) GetInfluxFilter() (types.HistoryFilter, error) {
+	return types.ParseHistoryFilter(c.Influx.FinishStates, c.Influx.Directions)
+}
@@ -1,6 +1,9 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
 	"time"
 )
@@ -43,19 +46,23 @@ func TestConfigTimezone(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			config := &Config{
 				FritzBox: FritzBoxConfig{
-					Host: "fritz.box",
-					Port: 1012,
+					Host:           "fritz.box",
+					Port:           1012,
+					ConnectTimeout: 10 * time.Second,
 				},
 				MQTT: MQTTConfig{
-					Broker: "localhost",
-					Port:   1883,
+					Broker:         "localhost",
+					Port:           1883,
+					PublishTimeout: 10 * time.Second,
 				},
 				App: AppConfig{
 					CallHistorySize: 50,
 					Timezone:        tt.timezone,
+					ShutdownTimeout: 10 * time.Second,
 				},
 				Database: DatabaseConfig{
-					DataDir: "./data",
+					DataDir:      "./data",
+					QueryTimeout: 30 * time.Second,
 				},
 			}
 
@@ -103,3 +110,464 @@ func TestLoadConfigTimezone(t *testing.T) {
 		t.Errorf("Default timezone should be valid: %v", err)
 	}
 }
+
+func TestConfigRedactionValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		afterDays   int
+		digits      int
+		interval    time.Duration
+		expectError bool
+	}{
+		{"disabled", 0, 0, 0, false},
+		{"enabled with defaults", 90, 3, time.Hour, false},
+		{"negative days", -1, 3, time.Hour, true},
+		{"enabled without digits", 90, 0, time.Hour, true},
+		{"enabled without interval", 90, 3, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{
+				FritzBox: FritzBoxConfig{Host: "fritz.box", Port: 1012, ConnectTimeout: 10 * time.Second},
+				MQTT:     MQTTConfig{Broker: "localhost", Port: 1883, PublishTimeout: 10 * time.Second},
+				App:      AppConfig{CallHistorySize: 50, ShutdownTimeout: 10 * time.Second},
+				Database: DatabaseConfig{
+					DataDir:         "./data",
+					QueryTimeout:    30 * time.Second,
+					RedactAfterDays: tt.afterDays,
+					RedactDigits:    tt.digits,
+					RedactInterval:  tt.interval,
+				},
+			}
+
+			err := config.Validate()
+			if tt.expectError && err == nil {
+				t.Error("Expected validation error, but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected validation error: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadConfigDoNotRecord(t *testing.T) {
+	t.Setenv("FRITZ_CALLMONITOR_PBX_DO_NOT_RECORD", "990133,21")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if len(config.PBX.DoNotRecord) != 2 || config.PBX.DoNotRecord[0] != "990133" || config.PBX.DoNotRecord[1] != "21" {
+		t.Errorf("Expected do-not-record list [990133 21], got %v", config.PBX.DoNotRecord)
+	}
+}
+
+func TestLoadConfigTopics(t *testing.T) {
+	t.Setenv("FRITZ_CALLMONITOR_MQTT_TOPIC_LINE_STATUS", "{{.Prefix}}/{{.Box}}/line/{{.Line}}/status")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if config.MQTT.Topics.LineStatus != "{{.Prefix}}/{{.Box}}/line/{{.Line}}/status" {
+		t.Errorf("Unexpected line status topic template %q", config.MQTT.Topics.LineStatus)
+	}
+	if config.MQTT.Topics.Status != "" {
+		t.Errorf("Expected unset templates to stay empty, got %q", config.MQTT.Topics.Status)
+	}
+}
+
+func TestLoadConfigRetainTopics(t *testing.T) {
+	t.Setenv("FRITZ_CALLMONITOR_MQTT_RETAIN_LINE_LAST_EVENT", "false")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if config.MQTT.RetainTopics.LineLastEvent == nil || *config.MQTT.RetainTopics.LineLastEvent {
+		t.Errorf("Expected line last event retain override false, got %v", config.MQTT.RetainTopics.LineLastEvent)
+	}
+	if config.MQTT.RetainTopics.LineStatus != nil {
+		t.Errorf("Expected no override for line status, got %v", *config.MQTT.RetainTopics.LineStatus)
+	}
+}
+
+func TestLoadConfigPublishTopics(t *testing.T) {
+	t.Setenv("FRITZ_CALLMONITOR_MQTT_PUBLISH_HISTORY", "false")
+	t.Setenv("FRITZ_CALLMONITOR_MQTT_PUBLISH_FSM", "true")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if config.MQTT.PublishTopics.History == nil || *config.MQTT.PublishTopics.History {
+		t.Errorf("Expected history switched off, got %v", config.MQTT.PublishTopics.History)
+	}
+	if config.MQTT.PublishTopics.FSM == nil || !*config.MQTT.PublishTopics.FSM {
+		t.Errorf("Expected FSM topics switched on, got %v", config.MQTT.PublishTopics.FSM)
+	}
+	if config.MQTT.PublishTopics.LineStatus != nil {
+		t.Errorf("Expected no switch for line status, got %v", *config.MQTT.PublishTopics.LineStatus)
+	}
+}
+
+func TestLoadConfigPayloadFormat(t *testing.T) {
+	t.Setenv("FRITZ_CALLMONITOR_MQTT_PAYLOAD_FORMATS", "history=msgpack,ringing=json")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if config.MQTT.PayloadFormat != "json" || len(config.MQTT.PayloadFormats) != 2 {
+		t.Errorf("Expected json with 2 topic formats, got %q and %v", config.MQTT.PayloadFormat, config.MQTT.PayloadFormats)
+	}
+
+	config.MQTT.PayloadFormat = "xml"
+	if err := config.Validate(); err == nil {
+		t.Error("Expected an unknown payload format to be rejected")
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "fritz-callmonitor2mqtt.env")
+	content := `# Reloaded on SIGHUP
+export FRITZ_CALLMONITOR_PBX_MSN=990133,990134
+
+FRITZ_CALLMONITOR_APP_LOG_LEVEL="debug"
+FRITZ_CALLMONITOR_MQTT_TOPIC_PREFIX='home/phone'
+`
+	if err := os.WriteFile(configFile, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	t.Setenv("FRITZ_CALLMONITOR_CONFIG_FILE", configFile)
+	t.Setenv("FRITZ_CALLMONITOR_APP_LOG_LEVEL", "warn")
+	t.Setenv("FRITZ_CALLMONITOR_MQTT_QOS", "2")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if len(config.PBX.MSN) != 2 || config.PBX.MSN[1] != "990134" {
+		t.Errorf("Expected MSNs [990133 990134], got %v", config.PBX.MSN)
+	}
+	if config.App.LogLevel != "debug" || config.MQTT.TopicPrefix != "home/phone" {
+		t.Errorf("Expected the file to override the environment, got log level %q and prefix %q", config.App.LogLevel, config.MQTT.TopicPrefix)
+	}
+	if config.MQTT.QoS != 2 {
+		t.Errorf("Expected QoS 2 from the environment, got %d", config.MQTT.QoS)
+	}
+	if config.App.ConfigFile != configFile {
+		t.Errorf("Expected config file %s, got %q", configFile, config.App.ConfigFile)
+	}
+
+	if err := os.WriteFile(configFile, []byte("FRITZ_CALLMONITOR_PBX_MSN\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if _, err := LoadConfig(); err == nil {
+		t.Error("Expected an error for a line without value")
+	}
+}
+
+func TestGetReconnectPolicy(t *testing.T) {
+	t.Setenv("FRITZ_CALLMONITOR_APP_RECONNECT_DELAY", "2s")
+	t.Setenv("FRITZ_CALLMONITOR_APP_RECONNECT_JITTER", "50")
+	t.Setenv("FRITZ_CALLMONITOR_APP_RECONNECT_MAX_ATTEMPTS", "3")
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	policy := config.GetReconnectPolicy()
+	if policy.Initial != 2*time.Second || policy.Max != 5*time.Minute || policy.Jitter != 0.5 || policy.MaxAttempts != 3 {
+		t.Errorf("Unexpected reconnect policy %+v", policy)
+	}
+
+	config.App.ReconnectMaxDelay = time.Second
+	if err := config.Validate(); err == nil {
+		t.Error("Expected a maximum delay below the initial delay to be rejected")
+	}
+	config.App.ReconnectMaxDelay = time.Minute
+	config.App.ReconnectJitter = 150
+	if err := config.Validate(); err == nil {
+		t.Error("Expected a jitter above 100 percent to be rejected")
+	}
+}
+
+func TestGetMQTTTenants(t *testing.T) {
+	cfg := &Config{
+		PBX: PBXConfig{MSN: []string{"990133=Office", "990134", "0990144"}},
+		MQTT: MQTTConfig{
+			Tenants:           []string{"acme=990133|990134", "beta = 990 144"},
+			TenantCredentials: []string{"beta=beta-user:s3cr:et"},
+		},
+	}
+	tenants, err := cfg.GetMQTTTenants()
+	if err != nil {
+		t.Fatalf("GetMQTTTenants failed: %v", err)
+	}
+	if len(tenants) != 2 || tenants[0].Name != "acme" || len(tenants[0].MSNs) != 2 || tenants[0].Username != "" {
+		t.Fatalf("Unexpected tenants %+v", tenants)
+	}
+	if tenants[1].Name != "beta" || tenants[1].MSNs[0] != "990144" || tenants[1].Username != "beta-user" || tenants[1].Password != "s3cr:et" {
+		t.Errorf("Expected beta with own credentials, got %+v", tenants[1])
+	}
+
+	invalid := []MQTTConfig{
+		{Tenants: []string{"acme"}},
+		{Tenants: []string{"ac/me=990133"}},
+		{Tenants: []string{"acme=990199"}},
+		{Tenants: []string{"acme=99013x"}},
+		{Tenants: []string{"acme=990133", "beta=990133"}},
+		{Tenants: []string{"acme=990133", "acme=990134"}},
+		{Tenants: []string{"acme="}},
+		{Tenants: []string{"acme=990133"}, TenantCredentials: []string{"beta=user:secret"}},
+		{Tenants: []string{"acme=990133"}, TenantCredentials: []string{"acme=user"}},
+	}
+	for _, mqtt := range invalid {
+		cfg.MQTT = mqtt
+		if _, err := cfg.GetMQTTTenants(); err == nil {
+			t.Errorf("Expected an error for %+v", mqtt)
+		}
+	}
+}
+
+func TestGetMQTTBrokers(t *testing.T) {
+	cfg := &Config{MQTT: MQTTConfig{Broker: "mqtt-1", Port: 1883, Brokers: []string{"mqtt-2", " mqtt-3:8883", "mqtt-1:1883", "mqtt-2:1883", "[fd00::1]", ""}}}
+	brokers, err := cfg.GetMQTTBrokers()
+	if err != nil {
+		t.Fatalf("GetMQTTBrokers failed: %v", err)
+	}
+	if want := []string{"mqtt-2:1883", "mqtt-3:8883", "[fd00::1]:1883"}; !slices.Equal(brokers, want) {
+		t.Errorf("Expected %v, got %v", want, brokers)
+	}
+
+	for _, broker := range []string{"mqtt-2:0", "mqtt-2:http", ":1883", "tcp://mqtt-2:1883"} {
+		cfg.MQTT.Brokers = []string{broker}
+		if _, err := cfg.GetMQTTBrokers(); err == nil {
+			t.Errorf("Expected an error for %q", broker)
+		}
+	}
+}
+
+func TestGetMQTTCredentials(t *testing.T) {
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	if err := os.WriteFile(passwordFile, []byte("token-1\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write password file: %v", err)
+	}
+	t.Setenv("FRITZ_CALLMONITOR_MQTT_USERNAME", "bridge")
+	t.Setenv("FRITZ_CALLMONITOR_MQTT_PASSWORD", "static")
+	t.Setenv("FRITZ_CALLMONITOR_MQTT_PASSWORD_FILE", passwordFile)
+
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if !config.HasMQTTCredentialFiles() {
+		t.Error("Expected credential files to be configured")
+	}
+
+	username, password, err := config.GetMQTTCredentials()
+	if err != nil {
+		t.Fatalf("GetMQTTCredentials failed: %v", err)
+	}
+	if username != "bridge" || password != "token-1" {
+		t.Errorf("Expected bridge/token-1, got %s/%s", username, password)
+	}
+
+	// Rotated credentials are picked up on the next read
+	if err := os.WriteFile(passwordFile, []byte("token-2"), 0o600); err != nil {
+		t.Fatalf("Failed to write password file: %v", err)
+	}
+	if _, password, _ := config.GetMQTTCredentials(); password != "token-2" {
+		t.Errorf("Expected rotated password token-2, got %s", password)
+	}
+}
+
+func TestGetMQTTEncryptionKey(t *testing.T) {
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if key, err := config.GetMQTTEncryptionKey(); key != nil || err != nil {
+		t.Errorf("Expected plain payloads by default, got %v, %v", key, err)
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("AQIDAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+	config.MQTT.EncryptionKey = "ignored"
+	config.MQTT.EncryptionKeyFile = keyFile
+	key, err := config.GetMQTTEncryptionKey()
+	if err != nil {
+		t.Fatalf("GetMQTTEncryptionKey failed: %v", err)
+	}
+	if key == nil || key[0] != 1 || key[2] != 3 {
+		t.Errorf("Expected the key of the file, got %v", key)
+	}
+
+	config.MQTT.EncryptionKeyFile = ""
+	if err := config.Validate(); err == nil {
+		t.Error("Expected an invalid encryption key to be rejected")
+	}
+}
+
+func TestConfigTimeoutValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		modify      func(c *Config)
+		expectError bool
+	}{
+		{"defaults", func(c *Config) {}, false},
+		{"missing fritz.box connect timeout", func(c *Config) { c.FritzBox.ConnectTimeout = 0 }, true},
+		{"missing MQTT publish timeout", func(c *Config) { c.MQTT.PublishTimeout = 0 }, true},
+		{"negative call topic TTL", func(c *Config) { c.MQTT.CallTopicTTL = -time.Minute }, true},
+		{"negative elapsed interval", func(c *Config) { c.MQTT.ElapsedInterval = -time.Second }, true},
+		{"national number format", func(c *Config) { c.PBX.NumberFormat = "national" }, false},
+		{"unknown number format", func(c *Config) { c.PBX.NumberFormat = "international" }, true},
+		{"repeat call window", func(c *Config) { c.PBX.RepeatCallWindow = 2 * time.Minute }, false},
+		{"negative repeat call window", func(c *Config) { c.PBX.RepeatCallWindow = -time.Minute }, true},
+		{"legacy schema version", func(c *Config) { c.MQTT.SchemaVersion = 1 }, false},
+		{"unknown schema version", func(c *Config) { c.MQTT.SchemaVersion = 3 }, true},
+		{"named MSNs", func(c *Config) { c.PBX.MSN = []string{"990133=Office", " 990 134 "} }, false},
+		{"MSN with non-digits", func(c *Config) { c.PBX.MSN = []string{"+4930990133"} }, true},
+		{"MSN without name", func(c *Config) { c.PBX.MSN = []string{"990133="} }, true},
+		{"MQTT publish rate", func(c *Config) { c.MQTT.PublishRate = 10 }, false},
+		{"negative MQTT publish rate", func(c *Config) { c.MQTT.PublishRate = -1 }, true},
+		{"negative missed call ack timeout", func(c *Config) { c.MQTT.MissedCallAckTimeout = -time.Minute }, true},
+		{"MQTT publish rate without burst", func(c *Config) { c.MQTT.PublishRate = 10; c.MQTT.PublishBurst = 0 }, true},
+		{"MQTT broker mirror", func(c *Config) { c.MQTT.Brokers = []string{"mqtt-2:1884"}; c.MQTT.BrokerMode = "mirror" }, false},
+		{"unknown MQTT broker mode", func(c *Config) { c.MQTT.BrokerMode = "roundrobin" }, true},
+		{"invalid MQTT broker", func(c *Config) { c.MQTT.Brokers = []string{"mqtt-2:99999"} }, true},
+		{"negative credentials check interval", func(c *Config) { c.MQTT.CredentialsCheckInterval = -time.Second }, true},
+		{"MQTT OAuth", func(c *Config) {
+			c.MQTT.OAuth.TokenURL = "https://auth.example.com/oauth/token"
+			c.MQTT.OAuth.ClientID = "bridge"
+		}, false},
+		{"MQTT OAuth without client ID", func(c *Config) { c.MQTT.OAuth.TokenURL = "https://auth.example.com/oauth/token" }, true},
+		{"MQTT OAuth check interval too long", func(c *Config) {
+			c.MQTT.OAuth.TokenURL = "https://auth.example.com/oauth/token"
+			c.MQTT.OAuth.ClientID = "bridge"
+			c.MQTT.CredentialsCheckInterval = 10 * time.Minute
+		}, true},
+		{"missing password file", func(c *Config) { c.MQTT.PasswordFile = "/nonexistent/mqtt-password" }, true},
+		{"influx v2", func(c *Config) { c.Influx.URL = "http://influx:8086"; c.Influx.Org = "home"; c.Influx.Bucket = "fritz" }, false},
+		{"influx URL without scheme", func(c *Config) { c.Influx.URL = "influx:8086" }, true},
+		{"influx bucket without org", func(c *Config) { c.Influx.URL = "http://influx:8086"; c.Influx.Bucket = "fritz" }, true},
+		{"invalid influx finish state", func(c *Config) { c.Influx.URL = "http://influx:8086"; c.Influx.FinishStates = []string{"busy"} }, true},
+		{"all outputs", func(c *Config) {
+			c.Output.Stdout = true
+			c.Output.File = "/var/log/calls.ndjson"
+			c.Output.WebhookURL = "https://hooks.example.com/calls"
+		}, false},
+		{"output file without max size", func(c *Config) { c.Output.File = "/var/log/calls.ndjson"; c.Output.FileMaxSize = 0 }, true},
+		{"output webhook URL without scheme", func(c *Config) { c.Output.WebhookURL = "hooks.example.com" }, true},
+		{"output log shipping", func(c *Config) {
+			c.Output.LogURL = "http://loki:3100/loki/api/v1/push"
+			c.Output.LogLabels = []string{"job=fritz", "host = box"}
+		}, false},
+		{"output log URL without scheme", func(c *Config) { c.Output.LogURL = "loki:3100" }, true},
+		{"unsupported output log format", func(c *Config) { c.Output.LogURL = "http://loki:3100"; c.Output.LogFormat = "syslog" }, true},
+		{"invalid output log label", func(c *Config) {
+			c.Output.LogURL = "http://loki:3100"
+			c.Output.LogLabels = []string{"service-name=fritz"}
+		}, true},
+		{"MQTT client ID suffix", func(c *Config) { c.MQTT.ClientIDSuffix = "hostname" }, false},
+		{"invalid MQTT client ID suffix", func(c *Config) { c.MQTT.ClientIDSuffix = "pid" }, true},
+		{"MQTT call query", func(c *Config) { c.MQTT.CallQuery = true; c.MQTT.CallQueryLimit = 100 }, false},
+		{"MQTT call query without limit", func(c *Config) { c.MQTT.CallQuery = true; c.MQTT.CallQueryLimit = 0 }, true},
+		{"output AMI", func(c *Config) { c.Output.AMIPort = 5038; c.Output.AMIUsername = "crm"; c.Output.AMISecret = "secret" }, false},
+		{"output AMI port out of range", func(c *Config) { c.Output.AMIPort = 70000 }, true},
+		{"output AMI secret without username", func(c *Config) { c.Output.AMIPort = 5038; c.Output.AMISecret = "secret" }, true},
+		{"caldav", func(c *Config) {
+			c.CalDAV.URL = "https://dav.example.com/cal/"
+			c.CalDAV.Timeout = time.Second
+			c.CalDAV.Contacts = []string{"+4930123456=ACME Corp"}
+		}, false},
+		{"caldav URL without scheme", func(c *Config) { c.CalDAV.URL = "dav.example.com/cal"; c.CalDAV.Timeout = time.Second }, true},
+		{"invalid caldav contact", func(c *Config) {
+			c.CalDAV.URL = "https://dav.example.com/cal/"
+			c.CalDAV.Timeout = time.Second
+			c.CalDAV.Contacts = []string{"ACME Corp"}
+		}, true},
+		{"report", func(c *Config) {
+			c.Report.Enabled = true
+			c.Report.Tariffs = []string{"=0.02", "01=0.09"}
+			c.Report.SMTPHost = "mail.example.com"
+			c.Report.MailFrom = "pbx@example.com"
+			c.Report.MailTo = []string{"office@example.com"}
+		}, false},
+		{"invalid report tariff", func(c *Config) { c.Report.Enabled = true; c.Report.Tariffs = []string{"01"} }, true},
+		{"report mail without recipients", func(c *Config) { c.Report.Enabled = true; c.Report.SMTPHost = "mail.example.com" }, true},
+		{"notify", func(c *Config) {
+			c.Notify.TelegramToken = "123:abc"
+			c.Notify.TelegramChatID = "-10042"
+			c.Notify.NtfyTopic = "fritz-calls"
+			c.Notify.VIPs = []string{"+4930123456=Mom"}
+		}, false},
+		{"notify Telegram without chat ID", func(c *Config) { c.Notify.TelegramToken = "123:abc" }, true},
+		{"notify Pushover without user", func(c *Config) { c.Notify.PushoverToken = "app" }, true},
+		{"notify ntfy URL without scheme", func(c *Config) { c.Notify.NtfyTopic = "fritz-calls"; c.Notify.NtfyURL = "ntfy.sh" }, true},
+		{"invalid notify VIP", func(c *Config) { c.Notify.NtfyTopic = "fritz-calls"; c.Notify.VIPs = []string{"Mom"} }, true},
+		{"backup to S3", func(c *Config) { c.Backup.S3Bucket = "backups"; c.Backup.S3Endpoint = "http://minio:9000" }, false},
+		{"backup to WebDAV", func(c *Config) { c.Backup.WebDAVURL = "http://fritz.nas/FRITZ.NAS/backups/" }, false},
+		{"backup to S3 and WebDAV", func(c *Config) { c.Backup.S3Bucket = "backups"; c.Backup.WebDAVURL = "http://fritz.nas/backups/" }, true},
+		{"backup WebDAV URL without scheme", func(c *Config) { c.Backup.WebDAVURL = "fritz.nas/backups" }, true},
+		{"backup of postgres database", func(c *Config) {
+			c.Database.Driver = "postgres"
+			c.Database.DSN = "postgres://fritz@db/fritz"
+			c.Backup.S3Bucket = "backups"
+		}, true},
+		{"negative backup keep", func(c *Config) { c.Backup.S3Bucket = "backups"; c.Backup.Keep = -1 }, true},
+		{"missing backup interval", func(c *Config) { c.Backup.WebDAVURL = "http://fritz.nas/backups/"; c.Backup.Interval = 0 }, true},
+		{"line finish timeouts", func(c *Config) { c.App.FinishTimeout = 0; c.App.LineFinishTimeouts = []string{"0=0", " 3 = 30s"} }, false},
+		{"negative finish timeout", func(c *Config) { c.App.FinishTimeout = -time.Second }, true},
+		{"invalid line finish timeout", func(c *Config) { c.App.LineFinishTimeouts = []string{"SIP0=30s"} }, true},
+		{"timestamp pivot year", func(c *Config) { c.FritzBox.TimestampPivotYear = 1970 }, false},
+		{"two-digit timestamp pivot year", func(c *Config) { c.FritzBox.TimestampPivotYear = 70 }, true},
+		{"missing shutdown timeout", func(c *Config) { c.App.ShutdownTimeout = 0 }, true},
+		{"negative database query timeout", func(c *Config) { c.Database.QueryTimeout = -time.Second }, true},
+		{"negative database health interval", func(c *Config) { c.Database.HealthInterval = -time.Minute }, true},
+		{"postgres database", func(c *Config) { c.Database.Driver = "postgres"; c.Database.DSN = "postgres://fritz@db/fritz" }, !postgresSupported},
+		{"postgres database without DSN", func(c *Config) { c.Database.Driver = "postgres" }, true},
+		{"unknown database driver", func(c *Config) { c.Database.Driver = "mysql" }, true},
+		{"database retention", func(c *Config) { c.Database.RetentionDays = 365; c.Database.ArchiveFormat = "csv" }, false},
+		{"negative database retention days", func(c *Config) { c.Database.RetentionDays = -1 }, true},
+		{"parquet database archive", func(c *Config) { c.Database.RetentionDays = 365; c.Database.ArchiveFormat = "parquet" }, true},
+		{"negative missed call merge window", func(c *Config) { c.App.MissedCallMergeWindow = -time.Minute }, true},
+		{"enrichment hook", func(c *Config) { c.App.EnrichHook = "/usr/local/bin/crm-lookup --json" }, false},
+		{"enrichment hook without timeout", func(c *Config) { c.App.EnrichHook = "http://crm/lookup"; c.App.EnrichTimeout = 0 }, true},
+		{"enrichment hook timeout beyond stall timeout", func(c *Config) {
+			c.App.EnrichHook = "http://crm/lookup"
+			c.App.EnrichTimeout = time.Minute
+			c.App.StallTimeout = 30 * time.Second
+		}, true},
+		{"DND control", func(c *Config) { c.FritzBox.DNDControl = true; c.FritzBox.DNDDeflections = []string{"0", " 2"} }, false},
+		{"invalid DND deflection", func(c *Config) { c.FritzBox.DNDControl = true; c.FritzBox.DNDDeflections = []string{"night"} }, true},
+		{"missing DND refresh interval", func(c *Config) { c.FritzBox.DNDControl = true; c.FritzBox.DNDRefreshInterval = 0 }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := LoadConfig()
+			if err != nil {
+				t.Fatalf("Failed to load config: %v", err)
+			}
+			tt.modify(config)
+
+			err = config.Validate()
+			if tt.expectError && err == nil {
+				t.Error("Expected validation error, but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected validation error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// configFileEnv names the optional file with settings as KEY=VALUE lines
+const configFileEnv = "FRITZ_CALLMONITOR_CONFIG_FILE"
+
+var (
+	fileMu     sync.Mutex        // Serializes LoadConfig, which reads through fileValues
+	fileValues map[string]string // Settings of the config file while LoadConfig runs
+)
+
+// lookupEnv returns a setting from the config file, or from the environment if the file does not set it
+func lookupEnv(key string) string {
+	if value, ok := fileValues[key]; ok {
+		return value
+	}
+	return os.Getenv(key)
+}
+
+// readConfigFile reads settings in the format of systemd environment files and
+// docker --env-file: KEY=VALUE lines, optionally quoted or prefixed with
+// "export"; empty lines and lines starting with # are skipped. An empty path
+// reads nothing.
+func readConfigFile(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid line %d of config file %s, expected KEY=VALUE", number, path)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return values, nil
+}
@@ -0,0 +1,6 @@
+//go:build postgres
+
+package config
+
+// postgresSupported reports whether the PostgreSQL driver is compiled in
+const postgresSupported = true
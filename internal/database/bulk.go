@@ -0,0 +1,283 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// ErrEmptyFilter is returned when a bulk change is requested without any
+// filter; changing all calls has to be asked for with CallFilter.All
+var ErrEmptyFilter = errors.New("filter selects all calls")
+
+// CallFilter selects the calls of a bulk operation. All set fields must match.
+type CallFilter struct {
+	From    time.Time // Calls started at or after From (zero = no lower bound)
+	To      time.Time // Calls started before To (zero = no upper bound)
+	Number  string    // Caller or called number, * matches any digits; without * the number matches anywhere
+	Tag     string    // Calls with this tag
+	Deleted bool      // Select deleted calls instead of the others
+	All     bool      // Allow changing all calls if no other field is set
+}
+
+// IsEmpty reports whether the filter selects all (deleted) calls without All being set
+func (f CallFilter) IsEmpty() bool {
+	return !f.All && f.From.IsZero() && f.To.IsZero() && f.Number == "" && f.Tag == ""
+}
+
+// selection returns the condition selecting the start rows of the calls matching the filter
+func (f CallFilter) selection() (string, []any) {
+	conditions := []string{"event_type IN ('incoming', 'outgoing')", "deleted_at IS NULL"}
+	if f.Deleted {
+		conditions[1] = "deleted_at IS NOT NULL"
+	}
+	var args []any
+	if !f.From.IsZero() {
+		conditions = append(conditions, "timestamp >= ?")
+		args = append(args, f.From.UTC())
+	}
+	if !f.To.IsZero() {
+		conditions = append(conditions, "timestamp < ?")
+		args = append(args, f.To.UTC())
+	}
+	if f.Number != "" {
+		conditions = append(conditions, `(caller LIKE ? ESCAPE '\' OR called LIKE ? ESCAPE '\')`)
+		pattern := likePattern(f.Number)
+		args = append(args, pattern, pattern)
+	}
+	if f.Tag != "" {
+		conditions = append(conditions, "call_id IN (SELECT call_id FROM call_tags WHERE tag = ?)")
+		args = append(args, f.Tag)
+	}
+	return strings.Join(conditions, " AND "), args
+}
+
+// likePattern converts a number pattern with * wildcards into a LIKE pattern
+func likePattern(pattern string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(pattern)
+	if !strings.Contains(pattern, "*") {
+		return "%" + escaped + "%"
+	}
+	return strings.ReplaceAll(escaped, "*", "%")
+}
+
+// CountCalls returns the number of calls matching the filter, e.g. to preview a bulk operation
+func (c *Client) CountCalls(ctx context.Context, filter CallFilter) (int64, error) {
+	if c.db == nil {
+		return 0, fmt.Errorf("database not connected")
+	}
+
+	selection, args := filter.selection()
+	var count int64
+	err := c.db.QueryRowContext(ctx, c.rebind(`SELECT COUNT(DISTINCT call_id) FROM calls WHERE `+selection), args...).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count calls: %w", err)
+	}
+	return count, nil
+}
+
+// DeleteCalls deletes the calls matching the filter like DeleteCall and returns their number.
+// Like all bulk changes it fails with ErrEmptyFilter if the filter is empty.
+func (c *Client) DeleteCalls(ctx context.Context, filter CallFilter) (int64, error) {
+	filter.Deleted = false
+	return c.updateCalls(ctx, filter, "deleted_at = ?", time.Now().UTC())
+}
+
+// RestoreCalls restores the deleted calls matching the filter and returns their number
+func (c *Client) RestoreCalls(ctx context.Context, filter CallFilter) (int64, error) {
+	filter.Deleted = true
+	return c.updateCalls(ctx, filter, "deleted_at = NULL")
+}
+
+// updateCalls sets the assignment on all rows of the calls matching the filter
+func (c *Client) updateCalls(ctx context.Context, filter CallFilter, assignment string, values ...any) (_ int64, err error) {
+	if c.db == nil {
+		return 0, fmt.Errorf("database not connected")
+	}
+	if filter.IsEmpty() {
+		return 0, ErrEmptyFilter
+	}
+
+	defer c.updates.observe(time.Now(), &err)
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	selection, args := filter.selection()
+	var count int64
+	if err := tx.QueryRowContext(ctx, c.rebind(`SELECT COUNT(DISTINCT call_id) FROM calls WHERE `+selection), args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count calls: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, c.rebind(`
+		UPDATE calls SET `+assignment+`, updated_at = CURRENT_TIMESTAMP
+		WHERE call_id IN (SELECT call_id FROM calls WHERE `+selection+`)
+	`), append(values, args...)...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update calls: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit call update: %w", err)
+	}
+	return count, nil
+}
+
+// TagCalls adds the tag to the calls matching the filter and returns the number of newly tagged calls
+func (c *Client) TagCalls(ctx context.Context, filter CallFilter, tag string) (int64, error) {
+	if c.db == nil {
+		return 0, fmt.Errorf("database not connected")
+	}
+	if filter.IsEmpty() {
+		return 0, ErrEmptyFilter
+	}
+	if tag = strings.TrimSpace(tag); tag == "" {
+		return 0, fmt.Errorf("tag cannot be empty")
+	}
+
+	selection, args := filter.selection()
+	result, err := c.db.ExecContext(ctx, c.rebind(`
+		INSERT INTO call_tags (call_id, tag)
+		SELECT DISTINCT call_id, ? FROM calls WHERE `+selection+`
+		ON CONFLICT (call_id, tag) DO NOTHING
+	`), append([]any{tag}, args...)...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to tag calls: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// UntagCalls removes the tag from the calls matching the filter and returns their number
+func (c *Client) UntagCalls(ctx context.Context, filter CallFilter, tag string) (int64, error) {
+	if c.db == nil {
+		return 0, fmt.Errorf("database not connected")
+	}
+	if filter.IsEmpty() {
+		return 0, ErrEmptyFilter
+	}
+
+	tag = strings.TrimSpace(tag)
+	selection, args := filter.selection()
+	result, err := c.db.ExecContext(ctx, c.rebind(`
+		DELETE FROM call_tags
+		WHERE tag = ? AND call_id IN (SELECT call_id FROM calls WHERE `+selection+`)
+	`), append([]any{tag}, args...)...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to untag calls: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// EnrichCalls recomputes the numbers and MSNs of the calls matching the
+// filter with enrich, e.g. after the MSNs or the area code were configured,
+// and returns the number of changed calls. Redacted rows are left as they are.
+func (c *Client) EnrichCalls(ctx context.Context, filter CallFilter, enrich func(event *types.CallEvent)) (_ int64, err error) {
+	if c.db == nil {
+		return 0, fmt.Errorf("database not connected")
+	}
+	if filter.IsEmpty() {
+		return 0, ErrEmptyFilter
+	}
+	defer c.updates.observe(time.Now(), &err)
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	selection, args := filter.selection()
+	rows, err := tx.QueryContext(ctx, c.rebind(`
+		SELECT id, call_id, COALESCE(caller, ''), COALESCE(called, ''), COALESCE(caller_msn, ''), COALESCE(called_msn, '')
+		FROM calls
+		WHERE redacted_at IS NULL AND call_id IN (SELECT call_id FROM calls WHERE `+selection+`)
+	`), args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query calls for enrichment: %w", err)
+	}
+
+	type pendingEnrichment struct {
+		id     int64
+		callID string
+		event  types.CallEvent
+	}
+
+	var pending []pendingEnrichment
+	for rows.Next() {
+		var p pendingEnrichment
+		var stored types.CallEvent
+		if err := rows.Scan(&p.id, &p.callID, &stored.Caller, &stored.Called, &stored.CallerMSN, &stored.CalledMSN); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan call row: %w", err)
+		}
+		p.event = stored
+		enrich(&p.event)
+		if p.event.Caller != stored.Caller || p.event.Called != stored.Called || p.event.CallerMSN != stored.CallerMSN || p.event.CalledMSN != stored.CalledMSN {
+			pending = append(pending, p)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return 0, fmt.Errorf("failed to iterate call rows: %w", err)
+	}
+	rows.Close()
+
+	stmt, err := tx.PrepareContext(ctx, c.rebind(`
+		UPDATE calls
+		SET caller = ?, called = ?, caller_msn = ?, called_msn = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare enrichment statement: %w", err)
+	}
+	defer stmt.Close()
+
+	changed := make(map[string]struct{})
+	for _, p := range pending {
+		e := p.event
+		if _, err := stmt.ExecContext(ctx, nullString(e.Caller), nullString(e.Called), nullString(e.CallerMSN), nullString(e.CalledMSN), p.id); err != nil {
+			return 0, fmt.Errorf("failed to enrich call %s: %w", p.callID, err)
+		}
+		changed[p.callID] = struct{}{}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit enrichment: %w", err)
+	}
+	return int64(len(changed)), nil
+}
+
+// callTags returns the tags of the calls started in [from, to) by call ID
+func (c *Client) callTags(ctx context.Context, from, to time.Time) (map[string][]string, error) {
+	rows, err := c.db.QueryContext(ctx, c.rebind(`
+		SELECT t.call_id, t.tag
+		FROM call_tags t
+		JOIN calls s ON s.call_id = t.call_id AND s.event_type IN ('incoming', 'outgoing')
+		WHERE s.timestamp >= ? AND s.timestamp < ?
+		ORDER BY t.tag
+	`), from.UTC(), to.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query call tags: %w", err)
+	}
+	defer rows.Close()
+
+	tags := make(map[string][]string)
+	for rows.Next() {
+		var callID string
+		var tag string
+		if err := rows.Scan(&callID, &tag); err != nil {
+			return nil, fmt.Errorf("failed to scan call tag: %w", err)
+		}
+		tags[callID] = append(tags[callID], tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read call tags: %w", err)
+	}
+	return tags, nil
+}
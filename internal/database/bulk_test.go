@@ -0,0 +1,154 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+func TestLikePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    string
+	}{
+		{"+4930", "%+4930%"},
+		{"+4930*", "+4930%"},
+		{"*123", "%123"},
+		{"50%_", `%50\%\_%`},
+	}
+
+	for _, tt := range tests {
+		if got := likePattern(tt.pattern); got != tt.want {
+			t.Errorf("likePattern(%q) = %q, want %q", tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestBulkOperations(t *testing.T) {
+	client := newMigratedClient(t)
+	ctx := context.Background()
+
+	start := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	events := []types.CallEvent{
+		{ID: "berlin", Timestamp: start, Type: types.CallTypeRing, Caller: "+4930123456", Called: "111111"},
+		{ID: "berlin", Timestamp: start.Add(time.Minute), Type: types.CallTypeDisconnect},
+		{ID: "mobile", Timestamp: start.Add(time.Hour), Type: types.CallTypeCall, Caller: "111111", Called: "+491701234567"},
+		{ID: "later", Timestamp: start.AddDate(0, 1, 0), Type: types.CallTypeRing, Caller: "+4930654321", Called: "111111"},
+	}
+	if err := client.InsertCalls(ctx, events); err != nil {
+		t.Fatalf("InsertCalls failed: %v", err)
+	}
+	january := CallFilter{From: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)}
+	berlin := CallFilter{Number: "+4930*"}
+
+	for name, tt := range map[string]struct {
+		filter CallFilter
+		want   int64
+	}{
+		"all":     {CallFilter{}, 3},
+		"january": {january, 2},
+		"berlin":  {berlin, 2},
+		"both":    {CallFilter{From: january.From, To: january.To, Number: "+4930*"}, 1},
+		"digits":  {CallFilter{Number: "1234"}, 2},
+	} {
+		count, err := client.CountCalls(ctx, tt.filter)
+		if err != nil {
+			t.Fatalf("CountCalls(%s) failed: %v", name, err)
+		}
+		if count != tt.want {
+			t.Errorf("Expected %d calls for %s, got %d", tt.want, name, count)
+		}
+	}
+
+	tagged, err := client.TagCalls(ctx, berlin, "spam")
+	if err != nil || tagged != 2 {
+		t.Fatalf("Expected 2 tagged calls, got %d: %v", tagged, err)
+	}
+	if tagged, err := client.TagCalls(ctx, berlin, "spam"); err != nil || tagged != 0 {
+		t.Errorf("Expected tagging twice to change nothing, got %d: %v", tagged, err)
+	}
+	if count, err := client.CountCalls(ctx, CallFilter{Tag: "spam"}); err != nil || count != 2 {
+		t.Errorf("Expected 2 calls tagged spam, got %d: %v", count, err)
+	}
+	calls, err := client.ListCalls(ctx, january.From, january.To)
+	if err != nil {
+		t.Fatalf("ListCalls failed: %v", err)
+	}
+	if len(calls) != 2 || !slices.Equal(calls[0].Tags, []string{"spam"}) || calls[1].Tags != nil {
+		t.Errorf("Expected only the Berlin call to be tagged, got %+v", calls)
+	}
+
+	deleted, err := client.DeleteCalls(ctx, CallFilter{Tag: "spam"})
+	if err != nil || deleted != 2 {
+		t.Fatalf("Expected 2 deleted calls, got %d: %v", deleted, err)
+	}
+	if count, err := client.CountCalls(ctx, CallFilter{}); err != nil || count != 1 {
+		t.Errorf("Expected 1 remaining call, got %d: %v", count, err)
+	}
+	restored, err := client.RestoreCalls(ctx, january)
+	if err != nil || restored != 1 {
+		t.Fatalf("Expected 1 restored call, got %d: %v", restored, err)
+	}
+
+	if _, err := client.DeleteCalls(ctx, CallFilter{}); !errors.Is(err, ErrEmptyFilter) {
+		t.Errorf("Expected deleting without a filter to fail with ErrEmptyFilter, got %v", err)
+	}
+	if _, err := client.UntagCalls(ctx, CallFilter{Deleted: true}, "spam"); !errors.Is(err, ErrEmptyFilter) {
+		t.Errorf("Expected untagging without a filter to fail with ErrEmptyFilter, got %v", err)
+	}
+	untagged, err := client.UntagCalls(ctx, CallFilter{Deleted: true, Tag: "spam"}, "spam")
+	if err != nil || untagged != 1 {
+		t.Errorf("Expected the deleted call to be untagged, got %d: %v", untagged, err)
+	}
+}
+
+func TestEnrichCalls(t *testing.T) {
+	client := newMigratedClient(t)
+	ctx := context.Background()
+
+	start := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	events := []types.CallEvent{
+		{ID: "local", Timestamp: start, Type: types.CallTypeRing, Caller: "030123456", Called: "111111"},
+		{ID: "local", Timestamp: start.Add(time.Minute), Type: types.CallTypeDisconnect},
+		{ID: "e164", Timestamp: start.Add(time.Hour), Type: types.CallTypeRing, Caller: "+4930654321", Called: "+4930111111"},
+	}
+	if err := client.InsertCalls(ctx, events); err != nil {
+		t.Fatalf("InsertCalls failed: %v", err)
+	}
+
+	enrich := func(event *types.CallEvent) {
+		for _, number := range []*string{&event.Caller, &event.Called} {
+			if strings.HasPrefix(*number, "0") {
+				*number = "+49" + (*number)[1:]
+			} else if *number != "" && !strings.HasPrefix(*number, "+") {
+				*number = "+4930" + *number
+			}
+		}
+		event.EnrichWithMSNs([]string{"+4930111111"}, nil)
+	}
+	all := CallFilter{All: true}
+	changed, err := client.EnrichCalls(ctx, all, enrich)
+	if err != nil {
+		t.Fatalf("EnrichCalls failed: %v", err)
+	}
+	if changed != 2 {
+		t.Errorf("Expected 2 changed calls, got %d", changed)
+	}
+
+	calls, err := client.ListCalls(ctx, start, start.Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("ListCalls failed: %v", err)
+	}
+	if len(calls) != 2 || calls[0].Caller != "+4930123456" || calls[0].Called != "+4930111111" || calls[0].CalledMSN != "+4930111111" {
+		t.Errorf("Expected the local call to be normalized, got %+v", calls)
+	}
+
+	if changed, err := client.EnrichCalls(ctx, all, enrich); err != nil || changed != 0 {
+		t.Errorf("Expected a second enrichment to change nothing, got %d: %v", changed, err)
+	}
+}
@@ -0,0 +1,394 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// eventTypes maps call types to the event_type values of the calls table
+var eventTypes = map[types.CallType]string{
+	types.CallTypeRing:       "incoming",
+	types.CallTypeCall:       "outgoing",
+	types.CallTypeConnect:    "connect",
+	types.CallTypeDisconnect: "disconnect",
+}
+
+// InsertCall stores a single call event
+func (c *Client) InsertCall(ctx context.Context, event types.CallEvent) error {
+	return c.InsertCalls(ctx, []types.CallEvent{event})
+}
+
+// InsertCalls stores call events in a single transaction. Either all events
+// are stored or none.
+func (c *Client) InsertCalls(ctx context.Context, events []types.CallEvent) (err error) {
+	if c.db == nil {
+		return fmt.Errorf("database not connected")
+	}
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	defer c.inserts.observe(time.Now(), &err)
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, c.rebind(`
+		INSERT INTO calls (call_id, timestamp, event_type, caller, called, caller_msn, called_msn, line, trunk, duration,
+			status_from, status_to, transition_reason, forwarded, parent_call_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`))
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, event := range events {
+		eventType, ok := eventTypes[event.Type]
+		if !ok {
+			return fmt.Errorf("unknown call type '%s' of call %s", event.Type, event.ID)
+		}
+
+		// Only DISCONNECT carries the call duration
+		var duration sql.NullInt64
+		if event.Type == types.CallTypeDisconnect {
+			duration = sql.NullInt64{Int64: int64(event.Duration), Valid: true}
+		}
+		var transition types.Transition
+		if event.Transition != nil {
+			transition = *event.Transition
+		}
+
+		_, err := stmt.ExecContext(ctx,
+			event.ID,
+			event.Timestamp.UTC(),
+			eventType,
+			nullString(event.Caller),
+			nullString(event.Called),
+			nullString(event.CallerMSN),
+			nullString(event.CalledMSN),
+			event.Line,
+			nullString(event.Trunk),
+			duration,
+			nullString(string(transition.From)),
+			nullString(string(transition.To)),
+			nullString(transition.Reason),
+			event.Forwarded,
+			nullString(event.ParentCallID),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert call %s: %w", event.ID, err)
+		}
+
+		// Every event of a call carries its tags, they are stored once
+		for _, tag := range event.Tags {
+			_, err := tx.ExecContext(ctx, c.rebind(`
+				INSERT INTO call_tags (call_id, tag) VALUES (?, ?)
+				ON CONFLICT (call_id, tag) DO NOTHING
+			`), event.ID, tag)
+			if err != nil {
+				return fmt.Errorf("failed to tag call %s: %w", event.ID, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit calls: %w", err)
+	}
+
+	return nil
+}
+
+// FirstCallTime returns the start of the oldest stored call, the zero time if there is none
+func (c *Client) FirstCallTime(ctx context.Context) (time.Time, error) {
+	if c.db == nil {
+		return time.Time{}, fmt.Errorf("database not connected")
+	}
+
+	// ORDER BY instead of MIN, which loses the column type in SQLite
+	var first time.Time
+	err := c.db.QueryRowContext(ctx, `
+		SELECT timestamp FROM calls
+		WHERE event_type IN ('incoming', 'outgoing')
+		ORDER BY timestamp
+		LIMIT 1
+	`).Scan(&first)
+	if errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to query first call: %w", err)
+	}
+	return first, nil
+}
+
+// CallRecord is a call assembled from its start row and, once finished, its disconnect row
+type CallRecord struct {
+	CallID    string
+	Started   time.Time
+	Ended     time.Time // Zero while the call has not been disconnected
+	Direction types.CallDirection
+	Caller    string
+	Called    string
+	CallerMSN string
+	CalledMSN string
+	Line      int
+	Trunk     string
+	Duration  int       // Talk time in seconds, 0 for calls that were not answered
+	DeletedAt time.Time // Zero unless the call was deleted
+	Tags      []string
+	Connected time.Time // Zero unless the call was answered, only set by GetCall
+}
+
+// ListCalls returns the calls started in [from, to), oldest first. Deleted calls are left out.
+func (c *Client) ListCalls(ctx context.Context, from, to time.Time) ([]CallRecord, error) {
+	return c.listCalls(ctx, from, to, false)
+}
+
+// ListDeletedCalls returns the deleted calls started in [from, to), oldest first
+func (c *Client) ListDeletedCalls(ctx context.Context, from, to time.Time) ([]CallRecord, error) {
+	return c.listCalls(ctx, from, to, true)
+}
+
+// listCalls returns either the deleted or the other calls started in [from, to)
+func (c *Client) listCalls(ctx context.Context, from, to time.Time, deleted bool) ([]CallRecord, error) {
+	if c.db == nil {
+		return nil, fmt.Errorf("database not connected")
+	}
+
+	condition := "s.deleted_at IS NULL"
+	if deleted {
+		condition = "s.deleted_at IS NOT NULL"
+	}
+	rows, err := c.db.QueryContext(ctx, c.rebind(`
+		SELECT s.call_id, s.timestamp, s.event_type,
+			COALESCE(s.caller, ''), COALESCE(s.called, ''), COALESCE(s.caller_msn, ''), COALESCE(s.called_msn, ''),
+			COALESCE(s.line, 0), COALESCE(s.trunk, ''), d.timestamp, COALESCE(d.duration, 0), s.deleted_at
+		FROM calls s
+		LEFT JOIN calls d ON d.call_id = s.call_id AND d.event_type = 'disconnect'
+		WHERE s.event_type IN ('incoming', 'outgoing') AND s.timestamp >= ? AND s.timestamp < ? AND `+condition+`
+		ORDER BY s.timestamp, s.id
+	`), from.UTC(), to.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query calls: %w", err)
+	}
+	defer rows.Close()
+
+	var calls []CallRecord
+	for rows.Next() {
+		var call CallRecord
+		var eventType string
+		var ended, deletedAt sql.NullTime
+		if err := rows.Scan(&call.CallID, &call.Started, &eventType, &call.Caller, &call.Called, &call.CallerMSN, &call.CalledMSN,
+			&call.Line, &call.Trunk, &ended, &call.Duration, &deletedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan call: %w", err)
+		}
+		call.Direction = types.CallDirectionInbound
+		if eventType == eventTypes[types.CallTypeCall] {
+			call.Direction = types.CallDirectionOutbound
+		}
+		call.Ended = ended.Time
+		call.DeletedAt = deletedAt.Time
+		calls = append(calls, call)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read calls: %w", err)
+	}
+	rows.Close()
+
+	tags, err := c.callTags(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	for i := range calls {
+		calls[i].Tags = tags[calls[i].CallID]
+	}
+	return calls, nil
+}
+
+// GetCall returns the call with the ID, including a deleted one. It returns
+// ErrNotFound if there is no call with the ID.
+func (c *Client) GetCall(ctx context.Context, callID string) (CallRecord, error) {
+	if c.db == nil {
+		return CallRecord{}, fmt.Errorf("database not connected")
+	}
+
+	call := CallRecord{CallID: callID}
+	var eventType string
+	var ended, deletedAt sql.NullTime
+	err := c.db.QueryRowContext(ctx, c.rebind(`
+		SELECT s.timestamp, s.event_type,
+			COALESCE(s.caller, ''), COALESCE(s.called, ''), COALESCE(s.caller_msn, ''), COALESCE(s.called_msn, ''),
+			COALESCE(s.line, 0), COALESCE(s.trunk, ''), d.timestamp, COALESCE(d.duration, 0), s.deleted_at
+		FROM calls s
+		LEFT JOIN calls d ON d.call_id = s.call_id AND d.event_type = 'disconnect'
+		WHERE s.event_type IN ('incoming', 'outgoing') AND s.call_id = ?
+		ORDER BY s.timestamp
+		LIMIT 1
+	`), callID).Scan(&call.Started, &eventType, &call.Caller, &call.Called, &call.CallerMSN, &call.CalledMSN,
+		&call.Line, &call.Trunk, &ended, &call.Duration, &deletedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return CallRecord{}, fmt.Errorf("call %s: %w", callID, ErrNotFound)
+	}
+	if err != nil {
+		return CallRecord{}, fmt.Errorf("failed to query call %s: %w", callID, err)
+	}
+	call.Direction = types.CallDirectionInbound
+	if eventType == eventTypes[types.CallTypeCall] {
+		call.Direction = types.CallDirectionOutbound
+	}
+	call.Ended = ended.Time
+	call.DeletedAt = deletedAt.Time
+
+	var connected sql.NullTime
+	err = c.db.QueryRowContext(ctx, c.rebind(`
+		SELECT timestamp FROM calls
+		WHERE call_id = ? AND event_type = 'connect'
+		ORDER BY timestamp
+		LIMIT 1
+	`), callID).Scan(&connected)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return CallRecord{}, fmt.Errorf("failed to query connect of call %s: %w", callID, err)
+	}
+	call.Connected = connected.Time
+
+	rows, err := c.db.QueryContext(ctx, c.rebind(`SELECT tag FROM call_tags WHERE call_id = ? ORDER BY tag`), callID)
+	if err != nil {
+		return CallRecord{}, fmt.Errorf("failed to query tags of call %s: %w", callID, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return CallRecord{}, fmt.Errorf("failed to scan call tag: %w", err)
+		}
+		call.Tags = append(call.Tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return CallRecord{}, fmt.Errorf("failed to read call tags: %w", err)
+	}
+	return call, nil
+}
+
+// TimelineEntry is an event of a call with the FSM transition it caused
+type TimelineEntry struct {
+	Timestamp  time.Time
+	Type       types.CallType
+	Line       int
+	Duration   int               // Seconds, only set for disconnect
+	Transition *types.Transition // Nil for events stored before transitions were recorded
+}
+
+// CallTimeline returns the events of the call with the ID in the order they
+// happened, including those of a deleted call. It returns ErrNotFound if
+// there is no call with the ID.
+func (c *Client) CallTimeline(ctx context.Context, callID string) ([]TimelineEntry, error) {
+	if c.db == nil {
+		return nil, fmt.Errorf("database not connected")
+	}
+
+	rows, err := c.db.QueryContext(ctx, c.rebind(`
+		SELECT timestamp, event_type, COALESCE(line, 0), COALESCE(duration, 0),
+			COALESCE(status_from, ''), COALESCE(status_to, ''), COALESCE(transition_reason, '')
+		FROM calls
+		WHERE call_id = ?
+		ORDER BY timestamp, id
+	`), callID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query timeline of call %s: %w", callID, err)
+	}
+	defer rows.Close()
+
+	var timeline []TimelineEntry
+	for rows.Next() {
+		var entry TimelineEntry
+		var eventType, from, to, reason string
+		if err := rows.Scan(&entry.Timestamp, &eventType, &entry.Line, &entry.Duration, &from, &to, &reason); err != nil {
+			return nil, fmt.Errorf("failed to scan call event: %w", err)
+		}
+		for callType, name := range eventTypes {
+			if name == eventType {
+				entry.Type = callType
+			}
+		}
+		if to != "" {
+			entry.Transition = &types.Transition{From: types.CallStatus(from), To: types.CallStatus(to), Reason: reason}
+		}
+		timeline = append(timeline, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read call events: %w", err)
+	}
+	if len(timeline) == 0 {
+		return nil, fmt.Errorf("call %s: %w", callID, ErrNotFound)
+	}
+	return timeline, nil
+}
+
+// AnsweredCall is a call that was connected, assembled from its start and disconnect rows
+type AnsweredCall struct {
+	CallID    string
+	Ended     time.Time
+	Direction types.CallDirection
+	Caller    string
+	Called    string
+	CallerMSN string
+	CalledMSN string
+	Duration  int // Talk time in seconds
+}
+
+// ListAnsweredCalls returns the calls with talk time that ended in [from, to),
+// oldest first. Deleted calls are left out.
+func (c *Client) ListAnsweredCalls(ctx context.Context, from, to time.Time) ([]AnsweredCall, error) {
+	if c.db == nil {
+		return nil, fmt.Errorf("database not connected")
+	}
+
+	// The DISCONNECT row only carries the duration, numbers are stored with the RING or CALL row
+	rows, err := c.db.QueryContext(ctx, c.rebind(`
+		SELECT d.call_id, d.timestamp, s.event_type,
+			COALESCE(s.caller, ''), COALESCE(s.called, ''), COALESCE(s.caller_msn, ''), COALESCE(s.called_msn, ''),
+			d.duration
+		FROM calls d
+		JOIN calls s ON s.call_id = d.call_id AND s.event_type IN ('incoming', 'outgoing')
+		WHERE d.event_type = 'disconnect' AND d.duration > 0 AND d.timestamp >= ? AND d.timestamp < ?
+			AND d.deleted_at IS NULL
+		ORDER BY d.timestamp, d.id
+	`), from.UTC(), to.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to query answered calls: %w", err)
+	}
+	defer rows.Close()
+
+	var calls []AnsweredCall
+	for rows.Next() {
+		var call AnsweredCall
+		var eventType string
+		if err := rows.Scan(&call.CallID, &call.Ended, &eventType, &call.Caller, &call.Called, &call.CallerMSN, &call.CalledMSN, &call.Duration); err != nil {
+			return nil, fmt.Errorf("failed to scan answered call: %w", err)
+		}
+		call.Direction = types.CallDirectionInbound
+		if eventType == eventTypes[types.CallTypeCall] {
+			call.Direction = types.CallDirectionOutbound
+		}
+		calls = append(calls, call)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read answered calls: %w", err)
+	}
+	return calls, nil
+}
+
+// nullString stores empty strings as NULL
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
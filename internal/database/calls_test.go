@@ -0,0 +1,334 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// newMigratedClient creates a connected client with all migrations applied
+func newMigratedClient(t *testing.T) *Client {
+	t.Helper()
+
+	client, err := NewClient(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+
+	if err := client.RunEmbeddedMigrations(context.Background()); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	return client
+}
+
+func TestInsertCalls(t *testing.T) {
+	client := newMigratedClient(t)
+
+	now := time.Now()
+	events := []types.CallEvent{
+		{ID: "call-1", Timestamp: now, Type: types.CallTypeRing, Line: 0, Trunk: "SIP0", Caller: "+4930123456", Called: "+4930990133", CalledMSN: "990133"},
+		{ID: "call-1", Timestamp: now.Add(5 * time.Second), Type: types.CallTypeDisconnect, Line: 0, Duration: 0},
+	}
+	if err := client.InsertCalls(context.Background(), events); err != nil {
+		t.Fatalf("InsertCalls failed: %v", err)
+	}
+
+	rows, err := client.DB().Query("SELECT event_type, caller, called_msn, duration FROM calls WHERE call_id = 'call-1' ORDER BY id")
+	if err != nil {
+		t.Fatalf("Failed to query calls: %v", err)
+	}
+	defer rows.Close()
+
+	type row struct {
+		eventType string
+		caller    sql.NullString
+		calledMSN sql.NullString
+		duration  sql.NullInt64
+	}
+	var got []row
+	for rows.Next() {
+		var r row
+		if err := rows.Scan(&r.eventType, &r.caller, &r.calledMSN, &r.duration); err != nil {
+			t.Fatalf("Failed to scan row: %v", err)
+		}
+		got = append(got, r)
+	}
+
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 rows, got %d", len(got))
+	}
+	if got[0].eventType != "incoming" || got[0].caller.String != "+4930123456" || got[0].calledMSN.String != "990133" {
+		t.Errorf("Unexpected RING row: %+v", got[0])
+	}
+	if got[0].duration.Valid {
+		t.Errorf("Expected no duration for RING, got %d", got[0].duration.Int64)
+	}
+	if got[1].eventType != "disconnect" || !got[1].duration.Valid || got[1].caller.Valid {
+		t.Errorf("Unexpected DISCONNECT row: %+v", got[1])
+	}
+}
+
+func TestInsertCallsStoresTags(t *testing.T) {
+	client := newMigratedClient(t)
+
+	tags := []string{"family", "work"}
+	events := []types.CallEvent{
+		{ID: "call-1", Timestamp: time.Now(), Type: types.CallTypeRing, Tags: tags},
+		{ID: "call-1", Timestamp: time.Now(), Type: types.CallTypeDisconnect, Tags: tags},
+	}
+	if err := client.InsertCalls(context.Background(), events); err != nil {
+		t.Fatalf("InsertCalls failed: %v", err)
+	}
+
+	var count int
+	if err := client.DB().QueryRow("SELECT COUNT(*) FROM call_tags WHERE call_id = 'call-1'").Scan(&count); err != nil {
+		t.Fatalf("Failed to count tags: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected each tag to be stored once, got %d rows", count)
+	}
+}
+
+func TestInsertCallsStoresForwarding(t *testing.T) {
+	client := newMigratedClient(t)
+
+	events := []types.CallEvent{
+		{ID: "call-1", Timestamp: time.Now(), Type: types.CallTypeRing, Caller: "+4930123456"},
+		{ID: "call-2", Timestamp: time.Now(), Type: types.CallTypeCall, Called: "+491784567890", Forwarded: true, ParentCallID: "call-1"},
+	}
+	if err := client.InsertCalls(context.Background(), events); err != nil {
+		t.Fatalf("InsertCalls failed: %v", err)
+	}
+
+	var forwarded bool
+	var parentID sql.NullString
+	if err := client.DB().QueryRow("SELECT forwarded, parent_call_id FROM calls WHERE call_id = 'call-2'").Scan(&forwarded, &parentID); err != nil {
+		t.Fatalf("Failed to query forwarding: %v", err)
+	}
+	if !forwarded || parentID.String != "call-1" {
+		t.Errorf("Expected the forward of call-1, got %t, %+v", forwarded, parentID)
+	}
+	if err := client.DB().QueryRow("SELECT forwarded, parent_call_id FROM calls WHERE call_id = 'call-1'").Scan(&forwarded, &parentID); err != nil {
+		t.Fatalf("Failed to query forwarding: %v", err)
+	}
+	if forwarded || parentID.Valid {
+		t.Errorf("Expected a call that is not forwarded, got %t, %+v", forwarded, parentID)
+	}
+}
+
+func TestInsertCallsIsAtomic(t *testing.T) {
+	client := newMigratedClient(t)
+
+	events := []types.CallEvent{
+		{ID: "call-1", Timestamp: time.Now(), Type: types.CallTypeRing},
+		{ID: "call-2", Timestamp: time.Now(), Type: "bogus"},
+	}
+	if err := client.InsertCalls(context.Background(), events); err == nil {
+		t.Fatal("Expected error for unknown call type")
+	}
+
+	var count int
+	if err := client.DB().QueryRow("SELECT COUNT(*) FROM calls").Scan(&count); err != nil {
+		t.Fatalf("Failed to count calls: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected failed batch to be rolled back, got %d rows", count)
+	}
+}
+
+func TestListAnsweredCalls(t *testing.T) {
+	client := newMigratedClient(t)
+
+	start := time.Date(2025, 9, 30, 23, 50, 0, 0, time.UTC)
+	events := []types.CallEvent{
+		// Answered inbound call in range
+		{ID: "in", Timestamp: start, Type: types.CallTypeRing, Caller: "+4930123456", Called: "990133", CalledMSN: "990133"},
+		{ID: "in", Timestamp: start.Add(5 * time.Second), Type: types.CallTypeConnect},
+		{ID: "in", Timestamp: start.Add(65 * time.Second), Type: types.CallTypeDisconnect, Duration: 60},
+		// Missed call in range
+		{ID: "missed", Timestamp: start, Type: types.CallTypeRing, Caller: "+4930555"},
+		{ID: "missed", Timestamp: start.Add(20 * time.Second), Type: types.CallTypeDisconnect},
+		// Outbound call ending after the range
+		{ID: "out", Timestamp: start, Type: types.CallTypeCall, Caller: "990133", Called: "01701234567", CallerMSN: "990133"},
+		{ID: "out", Timestamp: start.Add(15 * time.Minute), Type: types.CallTypeDisconnect, Duration: 890},
+	}
+	if err := client.InsertCalls(context.Background(), events); err != nil {
+		t.Fatalf("InsertCalls failed: %v", err)
+	}
+
+	calls, err := client.ListAnsweredCalls(context.Background(), time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("ListAnsweredCalls failed: %v", err)
+	}
+	if len(calls) != 1 {
+		t.Fatalf("Expected 1 answered call in September, got %+v", calls)
+	}
+	call := calls[0]
+	if call.CallID != "in" || call.Direction != types.CallDirectionInbound || call.Caller != "+4930123456" || call.CalledMSN != "990133" || call.Duration != 60 {
+		t.Errorf("Unexpected call %+v", call)
+	}
+	if !call.Ended.Equal(start.Add(65 * time.Second)) {
+		t.Errorf("Expected call to end at %v, got %v", start.Add(65*time.Second), call.Ended)
+	}
+
+	calls, err = client.ListAnsweredCalls(context.Background(), time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 11, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("ListAnsweredCalls failed: %v", err)
+	}
+	if len(calls) != 1 || calls[0].Direction != types.CallDirectionOutbound || calls[0].Called != "01701234567" {
+		t.Errorf("Expected outbound call in October, got %+v", calls)
+	}
+}
+
+func TestListCalls(t *testing.T) {
+	client := newMigratedClient(t)
+
+	start := time.Date(2025, 1, 31, 22, 0, 0, 0, time.UTC)
+	events := []types.CallEvent{
+		{ID: "out", Timestamp: start, Type: types.CallTypeCall, Line: 1, Trunk: "SIP0", Caller: "990133", Called: "01701234567", CallerMSN: "990133"},
+		{ID: "out", Timestamp: start.Add(3 * time.Second), Type: types.CallTypeConnect, Line: 1},
+		{ID: "out", Timestamp: start.Add(45 * time.Second), Type: types.CallTypeDisconnect, Line: 1, Duration: 42},
+		{ID: "ringing", Timestamp: start.Add(time.Minute), Type: types.CallTypeRing, Caller: "+4930123456", Called: "990133"},
+		{ID: "later", Timestamp: start.Add(3 * time.Hour), Type: types.CallTypeRing, Caller: "+4930123456"},
+	}
+	if err := client.InsertCalls(context.Background(), events); err != nil {
+		t.Fatalf("InsertCalls failed: %v", err)
+	}
+
+	calls, err := client.ListCalls(context.Background(), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("ListCalls failed: %v", err)
+	}
+	if len(calls) != 2 {
+		t.Fatalf("Expected 2 calls in January, got %+v", calls)
+	}
+
+	out := calls[0]
+	if out.CallID != "out" || out.Direction != types.CallDirectionOutbound || out.Called != "01701234567" || out.Line != 1 || out.Trunk != "SIP0" || out.Duration != 42 {
+		t.Errorf("Unexpected outbound call %+v", out)
+	}
+	if !out.Started.Equal(start) || !out.Ended.Equal(start.Add(45*time.Second)) {
+		t.Errorf("Unexpected call times %v - %v", out.Started, out.Ended)
+	}
+
+	ringing := calls[1]
+	if ringing.Direction != types.CallDirectionInbound || ringing.Caller != "+4930123456" || !ringing.Ended.IsZero() || ringing.Duration != 0 {
+		t.Errorf("Unexpected ringing call %+v", ringing)
+	}
+}
+
+func TestGetCall(t *testing.T) {
+	client := newMigratedClient(t)
+	ctx := context.Background()
+
+	start := time.Date(2025, 1, 31, 22, 0, 0, 0, time.UTC)
+	events := []types.CallEvent{
+		{ID: "in", Timestamp: start, Type: types.CallTypeRing, Line: 2, Caller: "+4930123456", Called: "990133", CalledMSN: "990133", Tags: []string{"work"}},
+		{ID: "in", Timestamp: start.Add(5 * time.Second), Type: types.CallTypeConnect, Line: 2},
+		{ID: "in", Timestamp: start.Add(65 * time.Second), Type: types.CallTypeDisconnect, Line: 2, Duration: 60},
+	}
+	if err := client.InsertCalls(ctx, events); err != nil {
+		t.Fatalf("InsertCalls failed: %v", err)
+	}
+
+	call, err := client.GetCall(ctx, "in")
+	if err != nil {
+		t.Fatalf("GetCall failed: %v", err)
+	}
+	if call.Direction != types.CallDirectionInbound || call.Caller != "+4930123456" || call.CalledMSN != "990133" || call.Line != 2 || call.Duration != 60 {
+		t.Errorf("Unexpected call %+v", call)
+	}
+	if !call.Started.Equal(start) || !call.Connected.Equal(start.Add(5*time.Second)) || !call.Ended.Equal(start.Add(65*time.Second)) {
+		t.Errorf("Unexpected call times %v, %v, %v", call.Started, call.Connected, call.Ended)
+	}
+	if len(call.Tags) != 1 || call.Tags[0] != "work" {
+		t.Errorf("Expected tag work, got %v", call.Tags)
+	}
+
+	if _, err := client.GetCall(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestCallTimeline(t *testing.T) {
+	client := newMigratedClient(t)
+	ctx := context.Background()
+
+	start := time.Date(2025, 1, 31, 22, 0, 0, 0, time.UTC)
+	events := []types.CallEvent{
+		{ID: "out", Timestamp: start, Type: types.CallTypeCall, Line: 1, Called: "+4930123456",
+			Transition: &types.Transition{From: types.CallStatusIdle, To: types.CallStatusCalling, Reason: "outgoing call dialed"}},
+		{ID: "out", Timestamp: start.Add(20 * time.Second), Type: types.CallTypeDisconnect, Line: 1,
+			Transition: &types.Transition{From: types.CallStatusCalling, To: types.CallStatusNotReached, Reason: "disconnected before the callee answered"}},
+		{ID: "old", Timestamp: start, Type: types.CallTypeRing, Line: 2},
+	}
+	if err := client.InsertCalls(ctx, events); err != nil {
+		t.Fatalf("InsertCalls failed: %v", err)
+	}
+
+	timeline, err := client.CallTimeline(ctx, "out")
+	if err != nil {
+		t.Fatalf("CallTimeline failed: %v", err)
+	}
+	if len(timeline) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(timeline))
+	}
+	if timeline[0].Type != types.CallTypeCall || !timeline[0].Timestamp.Equal(start) || *timeline[0].Transition != *events[0].Transition {
+		t.Errorf("Unexpected first event %+v", timeline[0])
+	}
+	if timeline[1].Type != types.CallTypeDisconnect || timeline[1].Transition == nil || timeline[1].Transition.To != types.CallStatusNotReached {
+		t.Errorf("Unexpected last event %+v", timeline[1])
+	}
+
+	// Events stored without transition
+	timeline, err = client.CallTimeline(ctx, "old")
+	if err != nil {
+		t.Fatalf("CallTimeline failed: %v", err)
+	}
+	if len(timeline) != 1 || timeline[0].Transition != nil {
+		t.Errorf("Expected one event without transition, got %+v", timeline)
+	}
+
+	if _, err := client.CallTimeline(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestFirstCallTime(t *testing.T) {
+	client := newMigratedClient(t)
+	ctx := context.Background()
+
+	first, err := client.FirstCallTime(ctx)
+	if err != nil {
+		t.Fatalf("FirstCallTime failed: %v", err)
+	}
+	if !first.IsZero() {
+		t.Errorf("Expected zero time without calls, got %v", first)
+	}
+
+	start := time.Date(2025, 9, 21, 15, 30, 0, 0, time.UTC)
+	err = client.InsertCalls(ctx, []types.CallEvent{
+		{ID: "call-2", Timestamp: start.Add(time.Hour), Type: types.CallTypeCall},
+		{ID: "call-1", Timestamp: start, Type: types.CallTypeRing},
+		{ID: "call-0", Timestamp: start.Add(-time.Hour), Type: types.CallTypeDisconnect},
+	})
+	if err != nil {
+		t.Fatalf("InsertCalls failed: %v", err)
+	}
+
+	first, err = client.FirstCallTime(ctx)
+	if err != nil {
+		t.Fatalf("FirstCallTime failed: %v", err)
+	}
+	if !first.Equal(start) {
+		t.Errorf("Expected %v, got %v", start, first)
+	}
+}
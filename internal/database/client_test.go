@@ -1,8 +1,12 @@
 package database
 
 import (
+	"context"
+	"database/sql"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -47,7 +51,7 @@ func TestClientConnectAndClose(t *testing.T) {
 	}
 
 	// Test connection
-	if err := client.Connect(); err != nil {
+	if err := client.Connect(context.Background()); err != nil {
 		t.Fatalf("Failed to connect: %v", err)
 	}
 
@@ -76,13 +80,13 @@ func TestClientMigrations(t *testing.T) {
 		t.Fatalf("Failed to create client: %v", err)
 	}
 
-	if err := client.Connect(); err != nil {
+	if err := client.Connect(context.Background()); err != nil {
 		t.Fatalf("Failed to connect: %v", err)
 	}
 	defer client.Close()
 
 	// Test embedded migrations
-	if err := client.RunEmbeddedMigrations(); err != nil {
+	if err := client.RunEmbeddedMigrations(context.Background()); err != nil {
 		t.Errorf("Failed to run embedded migrations: %v", err)
 	}
 
@@ -121,7 +125,7 @@ func TestGetMigrator(t *testing.T) {
 		t.Fatalf("Failed to create client: %v", err)
 	}
 
-	if err := client.Connect(); err != nil {
+	if err := client.Connect(context.Background()); err != nil {
 		t.Fatalf("Failed to connect: %v", err)
 	}
 	defer client.Close()
@@ -131,3 +135,24 @@ func TestGetMigrator(t *testing.T) {
 		t.Error("Migrator is nil")
 	}
 }
+
+func TestNewPostgresClient(t *testing.T) {
+	if _, err := NewPostgresClient(""); err == nil {
+		t.Error("Expected error for empty connection string")
+	}
+
+	client, err := NewPostgresClient("postgres://fritz@localhost/fritz")
+	if err != nil {
+		t.Fatalf("NewPostgresClient failed: %v", err)
+	}
+	if client.Driver() != DriverPostgres || client.GetDatabasePath() != "" {
+		t.Errorf("Expected PostgreSQL client without database file, got %s at %q", client.Driver(), client.GetDatabasePath())
+	}
+
+	// Default builds do not include the PostgreSQL driver
+	if !slices.Contains(sql.Drivers(), postgresDriverName) {
+		if err := client.Connect(context.Background()); err == nil || !strings.Contains(err.Error(), "-tags postgres") {
+			t.Errorf("Expected hint to build with the postgres tag, got %v", err)
+		}
+	}
+}
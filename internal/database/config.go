@@ -0,0 +1,182 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// lineSequenceKey is the config key prefix of the publish sequence numbers per line
+const lineSequenceKey = "mqtt.line_sequence."
+
+// pendingAckKey is the config key prefix of the missed calls waiting for an acknowledgement
+const pendingAckKey = "mqtt.missed_call_ack."
+
+// activeCallsKey is the config key of the calls active when the bridge stopped
+const activeCallsKey = "callmonitor.active_calls"
+
+// GetConfig returns the value stored under key or ErrNotFound
+func (c *Client) GetConfig(ctx context.Context, key string) (string, error) {
+	if c.db == nil {
+		return "", fmt.Errorf("database not connected")
+	}
+
+	var value sql.NullString
+	err := c.db.QueryRowContext(ctx, c.rebind(`SELECT value FROM config WHERE key = ?`), key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("config %s: %w", key, ErrNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read config %s: %w", key, err)
+	}
+	return value.String, nil
+}
+
+// SetConfig stores value under key, replacing a previous value
+func (c *Client) SetConfig(ctx context.Context, key, value string) error {
+	if c.db == nil {
+		return fmt.Errorf("database not connected")
+	}
+
+	_, err := c.db.ExecContext(ctx, c.rebind(`
+		INSERT INTO config (key, value) VALUES (?, ?)
+		ON CONFLICT (key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP
+	`), key, value)
+	if err != nil {
+		return fmt.Errorf("failed to write config %s: %w", key, err)
+	}
+	return nil
+}
+
+// DeleteConfig removes the value stored under key; a missing key is not an error
+func (c *Client) DeleteConfig(ctx context.Context, key string) error {
+	if c.db == nil {
+		return fmt.Errorf("database not connected")
+	}
+
+	if _, err := c.db.ExecContext(ctx, c.rebind(`DELETE FROM config WHERE key = ?`), key); err != nil {
+		return fmt.Errorf("failed to delete config %s: %w", key, err)
+	}
+	return nil
+}
+
+// LineSequences returns the last publish sequence number of each line by line
+// key. Numbers saved by line number only, before trunks were told apart, are skipped.
+func (c *Client) LineSequences(ctx context.Context) (map[string]uint64, error) {
+	if c.db == nil {
+		return nil, fmt.Errorf("database not connected")
+	}
+
+	rows, err := c.db.QueryContext(ctx, c.rebind(`SELECT key, value FROM config WHERE key LIKE ?`), lineSequenceKey+"%")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query line sequences: %w", err)
+	}
+	defer rows.Close()
+
+	sequences := make(map[string]uint64)
+	for rows.Next() {
+		var key string
+		var value sql.NullString
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan line sequence: %w", err)
+		}
+		lineKey := strings.TrimPrefix(key, lineSequenceKey)
+		if _, err := strconv.Atoi(lineKey); err == nil {
+			continue
+		}
+		sequence, err := strconv.ParseUint(value.String, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sequence %q of line %s: %w", value.String, lineKey, err)
+		}
+		sequences[lineKey] = sequence
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read line sequences: %w", err)
+	}
+	return sequences, nil
+}
+
+// SaveLineSequence stores the last publish sequence number of a line
+func (c *Client) SaveLineSequence(ctx context.Context, lineKey string, sequence uint64) error {
+	return c.SetConfig(ctx, lineSequenceKey+lineKey, strconv.FormatUint(sequence, 10))
+}
+
+// PendingAcks returns the missed calls waiting for an acknowledgement
+func (c *Client) PendingAcks(ctx context.Context) ([]types.PendingAck, error) {
+	if c.db == nil {
+		return nil, fmt.Errorf("database not connected")
+	}
+
+	rows, err := c.db.QueryContext(ctx, c.rebind(`SELECT key, value FROM config WHERE key LIKE ? ORDER BY key`), pendingAckKey+"%")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending acknowledgements: %w", err)
+	}
+	defer rows.Close()
+
+	var acks []types.PendingAck
+	for rows.Next() {
+		var key string
+		var value sql.NullString
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan pending acknowledgement: %w", err)
+		}
+		var ack types.PendingAck
+		if err := json.Unmarshal([]byte(value.String), &ack); err != nil {
+			return nil, fmt.Errorf("invalid pending acknowledgement %s: %w", key, err)
+		}
+		acks = append(acks, ack)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read pending acknowledgements: %w", err)
+	}
+	return acks, nil
+}
+
+// SavePendingAck stores a missed call waiting for an acknowledgement
+func (c *Client) SavePendingAck(ctx context.Context, ack types.PendingAck) error {
+	value, err := json.Marshal(ack)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pending acknowledgement: %w", err)
+	}
+	return c.SetConfig(ctx, pendingAckKey+ack.Call.ID, string(value))
+}
+
+// DeletePendingAck removes the acknowledgement of a missed call that was acknowledged or escalated
+func (c *Client) DeletePendingAck(ctx context.Context, callID string) error {
+	return c.DeleteConfig(ctx, pendingAckKey+callID)
+}
+
+// ActiveCalls returns the calls that were active when the bridge stopped
+func (c *Client) ActiveCalls(ctx context.Context) ([]types.ActiveCall, error) {
+	value, err := c.GetConfig(ctx, activeCallsKey)
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var calls []types.ActiveCall
+	if err := json.Unmarshal([]byte(value), &calls); err != nil {
+		return nil, fmt.Errorf("invalid active calls: %w", err)
+	}
+	return calls, nil
+}
+
+// SaveActiveCalls replaces the stored active calls
+func (c *Client) SaveActiveCalls(ctx context.Context, calls []types.ActiveCall) error {
+	if len(calls) == 0 {
+		return c.DeleteConfig(ctx, activeCallsKey)
+	}
+	value, err := json.Marshal(calls)
+	if err != nil {
+		return fmt.Errorf("failed to marshal active calls: %w", err)
+	}
+	return c.SetConfig(ctx, activeCallsKey, string(value))
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+func TestConfig(t *testing.T) {
+	client := newMigratedClient(t)
+	ctx := context.Background()
+
+	if _, err := client.GetConfig(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	for _, value := range []string{"first", "second"} {
+		if err := client.SetConfig(ctx, "key", value); err != nil {
+			t.Fatalf("SetConfig failed: %v", err)
+		}
+		got, err := client.GetConfig(ctx, "key")
+		if err != nil {
+			t.Fatalf("GetConfig failed: %v", err)
+		}
+		if got != value {
+			t.Errorf("Expected %q, got %q", value, got)
+		}
+	}
+}
+
+func TestLineSequences(t *testing.T) {
+	client := newMigratedClient(t)
+	ctx := context.Background()
+
+	for lineKey, sequence := range map[string]uint64{"SIP0_0": 7, "SIP1_0": 2, "SIP0_3": 1} {
+		if err := client.SaveLineSequence(ctx, lineKey, sequence); err != nil {
+			t.Fatalf("SaveLineSequence failed: %v", err)
+		}
+	}
+	if err := client.SaveLineSequence(ctx, "SIP0_0", 8); err != nil {
+		t.Fatalf("SaveLineSequence failed: %v", err)
+	}
+	// Unrelated keys and numbers saved by line number only are skipped
+	for key, value := range map[string]string{"other": "x", lineSequenceKey + "1": "5"} {
+		if err := client.SetConfig(ctx, key, value); err != nil {
+			t.Fatalf("SetConfig failed: %v", err)
+		}
+	}
+
+	sequences, err := client.LineSequences(ctx)
+	if err != nil {
+		t.Fatalf("LineSequences failed: %v", err)
+	}
+	if len(sequences) != 3 || sequences["SIP0_0"] != 8 || sequences["SIP1_0"] != 2 || sequences["SIP0_3"] != 1 {
+		t.Errorf("Unexpected sequences: %v", sequences)
+	}
+}
+
+func TestPendingAcks(t *testing.T) {
+	client := newMigratedClient(t)
+	ctx := context.Background()
+
+	deadline := time.Date(2025, 9, 21, 15, 40, 0, 0, time.UTC)
+	for _, id := range []string{"acked", "pending"} {
+		ack := types.PendingAck{Call: types.MissedCall{ID: id, Attempts: 1}, Deadline: deadline}
+		if err := client.SavePendingAck(ctx, ack); err != nil {
+			t.Fatalf("SavePendingAck failed: %v", err)
+		}
+	}
+	if err := client.DeletePendingAck(ctx, "acked"); err != nil {
+		t.Fatalf("DeletePendingAck failed: %v", err)
+	}
+	if err := client.DeletePendingAck(ctx, "unknown"); err != nil {
+		t.Errorf("Expected deleting an unknown acknowledgement to succeed, got %v", err)
+	}
+
+	acks, err := client.PendingAcks(ctx)
+	if err != nil {
+		t.Fatalf("PendingAcks failed: %v", err)
+	}
+	if len(acks) != 1 || acks[0].Call.ID != "pending" || !acks[0].Deadline.Equal(deadline) {
+		t.Errorf("Unexpected pending acknowledgements: %+v", acks)
+	}
+}
+
+func TestActiveCalls(t *testing.T) {
+	client := newMigratedClient(t)
+	ctx := context.Background()
+
+	calls, err := client.ActiveCalls(ctx)
+	if err != nil || len(calls) != 0 {
+		t.Fatalf("Expected no active calls initially, got %+v (%v)", calls, err)
+	}
+
+	connected := time.Date(2025, 9, 21, 15, 40, 7, 0, time.UTC)
+	saved := []types.ActiveCall{{ID: "call", Line: 2, Started: connected.Add(-7 * time.Second), Trunk: "SIP0", ConnectedAt: &connected, RingGroup: []int{0, 2}}}
+	if err := client.SaveActiveCalls(ctx, saved); err != nil {
+		t.Fatalf("SaveActiveCalls failed: %v", err)
+	}
+	calls, err = client.ActiveCalls(ctx)
+	if err != nil {
+		t.Fatalf("ActiveCalls failed: %v", err)
+	}
+	if len(calls) != 1 || calls[0].ID != "call" || calls[0].ConnectedAt == nil || !calls[0].ConnectedAt.Equal(connected) || len(calls[0].RingGroup) != 2 {
+		t.Errorf("Unexpected active calls: %+v", calls)
+	}
+
+	if err := client.SaveActiveCalls(ctx, nil); err != nil {
+		t.Fatalf("SaveActiveCalls failed: %v", err)
+	}
+	if calls, err := client.ActiveCalls(ctx); err != nil || len(calls) != 0 {
+		t.Errorf("Expected no active calls after all ended, got %+v (%v)", calls, err)
+	}
+}
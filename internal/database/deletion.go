@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DeleteCall marks all rows of the call as deleted, so it is left out of
+// listings and reports until it is restored. It returns ErrNotFound if there
+// is no call with the ID that is not deleted yet.
+func (c *Client) DeleteCall(ctx context.Context, callID string) (err error) {
+	if c.db == nil {
+		return fmt.Errorf("database not connected")
+	}
+
+	defer c.updates.observe(time.Now(), &err)
+
+	result, err := c.db.ExecContext(ctx, c.rebind(`
+		UPDATE calls SET deleted_at = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE call_id = ? AND deleted_at IS NULL
+	`), time.Now().UTC(), callID)
+	if err != nil {
+		return fmt.Errorf("failed to delete call %s: %w", callID, err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("call %s: %w", callID, ErrNotFound)
+	}
+	return nil
+}
+
+// RestoreCall undoes DeleteCall. It returns ErrNotFound if there is no deleted call with the ID.
+func (c *Client) RestoreCall(ctx context.Context, callID string) (err error) {
+	if c.db == nil {
+		return fmt.Errorf("database not connected")
+	}
+
+	defer c.updates.observe(time.Now(), &err)
+
+	result, err := c.db.ExecContext(ctx, c.rebind(`
+		UPDATE calls SET deleted_at = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE call_id = ? AND deleted_at IS NOT NULL
+	`), callID)
+	if err != nil {
+		return fmt.Errorf("failed to restore call %s: %w", callID, err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("deleted call %s: %w", callID, ErrNotFound)
+	}
+	return nil
+}
+
+// PurgeCallsBefore removes all rows and tags of the calls started before the
+// cutoff for good, deleted calls included, and returns the number of calls
+func (c *Client) PurgeCallsBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	if c.db == nil {
+		return 0, fmt.Errorf("database not connected")
+	}
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	const started = `SELECT call_id FROM calls WHERE event_type IN ('incoming', 'outgoing') AND timestamp < ?`
+	var count int64
+	if err := tx.QueryRowContext(ctx, c.rebind(`SELECT COUNT(*) FROM (`+started+`) s`), cutoff.UTC()).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count calls: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, c.rebind(`DELETE FROM call_tags WHERE call_id IN (`+started+`)`), cutoff.UTC()); err != nil {
+		return 0, fmt.Errorf("failed to purge call tags: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, c.rebind(`DELETE FROM calls WHERE call_id IN (`+started+`)`), cutoff.UTC()); err != nil {
+		return 0, fmt.Errorf("failed to purge calls: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit call purge: %w", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+func TestDeleteAndRestoreCall(t *testing.T) {
+	client := newMigratedClient(t)
+	ctx := context.Background()
+
+	start := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	events := []types.CallEvent{
+		{ID: "kept", Timestamp: start, Type: types.CallTypeRing, Caller: "+4930123456"},
+		{ID: "deleted", Timestamp: start.Add(time.Minute), Type: types.CallTypeCall, Called: "01701234567"},
+		{ID: "deleted", Timestamp: start.Add(time.Minute + 3*time.Second), Type: types.CallTypeConnect},
+		{ID: "deleted", Timestamp: start.Add(2 * time.Minute), Type: types.CallTypeDisconnect, Duration: 57},
+	}
+	if err := client.InsertCalls(ctx, events); err != nil {
+		t.Fatalf("InsertCalls failed: %v", err)
+	}
+	from, to := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	if err := client.DeleteCall(ctx, "deleted"); err != nil {
+		t.Fatalf("DeleteCall failed: %v", err)
+	}
+	if err := client.DeleteCall(ctx, "deleted"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound deleting twice, got %v", err)
+	}
+
+	calls, err := client.ListCalls(ctx, from, to)
+	if err != nil {
+		t.Fatalf("ListCalls failed: %v", err)
+	}
+	if len(calls) != 1 || calls[0].CallID != "kept" {
+		t.Errorf("Expected only the kept call, got %+v", calls)
+	}
+	answered, err := client.ListAnsweredCalls(ctx, from, to)
+	if err != nil {
+		t.Fatalf("ListAnsweredCalls failed: %v", err)
+	}
+	if len(answered) != 0 {
+		t.Errorf("Expected the deleted call to be left out of the answered calls, got %+v", answered)
+	}
+	deleted, err := client.ListDeletedCalls(ctx, from, to)
+	if err != nil {
+		t.Fatalf("ListDeletedCalls failed: %v", err)
+	}
+	if len(deleted) != 1 || deleted[0].CallID != "deleted" || deleted[0].DeletedAt.IsZero() || deleted[0].Duration != 57 {
+		t.Errorf("Expected the deleted call with its deletion time, got %+v", deleted)
+	}
+
+	if err := client.RestoreCall(ctx, "deleted"); err != nil {
+		t.Fatalf("RestoreCall failed: %v", err)
+	}
+	if err := client.RestoreCall(ctx, "kept"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound restoring a call that is not deleted, got %v", err)
+	}
+	calls, err = client.ListCalls(ctx, from, to)
+	if err != nil {
+		t.Fatalf("ListCalls failed: %v", err)
+	}
+	if len(calls) != 2 || !calls[1].DeletedAt.IsZero() {
+		t.Errorf("Expected both calls after restoring, got %+v", calls)
+	}
+}
+
+func TestPurgeCallsBefore(t *testing.T) {
+	client := newMigratedClient(t)
+	ctx := context.Background()
+
+	cutoff := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	events := []types.CallEvent{
+		{ID: "old", Timestamp: cutoff.Add(-time.Hour), Type: types.CallTypeRing, Tags: []string{"family"}},
+		{ID: "old", Timestamp: cutoff.Add(time.Minute), Type: types.CallTypeDisconnect, Tags: []string{"family"}},
+		{ID: "old-deleted", Timestamp: cutoff.AddDate(0, -1, 0), Type: types.CallTypeCall},
+		{ID: "new", Timestamp: cutoff, Type: types.CallTypeRing, Tags: []string{"work"}},
+	}
+	if err := client.InsertCalls(ctx, events); err != nil {
+		t.Fatalf("InsertCalls failed: %v", err)
+	}
+	if err := client.DeleteCall(ctx, "old-deleted"); err != nil {
+		t.Fatalf("DeleteCall failed: %v", err)
+	}
+
+	count, err := client.PurgeCallsBefore(ctx, cutoff)
+	if err != nil {
+		t.Fatalf("PurgeCallsBefore failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 purged calls, got %d", count)
+	}
+
+	var rows, tags int
+	if err := client.DB().QueryRow("SELECT COUNT(*) FROM calls WHERE call_id <> 'new'").Scan(&rows); err != nil {
+		t.Fatalf("Failed to count calls: %v", err)
+	}
+	if err := client.DB().QueryRow("SELECT COUNT(*) FROM call_tags").Scan(&tags); err != nil {
+		t.Fatalf("Failed to count tags: %v", err)
+	}
+	if rows != 0 || tags != 1 {
+		t.Errorf("Expected only the new call and its tag to remain, got %d old rows and %d tags", rows, tags)
+	}
+}
@@ -0,0 +1,35 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Supported database drivers
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
+// postgresDriverName is the database/sql driver registered by builds with the postgres tag
+const postgresDriverName = "pgx"
+
+// rebind rewrites the ? placeholders of a query to the $1, $2, ... form
+// PostgreSQL expects. Queries of this package contain no literal question marks.
+func rebind(driver, query string) string {
+	if driver != DriverPostgres || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+	return b.String()
+}
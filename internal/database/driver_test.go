@@ -0,0 +1,24 @@
+package database
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		name     string
+		driver   string
+		query    string
+		expected string
+	}{
+		{"sqlite keeps placeholders", DriverSQLite, "SELECT * FROM calls WHERE id = ? AND line = ?", "SELECT * FROM calls WHERE id = ? AND line = ?"},
+		{"postgres numbers placeholders", DriverPostgres, "UPDATE calls SET caller = ?, called = ? WHERE id = ?", "UPDATE calls SET caller = $1, called = $2 WHERE id = $3"},
+		{"postgres without placeholders", DriverPostgres, "SELECT 1", "SELECT 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rebind(tt.driver, tt.query); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
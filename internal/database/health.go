@@ -0,0 +1,131 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// healthTables are the tables whose rows are counted by Health
+var healthTables = []string{"calls", "call_tags", "unparsed_lines", "notification_rules", "config"}
+
+// Health is a snapshot of the size and performance of the database, so
+// operators notice runaway growth before the disk fills
+type Health struct {
+	Driver           string           `json:"driver"`
+	FileSizeBytes    int64            `json:"file_size_bytes"`   // Database file, or the whole database for PostgreSQL
+	WALSizeBytes     int64            `json:"wal_size_bytes"`    // Write-ahead log of SQLite, 0 for PostgreSQL
+	Rows             map[string]int64 `json:"rows"`              // Rows by table, deleted calls included
+	MigrationVersion int              `json:"migration_version"` // Latest applied migration
+	Inserts          LatencyStats     `json:"inserts"`           // Inserts of call events and unparsed lines
+	Updates          LatencyStats     `json:"updates"`           // Deletions, restores, redactions and bulk changes of calls
+	CollectedAt      time.Time        `json:"collected_at"`
+}
+
+// LatencyStats are the durations of the writes of one kind since the start
+type LatencyStats struct {
+	Count       uint64  `json:"count"`
+	Failed      uint64  `json:"failed"`
+	LastSeconds float64 `json:"last_seconds"`
+	AvgSeconds  float64 `json:"avg_seconds"`
+	MaxSeconds  float64 `json:"max_seconds"`
+}
+
+// latency records the durations of the writes of one kind
+type latency struct {
+	mu     sync.Mutex
+	count  uint64
+	failed uint64
+	total  time.Duration
+	last   time.Duration
+	max    time.Duration
+}
+
+// observe records a write that started at start and ended with *err; it is
+// meant to be deferred. Writes of rows that do not exist do not count as failed.
+func (l *latency) observe(start time.Time, err *error) {
+	elapsed := time.Since(start)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.count++
+	if *err != nil && !errors.Is(*err, ErrNotFound) {
+		l.failed++
+	}
+	l.total += elapsed
+	l.last = elapsed
+	l.max = max(l.max, elapsed)
+}
+
+// stats returns a snapshot of the recorded durations
+func (l *latency) stats() LatencyStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := LatencyStats{Count: l.count, Failed: l.failed, LastSeconds: l.last.Seconds(), MaxSeconds: l.max.Seconds()}
+	if l.count > 0 {
+		stats.AvgSeconds = (l.total / time.Duration(l.count)).Seconds()
+	}
+	return stats
+}
+
+// Health collects the size, row counts and write latencies of the database.
+// Counting rows reads the whole tables, so it is meant to run every few
+// minutes rather than on every health check.
+func (c *Client) Health(ctx context.Context) (Health, error) {
+	if c.db == nil {
+		return Health{}, fmt.Errorf("database not connected")
+	}
+
+	health := Health{
+		Driver:      c.driver,
+		Rows:        make(map[string]int64, len(healthTables)),
+		Inserts:     c.inserts.stats(),
+		Updates:     c.updates.stats(),
+		CollectedAt: time.Now(),
+	}
+	if c.driver == DriverPostgres {
+		if err := c.db.QueryRowContext(ctx, "SELECT pg_database_size(current_database())").Scan(&health.FileSizeBytes); err != nil {
+			return Health{}, fmt.Errorf("failed to query database size: %w", err)
+		}
+	} else {
+		var err error
+		if health.FileSizeBytes, err = fileSize(c.databasePath); err != nil {
+			return Health{}, err
+		}
+		if health.WALSizeBytes, err = fileSize(c.databasePath + "-wal"); err != nil {
+			return Health{}, err
+		}
+	}
+
+	for _, table := range healthTables {
+		var rows int64
+		if err := c.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table).Scan(&rows); err != nil {
+			return Health{}, fmt.Errorf("failed to count rows of %s: %w", table, err)
+		}
+		health.Rows[table] = rows
+	}
+
+	if c.migrator != nil {
+		version, err := c.migrator.GetCurrentVersion(ctx)
+		if err != nil {
+			return Health{}, err
+		}
+		health.MigrationVersion = version
+	}
+	return health, nil
+}
+
+// fileSize returns the size of a file, 0 if it does not exist, e.g. a WAL after a checkpoint
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat database file: %w", err)
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+func TestHealth(t *testing.T) {
+	client := newMigratedClient(t)
+	ctx := context.Background()
+
+	events := []types.CallEvent{
+		{ID: "call-1", Timestamp: time.Now(), Type: types.CallTypeRing, Caller: "+4930123456", Called: "990133", Tags: []string{"work"}},
+		{ID: "call-1", Timestamp: time.Now(), Type: types.CallTypeDisconnect},
+	}
+	if err := client.InsertCalls(ctx, events); err != nil {
+		t.Fatalf("InsertCalls failed: %v", err)
+	}
+	if err := client.DeleteCall(ctx, "call-1"); err != nil {
+		t.Fatalf("DeleteCall failed: %v", err)
+	}
+	if err := client.RestoreCall(ctx, "call-1"); err != nil {
+		t.Fatalf("RestoreCall failed: %v", err)
+	}
+	if err := client.RestoreCall(ctx, "call-1"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+
+	health, err := client.Health(ctx)
+	if err != nil {
+		t.Fatalf("Health failed: %v", err)
+	}
+	if health.Driver != DriverSQLite || health.FileSizeBytes <= 0 {
+		t.Errorf("Expected the size of the SQLite file, got %+v", health)
+	}
+	if health.Rows["calls"] != 2 || health.Rows["call_tags"] != 1 || health.Rows["unparsed_lines"] != 0 {
+		t.Errorf("Expected 2 call rows and 1 tag, got %v", health.Rows)
+	}
+	if health.MigrationVersion == 0 {
+		t.Error("Expected the migration version")
+	}
+	if health.Inserts.Count != 1 || health.Inserts.Failed != 0 || health.Inserts.MaxSeconds <= 0 {
+		t.Errorf("Expected 1 insert, got %+v", health.Inserts)
+	}
+	// The restore of a call that is not deleted does not count as failed
+	if health.Updates.Count != 3 || health.Updates.Failed != 0 {
+		t.Errorf("Expected 3 updates without failure, got %+v", health.Updates)
+	}
+}
@@ -66,8 +66,146 @@ CREATE INDEX IF NOT EXISTS idx_calls_called_msn ON calls(called_msn);`,
 DROP INDEX IF EXISTS idx_calls_called_msn;
 DROP INDEX IF EXISTS idx_calls_caller_msn;
 
--- Note: SQLite doesn't support DROP COLUMN, so we can't easily remove the columns
--- In a real rollback scenario, you'd need to recreate the table without these columns`,
+-- Remove columns, supported since SQLite 3.35
+ALTER TABLE calls DROP COLUMN called_msn;
+ALTER TABLE calls DROP COLUMN caller_msn;`,
+		},
+		{
+			Version:     3,
+			Name:        "add_redaction_marker",
+			Description: "Add redacted_at column to calls table to track at-rest redaction of phone numbers",
+			UpSQL: `-- Add redacted_at column to calls table
+ALTER TABLE calls ADD COLUMN redacted_at DATETIME;
+
+-- Index for faster lookups of rows that still need redaction
+CREATE INDEX IF NOT EXISTS idx_calls_redacted_at ON calls(redacted_at);`,
+			DownSQL: `-- Remove index
+DROP INDEX IF EXISTS idx_calls_redacted_at;
+
+-- Remove column, supported since SQLite 3.35
+ALTER TABLE calls DROP COLUMN redacted_at;`,
+		},
+		{
+			Version:     4,
+			Name:        "add_notification_rules",
+			Description: "Add notification_rules table for per-recipient notification rules and schedules",
+			UpSQL: `-- Table for storing notification rules
+CREATE TABLE IF NOT EXISTS notification_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    recipient TEXT NOT NULL,
+    msn TEXT, -- NULL matches all MSNs
+    directions TEXT, -- Comma separated, NULL matches all directions
+    finish_states TEXT, -- Comma separated, NULL matches all finish states
+    days TEXT, -- Comma separated weekdays (mon..sun), NULL matches every day
+    start_time TEXT, -- HH:MM, NULL together with end_time matches the whole day
+    end_time TEXT,
+    enabled INTEGER NOT NULL DEFAULT 1,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);`,
+			DownSQL: `DROP TABLE IF EXISTS notification_rules;`,
+		},
+		{
+			Version:     5,
+			Name:        "add_unparsed_lines",
+			Description: "Add unparsed_lines table keeping callmonitor lines that could not be parsed",
+			UpSQL: `-- Table for storing unparsable callmonitor lines
+CREATE TABLE IF NOT EXISTS unparsed_lines (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    line TEXT NOT NULL,
+    reason TEXT,
+    received_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);`,
+			DownSQL: `DROP TABLE IF EXISTS unparsed_lines;`,
+		},
+		{
+			Version:     6,
+			Name:        "add_soft_delete",
+			Description: "Add deleted_at column to calls table so deleted calls can be restored",
+			UpSQL: `-- Add deleted_at column to calls table
+ALTER TABLE calls ADD COLUMN deleted_at DATETIME;
+
+-- Index for excluding deleted calls
+CREATE INDEX IF NOT EXISTS idx_calls_deleted_at ON calls(deleted_at);`,
+			DownSQL: `-- Remove index
+DROP INDEX IF EXISTS idx_calls_deleted_at;
+
+-- Remove column, supported since SQLite 3.35
+ALTER TABLE calls DROP COLUMN deleted_at;`,
+		},
+		{
+			Version:     7,
+			Name:        "add_call_tags",
+			Description: "Add call_tags table for tagging calls",
+			UpSQL: `-- Table for storing tags of calls
+CREATE TABLE IF NOT EXISTS call_tags (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    call_id TEXT NOT NULL,
+    tag TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (call_id, tag)
+);
+
+-- Index for selecting calls by tag
+CREATE INDEX IF NOT EXISTS idx_call_tags_tag ON call_tags(tag);`,
+			DownSQL: `DROP TABLE IF EXISTS call_tags;`,
+		},
+		{
+			Version:     8,
+			Name:        "add_stats_indexes",
+			Description: "Add indexes for the line statistics",
+			UpSQL: `-- Index for selecting the start rows of a period
+CREATE INDEX IF NOT EXISTS idx_calls_event_type_timestamp ON calls(event_type, timestamp);
+
+-- Index for joining the disconnect row of a call
+CREATE INDEX IF NOT EXISTS idx_calls_call_id_event_type ON calls(call_id, event_type);`,
+			DownSQL: `DROP INDEX IF EXISTS idx_calls_call_id_event_type;
+DROP INDEX IF EXISTS idx_calls_event_type_timestamp;`,
+		},
+		{
+			Version:     9,
+			Name:        "add_call_transitions",
+			Description: "Add the FSM transition caused by each call event to calls table",
+			UpSQL: `-- Add FSM transition columns to calls table
+ALTER TABLE calls ADD COLUMN status_from TEXT;
+ALTER TABLE calls ADD COLUMN status_to TEXT;
+ALTER TABLE calls ADD COLUMN transition_reason TEXT;`,
+			DownSQL: `-- Remove FSM transition columns, supported since SQLite 3.35
+ALTER TABLE calls DROP COLUMN transition_reason;
+ALTER TABLE calls DROP COLUMN status_to;
+ALTER TABLE calls DROP COLUMN status_from;`,
+		},
+		{
+			Version:     10,
+			Name:        "normalize_timestamps",
+			Description: "Rewrite timestamps stored in the Go time format to UTC text the SQLite date functions understand",
+			UpSQL: `-- Timestamps were bound in UTC but stored as "2025-09-21 07:15:00 +0000 UTC"
+UPDATE calls SET timestamp = substr(timestamp, 1, length(timestamp) - 10) || '+00:00'
+WHERE timestamp LIKE '% +0000 UTC';
+UPDATE calls SET deleted_at = substr(deleted_at, 1, length(deleted_at) - 10) || '+00:00'
+WHERE deleted_at LIKE '% +0000 UTC';
+UPDATE unparsed_lines SET received_at = substr(received_at, 1, length(received_at) - 10) || '+00:00'
+WHERE received_at LIKE '% +0000 UTC';`,
+			DownSQL: `-- Note: the normalized timestamps are read the same way, nothing to undo`,
+		},
+		{
+			Version:     11,
+			Name:        "add_call_forwarding",
+			Description: "Add forwarded flag and parent call ID linking the legs of calls forwarded by the Fritz!Box",
+			UpSQL: `-- Add call forwarding columns to calls table
+ALTER TABLE calls ADD COLUMN forwarded INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE calls ADD COLUMN parent_call_id TEXT;
+
+-- Index for finding the outbound legs of a forwarded call
+CREATE INDEX IF NOT EXISTS idx_calls_parent_call_id ON calls(parent_call_id);`,
+			DownSQL: `-- Remove index
+DROP INDEX IF EXISTS idx_calls_parent_call_id;
+
+-- Remove columns, supported since SQLite 3.35
+ALTER TABLE calls DROP COLUMN parent_call_id;
+ALTER TABLE calls DROP COLUMN forwarded;`,
 		},
 	}
 }
@@ -0,0 +1,190 @@
+package database
+
+// GetEmbeddedPostgresMigrations returns the built-in PostgreSQL migrations. They
+// keep the versions of the SQLite migrations, so both schemas stay in step.
+func GetEmbeddedPostgresMigrations() []Migration {
+	return []Migration{
+		{
+			Version:     1,
+			Name:        "initial_schema",
+			Description: "Initial schema setup - Create the initial PostgreSQL schema for fritz-callmonitor2mqtt",
+			UpSQL: `-- Table for storing call events
+CREATE TABLE IF NOT EXISTS calls (
+    id BIGSERIAL PRIMARY KEY,
+    call_id TEXT NOT NULL,
+    timestamp TIMESTAMPTZ NOT NULL,
+    event_type TEXT NOT NULL CHECK (event_type IN ('incoming', 'outgoing', 'connect', 'disconnect')),
+    caller TEXT,
+    called TEXT,
+    line INTEGER,
+    trunk TEXT,
+    duration INTEGER, -- Duration in seconds (for connect/disconnect events)
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Index for faster queries by timestamp
+CREATE INDEX IF NOT EXISTS idx_calls_timestamp ON calls(timestamp);
+
+-- Index for faster queries by call_id
+CREATE INDEX IF NOT EXISTS idx_calls_call_id ON calls(call_id);
+
+-- Index for faster queries by event_type
+CREATE INDEX IF NOT EXISTS idx_calls_event_type ON calls(event_type);
+
+-- Table for storing application configuration
+CREATE TABLE IF NOT EXISTS config (
+    id BIGSERIAL PRIMARY KEY,
+    key TEXT UNIQUE NOT NULL,
+    value TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);`,
+			DownSQL: `DROP TABLE IF EXISTS config;
+DROP INDEX IF EXISTS idx_calls_event_type;
+DROP INDEX IF EXISTS idx_calls_call_id;
+DROP INDEX IF EXISTS idx_calls_timestamp;
+DROP TABLE IF EXISTS calls;`,
+		},
+		{
+			Version:     2,
+			Name:        "add_msn_fields",
+			Description: "Add MSN fields to calls table for caller and called party MSN detection",
+			UpSQL: `-- Add caller_msn and called_msn columns to calls table
+ALTER TABLE calls ADD COLUMN IF NOT EXISTS caller_msn TEXT;
+ALTER TABLE calls ADD COLUMN IF NOT EXISTS called_msn TEXT;
+
+-- Index for faster queries by caller_msn
+CREATE INDEX IF NOT EXISTS idx_calls_caller_msn ON calls(caller_msn);
+
+-- Index for faster queries by called_msn
+CREATE INDEX IF NOT EXISTS idx_calls_called_msn ON calls(called_msn);`,
+			DownSQL: `DROP INDEX IF EXISTS idx_calls_called_msn;
+DROP INDEX IF EXISTS idx_calls_caller_msn;
+ALTER TABLE calls DROP COLUMN IF EXISTS called_msn;
+ALTER TABLE calls DROP COLUMN IF EXISTS caller_msn;`,
+		},
+		{
+			Version:     3,
+			Name:        "add_redaction_marker",
+			Description: "Add redacted_at column to calls table to track at-rest redaction of phone numbers",
+			UpSQL: `-- Add redacted_at column to calls table
+ALTER TABLE calls ADD COLUMN IF NOT EXISTS redacted_at TIMESTAMPTZ;
+
+-- Index for faster lookups of rows that still need redaction
+CREATE INDEX IF NOT EXISTS idx_calls_redacted_at ON calls(redacted_at);`,
+			DownSQL: `DROP INDEX IF EXISTS idx_calls_redacted_at;
+ALTER TABLE calls DROP COLUMN IF EXISTS redacted_at;`,
+		},
+		{
+			Version:     4,
+			Name:        "add_notification_rules",
+			Description: "Add notification_rules table for per-recipient notification rules and schedules",
+			UpSQL: `-- Table for storing notification rules
+CREATE TABLE IF NOT EXISTS notification_rules (
+    id BIGSERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    recipient TEXT NOT NULL,
+    msn TEXT, -- NULL matches all MSNs
+    directions TEXT, -- Comma separated, NULL matches all directions
+    finish_states TEXT, -- Comma separated, NULL matches all finish states
+    days TEXT, -- Comma separated weekdays (mon..sun), NULL matches every day
+    start_time TEXT, -- HH:MM, NULL together with end_time matches the whole day
+    end_time TEXT,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);`,
+			DownSQL: `DROP TABLE IF EXISTS notification_rules;`,
+		},
+		{
+			Version:     5,
+			Name:        "add_unparsed_lines",
+			Description: "Add unparsed_lines table keeping callmonitor lines that could not be parsed",
+			UpSQL: `-- Table for storing unparsable callmonitor lines
+CREATE TABLE IF NOT EXISTS unparsed_lines (
+    id BIGSERIAL PRIMARY KEY,
+    line TEXT NOT NULL,
+    reason TEXT,
+    received_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);`,
+			DownSQL: `DROP TABLE IF EXISTS unparsed_lines;`,
+		},
+		{
+			Version:     6,
+			Name:        "add_soft_delete",
+			Description: "Add deleted_at column to calls table so deleted calls can be restored",
+			UpSQL: `-- Add deleted_at column to calls table
+ALTER TABLE calls ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- Index for excluding deleted calls
+CREATE INDEX IF NOT EXISTS idx_calls_deleted_at ON calls(deleted_at);`,
+			DownSQL: `DROP INDEX IF EXISTS idx_calls_deleted_at;
+ALTER TABLE calls DROP COLUMN IF EXISTS deleted_at;`,
+		},
+		{
+			Version:     7,
+			Name:        "add_call_tags",
+			Description: "Add call_tags table for tagging calls",
+			UpSQL: `-- Table for storing tags of calls
+CREATE TABLE IF NOT EXISTS call_tags (
+    id BIGSERIAL PRIMARY KEY,
+    call_id TEXT NOT NULL,
+    tag TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (call_id, tag)
+);
+
+-- Index for selecting calls by tag
+CREATE INDEX IF NOT EXISTS idx_call_tags_tag ON call_tags(tag);`,
+			DownSQL: `DROP TABLE IF EXISTS call_tags;`,
+		},
+		{
+			Version:     8,
+			Name:        "add_stats_indexes",
+			Description: "Add indexes for the line statistics",
+			UpSQL: `-- Index for selecting the start rows of a period
+CREATE INDEX IF NOT EXISTS idx_calls_event_type_timestamp ON calls(event_type, timestamp);
+
+-- Index for joining the disconnect row of a call
+CREATE INDEX IF NOT EXISTS idx_calls_call_id_event_type ON calls(call_id, event_type);`,
+			DownSQL: `DROP INDEX IF EXISTS idx_calls_call_id_event_type;
+DROP INDEX IF EXISTS idx_calls_event_type_timestamp;`,
+		},
+		{
+			Version:     9,
+			Name:        "add_call_transitions",
+			Description: "Add the FSM transition caused by each call event to calls table",
+			UpSQL: `-- Add FSM transition columns to calls table
+ALTER TABLE calls ADD COLUMN IF NOT EXISTS status_from TEXT;
+ALTER TABLE calls ADD COLUMN IF NOT EXISTS status_to TEXT;
+ALTER TABLE calls ADD COLUMN IF NOT EXISTS transition_reason TEXT;`,
+			DownSQL: `ALTER TABLE calls DROP COLUMN IF EXISTS transition_reason;
+ALTER TABLE calls DROP COLUMN IF EXISTS status_to;
+ALTER TABLE calls DROP COLUMN IF EXISTS status_from;`,
+		},
+		{
+			Version:     10,
+			Name:        "normalize_timestamps",
+			Description: "Normalize stored timestamps to UTC, which TIMESTAMPTZ columns already are",
+			UpSQL: `-- Nothing to rewrite, the version keeps both schemas in step
+SELECT 1;`,
+			DownSQL: `SELECT 1;`,
+		},
+		{
+			Version:     11,
+			Name:        "add_call_forwarding",
+			Description: "Add forwarded flag and parent call ID linking the legs of calls forwarded by the Fritz!Box",
+			UpSQL: `-- Add call forwarding columns to calls table
+ALTER TABLE calls ADD COLUMN IF NOT EXISTS forwarded BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE calls ADD COLUMN IF NOT EXISTS parent_call_id TEXT;
+
+-- Index for finding the outbound legs of a forwarded call
+CREATE INDEX IF NOT EXISTS idx_calls_parent_call_id ON calls(parent_call_id);`,
+			DownSQL: `DROP INDEX IF EXISTS idx_calls_parent_call_id;
+ALTER TABLE calls DROP COLUMN IF EXISTS parent_call_id;
+ALTER TABLE calls DROP COLUMN IF EXISTS forwarded;`,
+		},
+	}
+}
@@ -1,7 +1,15 @@
 package database
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
 )
 
 func TestGetEmbeddedMigrations(t *testing.T) {
@@ -88,3 +96,192 @@ func findSubstring(s, substr string) bool {
 	}
 	return false
 }
+
+func TestPostgresMigrationsMatchSQLite(t *testing.T) {
+	sqlite := GetEmbeddedMigrations()
+	postgres := GetEmbeddedPostgresMigrations()
+
+	if len(postgres) != len(sqlite) {
+		t.Fatalf("Expected %d PostgreSQL migrations, got %d", len(sqlite), len(postgres))
+	}
+	for i, migration := range postgres {
+		if migration.Version != sqlite[i].Version || migration.Name != sqlite[i].Name {
+			t.Errorf("Expected migration %d %s, got %d %s", sqlite[i].Version, sqlite[i].Name, migration.Version, migration.Name)
+		}
+		if migration.UpSQL == "" || migration.DownSQL == "" {
+			t.Errorf("Migration %d has no UP or DOWN SQL", migration.Version)
+		}
+		if containsSubstring(migration.UpSQL, "AUTOINCREMENT") || containsSubstring(migration.UpSQL, "DATETIME") {
+			t.Errorf("Migration %d uses SQLite types", migration.Version)
+		}
+	}
+}
+
+func TestMigrationFilesMatchEmbedded(t *testing.T) {
+	tests := []struct {
+		dir        string
+		migrations []Migration
+	}{
+		{"../../migrations", GetEmbeddedMigrations()},
+		{"../../migrations/postgres", GetEmbeddedPostgresMigrations()},
+	}
+	for _, tt := range tests {
+		files, err := filepath.Glob(filepath.Join(tt.dir, "*.sql"))
+		if err != nil {
+			t.Fatalf("Failed to list migration files: %v", err)
+		}
+		if len(files) != len(tt.migrations) {
+			t.Errorf("Expected %d migration files in %s, got %d", len(tt.migrations), tt.dir, len(files))
+		}
+		for _, migration := range tt.migrations {
+			path := filepath.Join(tt.dir, fmt.Sprintf("%03d_%s.sql", migration.Version, migration.Name))
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Errorf("Missing migration file: %v", err)
+				continue
+			}
+			_, rest, _ := strings.Cut(string(data), "-- +migrate Up\n\n")
+			up, down, found := strings.Cut(rest, "\n\n-- +migrate Down\n\n")
+			if !found {
+				t.Errorf("Expected Up and Down sections in %s", path)
+				continue
+			}
+			if up != migration.UpSQL {
+				t.Errorf("Up section of %s differs from the embedded migration:\n%s", path, up)
+			}
+			if strings.TrimSuffix(down, "\n") != migration.DownSQL {
+				t.Errorf("Down section of %s differs from the embedded migration:\n%s", path, down)
+			}
+		}
+	}
+}
+
+func TestNormalizeTimestampsMigration(t *testing.T) {
+	client := newMigratedClient(t)
+	ctx := context.Background()
+
+	// A row written before the timestamps were normalized
+	if _, err := client.db.ExecContext(ctx, `INSERT INTO calls (call_id, timestamp, event_type, line) VALUES ('old', '2025-09-21 07:15:00.5 +0000 UTC', 'incoming', 1)`); err != nil {
+		t.Fatalf("Failed to insert legacy row: %v", err)
+	}
+	var normalize Migration
+	for _, migration := range GetEmbeddedMigrations() {
+		if migration.Name == "normalize_timestamps" {
+			normalize = migration
+		}
+	}
+	if _, err := client.db.ExecContext(ctx, normalize.UpSQL); err != nil {
+		t.Fatalf("Failed to normalize timestamps: %v", err)
+	}
+
+	var stored string
+	var hour *string
+	err := client.db.QueryRowContext(ctx, `SELECT CAST(timestamp AS TEXT), strftime('%H', timestamp) FROM calls WHERE call_id = 'old'`).Scan(&stored, &hour)
+	if err != nil {
+		t.Fatalf("Failed to read timestamp: %v", err)
+	}
+	if stored != "2025-09-21 07:15:00.5+00:00" || hour == nil || *hour != "07" {
+		t.Errorf("Expected a timestamp SQLite can read, got %q (hour %v)", stored, hour)
+	}
+
+	first, err := client.FirstCallTime(ctx)
+	if err != nil {
+		t.Fatalf("FirstCallTime failed: %v", err)
+	}
+	if !first.Equal(time.Date(2025, 9, 21, 7, 15, 0, 500000000, time.UTC)) {
+		t.Errorf("Expected the normalized timestamp to be read back, got %v", first)
+	}
+}
+
+func TestMigratorDownAndUp(t *testing.T) {
+	client := newMigratedClient(t)
+	migrator := client.GetMigrator()
+	ctx := context.Background()
+	latest := GetEmbeddedMigrations()[len(GetEmbeddedMigrations())-1].Version
+
+	// Reverting everything and applying it again leaves a working schema
+	reverted, err := migrator.Down(ctx, 0)
+	if err != nil {
+		t.Fatalf("Down failed: %v", err)
+	}
+	if len(reverted) != latest || reverted[0].Version != latest || reverted[len(reverted)-1].Version != 1 {
+		t.Errorf("Expected all migrations to be reverted newest first, got %d", len(reverted))
+	}
+	var tables int
+	if err := client.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'calls'").Scan(&tables); err != nil {
+		t.Fatalf("Failed to look up the calls table: %v", err)
+	}
+	if tables != 0 {
+		t.Error("Expected the calls table to be dropped")
+	}
+
+	applied, err := migrator.Up(ctx, 5)
+	if err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	if len(applied) != 5 {
+		t.Errorf("Expected 5 applied migrations, got %d", len(applied))
+	}
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if len(statuses) != latest || !statuses[4].Applied || statuses[4].AppliedAt == "" || statuses[5].Applied {
+		t.Errorf("Expected migrations up to 5 to be applied, got %+v", statuses)
+	}
+
+	pending, err := migrator.UpPlan(ctx, 0)
+	if err != nil {
+		t.Fatalf("UpPlan failed: %v", err)
+	}
+	if len(pending) != latest-5 || pending[0].Version != 6 {
+		t.Errorf("Expected migrations 6 to %d to be pending, got %d", latest, len(pending))
+	}
+	if _, err := migrator.Up(ctx, 0); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+
+	// Every migration can be redone
+	for version := latest; version > 1; version-- {
+		if _, err := migrator.Down(ctx, version); err != nil {
+			t.Fatalf("Down to %d failed: %v", version, err)
+		}
+		redone, err := migrator.Redo(ctx)
+		if err != nil {
+			t.Fatalf("Redo of %d failed: %v", version, err)
+		}
+		if redone.Version != version {
+			t.Errorf("Expected migration %d to be redone, got %d", version, redone.Version)
+		}
+	}
+	if _, err := migrator.Up(ctx, 0); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+	if current, err := migrator.GetCurrentVersion(ctx); err != nil || current != latest {
+		t.Errorf("Expected version %d, got %d (%v)", latest, current, err)
+	}
+	if err := client.InsertCall(ctx, types.CallEvent{ID: "after-redo", Timestamp: time.Now(), Type: types.CallTypeRing, Line: 1}); err != nil {
+		t.Errorf("Expected the redone schema to store calls: %v", err)
+	}
+}
+
+func TestMigratorUnknownMigration(t *testing.T) {
+	client := newMigratedClient(t)
+	ctx := context.Background()
+
+	// A migration applied by a newer version of the application
+	if _, err := client.db.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES (99, 'from_the_future')"); err != nil {
+		t.Fatalf("Failed to record migration: %v", err)
+	}
+	migrator := client.GetMigrator()
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if last := statuses[len(statuses)-1]; last.Version != 99 || !last.Unknown || !last.Applied {
+		t.Errorf("Expected the unknown migration last, got %+v", last)
+	}
+	if _, err := migrator.Redo(ctx); err == nil {
+		t.Error("Expected an unknown migration not to be reverted")
+	}
+}
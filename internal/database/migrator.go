@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"embed"
 	"fmt"
@@ -10,6 +11,9 @@ import (
 	"strings"
 )
 
+// postgresMigrationLock is the advisory lock key held while PostgreSQL migrations run
+const postgresMigrationLock = 0x66726974 // "frit"
+
 // Migration represents a database migration
 type Migration struct {
 	Version     int
@@ -22,6 +26,7 @@ type Migration struct {
 // Migrator handles database migrations
 type Migrator struct {
 	db             *sql.DB
+	driver         string // Selects the embedded migrations and SQL dialect
 	migrationsPath string
 	migrations     []Migration
 }
@@ -30,6 +35,7 @@ type Migrator struct {
 func NewMigrator(db *sql.DB, migrationsPath string) *Migrator {
 	return &Migrator{
 		db:             db,
+		driver:         DriverSQLite,
 		migrationsPath: migrationsPath,
 		migrations:     []Migration{},
 	}
@@ -38,6 +44,9 @@ func NewMigrator(db *sql.DB, migrationsPath string) *Migrator {
 // LoadEmbeddedMigrations loads the embedded migrations
 func (m *Migrator) LoadEmbeddedMigrations() error {
 	m.migrations = GetEmbeddedMigrations()
+	if m.driver == DriverPostgres {
+		m.migrations = GetEmbeddedPostgresMigrations()
+	}
 
 	// Sort migrations by version
 	sort.Slice(m.migrations, func(i, j int) bool {
@@ -166,7 +175,7 @@ func (m *Migrator) parseSQLContent(content string) (upSQL, downSQL, description
 }
 
 // InitSchema initializes the migration tracking table
-func (m *Migrator) InitSchema() error {
+func (m *Migrator) InitSchema(ctx context.Context) error {
 	createSchemaSQL := `
 		CREATE TABLE IF NOT EXISTS schema_migrations (
 			version INTEGER PRIMARY KEY,
@@ -175,8 +184,11 @@ func (m *Migrator) InitSchema() error {
 			description TEXT
 		);
 	`
+	if m.driver == DriverPostgres {
+		createSchemaSQL = strings.Replace(createSchemaSQL, "DATETIME", "TIMESTAMPTZ", 1)
+	}
 
-	if _, err := m.db.Exec(createSchemaSQL); err != nil {
+	if _, err := m.db.ExecContext(ctx, createSchemaSQL); err != nil {
 		return fmt.Errorf("failed to create schema_migrations table: %w", err)
 	}
 
@@ -184,9 +196,9 @@ func (m *Migrator) InitSchema() error {
 }
 
 // GetCurrentVersion returns the current database schema version
-func (m *Migrator) GetCurrentVersion() (int, error) {
+func (m *Migrator) GetCurrentVersion(ctx context.Context) (int, error) {
 	var version int
-	err := m.db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	err := m.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
 	if err != nil {
 		return 0, fmt.Errorf("failed to get current schema version: %w", err)
 	}
@@ -194,53 +206,175 @@ func (m *Migrator) GetCurrentVersion() (int, error) {
 }
 
 // Migrate runs all pending migrations
-func (m *Migrator) Migrate() error {
-	if err := m.InitSchema(); err != nil {
-		return err
+func (m *Migrator) Migrate(ctx context.Context) error {
+	_, err := m.Up(ctx, 0)
+	return err
+}
+
+// UpPlan returns the pending migrations up to the target version, all of them with target 0
+func (m *Migrator) UpPlan(ctx context.Context, target int) ([]Migration, error) {
+	if err := m.InitSchema(ctx); err != nil {
+		return nil, err
 	}
 
-	currentVersion, err := m.GetCurrentVersion()
+	currentVersion, err := m.GetCurrentVersion(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// Find migrations to apply
 	var pendingMigrations []Migration
 	for _, migration := range m.migrations {
-		if migration.Version > currentVersion {
+		if migration.Version > currentVersion && (target == 0 || migration.Version <= target) {
 			pendingMigrations = append(pendingMigrations, migration)
 		}
 	}
+	return pendingMigrations, nil
+}
+
+// DownPlan returns the applied migrations above the target version, newest first
+func (m *Migrator) DownPlan(ctx context.Context, target int) ([]Migration, error) {
+	if target < 0 {
+		return nil, fmt.Errorf("invalid target version %d", target)
+	}
+	if err := m.InitSchema(ctx); err != nil {
+		return nil, err
+	}
+
+	applied, err := m.GetAppliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var revertMigrations []Migration
+	for i := len(applied) - 1; i >= 0 && applied[i].Version > target; i-- {
+		migration, ok := m.migration(applied[i].Version)
+		if !ok {
+			return nil, fmt.Errorf("migration %d %s is unknown to this version and cannot be reverted", applied[i].Version, applied[i].Name)
+		}
+		revertMigrations = append(revertMigrations, migration)
+	}
+	return revertMigrations, nil
+}
+
+// Up applies the pending migrations up to the target version, all of them
+// with target 0, and returns the applied migrations
+func (m *Migrator) Up(ctx context.Context, target int) ([]Migration, error) {
+	pendingMigrations, err := m.UpPlan(ctx, target)
+	if err != nil || len(pendingMigrations) == 0 {
+		return nil, err // No pending migrations
+	}
+	return m.run(ctx, nil, pendingMigrations)
+}
+
+// Down reverts the applied migrations above the target version, newest
+// first, and returns the reverted migrations
+func (m *Migrator) Down(ctx context.Context, target int) ([]Migration, error) {
+	revertMigrations, err := m.DownPlan(ctx, target)
+	if err != nil || len(revertMigrations) == 0 {
+		return nil, err
+	}
+	if _, err := m.run(ctx, revertMigrations, nil); err != nil {
+		return nil, err
+	}
+	return revertMigrations, nil
+}
+
+// Redo reverts the latest applied migration and applies it again
+func (m *Migrator) Redo(ctx context.Context) (Migration, error) {
+	latest, err := m.latest(ctx)
+	if err != nil {
+		return Migration{}, err
+	}
+	if _, err := m.run(ctx, []Migration{latest}, []Migration{latest}); err != nil {
+		return Migration{}, err
+	}
+	return latest, nil
+}
+
+// RedoPlan returns the migration Redo would revert and apply again
+func (m *Migrator) RedoPlan(ctx context.Context) (Migration, error) {
+	return m.latest(ctx)
+}
+
+// latest returns the latest applied migration
+func (m *Migrator) latest(ctx context.Context) (Migration, error) {
+	if err := m.InitSchema(ctx); err != nil {
+		return Migration{}, err
+	}
+	currentVersion, err := m.GetCurrentVersion(ctx)
+	if err != nil {
+		return Migration{}, err
+	}
+	if currentVersion == 0 {
+		return Migration{}, fmt.Errorf("no migration applied")
+	}
+	revertMigrations, err := m.DownPlan(ctx, currentVersion-1)
+	if err != nil {
+		return Migration{}, err
+	}
+	return revertMigrations[0], nil
+}
 
-	if len(pendingMigrations) == 0 {
-		return nil // No pending migrations
+// migration returns the known migration of a version
+func (m *Migrator) migration(version int) (Migration, bool) {
+	for _, migration := range m.migrations {
+		if migration.Version == version {
+			return migration, true
+		}
 	}
+	return Migration{}, false
+}
 
-	// Apply migrations in transaction
-	tx, err := m.db.Begin()
+// run reverts and then applies migrations in one transaction and returns the applied ones
+func (m *Migrator) run(ctx context.Context, revert, apply []Migration) ([]Migration, error) {
+	tx, err := m.db.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	defer tx.Rollback()
 
-	for _, migration := range pendingMigrations {
-		if err := m.applyMigration(tx, migration); err != nil {
-			return fmt.Errorf("failed to apply migration %d: %w", migration.Version, err)
+	// Instances sharing a PostgreSQL database may start at the same time. The
+	// lock serializes them, and migrations applied meanwhile are skipped.
+	if m.driver == DriverPostgres {
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", postgresMigrationLock); err != nil {
+			return nil, fmt.Errorf("failed to lock migrations: %w", err)
+		}
+	}
+
+	for _, migration := range revert {
+		if err := m.revertMigration(ctx, tx, migration); err != nil {
+			return nil, fmt.Errorf("failed to revert migration %d: %w", migration.Version, err)
 		}
 	}
 
+	var currentVersion int
+	if err := tx.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&currentVersion); err != nil {
+		return nil, fmt.Errorf("failed to get current schema version: %w", err)
+	}
+
+	var applied []Migration
+	for _, migration := range apply {
+		if migration.Version <= currentVersion {
+			continue
+		}
+		if err := m.applyMigration(ctx, tx, migration); err != nil {
+			return nil, fmt.Errorf("failed to apply migration %d: %w", migration.Version, err)
+		}
+		applied = append(applied, migration)
+	}
+
 	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("failed to commit migrations: %w", err)
+		return nil, fmt.Errorf("failed to commit migrations: %w", err)
 	}
 
-	return nil
+	return applied, nil
 }
 
 // applyMigration applies a single migration
-func (m *Migrator) applyMigration(tx *sql.Tx, migration Migration) error {
+func (m *Migrator) applyMigration(ctx context.Context, tx *sql.Tx, migration Migration) error {
 	// Execute the UP SQL
 	if migration.UpSQL != "" {
-		if _, err := tx.Exec(migration.UpSQL); err != nil {
+		if _, err := tx.ExecContext(ctx, migration.UpSQL); err != nil {
 			return fmt.Errorf("failed to execute migration SQL: %w", err)
 		}
 	}
@@ -250,22 +384,94 @@ func (m *Migrator) applyMigration(tx *sql.Tx, migration Migration) error {
 		INSERT INTO schema_migrations (version, name, description, applied_at)
 		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
 	`
-	if _, err := tx.Exec(insertSQL, migration.Version, migration.Name, migration.Description); err != nil {
+	if _, err := tx.ExecContext(ctx, rebind(m.driver, insertSQL), migration.Version, migration.Name, migration.Description); err != nil {
 		return fmt.Errorf("failed to record migration: %w", err)
 	}
 
 	return nil
 }
 
+// revertMigration reverts a single migration
+func (m *Migrator) revertMigration(ctx context.Context, tx *sql.Tx, migration Migration) error {
+	// Execute the DOWN SQL
+	if migration.DownSQL != "" {
+		if _, err := tx.ExecContext(ctx, migration.DownSQL); err != nil {
+			return fmt.Errorf("failed to execute migration SQL: %w", err)
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, rebind(m.driver, "DELETE FROM schema_migrations WHERE version = ?"), migration.Version); err != nil {
+		return fmt.Errorf("failed to remove migration record: %w", err)
+	}
+
+	return nil
+}
+
+// MigrationStatus is a known or applied migration and whether it is applied
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt string // As stored by the database, empty while pending
+	Unknown   bool   // Applied by a newer version of the application, it cannot be reverted
+}
+
+// Status returns the known and applied migrations by version
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	if err := m.InitSchema(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.QueryContext(ctx, `
+		SELECT version, name, COALESCE(description, ''), COALESCE(CAST(applied_at AS TEXT), '')
+		FROM schema_migrations
+		ORDER BY version
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]MigrationStatus)
+	for rows.Next() {
+		status := MigrationStatus{Applied: true}
+		if err := rows.Scan(&status.Version, &status.Name, &status.Description, &status.AppliedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan migration row: %w", err)
+		}
+		applied[status.Version] = status
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query applied migrations: %w", err)
+	}
+
+	var statuses []MigrationStatus
+	for _, migration := range m.migrations {
+		status := MigrationStatus{Migration: migration}
+		if row, ok := applied[migration.Version]; ok {
+			status.Applied, status.AppliedAt = true, row.AppliedAt
+			delete(applied, migration.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, status := range applied {
+		status.Unknown = true
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Version < statuses[j].Version
+	})
+
+	return statuses, nil
+}
+
 // GetAppliedMigrations returns all applied migrations
-func (m *Migrator) GetAppliedMigrations() ([]Migration, error) {
+func (m *Migrator) GetAppliedMigrations(ctx context.Context) ([]Migration, error) {
 	query := `
 		SELECT version, name, description
 		FROM schema_migrations
 		ORDER BY version
 	`
 
-	rows, err := m.db.Query(query)
+	rows, err := m.db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query applied migrations: %w", err)
 	}
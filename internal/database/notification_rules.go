@@ -0,0 +1,290 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// ErrNotFound is returned when a record does not exist
+var ErrNotFound = errors.New("not found")
+
+// weekdays maps the day names of notification schedules to weekdays
+var weekdays = map[string]time.Weekday{
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+	"sun": time.Sunday,
+}
+
+// NotificationRule decides who gets notified about which finished calls and when.
+// Empty fields match everything.
+type NotificationRule struct {
+	ID           int64     `json:"id"`
+	Name         string    `json:"name"`
+	Recipient    string    `json:"recipient"`               // Becomes a topic level, e.g. {prefix}/notify/{recipient}
+	MSN          string    `json:"msn,omitempty"`           // Local MSN of the call
+	Directions   []string  `json:"directions,omitempty"`    // inbound, outbound
+	FinishStates []string  `json:"finish_states,omitempty"` // notReached, missedCall, finished, messageBox
+	Days         []string  `json:"days,omitempty"`          // mon..sun
+	StartTime    string    `json:"start_time,omitempty"`    // HH:MM in the configured timezone
+	EndTime      string    `json:"end_time,omitempty"`      // HH:MM, before StartTime for windows spanning midnight
+	Enabled      bool      `json:"enabled"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Validate checks the rule before it is stored
+func (r NotificationRule) Validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if r.Recipient == "" {
+		return fmt.Errorf("recipient is required")
+	}
+	if strings.ContainsAny(r.Recipient, "/+#\x00") {
+		return fmt.Errorf("recipient must not contain '/', '+', '#' or NUL characters")
+	}
+	if _, err := types.ParseHistoryFilter(r.FinishStates, r.Directions); err != nil {
+		return err
+	}
+	for _, day := range r.Days {
+		if _, ok := weekdays[day]; !ok {
+			return fmt.Errorf("invalid day '%s', expected mon, tue, wed, thu, fri, sat or sun", day)
+		}
+	}
+	if (r.StartTime == "") != (r.EndTime == "") {
+		return fmt.Errorf("start_time and end_time must be set together")
+	}
+	for _, value := range []string{r.StartTime, r.EndTime} {
+		if value == "" {
+			continue
+		}
+		if _, err := time.Parse("15:04", value); err != nil {
+			return fmt.Errorf("invalid time '%s', expected HH:MM", value)
+		}
+	}
+	return nil
+}
+
+// Matches reports whether a finished call triggers the rule. event is the
+// disconnect event carrying the finish state; its timestamp decides the schedule.
+func (r NotificationRule) Matches(event types.CallEvent) bool {
+	if !r.Enabled || event.Type != types.CallTypeDisconnect {
+		return false
+	}
+
+	filter, err := types.ParseHistoryFilter(r.FinishStates, r.Directions)
+	if err != nil || !filter.Matches(event) {
+		return false
+	}
+
+	if r.MSN != "" {
+		msn := event.CalledMSN
+		if event.Direction == types.CallDirectionOutbound {
+			msn = event.CallerMSN
+		}
+		if msn != r.MSN {
+			return false
+		}
+	}
+
+	return r.scheduled(event.Timestamp)
+}
+
+// scheduled reports whether t falls into the days and time window of the rule
+func (r NotificationRule) scheduled(t time.Time) bool {
+	if len(r.Days) > 0 {
+		day := t.Weekday()
+		// A window spanning midnight belongs to the day it started
+		if r.StartTime != "" && r.EndTime < r.StartTime && t.Format("15:04") < r.EndTime {
+			day = t.AddDate(0, 0, -1).Weekday()
+		}
+		found := false
+		for _, name := range r.Days {
+			if weekdays[name] == day {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if r.StartTime == "" {
+		return true
+	}
+	now := t.Format("15:04")
+	if r.StartTime <= r.EndTime {
+		return now >= r.StartTime && now < r.EndTime
+	}
+	return now >= r.StartTime || now < r.EndTime
+}
+
+// ListNotificationRules returns all notification rules ordered by ID
+func (c *Client) ListNotificationRules(ctx context.Context) ([]NotificationRule, error) {
+	if c.db == nil {
+		return nil, fmt.Errorf("database not connected")
+	}
+
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT id, name, recipient, msn, directions, finish_states, days, start_time, end_time, enabled, created_at, updated_at
+		FROM notification_rules
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query notification rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []NotificationRule{}
+	for rows.Next() {
+		rule, err := scanNotificationRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read notification rules: %w", err)
+	}
+	return rules, nil
+}
+
+// GetNotificationRule returns a single rule or ErrNotFound
+func (c *Client) GetNotificationRule(ctx context.Context, id int64) (NotificationRule, error) {
+	if c.db == nil {
+		return NotificationRule{}, fmt.Errorf("database not connected")
+	}
+
+	row := c.db.QueryRowContext(ctx, c.rebind(`
+		SELECT id, name, recipient, msn, directions, finish_states, days, start_time, end_time, enabled, created_at, updated_at
+		FROM notification_rules
+		WHERE id = ?
+	`), id)
+	rule, err := scanNotificationRule(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return NotificationRule{}, fmt.Errorf("notification rule %d: %w", id, ErrNotFound)
+	}
+	return rule, err
+}
+
+// CreateNotificationRule validates and stores a new rule and returns it with its ID
+func (c *Client) CreateNotificationRule(ctx context.Context, rule NotificationRule) (NotificationRule, error) {
+	if c.db == nil {
+		return NotificationRule{}, fmt.Errorf("database not connected")
+	}
+	if err := rule.Validate(); err != nil {
+		return NotificationRule{}, fmt.Errorf("invalid notification rule: %w", err)
+	}
+
+	// RETURNING instead of LastInsertId, which the PostgreSQL driver does not support
+	var id int64
+	err := c.db.QueryRowContext(ctx, c.rebind(`
+		INSERT INTO notification_rules (name, recipient, msn, directions, finish_states, days, start_time, end_time, enabled)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+	`),
+		rule.Name,
+		rule.Recipient,
+		nullString(rule.MSN),
+		nullString(strings.Join(rule.Directions, ",")),
+		nullString(strings.Join(rule.FinishStates, ",")),
+		nullString(strings.Join(rule.Days, ",")),
+		nullString(rule.StartTime),
+		nullString(rule.EndTime),
+		rule.Enabled,
+	).Scan(&id)
+	if err != nil {
+		return NotificationRule{}, fmt.Errorf("failed to insert notification rule: %w", err)
+	}
+	return c.GetNotificationRule(ctx, id)
+}
+
+// UpdateNotificationRule validates and replaces the rule with rule.ID
+func (c *Client) UpdateNotificationRule(ctx context.Context, rule NotificationRule) (NotificationRule, error) {
+	if c.db == nil {
+		return NotificationRule{}, fmt.Errorf("database not connected")
+	}
+	if err := rule.Validate(); err != nil {
+		return NotificationRule{}, fmt.Errorf("invalid notification rule: %w", err)
+	}
+
+	result, err := c.db.ExecContext(ctx, c.rebind(`
+		UPDATE notification_rules
+		SET name = ?, recipient = ?, msn = ?, directions = ?, finish_states = ?, days = ?, start_time = ?, end_time = ?, enabled = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`),
+		rule.Name,
+		rule.Recipient,
+		nullString(rule.MSN),
+		nullString(strings.Join(rule.Directions, ",")),
+		nullString(strings.Join(rule.FinishStates, ",")),
+		nullString(strings.Join(rule.Days, ",")),
+		nullString(rule.StartTime),
+		nullString(rule.EndTime),
+		rule.Enabled,
+		rule.ID,
+	)
+	if err != nil {
+		return NotificationRule{}, fmt.Errorf("failed to update notification rule %d: %w", rule.ID, err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return NotificationRule{}, fmt.Errorf("notification rule %d: %w", rule.ID, ErrNotFound)
+	}
+	return c.GetNotificationRule(ctx, rule.ID)
+}
+
+// DeleteNotificationRule removes a rule or returns ErrNotFound
+func (c *Client) DeleteNotificationRule(ctx context.Context, id int64) error {
+	if c.db == nil {
+		return fmt.Errorf("database not connected")
+	}
+
+	result, err := c.db.ExecContext(ctx, c.rebind("DELETE FROM notification_rules WHERE id = ?"), id)
+	if err != nil {
+		return fmt.Errorf("failed to delete notification rule %d: %w", id, err)
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("notification rule %d: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// scanNotificationRule reads a rule from a row of the notification_rules table
+func scanNotificationRule(row interface{ Scan(dest ...any) error }) (NotificationRule, error) {
+	var rule NotificationRule
+	var msn, directions, finishStates, days, startTime, endTime sql.NullString
+	err := row.Scan(&rule.ID, &rule.Name, &rule.Recipient, &msn, &directions, &finishStates, &days, &startTime, &endTime, &rule.Enabled, &rule.CreatedAt, &rule.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return NotificationRule{}, err
+	}
+	if err != nil {
+		return NotificationRule{}, fmt.Errorf("failed to scan notification rule: %w", err)
+	}
+
+	rule.MSN = msn.String
+	rule.Directions = splitList(directions.String)
+	rule.FinishStates = splitList(finishStates.String)
+	rule.Days = splitList(days.String)
+	rule.StartTime = startTime.String
+	rule.EndTime = endTime.String
+	return rule, nil
+}
+
+// splitList splits a comma separated column value, returning nil for an empty value
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
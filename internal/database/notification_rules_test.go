@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+func TestNotificationRuleCRUD(t *testing.T) {
+	client := newMigratedClient(t)
+	ctx := context.Background()
+
+	rule, err := client.CreateNotificationRule(ctx, NotificationRule{
+		Name:         "Missed calls for Anna",
+		Recipient:    "anna",
+		MSN:          "990133",
+		FinishStates: []string{"missedCall"},
+		Days:         []string{"mon", "tue"},
+		StartTime:    "08:00",
+		EndTime:      "18:00",
+		Enabled:      true,
+	})
+	if err != nil {
+		t.Fatalf("CreateNotificationRule failed: %v", err)
+	}
+	if rule.ID == 0 || rule.MSN != "990133" || len(rule.Days) != 2 || rule.Directions != nil || !rule.Enabled {
+		t.Errorf("Unexpected created rule: %+v", rule)
+	}
+
+	rule.Enabled = false
+	rule.Days = nil
+	updated, err := client.UpdateNotificationRule(ctx, rule)
+	if err != nil {
+		t.Fatalf("UpdateNotificationRule failed: %v", err)
+	}
+	if updated.Enabled || updated.Days != nil {
+		t.Errorf("Unexpected updated rule: %+v", updated)
+	}
+
+	rules, err := client.ListNotificationRules(ctx)
+	if err != nil {
+		t.Fatalf("ListNotificationRules failed: %v", err)
+	}
+	if len(rules) != 1 || rules[0].ID != rule.ID {
+		t.Fatalf("Expected the created rule, got %+v", rules)
+	}
+
+	if err := client.DeleteNotificationRule(ctx, rule.ID); err != nil {
+		t.Fatalf("DeleteNotificationRule failed: %v", err)
+	}
+	if _, err := client.GetNotificationRule(ctx, rule.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after delete, got %v", err)
+	}
+	if err := client.DeleteNotificationRule(ctx, rule.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for deleted rule, got %v", err)
+	}
+	if _, err := client.UpdateNotificationRule(ctx, rule); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for updating deleted rule, got %v", err)
+	}
+
+	if _, err := client.CreateNotificationRule(ctx, NotificationRule{Name: "invalid", Recipient: "a/b"}); err == nil {
+		t.Error("Expected invalid rule to be rejected")
+	}
+}
+
+func TestNotificationRuleValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    NotificationRule
+		wantErr bool
+	}{
+		{"minimal", NotificationRule{Name: "all", Recipient: "anna"}, false},
+		{"full", NotificationRule{Name: "all", Recipient: "anna", Directions: []string{"inbound"}, FinishStates: []string{"missedCall"}, Days: []string{"sat", "sun"}, StartTime: "22:00", EndTime: "07:00"}, false},
+		{"missing name", NotificationRule{Recipient: "anna"}, true},
+		{"missing recipient", NotificationRule{Name: "all"}, true},
+		{"wildcard recipient", NotificationRule{Name: "all", Recipient: "#"}, true},
+		{"invalid finish state", NotificationRule{Name: "all", Recipient: "anna", FinishStates: []string{"busy"}}, true},
+		{"invalid day", NotificationRule{Name: "all", Recipient: "anna", Days: []string{"monday"}}, true},
+		{"start without end", NotificationRule{Name: "all", Recipient: "anna", StartTime: "08:00"}, true},
+		{"invalid time", NotificationRule{Name: "all", Recipient: "anna", StartTime: "8am", EndTime: "18:00"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNotificationRuleMatches(t *testing.T) {
+	missed := types.CallStatusMissedCall
+	// Monday, 22 September 2025
+	call := func(hour, minute int, direction types.CallDirection) types.CallEvent {
+		return types.CallEvent{
+			Type:        types.CallTypeDisconnect,
+			Timestamp:   time.Date(2025, 9, 22, hour, minute, 0, 0, time.UTC),
+			Direction:   direction,
+			CalledMSN:   "990133",
+			FinishState: &missed,
+		}
+	}
+	night := NotificationRule{Enabled: true, Days: []string{"sun"}, StartTime: "22:00", EndTime: "07:00"}
+
+	tests := []struct {
+		name     string
+		rule     NotificationRule
+		event    types.CallEvent
+		expected bool
+	}{
+		{"match all", NotificationRule{Enabled: true}, call(12, 0, types.CallDirectionInbound), true},
+		{"disabled", NotificationRule{}, call(12, 0, types.CallDirectionInbound), false},
+		{"matching msn", NotificationRule{Enabled: true, MSN: "990133"}, call(12, 0, types.CallDirectionInbound), true},
+		{"other msn", NotificationRule{Enabled: true, MSN: "990134"}, call(12, 0, types.CallDirectionInbound), false},
+		{"outbound msn is the caller", NotificationRule{Enabled: true, MSN: "990133"}, call(12, 0, types.CallDirectionOutbound), false},
+		{"finish state", NotificationRule{Enabled: true, FinishStates: []string{"finished"}}, call(12, 0, types.CallDirectionInbound), false},
+		{"weekday", NotificationRule{Enabled: true, Days: []string{"mon"}}, call(12, 0, types.CallDirectionInbound), true},
+		{"other weekday", NotificationRule{Enabled: true, Days: []string{"tue"}}, call(12, 0, types.CallDirectionInbound), false},
+		{"within window", NotificationRule{Enabled: true, StartTime: "08:00", EndTime: "18:00"}, call(8, 0, types.CallDirectionInbound), true},
+		{"end of window", NotificationRule{Enabled: true, StartTime: "08:00", EndTime: "18:00"}, call(18, 0, types.CallDirectionInbound), false},
+		{"overnight window of previous day", night, call(6, 30, types.CallDirectionInbound), true},
+		{"overnight window of current day", night, call(23, 0, types.CallDirectionInbound), false},
+		{"ring event", NotificationRule{Enabled: true}, types.CallEvent{Type: types.CallTypeRing}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.Matches(tt.event); got != tt.expected {
+				t.Errorf("Matches() = %t, expected %t", got, tt.expected)
+			}
+		})
+	}
+}
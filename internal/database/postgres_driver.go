@@ -0,0 +1,5 @@
+//go:build postgres
+
+package database
+
+import _ "github.com/jackc/pgx/v5/stdlib" // PostgreSQL driver, registered as "pgx"
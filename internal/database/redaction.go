@@ -0,0 +1,101 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// RedactionMask is the character used to replace redacted digits
+const RedactionMask = 'x'
+
+// RedactNumber replaces the last digits of a phone number with RedactionMask.
+// Non-digit characters (e.g. a leading "+") are kept so the number format stays recognizable.
+func RedactNumber(number string, digits int) string {
+	if number == "" || digits <= 0 {
+		return number
+	}
+
+	runes := []rune(number)
+	remaining := digits
+	for i := len(runes) - 1; i >= 0 && remaining > 0; i-- {
+		if runes[i] >= '0' && runes[i] <= '9' {
+			runes[i] = RedactionMask
+			remaining--
+		}
+	}
+	return string(runes)
+}
+
+// RedactCallsBefore masks the last digits of caller and called numbers of all calls
+// older than cutoff that have not been redacted yet. Rows are kept so that counts,
+// durations and MSN statistics stay intact. Returns the number of redacted rows.
+func (c *Client) RedactCallsBefore(ctx context.Context, cutoff time.Time, digits int) (_ int64, err error) {
+	if c.db == nil {
+		return 0, fmt.Errorf("database not connected")
+	}
+
+	if digits <= 0 {
+		return 0, fmt.Errorf("number of redacted digits must be greater than 0")
+	}
+
+	defer c.updates.observe(time.Now(), &err)
+
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, c.rebind(`
+		SELECT id, COALESCE(caller, ''), COALESCE(called, '')
+		FROM calls
+		WHERE redacted_at IS NULL AND timestamp < ?
+	`), cutoff.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to query calls for redaction: %w", err)
+	}
+
+	type pendingRedaction struct {
+		id     int64
+		caller string
+		called string
+	}
+
+	var pending []pendingRedaction
+	for rows.Next() {
+		var p pendingRedaction
+		if err := rows.Scan(&p.id, &p.caller, &p.called); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan call row: %w", err)
+		}
+		pending = append(pending, p)
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return 0, fmt.Errorf("failed to iterate call rows: %w", err)
+	}
+	rows.Close()
+
+	stmt, err := tx.PrepareContext(ctx, c.rebind(`
+		UPDATE calls
+		SET caller = ?, called = ?, redacted_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`))
+	if err != nil {
+		return 0, fmt.Errorf("failed to prepare redaction statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, p := range pending {
+		if _, err := stmt.ExecContext(ctx, RedactNumber(p.caller, digits), RedactNumber(p.called, digits), p.id); err != nil {
+			return 0, fmt.Errorf("failed to redact call %d: %w", p.id, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit redaction: %w", err)
+	}
+
+	return int64(len(pending)), nil
+}
@@ -0,0 +1,121 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRedactNumber(t *testing.T) {
+	tests := []struct {
+		name     string
+		number   string
+		digits   int
+		expected string
+	}{
+		{"e164 number", "+4930123456789", 3, "+4930123456xxx"},
+		{"national number", "030123456", 4, "03012xxxx"},
+		{"shorter than digits", "112", 5, "xxx"},
+		{"empty number", "", 3, ""},
+		{"zero digits", "+4930123456789", 0, "+4930123456789"},
+		{"already redacted", "+4930123456xxx", 3, "+4930123xxxxxx"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactNumber(tt.number, tt.digits); got != tt.expected {
+				t.Errorf("RedactNumber(%q, %d) = %q, expected %q", tt.number, tt.digits, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRedactCallsBefore(t *testing.T) {
+	client, err := NewClient(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.RunEmbeddedMigrations(context.Background()); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	now := time.Now().UTC()
+	insert := `INSERT INTO calls (call_id, timestamp, event_type, caller, called, line, trunk, duration)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	if _, err := client.DB().Exec(insert, "old", now.AddDate(0, 0, -40), "incoming", "+4930123456789", "+4930990133", 0, "SIP0", 42); err != nil {
+		t.Fatalf("Failed to insert old call: %v", err)
+	}
+	if _, err := client.DB().Exec(insert, "new", now, "incoming", "+4930123456789", "+4930990133", 0, "SIP0", 17); err != nil {
+		t.Fatalf("Failed to insert new call: %v", err)
+	}
+
+	count, err := client.RedactCallsBefore(context.Background(), now.AddDate(0, 0, -30), 3)
+	if err != nil {
+		t.Fatalf("RedactCallsBefore failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 redacted call, got %d", count)
+	}
+
+	var caller, called string
+	var duration int
+	if err := client.DB().QueryRow("SELECT caller, called, duration FROM calls WHERE call_id = 'old'").Scan(&caller, &called, &duration); err != nil {
+		t.Fatalf("Failed to query old call: %v", err)
+	}
+	if caller != "+4930123456xxx" || called != "+4930990xxx" {
+		t.Errorf("Old call not redacted: caller=%s called=%s", caller, called)
+	}
+	if duration != 42 {
+		t.Errorf("Expected duration to be kept, got %d", duration)
+	}
+
+	if err := client.DB().QueryRow("SELECT caller FROM calls WHERE call_id = 'new'").Scan(&caller); err != nil {
+		t.Fatalf("Failed to query new call: %v", err)
+	}
+	if caller != "+4930123456789" {
+		t.Errorf("New call should not be redacted, got %s", caller)
+	}
+
+	// A second run must not redact the same rows again
+	count, err = client.RedactCallsBefore(context.Background(), now.AddDate(0, 0, -30), 3)
+	if err != nil {
+		t.Fatalf("Second RedactCallsBefore failed: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected no rows on second run, got %d", count)
+	}
+
+	var total int
+	if err := client.DB().QueryRow("SELECT COUNT(*) FROM calls").Scan(&total); err != nil {
+		t.Fatalf("Failed to count calls: %v", err)
+	}
+	if total != 2 {
+		t.Errorf("Expected rows to be kept, got %d", total)
+	}
+}
+
+func TestRedactCallsBeforeCancelled(t *testing.T) {
+	client, err := NewClient(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer client.Close()
+
+	if err := client.RunEmbeddedMigrations(context.Background()); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.RedactCallsBefore(ctx, time.Now(), 3); err == nil {
+		t.Error("Expected error for cancelled context")
+	}
+}
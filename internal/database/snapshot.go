@@ -0,0 +1,22 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// Snapshot writes a consistent copy of the SQLite database to a new file at
+// path with VACUUM INTO, e.g. for backups. Writes continue meanwhile; the copy
+// holds the state when the snapshot started and no write-ahead log.
+func (c *Client) Snapshot(ctx context.Context, path string) error {
+	if c.db == nil {
+		return fmt.Errorf("database not connected")
+	}
+	if c.driver == DriverPostgres {
+		return fmt.Errorf("snapshots are only supported for SQLite, back up PostgreSQL with pg_dump")
+	}
+	if _, err := c.db.ExecContext(ctx, "VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("failed to snapshot database: %w", err)
+	}
+	return nil
+}
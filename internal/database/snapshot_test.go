@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+func TestSnapshot(t *testing.T) {
+	client := newMigratedClient(t)
+
+	events := []types.CallEvent{
+		{ID: "call-1", Timestamp: time.Now(), Type: types.CallTypeRing, Caller: "+4930123456"},
+		{ID: "call-1", Timestamp: time.Now(), Type: types.CallTypeDisconnect},
+	}
+	if err := client.InsertCalls(context.Background(), events); err != nil {
+		t.Fatalf("InsertCalls failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "snapshot.db")
+	if err := client.Snapshot(context.Background(), path); err != nil {
+		t.Fatalf("Snapshot failed: %v", err)
+	}
+	if err := client.Snapshot(context.Background(), path); err == nil {
+		t.Error("Expected snapshot to an existing file to fail")
+	}
+
+	snapshot, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("Failed to open snapshot: %v", err)
+	}
+	defer snapshot.Close()
+	var count, version int
+	if err := snapshot.QueryRow("SELECT COUNT(*) FROM calls").Scan(&count); err != nil {
+		t.Fatalf("Failed to count calls of the snapshot: %v", err)
+	}
+	if err := snapshot.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&version); err != nil {
+		t.Fatalf("Failed to read the schema version of the snapshot: %v", err)
+	}
+	if count != 2 || version == 0 {
+		t.Errorf("Expected 2 calls and the schema version in the snapshot, got %d calls, version %d", count, version)
+	}
+}
@@ -0,0 +1,177 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// StatsFilter selects the calls of the line statistics
+type StatsFilter struct {
+	From  time.Time // Calls started at or after From
+	To    time.Time // Calls started before To
+	Trunk string    // Only calls of this line, e.g. SIP0 (empty = all lines)
+}
+
+// LineTotals are the counters of the calls of a line
+type LineTotals struct {
+	Trunk    string
+	Calls    int64
+	Inbound  int64
+	Answered int64 // Calls with talk time
+	Missed   int64 // Inbound calls that ended without talk time
+	TalkTime int64 // Seconds
+}
+
+// HourlyCalls are the counters of the calls of a line started in an hour
+type HourlyCalls struct {
+	Trunk    string
+	Hour     time.Time // Start of the hour in UTC
+	Calls    int64
+	Missed   int64
+	TalkTime int64 // Seconds
+}
+
+// CallerCount counts the inbound calls of a number on a line
+type CallerCount struct {
+	Trunk    string
+	Number   string
+	Calls    int64
+	TalkTime int64 // Seconds
+}
+
+// statsFrom joins the start rows selected by the filter with their
+// disconnect rows; deleted calls are left out
+const statsFrom = `
+	FROM calls s
+	LEFT JOIN calls d ON d.call_id = s.call_id AND d.event_type = 'disconnect'
+	WHERE s.event_type IN ('incoming', 'outgoing') AND s.deleted_at IS NULL AND s.timestamp >= ? AND s.timestamp < ?`
+
+// missedCall counts an inbound call that ended without talk time
+const missedCall = `CASE WHEN s.event_type = 'incoming' AND d.call_id IS NOT NULL AND COALESCE(d.duration, 0) = 0 THEN 1 ELSE 0 END`
+
+// selection returns the conditions and arguments of the filter following statsFrom
+func (f StatsFilter) selection() (string, []any) {
+	args := []any{f.From.UTC(), f.To.UTC()}
+	if f.Trunk == "" {
+		return "", args
+	}
+	return " AND COALESCE(s.trunk, '') = ?", append(args, f.Trunk)
+}
+
+// LineTotals returns the counters of every line with calls matching the filter, ordered by line
+func (c *Client) LineTotals(ctx context.Context, filter StatsFilter) ([]LineTotals, error) {
+	if c.db == nil {
+		return nil, fmt.Errorf("database not connected")
+	}
+
+	selection, args := filter.selection()
+	rows, err := c.db.QueryContext(ctx, c.rebind(`
+		SELECT COALESCE(s.trunk, ''), COUNT(*),
+			SUM(CASE WHEN s.event_type = 'incoming' THEN 1 ELSE 0 END),
+			SUM(CASE WHEN d.duration > 0 THEN 1 ELSE 0 END),
+			SUM(`+missedCall+`),
+			COALESCE(SUM(d.duration), 0)
+		`+statsFrom+selection+`
+		GROUP BY COALESCE(s.trunk, '')
+		ORDER BY COALESCE(s.trunk, '')
+	`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query line totals: %w", err)
+	}
+	defer rows.Close()
+
+	var totals []LineTotals
+	for rows.Next() {
+		var line LineTotals
+		if err := rows.Scan(&line.Trunk, &line.Calls, &line.Inbound, &line.Answered, &line.Missed, &line.TalkTime); err != nil {
+			return nil, fmt.Errorf("failed to scan line totals: %w", err)
+		}
+		totals = append(totals, line)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read line totals: %w", err)
+	}
+	return totals, nil
+}
+
+// HourlyCalls returns the counters of the calls matching the filter per line
+// and hour, ordered by line and hour. Hours without calls are left out.
+// The hours are in UTC, so callers can group them by day or hour of day in
+// any timezone, including days with a daylight saving time change.
+func (c *Client) HourlyCalls(ctx context.Context, filter StatsFilter) ([]HourlyCalls, error) {
+	if c.db == nil {
+		return nil, fmt.Errorf("database not connected")
+	}
+
+	// Timestamps are stored in UTC; the hour is formatted as text in both databases
+	hour := `strftime('%Y-%m-%d %H:00:00', s.timestamp)`
+	if c.driver == DriverPostgres {
+		hour = `to_char(s.timestamp AT TIME ZONE 'UTC', 'YYYY-MM-DD HH24:00:00')`
+	}
+	selection, args := filter.selection()
+	rows, err := c.db.QueryContext(ctx, c.rebind(`
+		SELECT COALESCE(s.trunk, ''), `+hour+`, COUNT(*), SUM(`+missedCall+`), COALESCE(SUM(d.duration), 0)
+		`+statsFrom+selection+`
+		GROUP BY COALESCE(s.trunk, ''), `+hour+`
+		ORDER BY COALESCE(s.trunk, ''), `+hour+`
+	`), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query hourly calls: %w", err)
+	}
+	defer rows.Close()
+
+	var hours []HourlyCalls
+	for rows.Next() {
+		var calls HourlyCalls
+		var start string
+		if err := rows.Scan(&calls.Trunk, &start, &calls.Calls, &calls.Missed, &calls.TalkTime); err != nil {
+			return nil, fmt.Errorf("failed to scan hourly calls: %w", err)
+		}
+		if calls.Hour, err = time.Parse(time.DateTime, start); err != nil {
+			return nil, fmt.Errorf("invalid hour '%s': %w", start, err)
+		}
+		hours = append(hours, calls)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read hourly calls: %w", err)
+	}
+	return hours, nil
+}
+
+// TopCallers returns up to limit numbers with the most inbound calls
+// matching the filter per line, ordered by line and number of calls
+func (c *Client) TopCallers(ctx context.Context, filter StatsFilter, limit int) ([]CallerCount, error) {
+	if c.db == nil {
+		return nil, fmt.Errorf("database not connected")
+	}
+
+	selection, args := filter.selection()
+	rows, err := c.db.QueryContext(ctx, c.rebind(`
+		SELECT trunk, caller, calls, talk_time FROM (
+			SELECT COALESCE(s.trunk, '') AS trunk, s.caller AS caller, COUNT(*) AS calls, COALESCE(SUM(d.duration), 0) AS talk_time,
+				ROW_NUMBER() OVER (PARTITION BY COALESCE(s.trunk, '') ORDER BY COUNT(*) DESC, s.caller) AS caller_rank
+			`+statsFrom+selection+` AND s.event_type = 'incoming' AND s.caller IS NOT NULL
+			GROUP BY COALESCE(s.trunk, ''), s.caller
+		) ranked
+		WHERE caller_rank <= ?
+		ORDER BY trunk, caller_rank
+	`), append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query top callers: %w", err)
+	}
+	defer rows.Close()
+
+	var callers []CallerCount
+	for rows.Next() {
+		var caller CallerCount
+		if err := rows.Scan(&caller.Trunk, &caller.Number, &caller.Calls, &caller.TalkTime); err != nil {
+			return nil, fmt.Errorf("failed to scan top caller: %w", err)
+		}
+		callers = append(callers, caller)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read top callers: %w", err)
+	}
+	return callers, nil
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+func TestLineStatistics(t *testing.T) {
+	client := newMigratedClient(t)
+	ctx := context.Background()
+
+	start := time.Date(2025, 9, 21, 9, 15, 0, 0, time.UTC)
+	call := func(id string, at time.Time, callType types.CallType, trunk, caller string, duration int) []types.CallEvent {
+		return []types.CallEvent{
+			{ID: id, Timestamp: at, Type: callType, Trunk: trunk, Caller: caller, Called: "990133"},
+			{ID: id, Timestamp: at.Add(time.Minute), Type: types.CallTypeDisconnect, Duration: duration},
+		}
+	}
+	var events []types.CallEvent
+	events = append(events, call("a", start, types.CallTypeRing, "SIP0", "+4930111111", 60)...)
+	events = append(events, call("b", start.Add(10*time.Minute), types.CallTypeRing, "SIP0", "+4930111111", 0)...)
+	events = append(events, call("c", start.Add(2*time.Hour), types.CallTypeRing, "SIP0", "+4930222222", 30)...)
+	events = append(events, call("d", start.Add(25*time.Hour), types.CallTypeCall, "SIP1", "990133", 120)...)
+	events = append(events, call("deleted", start, types.CallTypeRing, "SIP0", "+4930333333", 0)...)
+	if err := client.InsertCalls(ctx, events); err != nil {
+		t.Fatalf("InsertCalls failed: %v", err)
+	}
+	if err := client.DeleteCall(ctx, "deleted"); err != nil {
+		t.Fatalf("DeleteCall failed: %v", err)
+	}
+
+	filter := StatsFilter{From: start.Add(-time.Hour), To: start.AddDate(0, 0, 7)}
+	totals, err := client.LineTotals(ctx, filter)
+	if err != nil {
+		t.Fatalf("LineTotals failed: %v", err)
+	}
+	want := []LineTotals{
+		{Trunk: "SIP0", Calls: 3, Inbound: 3, Answered: 2, Missed: 1, TalkTime: 90},
+		{Trunk: "SIP1", Calls: 1, Answered: 1, TalkTime: 120},
+	}
+	if len(totals) != len(want) || totals[0] != want[0] || totals[1] != want[1] {
+		t.Errorf("Expected totals %+v, got %+v", want, totals)
+	}
+
+	hours, err := client.HourlyCalls(ctx, StatsFilter{From: filter.From, To: filter.To, Trunk: "SIP0"})
+	if err != nil {
+		t.Fatalf("HourlyCalls failed: %v", err)
+	}
+	if len(hours) != 2 || !hours[0].Hour.Equal(start.Truncate(time.Hour)) || hours[0].Calls != 2 || hours[0].Missed != 1 || hours[1].TalkTime != 30 {
+		t.Errorf("Unexpected hourly calls %+v", hours)
+	}
+
+	callers, err := client.TopCallers(ctx, filter, 1)
+	if err != nil {
+		t.Fatalf("TopCallers failed: %v", err)
+	}
+	if len(callers) != 1 || callers[0] != (CallerCount{Trunk: "SIP0", Number: "+4930111111", Calls: 2, TalkTime: 60}) {
+		t.Errorf("Expected the most frequent caller of SIP0, got %+v", callers)
+	}
+}
+
+func TestHourlyCallsAcrossDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("Timezone data not available: %v", err)
+	}
+	client := newMigratedClient(t)
+	ctx := context.Background()
+
+	// 02:30 occurred twice on 26 October 2025, first in CEST and then in CET
+	first := time.Date(2025, 10, 26, 0, 30, 0, 0, time.UTC).In(berlin)
+	second := first.Add(time.Hour)
+	if first.Hour() != 2 || second.Hour() != 2 {
+		t.Fatalf("Expected both calls at 02:30 local time, got %v and %v", first, second)
+	}
+	var events []types.CallEvent
+	for i, at := range []time.Time{first, second} {
+		id := string(rune('a' + i))
+		events = append(events,
+			types.CallEvent{ID: id, Timestamp: at, Type: types.CallTypeRing, Trunk: "SIP0", Caller: "+4930111111", Called: "990133"},
+			types.CallEvent{ID: id, Timestamp: at.Add(time.Minute), Type: types.CallTypeDisconnect},
+		)
+	}
+	if err := client.InsertCalls(ctx, events); err != nil {
+		t.Fatalf("InsertCalls failed: %v", err)
+	}
+
+	day := time.Date(2025, 10, 26, 0, 0, 0, 0, berlin)
+	hours, err := client.HourlyCalls(ctx, StatsFilter{From: day, To: day.AddDate(0, 0, 1)})
+	if err != nil {
+		t.Fatalf("HourlyCalls failed: %v", err)
+	}
+	if len(hours) != 2 || !hours[0].Hour.Equal(first.Truncate(time.Hour)) || !hours[1].Hour.Equal(second.Truncate(time.Hour)) || hours[0].Calls != 1 || hours[1].Calls != 1 {
+		t.Errorf("Expected one call in each of the two hours at 02:00, got %+v", hours)
+	}
+
+	records, err := client.ListCalls(ctx, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("ListCalls failed: %v", err)
+	}
+	if len(records) != 2 || !records[0].Started.Equal(first) || !records[1].Started.Equal(second) {
+		t.Fatalf("Expected the calls at both 02:30, got %+v", records)
+	}
+	if got := records[0].Ended.Sub(records[0].Started); got != time.Minute {
+		t.Errorf("Expected a duration of 1m across the change, got %v", got)
+	}
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// Store is the persistence of the bridge. Client implements it for SQLite
+// and PostgreSQL, so callers do not depend on the database in use.
+type Store interface {
+	Ping(ctx context.Context) error
+	Close() error
+
+	InsertCalls(ctx context.Context, events []types.CallEvent) error
+	RedactCallsBefore(ctx context.Context, cutoff time.Time, digits int) (int64, error)
+	PurgeCallsBefore(ctx context.Context, cutoff time.Time) (int64, error)
+	ListCalls(ctx context.Context, from, to time.Time) ([]CallRecord, error)
+	ListDeletedCalls(ctx context.Context, from, to time.Time) ([]CallRecord, error)
+	GetCall(ctx context.Context, callID string) (CallRecord, error)
+	CallTimeline(ctx context.Context, callID string) ([]TimelineEntry, error)
+	DeleteCall(ctx context.Context, callID string) error
+	RestoreCall(ctx context.Context, callID string) error
+	CountCalls(ctx context.Context, filter CallFilter) (int64, error)
+	DeleteCalls(ctx context.Context, filter CallFilter) (int64, error)
+	RestoreCalls(ctx context.Context, filter CallFilter) (int64, error)
+	TagCalls(ctx context.Context, filter CallFilter, tag string) (int64, error)
+	UntagCalls(ctx context.Context, filter CallFilter, tag string) (int64, error)
+	EnrichCalls(ctx context.Context, filter CallFilter, enrich func(event *types.CallEvent)) (int64, error)
+	FirstCallTime(ctx context.Context) (time.Time, error)
+	ListAnsweredCalls(ctx context.Context, from, to time.Time) ([]AnsweredCall, error)
+	LineTotals(ctx context.Context, filter StatsFilter) ([]LineTotals, error)
+	HourlyCalls(ctx context.Context, filter StatsFilter) ([]HourlyCalls, error)
+	TopCallers(ctx context.Context, filter StatsFilter, limit int) ([]CallerCount, error)
+	InsertUnparsedLine(ctx context.Context, line, reason string, receivedAt time.Time) error
+	DeleteUnparsedLinesBefore(ctx context.Context, cutoff time.Time) (int64, error)
+	Health(ctx context.Context) (Health, error)
+	Snapshot(ctx context.Context, path string) error
+
+	ListNotificationRules(ctx context.Context) ([]NotificationRule, error)
+	GetNotificationRule(ctx context.Context, id int64) (NotificationRule, error)
+	CreateNotificationRule(ctx context.Context, rule NotificationRule) (NotificationRule, error)
+	UpdateNotificationRule(ctx context.Context, rule NotificationRule) (NotificationRule, error)
+	DeleteNotificationRule(ctx context.Context, id int64) error
+
+	GetConfig(ctx context.Context, key string) (string, error)
+	SetConfig(ctx context.Context, key, value string) error
+	LineSequences(ctx context.Context) (map[string]uint64, error)
+	SaveLineSequence(ctx context.Context, lineKey string, sequence uint64) error
+	PendingAcks(ctx context.Context) ([]types.PendingAck, error)
+	SavePendingAck(ctx context.Context, ack types.PendingAck) error
+	DeletePendingAck(ctx context.Context, callID string) error
+}
+
+var _ Store = (*Client)(nil)
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// InsertUnparsedLine stores a callmonitor line that could not be parsed, so
+// new Fritz!OS formats can be looked up and reported later
+func (c *Client) InsertUnparsedLine(ctx context.Context, line, reason string, receivedAt time.Time) (err error) {
+	if c.db == nil {
+		return fmt.Errorf("database not connected")
+	}
+
+	defer c.inserts.observe(time.Now(), &err)
+
+	_, err = c.db.ExecContext(ctx, c.rebind(`
+		INSERT INTO unparsed_lines (line, reason, received_at) VALUES (?, ?, ?)
+	`), line, reason, receivedAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to insert unparsed line: %w", err)
+	}
+	return nil
+}
+
+// DeleteUnparsedLinesBefore removes the unparsed lines received before cutoff
+// and returns how many were removed
+func (c *Client) DeleteUnparsedLinesBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	if c.db == nil {
+		return 0, fmt.Errorf("database not connected")
+	}
+
+	result, err := c.db.ExecContext(ctx, c.rebind(`DELETE FROM unparsed_lines WHERE received_at < ?`), cutoff.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete unparsed lines: %w", err)
+	}
+	count, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count deleted unparsed lines: %w", err)
+	}
+	return count, nil
+}
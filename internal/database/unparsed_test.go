@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestInsertUnparsedLine(t *testing.T) {
+	client := newMigratedClient(t)
+	ctx := context.Background()
+
+	receivedAt := time.Date(2025, 9, 21, 15, 30, 45, 0, time.UTC)
+	if err := client.InsertUnparsedLine(ctx, "21.09.25 15:30:45;TRANSFER;0;11;12;", "unknown call type: TRANSFER", receivedAt); err != nil {
+		t.Fatalf("Failed to insert unparsed line: %v", err)
+	}
+
+	var line, reason string
+	var stored time.Time
+	err := client.db.QueryRowContext(ctx, `SELECT line, reason, received_at FROM unparsed_lines`).Scan(&line, &reason, &stored)
+	if err != nil {
+		t.Fatalf("Failed to read unparsed line: %v", err)
+	}
+	if line != "21.09.25 15:30:45;TRANSFER;0;11;12;" || reason != "unknown call type: TRANSFER" || !stored.Equal(receivedAt) {
+		t.Errorf("Unexpected unparsed line %q (%q) at %v", line, reason, stored)
+	}
+}
+
+func TestDeleteUnparsedLinesBefore(t *testing.T) {
+	client := newMigratedClient(t)
+	ctx := context.Background()
+
+	cutoff := time.Date(2025, 9, 21, 0, 0, 0, 0, time.UTC)
+	for _, receivedAt := range []time.Time{cutoff.AddDate(0, 0, -2), cutoff.Add(-time.Second), cutoff.Add(time.Hour)} {
+		if err := client.InsertUnparsedLine(ctx, "21.09.25 15:30:45;TRANSFER;0;", "unknown call type: TRANSFER", receivedAt); err != nil {
+			t.Fatalf("Failed to insert unparsed line: %v", err)
+		}
+	}
+
+	count, err := client.DeleteUnparsedLinesBefore(ctx, cutoff)
+	if err != nil {
+		t.Fatalf("DeleteUnparsedLinesBefore failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 deleted lines, got %d", count)
+	}
+
+	var remaining int
+	if err := client.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM unparsed_lines`).Scan(&remaining); err != nil {
+		t.Fatalf("Failed to count unparsed lines: %v", err)
+	}
+	if remaining != 1 {
+		t.Errorf("Expected 1 remaining line, got %d", remaining)
+	}
+}
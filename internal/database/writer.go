@@ -0,0 +1,358 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// ErrQueueFull is returned when the write queue cannot take another event
+var ErrQueueFull = errors.New("database write queue is full")
+
+// ErrWriterClosed is returned for events arriving after Close
+var ErrWriterClosed = errors.New("database writer is closed")
+
+// WriterOptions configures the asynchronous call writer
+type WriterOptions struct {
+	QueueSize     int                 // Number of events buffered before new events are dropped
+	BatchSize     int                 // Maximum number of events per transaction
+	FlushInterval time.Duration       // Maximum time an event waits for its batch to fill up
+	Timeout       time.Duration       // Upper bound for writing a single batch
+	Retries       int                 // Further attempts for a failed write before it is dropped
+	RetryDelay    time.Duration       // Wait before the first retry, doubled for every further one
+	Clock         clock.Clock         // Drives the flush interval (default: real time)
+	Filter        types.HistoryFilter // Calls that are stored (default: all)
+
+	// OnFlush is called with every stored batch on the writer goroutine,
+	// which waits for it. The slice is reused for the next batch.
+	OnFlush func(events []types.CallEvent)
+}
+
+// DefaultWriterOptions returns the options used when nothing else is configured
+func DefaultWriterOptions() WriterOptions {
+	return WriterOptions{
+		QueueSize:     1000,
+		BatchSize:     50,
+		FlushInterval: time.Second,
+		Timeout:       30 * time.Second,
+		Retries:       3,
+		RetryDelay:    500 * time.Millisecond,
+		Clock:         clock.Real(),
+	}
+}
+
+// withDefaults fills unset fields from DefaultWriterOptions
+func (o WriterOptions) withDefaults() WriterOptions {
+	defaults := DefaultWriterOptions()
+	if o.QueueSize <= 0 {
+		o.QueueSize = defaults.QueueSize
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = defaults.BatchSize
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = defaults.FlushInterval
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = defaults.Timeout
+	}
+	if o.Retries <= 0 {
+		o.Retries = defaults.Retries
+	}
+	if o.RetryDelay <= 0 {
+		o.RetryDelay = defaults.RetryDelay
+	}
+	if o.Clock == nil {
+		o.Clock = defaults.Clock
+	}
+	return o
+}
+
+// WriterStats reports queue usage and throughput of the writer
+type WriterStats struct {
+	Queued        int    `json:"queued"`          // Events currently waiting
+	Capacity      int    `json:"capacity"`        // Size of the queue
+	MaxQueued     int    `json:"max_queued"`      // Highest queue length seen
+	Written       uint64 `json:"written"`         // Events stored successfully
+	Dropped       uint64 `json:"dropped"`         // Events and unparsed lines rejected because the queue was full
+	Failed        uint64 `json:"failed"`          // Events and unparsed lines dropped after all retries failed
+	Retried       uint64 `json:"retried"`         // Writes retried after an error, e.g. a busy database
+	Batches       uint64 `json:"batches"`         // Transactions committed
+	LastBatchSize int    `json:"last_batch_size"` // Events in the most recent transaction
+}
+
+// unparsedLine is a callmonitor line waiting to be stored
+type unparsedLine struct {
+	line       string
+	reason     string
+	receivedAt time.Time
+}
+
+// Writer persists call events asynchronously in batched transactions.
+// Enqueueing never blocks, so slow disks or a locked database cannot stall
+// the state machine; events are dropped and counted when the queue is full.
+type Writer struct {
+	client Store
+	opts   WriterOptions
+	queue  chan types.CallEvent
+	gate   *types.HistoryGate
+
+	unparsed chan unparsedLine // Unparsable callmonitor lines, stored one by one
+
+	mu     sync.RWMutex // Guards closed against concurrent enqueues
+	closed bool
+	done   chan struct{}
+
+	maxQueued     atomic.Int64
+	written       atomic.Uint64
+	dropped       atomic.Uint64
+	failed        atomic.Uint64
+	retried       atomic.Uint64
+	batches       atomic.Uint64
+	lastBatchSize atomic.Int64
+}
+
+// NewWriter creates a writer for the given store
+func NewWriter(client Store, opts WriterOptions) *Writer {
+	opts = opts.withDefaults()
+	return &Writer{
+		client: client,
+		opts:   opts,
+		queue:  make(chan types.CallEvent, opts.QueueSize),
+		gate:   types.NewHistoryGate(opts.Filter),
+		done:   make(chan struct{}),
+
+		unparsed: make(chan unparsedLine, opts.QueueSize),
+	}
+}
+
+// Start launches the background worker. Queued events are flushed when Close is called.
+func (w *Writer) Start() {
+	go w.run()
+}
+
+// PublishCallEvent queues an event for persistence without blocking.
+// Events flagged as do-not-record are skipped. With a filter, the events of a
+// call are held back until its disconnect shows whether it is stored.
+func (w *Writer) PublishCallEvent(_ context.Context, event types.CallEvent) error {
+	if event.DoNotRecord {
+		return nil
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		return ErrWriterClosed
+	}
+
+	var err error
+	for _, e := range w.gate.Add(event) {
+		if enqueueErr := w.enqueue(e); enqueueErr != nil && err == nil {
+			err = enqueueErr
+		}
+	}
+	return err
+}
+
+// QueueUnparsedLine stores a callmonitor line that could not be parsed without
+// blocking; the line is dropped and counted if the queue is full
+func (w *Writer) QueueUnparsedLine(line, reason string, receivedAt time.Time) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		return ErrWriterClosed
+	}
+	select {
+	case w.unparsed <- unparsedLine{line: line, reason: reason, receivedAt: receivedAt}:
+		return nil
+	default:
+		dropped := w.dropped.Add(1)
+		log.Printf("Database write queue full, dropped unparsed line (%d dropped in total)", dropped)
+		return ErrQueueFull
+	}
+}
+
+// enqueue puts an event on the queue, dropping it if the queue is full; w.mu must be held
+func (w *Writer) enqueue(event types.CallEvent) error {
+	select {
+	case w.queue <- event:
+		w.recordQueueLength(len(w.queue))
+		return nil
+	default:
+		dropped := w.dropped.Add(1)
+		log.Printf("Database write queue full, dropped call event %s (%d dropped in total)", event.ID, dropped)
+		return ErrQueueFull
+	}
+}
+
+// Stats returns a snapshot of the writer metrics
+func (w *Writer) Stats() WriterStats {
+	return WriterStats{
+		Queued:        len(w.queue),
+		Capacity:      cap(w.queue),
+		MaxQueued:     int(w.maxQueued.Load()),
+		Written:       w.written.Load(),
+		Dropped:       w.dropped.Load(),
+		Failed:        w.failed.Load(),
+		Retried:       w.retried.Load(),
+		Batches:       w.batches.Load(),
+		LastBatchSize: int(w.lastBatchSize.Load()),
+	}
+}
+
+// Close stops accepting events and waits until all queued events are written
+func (w *Writer) Close() {
+	_ = w.Shutdown(context.Background())
+}
+
+// Shutdown stops accepting events and waits until all queued events are
+// written or ctx is done, in which case it returns an error. Events of
+// running calls held back by the filter are written as well, as their
+// disconnect will not arrive anymore.
+func (w *Writer) Shutdown(ctx context.Context) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	if running := w.gate.Drain(); len(running) > 0 {
+		log.Printf("Storing %d events of running calls, their finish state is unknown", len(running))
+		for _, event := range running {
+			_ = w.enqueue(event)
+		}
+	}
+	close(w.queue)
+	close(w.unparsed)
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%d call events not written: %w", len(w.queue), ctx.Err())
+	}
+}
+
+// run collects events into batches until the queue is closed
+func (w *Writer) run() {
+	defer close(w.done)
+
+	ticker := w.opts.Clock.NewTicker(w.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]types.CallEvent, 0, w.opts.BatchSize)
+	unparsed := w.unparsed
+	for {
+		select {
+		case event, ok := <-w.queue:
+			if !ok {
+				w.flush(batch)
+				for line := range w.unparsed {
+					w.storeUnparsed(line)
+				}
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= w.opts.BatchSize {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+
+		case line, ok := <-unparsed:
+			if !ok {
+				unparsed = nil
+				continue
+			}
+			w.storeUnparsed(line)
+
+		case <-ticker.C():
+			if len(batch) > 0 {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// storeUnparsed writes an unparsable callmonitor line
+func (w *Writer) storeUnparsed(line unparsedLine) {
+	err := w.write("unparsed callmonitor line", func(ctx context.Context) error {
+		return w.client.InsertUnparsedLine(ctx, line.line, line.reason, line.receivedAt)
+	})
+	if err != nil {
+		w.failed.Add(1)
+	}
+}
+
+// flush writes a batch in one transaction
+func (w *Writer) flush(batch []types.CallEvent) {
+	if len(batch) == 0 {
+		return
+	}
+
+	err := w.write(fmt.Sprintf("%d call events", len(batch)), func(ctx context.Context) error {
+		return w.client.InsertCalls(ctx, batch)
+	})
+	if err != nil {
+		w.failed.Add(uint64(len(batch)))
+		return
+	}
+
+	w.written.Add(uint64(len(batch)))
+	w.batches.Add(1)
+	w.lastBatchSize.Store(int64(len(batch)))
+	if w.opts.OnFlush != nil {
+		w.opts.OnFlush(batch)
+	}
+}
+
+// write runs insert, retrying with a growing delay if it fails, e.g. while
+// another process locks the database. It returns the last error once all
+// retries failed.
+func (w *Writer) write(what string, insert func(ctx context.Context) error) error {
+	delay := w.opts.RetryDelay
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), w.opts.Timeout)
+		err := insert(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if attempt == w.opts.Retries {
+			log.Printf("Failed to store %s, dropped after %d attempts: %v", what, attempt+1, err)
+			return err
+		}
+
+		w.retried.Add(1)
+		log.Printf("Failed to store %s, retrying in %v: %v", what, delay, err)
+		w.sleep(delay)
+		delay *= 2
+	}
+}
+
+// sleep waits for d on the clock of the writer
+func (w *Writer) sleep(d time.Duration) {
+	wake := make(chan struct{})
+	w.opts.Clock.AfterFunc(d, func() { close(wake) })
+	<-wake
+}
+
+// recordQueueLength keeps track of the highest queue length
+func (w *Writer) recordQueueLength(length int) {
+	for {
+		current := w.maxQueued.Load()
+		if int64(length) <= current || w.maxQueued.CompareAndSwap(current, int64(length)) {
+			return
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// countCalls returns the number of stored call events
+func countCalls(t *testing.T, client *Client) int {
+	t.Helper()
+	var count int
+	if err := client.DB().QueryRow("SELECT COUNT(*) FROM calls").Scan(&count); err != nil {
+		t.Fatalf("Failed to count calls: %v", err)
+	}
+	return count
+}
+
+func TestWriterBatchesEvents(t *testing.T) {
+	client := newMigratedClient(t)
+	writer := NewWriter(client, WriterOptions{BatchSize: 4, FlushInterval: time.Hour})
+	writer.Start()
+
+	for i := 0; i < 10; i++ {
+		event := types.CallEvent{ID: fmt.Sprintf("call-%d", i), Timestamp: time.Now(), Type: types.CallTypeRing, Line: i}
+		if err := writer.PublishCallEvent(context.Background(), event); err != nil {
+			t.Fatalf("PublishCallEvent failed: %v", err)
+		}
+	}
+
+	// Close flushes the incomplete last batch
+	writer.Close()
+
+	if got := countCalls(t, client); got != 10 {
+		t.Errorf("Expected 10 stored events, got %d", got)
+	}
+	stats := writer.Stats()
+	if stats.Written != 10 || stats.Batches != 3 || stats.LastBatchSize != 2 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestWriterFlushesOnInterval(t *testing.T) {
+	client := newMigratedClient(t)
+	clk := clock.NewFake(time.Date(2025, 9, 21, 15, 35, 0, 0, time.UTC))
+	writer := NewWriter(client, WriterOptions{BatchSize: 100, FlushInterval: time.Minute, Clock: clk})
+	writer.Start()
+	defer writer.Close()
+
+	if err := writer.PublishCallEvent(context.Background(), types.CallEvent{ID: "call-1", Timestamp: time.Now(), Type: types.CallTypeCall}); err != nil {
+		t.Fatalf("PublishCallEvent failed: %v", err)
+	}
+
+	// Let the worker take the event into its batch before the interval elapses
+	clk.BlockUntil(1)
+	for writer.Stats().Queued > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clk.Advance(time.Minute)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for writer.Stats().Written == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Event was not flushed within the flush interval")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWriterDropsWhenQueueFull(t *testing.T) {
+	client := newMigratedClient(t)
+	// Not started, so nothing drains the queue
+	writer := NewWriter(client, WriterOptions{QueueSize: 1})
+
+	event := types.CallEvent{ID: "call-1", Timestamp: time.Now(), Type: types.CallTypeRing}
+	if err := writer.PublishCallEvent(context.Background(), event); err != nil {
+		t.Fatalf("First event should be queued: %v", err)
+	}
+	if err := writer.PublishCallEvent(context.Background(), event); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+
+	stats := writer.Stats()
+	if stats.Dropped != 1 || stats.Queued != 1 || stats.MaxQueued != 1 || stats.Capacity != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	writer.Start()
+	writer.Close()
+	if err := writer.PublishCallEvent(context.Background(), event); !errors.Is(err, ErrWriterClosed) {
+		t.Errorf("Expected ErrWriterClosed, got %v", err)
+	}
+	if got := countCalls(t, client); got != 1 {
+		t.Errorf("Expected queued event to be stored on close, got %d", got)
+	}
+}
+
+func TestWriterSkipsDoNotRecord(t *testing.T) {
+	client := newMigratedClient(t)
+	writer := NewWriter(client, WriterOptions{})
+	writer.Start()
+
+	event := types.CallEvent{ID: "call-1", Timestamp: time.Now(), Type: types.CallTypeRing, DoNotRecord: true}
+	if err := writer.PublishCallEvent(context.Background(), event); err != nil {
+		t.Fatalf("PublishCallEvent failed: %v", err)
+	}
+	writer.Close()
+
+	if got := countCalls(t, client); got != 0 {
+		t.Errorf("Expected do-not-record event to be skipped, got %d rows", got)
+	}
+}
+
+func TestWriterReportsStoredBatches(t *testing.T) {
+	client := newMigratedClient(t)
+	var stored []string
+	writer := NewWriter(client, WriterOptions{BatchSize: 2, FlushInterval: time.Hour, OnFlush: func(events []types.CallEvent) {
+		// The batch is stored once the callback runs
+		if got := countCalls(t, client); got != len(stored)+len(events) {
+			t.Errorf("Expected %d stored events, got %d", len(stored)+len(events), got)
+		}
+		for _, event := range events {
+			stored = append(stored, event.ID)
+		}
+	}})
+	writer.Start()
+
+	for i := 0; i < 3; i++ {
+		event := types.CallEvent{ID: fmt.Sprintf("call-%d", i), Timestamp: time.Now(), Type: types.CallTypeRing}
+		if err := writer.PublishCallEvent(context.Background(), event); err != nil {
+			t.Fatalf("PublishCallEvent failed: %v", err)
+		}
+	}
+	writer.Close()
+
+	if fmt.Sprint(stored) != "[call-0 call-1 call-2]" {
+		t.Errorf("Expected all events to be reported in order, got %v", stored)
+	}
+}
+
+func TestWriterStoresUnparsedLines(t *testing.T) {
+	client := newMigratedClient(t)
+	writer := NewWriter(client, WriterOptions{FlushInterval: time.Hour})
+	writer.Start()
+
+	receivedAt := time.Date(2025, 9, 21, 15, 30, 45, 0, time.UTC)
+	if err := writer.QueueUnparsedLine("21.09.25 15:30:45;TRANSFER;0;", "unknown call type: TRANSFER", receivedAt); err != nil {
+		t.Fatalf("QueueUnparsedLine failed: %v", err)
+	}
+	writer.Close()
+
+	var count int
+	if err := client.DB().QueryRow("SELECT COUNT(*) FROM unparsed_lines").Scan(&count); err != nil {
+		t.Fatalf("Failed to count unparsed lines: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected the unparsed line to be stored on close, got %d rows", count)
+	}
+	if err := writer.QueueUnparsedLine("line", "reason", receivedAt); !errors.Is(err, ErrWriterClosed) {
+		t.Errorf("Expected ErrWriterClosed after close, got %v", err)
+	}
+}
+
+func TestWriterShutdown(t *testing.T) {
+	client := newMigratedClient(t)
+
+	t.Run("flushes queue", func(t *testing.T) {
+		writer := NewWriter(client, WriterOptions{FlushInterval: time.Hour})
+		writer.Start()
+
+		event := types.CallEvent{ID: "call-1", Timestamp: time.Now(), Type: types.CallTypeRing}
+		if err := writer.PublishCallEvent(context.Background(), event); err != nil {
+			t.Fatalf("PublishCallEvent failed: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := writer.Shutdown(ctx); err != nil {
+			t.Fatalf("Shutdown failed: %v", err)
+		}
+		if writer.Stats().Written != 1 {
+			t.Errorf("Expected queued event to be written, got %+v", writer.Stats())
+		}
+		if err := writer.PublishCallEvent(context.Background(), event); !errors.Is(err, ErrWriterClosed) {
+			t.Errorf("Expected ErrWriterClosed after shutdown, got %v", err)
+		}
+	})
+
+	t.Run("gives up on timeout", func(t *testing.T) {
+		// Without Start nothing consumes the queue
+		writer := NewWriter(client, WriterOptions{})
+		event := types.CallEvent{ID: "call-2", Timestamp: time.Now(), Type: types.CallTypeRing}
+		if err := writer.PublishCallEvent(context.Background(), event); err != nil {
+			t.Fatalf("PublishCallEvent failed: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := writer.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected deadline error, got %v", err)
+		}
+	})
+}
+
+// flakyStore fails the first writes of call events, like a busy database
+type flakyStore struct {
+	*Client
+	failures int
+}
+
+func (s *flakyStore) InsertCalls(ctx context.Context, events []types.CallEvent) error {
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("database is locked")
+	}
+	return s.Client.InsertCalls(ctx, events)
+}
+
+func TestWriterRetriesFailedWrites(t *testing.T) {
+	client := newMigratedClient(t)
+	event := types.CallEvent{ID: "call-1", Timestamp: time.Now(), Type: types.CallTypeRing}
+
+	t.Run("succeeds on retry", func(t *testing.T) {
+		writer := NewWriter(&flakyStore{Client: client, failures: 2}, WriterOptions{FlushInterval: time.Hour, RetryDelay: time.Millisecond})
+		writer.Start()
+		if err := writer.PublishCallEvent(context.Background(), event); err != nil {
+			t.Fatalf("PublishCallEvent failed: %v", err)
+		}
+		writer.Close()
+
+		stats := writer.Stats()
+		if stats.Written != 1 || stats.Retried != 2 || stats.Failed != 0 {
+			t.Errorf("Expected the event to be written after 2 retries, got %+v", stats)
+		}
+	})
+
+	t.Run("drops after all retries", func(t *testing.T) {
+		writer := NewWriter(&flakyStore{Client: client, failures: 10}, WriterOptions{FlushInterval: time.Hour, Retries: 2, RetryDelay: time.Millisecond})
+		writer.Start()
+		if err := writer.PublishCallEvent(context.Background(), event); err != nil {
+			t.Fatalf("PublishCallEvent failed: %v", err)
+		}
+		writer.Close()
+
+		stats := writer.Stats()
+		if stats.Written != 0 || stats.Retried != 2 || stats.Failed != 1 {
+			t.Errorf("Expected the event to be dropped after 2 retries, got %+v", stats)
+		}
+	})
+}
+
+func TestWriterShutdownStoresRunningCalls(t *testing.T) {
+	client := newMigratedClient(t)
+	filter := types.HistoryFilter{FinishStates: []types.CallStatus{types.CallStatusFinished}}
+	writer := NewWriter(client, WriterOptions{FlushInterval: time.Hour, Filter: filter})
+	writer.Start()
+
+	event := types.CallEvent{ID: "running", Timestamp: time.Now(), Type: types.CallTypeRing}
+	if err := writer.PublishCallEvent(context.Background(), event); err != nil {
+		t.Fatalf("PublishCallEvent failed: %v", err)
+	}
+	writer.Close()
+
+	if got := countCalls(t, client); got != 1 {
+		t.Errorf("Expected the event of the running call to be stored on shutdown, got %d", got)
+	}
+}
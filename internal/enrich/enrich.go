@@ -0,0 +1,182 @@
+package enrich
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// maxResponseSize bounds the fields read from a hook
+const maxResponseSize = 1 << 20
+
+// Hook adds custom fields to the call events, e.g. the customer of a CRM
+// lookup. It runs an external command with the event JSON on stdin, or posts
+// the event JSON to a URL, and expects a JSON object with the fields in
+// return. The fields of a call are kept until it is disconnected, so a hook
+// answering only the first event of a call enriches all of them.
+type Hook struct {
+	command    []string // Command and arguments, empty for a URL
+	url        string
+	timeout    time.Duration
+	httpClient *http.Client
+
+	mu     sync.Mutex
+	fields map[string]map[string]any // Fields returned so far by call ID
+}
+
+// Options configures a hook
+type Options struct {
+	Target     string        // Command with arguments, split at spaces, or http(s) URL
+	Timeout    time.Duration // Upper bound for a single run (default: 2s)
+	HTTPClient *http.Client  // Overrides the client built from Timeout
+}
+
+// DefaultOptions returns the options used when nothing else is configured
+func DefaultOptions() Options {
+	return Options{
+		Timeout: 2 * time.Second,
+	}
+}
+
+// withDefaults fills unset fields from DefaultOptions
+func (o Options) withDefaults() Options {
+	defaults := DefaultOptions()
+	if o.Timeout <= 0 {
+		o.Timeout = defaults.Timeout
+	}
+	if o.HTTPClient == nil {
+		o.HTTPClient = &http.Client{Timeout: o.Timeout}
+	}
+	return o
+}
+
+// New creates a hook. Commands are run without a shell.
+func New(opts Options) (*Hook, error) {
+	opts = opts.withDefaults()
+	target := strings.TrimSpace(opts.Target)
+	if target == "" {
+		return nil, fmt.Errorf("empty enrichment hook")
+	}
+	h := &Hook{timeout: opts.Timeout, httpClient: opts.HTTPClient, fields: make(map[string]map[string]any)}
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		if u, err := url.Parse(target); err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid enrichment hook URL '%s'", target)
+		}
+		h.url = target
+	} else {
+		h.command = strings.Fields(target)
+	}
+	return h, nil
+}
+
+// Enrich runs the hook for the event and sets the fields returned for its
+// call so far. A failing hook is returned as error, the event then keeps the
+// fields of earlier runs.
+func (h *Hook) Enrich(ctx context.Context, event *types.CallEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode call event: %w", err)
+	}
+
+	var output []byte
+	if h.url != "" {
+		output, err = h.post(ctx, payload)
+	} else {
+		output, err = h.run(ctx, payload)
+	}
+	if err == nil {
+		err = h.merge(event.ID, output)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if fields := h.fields[event.ID]; len(fields) > 0 {
+		event.Enrichment = make(map[string]any, len(fields))
+		for key, value := range fields {
+			event.Enrichment[key] = value
+		}
+	}
+	if event.Type == types.CallTypeDisconnect {
+		delete(h.fields, event.ID)
+	}
+	return err
+}
+
+// run executes the command with the event on stdin and returns its stdout
+func (h *Hook) run(ctx context.Context, payload []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, h.command[0], h.command[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	// Children of the command may keep its output open after it was killed
+	cmd.WaitDelay = 100 * time.Millisecond
+	output, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("enrichment hook '%s' failed: %w: %s", h.command[0], err, message)
+		}
+		return nil, fmt.Errorf("enrichment hook '%s' failed: %w", h.command[0], err)
+	}
+	return output, nil
+}
+
+// post sends the event to the URL and returns the response body; any status but 2xx is an error
+func (h *Hook) post(ctx context.Context, payload []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create enrichment request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call enrichment hook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read enrichment response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("enrichment hook returned status %d", resp.StatusCode)
+	}
+	return body, nil
+}
+
+// merge adds the fields of a hook response to the fields of the call. An
+// empty response adds nothing, anything else must be a JSON object.
+func (h *Hook) merge(callID string, output []byte) error {
+	if len(bytes.TrimSpace(output)) == 0 {
+		return nil
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(output, &fields); err != nil || fields == nil {
+		return fmt.Errorf("invalid enrichment hook response, expected a JSON object: %.100s", bytes.TrimSpace(output))
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	known := h.fields[callID]
+	if known == nil {
+		known = make(map[string]any, len(fields))
+		h.fields[callID] = known
+	}
+	for key, value := range fields {
+		known[key] = value
+	}
+	return nil
+}
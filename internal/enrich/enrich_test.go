@@ -0,0 +1,143 @@
+package enrich
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// writeScript creates an executable shell script in a temporary directory
+func writeScript(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hook.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o755); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+	return path
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(Options{}); err == nil {
+		t.Error("Expected an error for an empty hook")
+	}
+	if _, err := New(Options{Target: "http://"}); err == nil {
+		t.Error("Expected an error for a URL without host")
+	}
+	if _, err := New(Options{Target: "/usr/local/bin/crm-lookup --json"}); err != nil {
+		t.Errorf("New failed: %v", err)
+	}
+}
+
+func TestCommandHook(t *testing.T) {
+	// The script answers with the caller it got on stdin
+	script := writeScript(t, `caller=$(sed -n 's/.*"caller":"\([^"]*\)".*/\1/p')
+if [ -n "$caller" ]; then echo "{\"customer\": \"ACME Corp\", \"number\": \"$caller\"}"; fi`)
+	hook, err := New(Options{Target: script})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	event := types.CallEvent{ID: "call-1", Type: types.CallTypeRing, Caller: "+4930123456"}
+	if err := hook.Enrich(context.Background(), &event); err != nil {
+		t.Fatalf("Enrich failed: %v", err)
+	}
+	if event.Enrichment["customer"] != "ACME Corp" || event.Enrichment["number"] != "+4930123456" {
+		t.Errorf("Expected the fields of the script, got %v", event.Enrichment)
+	}
+
+	// Later events of the call keep the fields, even if the script adds nothing
+	disconnect := types.CallEvent{ID: "call-1", Type: types.CallTypeDisconnect}
+	if err := hook.Enrich(context.Background(), &disconnect); err != nil {
+		t.Fatalf("Enrich failed: %v", err)
+	}
+	if disconnect.Enrichment["customer"] != "ACME Corp" {
+		t.Errorf("Expected the fields of the ring, got %v", disconnect.Enrichment)
+	}
+	if len(hook.fields) != 0 {
+		t.Errorf("Expected the fields to be dropped on disconnect, got %v", hook.fields)
+	}
+}
+
+func TestCommandHookFailure(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+	}{
+		{"exit code", "echo 'lookup failed' >&2; exit 1"},
+		{"no JSON object", "echo '[1, 2]'"},
+		{"timeout", "sleep 5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook, err := New(Options{Target: writeScript(t, tt.script), Timeout: 200 * time.Millisecond})
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			event := types.CallEvent{ID: "call-1", Type: types.CallTypeRing}
+			start := time.Now()
+			if err := hook.Enrich(context.Background(), &event); err == nil {
+				t.Error("Expected an error")
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("Expected the hook to be stopped after the timeout, took %v", elapsed)
+			}
+			if event.Enrichment != nil {
+				t.Errorf("Expected no fields, got %v", event.Enrichment)
+			}
+		})
+	}
+}
+
+func TestHTTPHook(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event types.CallEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch event.Type {
+		case types.CallTypeRing:
+			w.Write([]byte(`{"customer": "ACME Corp", "open_tickets": 2}`))
+		case types.CallTypeConnect:
+			w.Write([]byte(`{"open_tickets": 3}`))
+		default:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	hook, err := New(Options{Target: server.URL})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	ring := types.CallEvent{ID: "call-1", Type: types.CallTypeRing}
+	if err := hook.Enrich(context.Background(), &ring); err != nil {
+		t.Fatalf("Enrich failed: %v", err)
+	}
+	connect := types.CallEvent{ID: "call-1", Type: types.CallTypeConnect}
+	if err := hook.Enrich(context.Background(), &connect); err != nil {
+		t.Fatalf("Enrich failed: %v", err)
+	}
+	if connect.Enrichment["customer"] != "ACME Corp" || connect.Enrichment["open_tickets"] != float64(3) {
+		t.Errorf("Expected the merged fields, got %v", connect.Enrichment)
+	}
+	if ring.Enrichment["open_tickets"] != float64(2) {
+		t.Errorf("Expected earlier events to keep their fields, got %v", ring.Enrichment)
+	}
+
+	disconnect := types.CallEvent{ID: "call-1", Type: types.CallTypeDisconnect}
+	if err := hook.Enrich(context.Background(), &disconnect); err == nil {
+		t.Error("Expected an error for status 503")
+	}
+	if disconnect.Enrichment["customer"] != "ACME Corp" {
+		t.Errorf("Expected the fields of the call despite the error, got %v", disconnect.Enrichment)
+	}
+}
@@ -0,0 +1,80 @@
+package export
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/database"
+)
+
+// Supported archive formats
+const (
+	ArchiveFormatCSV  = "csv"  // gzip compressed CSV with all columns
+	ArchiveFormatNone = "none" // Calls are deleted without archiving them
+)
+
+// ArchiveFileName returns the name of the archive file of a month, e.g. calls-2025-01.csv.gz
+func ArchiveFileName(month time.Time) string {
+	return "calls-" + month.Format("2006-01") + ".csv.gz"
+}
+
+// Archive appends the calls to the archive file of the month they started in,
+// in the location, and returns the paths of the written files. A new file
+// starts with the header line; later runs append another gzip member, which
+// gzip readers decompress as one continuous CSV. The files are synced before
+// Archive returns, so the calls can be deleted afterwards.
+func Archive(dir string, calls []database.CallRecord, location *time.Location) ([]string, error) {
+	if location == nil {
+		location = time.Local
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+
+	var months []string
+	byMonth := make(map[string][]database.CallRecord)
+	for _, call := range calls {
+		name := ArchiveFileName(call.Started.In(location))
+		if _, exists := byMonth[name]; !exists {
+			months = append(months, name)
+		}
+		byMonth[name] = append(byMonth[name], call)
+	}
+
+	paths := make([]string, 0, len(months))
+	for _, name := range months {
+		path := filepath.Join(dir, name)
+		if err := appendArchive(path, byMonth[name], location); err != nil {
+			return paths, fmt.Errorf("failed to archive calls to %s: %w", path, err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+
+// appendArchive appends the calls as a gzip member to the file
+func appendArchive(path string, calls []database.CallRecord, location *time.Location) (err error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, file.Close()) }()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	compressed := gzip.NewWriter(file)
+	if err := writeCSV(compressed, calls, columns, location, info.Size() == 0); err != nil {
+		return err
+	}
+	if err := compressed.Close(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
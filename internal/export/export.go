@@ -0,0 +1,195 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/database"
+)
+
+// Supported export formats
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// column is an exported field of a call. Values are strings, ints, bools or nil for missing values.
+type column struct {
+	name  string
+	value func(call database.CallRecord, location *time.Location) any
+}
+
+var columns = []column{
+	{"id", func(c database.CallRecord, _ *time.Location) any { return c.CallID }},
+	{"start", func(c database.CallRecord, loc *time.Location) any { return formatTime(c.Started, loc) }},
+	{"end", func(c database.CallRecord, loc *time.Location) any { return formatTime(c.Ended, loc) }},
+	{"direction", func(c database.CallRecord, _ *time.Location) any { return string(c.Direction) }},
+	{"caller", func(c database.CallRecord, _ *time.Location) any { return c.Caller }},
+	{"called", func(c database.CallRecord, _ *time.Location) any { return c.Called }},
+	{"caller_msn", func(c database.CallRecord, _ *time.Location) any { return c.CallerMSN }},
+	{"called_msn", func(c database.CallRecord, _ *time.Location) any { return c.CalledMSN }},
+	{"line", func(c database.CallRecord, _ *time.Location) any { return c.Line }},
+	{"trunk", func(c database.CallRecord, _ *time.Location) any { return c.Trunk }},
+	{"duration", func(c database.CallRecord, _ *time.Location) any { return c.Duration }},
+	{"answered", func(c database.CallRecord, _ *time.Location) any { return c.Duration > 0 }},
+}
+
+// Columns returns the names of all columns in their default order
+func Columns() []string {
+	names := make([]string, 0, len(columns))
+	for _, c := range columns {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+// Options configures an export
+type Options struct {
+	Format   string         // csv or json
+	Columns  []string       // Exported columns in this order (default: all)
+	Location *time.Location // Timezone of the exported times (default: local)
+}
+
+// Validate checks the format and column names
+func (o Options) Validate() error {
+	if o.Format != FormatCSV && o.Format != FormatJSON {
+		return fmt.Errorf("invalid export format '%s', expected csv or json", o.Format)
+	}
+	_, err := selectColumns(o.Columns)
+	return err
+}
+
+// Write exports the calls to w. CSV gets a header line, JSON is an array of objects.
+func Write(w io.Writer, calls []database.CallRecord, opts Options) error {
+	selected, err := selectColumns(opts.Columns)
+	if err != nil {
+		return err
+	}
+	location := opts.Location
+	if location == nil {
+		location = time.Local
+	}
+
+	switch opts.Format {
+	case FormatCSV:
+		return writeCSV(w, calls, selected, location, true)
+	case FormatJSON:
+		return writeJSON(w, calls, selected, location)
+	default:
+		return fmt.Errorf("invalid export format '%s', expected csv or json", opts.Format)
+	}
+}
+
+// selectColumns looks up the columns by name
+func selectColumns(names []string) ([]column, error) {
+	if len(names) == 0 {
+		return columns, nil
+	}
+	selected := make([]column, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		found := false
+		for _, c := range columns {
+			if c.name == name {
+				selected = append(selected, c)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column '%s', expected one of %s", name, strings.Join(Columns(), ", "))
+		}
+	}
+	return selected, nil
+}
+
+// writeCSV writes the calls as CSV, starting with a header line if header is set
+func writeCSV(w io.Writer, calls []database.CallRecord, selected []column, location *time.Location, header bool) error {
+	writer := csv.NewWriter(w)
+	record := make([]string, len(selected))
+	if header {
+		for i, c := range selected {
+			record[i] = c.name
+		}
+		_ = writer.Write(record)
+	}
+
+	for _, call := range calls {
+		for i, c := range selected {
+			switch value := c.value(call, location).(type) {
+			case nil:
+				record[i] = ""
+			case string:
+				record[i] = value
+			case int:
+				record[i] = strconv.Itoa(value)
+			case bool:
+				record[i] = strconv.FormatBool(value)
+			}
+		}
+		_ = writer.Write(record)
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// writeJSON writes the objects field by field, so the keys keep the column order
+func writeJSON(w io.Writer, calls []database.CallRecord, selected []column, location *time.Location) error {
+	var buf bytes.Buffer
+	buf.WriteString("[")
+	for i, call := range calls {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		buf.WriteString("\n  {")
+		for j, c := range selected {
+			if j > 0 {
+				buf.WriteString(", ")
+			}
+			key, _ := json.Marshal(c.name)
+			value, err := json.Marshal(c.value(call, location))
+			if err != nil {
+				return fmt.Errorf("failed to encode %s of call %s: %w", c.name, call.CallID, err)
+			}
+			buf.Write(key)
+			buf.WriteString(": ")
+			buf.Write(value)
+		}
+		buf.WriteString("}")
+	}
+	if len(calls) > 0 {
+		buf.WriteString("\n")
+	}
+	buf.WriteString("]\n")
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// formatTime formats t as RFC 3339 in the location, nil for the zero time
+func formatTime(t time.Time, location *time.Location) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.In(location).Format(time.RFC3339)
+}
+
+// ParseTime parses a date (2025-01-01), a local date and time (2025-01-01T08:00)
+// in the location, or an RFC 3339 timestamp
+func ParseTime(value string, location *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{time.DateOnly, "2006-01-02T15:04", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, value, location); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time '%s', expected YYYY-MM-DD, YYYY-MM-DDTHH:MM or RFC 3339", value)
+}
@@ -0,0 +1,159 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/database"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+var exportedCalls = []database.CallRecord{
+	{
+		CallID: "out", Started: time.Date(2025, 1, 31, 22, 0, 0, 0, time.UTC), Ended: time.Date(2025, 1, 31, 22, 0, 45, 0, time.UTC),
+		Direction: types.CallDirectionOutbound, Caller: "990133", Called: "01701234567", CallerMSN: "990133", Line: 1, Trunk: "SIP0", Duration: 42,
+	},
+	{CallID: "ringing", Started: time.Date(2025, 1, 31, 22, 1, 0, 0, time.UTC), Direction: types.CallDirectionInbound, Caller: "+4930123456, ext"},
+}
+
+func TestWriteCSV(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("Timezone data not available: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, exportedCalls, Options{Format: FormatCSV, Columns: []string{"start", "end", "caller", " duration", "answered"}, Location: berlin}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	expected := "start,end,caller,duration,answered\n" +
+		"2025-01-31T23:00:00+01:00,2025-01-31T23:00:45+01:00,990133,42,true\n" +
+		"2025-01-31T23:01:00+01:00,,\"+4930123456, ext\",0,false\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected CSV:\n%s", buf.String())
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, exportedCalls, Options{Format: FormatJSON, Columns: []string{"id", "end", "line"}, Location: time.UTC}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	expected := "[\n" +
+		`  {"id": "out", "end": "2025-01-31T22:00:45Z", "line": 1},` + "\n" +
+		`  {"id": "ringing", "end": null, "line": 0}` + "\n" +
+		"]\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected JSON:\n%s", buf.String())
+	}
+
+	buf.Reset()
+	if err := Write(&buf, nil, Options{Format: FormatJSON}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	var decoded []map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || len(decoded) != 0 {
+		t.Errorf("Expected empty JSON array, got %q", buf.String())
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        Options
+		expectError bool
+	}{
+		{"csv with all columns", Options{Format: FormatCSV}, false},
+		{"json with columns", Options{Format: FormatJSON, Columns: []string{"id", "duration"}}, false},
+		{"unknown format", Options{Format: "xml"}, true},
+		{"unknown column", Options{Format: FormatCSV, Columns: []string{"id", "cost"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.opts.Validate()
+			if tt.expectError && err == nil {
+				t.Error("Expected validation error, but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected validation error: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("Timezone data not available: %v", err)
+	}
+
+	tests := []struct {
+		value    string
+		expected time.Time
+	}{
+		{"2025-01-01", time.Date(2024, 12, 31, 23, 0, 0, 0, time.UTC)},
+		{"2025-07-01T08:30", time.Date(2025, 7, 1, 6, 30, 0, 0, time.UTC)},
+		{"2025-07-01T08:30:00Z", time.Date(2025, 7, 1, 8, 30, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		parsed, err := ParseTime(tt.value, berlin)
+		if err != nil {
+			t.Errorf("ParseTime(%q) failed: %v", tt.value, err)
+			continue
+		}
+		if !parsed.Equal(tt.expected) {
+			t.Errorf("ParseTime(%q) = %v, expected %v", tt.value, parsed, tt.expected)
+		}
+	}
+
+	if _, err := ParseTime("01.01.2025", berlin); err == nil {
+		t.Error("Expected error for unsupported date format")
+	}
+}
+
+func TestArchive(t *testing.T) {
+	dir := t.TempDir()
+	february := database.CallRecord{CallID: "feb", Started: time.Date(2025, 2, 1, 8, 0, 0, 0, time.UTC), Direction: types.CallDirectionInbound}
+
+	// Calls archived in two runs end up in one file per month with a single header line
+	paths, err := Archive(dir, exportedCalls[:1], time.UTC)
+	if err != nil {
+		t.Fatalf("Archive failed: %v", err)
+	}
+	if len(paths) != 1 || filepath.Base(paths[0]) != "calls-2025-01.csv.gz" {
+		t.Errorf("Expected the January archive, got %v", paths)
+	}
+	if paths, err = Archive(dir, []database.CallRecord{exportedCalls[1], february}, time.UTC); err != nil {
+		t.Fatalf("Archive failed: %v", err)
+	}
+	if len(paths) != 2 {
+		t.Errorf("Expected the January and February archives, got %v", paths)
+	}
+
+	file, err := os.Open(filepath.Join(dir, "calls-2025-01.csv.gz"))
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("Invalid gzip archive: %v", err)
+	}
+	records, err := csv.NewReader(reader).ReadAll()
+	if err != nil {
+		t.Fatalf("Invalid CSV archive: %v", err)
+	}
+	if len(records) != 3 || records[0][0] != "id" || records[1][0] != "out" || records[2][0] != "ringing" {
+		t.Errorf("Expected the header and both January calls, got %v", records)
+	}
+}
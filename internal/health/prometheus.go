@@ -0,0 +1,102 @@
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetricPrefix starts the names of all metrics of the Prometheus endpoint
+const MetricPrefix = "fritz_callmonitor"
+
+// Prometheus returns the metrics in the Prometheus text format, one sample
+// per number of the stats. Nested fields are joined with underscores, e.g.
+// stats.database.rows.calls becomes fritz_callmonitor_database_rows_calls.
+// Booleans are 1 or 0, timestamps seconds since the epoch; other values
+// like strings and lists are left out.
+func (s *Server) Prometheus() ([]byte, error) {
+	metrics, err := s.Metrics(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := map[string]float64{MetricPrefix + "_uptime_seconds": float64(metrics.UptimeSeconds)}
+	if metrics.LastEvent != nil {
+		samples[MetricPrefix+"_last_event_timestamp_seconds"] = float64(metrics.LastEvent.Unix())
+	}
+	for name, stats := range metrics.Stats {
+		// Decoding the JSON of the stats names their fields as in /healthz
+		data, err := json.Marshal(stats)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode stats %s: %w", name, err)
+		}
+		var value any
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, fmt.Errorf("failed to decode stats %s: %w", name, err)
+		}
+		flatten(samples, MetricPrefix+"_"+metricName(name), value)
+	}
+
+	names := make([]string, 0, len(samples))
+	for name := range samples {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteString(name)
+		sb.WriteByte(' ')
+		sb.WriteString(strconv.FormatFloat(samples[name], 'g', -1, 64))
+		sb.WriteByte('\n')
+	}
+	return []byte(sb.String()), nil
+}
+
+// flatten adds the numbers of a decoded JSON value as samples below name
+func flatten(samples map[string]float64, name string, value any) {
+	switch v := value.(type) {
+	case float64:
+		samples[name] = v
+	case bool:
+		samples[name] = 0
+		if v {
+			samples[name] = 1
+		}
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil && !t.IsZero() {
+			samples[strings.TrimSuffix(name, "_at")+"_timestamp_seconds"] = float64(t.UnixNano()) / 1e9
+		}
+	case map[string]any:
+		for key, field := range v {
+			flatten(samples, name+"_"+metricName(key), field)
+		}
+	}
+}
+
+// metricName replaces the characters not allowed in metric names by underscores
+func metricName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, name)
+}
+
+// servePrometheus writes the metrics for a Prometheus scrape
+func (s *Server) servePrometheus(w http.ResponseWriter, _ *http.Request) {
+	body, err := s.Prometheus()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := w.Write(body); err != nil {
+		log.Printf("Failed to write metrics response: %v", err)
+	}
+}
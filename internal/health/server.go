@@ -0,0 +1,328 @@
+package health
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CheckTimeout bounds the time all dependency checks of one request may take
+const CheckTimeout = 2 * time.Second
+
+// Checker reports whether a dependency is usable; nil means up
+type Checker func(ctx context.Context) error
+
+// CheckResult is the state of a single dependency
+type CheckResult struct {
+	Status string `json:"status"` // "up" or "down"
+	Error  string `json:"error,omitempty"`
+}
+
+// Stats returns counters reported along with the checks, e.g. of a queue
+type Stats func() any
+
+// Response is the JSON body of /healthz and /readyz
+type Response struct {
+	Status        string                 `json:"status"` // "ok" or "unavailable"
+	Uptime        string                 `json:"uptime"`
+	UptimeSeconds int64                  `json:"uptime_seconds"`
+	LastEvent     *time.Time             `json:"last_event,omitempty"`
+	Checks        map[string]CheckResult `json:"checks"`
+	Stats         map[string]any         `json:"stats,omitempty"`
+
+	// Rest of the startup grace period, only reported by /readyz
+	GraceRemaining        string `json:"grace_remaining,omitempty"`
+	GraceRemainingSeconds int64  `json:"grace_remaining_seconds,omitempty"`
+}
+
+// Metrics is a snapshot of the stats for monitoring without the HTTP endpoints
+type Metrics struct {
+	UptimeSeconds int64          `json:"uptime_seconds"`
+	LastEvent     *time.Time     `json:"last_event,omitempty"`
+	Stats         map[string]any `json:"stats"`
+}
+
+// check is a registered dependency check
+type check struct {
+	name     string
+	liveness bool
+	checker  Checker
+}
+
+// Server serves the liveness (/healthz) and readiness (/readyz) endpoints
+// and the stats for Prometheus (/metrics)
+type Server struct {
+	port      int
+	started   time.Time
+	lastEvent atomic.Int64 // Unix nanoseconds of the last call event, 0 if none
+
+	mu         sync.RWMutex
+	checks     []check
+	stats      map[string]Stats
+	handlers   map[string]http.Handler // Additional routes served on the same port
+	apiToken   string                  // Bearer token of requests changing data (empty = loopback clients only)
+	graceUntil time.Time               // Failing checks do not fail readiness before
+
+	server     *http.Server
+	stopServer context.CancelFunc // Ends long-lived requests, e.g. event streams, on shutdown
+}
+
+// NewServer creates a health server listening on the given port once started
+func NewServer(port int) *Server {
+	return &Server{
+		port:    port,
+		started: time.Now(),
+	}
+}
+
+// AddLivenessCheck registers a dependency whose failure requires a restart.
+// Liveness checks also count for readiness.
+func (s *Server) AddLivenessCheck(name string, checker Checker) {
+	s.addCheck(check{name: name, liveness: true, checker: checker})
+}
+
+// AddReadinessCheck registers a dependency the service recovers from by itself,
+// e.g. a Fritz!Box that is temporarily unreachable
+func (s *Server) AddReadinessCheck(name string, checker Checker) {
+	s.addCheck(check{name: name, checker: checker})
+}
+
+// AddStats reports counters under the given name without affecting the status
+func (s *Server) AddStats(name string, stats Stats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stats == nil {
+		s.stats = make(map[string]Stats)
+	}
+	s.stats[name] = stats
+}
+
+func (s *Server) addCheck(c check) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checks = append(s.checks, c)
+}
+
+// Handle serves an additional route, e.g. an API, on the health check port.
+// Routes must be registered before Start.
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.handlers == nil {
+		s.handlers = make(map[string]http.Handler)
+	}
+	s.handlers[pattern] = handler
+}
+
+// SetAPIToken sets the bearer token requests to the routes added with Handle
+// need unless they only read. Without a token only clients on the loopback
+// interface may change data. The token must be set before Start.
+func (s *Server) SetAPIToken(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.apiToken = token
+}
+
+// SetStartupGrace keeps /readyz ready until the given time, while the
+// connections settle after a start. /healthz is not affected.
+func (s *Server) SetStartupGrace(until time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.graceUntil = until
+}
+
+// RecordEvent remembers the time of the most recent call event
+func (s *Server) RecordEvent(t time.Time) {
+	s.lastEvent.Store(t.UnixNano())
+}
+
+// Handler returns the HTTP handler serving /healthz, /readyz, /metrics and the routes added with Handle
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	s.mu.RLock()
+	for pattern, handler := range s.handlers {
+		mux.Handle(pattern, authorize(handler, s.apiToken))
+	}
+	s.mu.RUnlock()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		s.serve(w, r, true)
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		s.serve(w, r, false)
+	})
+	mux.HandleFunc("GET /metrics", s.servePrometheus)
+	return mux
+}
+
+// readMethods are served without authorization
+var readMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions}
+
+// authorize passes requests changing data to handler only with the bearer
+// token or, if token is empty, from a loopback address
+func authorize(handler http.Handler, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slices.Contains(readMethods, r.Method) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		if token == "" {
+			if address, err := netip.ParseAddrPort(r.RemoteAddr); err != nil || !address.Addr().Unmap().IsLoopback() {
+				writeError(w, http.StatusForbidden, "changes are only allowed from localhost unless an API token is configured")
+				return
+			}
+		} else if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "invalid or missing API token")
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// writeError writes a JSON error response like the APIs served on the port
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// Start listens on the configured port and serves requests in the background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", net.JoinHostPort("", strconv.Itoa(s.port)))
+	if err != nil {
+		return fmt.Errorf("failed to listen for health checks: %w", err)
+	}
+
+	base, stop := context.WithCancel(context.Background())
+	s.stopServer = stop
+	s.server = &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+		BaseContext:       func(net.Listener) context.Context { return base },
+	}
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Health check server stopped: %v", err)
+		}
+	}()
+
+	log.Printf("Health checks available on port %d (/healthz, /readyz, /metrics)", s.port)
+	return nil
+}
+
+// Shutdown stops the HTTP server
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.server == nil {
+		return nil
+	}
+	s.stopServer()
+	return s.server.Shutdown(ctx)
+}
+
+// Status runs the checks and builds the response. With livenessOnly set,
+// only liveness checks decide the overall status.
+func (s *Server) Status(ctx context.Context, livenessOnly bool) Response {
+	s.mu.RLock()
+	checks := make([]check, len(s.checks))
+	copy(checks, s.checks)
+	var stats map[string]any
+	if len(s.stats) > 0 {
+		stats = s.collectStats(nil)
+	}
+	grace := time.Until(s.graceUntil)
+	s.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+	defer cancel()
+
+	uptime := time.Since(s.started)
+	response := Response{
+		Status:        "ok",
+		Uptime:        uptime.Truncate(time.Second).String(),
+		UptimeSeconds: int64(uptime.Seconds()),
+		Checks:        make(map[string]CheckResult, len(checks)),
+		Stats:         stats,
+	}
+
+	if nanos := s.lastEvent.Load(); nanos != 0 {
+		lastEvent := time.Unix(0, nanos)
+		response.LastEvent = &lastEvent
+	}
+
+	inGrace := !livenessOnly && grace > 0
+	if inGrace {
+		response.GraceRemaining = grace.Round(time.Second).String()
+		response.GraceRemainingSeconds = int64(grace.Seconds())
+	}
+
+	for _, c := range checks {
+		result := CheckResult{Status: "up"}
+		if err := c.checker(ctx); err != nil {
+			result = CheckResult{Status: "down", Error: err.Error()}
+			if (c.liveness || !livenessOnly) && !inGrace {
+				response.Status = "unavailable"
+			}
+		}
+		response.Checks[c.name] = result
+	}
+
+	return response
+}
+
+// Metrics returns the stats registered under the given names, all of them
+// if names is empty. Unknown names are an error.
+func (s *Server) Metrics(names []string) (Metrics, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, name := range names {
+		if _, ok := s.stats[name]; !ok {
+			return Metrics{}, fmt.Errorf("unknown stats '%s'", name)
+		}
+	}
+
+	metrics := Metrics{
+		UptimeSeconds: int64(time.Since(s.started).Seconds()),
+		Stats:         s.collectStats(names),
+	}
+	if nanos := s.lastEvent.Load(); nanos != 0 {
+		lastEvent := time.Unix(0, nanos)
+		metrics.LastEvent = &lastEvent
+	}
+	return metrics, nil
+}
+
+// collectStats calls the stats of the names, all if names is empty; s.mu must be held
+func (s *Server) collectStats(names []string) map[string]any {
+	stats := make(map[string]any, len(s.stats))
+	for name, fn := range s.stats {
+		if len(names) == 0 || slices.Contains(names, name) {
+			stats[name] = fn()
+		}
+	}
+	return stats
+}
+
+// serve writes the status as JSON, using 503 if the service is unavailable
+func (s *Server) serve(w http.ResponseWriter, r *http.Request, livenessOnly bool) {
+	response := s.Status(r.Context(), livenessOnly)
+
+	w.Header().Set("Content-Type", "application/json")
+	if response.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("Failed to write health response: %v", err)
+	}
+}
@@ -0,0 +1,247 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEndpoints(t *testing.T) {
+	mqttUp := true
+	fritzBoxUp := true
+
+	server := NewServer(0)
+	server.AddLivenessCheck("mqtt", func(ctx context.Context) error {
+		if !mqttUp {
+			return errors.New("not connected")
+		}
+		return nil
+	})
+	server.AddReadinessCheck("callmonitor", func(ctx context.Context) error {
+		if !fritzBoxUp {
+			return errors.New("not connected")
+		}
+		return nil
+	})
+
+	tests := []struct {
+		name          string
+		mqttUp        bool
+		fritzBoxUp    bool
+		healthzStatus int
+		readyzStatus  int
+	}{
+		{"all up", true, true, http.StatusOK, http.StatusOK},
+		{"fritz!box down", true, false, http.StatusOK, http.StatusServiceUnavailable},
+		{"mqtt down", false, true, http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mqttUp = tt.mqttUp
+			fritzBoxUp = tt.fritzBoxUp
+
+			for path, expected := range map[string]int{"/healthz": tt.healthzStatus, "/readyz": tt.readyzStatus} {
+				recorder := httptest.NewRecorder()
+				server.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+
+				if recorder.Code != expected {
+					t.Errorf("%s: expected status %d, got %d", path, expected, recorder.Code)
+				}
+
+				var response Response
+				if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+					t.Fatalf("%s: invalid JSON: %v", path, err)
+				}
+				if len(response.Checks) != 2 {
+					t.Errorf("%s: expected 2 checks, got %v", path, response.Checks)
+				}
+				if !tt.fritzBoxUp && response.Checks["callmonitor"].Status != "down" {
+					t.Errorf("%s: expected callmonitor to be reported down", path)
+				}
+			}
+		})
+	}
+}
+
+func TestRecordEvent(t *testing.T) {
+	server := NewServer(0)
+
+	if server.Status(context.Background(), false).LastEvent != nil {
+		t.Error("Expected no last event before any event was recorded")
+	}
+
+	eventTime := time.Date(2025, 9, 21, 15, 35, 0, 0, time.UTC)
+	server.RecordEvent(eventTime)
+
+	lastEvent := server.Status(context.Background(), false).LastEvent
+	if lastEvent == nil || !lastEvent.Equal(eventTime) {
+		t.Errorf("Expected last event %v, got %v", eventTime, lastEvent)
+	}
+}
+
+func TestAddStats(t *testing.T) {
+	server := NewServer(0)
+	if stats := server.Status(context.Background(), true).Stats; stats != nil {
+		t.Errorf("Expected no stats, got %v", stats)
+	}
+
+	server.AddStats("queue", func() any { return map[string]int{"dropped": 3} })
+
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	var response struct {
+		Stats map[string]map[string]int `json:"stats"`
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if response.Stats["queue"]["dropped"] != 3 {
+		t.Errorf("Expected the queue stats, got %v", response.Stats)
+	}
+}
+
+func TestStartupGrace(t *testing.T) {
+	server := NewServer(0)
+	server.AddLivenessCheck("mqtt", func(ctx context.Context) error { return errors.New("not connected") })
+	server.AddReadinessCheck("callmonitor", func(ctx context.Context) error { return errors.New("not connected") })
+	server.SetStartupGrace(time.Now().Add(time.Minute))
+
+	ready := server.Status(context.Background(), false)
+	if ready.Status != "ok" || ready.GraceRemainingSeconds <= 0 || ready.Checks["callmonitor"].Status != "down" {
+		t.Errorf("Expected ready in the grace period with the checks down, got %+v", ready)
+	}
+	if live := server.Status(context.Background(), true); live.Status != "unavailable" || live.GraceRemaining != "" {
+		t.Errorf("Expected liveness to ignore the grace period, got %+v", live)
+	}
+
+	server.SetStartupGrace(time.Now())
+	if ready := server.Status(context.Background(), false); ready.Status != "unavailable" || ready.GraceRemaining != "" {
+		t.Errorf("Expected unavailable after the grace period, got %+v", ready)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	server := NewServer(0)
+	server.AddStats("queue", func() any { return 3 })
+	server.AddStats("restarts", func() any { return 1 })
+
+	metrics, err := server.Metrics(nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(metrics.Stats) != 2 || metrics.LastEvent != nil {
+		t.Errorf("Expected all stats and no event, got %+v", metrics)
+	}
+
+	server.RecordEvent(time.Now())
+	metrics, err = server.Metrics([]string{"queue"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(metrics.Stats) != 1 || metrics.Stats["queue"] != 3 || metrics.LastEvent == nil {
+		t.Errorf("Expected the queue stats and the last event, got %+v", metrics)
+	}
+
+	if _, err := server.Metrics([]string{"unknown"}); err == nil {
+		t.Error("Expected an error for unknown stats")
+	}
+}
+
+func TestHandle(t *testing.T) {
+	server := NewServer(0)
+	server.Handle("GET /api/ping", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("pong"))
+	}))
+
+	for path, expected := range map[string]int{"/api/ping": http.StatusOK, "/healthz": http.StatusOK, "/api/unknown": http.StatusNotFound} {
+		recorder := httptest.NewRecorder()
+		server.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+		if recorder.Code != expected {
+			t.Errorf("%s: expected status %d, got %d", path, expected, recorder.Code)
+		}
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		method        string
+		remoteAddr    string
+		authorization string
+		expected      int
+	}{
+		{"read from anywhere", "", http.MethodGet, "192.0.2.1:1234", "", http.StatusOK},
+		{"change from localhost", "", http.MethodDelete, "127.0.0.1:1234", "", http.StatusNoContent},
+		{"change from ipv6 localhost", "", http.MethodDelete, "[::1]:1234", "", http.StatusNoContent},
+		{"change from remote", "", http.MethodDelete, "192.0.2.1:1234", "", http.StatusForbidden},
+		{"change with token", "secret", http.MethodPost, "192.0.2.1:1234", "Bearer secret", http.StatusNoContent},
+		{"change with wrong token", "secret", http.MethodPost, "192.0.2.1:1234", "Bearer guess", http.StatusUnauthorized},
+		{"change from localhost without token", "secret", http.MethodPost, "127.0.0.1:1234", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(0)
+			server.SetAPIToken(tt.token)
+			server.Handle("/api/calls", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodGet {
+					w.WriteHeader(http.StatusOK)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			}))
+
+			request := httptest.NewRequest(tt.method, "/api/calls", nil)
+			request.RemoteAddr = tt.remoteAddr
+			if tt.authorization != "" {
+				request.Header.Set("Authorization", tt.authorization)
+			}
+			recorder := httptest.NewRecorder()
+			server.Handler().ServeHTTP(recorder, request)
+			if recorder.Code != tt.expected {
+				t.Errorf("Expected status %d, got %d: %s", tt.expected, recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+}
+
+func TestPrometheus(t *testing.T) {
+	server := NewServer(0)
+	server.AddStats("database", func() any {
+		return struct {
+			Rows        map[string]int64 `json:"rows"`
+			Driver      string           `json:"driver"`
+			Healthy     bool             `json:"healthy"`
+			CollectedAt time.Time        `json:"collected_at"`
+		}{map[string]int64{"calls": 1200}, "sqlite", true, time.Unix(1758462900, 0)}
+	})
+	server.AddStats("mqtt-publish", func() any { return map[string]float64{"avg_seconds": 0.25} })
+
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Fatalf("Expected a text response, got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	body := rec.Body.String()
+	for _, sample := range []string{
+		"fritz_callmonitor_database_rows_calls 1200\n",
+		"fritz_callmonitor_database_healthy 1\n",
+		"fritz_callmonitor_database_collected_timestamp_seconds 1.7584629e+09\n",
+		"fritz_callmonitor_mqtt_publish_avg_seconds 0.25\n",
+		"fritz_callmonitor_uptime_seconds ",
+	} {
+		if !strings.Contains(body, sample) {
+			t.Errorf("Expected sample %q, got:\n%s", sample, body)
+		}
+	}
+	if strings.Contains(body, "driver") {
+		t.Errorf("Expected strings to be left out, got:\n%s", body)
+	}
+}
@@ -0,0 +1,152 @@
+package influx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// Exporter writes finished calls as line protocol points to InfluxDB v2 or any
+// other endpoint accepting line protocol, e.g. Telegraf or VictoriaMetrics
+type Exporter struct {
+	writeURL    string
+	token       string
+	measurement string
+	filter      types.HistoryFilter
+	httpClient  *http.Client
+}
+
+// Options configures an exporter
+type Options struct {
+	URL         string              // InfluxDB v2 server URL, or the full write URL of a generic endpoint
+	Token       string              // Sent as "Authorization: Token ..." if set
+	Org         string              // InfluxDB v2 organization
+	Bucket      string              // InfluxDB v2 bucket; without it URL is used as is
+	Measurement string              // Name of the measurement (default: calls)
+	Timeout     time.Duration       // Upper bound for a single write
+	Filter      types.HistoryFilter // Calls that are exported (default: all)
+	HTTPClient  *http.Client        // Overrides the client built from Timeout
+}
+
+// DefaultOptions returns the options used when nothing else is configured
+func DefaultOptions() Options {
+	return Options{
+		Measurement: "calls",
+		Timeout:     10 * time.Second,
+	}
+}
+
+// withDefaults fills unset fields from DefaultOptions
+func (o Options) withDefaults() Options {
+	defaults := DefaultOptions()
+	if o.Measurement == "" {
+		o.Measurement = defaults.Measurement
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = defaults.Timeout
+	}
+	if o.HTTPClient == nil {
+		o.HTTPClient = &http.Client{Timeout: o.Timeout}
+	}
+	return o
+}
+
+// NewExporter creates a new exporter
+func NewExporter(opts Options) (*Exporter, error) {
+	opts = opts.withDefaults()
+
+	writeURL, err := url.Parse(opts.URL)
+	if err != nil || (writeURL.Scheme != "http" && writeURL.Scheme != "https") || writeURL.Host == "" {
+		return nil, fmt.Errorf("invalid line protocol URL '%s'", opts.URL)
+	}
+
+	// InfluxDB v2 takes organization and bucket as query parameters of its write API
+	if opts.Bucket != "" {
+		writeURL = writeURL.JoinPath("api", "v2", "write")
+		query := writeURL.Query()
+		query.Set("org", opts.Org)
+		query.Set("bucket", opts.Bucket)
+		writeURL.RawQuery = query.Encode()
+	}
+
+	return &Exporter{
+		writeURL:    writeURL.String(),
+		token:       opts.Token,
+		measurement: opts.Measurement,
+		filter:      opts.Filter,
+		httpClient:  opts.HTTPClient,
+	}, nil
+}
+
+// PublishCallEvent exports a call once it is finished. Events flagged as
+// do-not-record and calls not matching the filter are skipped.
+func (e *Exporter) PublishCallEvent(ctx context.Context, event types.CallEvent) error {
+	if event.DoNotRecord || event.Type != types.CallTypeDisconnect || !e.filter.Matches(event) {
+		return nil
+	}
+	return e.Write(ctx, Point(e.measurement, event))
+}
+
+// Write sends line protocol points in a single request
+func (e *Exporter) Write(ctx context.Context, lines ...string) error {
+	body := strings.Join(lines, "\n") + "\n"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.writeURL, strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create write request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if e.token != "" {
+		req.Header.Set("Authorization", "Token "+e.token)
+	}
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to write points: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("write rejected with HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+)
+
+// Point formats the disconnect event of a call as a line protocol point.
+// Phone numbers are left out, they would blow up the series cardinality.
+func Point(measurement string, event types.CallEvent) string {
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(measurement))
+
+	// Tags in key order, as recommended for write performance
+	tags := []struct{ key, value string }{
+		{"direction", string(event.Direction)},
+		{"extension", event.Extension},
+		{"finish_state", ""},
+		{"line", fmt.Sprint(event.Line)},
+		{"trunk", event.Trunk},
+	}
+	if event.FinishState != nil {
+		tags[2].value = string(*event.FinishState)
+	}
+	for _, tag := range tags {
+		if tag.value != "" {
+			fmt.Fprintf(&b, ",%s=%s", tag.key, tagEscaper.Replace(tag.value))
+		}
+	}
+
+	fmt.Fprintf(&b, " duration=%di,message_box=%t %d", event.Duration, event.MessageBox, event.Timestamp.UnixNano())
+	return b.String()
+}
@@ -0,0 +1,156 @@
+package influx
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+func finishedCall(direction types.CallDirection, finish types.CallStatus) types.CallEvent {
+	return types.CallEvent{
+		ID:          "0199a8c4-0000-7000-8000-000000000001",
+		Timestamp:   time.Unix(1758468900, 0),
+		Type:        types.CallTypeDisconnect,
+		Direction:   direction,
+		Line:        2,
+		Trunk:       "SIP0",
+		Caller:      "+4930123456",
+		Called:      "+4930990133",
+		Duration:    42,
+		Status:      types.CallStatusIdle,
+		FinishState: &finish,
+	}
+}
+
+func TestPoint(t *testing.T) {
+	tests := []struct {
+		name        string
+		measurement string
+		event       types.CallEvent
+		expected    string
+	}{
+		{
+			name:        "finished call",
+			measurement: "calls",
+			event:       finishedCall(types.CallDirectionInbound, types.CallStatusFinished),
+			expected:    "calls,direction=inbound,finish_state=finished,line=2,trunk=SIP0 duration=42i,message_box=false 1758468900000000000",
+		},
+		{
+			name:        "escaped values",
+			measurement: "fritz calls",
+			event: func() types.CallEvent {
+				event := finishedCall(types.CallDirectionOutbound, types.CallStatusNotReached)
+				event.Trunk = "SIP 1,a=b"
+				event.Extension = "1"
+				return event
+			}(),
+			expected: `fritz\ calls,direction=outbound,extension=1,finish_state=notReached,line=2,trunk=SIP\ 1\,a\=b duration=42i,message_box=false 1758468900000000000`,
+		},
+		{
+			name:        "without finish state",
+			measurement: "calls",
+			event: func() types.CallEvent {
+				event := finishedCall(types.CallDirectionInbound, types.CallStatusFinished)
+				event.FinishState = nil
+				event.Trunk = ""
+				return event
+			}(),
+			expected: "calls,direction=inbound,line=2 duration=42i,message_box=false 1758468900000000000",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if point := Point(tt.measurement, tt.event); point != tt.expected {
+				t.Errorf("Expected\n%s\ngot\n%s", tt.expected, point)
+			}
+		})
+	}
+}
+
+func TestExporter(t *testing.T) {
+	var requests []*http.Request
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+		if r.Header.Get("Authorization") != "Token secret" {
+			http.Error(w, `{"code":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	filter, err := types.ParseHistoryFilter([]string{"missedCall", "finished"}, nil)
+	if err != nil {
+		t.Fatalf("ParseHistoryFilter failed: %v", err)
+	}
+	exporter, err := NewExporter(Options{URL: server.URL, Token: "secret", Org: "home", Bucket: "fritz", Filter: filter})
+	if err != nil {
+		t.Fatalf("NewExporter failed: %v", err)
+	}
+
+	ring := finishedCall(types.CallDirectionInbound, types.CallStatusFinished)
+	ring.Type = types.CallTypeRing
+	optedOut := finishedCall(types.CallDirectionInbound, types.CallStatusFinished)
+	optedOut.DoNotRecord = true
+
+	events := []types.CallEvent{
+		ring,
+		optedOut,
+		finishedCall(types.CallDirectionOutbound, types.CallStatusNotReached),
+		finishedCall(types.CallDirectionInbound, types.CallStatusMissedCall),
+	}
+	for _, event := range events {
+		if err := exporter.PublishCallEvent(context.Background(), event); err != nil {
+			t.Fatalf("PublishCallEvent failed: %v", err)
+		}
+	}
+
+	if len(requests) != 1 {
+		t.Fatalf("Expected only the missed call to be exported, got %d requests", len(requests))
+	}
+	if requests[0].URL.Path != "/api/v2/write" || requests[0].URL.Query().Get("org") != "home" || requests[0].URL.Query().Get("bucket") != "fritz" {
+		t.Errorf("Unexpected write URL %s", requests[0].URL)
+	}
+	if !strings.HasPrefix(bodies[0], "calls,direction=inbound,finish_state=missedCall,") {
+		t.Errorf("Unexpected point %q", bodies[0])
+	}
+
+	t.Run("generic endpoint", func(t *testing.T) {
+		generic, err := NewExporter(Options{URL: server.URL + "/write?db=fritz", Token: "secret"})
+		if err != nil {
+			t.Fatalf("NewExporter failed: %v", err)
+		}
+		if err := generic.Write(context.Background(), "calls duration=1i"); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		if last := requests[len(requests)-1]; last.URL.String() != "/write?db=fritz" {
+			t.Errorf("Expected URL to be used as is, got %s", last.URL)
+		}
+	})
+
+	t.Run("rejected write", func(t *testing.T) {
+		unauthorized, err := NewExporter(Options{URL: server.URL, Org: "home", Bucket: "fritz"})
+		if err != nil {
+			t.Fatalf("NewExporter failed: %v", err)
+		}
+		if err := unauthorized.Write(context.Background(), "calls duration=1i"); err == nil || !strings.Contains(err.Error(), "HTTP 401") {
+			t.Errorf("Expected HTTP 401 error, got %v", err)
+		}
+	})
+
+	t.Run("invalid URL", func(t *testing.T) {
+		if _, err := NewExporter(Options{URL: "influx:8086"}); err == nil {
+			t.Error("Expected URL without scheme to be rejected")
+		}
+	})
+}
@@ -0,0 +1,165 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// MissedCallEscalation is the notification sent when no consumer acknowledged a missed call in time
+type MissedCallEscalation struct {
+	Reason  string           `json:"reason"`  // Always "missed_call_unacknowledged"
+	Timeout int              `json:"timeout"` // Seconds waited for the acknowledgement
+	Call    types.MissedCall `json:"call"`
+}
+
+// AckStore persists pending missed call acknowledgements, so escalations are
+// still sent after a restart of the bridge
+type AckStore interface {
+	PendingAcks(ctx context.Context) ([]types.PendingAck, error)
+	SavePendingAck(ctx context.Context, ack types.PendingAck) error
+	DeletePendingAck(ctx context.Context, callID string) error
+}
+
+// RestoreMissedCallAcks continues waiting for the acknowledgements pending in
+// the store and saves every further change there. Acknowledgements whose
+// deadline passed while the bridge was down are escalated right away.
+func (c *Client) RestoreMissedCallAcks(ctx context.Context, store AckStore) error {
+	if c.ackTimeout <= 0 {
+		return nil
+	}
+	acks, err := store.PendingAcks(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load pending missed call acknowledgements: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ackStore = store
+	for _, ack := range acks {
+		if _, ok := c.pendingAcks[ack.Call.ID]; !ok {
+			c.scheduleEscalation(ack)
+		}
+	}
+	if len(acks) > 0 {
+		log.Printf("Restored %d pending missed call acknowledgements", len(acks))
+	}
+	return nil
+}
+
+// ParseMissedCallAck accepts the call ID as plain text or as JSON {"id": "..."}
+func ParseMissedCallAck(payload []byte) (string, error) {
+	text := strings.TrimSpace(string(payload))
+	if strings.HasPrefix(text, "{") {
+		var ack struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal([]byte(text), &ack); err != nil {
+			return "", fmt.Errorf("invalid missed call acknowledgement %q: %w", text, err)
+		}
+		text = strings.TrimSpace(ack.ID)
+	}
+	if text == "" {
+		return "", fmt.Errorf("missed call acknowledgement without call ID")
+	}
+	return text, nil
+}
+
+// awaitMissedCallAck escalates the missed call unless it is acknowledged
+// within the ack timeout. A merged redial restarts the wait. c.mu must be held.
+func (c *Client) awaitMissedCallAck(call types.MissedCall) {
+	ack := types.PendingAck{Call: call, Deadline: c.clock.Now().Add(c.ackTimeout)}
+	c.scheduleEscalation(ack)
+	if store := c.ackStore; store != nil {
+		c.persister.set("missed call ack "+call.ID, func(ctx context.Context) error {
+			return store.SavePendingAck(ctx, ack)
+		})
+	}
+}
+
+// forgetMissedCallAck removes a pending acknowledgement from the store; c.mu must be held
+func (c *Client) forgetMissedCallAck(callID string) {
+	if store := c.ackStore; store != nil {
+		c.persister.set("missed call ack "+callID, func(ctx context.Context) error {
+			return store.DeletePendingAck(ctx, callID)
+		})
+	}
+}
+
+// scheduleEscalation escalates the missed call at the deadline of the acknowledgement; c.mu must be held
+func (c *Client) scheduleEscalation(ack types.PendingAck) {
+	call := ack.Call
+	if timer, ok := c.pendingAcks[call.ID]; ok {
+		timer.Stop()
+	}
+	c.pendingAcks[call.ID] = c.clock.AfterFunc(max(ack.Deadline.Sub(c.clock.Now()), 0), func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		delete(c.pendingAcks, call.ID)
+		c.forgetMissedCallAck(call.ID)
+		log.Printf("Missed call %s was not acknowledged within %v, escalating to '%s'", call.ID, c.ackTimeout, c.ackRecipient)
+		if !c.connected {
+			log.Printf("Failed to escalate missed call %s: MQTT client not connected", call.ID)
+			return
+		}
+		payload, err := json.Marshal(MissedCallEscalation{Reason: "missed_call_unacknowledged", Timeout: int(c.ackTimeout / time.Second), Call: call})
+		if err != nil {
+			log.Printf("Failed to marshal missed call escalation: %v", err)
+			return
+		}
+		if err := c.PublishNotification(context.Background(), c.ackRecipient, payload); err != nil {
+			log.Printf("Failed to escalate missed call %s: %v", call.ID, err)
+		}
+	})
+}
+
+// AcknowledgeMissedCall stops the escalation of a missed call. It reports
+// false if no acknowledgement was pending for the call.
+func (c *Client) AcknowledgeMissedCall(callID string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	timer, ok := c.pendingAcks[callID]
+	if !ok {
+		return false
+	}
+	timer.Stop()
+	delete(c.pendingAcks, callID)
+	c.forgetMissedCallAck(callID)
+	return true
+}
+
+// subscribeMissedCallAcks listens on the acknowledgement topic; subscriptions are lost on reconnect with a clean session
+func (c *Client) subscribeMissedCallAcks(client mqtt.Client) error {
+	topic, err := c.topic(c.topics.MissedCallAck, TopicData{})
+	if err != nil {
+		return err
+	}
+	if err := waitToken(context.Background(), client.Subscribe(topic, c.qos, c.onMissedCallAck), c.publishTimeout); err != nil {
+		return fmt.Errorf("failed to subscribe to '%s': %w", topic, err)
+	}
+	log.Printf("Listening for missed call acknowledgements on topic '%s'", topic)
+	return nil
+}
+
+// onMissedCallAck handles an acknowledgement outside of the paho callback, which must not block
+func (c *Client) onMissedCallAck(_ mqtt.Client, msg mqtt.Message) {
+	callID, err := ParseMissedCallAck(msg.Payload())
+	if err != nil {
+		log.Printf("Ignoring missed call acknowledgement: %v", err)
+		return
+	}
+	go func() {
+		if c.AcknowledgeMissedCall(callID) {
+			log.Printf("Missed call %s acknowledged", callID)
+		}
+	}()
+}
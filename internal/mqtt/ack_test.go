@@ -0,0 +1,171 @@
+package mqtt
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+func TestParseMissedCallAck(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    string
+		wantErr bool
+	}{
+		{"0199a8c4-0000-7000-8000-000000000001", "0199a8c4-0000-7000-8000-000000000001", false},
+		{" call-1\n", "call-1", false},
+		{`{"id": "call-1"}`, "call-1", false},
+		{"", "", true},
+		{`{"id": ""}`, "", true},
+		{`{"id": `, "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMissedCallAck([]byte(tt.payload))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseMissedCallAck(%q) error = %v, wantErr %v", tt.payload, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMissedCallAck(%q) = %q, want %q", tt.payload, got, tt.want)
+		}
+	}
+}
+
+// fakeAckStore keeps the pending acknowledgements in memory
+type fakeAckStore struct {
+	mu   sync.Mutex
+	acks map[string]types.PendingAck
+}
+
+func (s *fakeAckStore) PendingAcks(ctx context.Context) ([]types.PendingAck, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acks := make([]types.PendingAck, 0, len(s.acks))
+	for _, ack := range s.acks {
+		acks = append(acks, ack)
+	}
+	return acks, nil
+}
+
+func (s *fakeAckStore) SavePendingAck(ctx context.Context, ack types.PendingAck) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.acks[ack.Call.ID] = ack
+	return nil
+}
+
+func (s *fakeAckStore) DeletePendingAck(ctx context.Context, callID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.acks, callID)
+	return nil
+}
+
+// stored returns the IDs of the stored acknowledgements once all changes are saved
+func (s *fakeAckStore) stored(client *Client) []string {
+	client.persister.wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.acks))
+	for id := range s.acks {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// newAckClient creates an unconnected client waiting 5 minutes for acknowledgements
+func newAckClient(t *testing.T, clk *clock.Fake, store *fakeAckStore) *Client {
+	t.Helper()
+	client := NewClient(Options{ClientID: "test", TopicPrefix: "test", Clock: clk, MissedCallAckTimeout: 5 * time.Minute})
+	if err := client.RestoreMissedCallAcks(context.Background(), store); err != nil {
+		t.Fatalf("RestoreMissedCallAcks failed: %v", err)
+	}
+	return client
+}
+
+// pending returns the number of acknowledgements the client waits for
+func pending(client *Client) int {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return len(client.pendingAcks)
+}
+
+func TestMissedCallAckTimeout(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 9, 21, 15, 35, 0, 0, time.UTC))
+	store := &fakeAckStore{acks: map[string]types.PendingAck{}}
+	client := newAckClient(t, clk, store)
+
+	client.mu.Lock()
+	client.awaitMissedCallAck(types.MissedCall{ID: "missed-1"})
+	client.mu.Unlock()
+	if ids := store.stored(client); !slices.Equal(ids, []string{"missed-1"}) {
+		t.Errorf("Expected the pending acknowledgement to be saved, got %v", ids)
+	}
+
+	clk.Advance(4 * time.Minute)
+	if pending(client) != 1 {
+		t.Fatal("Expected the acknowledgement to be pending before the timeout")
+	}
+	clk.Advance(time.Minute)
+	if pending(client) != 0 {
+		t.Error("Expected the missed call to be escalated after the timeout")
+	}
+	if ids := store.stored(client); len(ids) != 0 {
+		t.Errorf("Expected the escalated acknowledgement to be removed from the store, got %v", ids)
+	}
+}
+
+func TestAcknowledgeMissedCall(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 9, 21, 15, 35, 0, 0, time.UTC))
+	store := &fakeAckStore{acks: map[string]types.PendingAck{}}
+	client := newAckClient(t, clk, store)
+
+	client.mu.Lock()
+	client.awaitMissedCallAck(types.MissedCall{ID: "acked"})
+	client.awaitMissedCallAck(types.MissedCall{ID: "other"})
+	client.mu.Unlock()
+
+	if !client.AcknowledgeMissedCall("acked") {
+		t.Error("Expected the acknowledgement to be pending")
+	}
+	if client.AcknowledgeMissedCall("acked") {
+		t.Error("Expected a second acknowledgement to be ignored")
+	}
+	if ids := store.stored(client); !slices.Equal(ids, []string{"other"}) {
+		t.Errorf("Expected only the unacknowledged call in the store, got %v", ids)
+	}
+
+	clk.Advance(10 * time.Minute)
+	if pending(client) != 0 {
+		t.Error("Expected no pending acknowledgements after the timeout")
+	}
+}
+
+func TestRestoreMissedCallAcks(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 9, 21, 15, 35, 0, 0, time.UTC))
+	store := &fakeAckStore{acks: map[string]types.PendingAck{
+		"overdue": {Call: types.MissedCall{ID: "overdue"}, Deadline: clk.Now().Add(-time.Minute)},
+		"waiting": {Call: types.MissedCall{ID: "waiting"}, Deadline: clk.Now().Add(2 * time.Minute)},
+	}}
+	client := newAckClient(t, clk, store)
+
+	// Acknowledgements overdue after the restart are escalated right away
+	clk.Advance(0)
+	if pending(client) != 1 {
+		t.Fatalf("Expected one restored acknowledgement to be pending, got %d", pending(client))
+	}
+	clk.Advance(2 * time.Minute)
+	if pending(client) != 0 {
+		t.Error("Expected the restored acknowledgement to be escalated at its deadline")
+	}
+	if ids := store.stored(client); len(ids) != 0 {
+		t.Errorf("Expected the store to be empty, got %v", ids)
+	}
+}
@@ -0,0 +1,115 @@
+package mqtt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/codec"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// Results of the ACL self-test
+const (
+	ACLCheckPassed = "passed"
+	ACLCheckFailed = "failed"
+)
+
+// ACLTestMessage is the payload the ACL self-test publishes and expects back
+type ACLTestMessage struct {
+	ClientID string    `json:"client_id"`
+	SentAt   time.Time `json:"sent_at"`
+}
+
+// ACLCheck returns the result of the ACL self-test of the current
+// connection, nil while it runs or if it is switched off
+func (c *Client) ACLCheck() *types.ACLCheck {
+	c.aclMu.Lock()
+	defer c.aclMu.Unlock()
+	if c.aclCheck == nil {
+		return nil
+	}
+	check := *c.aclCheck
+	return &check
+}
+
+// selfTestACL runs the ACL self-test after connecting and publishes the
+// result with the status. A broker whose ACL denies the topics of the bridge
+// often drops the messages silently, which otherwise looks like missing calls.
+func (c *Client) selfTestACL(client mqtt.Client) {
+	topic, err := c.topic(c.topics.ACLTest, TopicData{})
+	if err == nil {
+		err = c.testACL(context.Background(), client, topic)
+	}
+
+	check := types.ACLCheck{Result: ACLCheckPassed, Topic: topic, CheckedAt: c.clock.Now()}
+	if err != nil {
+		check.Result, check.Error = ACLCheckFailed, err.Error()
+		log.Printf("MQTT ACL self-test failed: %v. Check that the broker ACL allows the bridge to publish and subscribe to '%s/#', otherwise call events are lost.", err, c.topicPrefix)
+	} else {
+		log.Printf("MQTT ACL self-test passed on topic '%s'", topic)
+	}
+
+	c.mu.RLock()
+	current := client == c.client && c.connected
+	c.mu.RUnlock()
+	if !current {
+		return
+	}
+	c.aclMu.Lock()
+	c.aclCheck = &check
+	c.aclMu.Unlock()
+	if err := c.publishBirthMessage(context.Background()); err != nil {
+		log.Printf("Failed to publish the ACL self-test result: %v", err)
+	}
+}
+
+// testACL subscribes to the topic, publishes a test message to it and waits
+// until the broker delivers the message back
+func (c *Client) testACL(ctx context.Context, client mqtt.Client, topic string) error {
+	now := c.clock.Now()
+	payload, err := c.encode("acl_test", codec.Message{Kind: "acl_test", Time: now, Value: ACLTestMessage{ClientID: c.clientID, SentAt: now}})
+	if err != nil {
+		return err
+	}
+
+	delivered := make(chan struct{}, 1)
+	token := client.Subscribe(topic, c.qos, func(_ mqtt.Client, msg mqtt.Message) {
+		if bytes.Equal(msg.Payload(), payload) {
+			select {
+			case delivered <- struct{}{}:
+			default:
+			}
+		}
+	})
+	if err := waitToken(ctx, token, c.publishTimeout); err != nil {
+		return fmt.Errorf("failed to subscribe to '%s': %w", topic, err)
+	}
+	defer func() {
+		if err := waitToken(context.Background(), client.Unsubscribe(topic), c.publishTimeout); err != nil {
+			log.Printf("Failed to unsubscribe from '%s': %v", topic, err)
+		}
+	}()
+	// A SUBACK return code of 0x80 or above refuses the subscription
+	if subscribe, ok := token.(*mqtt.SubscribeToken); ok && subscribe.Result()[topic] >= 0x80 {
+		return fmt.Errorf("broker refused the subscription to '%s'", topic)
+	}
+
+	if err := waitToken(ctx, client.Publish(topic, c.qos, false, payload), c.publishTimeout); err != nil {
+		return fmt.Errorf("failed to publish to '%s': %w", topic, err)
+	}
+	timeout := time.NewTimer(c.publishTimeout)
+	defer timeout.Stop()
+	select {
+	case <-delivered:
+		return nil
+	case <-timeout.C:
+		return fmt.Errorf("broker accepted the test message on '%s' but did not deliver it within %v", topic, c.publishTimeout)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
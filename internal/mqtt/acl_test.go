@@ -0,0 +1,48 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+func TestACLSelfTest(t *testing.T) {
+	tests := []struct {
+		name   string
+		qos    byte
+		allow  func(topic string, write bool) bool
+		result string
+		error  string
+	}{
+		{"allowed", 1, nil, ACLCheckPassed, ""},
+		{"publish dropped", 0, func(topic string, write bool) bool { return !write || topic != "test/debug/acl_test" }, ACLCheckFailed, "did not deliver"},
+		{"subscribe refused", 1, func(topic string, write bool) bool { return write || topic != "test/debug/acl_test" }, ACLCheckFailed, "refused the subscription"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, host, port := startTestBroker(t)
+			b.SetACL(tt.allow)
+			messages := subscribeAll(t, b)
+
+			client := newTestClient(t, host, port, Options{QoS: tt.qos, Retain: true, PublishTimeout: 500 * time.Millisecond, ACLSelfTest: true})
+
+			// The status is published again with the result once the self-test finished
+			var status types.ServiceStatus
+			for status.ACLCheck == nil {
+				if err := json.Unmarshal(waitForMessage(t, messages, "test/status").Payload, &status); err != nil {
+					t.Fatalf("Invalid status payload: %v", err)
+				}
+			}
+			check := status.ACLCheck
+			if status.State != "online" || check.Result != tt.result || check.Topic != "test/debug/acl_test" || !strings.Contains(check.Error, tt.error) {
+				t.Errorf("Expected an online status with ACL self-test %s (%q), got %s with %+v", tt.result, tt.error, status.State, check)
+			}
+			if got := client.ACLCheck(); got == nil || got.Result != tt.result {
+				t.Errorf("Expected ACLCheck to return %s, got %+v", tt.result, got)
+			}
+		})
+	}
+}
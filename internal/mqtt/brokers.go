@@ -0,0 +1,262 @@
+package mqtt
+
+import (
+	"context"
+	"crypto/tls"
+	"log"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// BrokerStats reports the brokers of the client and which one it is connected to
+type BrokerStats struct {
+	Active    string                 `json:"active,omitempty"` // Broker of the main connection, empty while disconnected
+	Brokers   []string               `json:"brokers"`          // In order of preference
+	Mirror    bool                   `json:"mirror"`           // Publishing to all brokers instead of failing over
+	Failovers uint64                 `json:"failovers"`        // Connections to another broker than the one before
+	Mirrors   map[string]MirrorStats `json:"mirrors,omitempty"`
+}
+
+// MirrorStats reports a broker the messages are mirrored to
+type MirrorStats struct {
+	Connected bool   `json:"connected"`
+	Failed    uint64 `json:"failed"` // Copies not acknowledged by the broker since the start
+}
+
+// brokerState tracks the broker of the main connection. Paho tries the
+// brokers in order on every connect and reconnect; the last one it attempted
+// is the one a successful connect went to.
+type brokerState struct {
+	mu        sync.Mutex
+	attempted string
+	active    string
+	failovers uint64
+}
+
+// attempt notes the broker paho is about to connect to
+func (s *brokerState) attempt(broker string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempted = broker
+}
+
+// connected makes the attempted broker the active one and returns it and the
+// broker connected to before, empty on the first connect
+func (s *brokerState) connected() (broker, previous string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, s.active = s.active, s.attempted
+	if previous != "" && previous != s.active {
+		s.failovers++
+	}
+	return s.active, previous
+}
+
+// current returns the broker of the last connection
+func (s *brokerState) current() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active
+}
+
+// mirrorClient publishes copies of all messages to a further broker in mirror mode
+type mirrorClient struct {
+	broker  string // host:port
+	client  mqtt.Client
+	started bool // Connect was called, guarded by Client.mu
+	failed  atomic.Uint64
+}
+
+// brokerList returns the brokers as host:port, the configured broker first, without duplicates
+func brokerList(host string, port int, further []string) []string {
+	brokers := []string{net.JoinHostPort(host, strconv.Itoa(port))}
+	for _, broker := range further {
+		if !slices.Contains(brokers, broker) {
+			brokers = append(brokers, broker)
+		}
+	}
+	return brokers
+}
+
+// brokerURLs returns the URLs of the brokers the main connection may use:
+// all of them in failover mode, the first one in mirror mode
+func (c *Client) brokerURLs() []string {
+	brokers := c.brokers
+	if len(c.mirrors) > 0 {
+		brokers = brokers[:1]
+	}
+	urls := make([]string, len(brokers))
+	for i, broker := range brokers {
+		urls[i] = "tcp://" + broker
+	}
+	return urls
+}
+
+// onConnectAttempt notes the broker of a connection attempt
+func (c *Client) onConnectAttempt(broker *url.URL, tlsCfg *tls.Config) *tls.Config {
+	c.brokerState.attempt(broker.Host)
+	return tlsCfg
+}
+
+// newMirrors creates a paho client for every further broker in mirror mode.
+// Paho reconnects them by itself; a mirror that was unreachable gets the
+// retained topics again once connected.
+func (c *Client) newMirrors() []*mirrorClient {
+	var mirrors []*mirrorClient
+	for _, broker := range c.brokers[1:] {
+		m := &mirrorClient{broker: broker}
+		opts := mqtt.NewClientOptions()
+		opts.AddBroker("tcp://" + broker)
+		opts.SetClientID(c.clientID)
+		opts.SetKeepAlive(c.keepAlive)
+		opts.SetConnectTimeout(c.connectTimeout)
+		opts.SetAutoReconnect(true)
+		opts.SetConnectRetry(true)
+		opts.SetConnectRetryInterval(c.reconnect.Initial)
+		if c.reconnect.Max > 0 {
+			opts.SetMaxReconnectInterval(c.reconnect.Max)
+		}
+		opts.SetCleanSession(true)
+		opts.SetCredentialsProvider(c.credentials)
+		if topic, err := c.topic(c.topics.Status, TopicData{}); err == nil {
+			if payload, err := c.createStatusMessage("offline"); err == nil {
+				opts.SetWill(topic, string(payload), c.qos, c.retainFlags.Status)
+			}
+		}
+		opts.SetOnConnectHandler(func(mqtt.Client) { c.onMirrorConnect(m) })
+		opts.SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			log.Printf("Connection to mirrored MQTT broker %s lost: %v", m.broker, err)
+		})
+		m.client = mqtt.NewClient(opts)
+		mirrors = append(mirrors, m)
+	}
+	return mirrors
+}
+
+// connectMirrors starts connecting the mirrors without waiting for them; c.mu must be held
+func (c *Client) connectMirrors() {
+	for _, m := range c.mirrors {
+		if m.started {
+			continue
+		}
+		log.Printf("Mirroring MQTT messages to broker %s", m.broker)
+		m.started = true
+		// With connect retry, the token only completes once connected
+		m.client.Connect()
+	}
+}
+
+// disconnectMirrors publishes the offline status to the mirrors and disconnects them; c.mu must be held
+func (c *Client) disconnectMirrors(topic string, offline []byte) {
+	for _, m := range c.mirrors {
+		if !m.started {
+			continue
+		}
+		if topic != "" && m.client.IsConnected() {
+			if err := waitToken(context.Background(), m.client.Publish(topic, c.qos, c.retainFlags.Status, offline), c.publishTimeout); err != nil {
+				log.Printf("Failed to publish offline message to mirrored MQTT broker %s: %v", m.broker, err)
+			}
+		}
+		m.client.Disconnect(250)
+		m.started = false
+	}
+}
+
+// onMirrorConnect publishes the online status and the retained topics to a mirror
+func (c *Client) onMirrorConnect(m *mirrorClient) {
+	log.Printf("Connected to mirrored MQTT broker %s", m.broker)
+	topic, err := c.topic(c.topics.Status, TopicData{})
+	if err != nil {
+		log.Printf("Failed to build status topic: %v", err)
+		return
+	}
+	payload, err := c.createStatusMessage("online")
+	if err != nil {
+		log.Printf("Failed to create birth message: %v", err)
+		return
+	}
+	c.publishMirror(m, topic, payload, c.retainFlags.Status)
+	for retainedTopic, retained := range c.retained.snapshot() {
+		if retainedTopic != topic {
+			c.publishMirror(m, retainedTopic, retained, true)
+		}
+	}
+}
+
+// publishMirrors sends a copy of a message to the connected mirrors without
+// waiting for them. Mirrors that are not connected miss it and get the
+// retained topics again on connect.
+func (c *Client) publishMirrors(topic string, payload []byte, retain bool) {
+	for _, m := range c.mirrors {
+		if m.client.IsConnected() {
+			c.publishMirror(m, topic, payload, retain)
+		}
+	}
+}
+
+// publishMirror sends a message to a mirror and logs a failure in the background
+func (c *Client) publishMirror(m *mirrorClient, topic string, payload []byte, retain bool) {
+	token := m.client.Publish(topic, c.qos, retain, payload)
+	go func() {
+		if !token.WaitTimeout(c.publishTimeout) {
+			m.failed.Add(1)
+			log.Printf("Timed out publishing to topic '%s' on mirrored MQTT broker %s", topic, m.broker)
+		} else if err := token.Error(); err != nil {
+			m.failed.Add(1)
+			log.Printf("Failed to publish to topic '%s' on mirrored MQTT broker %s: %v", topic, m.broker, err)
+		}
+	}()
+}
+
+// republishRetained publishes the retained topics again after failing over
+// to a broker that does not know them; the status topic was just published
+func (c *Client) republishRetained(ctx context.Context) {
+	status, err := c.topic(c.topics.Status, TopicData{})
+	if err != nil {
+		log.Printf("Failed to build status topic: %v", err)
+		return
+	}
+	payloads := c.retained.snapshot()
+	log.Printf("Publishing %d retained topics again after failing over", len(payloads))
+	for topic, payload := range payloads {
+		if topic == status {
+			continue
+		}
+		if err := c.send(ctx, topic, payload, true); err != nil {
+			log.Printf("Failed to publish retained topic '%s' again: %v", topic, err)
+		}
+	}
+}
+
+// ActiveBroker returns the broker of the main connection as host:port, or an empty string while disconnected
+func (c *Client) ActiveBroker() string {
+	if !c.IsConnected() {
+		return ""
+	}
+	return c.brokerState.current()
+}
+
+// BrokerStats returns the brokers and the one the client is connected to
+func (c *Client) BrokerStats() BrokerStats {
+	stats := BrokerStats{
+		Active:  c.ActiveBroker(),
+		Brokers: append([]string{}, c.brokers...),
+		Mirror:  len(c.mirrors) > 0,
+	}
+	c.brokerState.mu.Lock()
+	stats.Failovers = c.brokerState.failovers
+	c.brokerState.mu.Unlock()
+	for _, m := range c.mirrors {
+		if stats.Mirrors == nil {
+			stats.Mirrors = make(map[string]MirrorStats, len(c.mirrors))
+		}
+		stats.Mirrors[m.broker] = MirrorStats{Connected: m.client.IsConnected(), Failed: m.failed.Load()}
+	}
+	return stats
+}
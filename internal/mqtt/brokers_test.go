@@ -0,0 +1,146 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/broker"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/backoff"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// waitForMessage returns the next message on the topic
+func waitForMessage(t *testing.T, messages <-chan broker.Message, topic string) broker.Message {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-messages:
+			if msg.Topic == topic {
+				return msg
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for a message on %s", topic)
+			return broker.Message{}
+		}
+	}
+}
+
+// subscribeAll collects the messages below the test prefix
+func subscribeAll(t *testing.T, b *broker.Broker) <-chan broker.Message {
+	t.Helper()
+	messages := make(chan broker.Message, 100)
+	if err := b.Subscribe("test/#", func(msg broker.Message) { messages <- msg }); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	return messages
+}
+
+func TestBrokerList(t *testing.T) {
+	brokers := brokerList("mqtt-1", 1883, []string{"mqtt-2:1883", "mqtt-1:1883", "[fd00::1]:1883"})
+	if len(brokers) != 3 || brokers[0] != "mqtt-1:1883" || brokers[1] != "mqtt-2:1883" || brokers[2] != "[fd00::1]:1883" {
+		t.Errorf("Expected the configured broker first without duplicates, got %v", brokers)
+	}
+}
+
+func TestBrokerFailover(t *testing.T) {
+	primary, primaryHost, primaryPort := startTestBroker(t)
+	secondaryBroker, secondaryHost, secondaryPort := startTestBroker(t)
+	secondary := net.JoinHostPort(secondaryHost, strconv.Itoa(secondaryPort))
+	onPrimary := subscribeAll(t, primary)
+	onSecondary := subscribeAll(t, secondaryBroker)
+
+	client := NewClient(Options{
+		Broker:         primaryHost,
+		Port:           primaryPort,
+		Brokers:        []string{secondary},
+		ClientID:       "integration-test",
+		TopicPrefix:    "test",
+		QoS:            1,
+		Retain:         true,
+		ConnectTimeout: 2 * time.Second,
+		Reconnect:      backoff.Policy{Initial: 10 * time.Millisecond, Max: 50 * time.Millisecond},
+	})
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Disconnect() })
+
+	var status types.ServiceStatus
+	if err := json.Unmarshal(waitForMessage(t, onPrimary, "test/status").Payload, &status); err != nil {
+		t.Fatalf("Invalid status payload: %v", err)
+	}
+	if want := net.JoinHostPort(primaryHost, strconv.Itoa(primaryPort)); status.State != "online" || status.Broker != want {
+		t.Errorf("Expected online on %s, got %+v", want, status)
+	}
+
+	event := types.CallEvent{ID: "call-1", Type: types.CallTypeRing, Line: 1, Timestamp: time.Now(), Status: types.CallStatusRinging}
+	if err := client.PublishCallEvent(context.Background(), event); err != nil {
+		t.Fatalf("PublishCallEvent failed: %v", err)
+	}
+	waitForMessage(t, onPrimary, "test/line/1/status")
+
+	// The primary broker goes away: the client fails over and publishes the retained topics again
+	if err := primary.Close(); err != nil {
+		t.Fatalf("Failed to stop the primary broker: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for client.ActiveBroker() != secondary {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected failover to %s, got %+v", secondary, client.BrokerStats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if stats := client.BrokerStats(); stats.Failovers != 1 || len(stats.Brokers) != 2 || stats.Mirror {
+		t.Errorf("Expected one failover between 2 brokers, got %+v", stats)
+	}
+
+	if err := json.Unmarshal(waitForMessage(t, onSecondary, "test/status").Payload, &status); err != nil {
+		t.Fatalf("Invalid status payload: %v", err)
+	}
+	if status.State != "online" || status.Broker != secondary {
+		t.Errorf("Expected online on %s, got %+v", secondary, status)
+	}
+	var line types.LineStatus
+	if err := json.Unmarshal(waitForMessage(t, onSecondary, "test/line/1/status").Payload, &line); err != nil {
+		t.Fatalf("Invalid line status payload: %v", err)
+	}
+	if line.Status != types.CallStatusRinging {
+		t.Errorf("Expected the ringing line status on the new broker, got %+v", line)
+	}
+}
+
+func TestBrokerMirror(t *testing.T) {
+	primary, host, port := startTestBroker(t)
+	mirrorBroker, mirrorHost, mirrorPort := startTestBroker(t)
+	mirror := net.JoinHostPort(mirrorHost, strconv.Itoa(mirrorPort))
+	onPrimary := subscribeAll(t, primary)
+	onMirror := subscribeAll(t, mirrorBroker)
+
+	client := newTestClient(t, host, port, Options{QoS: 1, Retain: true, Brokers: []string{mirror}, Mirror: true})
+	waitForMessage(t, onPrimary, "test/status")
+	// The mirror announces the bridge online once it is connected
+	var status types.ServiceStatus
+	if err := json.Unmarshal(waitForMessage(t, onMirror, "test/status").Payload, &status); err != nil {
+		t.Fatalf("Invalid status payload: %v", err)
+	}
+	if want := net.JoinHostPort(host, strconv.Itoa(port)); status.State != "online" || status.Broker != want {
+		t.Errorf("Expected online on %s, got %+v", want, status)
+	}
+
+	event := types.CallEvent{ID: "call-1", Type: types.CallTypeRing, Line: 1, Timestamp: time.Now(), Status: types.CallStatusRinging}
+	if err := client.PublishCallEvent(context.Background(), event); err != nil {
+		t.Fatalf("PublishCallEvent failed: %v", err)
+	}
+	waitForMessage(t, onPrimary, "test/line/1/status")
+	waitForMessage(t, onMirror, "test/line/1/status")
+
+	stats := client.BrokerStats()
+	if !stats.Mirror || !stats.Mirrors[mirror].Connected || stats.Active != status.Broker {
+		t.Errorf("Expected a connected mirror, got %+v", stats)
+	}
+}
@@ -0,0 +1,130 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/seal"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// callIDMarker stands in for the call ID while building the call topic filter
+const callIDMarker = "__call_id__"
+
+// scheduleCallTopicRemoval clears the retained call topic after delay by
+// publishing an empty retained message. c.mu must be held.
+func (c *Client) scheduleCallTopicRemoval(topic string, delay time.Duration) {
+	if timer, ok := c.callTopicExpiry[topic]; ok {
+		timer.Stop()
+	}
+	c.callTopicExpiry[topic] = c.clock.AfterFunc(delay, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		delete(c.callTopicExpiry, topic)
+		if !c.connected {
+			return
+		}
+		// Call topic expiry has no context of its own, the publish timeout still applies
+		if err := c.publishWithRetain(context.Background(), topic, []byte{}, true); err != nil {
+			log.Printf("Failed to remove expired call topic %s: %v", topic, err)
+		}
+	})
+}
+
+// callTopicFilter returns the subscription filter matching the call topics of
+// all calls. It fails if the call topic layout depends on other call values
+// than the ID, since those cannot be matched by a single-level wildcard.
+func (c *Client) callTopicFilter() (string, error) {
+	first, err := c.topic(c.topics.Call, TopicData{ID: callIDMarker, Line: 1, Trunk: "SIP0", MSN: "1", Type: types.CallTypeRing, Direction: types.CallDirectionInbound})
+	if err != nil {
+		return "", err
+	}
+	second, err := c.topic(c.topics.Call, TopicData{ID: callIDMarker, Line: 2, Trunk: "SIP1", MSN: "2", Type: types.CallTypeCall, Direction: types.CallDirectionOutbound})
+	if err != nil {
+		return "", err
+	}
+	if first != second {
+		return "", fmt.Errorf("call topic layout depends on other call values than the ID")
+	}
+
+	levels := strings.Split(first, "/")
+	found := false
+	for i, level := range levels {
+		switch {
+		case level == callIDMarker && !found:
+			levels[i] = "+"
+			found = true
+		case strings.Contains(level, callIDMarker):
+			return "", fmt.Errorf("call ID must be a topic level of its own in the call topic layout")
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("call topic layout does not contain the call ID")
+	}
+	return strings.Join(levels, "/"), nil
+}
+
+// subscribeRetainedCallTopics receives the call topics retained on the broker,
+// so topics left by an earlier run expire as well
+func (c *Client) subscribeRetainedCallTopics(client mqtt.Client) error {
+	filter, err := c.callTopicFilter()
+	if err != nil {
+		return err
+	}
+	if err := waitToken(context.Background(), client.Subscribe(filter, c.qos, c.onRetainedCallTopic), c.publishTimeout); err != nil {
+		return fmt.Errorf("failed to subscribe to '%s': %w", filter, err)
+	}
+	return nil
+}
+
+// onRetainedCallTopic handles the call topic outside of the paho callback, which must not block.
+// Live messages, including the bridge's own publishes, are not flagged as retained and ignored.
+func (c *Client) onRetainedCallTopic(_ mqtt.Client, msg mqtt.Message) {
+	if !msg.Retained() || len(msg.Payload()) == 0 {
+		return
+	}
+	topic, payload := msg.Topic(), msg.Payload()
+	go c.expireRetainedCallTopic(topic, payload)
+}
+
+// expireRetainedCallTopic schedules the removal of a retained call topic
+// whose call is not tracked by this run, TTL after its last update. Calls
+// that never ended, e.g. because the bridge stopped during the call, are
+// removed the same way.
+func (c *Client) expireRetainedCallTopic(topic string, payload []byte) {
+	if c.encryptionKey != nil {
+		var err error
+		if payload, err = seal.Open(*c.encryptionKey, payload); err != nil {
+			return
+		}
+	}
+	var status types.LineStatus
+	if err := json.Unmarshal(payload, &status); err != nil || status.ID == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The filter may match foreign topics; only call topics rendered by this bridge are removed
+	if expected, err := c.topic(c.topics.Call, TopicData{ID: status.ID}); err != nil || expected != topic {
+		return
+	}
+	if _, active := c.callStatuses[status.ID]; active {
+		return
+	}
+	if _, pending := c.callTopicExpiry[topic]; pending {
+		return
+	}
+
+	delay := max(status.LastUpdated.Add(c.callTopicTTL).Sub(c.clock.Now()), 0)
+	log.Printf("Removing retained call topic %s in %s", topic, delay)
+	c.scheduleCallTopicRemoval(topic, delay)
+}
@@ -1,161 +1,771 @@
 package mqtt
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 
-	"fritz-callmonitor2mqtt/pkg/types"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/backoff"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/codec"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/seal"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
 )
 
 // Client represents an MQTT client using Eclipse Paho
 type Client struct {
 	broker         string
 	port           int
+	brokers        []string        // Brokers as host:port, the configured broker first
+	mirrors        []*mirrorClient // Further brokers receiving copies in mirror mode, nil in failover mode
+	brokerState    brokerState
 	username       string
 	password       string
+	credMu         sync.RWMutex // Guards username and password, which are read by paho on every reconnect
 	clientID       string
 	topicPrefix    string
 	qos            byte
 	retain         bool
 	keepAlive      time.Duration
 	connectTimeout time.Duration
+	publishTimeout time.Duration
 	logLevel       string
+	clock          clock.Clock
+	topics         *Topics
+	box            string
+	callTopicTTL   time.Duration
+	retainFlags    retainFlags
+	publishTopics  TopicEnabled
+	dnd            DeflectionService
+	dndDeflections []int
+	dndMu          sync.Mutex     // Serializes DND commands and refreshes
+	fritzBox       FritzBoxStatus // State of the callmonitor connection, published again on connect
+	fritzBoxMu     sync.Mutex
+	onReload       func(ctx context.Context) error
+	callQueries    CallQueryService // Answers the call query topic, nil if not served
+	profiles       *Profiles        // Publishing profiles muting event topics, nil if none are configured
+	profileTopics  bool             // Publishes the active profile and listens for profile commands
+	onConnection   func(online bool, cause error)
+	version        string
+	limiter        *rateLimiter // Nil without a publish rate limit
+	ackTimeout     time.Duration
+	ackRecipient   string
+	codecs         map[string]codec.Codec // Payload format of each published topic by registry name
+	schemaVersion  int                    // Layout of the payloads, see types.SchemaVersion
+	encryptionKey  *seal.Key              // Key of the encrypted payloads, nil if they are plain
+	reconnect      backoff.Policy         // Delays between reconnects after a lost connection
+	reconnects     atomic.Uint64          // Reconnect attempts since the start
+	failingSince   atomic.Int64           // Unix nanoseconds of the first failed publish since the last acknowledged one, 0 if none failed
+	failed         atomic.Uint64          // Publishes not acknowledged by the broker since the start
+	stopReconnect  chan struct{}          // Closed to abandon the running reconnect loop
+	retained       retainedState          // Payloads of the retained topics for drift checks
+	retainedSettle time.Duration
+	aclSelfTest    bool
+	aclCheck       *types.ACLCheck // Result of the ACL self-test of the current connection, nil until it finished
+	aclMu          sync.Mutex
 
 	// MQTT client
 	client mqtt.Client
 
 	// State management
 	connected              bool
+	reconnecting           bool              // Connection lost, the reconnect loop is running
+	outbox                 []types.CallEvent // Call events received while reconnecting, replayed on connect
+	outboxSize             int
+	onConnectDone          chan struct{} // Closed once onConnect finished for the current paho client
+	connectedAt            time.Time     // Start of the current connection
+	shortSessions          []time.Time   // Connections lost right after connecting, see noteConnectionLost
 	mu                     sync.RWMutex
 	lineStatuses           map[string]*types.LineStatus
+	callStatuses           map[string]*types.LineStatus // Status of each running call by call ID
+	summary                *callSummary                 // Snapshots of the summary topics
 	lineStatusExtensions   map[string]*types.LineStatusExtension
 	lineStatusParticipants map[string]*types.LineStatusParticipant
 	callHistory            *types.CallHistory
+	historyGate            *types.HistoryGate
+	missedCalls            *types.MissedCallList
+	ringStarts             map[string]time.Time   // Maps call ID to the start of ringing
+	lineTopicData          map[string]TopicData   // Template values of the last event per line
+	callTopicExpiry        map[string]clock.Timer // Pending removals of finished call topics
+	sequences              map[string]uint64      // Last publish sequence number of each line status by line key
+	sequenceStore          SequenceStore          // Persists the sequence numbers, nil keeps them in memory only
+	pendingAcks            map[string]clock.Timer // Escalations of missed calls waiting for an acknowledgement
+	ackStore               AckStore               // Persists pending acknowledgements, nil keeps them in memory only
+	persister              *persister             // Saves sequence numbers and acknowledgements in the background
+
+	elapsedInterval time.Duration
+	elapsedTickers  map[string]*elapsedTicker // Tickers of the talking calls by call ID
+}
+
+// Options configures an MQTT client
+type Options struct {
+	Broker         string
+	Port           int
+	Brokers        []string // Further brokers as host:port, tried in order while Broker is unreachable
+	Mirror         bool     // Publishes to Brokers as well instead of failing over to them
+	Username       string
+	Password       string
+	ClientID       string
+	TopicPrefix    string
+	QoS            byte
+	Retain         bool
+	KeepAlive      time.Duration
+	ConnectTimeout time.Duration
+	PublishTimeout time.Duration // Upper bound for waiting on a single publish acknowledgement
+	LogLevel       string
+	Clock          clock.Clock   // Source of status timestamps (default: real time)
+	Topics         *Topics       // Topic layout (default: DefaultTopics)
+	Box            string        // Value of {{.Box}} in topic templates
+	CallTopicTTL   time.Duration // Time after which retained topics of finished calls are removed, 0 keeps them
+	RetainTopics   TopicRetain   // Per-topic overrides of Retain
+	PublishTopics  TopicEnabled  // Topics switched off (default: all published, the FSM topics at debug log level)
+	Version        string        // Version of the bridge in the topic description
+
+	PublishRate      int // Messages per second sent to the broker, 0 disables the limit
+	PublishBurst     int // Messages sent at once before the rate applies
+	PublishQueueSize int // Topics queued while the rate is exceeded before messages are dropped
+
+	CallHistorySize int                   // Number of calls kept in the history and missed call list
+	CallHistory     *types.CallHistory    // Store for the call history (default: new list of CallHistorySize)
+	MissedCalls     *types.MissedCallList // Store for missed calls (default: new list of CallHistorySize)
+	HistoryFilter   types.HistoryFilter   // Calls kept in the call history (default: all)
+
+	MissedCallMergeWindow time.Duration // Merge redials of a missed caller within this time into one entry, 0 disables
+
+	MissedCallAckTimeout   time.Duration // Escalate missed calls not acknowledged on the ack topic within this time, 0 disables
+	MissedCallAckRecipient string        // Notification recipient of escalations (default: "escalation")
+
+	DND            DeflectionService // Enables the DND command topic when set
+	DNDDeflections []int             // Deflection rules switched by ON/OFF (default: all)
+
+	OnReload func(ctx context.Context) error // Enables the reload command topic when set
+
+	Profiles      *Profiles // Mutes event topics by the active profile, see ParseProfiles
+	ProfileTopics bool      // Publishes the active profile and enables the profile command topic
+
+	OnConnectionChange func(online bool, cause error) // Called when the broker connection is established or lost
+
+	ElapsedInterval time.Duration // How often the elapsed time of a talking call is published, 0 disables
+
+	OutboxSize int            // Call events kept while reconnecting to the broker before the oldest are dropped
+	Reconnect  backoff.Policy // Delays between reconnects after a lost connection (default: backoff.DefaultPolicy)
+
+	RetainedSettle time.Duration // Wait for the retained messages in drift checks (default: DefaultRetainedSettle)
+
+	PayloadFormat     codec.Codec            // Payload format of all topics (default: codec.JSON)
+	PayloadFormats    map[string]codec.Codec // Payload formats of single topics, see ParsePayloadFormats
+	CloudEventsSource string                 // Wraps the payloads of event topics without own format in CloudEvents envelopes with this source
+	EncryptionKey     *seal.Key              // Encrypts the payloads of all topics but status and description when set
+	SchemaVersion     int                    // Layout of the payloads, types.SchemaVersionLegacy omits schema_version (default: types.SchemaVersion)
+
+	ACLSelfTest bool // Checks on connect that the broker delivers messages published below the topic prefix
+}
+
+// DefaultOptions returns the options used when nothing else is configured
+func DefaultOptions() Options {
+	return Options{
+		Broker:         "localhost",
+		Port:           1883,
+		ClientID:       "fritz-callmonitor2mqtt",
+		TopicPrefix:    "fritz/callmonitor",
+		QoS:            1,
+		Retain:         true,
+		KeepAlive:      60 * time.Second,
+		ConnectTimeout: 30 * time.Second,
+		PublishTimeout: 10 * time.Second,
+		LogLevel:       "info",
+		Clock:          clock.Real(),
+		Topics:         DefaultTopics(),
+
+		PublishBurst:     20,
+		PublishQueueSize: 100,
+
+		CallHistorySize: 50,
+
+		MissedCallAckRecipient: "escalation",
+
+		OutboxSize: 100,
+		Reconnect:  backoff.DefaultPolicy(),
+
+		RetainedSettle: DefaultRetainedSettle,
+
+		PayloadFormat: codec.JSON,
+		SchemaVersion: types.SchemaVersion,
+	}
+}
+
+// withDefaults fills unset fields from DefaultOptions; QoS 0 and Retain false are valid settings and kept
+func (o Options) withDefaults() Options {
+	defaults := DefaultOptions()
+	if o.Broker == "" {
+		o.Broker = defaults.Broker
+	}
+	if o.Port == 0 {
+		o.Port = defaults.Port
+	}
+	if o.ClientID == "" {
+		o.ClientID = defaults.ClientID
+	}
+	if o.TopicPrefix == "" {
+		o.TopicPrefix = defaults.TopicPrefix
+	}
+	if o.KeepAlive == 0 {
+		o.KeepAlive = defaults.KeepAlive
+	}
+	if o.ConnectTimeout == 0 {
+		o.ConnectTimeout = defaults.ConnectTimeout
+	}
+	if o.PublishTimeout == 0 {
+		o.PublishTimeout = defaults.PublishTimeout
+	}
+	if o.LogLevel == "" {
+		o.LogLevel = defaults.LogLevel
+	}
+	if o.PublishBurst <= 0 {
+		o.PublishBurst = defaults.PublishBurst
+	}
+	if o.PublishQueueSize <= 0 {
+		o.PublishQueueSize = defaults.PublishQueueSize
+	}
+	if o.Clock == nil {
+		o.Clock = defaults.Clock
+	}
+	if o.Topics == nil {
+		o.Topics = defaults.Topics
+	}
+	if o.CallHistorySize <= 0 {
+		o.CallHistorySize = defaults.CallHistorySize
+	}
+	if o.CallHistory == nil {
+		o.CallHistory = &types.CallHistory{Calls: make([]types.CallEvent, 0)}
+	}
+	if o.CallHistory.MaxSize <= 0 {
+		o.CallHistory.MaxSize = o.CallHistorySize
+	}
+	if o.MissedCalls == nil {
+		o.MissedCalls = &types.MissedCallList{Calls: make([]types.MissedCall, 0)}
+	}
+	if o.MissedCalls.MaxSize <= 0 {
+		o.MissedCalls.MaxSize = o.CallHistorySize
+	}
+	if o.MissedCallAckRecipient == "" {
+		o.MissedCallAckRecipient = defaults.MissedCallAckRecipient
+	}
+	if o.OutboxSize <= 0 {
+		o.OutboxSize = defaults.OutboxSize
+	}
+	if o.Reconnect.Initial <= 0 {
+		o.Reconnect = defaults.Reconnect
+	}
+	if o.RetainedSettle <= 0 {
+		o.RetainedSettle = defaults.RetainedSettle
+	}
+	if o.PayloadFormat == nil {
+		o.PayloadFormat = defaults.PayloadFormat
+	}
+	if o.SchemaVersion <= 0 {
+		o.SchemaVersion = defaults.SchemaVersion
+	}
+	if o.MissedCalls.MergeWindow == 0 {
+		o.MissedCalls.MergeWindow = o.MissedCallMergeWindow
+	}
+	return o
 }
 
 // NewClient creates a new MQTT client
-func NewClient(broker string, port int, username, password, clientID, topicPrefix string, qos byte, retain bool, keepAlive, connectTimeout time.Duration, logLevel string) *Client {
-	return &Client{
-		broker:                 broker,
-		port:                   port,
-		username:               username,
-		password:               password,
-		clientID:               clientID,
-		topicPrefix:            topicPrefix,
-		qos:                    qos,
-		retain:                 retain,
-		keepAlive:              keepAlive,
-		connectTimeout:         connectTimeout,
-		logLevel:               logLevel,
+func NewClient(opts Options) *Client {
+	opts = opts.withDefaults()
+	c := &Client{
+		broker:                 opts.Broker,
+		port:                   opts.Port,
+		brokers:                brokerList(opts.Broker, opts.Port, opts.Brokers),
+		username:               opts.Username,
+		password:               opts.Password,
+		clientID:               opts.ClientID,
+		topicPrefix:            opts.TopicPrefix,
+		qos:                    opts.QoS,
+		retain:                 opts.Retain,
+		keepAlive:              opts.KeepAlive,
+		connectTimeout:         opts.ConnectTimeout,
+		publishTimeout:         opts.PublishTimeout,
+		logLevel:               opts.LogLevel,
+		clock:                  opts.Clock,
+		topics:                 opts.Topics,
+		box:                    opts.Box,
+		callTopicTTL:           opts.CallTopicTTL,
+		elapsedInterval:        opts.ElapsedInterval,
+		elapsedTickers:         make(map[string]*elapsedTicker),
+		retainFlags:            opts.RetainTopics.resolve(opts.Retain),
+		publishTopics:          opts.PublishTopics,
+		version:                opts.Version,
+		dnd:                    opts.DND,
+		dndDeflections:         opts.DNDDeflections,
+		onReload:               opts.OnReload,
+		profiles:               opts.Profiles,
+		profileTopics:          opts.Profiles != nil && opts.ProfileTopics,
+		onConnection:           opts.OnConnectionChange,
 		lineStatuses:           make(map[string]*types.LineStatus),
+		callStatuses:           make(map[string]*types.LineStatus),
+		summary:                newCallSummary(),
 		lineStatusExtensions:   make(map[string]*types.LineStatusExtension),
 		lineStatusParticipants: make(map[string]*types.LineStatusParticipant),
-		callHistory: &types.CallHistory{
-			Calls:   make([]types.CallEvent, 0),
-			MaxSize: 50,
-		},
+		callHistory:            opts.CallHistory,
+		historyGate:            types.NewHistoryGate(opts.HistoryFilter),
+		missedCalls:            opts.MissedCalls,
+		ringStarts:             make(map[string]time.Time),
+		lineTopicData:          make(map[string]TopicData),
+		callTopicExpiry:        make(map[string]clock.Timer),
+		sequences:              make(map[string]uint64),
+		pendingAcks:            make(map[string]clock.Timer),
+		ackTimeout:             opts.MissedCallAckTimeout,
+		ackRecipient:           opts.MissedCallAckRecipient,
+		outboxSize:             opts.OutboxSize,
+		codecs:                 resolveCodecs(opts.PayloadFormat, opts.PayloadFormats, opts.CloudEventsSource, opts.EncryptionKey),
+		schemaVersion:          opts.SchemaVersion,
+		encryptionKey:          opts.EncryptionKey,
+		reconnect:              opts.Reconnect,
+		retainedSettle:         opts.RetainedSettle,
+		aclSelfTest:            opts.ACLSelfTest,
+		persister:              newPersister(),
+	}
+	if opts.PublishRate > 0 {
+		c.limiter = newRateLimiter(opts.Clock, opts.PublishRate, opts.PublishBurst, opts.PublishQueueSize, c.publishQueued)
 	}
+	if opts.Mirror {
+		c.mirrors = c.newMirrors()
+	}
+	return c
 }
 
-// Connect establishes connection to MQTT broker
-func (c *Client) Connect() error {
+// Connect establishes connection to MQTT broker. It gives up when ctx is
+// cancelled or the configured connect timeout elapses.
+func (c *Client) Connect(ctx context.Context) error {
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	if c.connected {
+		c.mu.Unlock()
 		return nil
 	}
+	err := c.connect(ctx)
+	done := c.onConnectDone
+	if err == nil {
+		c.connectMirrors()
+	}
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
 
+	// onConnect needs the lock, wait for the birth message and subscriptions after releasing it
+	select {
+	case <-done:
+	case <-ctx.Done():
+	case <-time.After(c.connectTimeout):
+		log.Println("Timed out waiting for the MQTT connect handler")
+	}
+	return nil
+}
+
+// connect creates a new paho client and connects it; c.mu must be held
+func (c *Client) connect(ctx context.Context) error {
 	// Setup MQTT client options
 	opts := mqtt.NewClientOptions()
-	brokerURL := fmt.Sprintf("tcp://%s:%d", c.broker, c.port)
-	opts.AddBroker(brokerURL)
+	brokerURLs := c.brokerURLs()
+	for _, brokerURL := range brokerURLs {
+		opts.AddBroker(brokerURL)
+	}
+	// Paho tries the brokers in order, the attempt that succeeds names the active one
+	opts.SetConnectionAttemptHandler(c.onConnectAttempt)
 	opts.SetClientID(c.clientID)
 	opts.SetKeepAlive(c.keepAlive)
 	opts.SetConnectTimeout(c.connectTimeout)
-	opts.SetAutoReconnect(true)
+	// Lost connections are restored by reconnectLoop with a jittered backoff
+	opts.SetAutoReconnect(false)
 	opts.SetCleanSession(true)
 
-	if c.username != "" {
-		opts.SetUsername(c.username)
-	}
-	if c.password != "" {
-		opts.SetPassword(c.password)
-	}
+	// Automatic reconnects pick up rotated credentials
+	opts.SetCredentialsProvider(c.credentials)
 
 	// Setup Last Will Testament (LWT)
-	lastWillTopic := fmt.Sprintf("%s/status", c.topicPrefix)
+	lastWillTopic, err := c.topic(c.topics.Status, TopicData{})
+	if err != nil {
+		return err
+	}
 	lastWillPayload, err := c.createStatusMessage("offline")
 	if err != nil {
 		return fmt.Errorf("failed to create last will message: %w", err)
 	}
-	opts.SetWill(lastWillTopic, string(lastWillPayload), c.qos, c.retain)
+	opts.SetWill(lastWillTopic, string(lastWillPayload), c.qos, c.retainFlags.Status)
 
 	// Setup callbacks
 	opts.SetConnectionLostHandler(c.onConnectionLost)
 	opts.SetOnConnectHandler(c.onConnect)
 
-	log.Printf("Connecting to MQTT broker %s with client ID %s", brokerURL, c.clientID)
+	log.Printf("Connecting to MQTT broker %s with client ID %s", strings.Join(brokerURLs, ", "), c.clientID)
 
 	// Create and connect client
+	c.onConnectDone = make(chan struct{})
 	c.client = mqtt.NewClient(opts)
-	if token := c.client.Connect(); token.Wait() && token.Error() != nil {
-		return fmt.Errorf("failed to connect to MQTT broker: %w", token.Error())
+	if err := waitToken(ctx, c.client.Connect(), c.connectTimeout); err != nil {
+		// Stop background connection attempts of the abandoned client
+		c.client.Disconnect(0)
+		return fmt.Errorf("failed to connect to MQTT broker: %w", err)
 	}
 
 	c.connected = true
+	c.reconnecting = false
 	log.Println("Successfully connected to MQTT broker")
 	return nil
-} // Disconnect closes the MQTT connection
+}
+
+// credentials returns the current broker credentials
+func (c *Client) credentials() (username string, password string) {
+	c.credMu.RLock()
+	defer c.credMu.RUnlock()
+	return c.username, c.password
+}
+
+// UpdateCredentials replaces the broker credentials, e.g. after a short-lived
+// token was rotated. A connected client reconnects with the new credentials;
+// call events published meanwhile wait in the sink queue of the pipeline.
+// Events that arrive while reconnecting after a lost connection are kept
+// in the outbox and replayed once connected.
+func (c *Client) UpdateCredentials(ctx context.Context, username, password string) error {
+	c.credMu.Lock()
+	changed := username != c.username || password != c.password
+	c.username, c.password = username, password
+	c.credMu.Unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Do not reconnect a client that is being shut down
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// Not connected yet, Connect uses the new credentials
+	if c.client == nil {
+		return nil
+	}
+	// Still connected or reconnecting automatically with the current credentials
+	if !changed && c.client.IsConnected() {
+		return nil
+	}
+
+	log.Println("Reconnecting to MQTT broker with new credentials...")
+
+	// A clean disconnect does not trigger the last will, the birth message follows on connect
+	c.abandonReconnect()
+	c.client.Disconnect(250)
+	c.connected = false
+	c.reconnecting = false
+	return c.connect(ctx)
+}
+
+// Restart drops the broker connection and connects again, e.g. when publishes
+// are no longer acknowledged although the connection looks alive. If the
+// broker cannot be reached, the client keeps reconnecting with the backoff
+// like after a lost connection.
+func (c *Client) Restart(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Not connected yet, there is nothing to restart
+	if c.client == nil {
+		return nil
+	}
+
+	log.Println("Restarting the MQTT connection...")
+	c.abandonReconnect()
+	c.client.Disconnect(250)
+	c.connected = false
+	c.failingSince.Store(0)
+	if err := c.connect(ctx); err != nil {
+		c.reconnecting = true
+		c.stopReconnect = make(chan struct{})
+		go c.reconnectLoop(c.client, c.stopReconnect)
+		return err
+	}
+	return nil
+}
+
+// Disconnect closes the MQTT connection
 func (c *Client) Disconnect() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	if c.reconnecting {
+		// Give up on the reconnect, the outbox cannot be delivered anymore
+		if len(c.outbox) > 0 {
+			log.Printf("Dropping %d call events waiting for the MQTT connection", len(c.outbox))
+		}
+		c.outbox = nil
+		c.abandonReconnect()
+		c.client.Disconnect(0)
+		c.reconnecting = false
+		c.persister.wait()
+		c.disconnectMirrors("", nil)
+		return nil
+	}
 	if !c.connected || c.client == nil {
 		return nil
 	}
 
 	log.Println("Disconnecting from MQTT broker...")
 
+	// Messages held back by the rate limit carry the latest state, send them before going offline
+	if c.limiter != nil {
+		for _, msg := range c.limiter.drain() {
+			c.publishQueued(msg)
+		}
+	}
+
 	// Send explicit offline message before disconnecting
-	topic := fmt.Sprintf("%s/status", c.topicPrefix)
-	payload, err := c.createStatusMessage("offline")
+	topic, err := c.topic(c.topics.Status, TopicData{})
+	var offline []byte
 	if err != nil {
+		log.Printf("Failed to build offline topic: %v", err)
+	} else if offline, err = c.createStatusMessage("offline"); err != nil {
 		log.Printf("Failed to create offline message: %v", err)
+		topic = ""
 	} else {
 		log.Printf("Publishing offline message to topic '%s'", topic)
-		if token := c.client.Publish(topic, c.qos, c.retain, payload); token.Wait() && token.Error() != nil {
-			log.Printf("Failed to publish offline message: %v", token.Error())
+		if err := waitToken(context.Background(), c.client.Publish(topic, c.qos, c.retainFlags.Status, offline), c.publishTimeout); err != nil {
+			log.Printf("Failed to publish offline message: %v", err)
 		}
 	}
+	c.disconnectMirrors(topic, offline)
+
+	// Removals that did not happen yet are skipped, the next connect picks the topics up again
+	for topic, timer := range c.callTopicExpiry {
+		timer.Stop()
+		delete(c.callTopicExpiry, topic)
+	}
+	c.stopElapsed()
+	if len(c.pendingAcks) > 0 && c.ackStore == nil {
+		log.Printf("Dropping %d pending missed call acknowledgements", len(c.pendingAcks))
+	}
+	for id, timer := range c.pendingAcks {
+		timer.Stop()
+		delete(c.pendingAcks, id)
+	}
+	c.persister.wait()
 
 	c.client.Disconnect(250) // Wait up to 250ms for graceful disconnect
 	c.connected = false
+	c.reconnecting = false
 	log.Println("Disconnected from MQTT broker")
 	return nil
 }
 
-// onConnect is called when the MQTT connection is established
+// onConnect is called when the MQTT connection is established, also after
+// automatic reconnects
 func (c *Client) onConnect(client mqtt.Client) {
-	log.Println("MQTT client connected")
+	c.mu.Lock()
+	if client != c.client {
+		// A client replaced by UpdateCredentials
+		c.mu.Unlock()
+		return
+	}
+	c.connected = true
+	c.reconnecting = false
+	c.stopReconnect = nil
+	c.connectedAt = c.clock.Now()
+	outbox := c.outbox
+	c.outbox = nil
+	c.mu.Unlock()
+
+	broker, previous := c.brokerState.connected()
+	failedOver := previous != "" && broker != previous
+	if failedOver {
+		log.Printf("MQTT client connected to broker %s instead of %s", broker, previous)
+	} else {
+		log.Printf("MQTT client connected to broker %s", broker)
+	}
+	if c.onConnection != nil {
+		c.onConnection(true, nil)
+	}
+
+	// The result of the last connection may not hold for this one
+	c.aclMu.Lock()
+	c.aclCheck = nil
+	c.aclMu.Unlock()
 
 	// Publish birth message
-	if err := c.publishBirthMessage(); err != nil {
+	if err := c.publishBirthMessage(context.Background()); err != nil {
 		log.Printf("Failed to publish birth message: %v", err)
 	}
+	if err := c.publishTopicDescription(context.Background()); err != nil {
+		log.Printf("Failed to publish topic description: %v", err)
+	}
+	if err := c.republishFritzBoxStatus(context.Background()); err != nil {
+		log.Printf("Failed to publish Fritz!Box status: %v", err)
+	}
+	c.republishActiveCalls(context.Background())
+	if failedOver {
+		c.republishRetained(context.Background())
+	}
+
+	if c.callTopicTTL > 0 && c.retainFlags.Call {
+		if err := c.subscribeRetainedCallTopics(client); err != nil {
+			log.Printf("Failed to subscribe to retained call topics: %v", err)
+		}
+	}
+
+	if c.ackTimeout > 0 {
+		if err := c.subscribeMissedCallAcks(client); err != nil {
+			log.Printf("Failed to subscribe to missed call acknowledgements: %v", err)
+		}
+	}
+
+	if c.onReload != nil {
+		if err := c.subscribeReloadCommands(client); err != nil {
+			log.Printf("Failed to subscribe to reload commands: %v", err)
+		}
+	}
+
+	if c.callQueries != nil {
+		if err := c.subscribeCallQueries(client); err != nil {
+			log.Printf("Failed to subscribe to call queries: %v", err)
+		}
+	}
+
+	if c.profileTopics {
+		if err := c.subscribeProfileCommands(client); err != nil {
+			log.Printf("Failed to subscribe to profile commands: %v", err)
+		}
+		go func() {
+			if err := c.publishProfile(context.Background(), c.profiles.State()); err != nil {
+				log.Printf("Failed to publish profile: %v", err)
+			}
+		}()
+	}
+
+	if c.dnd != nil {
+		if err := c.subscribeDNDCommands(client); err != nil {
+			log.Printf("Failed to subscribe to DND commands: %v", err)
+		}
+		go func() {
+			if err := c.RefreshDND(context.Background()); err != nil {
+				log.Printf("Failed to publish DND state: %v", err)
+			}
+		}()
+	}
+
+	if c.aclSelfTest {
+		go c.selfTestACL(client)
+	}
+
+	c.mu.Lock()
+	if c.onConnectDone != nil && client == c.client {
+		close(c.onConnectDone)
+		c.onConnectDone = nil
+	}
+	c.mu.Unlock()
+
+	c.replayOutbox(outbox)
 }
 
-// onConnectionLost is called when the MQTT connection is lost
+// replayOutbox publishes the call events received while reconnecting
+func (c *Client) replayOutbox(events []types.CallEvent) {
+	if len(events) == 0 {
+		return
+	}
+	log.Printf("Publishing %d call events received while reconnecting", len(events))
+	for _, event := range events {
+		if err := c.PublishCallEvent(context.Background(), event); err != nil {
+			log.Printf("Failed to publish call event %s from the outbox: %v", event.ID, err)
+		}
+	}
+}
+
+// queueOutbox keeps a call event until the connection is back; c.mu must be held
+func (c *Client) queueOutbox(event types.CallEvent) {
+	if len(c.outbox) >= c.outboxSize {
+		log.Printf("MQTT outbox full, dropping call event %s", c.outbox[0].ID)
+		c.outbox = c.outbox[1:]
+	}
+	c.outbox = append(c.outbox, event)
+}
+
+// onConnectionLost is called when the MQTT connection is lost and starts reconnecting
 func (c *Client) onConnectionLost(client mqtt.Client, err error) {
 	c.mu.Lock()
-	c.connected = false
-	c.mu.Unlock()
+	defer c.mu.Unlock()
 	log.Printf("MQTT connection lost: %v", err)
+	if client != c.client || c.reconnecting {
+		return
+	}
+	c.noteConnectionLost(c.clock.Now())
+	if c.onConnection != nil {
+		// Called outside of c.mu, the callback may use the client
+		go c.onConnection(false, err)
+	}
+	c.connected = false
+	c.reconnecting = true
+	c.stopReconnect = make(chan struct{})
+	go c.reconnectLoop(client, c.stopReconnect)
+}
+
+// reconnectLoop reconnects a client after a lost connection with growing,
+// jittered delays until it is connected, replaced, disconnected or the
+// maximum number of attempts is used up
+func (c *Client) reconnectLoop(client mqtt.Client, stop chan struct{}) {
+	b := backoff.New(c.reconnect)
+	for {
+		delay, ok := b.Next()
+		if !ok {
+			c.mu.Lock()
+			if client == c.client && c.reconnecting {
+				log.Printf("Giving up reconnecting to MQTT broker after %d attempts, dropping %d waiting call events", b.Attempts(), len(c.outbox))
+				c.outbox = nil
+				c.reconnecting = false
+			}
+			c.mu.Unlock()
+			return
+		}
+
+		log.Printf("Reconnecting to MQTT broker in %v (attempt %d)...", delay.Round(time.Millisecond), b.Attempts())
+		select {
+		case <-stop:
+			return
+		case <-time.After(delay):
+		}
+
+		c.reconnects.Add(1)
+		err := waitToken(context.Background(), client.Connect(), c.connectTimeout)
+		if err == nil {
+			// onConnect takes over
+			return
+		}
+		select {
+		case <-stop:
+			client.Disconnect(0)
+			return
+		default:
+		}
+		log.Printf("Failed to reconnect to MQTT broker: %v", err)
+	}
+}
+
+// abandonReconnect stops a running reconnect loop; c.mu must be held
+func (c *Client) abandonReconnect() {
+	if c.stopReconnect != nil {
+		close(c.stopReconnect)
+		c.stopReconnect = nil
+	}
+}
+
+// Reconnects returns the number of reconnect attempts since the start
+func (c *Client) Reconnects() uint64 {
+	return c.reconnects.Load()
 }
 
 // IsConnected returns the connection status
@@ -165,123 +775,462 @@ func (c *Client) IsConnected() bool {
 	return c.connected
 }
 
-// PublishCallEvent publishes a call event and updates line status
-func (c *Client) PublishCallEvent(event types.CallEvent) error {
+// PublishCallEvent publishes a call event and updates line status.
+// Pending publishes are abandoned when ctx is cancelled. While paho
+// reconnects after a lost connection, events wait in the outbox.
+func (c *Client) PublishCallEvent(ctx context.Context, event types.CallEvent) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	if c.reconnecting {
+		c.queueOutbox(event)
+		return nil
+	}
 	if !c.connected {
 		return fmt.Errorf("MQTT client not connected")
 	}
 
-	// Update call history
-	c.callHistory.AddCall(event)
+	// Calls of opted-out MSNs/extensions only update the live line status
+	historyChanged := false
+	if !event.DoNotRecord {
+		for _, e := range c.historyGate.Add(event) {
+			c.callHistory.AddCallAt(e, c.clock.Now())
+			historyChanged = true
+		}
+	}
 
-	// Update line status
+	// Update line status; with call waiting the line shows the call that changed last
 	lineKey := fmt.Sprintf("%s_%d", event.Trunk, event.Line)
 	lineStatus := c.getOrCreateLineStatus(lineKey, event)
+	data := topicDataForEvent(event)
+	c.lineTopicData[lineKey] = data
+	c.applyEvent(lineStatus, event)
+
+	// Every call keeps its own status, so parallel calls on a line do not overwrite each other
+	callStatus := lineStatus
+	if event.ID != "" {
+		status, exists := c.callStatuses[event.ID]
+		if !exists {
+			statusCopy := *lineStatus
+			statusCopy.Sequence = 0 // Sequence numbers count line status publishes only
+			status = &statusCopy
+			c.callStatuses[event.ID] = status
+		}
+		c.applyEvent(status, event)
+		callStatus = status
+		if event.Type == types.CallTypeDisconnect {
+			delete(c.callStatuses, event.ID)
+		}
+	}
+
+	// Publish line status
+	if err := c.publishLineStatus(ctx, lineStatus, data); err != nil {
+		return fmt.Errorf("failed to publish line status: %w", err)
+	}
+
+	if err := c.publishLineLastEvent(ctx, event, data); err != nil {
+		return fmt.Errorf("failed to publish line last event: %w", err)
+	}
+
+	// Remember when ringing started to measure the ring duration of missed calls
+	switch event.Type {
+	case types.CallTypeRing:
+		c.ringStarts[event.ID] = event.Timestamp
+	case types.CallTypeDisconnect:
+		ringStart, rang := c.ringStarts[event.ID]
+		delete(c.ringStarts, event.ID)
+		if rang && event.Status == types.CallStatusMissedCall && !event.DoNotRecord {
+			if err := c.publishMissedCall(ctx, types.NewMissedCall(event, ringStart), data); err != nil {
+				return fmt.Errorf("failed to publish missed call: %w", err)
+			}
+		}
+	}
+
+	if err := c.updateElapsed(ctx, event, callStatus, data); err != nil {
+		return fmt.Errorf("failed to publish elapsed time: %w", err)
+	}
+
+	if !event.DoNotRecord {
+		if err := c.publishCallStatus(ctx, callStatus, data); err != nil {
+			return fmt.Errorf("failed to publish call status: %w", err)
+		}
+		if event.Type == types.CallTypeDisconnect {
+			c.expireCallTopic(data)
+		}
+	}
+
+	if historyChanged {
+		if err := c.publishCallHistory(ctx, data); err != nil {
+			return fmt.Errorf("failed to publish call history: %w", err)
+		}
+	}
+
+	if err := c.publishSummary(ctx, event); err != nil {
+		return fmt.Errorf("failed to publish summary: %w", err)
+	}
+
+	// Publish individual call event
+	// if err := c.publishEvent(ctx, event); err != nil {
+	// 	return fmt.Errorf("failed to publish call event: %w", err)
+	// }
+
+	return nil
+}
+
+// applyEvent updates a line or call status with a call event
+func (c *Client) applyEvent(status *types.LineStatus, event types.CallEvent) {
+	// A new call starts, forget the values of the previous one
+	if event.Type == types.CallTypeRing || event.Type == types.CallTypeCall {
+		status.Duration = nil
+		status.Extension = *c.getOrCreateLineStatusExtension(event.Extension, event.ExtensionName)
+	}
+	if event.ID != "" {
+		status.ID = event.ID
+	}
+	if event.Direction != "" {
+		status.Direction = event.Direction
+	}
+	if event.Caller != "" {
+		status.Caller = *c.getOrCreateLineStatusParticipant(event.Caller, event.CallerMSNName)
+	}
+	if event.Called != "" {
+		status.Called = *c.getOrCreateLineStatusParticipant(event.Called, event.CalledMSNName)
+	}
+	if event.Extension != "" {
+		status.Extension = *c.getOrCreateLineStatusExtension(event.Extension, event.ExtensionName)
+	}
 
 	// Use FSM status if available, otherwise fall back to call type mapping
 	if event.Status != "" {
-		lineStatus.Status = event.Status
+		status.Status = event.Status
 	} else {
 		// Fallback for events without FSM processing
 		switch event.Type {
 		case types.CallTypeRing:
-			lineStatus.Status = types.CallStatusRinging
+			status.Status = types.CallStatusRinging
 		case types.CallTypeCall:
-			lineStatus.Status = types.CallStatusCalling
+			status.Status = types.CallStatusCalling
 		case types.CallTypeConnect:
-			lineStatus.Status = types.CallStatusTalking
+			status.Status = types.CallStatusTalking
 		case types.CallTypeDisconnect:
-			lineStatus.Status = types.CallStatusIdle
+			status.Status = types.CallStatusIdle
 		}
 	}
 
 	// Update finish state from FSM
-	lineStatus.FinishState = event.FinishState
+	status.FinishState = event.FinishState
 
 	if event.Type == types.CallTypeDisconnect {
-		lineStatus.Duration = &event.Duration
+		duration := event.Duration
+		status.Duration = &duration
 	}
 
-	lineStatus.LastEvent = event.RawMessage
-	lineStatus.LastUpdated = event.Timestamp
+	status.LastEvent = event.RawMessage
+	status.LastUpdated = event.Timestamp
+}
 
-	// Publish line status
-	if err := c.publishLineStatus(lineStatus); err != nil {
-		return fmt.Errorf("failed to publish line status: %w", err)
+// topic renders a topic template with the configured prefix and box name
+func (c *Client) topic(t *Topic, data TopicData) (string, error) {
+	data.Prefix = c.topicPrefix
+	data.Box = c.box
+	return t.Render(data)
+}
+
+// publishLineStatus publishes the status of a phone line with the next sequence number of the line
+func (c *Client) publishLineStatus(ctx context.Context, status *types.LineStatus, data TopicData) error {
+	if !enabled(c.publishTopics.LineStatus) {
+		return nil
+	}
+	topic, err := c.topic(c.topics.LineStatus, data)
+	if err != nil {
+		return err
 	}
+	status.Sequence = c.nextSequence(fmt.Sprintf("%s_%d", status.Trunk, status.Line))
 
-	if err := c.publishLineLastEvent(event); err != nil {
-		return fmt.Errorf("failed to publish line last event: %w", err)
+	payload, err := c.encode("line_status", codec.Message{Kind: "line.status", Subject: strconv.Itoa(status.Line), Time: status.LastUpdated, Value: status})
+	if err != nil {
+		return err
 	}
 
-	if err := c.publishCallStatus(lineStatus); err != nil {
-		return fmt.Errorf("failed to publish call status: %w", err)
+	return c.publishWithRetain(ctx, topic, payload, c.retainFlags.LineStatus)
+}
+
+func (c *Client) publishCallStatus(ctx context.Context, status *types.LineStatus, data TopicData) error {
+	if !enabled(c.publishTopics.Call) {
+		return nil
+	}
+	topic, err := c.topic(c.topics.Call, data)
+	if err != nil {
+		return err
 	}
 
-	// Publish call history
-	// if err := c.publishCallHistory(); err != nil {
-	// 	return fmt.Errorf("failed to publish call history: %w", err)
-	// }
+	payload, err := c.encode("call", codec.Message{Kind: "call.status", Subject: status.ID, Time: status.LastUpdated, Value: status})
+	if err != nil {
+		return err
+	}
 
-	// Publish individual call event
-	// if err := c.publishEvent(event); err != nil {
-	// 	return fmt.Errorf("failed to publish call event: %w", err)
-	// }
+	return c.publishWithRetain(ctx, topic, payload, c.retainFlags.Call)
+}
 
-	return nil
+// expireCallTopic clears the retained topic of a finished call once the
+// call topic TTL has elapsed. c.mu must be held.
+func (c *Client) expireCallTopic(data TopicData) {
+	if c.callTopicTTL <= 0 || !c.retainFlags.Call || !enabled(c.publishTopics.Call) {
+		return
+	}
+
+	topic, err := c.topic(c.topics.Call, data)
+	if err != nil {
+		log.Printf("Failed to build call topic for expiry: %v", err)
+		return
+	}
+
+	c.scheduleCallTopicRemoval(topic, c.callTopicTTL)
 }
 
-// publishLineStatus publishes the status of a phone line
-func (c *Client) publishLineStatus(status *types.LineStatus) error {
-	topic := fmt.Sprintf("%s/line/%d/status", c.topicPrefix, status.Line)
+func (c *Client) publishLineLastEvent(ctx context.Context, event types.CallEvent, data TopicData) error {
+	if !enabled(c.publishTopics.LineLastEvent) || c.muted("line_last_event", event.ID) {
+		return nil
+	}
+	topic, err := c.topic(c.topics.LineLastEvent, data)
+	if err != nil {
+		return err
+	}
 
-	payload, err := json.Marshal(status)
+	payload, err := c.encode("line_last_event", codec.Message{Kind: "call." + string(event.Type), Subject: event.ID, Time: event.Timestamp, Value: event})
 	if err != nil {
-		return fmt.Errorf("failed to marshal line status: %w", err)
+		return err
 	}
 
-	return c.publish(topic, payload)
+	return c.publishEvent(ctx, topic, payload, c.retainFlags.LineLastEvent)
 }
 
-func (c *Client) publishCallStatus(status *types.LineStatus) error {
-	topic := fmt.Sprintf("%s/call/%s", c.topicPrefix, status.ID)
+// publishMissedCall adds a missed call to the list and publishes both
+// the single missed call and the updated list. A redial merged into the
+// previous entry is published as that entry with its attempt counter.
+func (c *Client) publishMissedCall(ctx context.Context, call types.MissedCall, data TopicData) error {
+	call = c.missedCalls.AddCallAt(call, c.clock.Now())
+	if c.ackTimeout > 0 {
+		c.awaitMissedCallAck(call)
+	}
 
-	payload, err := json.Marshal(status)
+	topic, err := c.topic(c.topics.MissedCall, data)
+	if err != nil {
+		return err
+	}
+	listTopic, err := c.topic(c.topics.MissedCalls, data)
 	if err != nil {
-		return fmt.Errorf("failed to marshal call status: %w", err)
+		return err
+	}
+
+	// A muted profile holds back the single missed call, the list is a state and stays current
+	if !c.muted("missed_call", call.ID) {
+		payload, err := c.encode("missed_call", codec.Message{Kind: "call.missed", Subject: call.ID, Time: call.Timestamp, Value: call})
+		if err != nil {
+			return err
+		}
+		// Single notifications are not retained, otherwise they would be replayed on every subscribe
+		if err := c.publishEvent(ctx, topic, payload, c.retainFlags.MissedCall); err != nil {
+			return err
+		}
 	}
 
-	return c.publish(topic, payload)
+	if err := c.publishMissedCalls(ctx, listTopic); err != nil {
+		return err
+	}
+	return c.publishLastMissed(ctx, call)
 }
 
-func (c *Client) publishLineLastEvent(event types.CallEvent) error {
-	topic := fmt.Sprintf("%s/line/%d/last_event", c.topicPrefix, event.Line)
+// BackfillHistory adds finished calls from before the start of the bridge,
+// oldest first, behind the calls of this run to the call history and the
+// missed call list and publishes both. Nothing is published for the single calls.
+func (c *Client) BackfillHistory(ctx context.Context, events []types.CallEvent) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ringStarts := make(map[string]time.Time)
+	var history []types.CallEvent
+	var missed []types.MissedCall
+	var last *types.CallEvent
+	for _, event := range events {
+		if event.DoNotRecord {
+			continue
+		}
+		history = append(history, c.historyGate.Add(event)...)
+
+		switch event.Type {
+		case types.CallTypeRing:
+			ringStarts[event.ID] = event.Timestamp
+		case types.CallTypeDisconnect:
+			if ringStart, rang := ringStarts[event.ID]; rang && event.Status == types.CallStatusMissedCall {
+				missed = append(missed, types.NewMissedCall(event, ringStart))
+			}
+			delete(ringStarts, event.ID)
+			last = &event
+		}
+	}
+	c.callHistory.AddOlderCallsAt(history, c.clock.Now())
+	c.missedCalls.AddOlderCallsAt(missed, c.clock.Now())
 
-	payload, err := json.Marshal(event)
+	if last == nil || !c.connected {
+		return nil
+	}
+	data := topicDataForEvent(*last)
+	if len(history) > 0 {
+		if err := c.publishCallHistory(ctx, data); err != nil {
+			return err
+		}
+	}
+	if len(missed) == 0 {
+		return nil
+	}
+	topic, err := c.topic(c.topics.MissedCalls, data)
 	if err != nil {
-		return fmt.Errorf("failed to marshal call event: %w", err)
+		return err
 	}
+	return c.publishMissedCalls(ctx, topic)
+}
 
-	return c.publish(topic, payload)
+// publishMissedCalls publishes the missed call list to its topic. c.mu must be held.
+func (c *Client) publishMissedCalls(ctx context.Context, topic string) error {
+	payload, err := c.encode("missed_calls", codec.Message{Kind: "call.missed_list", Time: c.clock.Now(), Value: c.missedCalls})
+	if err != nil {
+		return err
+	}
+	return c.publishWithRetain(ctx, topic, payload, c.retainFlags.MissedCalls)
 }
 
-// publishCallHistory publishes the call history
-// func (c *Client) publishCallHistory() error {
-// 	topic := fmt.Sprintf("%s/history", c.topicPrefix)
+// PublishNotification sends a notification payload to the topic of a recipient.
+// Notifications are not retained, otherwise they would be replayed on every subscribe.
+func (c *Client) PublishNotification(ctx context.Context, recipient string, payload []byte) error {
+	if c.muted("notification", recipient) {
+		return nil
+	}
+	topic, err := c.topic(c.topics.Notification, TopicData{Recipient: recipient})
+	if err != nil {
+		return err
+	}
+	if payload, err = c.encode("notification", codec.Message{Kind: "notification", Subject: recipient, Time: c.clock.Now(), Value: json.RawMessage(payload)}); err != nil {
+		return err
+	}
+	return c.publishEvent(ctx, topic, payload, false)
+}
 
-// 	payload, err := json.Marshal(c.callHistory)
-// 	if err != nil {
-// 		return fmt.Errorf("failed to marshal call history: %w", err)
-// 	}
+// PublishError reports a problem that does not stop the bridge, e.g. a
+// rejected callmonitor line, as JSON. Errors are not retained.
+func (c *Client) PublishError(ctx context.Context, v any) error {
+	if c.muted("error", "") {
+		return nil
+	}
+	topic, err := c.topic(c.topics.Error, TopicData{})
+	if err != nil {
+		return err
+	}
+	payload, err := c.encode("error", codec.Message{Kind: "error", Time: c.clock.Now(), Value: v})
+	if err != nil {
+		return err
+	}
+	return c.publishEvent(ctx, topic, payload, false)
+}
 
-// 	return c.publish(topic, payload)
-// }
+// PublishCompletedCall publishes the consolidated record of a finished call
+// as JSON. Records are not retained.
+func (c *Client) PublishCompletedCall(ctx context.Context, v any) error {
+	if c.muted("call_completed", "") {
+		return nil
+	}
+	topic, err := c.topic(c.topics.CallCompleted, TopicData{})
+	if err != nil {
+		return err
+	}
+	payload, err := c.encode("call_completed", codec.Message{Kind: "call_completed", Time: c.clock.Now(), Value: v})
+	if err != nil {
+		return err
+	}
+	return c.publishEvent(ctx, topic, payload, false)
+}
+
+// PublishIncident reports an automatic restart of the bridge as JSON.
+// Incidents are not retained.
+func (c *Client) PublishIncident(ctx context.Context, v any) error {
+	if c.muted("incident", "") {
+		return nil
+	}
+	topic, err := c.topic(c.topics.Incident, TopicData{})
+	if err != nil {
+		return err
+	}
+	payload, err := c.encode("incident", codec.Message{Kind: "incident", Time: c.clock.Now(), Value: v})
+	if err != nil {
+		return err
+	}
+	return c.publishEvent(ctx, topic, payload, false)
+}
+
+// PublishMetrics publishes a snapshot of the bridge's counters as JSON.
+// Metrics are not retained; a newer snapshot replaces one held back by the
+// publish rate limit.
+func (c *Client) PublishMetrics(ctx context.Context, v any) error {
+	topic, err := c.topic(c.topics.Metrics, TopicData{})
+	if err != nil {
+		return err
+	}
+	payload, err := c.encode("metrics", codec.Message{Kind: "metrics", Time: c.clock.Now(), Value: v})
+	if err != nil {
+		return err
+	}
+	return c.publishWithRetain(ctx, topic, payload, false)
+}
+
+// PublishDatabaseHealth publishes a snapshot of the size and write latencies
+// of the database as JSON. Snapshots are not retained.
+func (c *Client) PublishDatabaseHealth(ctx context.Context, v any) error {
+	topic, err := c.topic(c.topics.DatabaseHealth, TopicData{})
+	if err != nil {
+		return err
+	}
+	payload, err := c.encode("database_health", codec.Message{Kind: "database_health", Time: c.clock.Now(), Value: v})
+	if err != nil {
+		return err
+	}
+	return c.publishWithRetain(ctx, topic, payload, false)
+}
+
+// PublishUnparsed reports a callmonitor line that could not be parsed as
+// JSON, so new Fritz!OS formats can be reported. Lines are not retained.
+func (c *Client) PublishUnparsed(ctx context.Context, v any) error {
+	if c.muted("unparsed", "") {
+		return nil
+	}
+	topic, err := c.topic(c.topics.Unparsed, TopicData{})
+	if err != nil {
+		return err
+	}
+	payload, err := c.encode("unparsed", codec.Message{Kind: "unparsed", Time: c.clock.Now(), Value: v})
+	if err != nil {
+		return err
+	}
+	return c.publishEvent(ctx, topic, payload, false)
+}
+
+// publishCallHistory publishes the call history. c.mu must be held.
+func (c *Client) publishCallHistory(ctx context.Context, data TopicData) error {
+	if !enabled(c.publishTopics.History) {
+		return nil
+	}
+	topic, err := c.topic(c.topics.History, data)
+	if err != nil {
+		return err
+	}
+	payload, err := c.encode("history", codec.Message{Kind: "call.history", Time: c.clock.Now(), Value: c.callHistory})
+	if err != nil {
+		return err
+	}
+	return c.publishWithRetain(ctx, topic, payload, c.retainFlags.History)
+}
 
 // publishEvent publishes a single call event
-// func (c *Client) publishEvent(event types.CallEvent) error {
+// func (c *Client) publishEvent(ctx context.Context, event types.CallEvent) error {
 // 	topic := fmt.Sprintf("%s/events/%s", c.topicPrefix, event.Type)
 
 // 	payload, err := json.Marshal(event)
@@ -289,25 +1238,99 @@ func (c *Client) publishLineLastEvent(event types.CallEvent) error {
 // 		return fmt.Errorf("failed to marshal call event: %w", err)
 // 	}
 
-// 	return c.publish(topic, payload)
+// 	return c.publishWithRetain(ctx, topic, payload, c.retain)
 // }
 
-// publish sends a message to the MQTT broker
-func (c *Client) publish(topic string, payload []byte) error {
+// publishWithRetain sends the state of a topic to the MQTT broker with an
+// explicit retain flag. Messages exceeding the publish rate are queued and
+// sent later; a newer state replaces a queued one.
+func (c *Client) publishWithRetain(ctx context.Context, topic string, payload []byte, retain bool) error {
+	return c.publish(ctx, queuedMessage{topic: topic, payload: payload, retain: retain, state: true})
+}
+
+// publishEvent sends a message of an event stream, e.g. a notification, that
+// must not be replaced by a later message to the same topic
+func (c *Client) publishEvent(ctx context.Context, topic string, payload []byte, retain bool) error {
+	return c.publish(ctx, queuedMessage{topic: topic, payload: payload, retain: retain})
+}
+
+// publish sends a message or hands it to the rate limit; an error reports a dropped message
+func (c *Client) publish(ctx context.Context, msg queuedMessage) error {
 	if c.client == nil || !c.client.IsConnected() {
 		return fmt.Errorf("MQTT client not connected")
 	}
+	if c.limiter != nil {
+		if allowed, err := c.limiter.allow(msg); err != nil || !allowed {
+			return err
+		}
+	}
+	return c.send(ctx, msg.topic, msg.payload, msg.retain)
+}
+
+// publishQueued sends a message released by the rate limit
+func (c *Client) publishQueued(msg queuedMessage) {
+	if c.client == nil || !c.client.IsConnected() {
+		log.Printf("Dropped queued message to topic '%s': MQTT client not connected", msg.topic)
+		return
+	}
+	if err := c.send(context.Background(), msg.topic, msg.payload, msg.retain); err != nil {
+		log.Printf("Failed to publish queued message to topic '%s': %v", msg.topic, err)
+	}
+}
 
+// PublishStats returns the publish counters; those of the rate limit are zero without a limit
+func (c *Client) PublishStats() PublishStats {
+	var stats PublishStats
+	if c.limiter != nil {
+		stats = c.limiter.snapshot()
+	}
+	stats.Failed = c.failed.Load()
+	return stats
+}
+
+// send publishes a message and waits for its acknowledgement
+func (c *Client) send(ctx context.Context, topic string, payload []byte, retain bool) error {
 	log.Printf("Publishing to topic '%s': %s", topic, string(payload))
 
-	token := c.client.Publish(topic, c.qos, c.retain, payload)
-	if token.Wait() && token.Error() != nil {
-		return fmt.Errorf("failed to publish message: %w", token.Error())
+	token := c.client.Publish(topic, c.qos, retain, payload)
+	c.publishMirrors(topic, payload, retain)
+	if err := waitToken(ctx, token, c.publishTimeout); err != nil {
+		c.failingSince.CompareAndSwap(0, c.clock.Now().UnixNano())
+		c.failed.Add(1)
+		return fmt.Errorf("failed to publish message: %w", err)
 	}
 
+	c.failingSince.Store(0)
+	if retain {
+		c.retained.record(topic, payload)
+	}
 	return nil
 }
 
+// PublishFailingSince returns when publishing on the connection started to
+// fail, or the zero time if the last publish was acknowledged. Publishes
+// dropped while disconnected do not count.
+func (c *Client) PublishFailingSince() time.Time {
+	since := c.failingSince.Load()
+	if since == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, since)
+}
+
+// waitToken waits for an MQTT operation to complete, at most until ctx is done or timeout elapses
+func waitToken(ctx context.Context, token mqtt.Token, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // getOrCreateLineStatus gets or creates a line status entry
 func (c *Client) getOrCreateLineStatus(key string, event types.CallEvent) *types.LineStatus {
 	if status, exists := c.lineStatuses[key]; exists {
@@ -318,20 +1341,25 @@ func (c *Client) getOrCreateLineStatus(key string, event types.CallEvent) *types
 		ID:          event.ID,
 		Line:        event.Line,
 		Trunk:       event.Trunk,
+		TrunkName:   event.TrunkName,
 		Direction:   event.Direction,
 		Status:      types.CallStatusIdle,
-		Extension:   *c.getOrCreateLineStatusExtension(event.Extension, ""),
-		Caller:      *c.getOrCreateLineStatusParticipant(event.Caller, ""),
-		Called:      *c.getOrCreateLineStatusParticipant(event.Called, ""),
+		Extension:   *c.getOrCreateLineStatusExtension(event.Extension, event.ExtensionName),
+		Caller:      *c.getOrCreateLineStatusParticipant(event.Caller, event.CallerMSNName),
+		Called:      *c.getOrCreateLineStatusParticipant(event.Called, event.CalledMSNName),
 		LastEvent:   event.RawMessage,
-		LastUpdated: time.Now(),
+		LastUpdated: c.clock.Now(),
 	}
 	c.lineStatuses[key] = status
 	return status
 }
 
+// getOrCreateLineStatusParticipant gets or creates a participant, a non-empty name like the name of an own MSN replaces the known one
 func (c *Client) getOrCreateLineStatusParticipant(phoneNumber string, name string) *types.LineStatusParticipant {
 	if participant, exists := c.lineStatusParticipants[phoneNumber]; exists {
+		if name != "" {
+			participant.Name = name
+		}
 		return participant
 	}
 
@@ -343,9 +1371,12 @@ func (c *Client) getOrCreateLineStatusParticipant(phoneNumber string, name strin
 	return participant
 }
 
-// getOrCreateExtension gets or creates a line status extension
+// getOrCreateExtension gets or creates a line status extension, a non-empty name replaces the known one
 func (c *Client) getOrCreateLineStatusExtension(key string, name string) *types.LineStatusExtension {
 	if extension, exists := c.lineStatusExtensions[key]; exists {
+		if name != "" {
+			extension.Name = name
+		}
 		return extension
 	}
 
@@ -386,25 +1417,51 @@ func (c *Client) GetCallHistory() *types.CallHistory {
 	return historyCopy
 }
 
-// createStatusMessage creates a JSON payload for service status (online/offline)
+// GetMissedCalls returns the current list of missed calls
+func (c *Client) GetMissedCalls() *types.MissedCallList {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// Return a copy to avoid race conditions
+	listCopy := &types.MissedCallList{
+		Calls:     make([]types.MissedCall, len(c.missedCalls.Calls)),
+		Today:     c.missedCalls.Today,
+		MaxSize:   c.missedCalls.MaxSize,
+		UpdatedAt: c.missedCalls.UpdatedAt,
+
+		MergeWindow: c.missedCalls.MergeWindow,
+	}
+	copy(listCopy.Calls, c.missedCalls.Calls)
+	return listCopy
+}
+
+// createStatusMessage creates the payload of the service status (online/offline)
 func (c *Client) createStatusMessage(state string) ([]byte, error) {
 	status := types.ServiceStatus{
 		State:       state,
-		LastChanged: time.Now(),
+		LastChanged: c.clock.Now(),
+	}
+	if state == "online" {
+		status.Broker = c.brokerState.current()
+		status.ACLCheck = c.ACLCheck()
 	}
-	return json.Marshal(status)
+	return c.encode("status", codec.Message{Kind: "status", Time: status.LastChanged, Value: status})
 }
 
 // publishBirthMessage publishes the birth message indicating the service is online
-func (c *Client) publishBirthMessage() error {
-	topic := fmt.Sprintf("%s/status", c.topicPrefix)
+func (c *Client) publishBirthMessage(ctx context.Context) error {
+	topic, err := c.topic(c.topics.Status, TopicData{})
+	if err != nil {
+		return err
+	}
 	payload, err := c.createStatusMessage("online")
 	if err != nil {
 		return fmt.Errorf("failed to create birth message: %w", err)
 	}
 
+	// The birth message bypasses the rate limit, it must not wait behind stale state
 	log.Printf("Publishing birth message to topic '%s'", topic)
-	return c.publish(topic, payload)
+	return c.send(ctx, topic, payload, c.retainFlags.Status)
 }
 
 // PublishLineStatusChange publishes FSM status changes via MQTT
@@ -412,8 +1469,11 @@ func (c *Client) PublishLineStatusChange(line int, oldStatus, newStatus types.Ca
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	// Only publish FSM debug topics when log level is debug
-	if c.logLevel == "debug" {
+	// FSM callbacks carry no context; the publish timeout still applies
+	ctx := context.Background()
+
+	// Only publish FSM debug topics when log level is debug or they are switched on
+	if c.fsmEnabled() {
 		if !c.connected {
 			return fmt.Errorf("MQTT client not connected")
 		}
@@ -423,7 +1483,7 @@ func (c *Client) PublishLineStatusChange(line int, oldStatus, newStatus types.Ca
 			Line:      line,
 			OldStatus: oldStatus,
 			NewStatus: newStatus,
-			Timestamp: time.Now().Format(time.RFC3339),
+			Timestamp: c.clock.Now().Format(time.RFC3339),
 			Event:     event,
 		}
 
@@ -435,30 +1495,44 @@ func (c *Client) PublishLineStatusChange(line int, oldStatus, newStatus types.Ca
 		}
 
 		// Publish to line-specific FSM status topic
-		topic := fmt.Sprintf("%s/fsm/line/%d/status_change", c.topicPrefix, line)
-		payload, err := json.Marshal(msg)
+		if c.muted("fsm_status_change", strconv.Itoa(line)) {
+			return nil
+		}
+		topic, err := c.topic(c.topics.FSMStatusChange, TopicData{Line: line})
+		if err != nil {
+			return err
+		}
+		payload, err := c.encode("fsm_status_change", codec.Message{Kind: "line.status_change", Subject: strconv.Itoa(line), Time: c.clock.Now(), Value: msg})
 		if err != nil {
-			return fmt.Errorf("failed to marshal FSM status change: %w", err)
+			return err
 		}
 
-		if err := c.publish(topic, payload); err != nil {
+		if err := c.publishEvent(ctx, topic, payload, c.retainFlags.FSMStatusChange); err != nil {
 			return fmt.Errorf("failed to publish FSM status change: %w", err)
 		}
 
 		// Also publish current FSM status
-		return c.publishFSMStatus(line, newStatus, event)
+		return c.publishFSMStatus(ctx, line, newStatus, event)
 	}
 
 	// When not in debug mode, FSM status changes are not published to debug topics
 	return nil
 }
 
+// fsmEnabled reports whether the FSM debug topics are published. c.mu must be held.
+func (c *Client) fsmEnabled() bool {
+	if c.publishTopics.FSM != nil {
+		return *c.publishTopics.FSM
+	}
+	return c.logLevel == "debug"
+}
+
 // publishFSMStatus publishes the current FSM status
-func (c *Client) publishFSMStatus(line int, status types.CallStatus, lastEvent *types.CallEvent) error {
+func (c *Client) publishFSMStatus(ctx context.Context, line int, status types.CallStatus, lastEvent *types.CallEvent) error {
 	msg := types.FSMStatusMessage{
 		Line:      line,
 		Status:    status,
-		Timestamp: time.Now().Format(time.RFC3339),
+		Timestamp: c.clock.Now().Format(time.RFC3339),
 	}
 
 	// Add last event info if available
@@ -475,13 +1549,16 @@ func (c *Client) publishFSMStatus(line int, status types.CallStatus, lastEvent *
 		status == types.CallStatusMissedCall ||
 		status == types.CallStatusFinished
 
-	topic := fmt.Sprintf("%s/fsm/line/%d/status", c.topicPrefix, line)
-	payload, err := json.Marshal(msg)
+	topic, err := c.topic(c.topics.FSMStatus, TopicData{Line: line})
+	if err != nil {
+		return err
+	}
+	payload, err := c.encode("fsm_status", codec.Message{Kind: "line.fsm_status", Subject: strconv.Itoa(line), Time: c.clock.Now(), Value: msg})
 	if err != nil {
-		return fmt.Errorf("failed to marshal FSM status: %w", err)
+		return err
 	}
 
-	return c.publish(topic, payload)
+	return c.publishWithRetain(ctx, topic, payload, c.retainFlags.FSMStatus)
 }
 
 // PublishTimeoutStatusUpdate publishes a line status update for timeout transitions
@@ -495,9 +1572,11 @@ func (c *Client) PublishTimeoutStatusUpdate(line int, newStatus types.CallStatus
 
 	// Find existing line status and update it
 	var lineStatus *types.LineStatus
-	for _, status := range c.lineStatuses {
+	var data TopicData
+	for key, status := range c.lineStatuses {
 		if status.Line == line {
 			lineStatus = status
+			data = c.lineTopicData[key]
 			break
 		}
 	}
@@ -509,10 +1588,10 @@ func (c *Client) PublishTimeoutStatusUpdate(line int, newStatus types.CallStatus
 
 	// Update status from FSM timeout transition
 	lineStatus.Status = newStatus
-	lineStatus.LastUpdated = time.Now()
+	lineStatus.LastUpdated = c.clock.Now()
 
-	// Publish updated line status
-	return c.publishLineStatus(lineStatus)
+	// Publish updated line status; FSM timeouts carry no context, the publish timeout still applies
+	return c.publishLineStatus(context.Background(), lineStatus, data)
 }
 
 // getValidTransitionsForStatus returns valid transitions for a given status
@@ -524,7 +1603,7 @@ func (c *Client) getValidTransitionsForStatus(status types.CallStatus) []types.C
 		return []types.CallType{types.CallTypeConnect, types.CallTypeDisconnect}
 	case types.CallStatusCalling:
 		return []types.CallType{types.CallTypeConnect, types.CallTypeDisconnect}
-	case types.CallStatusTalking:
+	case types.CallStatusTalking, types.CallStatusMessageBox:
 		return []types.CallType{types.CallTypeDisconnect}
 	default:
 		return []types.CallType{} // Final states have no valid transitions
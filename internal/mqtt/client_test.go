@@ -1,27 +1,30 @@
 package mqtt
 
 import (
+	"context"
 	"encoding/json"
+	"net"
 	"testing"
 	"time"
 
-	"fritz-callmonitor2mqtt/pkg/types"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
 )
 
 func TestNewClient(t *testing.T) {
-	client := NewClient(
-		"localhost",
-		1883,
-		"user",
-		"pass",
-		"test-client",
-		"test/topic",
-		1,
-		true,
-		60*time.Second,
-		30*time.Second,
-		"info",
-	)
+	client := NewClient(Options{
+		Broker:         "localhost",
+		Port:           1883,
+		Username:       "user",
+		Password:       "pass",
+		ClientID:       "test-client",
+		TopicPrefix:    "test/topic",
+		QoS:            1,
+		Retain:         true,
+		KeepAlive:      60 * time.Second,
+		ConnectTimeout: 30 * time.Second,
+		LogLevel:       "info",
+	})
 
 	if client.broker != "localhost" {
 		t.Errorf("Expected broker 'localhost', got %s", client.broker)
@@ -40,11 +43,28 @@ func TestNewClient(t *testing.T) {
 	}
 }
 
+func TestNewClientDefaults(t *testing.T) {
+	client := NewClient(Options{QoS: 0, Retain: false})
+
+	defaults := DefaultOptions()
+	if client.broker != defaults.Broker || client.port != defaults.Port {
+		t.Errorf("Expected default broker %s:%d, got %s:%d", defaults.Broker, defaults.Port, client.broker, client.port)
+	}
+	if client.topicPrefix != defaults.TopicPrefix {
+		t.Errorf("Expected default topic prefix %s, got %s", defaults.TopicPrefix, client.topicPrefix)
+	}
+	if client.keepAlive != defaults.KeepAlive || client.connectTimeout != defaults.ConnectTimeout {
+		t.Errorf("Expected default timeouts, got keepAlive=%v connectTimeout=%v", client.keepAlive, client.connectTimeout)
+	}
+
+	// QoS 0 and Retain false are valid settings and must not be overridden
+	if client.qos != 0 || client.retain {
+		t.Errorf("Expected QoS 0 without retain, got qos=%d retain=%v", client.qos, client.retain)
+	}
+}
+
 func TestLineStatusManagement(t *testing.T) {
-	client := NewClient(
-		"localhost", 1883, "", "", "test", "test", 1, true,
-		60*time.Second, 30*time.Second, "info",
-	)
+	client := NewClient(Options{ClientID: "test", TopicPrefix: "test", QoS: 1, Retain: true})
 
 	// Create test event
 	event := types.CallEvent{
@@ -86,13 +106,7 @@ func TestLineStatusManagement(t *testing.T) {
 }
 
 func TestCallHistoryLimit(t *testing.T) {
-	client := NewClient(
-		"localhost", 1883, "", "", "test", "test", 1, true,
-		60*time.Second, 30*time.Second, "info",
-	)
-
-	// Set smaller history size for testing
-	client.callHistory.MaxSize = 3
+	client := NewClient(Options{ClientID: "test", TopicPrefix: "test", QoS: 1, Retain: true, CallHistorySize: 3})
 
 	// Add more calls than the limit
 	for i := 1; i <= 5; i++ {
@@ -121,11 +135,136 @@ func TestCallHistoryLimit(t *testing.T) {
 	}
 }
 
+func TestCallHistoryStores(t *testing.T) {
+	defaults := NewClient(Options{})
+	if defaults.callHistory.MaxSize != 50 || defaults.missedCalls.MaxSize != 50 {
+		t.Errorf("Expected default history size 50, got %d and %d", defaults.callHistory.MaxSize, defaults.missedCalls.MaxSize)
+	}
+
+	// Injected stores are used as they are, unset sizes come from CallHistorySize
+	history := &types.CallHistory{MaxSize: 5}
+	missed := &types.MissedCallList{}
+	client := NewClient(Options{CallHistorySize: 20, CallHistory: history, MissedCalls: missed})
+
+	if client.callHistory != history || client.missedCalls != missed {
+		t.Fatal("Expected the injected stores to be used")
+	}
+	if history.MaxSize != 5 || missed.MaxSize != 20 {
+		t.Errorf("Expected sizes 5 and 20, got %d and %d", history.MaxSize, missed.MaxSize)
+	}
+}
+
+func TestRetainTopics(t *testing.T) {
+	yes, no := true, false
+
+	tests := []struct {
+		name     string
+		retain   bool
+		override TopicRetain
+		expected retainFlags
+	}{
+		{
+			name:     "retain all but the missed call notification",
+			retain:   true,
+			expected: retainFlags{Status: true, LineStatus: true, LineLastEvent: true, Call: true, MissedCalls: true, History: true, FSMStatus: true, FSMStatusChange: true},
+		},
+		{
+			name:     "retain nothing",
+			retain:   false,
+			expected: retainFlags{},
+		},
+		{
+			name:     "retain status but not events",
+			retain:   true,
+			override: TopicRetain{LineLastEvent: &no, Call: &no, FSMStatusChange: &no},
+			expected: retainFlags{Status: true, LineStatus: true, MissedCalls: true, History: true, FSMStatus: true},
+		},
+		{
+			name:     "retain only the service status",
+			retain:   false,
+			override: TopicRetain{Status: &yes, MissedCall: &yes},
+			expected: retainFlags{Status: true, MissedCall: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient(Options{Retain: tt.retain, RetainTopics: tt.override})
+			if client.retainFlags != tt.expected {
+				t.Errorf("Expected %+v, got %+v", tt.expected, client.retainFlags)
+			}
+		})
+	}
+}
+
+func TestDoNotRecordSkipsHistory(t *testing.T) {
+	client := NewClient(Options{ClientID: "test", TopicPrefix: "test", QoS: 1, Retain: true})
+	// Pretend to be connected; publishing itself fails without a broker
+	client.connected = true
+
+	event := types.CallEvent{
+		ID:          "call-1",
+		Timestamp:   time.Now(),
+		Type:        types.CallTypeRing,
+		Line:        1,
+		Trunk:       "SIP0",
+		Status:      types.CallStatusRinging,
+		DoNotRecord: true,
+	}
+	_ = client.PublishCallEvent(context.Background(), event)
+
+	if len(client.callHistory.Calls) != 0 {
+		t.Errorf("Expected do-not-record call to be kept out of history, got %d calls", len(client.callHistory.Calls))
+	}
+
+	// Live line status is still tracked
+	status, exists := client.lineStatuses["SIP0_1"]
+	if !exists {
+		t.Fatal("Expected line status to be updated")
+	}
+	if status.Status != types.CallStatusRinging {
+		t.Errorf("Expected line status ringing, got %s", status.Status)
+	}
+}
+
+func TestBackfillHistory(t *testing.T) {
+	client := NewClient(Options{ClientID: "test", TopicPrefix: "test", QoS: 1, Retain: true})
+
+	at := time.Date(2025, 9, 20, 10, 0, 0, 0, time.UTC)
+	missed := types.CallStatusMissedCall
+	finished := types.CallStatusFinished
+	events := []types.CallEvent{
+		{ID: "missed", Timestamp: at, Type: types.CallTypeRing, Caller: "+49301234567", Status: types.CallStatusRinging},
+		{ID: "missed", Timestamp: at, Type: types.CallTypeDisconnect, Caller: "+49301234567", Status: types.CallStatusMissedCall, FinishState: &missed},
+		{ID: "outgoing", Timestamp: at.Add(time.Hour), Type: types.CallTypeCall, Called: "+49309876543", Status: types.CallStatusCalling},
+		{ID: "outgoing", Timestamp: at.Add(time.Hour), Type: types.CallTypeConnect, Called: "+49309876543", Status: types.CallStatusTalking},
+		{ID: "outgoing", Timestamp: at.Add(time.Hour + time.Minute), Type: types.CallTypeDisconnect, Called: "+49309876543", Status: types.CallStatusFinished, FinishState: &finished},
+		{ID: "private", Timestamp: at.Add(2 * time.Hour), Type: types.CallTypeRing, Status: types.CallStatusRinging, DoNotRecord: true},
+	}
+	// A call of this run arrived before the backfill
+	client.callHistory.AddCallAt(types.CallEvent{ID: "live", Timestamp: at.Add(3 * time.Hour), Type: types.CallTypeRing}, at.Add(3*time.Hour))
+
+	// Not connected, so nothing is published
+	if err := client.BackfillHistory(context.Background(), events); err != nil {
+		t.Fatalf("Failed to backfill history: %v", err)
+	}
+
+	if len(client.callHistory.Calls) != 6 {
+		t.Fatalf("Expected 6 history events, got %d", len(client.callHistory.Calls))
+	}
+	if client.callHistory.Calls[0].ID != "live" || client.callHistory.Calls[1].Type != types.CallTypeDisconnect || client.callHistory.Calls[5].ID != "missed" {
+		t.Errorf("Expected the backfilled calls behind the live call, newest first, got %+v", client.callHistory.Calls)
+	}
+	if len(client.missedCalls.Calls) != 1 {
+		t.Fatalf("Expected 1 missed call, got %d", len(client.missedCalls.Calls))
+	}
+	if client.missedCalls.Calls[0].Caller.PhoneNumber != "+49301234567" {
+		t.Errorf("Expected missed call from +49301234567, got %s", client.missedCalls.Calls[0].Caller.PhoneNumber)
+	}
+}
+
 func TestIsConnected(t *testing.T) {
-	client := NewClient(
-		"localhost", 1883, "", "", "test", "test", 1, true,
-		60*time.Second, 30*time.Second, "info",
-	)
+	client := NewClient(Options{ClientID: "test", TopicPrefix: "test", QoS: 1, Retain: true})
 
 	if client.IsConnected() {
 		t.Error("Expected client to be disconnected initially")
@@ -140,10 +279,8 @@ func TestIsConnected(t *testing.T) {
 }
 
 func TestCreateStatusMessage(t *testing.T) {
-	client := NewClient(
-		"localhost", 1883, "", "", "test", "test", 1, true,
-		60*time.Second, 30*time.Second, "info",
-	)
+	now := time.Date(2025, 9, 21, 15, 35, 0, 0, time.UTC)
+	client := NewClient(Options{ClientID: "test", TopicPrefix: "test", QoS: 1, Retain: true, Clock: clock.NewFake(now)})
 
 	// Test online status message
 	onlinePayload, err := client.createStatusMessage("online")
@@ -177,18 +314,13 @@ func TestCreateStatusMessage(t *testing.T) {
 		t.Errorf("Expected state 'offline', got '%s'", offlineStatus.State)
 	}
 
-	// Verify LastChanged is recent
-	timeDiff := time.Since(offlineStatus.LastChanged)
-	if timeDiff > 5*time.Second {
-		t.Errorf("LastChanged timestamp seems too old: %v", timeDiff)
+	if !offlineStatus.LastChanged.Equal(now) {
+		t.Errorf("Expected LastChanged %v from the clock, got %v", now, offlineStatus.LastChanged)
 	}
 }
 
 func TestCallEventStatusMapping(t *testing.T) {
-	client := NewClient(
-		"localhost", 1883, "", "", "test", "test", 1, true,
-		60*time.Second, 30*time.Second, "info",
-	)
+	client := NewClient(Options{ClientID: "test", TopicPrefix: "test", QoS: 1, Retain: true})
 
 	// Test different call types and their expected status mappings
 	testCases := []struct {
@@ -264,16 +396,10 @@ func TestCallEventStatusMapping(t *testing.T) {
 
 func TestFSMDebugTopicsOnlyOnDebugLevel(t *testing.T) {
 	// Test with info log level - FSM topics should not be published
-	clientInfo := NewClient(
-		"localhost", 1883, "", "", "test", "test", 1, true,
-		60*time.Second, 30*time.Second, "info",
-	)
+	clientInfo := NewClient(Options{ClientID: "test", TopicPrefix: "test", QoS: 1, Retain: true})
 
 	// Test with debug log level - FSM topics should be published
-	clientDebug := NewClient(
-		"localhost", 1883, "", "", "test", "test", 1, true,
-		60*time.Second, 30*time.Second, "debug",
-	)
+	clientDebug := NewClient(Options{ClientID: "test", TopicPrefix: "test", QoS: 1, Retain: true, LogLevel: "debug"})
 
 	// Verify log level is set correctly
 	if clientInfo.logLevel != "info" {
@@ -299,3 +425,29 @@ func TestFSMDebugTopicsOnlyOnDebugLevel(t *testing.T) {
 		t.Errorf("Expected 'MQTT client not connected' error, got: %v", err)
 	}
 }
+
+func TestConnectGivesUpOnContext(t *testing.T) {
+	// A broker that accepts connections but never answers
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	client := NewClient(Options{
+		Broker:   "127.0.0.1",
+		Port:     listener.Addr().(*net.TCPAddr).Port,
+		ClientID: "test",
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := client.Connect(ctx); err == nil {
+		t.Fatal("Expected connect to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Connect did not honor context, took %v", elapsed)
+	}
+}
@@ -0,0 +1,78 @@
+package mqtt
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Suffixes appended to the client ID, so several bridges can share a configuration
+const (
+	ClientIDSuffixNone     = ""
+	ClientIDSuffixHostname = "hostname" // Host name, stable across restarts, e.g. in a container
+	ClientIDSuffixRandom   = "random"   // Random per start
+)
+
+// A broker disconnects the older of two clients with the same client ID, and
+// both reconnect with the same ID. Connections lost this soon after connecting
+// are counted; this many within the window are reported as a client ID collision.
+const (
+	collisionSession = 10 * time.Second
+	collisionWindow  = 5 * time.Minute
+	collisionCount   = 3
+)
+
+// SuffixClientID appends the suffix of the kind to the client ID, e.g.
+// fritz-callmonitor2mqtt-nas for the hostname suffix on host nas
+func SuffixClientID(clientID, kind string) (string, error) {
+	switch kind {
+	case ClientIDSuffixNone:
+		return clientID, nil
+	case ClientIDSuffixHostname:
+		hostname, err := os.Hostname()
+		if err != nil {
+			return "", fmt.Errorf("failed to determine host name for the client ID: %w", err)
+		}
+		// Only the short host name, e.g. nas of nas.fritz.box, so the ID stays short
+		hostname, _, _ = strings.Cut(hostname, ".")
+		return clientID + "-" + hostname, nil
+	case ClientIDSuffixRandom:
+		b := make([]byte, 4)
+		if _, err := rand.Read(b); err != nil {
+			return "", fmt.Errorf("failed to create random client ID suffix: %w", err)
+		}
+		return clientID + "-" + hex.EncodeToString(b), nil
+	default:
+		return "", fmt.Errorf("invalid client ID suffix '%s', expected hostname or random", kind)
+	}
+}
+
+// noteConnectionLost records a connection lost at now and reports whether
+// it completes a series of connections lost right after connecting, which
+// points to another client using the same client ID; c.mu must be held
+func (c *Client) noteConnectionLost(now time.Time) bool {
+	if c.connectedAt.IsZero() || now.Sub(c.connectedAt) >= collisionSession {
+		return false
+	}
+	kept := c.shortSessions[:0]
+	for _, lost := range c.shortSessions {
+		if now.Sub(lost) < collisionWindow {
+			kept = append(kept, lost)
+		}
+	}
+	c.shortSessions = append(kept, now)
+	if len(c.shortSessions) < collisionCount {
+		return false
+	}
+
+	c.shortSessions = nil
+	log.Printf("WARNING: MQTT connection was lost %d times within %v right after connecting. "+
+		"Another client is probably connected with the client ID %s and the broker disconnects one of them on every connect. "+
+		"Give each instance its own FRITZ_CALLMONITOR_MQTT_CLIENT_ID or set FRITZ_CALLMONITOR_MQTT_CLIENT_ID_SUFFIX=hostname or random",
+		collisionCount, collisionWindow, c.clientID)
+	return true
+}
@@ -0,0 +1,66 @@
+package mqtt
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSuffixClientID(t *testing.T) {
+	if id, err := SuffixClientID("fritz", ClientIDSuffixNone); err != nil || id != "fritz" {
+		t.Errorf("Expected the client ID unchanged, got %q (%v)", id, err)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		t.Skipf("Host name not available: %v", err)
+	}
+	hostname, _, _ = strings.Cut(hostname, ".")
+	if id, err := SuffixClientID("fritz", ClientIDSuffixHostname); err != nil || id != "fritz-"+hostname {
+		t.Errorf("Expected fritz-%s, got %q (%v)", hostname, id, err)
+	}
+
+	first, err := SuffixClientID("fritz", ClientIDSuffixRandom)
+	if err != nil {
+		t.Fatalf("SuffixClientID failed: %v", err)
+	}
+	second, _ := SuffixClientID("fritz", ClientIDSuffixRandom)
+	if !strings.HasPrefix(first, "fritz-") || len(first) != len("fritz-")+8 || first == second {
+		t.Errorf("Expected two different random suffixes, got %q and %q", first, second)
+	}
+
+	if _, err := SuffixClientID("fritz", "pid"); err == nil {
+		t.Error("Expected an error for an unknown suffix")
+	}
+}
+
+func TestNoteConnectionLost(t *testing.T) {
+	client := NewClient(DefaultOptions())
+	now := time.Date(2025, 9, 21, 15, 0, 0, 0, time.UTC)
+
+	// A connection that lasted is no sign of a collision
+	client.connectedAt = now.Add(-time.Hour)
+	if client.noteConnectionLost(now) {
+		t.Error("Expected no collision for a long connection")
+	}
+
+	// Kicked right after connecting three times within the window
+	for i := range collisionCount {
+		now = now.Add(time.Minute)
+		client.connectedAt = now.Add(-time.Second)
+		collision := client.noteConnectionLost(now)
+		if collision != (i == collisionCount-1) {
+			t.Errorf("Short connection %d: expected collision %v, got %v", i+1, i == collisionCount-1, collision)
+		}
+	}
+
+	// Short connections too far apart do not add up
+	for range collisionCount {
+		now = now.Add(collisionWindow)
+		client.connectedAt = now.Add(-time.Second)
+		if client.noteConnectionLost(now) {
+			t.Error("Expected no collision for short connections outside the window")
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package mqtt
+
+import (
+	"context"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/codec"
+)
+
+// TopicDescription is the retained payload of the description topic. It lists
+// the topics of the running bridge, so consumers can configure themselves.
+type TopicDescription struct {
+	Version string      `json:"version"`
+	Topics  []TopicInfo `json:"topics"`
+}
+
+// TopicInfo describes a single topic
+type TopicInfo struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"`   // Subscription filter, + stands for levels depending on the call
+	Direction   string `json:"direction"` // publish, or subscribe for command topics
+	Retained    bool   `json:"retained"`
+	QoS         byte   `json:"qos"`
+	Schema      string `json:"schema"`                 // Type of the JSON payload, see docs/MQTT.md
+	ContentType string `json:"content_type,omitempty"` // Media type of the payload, empty for command topics
+}
+
+// describeTopics builds the description of all topics from the topic registry
+func (c *Client) describeTopics() (TopicDescription, error) {
+	description := TopicDescription{Version: c.version, Topics: []TopicInfo{}}
+	for _, entry := range topicRegistry(&TopicTemplates{}, c.topics) {
+		if c.dnd == nil && (entry.name == "dnd" || entry.name == "dnd_command") {
+			continue
+		}
+		if c.ackTimeout == 0 && entry.name == "missed_call_ack" {
+			continue
+		}
+		if c.onReload == nil && entry.name == "reload_command" {
+			continue
+		}
+		if c.callQueries == nil && (entry.name == "call_query" || entry.name == "call_query_response") {
+			continue
+		}
+		if !c.profileTopics && (entry.name == "profile" || entry.name == "profile_command") {
+			continue
+		}
+		if c.elapsedInterval <= 0 && entry.name == "line_elapsed" {
+			continue
+		}
+		if !c.topicEnabled(entry.name) {
+			continue
+		}
+		pattern, err := (*entry.topic).Filter(c.topicPrefix, c.box)
+		if err != nil {
+			return TopicDescription{}, err
+		}
+		info := TopicInfo{
+			Name:      entry.name,
+			Pattern:   pattern,
+			Direction: entry.direction,
+			Retained:  entry.retain(c.retainFlags),
+			QoS:       c.qos,
+			Schema:    entry.schema,
+		}
+		if entry.direction == TopicPublish {
+			info.ContentType = c.codecs[entry.name].ContentType()
+		}
+		description.Topics = append(description.Topics, info)
+	}
+	return description, nil
+}
+
+// publishTopicDescription publishes the retained description of all topics
+func (c *Client) publishTopicDescription(ctx context.Context) error {
+	description, err := c.describeTopics()
+	if err != nil {
+		return err
+	}
+	topic, err := c.topic(c.topics.Description, TopicData{})
+	if err != nil {
+		return err
+	}
+	payload, err := c.encode("description", codec.Message{Kind: "description", Time: c.clock.Now(), Value: description})
+	if err != nil {
+		return err
+	}
+	return c.publishWithRetain(ctx, topic, payload, true)
+}
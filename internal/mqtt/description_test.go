@@ -0,0 +1,83 @@
+package mqtt
+
+import (
+	"testing"
+)
+
+func TestDescribeTopics(t *testing.T) {
+	topics, err := ParseTopics(TopicTemplates{
+		Call:         "{{.Prefix}}/{{.Box}}/call/{{.ID}}",
+		Notification: "{{.Prefix}}/notify/{{.Recipient}}/{{.Type}}_{{.Direction}}",
+		Error:        "{{.Prefix}}/error/{{.MSN}}",
+	})
+	if err != nil {
+		t.Fatalf("ParseTopics failed: %v", err)
+	}
+	client := NewClient(Options{TopicPrefix: "fritz", Box: "box", Topics: topics, QoS: 2, Retain: true, Version: "1.2.3"})
+
+	description, err := client.describeTopics()
+	if err != nil {
+		t.Fatalf("describeTopics failed: %v", err)
+	}
+	if description.Version != "1.2.3" {
+		t.Errorf("Expected version 1.2.3, got %q", description.Version)
+	}
+
+	byName := make(map[string]TopicInfo)
+	for _, topic := range description.Topics {
+		byName[topic.Name] = topic
+	}
+	tests := []struct {
+		name     string
+		pattern  string
+		retained bool
+	}{
+		{"status", "fritz/status", true},
+		{"line_status", "fritz/line/+/status", true},
+		{"call", "fritz/box/call/+", true},
+		{"missed_call", "fritz/missed_call", false},
+		{"notification", "fritz/notify/+/+", false},
+		{"error", "fritz/error/+", false},
+		{"description", "fritz/$topics", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			topic, ok := byName[tt.name]
+			if !ok {
+				t.Fatalf("Topic %s not described", tt.name)
+			}
+			if topic.Pattern != tt.pattern || topic.Retained != tt.retained || topic.QoS != 2 || topic.Direction != "publish" || topic.Schema == "" || topic.ContentType != "application/json" {
+				t.Errorf("Unexpected description %+v, expected pattern %q, retained %v", topic, tt.pattern, tt.retained)
+			}
+		})
+	}
+
+	if _, ok := byName["dnd_command"]; ok {
+		t.Error("DND topics must not be described without DND control")
+	}
+	if _, ok := byName["missed_call_ack"]; ok {
+		t.Error("The acknowledgement topic must not be described without a missed call ack timeout")
+	}
+}
+
+func TestDescribeTopicsSwitchedOff(t *testing.T) {
+	off := false
+	client := NewClient(Options{TopicPrefix: "fritz", PublishTopics: TopicEnabled{History: &off, FSM: &off}})
+
+	description, err := client.describeTopics()
+	if err != nil {
+		t.Fatalf("describeTopics failed: %v", err)
+	}
+	described := make(map[string]bool)
+	for _, topic := range description.Topics {
+		described[topic.Name] = true
+	}
+	for _, name := range []string{"history", "fsm_status", "fsm_status_change"} {
+		if described[name] {
+			t.Errorf("Topic %s switched off but described", name)
+		}
+	}
+	if !described["line_status"] || !described["missed_calls"] {
+		t.Error("Topics not switched off must be described")
+	}
+}
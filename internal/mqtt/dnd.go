@@ -0,0 +1,176 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/codec"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// DeflectionService reads and switches the call deflection rules of the Fritz!Box
+type DeflectionService interface {
+	GetDeflections(ctx context.Context) ([]types.Deflection, error)
+	SetDeflectionEnable(ctx context.Context, id int, enable bool) error
+}
+
+// DNDState is the retained payload of the DND topic
+type DNDState struct {
+	Enabled     bool               `json:"enabled"`     // All controlled deflection rules are enabled
+	Controlled  []int              `json:"controlled"`  // IDs of the rules switched by ON/OFF
+	Deflections []types.Deflection `json:"deflections"` // All deflection rules of the Fritz!Box
+	LastUpdated time.Time          `json:"last_updated"`
+}
+
+// DNDCommand switches deflection rules. Without ID all controlled rules are switched.
+type DNDCommand struct {
+	ID     *int `json:"id,omitempty"`
+	Enable bool `json:"enable"`
+}
+
+// ParseDNDCommand accepts ON/OFF (also true/false, 1/0) or a JSON DNDCommand
+func ParseDNDCommand(payload []byte) (DNDCommand, error) {
+	text := strings.TrimSpace(string(payload))
+	switch strings.ToLower(text) {
+	case "on", "true", "1":
+		return DNDCommand{Enable: true}, nil
+	case "off", "false", "0":
+		return DNDCommand{Enable: false}, nil
+	}
+
+	var command DNDCommand
+	if err := json.Unmarshal([]byte(text), &command); err != nil {
+		return DNDCommand{}, fmt.Errorf("invalid DND command %q, expected ON, OFF or {\"id\": N, \"enable\": true}", text)
+	}
+	return command, nil
+}
+
+// subscribeDNDCommands listens on the DND command topic; subscriptions are lost on reconnect with a clean session
+func (c *Client) subscribeDNDCommands(client mqtt.Client) error {
+	topic, err := c.topic(c.topics.DNDCommand, TopicData{})
+	if err != nil {
+		return err
+	}
+	if err := waitToken(context.Background(), client.Subscribe(topic, c.qos, c.onDNDCommand), c.publishTimeout); err != nil {
+		return fmt.Errorf("failed to subscribe to '%s': %w", topic, err)
+	}
+	log.Printf("Listening for DND commands on topic '%s'", topic)
+	return nil
+}
+
+// onDNDCommand runs the command outside of the paho callback, which must not block
+func (c *Client) onDNDCommand(_ mqtt.Client, msg mqtt.Message) {
+	// A retained command would switch the rules again on every reconnect
+	if msg.Retained() {
+		log.Printf("Ignoring retained DND command on topic '%s'", msg.Topic())
+		return
+	}
+
+	payload := msg.Payload()
+	go func() {
+		if err := c.HandleDNDCommand(context.Background(), payload); err != nil {
+			log.Printf("DND command failed: %v", err)
+		}
+	}()
+}
+
+// HandleDNDCommand applies a command payload and publishes the resulting state
+func (c *Client) HandleDNDCommand(ctx context.Context, payload []byte) error {
+	if c.dnd == nil {
+		return fmt.Errorf("DND control is not configured")
+	}
+	command, err := ParseDNDCommand(payload)
+	if err != nil {
+		return err
+	}
+
+	c.dndMu.Lock()
+	defer c.dndMu.Unlock()
+
+	deflections, err := c.dnd.GetDeflections(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read deflections: %w", err)
+	}
+
+	targets := c.controlledDeflections(deflections)
+	if command.ID != nil {
+		if !slices.ContainsFunc(deflections, func(d types.Deflection) bool { return d.ID == *command.ID }) {
+			return fmt.Errorf("unknown deflection %d", *command.ID)
+		}
+		targets = []int{*command.ID}
+	}
+
+	for _, deflection := range deflections {
+		if !slices.Contains(targets, deflection.ID) || deflection.Enable == command.Enable {
+			continue
+		}
+		if err := c.dnd.SetDeflectionEnable(ctx, deflection.ID, command.Enable); err != nil {
+			return fmt.Errorf("failed to switch deflection %d: %w", deflection.ID, err)
+		}
+		log.Printf("Deflection %d enabled: %t", deflection.ID, command.Enable)
+	}
+	return c.refreshDND(ctx)
+}
+
+// RefreshDND publishes the current deflection state, e.g. after rules were changed in the Fritz!Box UI
+func (c *Client) RefreshDND(ctx context.Context) error {
+	// The state is published on connect
+	if c.dnd == nil || !c.IsConnected() {
+		return nil
+	}
+
+	c.dndMu.Lock()
+	defer c.dndMu.Unlock()
+	return c.refreshDND(ctx)
+}
+
+// refreshDND reads and publishes the deflection state; c.dndMu must be held
+func (c *Client) refreshDND(ctx context.Context) error {
+	deflections, err := c.dnd.GetDeflections(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read deflections: %w", err)
+	}
+
+	controlled := c.controlledDeflections(deflections)
+	enabled := 0
+	for _, deflection := range deflections {
+		if slices.Contains(controlled, deflection.ID) && deflection.Enable {
+			enabled++
+		}
+	}
+	state := DNDState{
+		Enabled:     len(controlled) > 0 && enabled == len(controlled),
+		Controlled:  controlled,
+		Deflections: deflections,
+		LastUpdated: c.clock.Now(),
+	}
+
+	topic, err := c.topic(c.topics.DND, TopicData{})
+	if err != nil {
+		return err
+	}
+	payload, err := c.encode("dnd", codec.Message{Kind: "dnd", Time: state.LastUpdated, Value: state})
+	if err != nil {
+		return err
+	}
+	return c.publishWithRetain(ctx, topic, payload, true)
+}
+
+// controlledDeflections returns the configured rule IDs, or all rules if none are configured
+func (c *Client) controlledDeflections(deflections []types.Deflection) []int {
+	if len(c.dndDeflections) > 0 {
+		return c.dndDeflections
+	}
+	ids := make([]int, 0, len(deflections))
+	for _, deflection := range deflections {
+		ids = append(ids, deflection.ID)
+	}
+	return ids
+}
@@ -0,0 +1,137 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/broker"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// fakeDeflections keeps deflection rules in memory
+type fakeDeflections struct {
+	mu          sync.Mutex
+	deflections []types.Deflection
+}
+
+func (f *fakeDeflections) GetDeflections(ctx context.Context) ([]types.Deflection, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]types.Deflection(nil), f.deflections...), nil
+}
+
+func (f *fakeDeflections) SetDeflectionEnable(ctx context.Context, id int, enable bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.deflections {
+		if f.deflections[i].ID == id {
+			f.deflections[i].Enable = enable
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown deflection %d", id)
+}
+
+func TestParseDNDCommand(t *testing.T) {
+	id := 2
+	tests := []struct {
+		payload     string
+		expected    DNDCommand
+		expectError bool
+	}{
+		{"ON", DNDCommand{Enable: true}, false},
+		{" off\n", DNDCommand{Enable: false}, false},
+		{"1", DNDCommand{Enable: true}, false},
+		{`{"enable": true}`, DNDCommand{Enable: true}, false},
+		{`{"id": 2, "enable": false}`, DNDCommand{ID: &id, Enable: false}, false},
+		{"night", DNDCommand{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.payload, func(t *testing.T) {
+			command, err := ParseDNDCommand([]byte(tt.payload))
+			if (err != nil) != tt.expectError {
+				t.Fatalf("ParseDNDCommand() error = %v, expectError %v", err, tt.expectError)
+			}
+			if command.Enable != tt.expected.Enable || (command.ID == nil) != (tt.expected.ID == nil) ||
+				(command.ID != nil && *command.ID != *tt.expected.ID) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, command)
+			}
+		})
+	}
+}
+
+func TestDNDCommands(t *testing.T) {
+	b, host, port := startTestBroker(t)
+
+	states := make(chan DNDState, 10)
+	err := b.Subscribe("test/dnd", func(msg broker.Message) {
+		var state DNDState
+		if err := json.Unmarshal(msg.Payload, &state); err != nil {
+			t.Errorf("Invalid DND state payload: %v", err)
+			return
+		}
+		states <- state
+	})
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	box := &fakeDeflections{deflections: []types.Deflection{{ID: 0}, {ID: 1}, {ID: 2, Enable: true}}}
+	client := newTestClient(t, host, port, Options{
+		DND:            box,
+		DNDDeflections: []int{0, 1},
+	})
+
+	// nextState waits for the next published DND state
+	nextState := func() DNDState {
+		t.Helper()
+		select {
+		case state := <-states:
+			return state
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for DND state")
+			return DNDState{}
+		}
+	}
+
+	if state := nextState(); state.Enabled || len(state.Deflections) != 3 {
+		t.Fatalf("Expected disabled initial state with 3 rules, got %+v", state)
+	}
+
+	tests := []struct {
+		payload  string
+		expected []bool // Enable flags of the rules after the command
+		enabled  bool
+	}{
+		{"ON", []bool{true, true, true}, true},
+		{`{"id": 2, "enable": false}`, []bool{true, true, false}, true},
+		{"OFF", []bool{false, false, false}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.payload, func(t *testing.T) {
+			if err := b.Publish("test/command/dnd", []byte(tt.payload), false); err != nil {
+				t.Fatalf("Publish failed: %v", err)
+			}
+
+			state := nextState()
+			if state.Enabled != tt.enabled {
+				t.Errorf("Expected enabled=%t, got %t", tt.enabled, state.Enabled)
+			}
+			for i, deflection := range state.Deflections {
+				if deflection.Enable != tt.expected[i] {
+					t.Errorf("Expected deflection %d enabled=%t, got %t", deflection.ID, tt.expected[i], deflection.Enable)
+				}
+			}
+		})
+	}
+
+	if err := client.HandleDNDCommand(context.Background(), []byte(`{"id": 7, "enable": true}`)); err == nil {
+		t.Error("Expected unknown deflection to fail")
+	}
+}
@@ -0,0 +1,116 @@
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/codec"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// ElapsedMessage is the payload of the elapsed topic, published while a call is talking
+type ElapsedMessage struct {
+	ID      string    `json:"id"`
+	Line    int       `json:"line"`
+	Trunk   string    `json:"trunk,omitempty"`
+	Since   time.Time `json:"since"`   // Local time of the CONNECT
+	Elapsed int       `json:"elapsed"` // Seconds since the CONNECT
+	Display string    `json:"display"` // Elapsed time as mm:ss, from one hour on as h:mm:ss
+	Running bool      `json:"running"` // False in the last message, once the call left the talking state
+}
+
+// elapsedTicker publishes the elapsed time of one talking call
+type elapsedTicker struct {
+	message ElapsedMessage
+	data    TopicData
+	timer   clock.Timer
+}
+
+// updateElapsed starts the elapsed ticker of a call that started talking and
+// stops it with a last message once the call left the talking state. c.mu
+// must be held.
+func (c *Client) updateElapsed(ctx context.Context, event types.CallEvent, status *types.LineStatus, data TopicData) error {
+	if c.elapsedInterval <= 0 || event.ID == "" {
+		return nil
+	}
+
+	ticker, running := c.elapsedTickers[event.ID]
+	talking := status.Status == types.CallStatusTalking && event.Type != types.CallTypeDisconnect
+	switch {
+	case talking && !running:
+		ticker = &elapsedTicker{
+			message: ElapsedMessage{ID: event.ID, Line: event.Line, Trunk: event.Trunk, Since: c.clock.Now(), Running: true},
+			data:    data,
+		}
+		c.elapsedTickers[event.ID] = ticker
+		c.scheduleElapsed(event.ID, ticker)
+		return c.publishElapsed(ctx, ticker)
+	case !talking && running:
+		ticker.timer.Stop()
+		delete(c.elapsedTickers, event.ID)
+		ticker.message.Running = false
+		return c.publishElapsed(ctx, ticker)
+	}
+	return nil
+}
+
+// scheduleElapsed publishes the elapsed time after the interval and schedules
+// the next publish, until the ticker is stopped. c.mu must be held.
+func (c *Client) scheduleElapsed(id string, ticker *elapsedTicker) {
+	ticker.timer = c.clock.AfterFunc(c.elapsedInterval, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if c.elapsedTickers[id] != ticker {
+			return
+		}
+		if c.connected {
+			// The ticker has no context of its own, the publish timeout still applies
+			if err := c.publishElapsed(context.Background(), ticker); err != nil {
+				log.Printf("Failed to publish elapsed time of call %s: %v", id, err)
+			}
+		}
+		c.scheduleElapsed(id, ticker)
+	})
+}
+
+// stopElapsed stops all elapsed tickers. c.mu must be held.
+func (c *Client) stopElapsed() {
+	for id, ticker := range c.elapsedTickers {
+		ticker.timer.Stop()
+		delete(c.elapsedTickers, id)
+	}
+}
+
+// publishElapsed publishes the time since the CONNECT of the call. c.mu must be held.
+func (c *Client) publishElapsed(ctx context.Context, ticker *elapsedTicker) error {
+	if c.muted("line_elapsed", ticker.message.ID) {
+		return nil
+	}
+	now := c.clock.Now()
+	elapsed := now.Sub(ticker.message.Since).Round(time.Second)
+	ticker.message.Elapsed = int(elapsed.Seconds())
+	ticker.message.Display = formatElapsed(elapsed)
+
+	topic, err := c.topic(c.topics.LineElapsed, ticker.data)
+	if err != nil {
+		return err
+	}
+	payload, err := c.encode("line_elapsed", codec.Message{Kind: "call.elapsed", Subject: ticker.message.ID, Time: now, Value: ticker.message})
+	if err != nil {
+		return err
+	}
+	return c.publishWithRetain(ctx, topic, payload, false)
+}
+
+// formatElapsed formats a duration as mm:ss, from one hour on as h:mm:ss
+func formatElapsed(d time.Duration) string {
+	seconds := int(d.Seconds())
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
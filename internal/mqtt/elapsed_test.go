@@ -0,0 +1,109 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/broker"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+func TestFormatElapsed(t *testing.T) {
+	tests := []struct {
+		elapsed  time.Duration
+		expected string
+	}{
+		{0, "00:00"},
+		{15 * time.Second, "00:15"},
+		{12*time.Minute + 5*time.Second, "12:05"},
+		{time.Hour + 2*time.Minute + 3*time.Second, "1:02:03"},
+	}
+
+	for _, tt := range tests {
+		if got := formatElapsed(tt.elapsed); got != tt.expected {
+			t.Errorf("formatElapsed(%v): expected %s, got %s", tt.elapsed, tt.expected, got)
+		}
+	}
+}
+
+func TestElapsedTicker(t *testing.T) {
+	b, host, port := startTestBroker(t)
+
+	messages := make(chan ElapsedMessage, 10)
+	err := b.Subscribe("test/line/+/elapsed", func(msg broker.Message) {
+		var message ElapsedMessage
+		if err := json.Unmarshal(msg.Payload, &message); err != nil {
+			t.Errorf("Invalid elapsed payload: %v", err)
+			return
+		}
+		messages <- message
+	})
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	// nextMessage waits for the next published elapsed time
+	nextMessage := func() ElapsedMessage {
+		t.Helper()
+		select {
+		case message := <-messages:
+			return message
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for elapsed time")
+			return ElapsedMessage{}
+		}
+	}
+
+	clk := clock.NewFake(time.Date(2025, 9, 22, 8, 0, 0, 0, time.UTC))
+	client := newTestClient(t, host, port, Options{
+		QoS:             1,
+		Clock:           clk,
+		ElapsedInterval: 15 * time.Second,
+	})
+
+	ring := types.CallEvent{
+		ID: "elapsed-1", Timestamp: clk.Now(), Type: types.CallTypeRing, Direction: types.CallDirectionInbound,
+		Line: 2, Trunk: "SIP0", Caller: "+4930123456", Called: "+4930990133", Status: types.CallStatusRinging,
+	}
+	connect := ring
+	connect.Type = types.CallTypeConnect
+	connect.Status = types.CallStatusTalking
+	disconnect := ring
+	disconnect.Type = types.CallTypeDisconnect
+	disconnect.Status = types.CallStatusFinished
+
+	for _, event := range []types.CallEvent{ring, connect} {
+		if err := client.PublishCallEvent(context.Background(), event); err != nil {
+			t.Fatalf("PublishCallEvent failed: %v", err)
+		}
+	}
+	message := nextMessage()
+	if message.ID != "elapsed-1" || message.Line != 2 || message.Elapsed != 0 || !message.Running {
+		t.Errorf("Expected a running ticker from 0 on CONNECT, got %+v", message)
+	}
+
+	clk.Advance(15 * time.Second)
+	message = nextMessage()
+	if message.Elapsed != 15 || message.Display != "00:15" || !message.Running {
+		t.Errorf("Expected 15 seconds after one interval, got %+v", message)
+	}
+
+	clk.Advance(5 * time.Second)
+	if err := client.PublishCallEvent(context.Background(), disconnect); err != nil {
+		t.Fatalf("PublishCallEvent failed: %v", err)
+	}
+	message = nextMessage()
+	if message.Elapsed != 20 || message.Running {
+		t.Errorf("Expected a last message after 20 seconds on DISCONNECT, got %+v", message)
+	}
+
+	clk.Advance(time.Minute)
+	select {
+	case message := <-messages:
+		t.Errorf("Elapsed time published after DISCONNECT: %+v", message)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,99 @@
+package mqtt
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/codec"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/seal"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// eventTopics are the topics of event streams, which carry CloudEvents
+// envelopes when Options.CloudEventsSource is set
+var eventTopics = map[string]bool{
+	"line_last_event":   true,
+	"ringing":           true,
+	"vip_ring":          true,
+	"call_completed":    true,
+	"missed_call":       true,
+	"fsm_status_change": true,
+	"notification":      true,
+	"error":             true,
+	"unparsed":          true,
+	"incident":          true,
+}
+
+// plainTopics are never encrypted: they carry no call data, and monitoring
+// like the availability of Home Assistant entities needs to read them
+var plainTopics = map[string]bool{
+	"status":          true,
+	"fritzbox_status": true,
+	"description":     true,
+}
+
+// ParsePayloadFormats parses per-topic payload formats like "history=msgpack"
+// or "ringing=template:/etc/ringing.tmpl", see codec.Parse. Topics are named
+// as in the topic description; CloudEvents carry source as their source.
+func ParsePayloadFormats(entries []string, source string) (map[string]codec.Codec, error) {
+	publishing := make(map[string]bool)
+	for _, entry := range topicRegistry(&TopicTemplates{}, &Topics{}) {
+		publishing[entry.name] = entry.direction == TopicPublish
+	}
+
+	codecs := make(map[string]codec.Codec, len(entries))
+	for _, entry := range entries {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, format, ok := strings.Cut(entry, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("invalid payload format '%s', expected topic=format", entry)
+		}
+		if !publishing[name] {
+			return nil, fmt.Errorf("invalid payload format '%s': no published topic named '%s'", entry, name)
+		}
+		c, err := codec.Parse(format, source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid payload format of topic %s: %w", name, err)
+		}
+		codecs[name] = c
+	}
+	return codecs, nil
+}
+
+// resolveCodecs returns the codec of every published topic: its own format,
+// CloudEvents for event topics if a source is set, or the default format
+func resolveCodecs(format codec.Codec, formats map[string]codec.Codec, eventSource string, key *seal.Key) map[string]codec.Codec {
+	codecs := make(map[string]codec.Codec)
+	for _, entry := range topicRegistry(&TopicTemplates{}, &Topics{}) {
+		switch c, ok := formats[entry.name]; {
+		case ok:
+			codecs[entry.name] = c
+		case eventTopics[entry.name] && eventSource != "":
+			codecs[entry.name] = codec.CloudEvents{Source: eventSource}
+		default:
+			codecs[entry.name] = format
+		}
+		if key != nil && !plainTopics[entry.name] {
+			codecs[entry.name] = codec.Sealed{Codec: codecs[entry.name], Key: *key}
+		}
+	}
+	return codecs
+}
+
+// encode serializes the payload of a topic, named as in the topic registry,
+// in the format configured for it. Except for the legacy layout, JSON objects
+// carry the schema version; it is added before any encryption.
+func (c *Client) encode(name string, msg codec.Message) ([]byte, error) {
+	format := c.codecs[name]
+	if c.schemaVersion > types.SchemaVersionLegacy {
+		format = codec.Versioned{Codec: format, Version: c.schemaVersion}
+	}
+	payload, err := codec.Marshal(format, msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s payload: %w", name, err)
+	}
+	return payload, nil
+}
@@ -0,0 +1,81 @@
+package mqtt
+
+import (
+	"testing"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/codec"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/seal"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+func TestParsePayloadFormats(t *testing.T) {
+	formats, err := ParsePayloadFormats([]string{"history=msgpack", " RINGING = cloudevents", ""}, "/test")
+	if err != nil {
+		t.Fatalf("ParsePayloadFormats failed: %v", err)
+	}
+	if len(formats) != 2 || formats["history"] != codec.MessagePack || formats["ringing"] != (codec.CloudEvents{Source: "/test"}) {
+		t.Errorf("Unexpected formats %v", formats)
+	}
+
+	for _, entry := range []string{"history", "unknown=json", "dnd_command=json", "history=xml"} {
+		if _, err := ParsePayloadFormats([]string{entry}, ""); err == nil {
+			t.Errorf("Expected '%s' to be rejected", entry)
+		}
+	}
+}
+
+func TestResolveCodecs(t *testing.T) {
+	codecs := resolveCodecs(codec.MessagePack, map[string]codec.Codec{"ringing": codec.JSON}, "/test", nil)
+
+	for name, expected := range map[string]codec.Codec{
+		"status":          codec.MessagePack,
+		"history":         codec.MessagePack,
+		"ringing":         codec.JSON,
+		"line_last_event": codec.CloudEvents{Source: "/test"},
+		"notification":    codec.CloudEvents{Source: "/test"},
+	} {
+		if codecs[name] != expected {
+			t.Errorf("Expected %v for %s, got %v", expected, name, codecs[name])
+		}
+	}
+
+	// Without a source, event topics use the default format
+	if codecs := resolveCodecs(codec.JSON, nil, "", nil); codecs["line_last_event"] != codec.JSON {
+		t.Errorf("Expected JSON for line_last_event, got %v", codecs["line_last_event"])
+	}
+
+	// With a key, all payloads but status and description are encrypted
+	key := seal.Key{1}
+	codecs = resolveCodecs(codec.MessagePack, map[string]codec.Codec{"ringing": codec.JSON}, "", &key)
+	for name, expected := range map[string]codec.Codec{
+		"status":      codec.MessagePack,
+		"description": codec.MessagePack,
+		"history":     codec.Sealed{Codec: codec.MessagePack, Key: key},
+		"ringing":     codec.Sealed{Codec: codec.JSON, Key: key},
+	} {
+		if codecs[name] != expected {
+			t.Errorf("Expected %v for %s, got %v", expected, name, codecs[name])
+		}
+	}
+}
+
+func TestEncodeSchemaVersion(t *testing.T) {
+	status := types.ServiceStatus{State: "online"}
+	tests := []struct {
+		version  int
+		expected string
+	}{
+		{types.SchemaVersion, `{"schema_version":2,"state":"online","last_changed":"0001-01-01T00:00:00Z"}`},
+		{types.SchemaVersionLegacy, `{"state":"online","last_changed":"0001-01-01T00:00:00Z"}`},
+	}
+	for _, tt := range tests {
+		c := &Client{codecs: resolveCodecs(codec.JSON, nil, "", nil), schemaVersion: tt.version}
+		payload, err := c.encode("status", codec.Message{Kind: "status", Value: status})
+		if err != nil {
+			t.Fatalf("encode failed: %v", err)
+		}
+		if string(payload) != tt.expected {
+			t.Errorf("Expected %s with schema version %d, got %s", tt.expected, tt.version, payload)
+		}
+	}
+}
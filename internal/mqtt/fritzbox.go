@@ -0,0 +1,81 @@
+package mqtt
+
+import (
+	"context"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/codec"
+)
+
+// FritzBoxStatus is the retained payload of the Fritz!Box status topic. It
+// reflects the connection to the callmonitor, while the status topic reflects
+// the bridge itself.
+type FritzBoxStatus struct {
+	State       string     `json:"state"`                  // online or offline
+	Since       time.Time  `json:"since"`                  // Last change of the state
+	LastOnline  *time.Time `json:"last_online,omitempty"`  // Last connect to the callmonitor
+	LastOffline *time.Time `json:"last_offline,omitempty"` // Last time the callmonitor became unreachable
+	Reconnects  uint64     `json:"reconnects"`             // Reconnect attempts to the Fritz!Box since the start
+	Error       string     `json:"error,omitempty"`        // Why the callmonitor is unreachable
+	LastUpdated time.Time  `json:"last_updated"`
+}
+
+// PublishFritzBoxStatus publishes whether the callmonitor of the Fritz!Box is
+// connected; cause tells why it is not. The status is kept and published again
+// on connect, so it is current after the broker was unreachable.
+func (c *Client) PublishFritzBoxStatus(ctx context.Context, online bool, reconnects uint64, cause error) error {
+	c.fritzBoxMu.Lock()
+	defer c.fritzBoxMu.Unlock()
+
+	now := c.clock.Now()
+	status := c.fritzBox
+	state := "offline"
+	if online {
+		state = "online"
+	}
+	if status.State != state {
+		status.State = state
+		status.Since = now
+		if online {
+			status.LastOnline = &now
+		} else {
+			status.LastOffline = &now
+		}
+	}
+	status.Error = ""
+	if !online && cause != nil {
+		status.Error = cause.Error()
+	}
+	status.Reconnects = reconnects
+	status.LastUpdated = now
+	c.fritzBox = status
+
+	// The status is published on connect
+	if !c.IsConnected() {
+		return nil
+	}
+	return c.publishFritzBoxStatus(ctx, status)
+}
+
+// republishFritzBoxStatus publishes the kept status, if there is one yet
+func (c *Client) republishFritzBoxStatus(ctx context.Context) error {
+	c.fritzBoxMu.Lock()
+	defer c.fritzBoxMu.Unlock()
+	if c.fritzBox.State == "" {
+		return nil
+	}
+	return c.publishFritzBoxStatus(ctx, c.fritzBox)
+}
+
+// publishFritzBoxStatus publishes the status retained; c.fritzBoxMu must be held
+func (c *Client) publishFritzBoxStatus(ctx context.Context, status FritzBoxStatus) error {
+	topic, err := c.topic(c.topics.FritzBoxStatus, TopicData{})
+	if err != nil {
+		return err
+	}
+	payload, err := c.encode("fritzbox_status", codec.Message{Kind: "fritzbox.status", Time: status.LastUpdated, Value: status})
+	if err != nil {
+		return err
+	}
+	return c.publishWithRetain(ctx, topic, payload, true)
+}
@@ -0,0 +1,94 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/broker"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+)
+
+func TestPublishFritzBoxStatus(t *testing.T) {
+	b, host, port := startTestBroker(t)
+
+	statuses := make(chan FritzBoxStatus, 10)
+	err := b.Subscribe("test/fritzbox/status", func(msg broker.Message) {
+		if !msg.Retained {
+			t.Errorf("Expected the Fritz!Box status to be retained")
+		}
+		var status FritzBoxStatus
+		if err := json.Unmarshal(msg.Payload, &status); err != nil {
+			t.Errorf("Invalid Fritz!Box status payload: %v", err)
+			return
+		}
+		statuses <- status
+	})
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	// nextStatus waits for the next published Fritz!Box status
+	nextStatus := func() FritzBoxStatus {
+		t.Helper()
+		select {
+		case status := <-statuses:
+			return status
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for Fritz!Box status")
+			return FritzBoxStatus{}
+		}
+	}
+
+	start := time.Date(2025, 9, 22, 8, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	client := NewClient(Options{
+		Broker:         host,
+		Port:           port,
+		ClientID:       "integration-test",
+		TopicPrefix:    "test",
+		ConnectTimeout: 5 * time.Second,
+		Clock:          fake,
+	})
+	t.Cleanup(func() { _ = client.Disconnect() })
+
+	// The first connect to the Fritz!Box fails before the broker is connected
+	if err := client.PublishFritzBoxStatus(context.Background(), false, 0, errors.New("connection refused")); err != nil {
+		t.Fatalf("PublishFritzBoxStatus failed: %v", err)
+	}
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	status := nextStatus()
+	if status.State != "offline" || status.Error != "connection refused" || !status.Since.Equal(start) {
+		t.Errorf("Expected offline since the failed connect, got %+v", status)
+	}
+
+	fake.Advance(time.Minute)
+	if err := client.PublishFritzBoxStatus(context.Background(), true, 3, nil); err != nil {
+		t.Fatalf("PublishFritzBoxStatus failed: %v", err)
+	}
+	status = nextStatus()
+	if status.State != "online" || status.Error != "" || status.Reconnects != 3 {
+		t.Errorf("Expected online after 3 reconnects, got %+v", status)
+	}
+	if !status.Since.Equal(start.Add(time.Minute)) || status.LastOffline == nil || !status.LastOffline.Equal(start) {
+		t.Errorf("Expected online since the connect and offline before, got %+v", status)
+	}
+
+	// Repeated failures keep the time the Fritz!Box became unreachable
+	fake.Advance(time.Minute)
+	_ = client.PublishFritzBoxStatus(context.Background(), false, 3, errors.New("i/o timeout"))
+	fake.Advance(time.Minute)
+	_ = client.PublishFritzBoxStatus(context.Background(), false, 4, errors.New("i/o timeout"))
+	nextStatus()
+	status = nextStatus()
+	if status.State != "offline" || status.Reconnects != 4 || !status.Since.Equal(start.Add(2*time.Minute)) {
+		t.Errorf("Expected offline since the first failure, got %+v", status)
+	}
+	if status.LastOnline == nil || !status.LastOnline.Equal(start.Add(time.Minute)) {
+		t.Errorf("Expected the last connect to be kept, got %+v", status.LastOnline)
+	}
+}
@@ -0,0 +1,876 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/broker"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/backoff"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/cloudevents"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// startTestBroker starts an embedded broker that is closed when the test ends
+func startTestBroker(t *testing.T) (*broker.Broker, string, int) {
+	t.Helper()
+
+	b, err := broker.New()
+	if err != nil {
+		t.Fatalf("Failed to create broker: %v", err)
+	}
+	host, port, err := b.Start()
+	if err != nil {
+		t.Fatalf("Failed to start broker: %v", err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+	return b, host, port
+}
+
+// newTestClient connects a client with the test topic prefix to the broker and
+// disconnects it when the test ends
+func newTestClient(t *testing.T, host string, port int, opts Options) *Client {
+	t.Helper()
+
+	opts.Broker = host
+	opts.Port = port
+	opts.ClientID = "integration-test"
+	opts.TopicPrefix = "test"
+	opts.ConnectTimeout = 5 * time.Second
+	client := NewClient(opts)
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Disconnect() })
+	return client
+}
+
+func TestPublishCallEventToBroker(t *testing.T) {
+	b, host, port := startTestBroker(t)
+
+	received := make(chan broker.Message, 10)
+	if err := b.Subscribe("test/#", func(msg broker.Message) { received <- msg }); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	client := newTestClient(t, host, port, Options{
+		QoS:    1,
+		Retain: true,
+	})
+
+	event := types.CallEvent{
+		ID:        "0199a8c4-0000-7000-8000-000000000001",
+		Timestamp: time.Now(),
+		Type:      types.CallTypeRing,
+		Direction: types.CallDirectionInbound,
+		Line:      2,
+		Trunk:     "SIP0",
+		Caller:    "+4930123456",
+		Called:    "+4930990133",
+		Status:    types.CallStatusRinging,
+	}
+	if err := client.PublishCallEvent(context.Background(), event); err != nil {
+		t.Fatalf("PublishCallEvent failed: %v", err)
+	}
+
+	expected := map[string]bool{
+		"test/status":            false,
+		"test/line/2/status":     false,
+		"test/line/2/last_event": false,
+		"test/call/" + event.ID:  false,
+	}
+
+	timeout := time.After(5 * time.Second)
+	for missing := len(expected); missing > 0; {
+		select {
+		case msg := <-received:
+			if seen, ok := expected[msg.Topic]; ok && !seen {
+				expected[msg.Topic] = true
+				missing--
+			}
+			if msg.Topic == "test/line/2/status" {
+				var status types.LineStatus
+				if err := json.Unmarshal(msg.Payload, &status); err != nil {
+					t.Fatalf("Invalid line status payload: %v", err)
+				}
+				if status.Status != types.CallStatusRinging {
+					t.Errorf("Expected ringing line status, got %s", status.Status)
+				}
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for topics: %v", expected)
+		}
+	}
+}
+
+func TestPublishRingingToBroker(t *testing.T) {
+	b, host, port := startTestBroker(t)
+
+	received := make(chan broker.Message, 10)
+	if err := b.Subscribe("test/line/+/ringing", func(msg broker.Message) { received <- msg }); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	unconnected := NewClient(Options{TopicPrefix: "test"})
+	if err := unconnected.PublishRinging(types.CallEvent{ID: "ring-0", Line: 3}); err == nil {
+		t.Error("Expected an error before connecting")
+	}
+
+	client := newTestClient(t, host, port, Options{QoS: 1, Retain: true})
+
+	event := types.CallEvent{
+		ID: "ring-1", Timestamp: time.Now(), Type: types.CallTypeRing, Line: 3, Trunk: "SIP0",
+		Caller: "+4930123456", Called: "+4930990133",
+	}
+	if err := client.PublishRinging(event); err != nil {
+		t.Fatalf("PublishRinging failed: %v", err)
+	}
+
+	select {
+	case msg := <-received:
+		var ringing RingingMessage
+		if err := json.Unmarshal(msg.Payload, &ringing); err != nil {
+			t.Fatalf("Invalid ringing payload: %v", err)
+		}
+		if msg.Topic != "test/line/3/ringing" || ringing.ID != "ring-1" || ringing.Caller != "+4930123456" {
+			t.Errorf("Unexpected ringing message on %s: %+v", msg.Topic, ringing)
+		}
+		if msg.Retained {
+			t.Error("Expected the ringing message not to be retained")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for ringing message")
+	}
+}
+
+func TestPublishVIPRingToBroker(t *testing.T) {
+	b, host, port := startTestBroker(t)
+
+	received := make(chan broker.Message, 10)
+	if err := b.Subscribe("test/vip_ring", func(msg broker.Message) { received <- msg }); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	client := newTestClient(t, host, port, Options{QoS: 1})
+
+	// Only the RING of a VIP reaches the VIP ring topic
+	for _, event := range []types.CallEvent{
+		{ID: "ring-1", Timestamp: time.Now(), Type: types.CallTypeRing, Line: 1, Caller: "+4930111111"},
+		{ID: "ring-2", Timestamp: time.Now(), Type: types.CallTypeRing, Line: 2, Caller: "+4930123456", Priority: true},
+	} {
+		if err := client.PublishRinging(event); err != nil {
+			t.Fatalf("PublishRinging failed: %v", err)
+		}
+	}
+
+	select {
+	case msg := <-received:
+		var ringing RingingMessage
+		if err := json.Unmarshal(msg.Payload, &ringing); err != nil {
+			t.Fatalf("Invalid VIP ring payload: %v", err)
+		}
+		if ringing.ID != "ring-2" || !ringing.Priority || ringing.Caller != "+4930123456" {
+			t.Errorf("Unexpected VIP ring message %+v", ringing)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for VIP ring message")
+	}
+	select {
+	case msg := <-received:
+		t.Errorf("Unexpected second VIP ring message %s", msg.Payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestPublishMetricsToBroker(t *testing.T) {
+	b, host, port := startTestBroker(t)
+
+	received := make(chan broker.Message, 10)
+	if err := b.Subscribe("test/metrics", func(msg broker.Message) { received <- msg }); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	client := newTestClient(t, host, port, Options{QoS: 1})
+	if err := client.PublishMetrics(context.Background(), map[string]any{"mqtt_publish": client.PublishStats()}); err != nil {
+		t.Fatalf("PublishMetrics failed: %v", err)
+	}
+
+	select {
+	case msg := <-received:
+		var metrics struct {
+			SchemaVersion int           `json:"schema_version"`
+			MQTTPublish   *PublishStats `json:"mqtt_publish"`
+		}
+		if err := json.Unmarshal(msg.Payload, &metrics); err != nil {
+			t.Fatalf("Invalid metrics payload: %v", err)
+		}
+		if metrics.MQTTPublish == nil || metrics.SchemaVersion != types.SchemaVersion {
+			t.Errorf("Expected the versioned publish stats, got %s", msg.Payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for metrics message")
+	}
+}
+
+func TestPublishCloudEventsToBroker(t *testing.T) {
+	b, host, port := startTestBroker(t)
+
+	received := make(chan broker.Message, 10)
+	if err := b.Subscribe("test/line/+/+", func(msg broker.Message) { received <- msg }); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	client := newTestClient(t, host, port, Options{QoS: 1, Retain: true, CloudEventsSource: "/test"})
+
+	event := types.CallEvent{
+		ID: "call-1", Timestamp: time.Now(), Type: types.CallTypeRing, Direction: types.CallDirectionInbound,
+		Line: 1, Trunk: "SIP0", Caller: "+4930123456", Status: types.CallStatusRinging,
+	}
+	if err := client.PublishCallEvent(context.Background(), event); err != nil {
+		t.Fatalf("PublishCallEvent failed: %v", err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for lastEvent, status := false, false; !lastEvent || !status; {
+		select {
+		case msg := <-received:
+			var envelope cloudevents.Event
+			err := json.Unmarshal(msg.Payload, &envelope)
+			switch msg.Topic {
+			case "test/line/1/last_event":
+				lastEvent = true
+				if err != nil || envelope.Type != cloudevents.Type("call.ring") || envelope.Source != "/test" || envelope.Subject != "call-1" {
+					t.Errorf("Expected a CloudEvent of the ring, got %s", msg.Payload)
+				}
+				var data types.CallEvent
+				if err := json.Unmarshal(envelope.Data, &data); err != nil || data.ID != "call-1" {
+					t.Errorf("Expected the call event as data, got %s", envelope.Data)
+				}
+			case "test/line/1/status":
+				// State topics are not wrapped
+				status = true
+				if envelope.SpecVersion != "" {
+					t.Errorf("Expected a plain line status, got %s", msg.Payload)
+				}
+			}
+		case <-timeout:
+			t.Fatal("Timed out waiting for the last event and the line status")
+		}
+	}
+}
+
+func TestPublishMissedCallToBroker(t *testing.T) {
+	b, host, port := startTestBroker(t)
+
+	received := make(chan broker.Message, 10)
+	err := b.Subscribe("test/+", func(msg broker.Message) {
+		if msg.Topic == "test/missed_call" || msg.Topic == "test/missed_calls" {
+			received <- msg
+		}
+	})
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	client := newTestClient(t, host, port, Options{
+		QoS:    1,
+		Retain: true,
+	})
+
+	ringStart := time.Now().Add(-12 * time.Second)
+	ring := types.CallEvent{
+		ID: "missed-1", Timestamp: ringStart, Type: types.CallTypeRing, Line: 0, Trunk: "SIP0",
+		Caller: "+4930123456", Called: "+4930990133", Status: types.CallStatusRinging,
+	}
+	disconnect := ring
+	disconnect.Type = types.CallTypeDisconnect
+	disconnect.Timestamp = ringStart.Add(12 * time.Second)
+	disconnect.Status = types.CallStatusMissedCall
+
+	for _, event := range []types.CallEvent{ring, disconnect} {
+		if err := client.PublishCallEvent(context.Background(), event); err != nil {
+			t.Fatalf("PublishCallEvent failed: %v", err)
+		}
+	}
+
+	var single types.MissedCall
+	var list types.MissedCallList
+	for seen := 0; seen < 2; seen++ {
+		select {
+		case msg := <-received:
+			switch msg.Topic {
+			case "test/missed_call":
+				if err := json.Unmarshal(msg.Payload, &single); err != nil {
+					t.Fatalf("Invalid missed call payload: %v", err)
+				}
+			case "test/missed_calls":
+				if err := json.Unmarshal(msg.Payload, &list); err != nil {
+					t.Fatalf("Invalid missed calls payload: %v", err)
+				}
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for missed call topics")
+		}
+	}
+
+	if single.ID != "missed-1" || single.RingDuration != 12 || single.RingCount != 3 {
+		t.Errorf("Unexpected missed call: %+v", single)
+	}
+	if single.Caller.PhoneNumber != "+4930123456" {
+		t.Errorf("Expected caller number, got %q", single.Caller.PhoneNumber)
+	}
+	if len(list.Calls) != 1 || list.Today != 1 {
+		t.Errorf("Expected one missed call today, got %d calls and today=%d", len(list.Calls), list.Today)
+	}
+}
+
+func TestPublishTopicsSwitchedOff(t *testing.T) {
+	b, host, port := startTestBroker(t)
+
+	received := make(chan string, 20)
+	err := b.Subscribe("test/#", func(msg broker.Message) {
+		switch msg.Topic {
+		case "test/status", "test/$topics":
+		default:
+			received <- msg.Topic
+		}
+	})
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	// Only the missed calls are wanted
+	off := false
+	client := newTestClient(t, host, port, Options{
+		QoS:           1,
+		Retain:        true,
+		PublishTopics: TopicEnabled{LineStatus: &off, LineLastEvent: &off, Call: &off, History: &off, Summary: &off},
+	})
+
+	ring := types.CallEvent{
+		ID: "switched-1", Timestamp: time.Now(), Type: types.CallTypeRing, Line: 0, Trunk: "SIP0",
+		Caller: "+4930123456", Called: "+4930990133", Status: types.CallStatusRinging,
+	}
+	disconnect := ring
+	disconnect.Type = types.CallTypeDisconnect
+	disconnect.Status = types.CallStatusMissedCall
+
+	for _, event := range []types.CallEvent{ring, disconnect} {
+		if err := client.PublishCallEvent(context.Background(), event); err != nil {
+			t.Fatalf("PublishCallEvent failed: %v", err)
+		}
+	}
+
+	topics := make(map[string]bool)
+	timeout := time.After(5 * time.Second)
+	for len(topics) < 2 {
+		select {
+		case topic := <-received:
+			topics[topic] = true
+		case <-timeout:
+			t.Fatalf("Timed out waiting for missed call topics, got %v", topics)
+		}
+	}
+	select {
+	case topic := <-received:
+		topics[topic] = true
+	case <-time.After(100 * time.Millisecond):
+	}
+	if len(topics) != 2 || !topics["test/missed_call"] || !topics["test/missed_calls"] {
+		t.Errorf("Expected only the missed call topics, got %v", topics)
+	}
+}
+
+func TestCallTopicExpiry(t *testing.T) {
+	b, host, port := startTestBroker(t)
+
+	received := make(chan broker.Message, 10)
+	if err := b.Subscribe("test/call/+", func(msg broker.Message) { received <- msg }); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	clk := clock.NewFake(time.Date(2025, 9, 21, 15, 35, 0, 0, time.UTC))
+	client := newTestClient(t, host, port, Options{
+		QoS:          1,
+		Retain:       true,
+		Clock:        clk,
+		CallTopicTTL: time.Hour,
+	})
+
+	call := types.CallEvent{
+		ID: "expiring-1", Timestamp: clk.Now(), Type: types.CallTypeCall, Line: 1, Trunk: "SIP0",
+		Caller: "+4930990133", Called: "+4930123456", Status: types.CallStatusCalling,
+	}
+	disconnect := call
+	disconnect.Type = types.CallTypeDisconnect
+	disconnect.Status = types.CallStatusNotReached
+
+	// nextPayload waits for the next message on the call topic
+	nextPayload := func() []byte {
+		t.Helper()
+		select {
+		case msg := <-received:
+			if msg.Topic != "test/call/expiring-1" {
+				t.Fatalf("Unexpected topic %s", msg.Topic)
+			}
+			return msg.Payload
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for call topic")
+			return nil
+		}
+	}
+
+	for _, event := range []types.CallEvent{call, disconnect} {
+		if err := client.PublishCallEvent(context.Background(), event); err != nil {
+			t.Fatalf("PublishCallEvent failed: %v", err)
+		}
+		if payload := nextPayload(); len(payload) == 0 {
+			t.Fatal("Expected call status payload")
+		}
+	}
+
+	clk.Advance(59 * time.Minute)
+	select {
+	case msg := <-received:
+		t.Fatalf("Call topic removed before the TTL elapsed: %+v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	clk.Advance(time.Minute)
+	if payload := nextPayload(); len(payload) != 0 {
+		t.Errorf("Expected empty retained message to remove the call topic, got %s", payload)
+	}
+}
+
+func TestParallelCallsOnSameLine(t *testing.T) {
+	b, host, port := startTestBroker(t)
+
+	received := make(chan broker.Message, 10)
+	if err := b.Subscribe("test/call/+", func(msg broker.Message) { received <- msg }); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	client := newTestClient(t, host, port, Options{
+		QoS:    1,
+		Retain: true,
+	})
+
+	// A waiting call rings on line 0 while the first call is talking
+	first := types.CallEvent{
+		ID: "first", Timestamp: time.Now(), Type: types.CallTypeConnect, Direction: types.CallDirectionInbound,
+		Line: 0, Trunk: "SIP0", Caller: "+4930123456", Called: "+4930990133", Status: types.CallStatusTalking,
+	}
+	second := types.CallEvent{
+		ID: "second", Timestamp: time.Now(), Type: types.CallTypeRing, Direction: types.CallDirectionInbound,
+		Line: 0, Trunk: "SIP0", Caller: "+4940654321", Called: "+4930990133", Status: types.CallStatusRinging,
+	}
+
+	expected := map[string]struct {
+		caller string
+		status types.CallStatus
+	}{
+		"test/call/first":  {"+4930123456", types.CallStatusTalking},
+		"test/call/second": {"+4940654321", types.CallStatusRinging},
+	}
+	for _, event := range []types.CallEvent{first, second} {
+		if err := client.PublishCallEvent(context.Background(), event); err != nil {
+			t.Fatalf("PublishCallEvent failed: %v", err)
+		}
+
+		select {
+		case msg := <-received:
+			var status types.LineStatus
+			if err := json.Unmarshal(msg.Payload, &status); err != nil {
+				t.Fatalf("Invalid call status payload: %v", err)
+			}
+			want, ok := expected[msg.Topic]
+			if !ok {
+				t.Fatalf("Unexpected topic %s", msg.Topic)
+			}
+			if status.ID != event.ID || status.Caller.PhoneNumber != want.caller || status.Status != want.status {
+				t.Errorf("%s: expected %s from %s, got %+v", msg.Topic, want.status, want.caller, status)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for call topic")
+		}
+	}
+}
+
+func TestUpdateCredentials(t *testing.T) {
+	b, host, port := startTestBroker(t)
+	b.SetCredentials("bridge", "token-1")
+
+	client := newTestClient(t, host, port, Options{
+		Username: "bridge",
+		Password: "token-1",
+		QoS:      1,
+	})
+
+	event := types.CallEvent{
+		ID: "rotation-1", Timestamp: time.Now(), Type: types.CallTypeRing, Line: 0, Trunk: "SIP0",
+		Caller: "+4930123456", Called: "+4930990133", Status: types.CallStatusRinging,
+	}
+
+	b.SetCredentials("bridge", "token-2")
+	if err := client.UpdateCredentials(context.Background(), "bridge", "wrong"); err == nil {
+		t.Fatal("Expected reconnect with rejected credentials to fail")
+	}
+	if client.IsConnected() {
+		t.Error("Expected client to be disconnected after rejected credentials")
+	}
+
+	if err := client.UpdateCredentials(context.Background(), "bridge", "token-2"); err != nil {
+		t.Fatalf("UpdateCredentials failed: %v", err)
+	}
+	if err := client.PublishCallEvent(context.Background(), event); err != nil {
+		t.Errorf("PublishCallEvent after rotation failed: %v", err)
+	}
+
+	if err := client.UpdateCredentials(context.Background(), "bridge", "token-2"); err != nil {
+		t.Errorf("Expected unchanged credentials to be a no-op, got %v", err)
+	}
+}
+
+func TestReconnectReplaysOutbox(t *testing.T) {
+	b, host, port := startTestBroker(t)
+
+	received := make(chan broker.Message, 10)
+	if err := b.Subscribe("test/call/+", func(msg broker.Message) { received <- msg }); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	client := newTestClient(t, host, port, Options{QoS: 1, Retain: true})
+
+	// waitConnected waits until the client reports the given connection state
+	waitConnected := func(want bool) {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for client.IsConnected() != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("Timed out waiting for connected=%v", want)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// Reject reconnects until the event is in the outbox
+	b.SetCredentials("bridge", "token")
+	b.DropClients()
+	waitConnected(false)
+
+	event := types.CallEvent{
+		ID: "outbox-1", Timestamp: time.Now(), Type: types.CallTypeRing, Line: 0, Trunk: "SIP0",
+		Caller: "+4930123456", Called: "+4930990133", Status: types.CallStatusRinging,
+	}
+	if err := client.PublishCallEvent(context.Background(), event); err != nil {
+		t.Fatalf("Expected the event to wait in the outbox, got %v", err)
+	}
+
+	b.SetCredentials("", "")
+	waitConnected(true)
+	select {
+	case msg := <-received:
+		if msg.Topic != "test/call/outbox-1" {
+			t.Errorf("Unexpected topic %s", msg.Topic)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the event from the outbox")
+	}
+	if client.Reconnects() == 0 {
+		t.Error("Expected the reconnect attempts to be counted")
+	}
+}
+
+func TestReconnectGivesUp(t *testing.T) {
+	b, host, port := startTestBroker(t)
+
+	client := newTestClient(t, host, port, Options{QoS: 1, Reconnect: backoff.Policy{Initial: 10 * time.Millisecond, Max: 10 * time.Millisecond, MaxAttempts: 2}})
+
+	// Every reconnect is rejected
+	b.SetCredentials("bridge", "token")
+	b.DropClients()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for client.IsConnected() {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the connection to drop")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Events wait in the outbox until the client gives up
+	event := types.CallEvent{ID: "lost", Timestamp: time.Now(), Type: types.CallTypeRing, Trunk: "SIP0", Status: types.CallStatusRinging}
+	for client.PublishCallEvent(context.Background(), event) == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the client to give up reconnecting")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if client.Reconnects() != 2 {
+		t.Errorf("Expected 2 reconnect attempts, got %d", client.Reconnects())
+	}
+}
+
+func TestRetainedCallTopicsOfEarlierRunExpire(t *testing.T) {
+	b, host, port := startTestBroker(t)
+
+	// Call topics left on the broker by an earlier run
+	clk := clock.NewFake(time.Date(2025, 9, 21, 15, 35, 0, 0, time.UTC))
+	for topic, status := range map[string]types.LineStatus{
+		"test/call/recent":  {ID: "recent", LastUpdated: clk.Now().Add(-30 * time.Minute)},
+		"test/call/expired": {ID: "expired", LastUpdated: clk.Now().Add(-2 * time.Hour)},
+		"test/call/foreign": {ID: "other", LastUpdated: clk.Now().Add(-2 * time.Hour)},
+	} {
+		payload, err := json.Marshal(status)
+		if err != nil {
+			t.Fatalf("Failed to marshal status: %v", err)
+		}
+		if err := b.Publish(topic, payload, true); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+
+	removed := make(chan string, 10)
+	if err := b.Subscribe("test/call/+", func(msg broker.Message) {
+		if len(msg.Payload) == 0 {
+			removed <- msg.Topic
+		}
+	}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	newTestClient(t, host, port, Options{
+		QoS:          1,
+		Retain:       true,
+		Clock:        clk,
+		CallTopicTTL: time.Hour,
+	})
+
+	// nextRemoval waits for the next removed call topic
+	nextRemoval := func() string {
+		t.Helper()
+		select {
+		case topic := <-removed:
+			return topic
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for call topic removal")
+			return ""
+		}
+	}
+
+	clk.BlockUntil(2)
+	clk.Advance(0)
+	if topic := nextRemoval(); topic != "test/call/expired" {
+		t.Errorf("Expected the expired call topic to be removed first, got %s", topic)
+	}
+
+	clk.Advance(30 * time.Minute)
+	if topic := nextRemoval(); topic != "test/call/recent" {
+		t.Errorf("Expected the recent call topic to be removed after its TTL, got %s", topic)
+	}
+
+	select {
+	case topic := <-removed:
+		t.Errorf("Expected foreign topic to be kept, got removal of %s", topic)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestMissedCallAcknowledgement(t *testing.T) {
+	b, host, port := startTestBroker(t)
+
+	received := make(chan broker.Message, 10)
+	if err := b.Subscribe("test/notify/+", func(msg broker.Message) { received <- msg }); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	clk := clock.NewFake(time.Date(2025, 9, 21, 15, 35, 0, 0, time.UTC))
+	client := newTestClient(t, host, port, Options{
+		QoS:                  1,
+		Clock:                clk,
+		MissedCallAckTimeout: 5 * time.Minute,
+	})
+
+	for i, id := range []string{"acked", "escalated"} {
+		ring := types.CallEvent{
+			ID: id, Timestamp: clk.Now(), Type: types.CallTypeRing, Line: i, Trunk: "SIP0",
+			Caller: "+4930123456", Called: "+4930990133", Status: types.CallStatusRinging,
+		}
+		disconnect := ring
+		disconnect.Type = types.CallTypeDisconnect
+		disconnect.Status = types.CallStatusMissedCall
+		for _, event := range []types.CallEvent{ring, disconnect} {
+			if err := client.PublishCallEvent(context.Background(), event); err != nil {
+				t.Fatalf("PublishCallEvent failed: %v", err)
+			}
+		}
+	}
+
+	if err := b.Publish("test/command/missed_call_ack", []byte(`{"id": "acked"}`), false); err != nil {
+		t.Fatalf("Failed to publish acknowledgement: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		client.mu.Lock()
+		_, pending := client.pendingAcks["acked"]
+		client.mu.Unlock()
+		if !pending {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the acknowledgement")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	clk.Advance(5 * time.Minute)
+	select {
+	case msg := <-received:
+		if msg.Topic != "test/notify/escalation" {
+			t.Fatalf("Unexpected topic %s", msg.Topic)
+		}
+		var escalation MissedCallEscalation
+		if err := json.Unmarshal(msg.Payload, &escalation); err != nil {
+			t.Fatalf("Invalid escalation payload: %v", err)
+		}
+		if escalation.Call.ID != "escalated" || escalation.Timeout != 300 {
+			t.Errorf("Expected escalation of the unacknowledged call, got %+v", escalation)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for escalation")
+	}
+	select {
+	case msg := <-received:
+		t.Errorf("Unexpected second escalation: %s", msg.Payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestReloadCommand(t *testing.T) {
+	b, host, port := startTestBroker(t)
+
+	// Retained commands are ignored, they would reload on every reconnect
+	if err := b.Publish("test/command/reload", []byte("1"), true); err != nil {
+		t.Fatalf("Failed to publish retained command: %v", err)
+	}
+
+	reloads := make(chan struct{}, 10)
+	newTestClient(t, host, port, Options{
+		QoS:      1,
+		OnReload: func(context.Context) error { reloads <- struct{}{}; return nil },
+	})
+
+	if err := b.Publish("test/command/reload", []byte("1"), false); err != nil {
+		t.Fatalf("Failed to publish command: %v", err)
+	}
+
+	select {
+	case <-reloads:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the reload")
+	}
+	select {
+	case <-reloads:
+		t.Error("Expected the retained command to be ignored")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestRestartAndPublishIncident(t *testing.T) {
+	b, host, port := startTestBroker(t)
+
+	received := make(chan broker.Message, 10)
+	if err := b.Subscribe("test/incident", func(msg broker.Message) { received <- msg }); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	client := newTestClient(t, host, port, Options{QoS: 1})
+	client.failingSince.Store(time.Now().UnixNano())
+	if err := client.Restart(context.Background()); err != nil {
+		t.Fatalf("Restart failed: %v", err)
+	}
+	if !client.IsConnected() || !client.PublishFailingSince().IsZero() {
+		t.Fatal("Expected a connected client without failed publishes after the restart")
+	}
+
+	if err := client.PublishIncident(context.Background(), map[string]string{"reason": "stalled_events"}); err != nil {
+		t.Fatalf("PublishIncident failed: %v", err)
+	}
+	select {
+	case msg := <-received:
+		var incident map[string]any
+		if err := json.Unmarshal(msg.Payload, &incident); err != nil || incident["reason"] != "stalled_events" {
+			t.Errorf("Unexpected incident payload %s (%v)", msg.Payload, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the incident")
+	}
+}
+
+func TestCheckRetainedDetectsAndRepairsDrift(t *testing.T) {
+	b, host, port := startTestBroker(t)
+	client := newTestClient(t, host, port, Options{
+		QoS:            1,
+		Retain:         true,
+		RetainedSettle: 100 * time.Millisecond,
+	})
+
+	event := types.CallEvent{
+		ID:        "0199a8c4-0000-7000-8000-000000000001",
+		Timestamp: time.Now(),
+		Type:      types.CallTypeRing,
+		Direction: types.CallDirectionInbound,
+		Line:      2,
+		Caller:    "+4930123456",
+		Called:    "+4930990133",
+		Status:    types.CallStatusRinging,
+	}
+	if err := client.PublishCallEvent(context.Background(), event); err != nil {
+		t.Fatalf("PublishCallEvent failed: %v", err)
+	}
+
+	drift, err := client.CheckRetained(context.Background(), false)
+	if err != nil {
+		t.Fatalf("CheckRetained failed: %v", err)
+	}
+	if drift.Drifted() || drift.Checked == 0 || drift.Actual != drift.Expected {
+		t.Fatalf("Expected no drift after publishing, got %+v", drift)
+	}
+
+	// Another client overwrites the line status and clears the status topic
+	if err := b.Publish("test/line/2/status", []byte(`{"status":"idle"}`), true); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if err := b.Publish("test/status", nil, true); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	drift, err = client.CheckRetained(context.Background(), true)
+	if err != nil {
+		t.Fatalf("CheckRetained failed: %v", err)
+	}
+	if len(drift.Changed) != 1 || drift.Changed[0] != "test/line/2/status" {
+		t.Errorf("Expected the overwritten line status, got %v", drift.Changed)
+	}
+	if len(drift.Missing) != 1 || drift.Missing[0] != "test/status" {
+		t.Errorf("Expected the cleared status topic, got %v", drift.Missing)
+	}
+	if drift.Repaired != 2 {
+		t.Errorf("Expected 2 repaired topics, got %d", drift.Repaired)
+	}
+
+	drift, err = client.CheckRetained(context.Background(), false)
+	if err != nil {
+		t.Fatalf("CheckRetained failed: %v", err)
+	}
+	if drift.Drifted() {
+		t.Errorf("Expected no drift after the repair, got %+v", drift)
+	}
+
+	stats := client.RetainedStats()
+	if stats.Checks != 3 || stats.Drifted != 2 || stats.Repaired != 2 || stats.Checksum != drift.Expected || stats.LastCheck == nil {
+		t.Errorf("Unexpected retained stats %+v", stats)
+	}
+}
@@ -0,0 +1,77 @@
+package mqtt
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// persistTimeout bounds a single save of the persister
+const persistTimeout = 5 * time.Second
+
+// persister saves state changes in the background, so publishing never waits
+// for the store. Only the latest change of a key is kept until it is saved;
+// keys are saved in the order they first changed.
+type persister struct {
+	mu      sync.Mutex
+	order   []string
+	pending map[string]func(ctx context.Context) error
+	idle    chan struct{} // Closed when no save is running
+}
+
+// newPersister creates an idle persister
+func newPersister() *persister {
+	idle := make(chan struct{})
+	close(idle)
+	return &persister{pending: make(map[string]func(ctx context.Context) error), idle: idle}
+}
+
+// set schedules save for key, replacing a change of the key that was not saved yet
+func (p *persister) set(key string, save func(ctx context.Context) error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, queued := p.pending[key]; !queued {
+		p.order = append(p.order, key)
+	}
+	p.pending[key] = save
+
+	select {
+	case <-p.idle:
+		p.idle = make(chan struct{})
+		go p.run(p.idle)
+	default:
+	}
+}
+
+// run saves the pending changes until none are left
+func (p *persister) run(idle chan struct{}) {
+	for {
+		p.mu.Lock()
+		if len(p.order) == 0 {
+			close(idle)
+			p.mu.Unlock()
+			return
+		}
+		key := p.order[0]
+		save := p.pending[key]
+		p.order = p.order[1:]
+		delete(p.pending, key)
+		p.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), persistTimeout)
+		if err := save(ctx); err != nil {
+			log.Printf("Failed to save %s: %v", key, err)
+		}
+		cancel()
+	}
+}
+
+// wait blocks until all changes scheduled so far are saved
+func (p *persister) wait() {
+	p.mu.Lock()
+	idle := p.idle
+	p.mu.Unlock()
+	<-idle
+}
@@ -0,0 +1,317 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/codec"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/cron"
+)
+
+// DefaultProfile is active until the schedule or a command selects another
+// profile; unless configured otherwise it mutes nothing
+const DefaultProfile = "default"
+
+// What activated the current profile
+const (
+	ProfileSourceDefault  = "default"
+	ProfileSourceSchedule = "schedule"
+	ProfileSourceCommand  = "command"
+)
+
+// Profile is a named set of event topics that are not published, only
+// logged, while the profile is active, e.g. no ringing at night
+type Profile struct {
+	Name  string
+	Muted []string // Registry names of the muted topics
+}
+
+// ProfileSwitch activates a profile whenever the schedule fires
+type ProfileSwitch struct {
+	Profile  string
+	Schedule cron.Schedule
+}
+
+// ProfileState is the retained payload of the profile topic
+type ProfileState struct {
+	Profile string    `json:"profile"`
+	Muted   []string  `json:"muted"`
+	Source  string    `json:"source"` // default, schedule or command
+	Since   time.Time `json:"since"`
+}
+
+// Profiles holds the publishing profiles and the active one. It is shared by
+// the clients of all tenants, so a profile applies to all of them.
+type Profiles struct {
+	profiles map[string]Profile
+	schedule []ProfileSwitch
+	location *time.Location // Timezone of the schedule
+
+	mu         sync.Mutex
+	active     ProfileState
+	muted      map[string]bool
+	switchedAt time.Time // Last switch; scheduled switches up to then are applied
+}
+
+// ParseProfiles parses profiles like "night=ringing|vip_ring|notification"
+// and switches like "night=0 22 * * *" in the location, see package cron.
+// Only event topics can be muted, as muted states would go stale. It returns
+// nil if no profiles are configured.
+func ParseProfiles(profiles, schedule []string, location *time.Location) (*Profiles, error) {
+	if len(profiles) == 0 && len(schedule) == 0 {
+		return nil, nil
+	}
+	if location == nil {
+		location = time.Local
+	}
+
+	p := &Profiles{profiles: map[string]Profile{DefaultProfile: {Name: DefaultProfile}}, location: location}
+	configured := make(map[string]bool)
+	for _, entry := range profiles {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, list, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid profile '%s', expected name=topic|topic", entry)
+		}
+		if configured[name] {
+			return nil, fmt.Errorf("profile '%s' is configured twice", name)
+		}
+		configured[name] = true
+
+		profile := Profile{Name: name, Muted: []string{}}
+		for _, topic := range strings.Split(list, "|") {
+			topic = strings.ToLower(strings.TrimSpace(topic))
+			if topic == "" {
+				continue
+			}
+			if !mutableTopics[topic] {
+				return nil, fmt.Errorf("invalid profile '%s': '%s' is not an event topic that can be muted", name, topic)
+			}
+			profile.Muted = append(profile.Muted, topic)
+		}
+		p.profiles[name] = profile
+	}
+
+	for _, entry := range schedule {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		name, expr, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if !ok {
+			return nil, fmt.Errorf("invalid profile schedule '%s', expected profile=schedule", entry)
+		}
+		if _, exists := p.profiles[name]; !exists {
+			return nil, fmt.Errorf("profile schedule '%s' of unknown profile '%s'", entry, name)
+		}
+		s, err := cron.Parse(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule of profile '%s': %w", name, err)
+		}
+		p.schedule = append(p.schedule, ProfileSwitch{Profile: name, Schedule: s})
+	}
+
+	// The default profile does not count as a switch, the first schedule run replaces it
+	p.activate(DefaultProfile, ProfileSourceDefault, time.Now())
+	return p, nil
+}
+
+// mutableTopics are the topics a profile can mute: the event topics and the elapsed time
+var mutableTopics = func() map[string]bool {
+	topics := map[string]bool{"line_elapsed": true}
+	for name := range eventTopics {
+		topics[name] = true
+	}
+	return topics
+}()
+
+// State returns the active profile
+func (p *Profiles) State() ProfileState {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.active
+}
+
+// Muted reports whether the active profile mutes the topic, and its name
+func (p *Profiles) Muted(topic string) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.active.Profile, p.muted[topic]
+}
+
+// Schedule activates the profile of the last scheduled switch at or before
+// now, unless the active profile was selected after it. It reports whether
+// the profile was switched.
+func (p *Profiles) Schedule(now time.Time) (ProfileState, bool) {
+	var last time.Time
+	name := ""
+	for _, s := range p.schedule {
+		if fired, ok := s.Schedule.Prev(now.In(p.location)); ok && fired.After(last) {
+			last, name = fired, s.Profile
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if name == "" || !last.After(p.switchedAt) {
+		return p.active, false
+	}
+	p.activate(name, ProfileSourceSchedule, last)
+	p.switchedAt = last
+	return p.active, true
+}
+
+// Set activates a profile until the next scheduled switch
+func (p *Profiles) Set(name string, now time.Time) (ProfileState, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, exists := p.profiles[name]; !exists {
+		return p.active, fmt.Errorf("unknown profile '%s', expected one of %s", name, strings.Join(p.profileNames(), ", "))
+	}
+	p.activate(name, ProfileSourceCommand, now)
+	p.switchedAt = now
+	return p.active, nil
+}
+
+// activate makes the profile the active one; p.mu must be held unless p is not shared yet
+func (p *Profiles) activate(name, source string, since time.Time) {
+	profile := p.profiles[name]
+	muted := append([]string{}, profile.Muted...)
+	p.active = ProfileState{Profile: name, Muted: muted, Source: source, Since: since}
+	p.muted = make(map[string]bool, len(muted))
+	for _, topic := range muted {
+		p.muted[topic] = true
+	}
+}
+
+// ParseProfileCommand accepts the profile name as plain text or as JSON {"profile": "..."}
+func ParseProfileCommand(payload []byte) (string, error) {
+	text := strings.TrimSpace(string(payload))
+	if strings.HasPrefix(text, "{") {
+		var command struct {
+			Profile string `json:"profile"`
+		}
+		if err := json.Unmarshal([]byte(text), &command); err != nil {
+			return "", fmt.Errorf("invalid profile command %q: %w", text, err)
+		}
+		text = strings.TrimSpace(command.Profile)
+	}
+	if text == "" {
+		return "", fmt.Errorf("profile command without profile")
+	}
+	return text, nil
+}
+
+// muted reports whether the active profile mutes the topic and logs the
+// message held back instead of publishing it
+func (c *Client) muted(name, subject string) bool {
+	if c.profiles == nil {
+		return false
+	}
+	profile, muted := c.profiles.Muted(name)
+	if muted {
+		if subject != "" {
+			log.Printf("Profile %s: not publishing %s of %s", profile, name, subject)
+		} else {
+			log.Printf("Profile %s: not publishing %s", profile, name)
+		}
+	}
+	return muted
+}
+
+// ApplyProfileSchedule switches to the profile of the last scheduled switch
+// and publishes it. It is meant to run every minute.
+func (c *Client) ApplyProfileSchedule(ctx context.Context) error {
+	if c.profiles == nil {
+		return nil
+	}
+	state, switched := c.profiles.Schedule(c.clock.Now())
+	if !switched {
+		return nil
+	}
+	log.Printf("Switched to profile %s scheduled at %s", state.Profile, state.Since.Format(time.RFC3339))
+	return c.publishProfile(ctx, state)
+}
+
+// SetProfile activates a profile until the next scheduled switch and publishes it
+func (c *Client) SetProfile(ctx context.Context, name string) error {
+	if c.profiles == nil {
+		return fmt.Errorf("publishing profiles are not configured")
+	}
+	state, err := c.profiles.Set(name, c.clock.Now())
+	if err != nil {
+		return err
+	}
+	log.Printf("Switched to profile %s by command", state.Profile)
+	return c.publishProfile(ctx, state)
+}
+
+// publishProfile publishes the retained state of the active profile; it is published again on connect
+func (c *Client) publishProfile(ctx context.Context, state ProfileState) error {
+	if !c.profileTopics || !c.IsConnected() {
+		return nil
+	}
+	topic, err := c.topic(c.topics.Profile, TopicData{})
+	if err != nil {
+		return err
+	}
+	payload, err := c.encode("profile", codec.Message{Kind: "profile", Subject: state.Profile, Time: state.Since, Value: state})
+	if err != nil {
+		return err
+	}
+	return c.publishWithRetain(ctx, topic, payload, true)
+}
+
+// subscribeProfileCommands listens on the profile command topic; subscriptions are lost on reconnect with a clean session
+func (c *Client) subscribeProfileCommands(client mqtt.Client) error {
+	topic, err := c.topic(c.topics.ProfileCommand, TopicData{})
+	if err != nil {
+		return err
+	}
+	if err := waitToken(context.Background(), client.Subscribe(topic, c.qos, c.onProfileCommand), c.publishTimeout); err != nil {
+		return fmt.Errorf("failed to subscribe to '%s': %w", topic, err)
+	}
+	log.Printf("Listening for profile commands on topic '%s'", topic)
+	return nil
+}
+
+// onProfileCommand switches the profile outside of the paho callback, which must not block
+func (c *Client) onProfileCommand(_ mqtt.Client, msg mqtt.Message) {
+	// A retained command would switch again on every reconnect, overriding the schedule
+	if msg.Retained() {
+		log.Printf("Ignoring retained profile command on topic '%s'", msg.Topic())
+		return
+	}
+
+	name, err := ParseProfileCommand(msg.Payload())
+	if err != nil {
+		log.Printf("Ignoring profile command: %v", err)
+		return
+	}
+	go func() {
+		if err := c.SetProfile(context.Background(), name); err != nil {
+			log.Printf("Profile command failed: %v", err)
+		}
+	}()
+}
+
+// profileNames returns the names of the configured profiles, for messages
+func (p *Profiles) profileNames() []string {
+	names := make([]string, 0, len(p.profiles))
+	for name := range p.profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,169 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/broker"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+func TestParseProfiles(t *testing.T) {
+	if profiles, err := ParseProfiles(nil, nil, time.UTC); err != nil || profiles != nil {
+		t.Errorf("Expected no profiles, got %v (%v)", profiles, err)
+	}
+
+	profiles, err := ParseProfiles([]string{"night=ringing|Notification", "day="}, []string{"night=0 22 * * *", "day=0 7 * * *"}, time.UTC)
+	if err != nil {
+		t.Fatalf("ParseProfiles failed: %v", err)
+	}
+	if state := profiles.State(); state.Profile != DefaultProfile || state.Source != ProfileSourceDefault || len(state.Muted) != 0 {
+		t.Errorf("Expected the default profile until the schedule applies, got %+v", state)
+	}
+	if _, err := profiles.Set("night", time.Now()); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if _, muted := profiles.Muted("notification"); !muted {
+		t.Error("Expected the night profile to mute notifications")
+	}
+
+	invalid := []struct {
+		profiles []string
+		schedule []string
+	}{
+		{[]string{"night"}, nil},
+		{[]string{"night=ringing", "night=vip_ring"}, nil},
+		{[]string{"night=line_status"}, nil},
+		{[]string{"night=ringing"}, []string{"evening=0 18 * * *"}},
+		{[]string{"night=ringing"}, []string{"night=22:00"}},
+	}
+	for _, tt := range invalid {
+		if _, err := ParseProfiles(tt.profiles, tt.schedule, time.UTC); err == nil {
+			t.Errorf("Expected an error for %v, %v", tt.profiles, tt.schedule)
+		}
+	}
+}
+
+func TestProfilesSchedule(t *testing.T) {
+	location := time.FixedZone("CEST", 2*60*60)
+	profiles, err := ParseProfiles([]string{"night=ringing", "day="}, []string{"night=0 22 * * *", "day=0 7 * * mon-fri", "day=0 9 * * sat|sun"}, location)
+	if err != nil {
+		t.Fatalf("ParseProfiles failed: %v", err)
+	}
+
+	// Saturday 08:00 local time: the night started on Friday at 22:00
+	now := time.Date(2025, 9, 20, 6, 0, 0, 0, time.UTC)
+	state, switched := profiles.Schedule(now)
+	if !switched || state.Profile != "night" || state.Source != ProfileSourceSchedule || !state.Since.Equal(time.Date(2025, 9, 19, 22, 0, 0, 0, location)) {
+		t.Fatalf("Expected the night since Friday 22:00, got %+v (%v)", state, switched)
+	}
+	if _, switched := profiles.Schedule(now.Add(time.Minute)); switched {
+		t.Error("Expected no switch without a new scheduled switch")
+	}
+
+	// A command holds until the next scheduled switch
+	if _, err := profiles.Set("day", now.Add(2*time.Minute)); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if state, switched := profiles.Schedule(now.Add(30 * time.Minute)); switched || state.Profile != "day" || state.Source != ProfileSourceCommand {
+		t.Errorf("Expected the commanded day profile to hold, got %+v", state)
+	}
+	if state, switched := profiles.Schedule(time.Date(2025, 9, 20, 22, 0, 30, 0, location)); !switched || state.Profile != "night" {
+		t.Errorf("Expected the night profile at 22:00, got %+v", state)
+	}
+	if _, err := profiles.Set("evening", now); err == nil {
+		t.Error("Expected an error for an unknown profile")
+	}
+}
+
+func TestParseProfileCommand(t *testing.T) {
+	tests := []struct {
+		payload     string
+		expected    string
+		expectError bool
+	}{
+		{"night", "night", false},
+		{" day\n", "day", false},
+		{`{"profile": "night"}`, "night", false},
+		{"", "", true},
+		{`{"name": "night"}`, "", true},
+		{`{"profile"`, "", true},
+	}
+	for _, tt := range tests {
+		name, err := ParseProfileCommand([]byte(tt.payload))
+		if (err != nil) != tt.expectError || name != tt.expected {
+			t.Errorf("ParseProfileCommand(%q) = %q, %v, expected %q", tt.payload, name, err, tt.expected)
+		}
+	}
+}
+
+func TestProfileMutesTopics(t *testing.T) {
+	b, host, port := startTestBroker(t)
+
+	ringing := make(chan broker.Message, 10)
+	if err := b.Subscribe("test/line/+/ringing", func(msg broker.Message) { ringing <- msg }); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	states := make(chan ProfileState, 10)
+	err := b.Subscribe("test/profile", func(msg broker.Message) {
+		var state ProfileState
+		if err := json.Unmarshal(msg.Payload, &state); err != nil {
+			t.Errorf("Invalid profile payload: %v", err)
+		}
+		states <- state
+	})
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	receive := func() ProfileState {
+		t.Helper()
+		select {
+		case state := <-states:
+			return state
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the profile")
+			return ProfileState{}
+		}
+	}
+
+	profiles, err := ParseProfiles([]string{"night=ringing"}, nil, time.UTC)
+	if err != nil {
+		t.Fatalf("ParseProfiles failed: %v", err)
+	}
+	client := newTestClient(t, host, port, Options{QoS: 1, Profiles: profiles, ProfileTopics: true})
+	if state := receive(); state.Profile != DefaultProfile {
+		t.Errorf("Expected the default profile on connect, got %+v", state)
+	}
+
+	if err := b.Publish("test/command/profile", []byte("night"), false); err != nil {
+		t.Fatalf("Failed to publish command: %v", err)
+	}
+	if state := receive(); state.Profile != "night" || state.Source != ProfileSourceCommand || len(state.Muted) != 1 {
+		t.Errorf("Expected the night profile, got %+v", state)
+	}
+
+	event := types.CallEvent{ID: "call-1", Type: types.CallTypeRing, Line: 1, Timestamp: time.Now()}
+	if err := client.PublishRinging(event); err != nil {
+		t.Fatalf("PublishRinging failed: %v", err)
+	}
+	select {
+	case msg := <-ringing:
+		t.Errorf("Expected ringing to be muted, got %s", msg.Payload)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	if err := client.SetProfile(context.Background(), DefaultProfile); err != nil {
+		t.Fatalf("SetProfile failed: %v", err)
+	}
+	receive()
+	if err := client.PublishRinging(event); err != nil {
+		t.Fatalf("PublishRinging failed: %v", err)
+	}
+	select {
+	case <-ringing:
+	case <-time.After(5 * time.Second):
+		t.Error("Expected ringing to be published with the default profile")
+	}
+}
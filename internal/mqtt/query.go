@@ -0,0 +1,175 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/codec"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// CallQueryStatusActive is the status of queried calls that did not end yet;
+// ended calls have the finish state finished, missedCall or notReached
+const CallQueryStatusActive = "active"
+
+// CallQuery filters the stored calls requested on the call query topic
+type CallQuery struct {
+	CorrelationID string    `json:"correlation_id"`   // Last level of the response topic, chosen by the client
+	Line          *int      `json:"line,omitempty"`   // Calls of this line only
+	From          time.Time `json:"from,omitempty"`   // Calls started at or after, RFC 3339
+	To            time.Time `json:"to,omitempty"`     // Calls started before, RFC 3339
+	Status        string    `json:"status,omitempty"` // active, finished, missedCall or notReached
+	Limit         int       `json:"limit,omitempty"`  // Number of calls returned, newest first
+}
+
+// QueriedCall is a stored call in the response to a call query
+type QueriedCall struct {
+	ID        string              `json:"id"`
+	Direction types.CallDirection `json:"direction"`
+	Started   time.Time           `json:"started"`
+	Ended     *time.Time          `json:"ended,omitempty"`
+	Caller    string              `json:"caller"`
+	Called    string              `json:"called"`
+	CallerMSN string              `json:"caller_msn,omitempty"`
+	CalledMSN string              `json:"called_msn,omitempty"`
+	Line      int                 `json:"line"`
+	Trunk     string              `json:"trunk,omitempty"`
+	Duration  int                 `json:"duration"`
+	Status    string              `json:"status"`
+	Tags      []string            `json:"tags,omitempty"`
+}
+
+// CallQueryResponse is the payload of the call query response topic
+type CallQueryResponse struct {
+	CorrelationID string        `json:"correlation_id"`
+	Calls         []QueriedCall `json:"calls"`
+	Error         string        `json:"error,omitempty"` // Set if the query was rejected or failed, Calls is empty then
+}
+
+// CallQueryService answers call queries from the stored calls
+type CallQueryService interface {
+	QueryCalls(ctx context.Context, query CallQuery) ([]QueriedCall, error)
+}
+
+// ParseCallQuery accepts a JSON CallQuery. An invalid query with a usable
+// correlation ID is returned along with the error, so the error can be answered.
+func ParseCallQuery(payload []byte) (CallQuery, error) {
+	var query CallQuery
+	if err := json.Unmarshal(payload, &query); err != nil {
+		// The correlation ID may still be readable when a filter is malformed
+		var id struct {
+			CorrelationID string `json:"correlation_id"`
+		}
+		_ = json.Unmarshal(payload, &id)
+		return CallQuery{CorrelationID: validCorrelationID(id.CorrelationID)}, fmt.Errorf("invalid call query %q: %w", payload, err)
+	}
+
+	if validCorrelationID(query.CorrelationID) == "" {
+		return CallQuery{}, fmt.Errorf("call query without valid correlation_id %q", query.CorrelationID)
+	}
+	switch query.Status {
+	case "", CallQueryStatusActive, string(types.CallStatusFinished), string(types.CallStatusMissedCall), string(types.CallStatusNotReached):
+	default:
+		return query, fmt.Errorf("invalid status '%s', expected active, finished, missedCall or notReached", query.Status)
+	}
+	if query.Limit < 0 {
+		return query, fmt.Errorf("invalid limit %d", query.Limit)
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && !query.From.Before(query.To) {
+		return query, fmt.Errorf("from %s is not before to %s", query.From.Format(time.RFC3339), query.To.Format(time.RFC3339))
+	}
+	return query, nil
+}
+
+// validCorrelationID returns the ID if it can be used as a topic level, otherwise ""
+func validCorrelationID(id string) string {
+	if id == "" || strings.ContainsAny(id, "/+#\x00") {
+		return ""
+	}
+	return id
+}
+
+// ServeCallQueries answers the queries on the call query topic from the
+// service. It must be called before Connect, which subscribes to the topic.
+func (c *Client) ServeCallQueries(service CallQueryService) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.callQueries = service
+}
+
+// subscribeCallQueries listens on the call query topic; subscriptions are lost on reconnect with a clean session
+func (c *Client) subscribeCallQueries(client mqtt.Client) error {
+	topic, err := c.topic(c.topics.CallQuery, TopicData{})
+	if err != nil {
+		return err
+	}
+	if err := waitToken(context.Background(), client.Subscribe(topic, c.qos, c.onCallQuery), c.publishTimeout); err != nil {
+		return fmt.Errorf("failed to subscribe to '%s': %w", topic, err)
+	}
+	log.Printf("Listening for call queries on topic '%s'", topic)
+	return nil
+}
+
+// onCallQuery answers the query outside of the paho callback, which must not block
+func (c *Client) onCallQuery(_ mqtt.Client, msg mqtt.Message) {
+	// A retained query would be answered again on every reconnect
+	if msg.Retained() {
+		log.Printf("Ignoring retained call query on topic '%s'", msg.Topic())
+		return
+	}
+
+	payload := msg.Payload()
+	go func() {
+		if err := c.HandleCallQuery(context.Background(), payload); err != nil {
+			log.Printf("Call query failed: %v", err)
+		}
+	}()
+}
+
+// HandleCallQuery answers a query payload on the response topic of its
+// correlation ID. Rejected and failed queries are answered with the error.
+func (c *Client) HandleCallQuery(ctx context.Context, payload []byte) error {
+	c.mu.RLock()
+	service := c.callQueries
+	c.mu.RUnlock()
+	if service == nil {
+		return fmt.Errorf("call queries are not configured")
+	}
+
+	query, err := ParseCallQuery(payload)
+	if err != nil {
+		if query.CorrelationID == "" {
+			return err
+		}
+		return c.publishCallQueryResponse(ctx, CallQueryResponse{CorrelationID: query.CorrelationID, Calls: []QueriedCall{}, Error: err.Error()})
+	}
+
+	response := CallQueryResponse{CorrelationID: query.CorrelationID, Calls: []QueriedCall{}}
+	calls, err := service.QueryCalls(ctx, query)
+	if err != nil {
+		log.Printf("Failed to query calls for %s: %v", query.CorrelationID, err)
+		response.Error = "failed to query calls"
+	} else if calls != nil {
+		response.Calls = calls
+	}
+	return c.publishCallQueryResponse(ctx, response)
+}
+
+// publishCallQueryResponse publishes the response, never retained
+func (c *Client) publishCallQueryResponse(ctx context.Context, response CallQueryResponse) error {
+	topic, err := c.topic(c.topics.CallQueryResponse, TopicData{ID: response.CorrelationID})
+	if err != nil {
+		return err
+	}
+	payload, err := c.encode("call_query_response", codec.Message{Kind: "call_query.response", Subject: response.CorrelationID, Time: c.clock.Now(), Value: response})
+	if err != nil {
+		return err
+	}
+	return c.publishWithRetain(ctx, topic, payload, false)
+}
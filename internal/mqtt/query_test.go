@@ -0,0 +1,135 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/broker"
+)
+
+func TestParseCallQuery(t *testing.T) {
+	tests := []struct {
+		payload     string
+		expectedID  string // Correlation ID returned, also along with an error
+		expectError bool
+	}{
+		{`{"correlation_id": "abc"}`, "abc", false},
+		{`{"correlation_id": "abc", "line": 1, "status": "missedCall", "limit": 10, "from": "2025-09-01T00:00:00Z", "to": "2025-10-01T00:00:00Z"}`, "abc", false},
+		{`{"line": 1}`, "", true},
+		{`{"correlation_id": "a/b"}`, "", true},
+		{`{"correlation_id": "abc", "status": "ringing"}`, "abc", true},
+		{`{"correlation_id": "abc", "limit": -1}`, "abc", true},
+		{`{"correlation_id": "abc", "from": "2025-10-01T00:00:00Z", "to": "2025-09-01T00:00:00Z"}`, "abc", true},
+		{`{"correlation_id": "abc", "from": "yesterday"}`, "abc", true},
+		{`calls`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.payload, func(t *testing.T) {
+			query, err := ParseCallQuery([]byte(tt.payload))
+			if (err != nil) != tt.expectError {
+				t.Fatalf("ParseCallQuery() error = %v, expectError %v", err, tt.expectError)
+			}
+			if query.CorrelationID != tt.expectedID {
+				t.Errorf("Expected correlation ID %q, got %q", tt.expectedID, query.CorrelationID)
+			}
+		})
+	}
+}
+
+// fakeCallQueries answers every query with the same calls and records the queries
+type fakeCallQueries struct {
+	mu      sync.Mutex
+	calls   []QueriedCall
+	err     error
+	queries chan CallQuery
+}
+
+func (f *fakeCallQueries) QueryCalls(_ context.Context, query CallQuery) ([]QueriedCall, error) {
+	f.queries <- query
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls, f.err
+}
+
+func TestCallQueries(t *testing.T) {
+	b, host, port := startTestBroker(t)
+
+	responses := make(chan CallQueryResponse, 10)
+	err := b.Subscribe("test/query/calls/response/+", func(msg broker.Message) {
+		var response CallQueryResponse
+		if err := json.Unmarshal(msg.Payload, &response); err != nil {
+			t.Errorf("Invalid call query response: %v", err)
+		}
+		if msg.Retained {
+			t.Errorf("Expected the response on %s not to be retained", msg.Topic)
+		}
+		if msg.Topic != "test/query/calls/response/"+response.CorrelationID {
+			t.Errorf("Response of %s on topic %s", response.CorrelationID, msg.Topic)
+		}
+		responses <- response
+	})
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	service := &fakeCallQueries{calls: []QueriedCall{{ID: "call-1", Line: 1, Status: "missedCall"}}, queries: make(chan CallQuery, 10)}
+	client := NewClient(Options{Broker: host, Port: port, ClientID: "integration-test", TopicPrefix: "test", QoS: 1, ConnectTimeout: 5 * time.Second})
+	client.ServeCallQueries(service)
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Disconnect() })
+
+	receive := func() CallQueryResponse {
+		t.Helper()
+		select {
+		case response := <-responses:
+			return response
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the response")
+			return CallQueryResponse{}
+		}
+	}
+
+	if err := b.Publish("test/query/calls", []byte(`{"correlation_id": "q1", "line": 1, "status": "missedCall", "limit": 5}`), false); err != nil {
+		t.Fatalf("Failed to publish query: %v", err)
+	}
+	response := receive()
+	if response.CorrelationID != "q1" || response.Error != "" || len(response.Calls) != 1 || response.Calls[0].ID != "call-1" {
+		t.Errorf("Expected call-1 for q1, got %+v", response)
+	}
+	if query := <-service.queries; query.Line == nil || *query.Line != 1 || query.Status != "missedCall" || query.Limit != 5 {
+		t.Errorf("Expected the filters of q1, got %+v", query)
+	}
+
+	// Invalid queries are answered with the error, without querying
+	if err := b.Publish("test/query/calls", []byte(`{"correlation_id": "q2", "status": "ringing"}`), false); err != nil {
+		t.Fatalf("Failed to publish query: %v", err)
+	}
+	if response := receive(); response.CorrelationID != "q2" || response.Error == "" || response.Calls == nil || len(response.Calls) != 0 {
+		t.Errorf("Expected an error for q2, got %+v", response)
+	}
+
+	// Failures of the database are not passed on in detail
+	service.mu.Lock()
+	service.err = errors.New("database is locked")
+	service.mu.Unlock()
+	if err := b.Publish("test/query/calls", []byte(`{"correlation_id": "q3"}`), false); err != nil {
+		t.Fatalf("Failed to publish query: %v", err)
+	}
+	if response := receive(); response.CorrelationID != "q3" || response.Error != "failed to query calls" {
+		t.Errorf("Expected a failed query for q3, got %+v", response)
+	}
+	select {
+	case query := <-service.queries:
+		if query.CorrelationID != "q3" {
+			t.Errorf("Expected the invalid query q2 not to be run, got %+v", query)
+		}
+	default:
+		t.Error("Expected q3 to be run")
+	}
+}
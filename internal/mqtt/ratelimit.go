@@ -0,0 +1,169 @@
+package mqtt
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+)
+
+// PublishStats are the counters of the publishes and the publish rate limit
+type PublishStats struct {
+	Queued    uint64 `json:"queued"`    // Messages delayed because the rate was exceeded
+	Coalesced uint64 `json:"coalesced"` // Queued state messages replaced by a newer message to the same topic
+	Dropped   uint64 `json:"dropped"`   // Messages lost because the queue was full
+	Pending   int    `json:"pending"`   // Messages waiting in the queue
+	Failed    uint64 `json:"failed"`    // Publishes the broker did not acknowledge
+}
+
+// queuedMessage is a publish waiting for the rate limit
+type queuedMessage struct {
+	topic   string
+	payload []byte
+	retain  bool
+	state   bool // Only the latest message of the topic matters, e.g. a line status
+}
+
+// rateLimiter is a token bucket in front of the broker. Messages exceeding
+// the rate are queued. A newer state message to a queued topic replaces the
+// queued one, so subscribers still get the latest state; event messages,
+// e.g. notifications, are queued one by one. While the queue is full, new
+// messages are dropped.
+type rateLimiter struct {
+	clock    clock.Clock
+	rate     float64 // Tokens per second
+	burst    float64
+	maxQueue int
+	publish  func(msg queuedMessage) // Sends a message that was queued
+
+	mu       sync.Mutex
+	tokens   float64
+	last     time.Time
+	order    []*queuedMessage          // Queued messages, oldest first
+	states   map[string]*queuedMessage // Queued state messages by topic
+	timer    clock.Timer
+	flushing bool // Queued messages are being sent, new messages must wait behind them
+	stats    PublishStats
+}
+
+// newRateLimiter creates a limiter allowing rate messages per second with bursts of up to burst messages
+func newRateLimiter(clk clock.Clock, rate, burst, maxQueue int, publish func(msg queuedMessage)) *rateLimiter {
+	return &rateLimiter{
+		clock:    clk,
+		rate:     float64(rate),
+		burst:    float64(burst),
+		maxQueue: maxQueue,
+		publish:  publish,
+		tokens:   float64(burst),
+		last:     clk.Now(),
+		states:   make(map[string]*queuedMessage),
+	}
+}
+
+// allow takes a token and reports true if the message may be sent right
+// away. Otherwise the message is queued or coalesced; an error reports that
+// it was dropped.
+func (l *rateLimiter) allow(msg queuedMessage) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill()
+	if len(l.order) == 0 && !l.flushing && l.tokens >= 1 {
+		l.tokens--
+		return true, nil
+	}
+
+	if queued, ok := l.states[msg.topic]; ok && msg.state {
+		*queued = msg
+		l.stats.Coalesced++
+		return false, nil
+	}
+	if len(l.order) >= l.maxQueue {
+		l.stats.Dropped++
+		return false, fmt.Errorf("publish queue full, dropped message to topic '%s' (%d dropped in total)", msg.topic, l.stats.Dropped)
+	}
+	queued := &msg
+	l.order = append(l.order, queued)
+	if msg.state {
+		l.states[msg.topic] = queued
+	}
+	l.stats.Queued++
+	l.schedule()
+	return false, nil
+}
+
+// refill adds the tokens earned since the last call
+func (l *rateLimiter) refill() {
+	now := l.clock.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+}
+
+// schedule arranges a flush for when the next token is available
+func (l *rateLimiter) schedule() {
+	if l.timer != nil || l.flushing || len(l.order) == 0 {
+		return
+	}
+	wait := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+	l.timer = l.clock.AfterFunc(max(wait, time.Millisecond), l.flush)
+}
+
+// flush sends as many queued messages as there are tokens, oldest first
+func (l *rateLimiter) flush() {
+	l.mu.Lock()
+	l.timer = nil
+	l.refill()
+	var batch []queuedMessage
+	for len(l.order) > 0 && l.tokens >= 1 {
+		l.tokens--
+		batch = append(batch, l.dequeue())
+	}
+	l.flushing = true
+	l.mu.Unlock()
+
+	for _, msg := range batch {
+		l.publish(msg)
+	}
+
+	l.mu.Lock()
+	l.flushing = false
+	l.schedule()
+	l.mu.Unlock()
+}
+
+// drain stops the limiter and returns the queued messages, oldest first
+func (l *rateLimiter) drain() []queuedMessage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	batch := make([]queuedMessage, 0, len(l.order))
+	for len(l.order) > 0 {
+		batch = append(batch, l.dequeue())
+	}
+	return batch
+}
+
+// dequeue removes the oldest queued message; l.mu must be held
+func (l *rateLimiter) dequeue() queuedMessage {
+	msg := l.order[0]
+	l.order = l.order[1:]
+	if l.states[msg.topic] == msg {
+		delete(l.states, msg.topic)
+	}
+	return *msg
+}
+
+// snapshot returns the counters and the queue length
+func (l *rateLimiter) snapshot() PublishStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	stats := l.stats
+	stats.Pending = len(l.order)
+	return stats
+}
@@ -0,0 +1,109 @@
+package mqtt
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+)
+
+func TestRateLimiter(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 9, 20, 12, 0, 0, 0, time.UTC))
+	var sent []string
+	limiter := newRateLimiter(clk, 2, 2, 2, func(msg queuedMessage) {
+		sent = append(sent, msg.topic+"="+string(msg.payload))
+	})
+	allow := func(topic, payload string) bool {
+		allowed, _ := limiter.allow(queuedMessage{topic: topic, payload: []byte(payload), state: true})
+		return allowed
+	}
+
+	// The burst is sent right away
+	if !allow("a", "1") || !allow("b", "1") {
+		t.Fatal("Expected the burst to be allowed")
+	}
+	// Then messages are queued, coalesced per topic and dropped once the queue is full
+	if allow("a", "2") || allow("c", "1") || allow("a", "3") {
+		t.Fatal("Expected messages exceeding the rate to be held back")
+	}
+	if _, err := limiter.allow(queuedMessage{topic: "d", state: true}); err == nil {
+		t.Fatal("Expected an error for a message dropped from the full queue")
+	}
+	if want := (PublishStats{Queued: 2, Coalesced: 1, Dropped: 1, Pending: 2}); limiter.snapshot() != want {
+		t.Errorf("Expected stats %+v, got %+v", want, limiter.snapshot())
+	}
+
+	// A new message waits behind the queue even when a token is available
+	clk.Advance(500 * time.Millisecond)
+	if want := []string{"a=3"}; !slices.Equal(sent, want) {
+		t.Fatalf("Expected %v after one token, got %v", want, sent)
+	}
+	if allow("e", "1") {
+		t.Error("Expected a message to wait behind the queue")
+	}
+	clk.Advance(time.Second)
+	if want := []string{"a=3", "c=1", "e=1"}; !slices.Equal(sent, want) {
+		t.Fatalf("Expected %v, got %v", want, sent)
+	}
+
+	// Once the queue is empty, earned tokens are used directly
+	clk.Advance(500 * time.Millisecond)
+	if !allow("f", "1") {
+		t.Error("Expected a message to be allowed with an empty queue")
+	}
+}
+
+func TestRateLimiterKeepsEvents(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 9, 20, 12, 0, 0, 0, time.UTC))
+	var sent []string
+	limiter := newRateLimiter(clk, 1, 1, 10, func(msg queuedMessage) {
+		sent = append(sent, msg.topic+"="+string(msg.payload))
+	})
+	allow := func(topic, payload string, state bool) {
+		if _, err := limiter.allow(queuedMessage{topic: topic, payload: []byte(payload), state: state}); err != nil {
+			t.Fatalf("Unexpected drop: %v", err)
+		}
+	}
+
+	// Events to the same topic are queued one by one, only states are coalesced
+	allow("status", "0", true)
+	allow("notify", "1", false)
+	allow("status", "1", true)
+	allow("notify", "2", false)
+	allow("status", "2", true)
+
+	clk.Advance(10 * time.Second)
+	if want := []string{"notify=1", "status=2", "notify=2"}; !slices.Equal(sent, want) {
+		t.Errorf("Expected %v, got %v", want, sent)
+	}
+	if want := (PublishStats{Queued: 3, Coalesced: 1}); limiter.snapshot() != want {
+		t.Errorf("Expected stats %+v, got %+v", want, limiter.snapshot())
+	}
+}
+
+func TestRateLimiterDrain(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 9, 20, 12, 0, 0, 0, time.UTC))
+	limiter := newRateLimiter(clk, 1, 1, 10, func(msg queuedMessage) {
+		t.Errorf("Unexpected publish of %s after drain", msg.topic)
+	})
+	limiter.allow(queuedMessage{topic: "a"})
+	limiter.allow(queuedMessage{topic: "b"})
+	limiter.allow(queuedMessage{topic: "c"})
+
+	drained := limiter.drain()
+	if len(drained) != 2 || drained[0].topic != "b" || drained[1].topic != "c" {
+		t.Errorf("Expected the queued messages b and c, got %+v", drained)
+	}
+	clk.Advance(time.Minute)
+}
+
+func TestNewClientPublishRate(t *testing.T) {
+	if client := NewClient(Options{}); client.limiter != nil {
+		t.Error("Expected no rate limit by default")
+	}
+	client := NewClient(Options{PublishRate: 5})
+	if client.limiter == nil || client.limiter.burst != 20 || client.limiter.maxQueue != 100 {
+		t.Errorf("Expected a rate limit with default burst and queue size, got %+v", client.limiter)
+	}
+}
@@ -0,0 +1,110 @@
+package mqtt
+
+import (
+	"strings"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// Directions of a topic as seen from the bridge
+const (
+	TopicPublish   = "publish"
+	TopicSubscribe = "subscribe"
+)
+
+// topicEntry registers a topic of the bridge
+type topicEntry struct {
+	name      string // Name in the topic description, the configuration uses it upper case
+	layout    *string
+	topic     **Topic
+	schema    string                 // Type of the JSON payload, see docs/MQTT.md
+	direction string                 // TopicPublish or TopicSubscribe
+	retain    func(retainFlags) bool // Retain flag of published messages
+}
+
+// topicRegistry lists all topics of the bridge. It is the single source for
+// parsing the templates, the retain flags and the topic description.
+func topicRegistry(templates *TopicTemplates, topics *Topics) []topicEntry {
+	always := func(retainFlags) bool { return true }
+	never := func(retainFlags) bool { return false }
+	return []topicEntry{
+		{"status", &templates.Status, &topics.Status, "ServiceStatus", TopicPublish, func(r retainFlags) bool { return r.Status }},
+		{"fritzbox_status", &templates.FritzBoxStatus, &topics.FritzBoxStatus, "FritzBoxStatus", TopicPublish, always},
+		{"line_status", &templates.LineStatus, &topics.LineStatus, "LineStatus", TopicPublish, func(r retainFlags) bool { return r.LineStatus }},
+		{"line_last_event", &templates.LineLastEvent, &topics.LineLastEvent, "CallEvent", TopicPublish, func(r retainFlags) bool { return r.LineLastEvent }},
+		{"line_elapsed", &templates.LineElapsed, &topics.LineElapsed, "ElapsedMessage", TopicPublish, never},
+		{"ringing", &templates.Ringing, &topics.Ringing, "RingingMessage", TopicPublish, never},
+		{"vip_ring", &templates.VIPRing, &topics.VIPRing, "RingingMessage", TopicPublish, never},
+		{"call", &templates.Call, &topics.Call, "LineStatus", TopicPublish, func(r retainFlags) bool { return r.Call }},
+		{"call_completed", &templates.CallCompleted, &topics.CallCompleted, "CompletedCall", TopicPublish, never},
+		{"missed_call", &templates.MissedCall, &topics.MissedCall, "MissedCall", TopicPublish, func(r retainFlags) bool { return r.MissedCall }},
+		{"missed_calls", &templates.MissedCalls, &topics.MissedCalls, "MissedCallList", TopicPublish, func(r retainFlags) bool { return r.MissedCalls }},
+		{"history", &templates.History, &topics.History, "CallHistory", TopicPublish, func(r retainFlags) bool { return r.History }},
+		{"fsm_status", &templates.FSMStatus, &topics.FSMStatus, "FSMStatusMessage", TopicPublish, func(r retainFlags) bool { return r.FSMStatus }},
+		{"fsm_status_change", &templates.FSMStatusChange, &topics.FSMStatusChange, "LineStatusChangeMessage", TopicPublish, func(r retainFlags) bool { return r.FSMStatusChange }},
+		{"dnd", &templates.DND, &topics.DND, "DNDState", TopicPublish, always},
+		{"dnd_command", &templates.DNDCommand, &topics.DNDCommand, "DNDCommand", TopicSubscribe, never},
+		{"missed_call_ack", &templates.MissedCallAck, &topics.MissedCallAck, "MissedCallAck", TopicSubscribe, never},
+		{"reload_command", &templates.ReloadCommand, &topics.ReloadCommand, "ReloadCommand", TopicSubscribe, never},
+		{"call_query", &templates.CallQuery, &topics.CallQuery, "CallQuery", TopicSubscribe, never},
+		{"call_query_response", &templates.CallQueryResponse, &topics.CallQueryResponse, "CallQueryResponse", TopicPublish, never},
+		{"profile", &templates.Profile, &topics.Profile, "ProfileState", TopicPublish, always},
+		{"profile_command", &templates.ProfileCommand, &topics.ProfileCommand, "ProfileCommand", TopicSubscribe, never},
+		{"notification", &templates.Notification, &topics.Notification, "Notification", TopicPublish, never},
+		{"error", &templates.Error, &topics.Error, "Rejection", TopicPublish, never},
+		{"unparsed", &templates.Unparsed, &topics.Unparsed, "Unparsed", TopicPublish, never},
+		{"database_health", &templates.DatabaseHealth, &topics.DatabaseHealth, "DatabaseHealth", TopicPublish, never},
+		{"acl_test", &templates.ACLTest, &topics.ACLTest, "ACLTestMessage", TopicPublish, never},
+		{"incident", &templates.Incident, &topics.Incident, "Incident", TopicPublish, never},
+		{"metrics", &templates.Metrics, &topics.Metrics, "Metrics", TopicPublish, never},
+		{"description", &templates.Description, &topics.Description, "TopicDescription", TopicPublish, always},
+		{"summary_last_caller", &templates.SummaryLastCaller, &topics.SummaryLastCaller, "SummaryCall", TopicPublish, always},
+		{"summary_last_missed", &templates.SummaryLastMissed, &topics.SummaryLastMissed, "MissedCall", TopicPublish, always},
+		{"summary_active_calls", &templates.SummaryActiveCalls, &topics.SummaryActiveCalls, "ActiveCalls", TopicPublish, always},
+	}
+}
+
+// Filter returns the subscription filter matching all topics of the layout
+// for the prefix and box. Levels differing between two calls become +, and
+// if the number of levels differs, the rest of the topic becomes #.
+func (t *Topic) Filter(prefix, box string) (string, error) {
+	first, err := t.Render(TopicData{Prefix: prefix, Box: box, Line: 1, Trunk: "SIP0", MSN: "1", Type: types.CallTypeRing, Direction: types.CallDirectionInbound, ID: "first", Recipient: "first"})
+	if err != nil {
+		return "", err
+	}
+	second, err := t.Render(TopicData{Prefix: prefix, Box: box, Line: 2, Trunk: "SIP1", MSN: "2", Type: types.CallTypeCall, Direction: types.CallDirectionOutbound, ID: "second", Recipient: "second"})
+	if err != nil {
+		return "", err
+	}
+
+	levels, others := strings.Split(first, "/"), strings.Split(second, "/")
+	if len(levels) != len(others) {
+		common := 0
+		for common < min(len(levels), len(others)) && levels[common] == others[common] {
+			common++
+		}
+		return strings.Join(append(levels[:common:common], "#"), "/"), nil
+	}
+	for i := range levels {
+		if levels[i] != others[i] {
+			levels[i] = "+"
+		}
+	}
+	return strings.Join(levels, "/"), nil
+}
+
+// MatchFilter reports whether the topic matches the subscription filter
+func MatchFilter(filter, topic string) bool {
+	filterLevels, topicLevels := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, level := range filterLevels {
+		switch {
+		case level == "#":
+			return true
+		case i >= len(topicLevels):
+			return false
+		case level != "+" && level != topicLevels[i]:
+			return false
+		}
+	}
+	return len(filterLevels) == len(topicLevels)
+}
@@ -0,0 +1,86 @@
+package mqtt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTopicRegistryComplete(t *testing.T) {
+	templates := DefaultTopicTemplates()
+	topics := DefaultTopics()
+	entries := topicRegistry(&templates, topics)
+
+	// Every template and parsed topic must be registered, otherwise it is neither parsed nor described
+	if n := reflect.TypeOf(templates).NumField(); len(entries) != n {
+		t.Errorf("Registry has %d entries, TopicTemplates has %d fields", len(entries), n)
+	}
+	if n := reflect.TypeOf(*topics).NumField(); len(entries) != n {
+		t.Errorf("Registry has %d entries, Topics has %d fields", len(entries), n)
+	}
+
+	names := make(map[string]bool)
+	for _, entry := range entries {
+		if names[entry.name] {
+			t.Errorf("Duplicate topic name %s", entry.name)
+		}
+		names[entry.name] = true
+		if *entry.layout == "" || *entry.topic == nil || entry.schema == "" {
+			t.Errorf("Incomplete registry entry %s", entry.name)
+		}
+		if entry.direction != TopicPublish && entry.direction != TopicSubscribe {
+			t.Errorf("Invalid direction %q of topic %s", entry.direction, entry.name)
+		}
+	}
+}
+
+func TestTopicFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		layout   string
+		expected string
+	}{
+		{"static", "{{.Prefix}}/status", "fritz/status"},
+		{"box", "{{.Prefix}}/{{.Box}}/status", "fritz/box/status"},
+		{"line level", "{{.Prefix}}/line/{{.Line}}/status", "fritz/line/+/status"},
+		{"partial level", "{{.Prefix}}/line_{{.Line}}", "fritz/+"},
+		{"varying level count", "{{.Prefix}}/line/{{if eq .Line 1}}first{{else}}other/{{.Line}}{{end}}/status", "fritz/line/#"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			topics, err := ParseTopics(TopicTemplates{LineStatus: tt.layout})
+			if err != nil {
+				t.Fatalf("ParseTopics failed: %v", err)
+			}
+			filter, err := topics.LineStatus.Filter("fritz", "box")
+			if err != nil {
+				t.Fatalf("Filter failed: %v", err)
+			}
+			if filter != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, filter)
+			}
+		})
+	}
+}
+
+func TestMatchFilter(t *testing.T) {
+	tests := []struct {
+		filter   string
+		topic    string
+		expected bool
+	}{
+		{"fritz/status", "fritz/status", true},
+		{"fritz/status", "fritz/status/x", false},
+		{"fritz/line/+/status", "fritz/line/1/status", true},
+		{"fritz/line/+/status", "fritz/line/1/last_event", false},
+		{"fritz/line/+/status", "fritz/line/status", false},
+		{"fritz/#", "fritz/line/1/status", true},
+		{"fritz/call/+", "fritz/call", false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchFilter(tt.filter, tt.topic); got != tt.expected {
+			t.Errorf("MatchFilter(%q, %q) = %v, expected %v", tt.filter, tt.topic, got, tt.expected)
+		}
+	}
+}
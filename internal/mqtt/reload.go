@@ -0,0 +1,45 @@
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// SetLogLevel changes the log level, which decides about the FSM debug topics unless they are switched explicitly
+func (c *Client) SetLogLevel(level string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.logLevel = level
+}
+
+// subscribeReloadCommands listens on the reload command topic; subscriptions are lost on reconnect with a clean session
+func (c *Client) subscribeReloadCommands(client mqtt.Client) error {
+	topic, err := c.topic(c.topics.ReloadCommand, TopicData{})
+	if err != nil {
+		return err
+	}
+	if err := waitToken(context.Background(), client.Subscribe(topic, c.qos, c.onReloadCommand), c.publishTimeout); err != nil {
+		return fmt.Errorf("failed to subscribe to '%s': %w", topic, err)
+	}
+	log.Printf("Listening for reload commands on topic '%s'", topic)
+	return nil
+}
+
+// onReloadCommand reloads the configuration outside of the paho callback, which must not block.
+// The payload is ignored.
+func (c *Client) onReloadCommand(_ mqtt.Client, msg mqtt.Message) {
+	// A retained command would reload again on every reconnect
+	if msg.Retained() {
+		log.Printf("Ignoring retained reload command on topic '%s'", msg.Topic())
+		return
+	}
+
+	go func() {
+		if err := c.onReload(context.Background()); err != nil {
+			log.Printf("Reload command failed: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,197 @@
+package mqtt
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// DefaultRetainedSettle is how long a drift check waits for the retained
+// messages the broker sends after subscribing
+const DefaultRetainedSettle = time.Second
+
+// RetainedStats reports the drift checks of the retained topics
+type RetainedStats struct {
+	Topics    int        `json:"topics"`             // Retained topics published by the bridge
+	Checksum  string     `json:"checksum,omitempty"` // SHA-256 of the topics and payloads compared by the last check
+	Checks    uint64     `json:"checks"`
+	Drifted   uint64     `json:"drifted"` // Topics found changed or cleared by another client
+	Repaired  uint64     `json:"repaired"`
+	LastCheck *time.Time `json:"last_check,omitempty"`
+}
+
+// RetainedDrift is the result of a drift check
+type RetainedDrift struct {
+	Checked  int      // Topics compared
+	Expected string   // Checksum of the payloads the bridge published
+	Actual   string   // Checksum of the payloads retained on the broker
+	Changed  []string // Topics retaining another payload
+	Missing  []string // Topics retaining nothing
+	Repaired int      // Topics published again
+}
+
+// Drifted reports whether the broker retains other payloads than the bridge published
+func (d RetainedDrift) Drifted() bool {
+	return len(d.Changed) > 0 || len(d.Missing) > 0
+}
+
+// retainedState is what the bridge believes its retained topics contain
+type retainedState struct {
+	mu       sync.Mutex
+	payloads map[string][]byte // Last acknowledged retained payload by topic
+	stats    RetainedStats
+}
+
+// record notes an acknowledged retained publish; an empty payload clears the topic
+func (s *retainedState) record(topic string, payload []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.payloads == nil {
+		s.payloads = make(map[string][]byte)
+	}
+	if len(payload) == 0 {
+		delete(s.payloads, topic)
+		return
+	}
+	s.payloads[topic] = bytes.Clone(payload)
+}
+
+// snapshot returns a copy of the expected payloads
+func (s *retainedState) snapshot() map[string][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return maps.Clone(s.payloads)
+}
+
+// retainedChecksum hashes the payloads of the topics in order
+func retainedChecksum(topics []string, payloads map[string][]byte) string {
+	hash := sha256.New()
+	var size [8]byte
+	for _, topic := range topics {
+		payload := payloads[topic]
+		for _, field := range [][]byte{[]byte(topic), payload} {
+			binary.BigEndian.PutUint64(size[:], uint64(len(field)))
+			hash.Write(size[:])
+			hash.Write(field)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// CheckRetained compares what the broker retains on the topics the bridge
+// published retained with the last payloads it published there, detecting
+// topics another client overwrote or cleared. With repair, the expected
+// payloads are published again. Topics published to during the check are
+// skipped, as their new payload may not have reached the broker yet.
+func (c *Client) CheckRetained(ctx context.Context, repair bool) (RetainedDrift, error) {
+	var drift RetainedDrift
+	c.mu.RLock()
+	client := c.client
+	c.mu.RUnlock()
+	if client == nil || !client.IsConnected() {
+		return drift, fmt.Errorf("MQTT client not connected")
+	}
+
+	expected := c.retained.snapshot()
+	if len(expected) == 0 {
+		return drift, nil
+	}
+
+	// The broker sends the retained message of each topic on subscribe
+	var mu sync.Mutex
+	observed := make(map[string][]byte, len(expected))
+	filters := make(map[string]byte, len(expected))
+	for topic := range expected {
+		filters[topic] = c.qos
+	}
+	handler := func(_ mqtt.Client, msg mqtt.Message) {
+		if !msg.Retained() {
+			return
+		}
+		mu.Lock()
+		observed[msg.Topic()] = bytes.Clone(msg.Payload())
+		mu.Unlock()
+	}
+	if err := waitToken(ctx, client.SubscribeMultiple(filters, handler), c.publishTimeout); err != nil {
+		return drift, fmt.Errorf("failed to subscribe to retained topics: %w", err)
+	}
+	settle := time.NewTimer(c.retainedSettle)
+	select {
+	case <-settle.C:
+	case <-ctx.Done():
+		settle.Stop()
+	}
+	topics := slices.Sorted(maps.Keys(filters))
+	if err := waitToken(context.Background(), client.Unsubscribe(topics...), c.publishTimeout); err != nil {
+		log.Printf("Failed to unsubscribe from retained topics: %v", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return drift, err
+	}
+
+	current := c.retained.snapshot()
+	topics = slices.DeleteFunc(topics, func(topic string) bool {
+		return !bytes.Equal(expected[topic], current[topic])
+	})
+	mu.Lock()
+	drift.Checked = len(topics)
+	drift.Expected = retainedChecksum(topics, expected)
+	drift.Actual = retainedChecksum(topics, observed)
+	if drift.Actual != drift.Expected {
+		for _, topic := range topics {
+			switch payload, ok := observed[topic]; {
+			case !ok:
+				drift.Missing = append(drift.Missing, topic)
+			case !bytes.Equal(payload, expected[topic]):
+				drift.Changed = append(drift.Changed, topic)
+			}
+		}
+	}
+	mu.Unlock()
+
+	for _, topic := range drift.Missing {
+		log.Printf("Retained topic '%s' was cleared by another client", topic)
+	}
+	for _, topic := range drift.Changed {
+		log.Printf("Retained topic '%s' was overwritten by another client", topic)
+	}
+	if repair {
+		for _, topic := range append(slices.Clone(drift.Missing), drift.Changed...) {
+			if err := c.publishWithRetain(ctx, topic, expected[topic], true); err != nil {
+				log.Printf("Failed to repair retained topic '%s': %v", topic, err)
+				continue
+			}
+			drift.Repaired++
+		}
+	}
+
+	now := c.clock.Now()
+	c.retained.mu.Lock()
+	c.retained.stats.Checksum = drift.Expected
+	c.retained.stats.Checks++
+	c.retained.stats.Drifted += uint64(len(drift.Missing) + len(drift.Changed))
+	c.retained.stats.Repaired += uint64(drift.Repaired)
+	c.retained.stats.LastCheck = &now
+	c.retained.mu.Unlock()
+	return drift, nil
+}
+
+// RetainedStats returns the counters of the drift checks
+func (c *Client) RetainedStats() RetainedStats {
+	c.retained.mu.Lock()
+	defer c.retained.mu.Unlock()
+	stats := c.retained.stats
+	stats.Topics = len(c.retained.payloads)
+	return stats
+}
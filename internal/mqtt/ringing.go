@@ -0,0 +1,93 @@
+package mqtt
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/codec"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// RingingMessage is the minimal payload of the ringing and VIP ring topics
+type RingingMessage struct {
+	ID        string    `json:"id"`
+	Line      int       `json:"line"`
+	Trunk     string    `json:"trunk,omitempty"`
+	Caller    string    `json:"caller,omitempty"`
+	Called    string    `json:"called,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	Priority  bool      `json:"priority,omitempty"` // Caller is on the VIP list
+
+	RepeatCall  bool `json:"repeat_call,omitempty"` // Caller called shortly before
+	RepeatCount int  `json:"repeat_count,omitempty"`
+}
+
+// PublishRinging publishes a RING event to the ringing topic as soon as it is
+// parsed, ahead of the state machine and the other sinks, for automations that
+// must react quickly. RINGs of VIPs are also published to the VIP ring topic.
+// It does not wait for the broker to acknowledge the message; failed publishes
+// are only logged. While the publish rate is exceeded, the message is queued
+// like any other event.
+func (c *Client) PublishRinging(event types.CallEvent) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if !c.connected || c.client == nil || !c.client.IsConnected() {
+		return fmt.Errorf("MQTT client not connected")
+	}
+
+	message := RingingMessage{
+		ID:        event.ID,
+		Line:      event.Line,
+		Trunk:     event.Trunk,
+		Caller:    event.Caller,
+		Called:    event.Called,
+		Timestamp: event.Timestamp,
+		Priority:  event.Priority,
+
+		RepeatCall:  event.RepeatCall,
+		RepeatCount: event.RepeatCount,
+	}
+	if err := c.publishRing("ringing", c.topics.Ringing, event, message); err != nil {
+		return err
+	}
+	if event.Priority {
+		return c.publishRing("vip_ring", c.topics.VIPRing, event, message)
+	}
+	return nil
+}
+
+// publishRing publishes the ringing message to a topic without waiting for
+// the broker. c.mu must be held.
+func (c *Client) publishRing(name string, layout *Topic, event types.CallEvent, message RingingMessage) error {
+	if c.muted(name, event.ID) {
+		return nil
+	}
+	topic, err := c.topic(layout, topicDataForEvent(event))
+	if err != nil {
+		return err
+	}
+	payload, err := c.encode(name, codec.Message{Kind: "call." + name, Subject: event.ID, Time: event.Timestamp, Value: message})
+	if err != nil {
+		return err
+	}
+
+	// Ringing counts against the publish rate like every other message
+	if c.limiter != nil {
+		if allowed, err := c.limiter.allow(queuedMessage{topic: topic, payload: payload}); err != nil || !allowed {
+			return err
+		}
+	}
+
+	token := c.client.Publish(topic, c.qos, false, payload)
+	c.publishMirrors(topic, payload, false)
+	go func() {
+		if !token.WaitTimeout(c.publishTimeout) {
+			log.Printf("Timed out publishing ringing message to %s", topic)
+		} else if err := token.Error(); err != nil {
+			log.Printf("Failed to publish ringing message to %s: %v", topic, err)
+		}
+	}()
+	return nil
+}
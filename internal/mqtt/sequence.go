@@ -0,0 +1,46 @@
+package mqtt
+
+import (
+	"context"
+	"fmt"
+)
+
+// SequenceStore persists the publish sequence numbers of the lines, so they
+// continue after a restart of the bridge. Lines are identified by their line
+// key, e.g. "SIP0_1", since line numbers repeat across trunks.
+type SequenceStore interface {
+	LineSequences(ctx context.Context) (map[string]uint64, error)
+	SaveLineSequence(ctx context.Context, lineKey string, sequence uint64) error
+}
+
+// RestoreSequences continues the sequence numbers of the line statuses from
+// the store and saves every further number there
+func (c *Client) RestoreSequences(ctx context.Context, store SequenceStore) error {
+	sequences, err := store.LineSequences(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load line sequences: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for lineKey, sequence := range sequences {
+		c.sequences[lineKey] = max(c.sequences[lineKey], sequence)
+	}
+	c.sequenceStore = store
+	return nil
+}
+
+// nextSequence returns the sequence number of the next line status publish
+// of the line. The number is saved in the background; a number that cannot
+// be saved is still used, the worst case after a restart is a repeated
+// number. c.mu must be held.
+func (c *Client) nextSequence(lineKey string) uint64 {
+	c.sequences[lineKey]++
+	sequence := c.sequences[lineKey]
+	if store := c.sequenceStore; store != nil {
+		c.persister.set("sequence of line "+lineKey, func(ctx context.Context) error {
+			return store.SaveLineSequence(ctx, lineKey, sequence)
+		})
+	}
+	return sequence
+}
@@ -0,0 +1,83 @@
+package mqtt
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// fakeSequenceStore keeps the sequence numbers in memory
+type fakeSequenceStore struct {
+	mu        sync.Mutex
+	sequences map[string]uint64
+	err       error
+}
+
+func (s *fakeSequenceStore) LineSequences(ctx context.Context) (map[string]uint64, error) {
+	return s.sequences, s.err
+}
+
+func (s *fakeSequenceStore) SaveLineSequence(ctx context.Context, lineKey string, sequence uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sequences[lineKey] = sequence
+	return nil
+}
+
+func TestLineSequencesContinueAfterRestart(t *testing.T) {
+	store := &fakeSequenceStore{sequences: map[string]uint64{"SIP0_1": 41}}
+	client := NewClient(Options{ClientID: "test", TopicPrefix: "test"})
+	if err := client.RestoreSequences(context.Background(), store); err != nil {
+		t.Fatalf("RestoreSequences failed: %v", err)
+	}
+	// Pretend to be connected; publishing itself fails without a broker
+	client.connected = true
+
+	for i, event := range []types.CallEvent{
+		{ID: "call-1", Timestamp: time.Now(), Type: types.CallTypeRing, Line: 1, Trunk: "SIP0", Status: types.CallStatusRinging},
+		{ID: "call-2", Timestamp: time.Now(), Type: types.CallTypeCall, Line: 2, Trunk: "SIP0", Status: types.CallStatusCalling},
+		{ID: "call-1", Timestamp: time.Now(), Type: types.CallTypeDisconnect, Line: 1, Trunk: "SIP0", Status: types.CallStatusMissedCall},
+	} {
+		_ = client.PublishCallEvent(context.Background(), event)
+		if i == 0 && client.callStatuses["call-1"].Sequence != 0 {
+			t.Errorf("Expected call status without sequence, got %d", client.callStatuses["call-1"].Sequence)
+		}
+	}
+	_ = client.PublishTimeoutStatusUpdate(1, types.CallStatusIdle)
+
+	if got := client.lineStatuses["SIP0_1"].Sequence; got != 44 {
+		t.Errorf("Expected line 1 at sequence 44, got %d", got)
+	}
+	if got := client.lineStatuses["SIP0_2"].Sequence; got != 1 {
+		t.Errorf("Expected line 2 at sequence 1, got %d", got)
+	}
+	// The same line number on another trunk counts on its own
+	_ = client.PublishCallEvent(context.Background(), types.CallEvent{
+		ID: "call-3", Timestamp: time.Now(), Type: types.CallTypeRing, Line: 1, Trunk: "SIP1", Status: types.CallStatusRinging,
+	})
+	if got := client.lineStatuses["SIP1_1"].Sequence; got != 1 {
+		t.Errorf("Expected line 1 of SIP1 at sequence 1, got %d", got)
+	}
+
+	client.persister.wait()
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.sequences["SIP0_1"] != 44 || store.sequences["SIP0_2"] != 1 || store.sequences["SIP1_1"] != 1 {
+		t.Errorf("Expected saved sequences 44, 1 and 1, got %v", store.sequences)
+	}
+}
+
+func TestRestoreSequencesFailure(t *testing.T) {
+	store := &fakeSequenceStore{err: errors.New("database locked")}
+	client := NewClient(Options{ClientID: "test", TopicPrefix: "test"})
+	if err := client.RestoreSequences(context.Background(), store); err == nil {
+		t.Fatal("Expected an error")
+	}
+	if client.sequenceStore != nil {
+		t.Error("Expected the failing store not to be used")
+	}
+}
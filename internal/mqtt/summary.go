@@ -0,0 +1,174 @@
+package mqtt
+
+import (
+	"context"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/codec"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// SummaryCall is a call as shown by the summary topics, compact enough for
+// simple template sensors, e.g. in Home Assistant
+type SummaryCall struct {
+	ID        string              `json:"id"`
+	Line      int                 `json:"line"`
+	Trunk     string              `json:"trunk,omitempty"`
+	Direction types.CallDirection `json:"direction"`
+	Caller    string              `json:"caller,omitempty"`
+	Called    string              `json:"called,omitempty"`
+	MSNName   string              `json:"msn_name,omitempty"` // Name of the own number of the call
+	Extension string              `json:"extension,omitempty"`
+	Status    types.CallStatus    `json:"status"`
+	Since     time.Time           `json:"since"`              // Start of the call
+	Duration  int                 `json:"duration,omitempty"` // Talk time in seconds, once the call ended
+	Priority  bool                `json:"priority,omitempty"` // Caller is on the VIP list
+}
+
+// ActiveCalls is the payload of the active calls summary topic
+type ActiveCalls struct {
+	Count     int           `json:"count"`
+	Calls     []SummaryCall `json:"calls"` // Oldest first
+	UpdatedAt time.Time     `json:"updated_at"`
+}
+
+// callSummary holds the snapshots of the summary topics; guarded by Client.mu
+type callSummary struct {
+	lastCaller *SummaryCall
+	active     map[string]*SummaryCall // Running calls by call ID
+}
+
+// newCallSummary creates an empty summary
+func newCallSummary() *callSummary {
+	return &callSummary{active: make(map[string]*SummaryCall)}
+}
+
+// update applies a call event and reports whether the last caller changed.
+// Calls of opted-out MSNs/extensions are active calls like on the line
+// status, but never become the last caller.
+func (s *callSummary) update(event types.CallEvent) bool {
+	call, running := s.active[event.ID]
+	if !running {
+		call = &SummaryCall{ID: event.ID, Since: event.Timestamp}
+		s.active[event.ID] = call
+	}
+	call.apply(event)
+	if event.Type == types.CallTypeDisconnect {
+		delete(s.active, event.ID)
+	}
+
+	switch {
+	case event.Type == types.CallTypeRing && event.Direction == types.CallDirectionInbound && !event.DoNotRecord && !event.Internal:
+		last := *call
+		s.lastCaller = &last
+		return true
+	case s.lastCaller != nil && s.lastCaller.ID == event.ID:
+		s.lastCaller.apply(event)
+		return true
+	}
+	return false
+}
+
+// apply copies the values of a call event into the call
+func (call *SummaryCall) apply(event types.CallEvent) {
+	call.Line = event.Line
+	if event.Trunk != "" {
+		call.Trunk = event.Trunk
+	}
+	if event.Direction != "" {
+		call.Direction = event.Direction
+	}
+	if event.Caller != "" {
+		call.Caller = event.Caller
+	}
+	if event.Called != "" {
+		call.Called = event.Called
+	}
+	msnName := event.CalledMSNName
+	if event.Direction == types.CallDirectionOutbound {
+		msnName = event.CallerMSNName
+	}
+	if msnName != "" {
+		call.MSNName = msnName
+	}
+	if event.Extension != "" {
+		call.Extension = event.Extension
+	}
+	if event.Status != "" {
+		call.Status = event.Status
+	}
+	if event.Type == types.CallTypeDisconnect {
+		call.Duration = event.Duration
+	}
+	call.Priority = event.Priority
+}
+
+// activeCalls returns the running calls, oldest first
+func (s *callSummary) activeCalls(now time.Time) ActiveCalls {
+	calls := make([]SummaryCall, 0, len(s.active))
+	for _, call := range s.active {
+		calls = append(calls, *call)
+	}
+	slices.SortFunc(calls, func(a, b SummaryCall) int {
+		if c := a.Since.Compare(b.Since); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+	return ActiveCalls{Count: len(calls), Calls: calls, UpdatedAt: now}
+}
+
+// publishSummary publishes the summary topics changed by a call event. c.mu must be held.
+func (c *Client) publishSummary(ctx context.Context, event types.CallEvent) error {
+	if !enabled(c.publishTopics.Summary) || event.ID == "" {
+		return nil
+	}
+	if c.summary.update(event) {
+		if err := c.publishSummaryTopic(ctx, "summary_last_caller", c.topics.SummaryLastCaller, event.Timestamp, c.summary.lastCaller); err != nil {
+			return err
+		}
+	}
+	return c.publishActiveCalls(ctx)
+}
+
+// publishLastMissed publishes the latest missed call to the last missed summary topic. c.mu must be held.
+func (c *Client) publishLastMissed(ctx context.Context, call types.MissedCall) error {
+	if !enabled(c.publishTopics.Summary) {
+		return nil
+	}
+	return c.publishSummaryTopic(ctx, "summary_last_missed", c.topics.SummaryLastMissed, call.Timestamp, call)
+}
+
+// publishActiveCalls publishes the running calls; c.mu must be held at least for reading
+func (c *Client) publishActiveCalls(ctx context.Context) error {
+	if !enabled(c.publishTopics.Summary) {
+		return nil
+	}
+	now := c.clock.Now()
+	return c.publishSummaryTopic(ctx, "summary_active_calls", c.topics.SummaryActiveCalls, now, c.summary.activeCalls(now))
+}
+
+// publishSummaryTopic publishes a snapshot retained, so it is available to every new subscriber
+func (c *Client) publishSummaryTopic(ctx context.Context, name string, layout *Topic, t time.Time, value any) error {
+	topic, err := c.topic(layout, TopicData{})
+	if err != nil {
+		return err
+	}
+	payload, err := c.encode(name, codec.Message{Kind: "summary." + strings.TrimPrefix(name, "summary_"), Time: t, Value: value})
+	if err != nil {
+		return err
+	}
+	return c.publishWithRetain(ctx, topic, payload, true)
+}
+
+// republishActiveCalls replaces the active calls retained by an earlier run after connecting
+func (c *Client) republishActiveCalls(ctx context.Context) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if err := c.publishActiveCalls(ctx); err != nil {
+		log.Printf("Failed to publish active calls: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/broker"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// decodeSummary unmarshals the value of a summary message
+func decodeSummary(t *testing.T, msg broker.Message, value any) {
+	t.Helper()
+	if err := json.Unmarshal(msg.Payload, value); err != nil {
+		t.Fatalf("Invalid payload on %s: %v", msg.Topic, err)
+	}
+}
+
+func TestCallSummary(t *testing.T) {
+	summary := newCallSummary()
+	start := time.Date(2025, 9, 21, 15, 35, 0, 0, time.UTC)
+
+	ring := types.CallEvent{
+		ID: "call-1", Timestamp: start, Type: types.CallTypeRing, Line: 0, Trunk: "SIP0", Direction: types.CallDirectionInbound,
+		Caller: "+4930123456", Called: "+4930990133", CalledMSNName: "Office", Status: types.CallStatusRinging,
+	}
+	if !summary.update(ring) {
+		t.Fatal("Expected an inbound RING to change the last caller")
+	}
+	outbound := types.CallEvent{
+		ID: "call-2", Timestamp: start.Add(time.Second), Type: types.CallTypeCall, Line: 1, Direction: types.CallDirectionOutbound,
+		Caller: "+4930990134", Called: "+4930555555", CallerMSNName: "Home", Status: types.CallStatusCalling,
+	}
+	if summary.update(outbound) {
+		t.Error("Expected an outbound call not to change the last caller")
+	}
+	private := ring
+	private.ID, private.Line, private.Timestamp, private.DoNotRecord = "call-3", 2, start.Add(2*time.Second), true
+	if summary.update(private) {
+		t.Error("Expected an opted-out call not to become the last caller")
+	}
+
+	active := summary.activeCalls(start)
+	if active.Count != 3 || active.Calls[0].ID != "call-1" || active.Calls[1].MSNName != "Home" {
+		t.Errorf("Expected 3 active calls oldest first, got %+v", active)
+	}
+
+	connect := ring
+	connect.Type, connect.Status, connect.Extension = types.CallTypeConnect, types.CallStatusTalking, "1"
+	disconnect := connect
+	disconnect.Type, disconnect.Status, disconnect.Duration = types.CallTypeDisconnect, types.CallStatusFinished, 42
+	for _, event := range []types.CallEvent{connect, disconnect} {
+		if !summary.update(event) {
+			t.Errorf("Expected %s of the last caller to update it", event.Type)
+		}
+	}
+	if last := summary.lastCaller; last.Status != types.CallStatusFinished || last.Duration != 42 || last.Extension != "1" || last.MSNName != "Office" {
+		t.Errorf("Expected the finished last call, got %+v", last)
+	}
+	if active := summary.activeCalls(start); active.Count != 2 {
+		t.Errorf("Expected the finished call to leave the active calls, got %+v", active)
+	}
+}
+
+func TestPublishSummary(t *testing.T) {
+	b, host, port := startTestBroker(t)
+	messages := subscribeAll(t, b)
+
+	client := newTestClient(t, host, port, Options{QoS: 1, Retain: true})
+	// The active calls of an earlier run are replaced on connect
+	var active ActiveCalls
+	decodeSummary(t, waitForMessage(t, messages, "test/summary/active_calls"), &active)
+	if active.Count != 0 || active.Calls == nil {
+		t.Errorf("Expected an empty list of active calls, got %+v", active)
+	}
+
+	ring := types.CallEvent{
+		ID: "summary-1", Timestamp: time.Now(), Type: types.CallTypeRing, Line: 0, Trunk: "SIP0", Direction: types.CallDirectionInbound,
+		Caller: "+4930123456", Called: "+4930990133", Status: types.CallStatusRinging,
+	}
+	disconnect := ring
+	disconnect.Type = types.CallTypeDisconnect
+	disconnect.Status = types.CallStatusMissedCall
+
+	if err := client.PublishCallEvent(context.Background(), ring); err != nil {
+		t.Fatalf("PublishCallEvent failed: %v", err)
+	}
+	var last SummaryCall
+	decodeSummary(t, waitForMessage(t, messages, "test/summary/last_caller"), &last)
+	if last.ID != "summary-1" || last.Caller != "+4930123456" || last.Status != types.CallStatusRinging {
+		t.Errorf("Expected the ringing caller, got %+v", last)
+	}
+	decodeSummary(t, waitForMessage(t, messages, "test/summary/active_calls"), &active)
+	if active.Count != 1 || active.Calls[0].ID != "summary-1" {
+		t.Errorf("Expected the ringing call to be active, got %+v", active)
+	}
+
+	if err := client.PublishCallEvent(context.Background(), disconnect); err != nil {
+		t.Fatalf("PublishCallEvent failed: %v", err)
+	}
+	var missed types.MissedCall
+	decodeSummary(t, waitForMessage(t, messages, "test/summary/last_missed"), &missed)
+	if missed.Caller.PhoneNumber != "+4930123456" {
+		t.Errorf("Expected the missed caller, got %+v", missed)
+	}
+	decodeSummary(t, waitForMessage(t, messages, "test/summary/last_caller"), &last)
+	if last.Status != types.CallStatusMissedCall {
+		t.Errorf("Expected the last caller to be missed, got %+v", last)
+	}
+	decodeSummary(t, waitForMessage(t, messages, "test/summary/active_calls"), &active)
+	if active.Count != 0 {
+		t.Errorf("Expected no active calls, got %+v", active)
+	}
+}
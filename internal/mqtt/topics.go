@@ -0,0 +1,319 @@
+package mqtt
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// TopicData holds the values available in topic templates
+type TopicData struct {
+	Prefix    string              // Configured topic prefix
+	Box       string              // Name of the Fritz!Box, the configured host by default
+	Line      int                 // Line ID
+	Trunk     string              // SIP line ID
+	MSN       string              // Configured MSN of the local party, empty if none matched
+	Type      types.CallType      // Type of the last call event
+	Direction types.CallDirection // Call direction
+	ID        string              // Call ID
+	Recipient string              // Recipient of a notification rule
+}
+
+// TopicTemplates are the text/template layouts of all published topics.
+// Empty fields use the layout of DefaultTopicTemplates.
+type TopicTemplates struct {
+	Status            string
+	FritzBoxStatus    string
+	LineStatus        string
+	LineLastEvent     string
+	LineElapsed       string
+	Ringing           string
+	VIPRing           string
+	Call              string
+	CallCompleted     string
+	MissedCall        string
+	MissedCalls       string
+	History           string
+	FSMStatus         string
+	FSMStatusChange   string
+	DND               string
+	DNDCommand        string
+	MissedCallAck     string
+	ReloadCommand     string
+	CallQuery         string
+	CallQueryResponse string
+	Profile           string
+	ProfileCommand    string
+	Notification      string
+	Error             string
+	Unparsed          string
+	DatabaseHealth    string
+	ACLTest           string
+	Incident          string
+	Metrics           string
+	Description       string
+
+	SummaryLastCaller  string
+	SummaryLastMissed  string
+	SummaryActiveCalls string
+}
+
+// DefaultTopicTemplates returns the built-in topic layout
+func DefaultTopicTemplates() TopicTemplates {
+	return TopicTemplates{
+		Status:            "{{.Prefix}}/status",
+		FritzBoxStatus:    "{{.Prefix}}/fritzbox/status",
+		LineStatus:        "{{.Prefix}}/line/{{.Line}}/status",
+		LineLastEvent:     "{{.Prefix}}/line/{{.Line}}/last_event",
+		LineElapsed:       "{{.Prefix}}/line/{{.Line}}/elapsed",
+		Ringing:           "{{.Prefix}}/line/{{.Line}}/ringing",
+		VIPRing:           "{{.Prefix}}/vip_ring",
+		Call:              "{{.Prefix}}/call/{{.ID}}",
+		CallCompleted:     "{{.Prefix}}/calls/completed",
+		MissedCall:        "{{.Prefix}}/missed_call",
+		MissedCalls:       "{{.Prefix}}/missed_calls",
+		History:           "{{.Prefix}}/history",
+		FSMStatus:         "{{.Prefix}}/fsm/line/{{.Line}}/status",
+		FSMStatusChange:   "{{.Prefix}}/fsm/line/{{.Line}}/status_change",
+		DND:               "{{.Prefix}}/dnd",
+		DNDCommand:        "{{.Prefix}}/command/dnd",
+		MissedCallAck:     "{{.Prefix}}/command/missed_call_ack",
+		ReloadCommand:     "{{.Prefix}}/command/reload",
+		CallQuery:         "{{.Prefix}}/query/calls",
+		CallQueryResponse: "{{.Prefix}}/query/calls/response/{{.ID}}",
+		Profile:           "{{.Prefix}}/profile",
+		ProfileCommand:    "{{.Prefix}}/command/profile",
+		Notification:      "{{.Prefix}}/notify/{{.Recipient}}",
+		Error:             "{{.Prefix}}/error",
+		Unparsed:          "{{.Prefix}}/debug/unparsed",
+		DatabaseHealth:    "{{.Prefix}}/debug/db",
+		ACLTest:           "{{.Prefix}}/debug/acl_test",
+		Incident:          "{{.Prefix}}/incident",
+		Metrics:           "{{.Prefix}}/metrics",
+		Description:       "{{.Prefix}}/$topics",
+
+		SummaryLastCaller:  "{{.Prefix}}/summary/last_caller",
+		SummaryLastMissed:  "{{.Prefix}}/summary/last_missed",
+		SummaryActiveCalls: "{{.Prefix}}/summary/active_calls",
+	}
+}
+
+// withDefaults fills unset fields from DefaultTopicTemplates
+func (t TopicTemplates) withDefaults() TopicTemplates {
+	defaults := DefaultTopicTemplates()
+	fallbacks := topicRegistry(&defaults, &Topics{})
+	for i, entry := range topicRegistry(&t, &Topics{}) {
+		if *entry.layout == "" {
+			*entry.layout = *fallbacks[i].layout
+		}
+	}
+	return t
+}
+
+// UsingMSN returns the names of the topics whose layout contains the MSN
+func (t TopicTemplates) UsingMSN() []string {
+	var names []string
+	for _, entry := range topicRegistry(&t, &Topics{}) {
+		if strings.Contains(*entry.layout, ".MSN") {
+			names = append(names, entry.name)
+		}
+	}
+	return names
+}
+
+// Topic is a parsed topic template
+type Topic struct {
+	tmpl *template.Template
+}
+
+// Render builds the topic for the given data
+func (t *Topic) Render(data TopicData) (string, error) {
+	var sb strings.Builder
+	if err := t.tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("failed to render topic %s: %w", t.tmpl.Name(), err)
+	}
+
+	topic := sb.String()
+	if topic == "" {
+		return "", fmt.Errorf("topic %s rendered empty", t.tmpl.Name())
+	}
+	if strings.ContainsAny(topic, "+#\x00") {
+		return "", fmt.Errorf("topic %s contains wildcard or NUL characters: %q", t.tmpl.Name(), topic)
+	}
+	return topic, nil
+}
+
+// Topics holds the parsed templates of all published topics
+type Topics struct {
+	Status            *Topic
+	FritzBoxStatus    *Topic
+	LineStatus        *Topic
+	LineLastEvent     *Topic
+	LineElapsed       *Topic
+	Ringing           *Topic
+	VIPRing           *Topic
+	Call              *Topic
+	CallCompleted     *Topic
+	MissedCall        *Topic
+	MissedCalls       *Topic
+	History           *Topic
+	FSMStatus         *Topic
+	FSMStatusChange   *Topic
+	DND               *Topic
+	DNDCommand        *Topic
+	MissedCallAck     *Topic
+	ReloadCommand     *Topic
+	CallQuery         *Topic
+	CallQueryResponse *Topic
+	Profile           *Topic
+	ProfileCommand    *Topic
+	Notification      *Topic
+	Error             *Topic
+	Unparsed          *Topic
+	DatabaseHealth    *Topic
+	ACLTest           *Topic
+	Incident          *Topic
+	Metrics           *Topic
+	Description       *Topic
+
+	SummaryLastCaller  *Topic
+	SummaryLastMissed  *Topic
+	SummaryActiveCalls *Topic
+}
+
+// ParseTopics parses the templates and checks that each renders a valid topic
+func ParseTopics(templates TopicTemplates) (*Topics, error) {
+	templates = templates.withDefaults()
+
+	topics := &Topics{}
+	sample := TopicData{Prefix: "prefix", Box: "box", Line: 1, Trunk: "SIP0", MSN: "123456", Type: types.CallTypeRing, Direction: types.CallDirectionInbound, ID: "id", Recipient: "recipient"}
+	for _, f := range topicRegistry(&templates, topics) {
+		tmpl, err := template.New(f.name).Option("missingkey=error").Parse(*f.layout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s topic template: %w", f.name, err)
+		}
+		topic := &Topic{tmpl: tmpl}
+		if _, err := topic.Render(sample); err != nil {
+			return nil, fmt.Errorf("invalid %s topic template: %w", f.name, err)
+		}
+		*f.topic = topic
+	}
+
+	return topics, nil
+}
+
+// DefaultTopics returns the parsed built-in topic layout
+func DefaultTopics() *Topics {
+	topics, err := ParseTopics(DefaultTopicTemplates())
+	if err != nil {
+		panic(err)
+	}
+	return topics
+}
+
+// topicDataForEvent returns the template values of a call event
+func topicDataForEvent(event types.CallEvent) TopicData {
+	msn := event.CalledMSN
+	if event.Direction == types.CallDirectionOutbound {
+		msn = event.CallerMSN
+	}
+	return TopicData{
+		Line:      event.Line,
+		Trunk:     event.Trunk,
+		MSN:       msn,
+		Type:      event.Type,
+		Direction: event.Direction,
+		ID:        event.ID,
+	}
+}
+
+// TopicRetain overrides the retain flag per topic. Nil fields use
+// Options.Retain, except MissedCall which is not retained by default since
+// the notification would be replayed on every subscribe.
+type TopicRetain struct {
+	Status          *bool
+	LineStatus      *bool
+	LineLastEvent   *bool
+	Call            *bool
+	MissedCall      *bool
+	MissedCalls     *bool
+	History         *bool
+	FSMStatus       *bool
+	FSMStatusChange *bool
+}
+
+// TopicEnabled switches the publishing of single topics. Nil fields publish
+// the topic, except FSM which covers fsm_status and fsm_status_change and
+// publishes them only at debug log level.
+type TopicEnabled struct {
+	LineStatus    *bool
+	LineLastEvent *bool
+	Call          *bool
+	History       *bool
+	FSM           *bool
+	Summary       *bool // summary_last_caller, summary_last_missed and summary_active_calls
+}
+
+// enabled reports whether a topic is published; nil keeps the default of publishing it
+func enabled(override *bool) bool {
+	return override == nil || *override
+}
+
+// topicEnabled reports whether a topic of the registry is published. The FSM
+// topics stay in the description unless switched off, as the log level
+// deciding about them can change at runtime.
+func (c *Client) topicEnabled(name string) bool {
+	switch name {
+	case "line_status":
+		return enabled(c.publishTopics.LineStatus)
+	case "line_last_event":
+		return enabled(c.publishTopics.LineLastEvent)
+	case "call":
+		return enabled(c.publishTopics.Call)
+	case "history":
+		return enabled(c.publishTopics.History)
+	case "fsm_status", "fsm_status_change":
+		return enabled(c.publishTopics.FSM)
+	case "summary_last_caller", "summary_last_missed", "summary_active_calls":
+		return enabled(c.publishTopics.Summary)
+	case "acl_test":
+		return c.aclSelfTest
+	}
+	return true
+}
+
+// retainFlags are the resolved retain flags of all topics
+type retainFlags struct {
+	Status          bool
+	LineStatus      bool
+	LineLastEvent   bool
+	Call            bool
+	MissedCall      bool
+	MissedCalls     bool
+	History         bool
+	FSMStatus       bool
+	FSMStatusChange bool
+}
+
+// resolve applies the overrides to the global retain flag
+func (r TopicRetain) resolve(retain bool) retainFlags {
+	pick := func(override *bool, fallback bool) bool {
+		if override != nil {
+			return *override
+		}
+		return fallback
+	}
+	return retainFlags{
+		Status:          pick(r.Status, retain),
+		LineStatus:      pick(r.LineStatus, retain),
+		LineLastEvent:   pick(r.LineLastEvent, retain),
+		Call:            pick(r.Call, retain),
+		MissedCall:      pick(r.MissedCall, false),
+		MissedCalls:     pick(r.MissedCalls, retain),
+		History:         pick(r.History, retain),
+		FSMStatus:       pick(r.FSMStatus, retain),
+		FSMStatusChange: pick(r.FSMStatusChange, retain),
+	}
+}
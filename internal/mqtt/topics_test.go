@@ -0,0 +1,111 @@
+package mqtt
+
+import (
+	"testing"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+func TestDefaultTopics(t *testing.T) {
+	topics := DefaultTopics()
+	data := TopicData{Prefix: "fritz/callmonitor", Line: 2, ID: "abc", Recipient: "anna"}
+
+	tests := []struct {
+		name     string
+		topic    *Topic
+		expected string
+	}{
+		{"status", topics.Status, "fritz/callmonitor/status"},
+		{"line status", topics.LineStatus, "fritz/callmonitor/line/2/status"},
+		{"line last event", topics.LineLastEvent, "fritz/callmonitor/line/2/last_event"},
+		{"ringing", topics.Ringing, "fritz/callmonitor/line/2/ringing"},
+		{"call", topics.Call, "fritz/callmonitor/call/abc"},
+		{"missed call", topics.MissedCall, "fritz/callmonitor/missed_call"},
+		{"missed calls", topics.MissedCalls, "fritz/callmonitor/missed_calls"},
+		{"fsm status", topics.FSMStatus, "fritz/callmonitor/fsm/line/2/status"},
+		{"fsm status change", topics.FSMStatusChange, "fritz/callmonitor/fsm/line/2/status_change"},
+		{"dnd", topics.DND, "fritz/callmonitor/dnd"},
+		{"dnd command", topics.DNDCommand, "fritz/callmonitor/command/dnd"},
+		{"notification", topics.Notification, "fritz/callmonitor/notify/anna"},
+		{"error", topics.Error, "fritz/callmonitor/error"},
+		{"unparsed", topics.Unparsed, "fritz/callmonitor/debug/unparsed"},
+		{"description", topics.Description, "fritz/callmonitor/$topics"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.topic.Render(data)
+			if err != nil {
+				t.Fatalf("Render failed: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("Expected topic %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCustomTopics(t *testing.T) {
+	topics, err := ParseTopics(TopicTemplates{
+		LineStatus: "{{.Prefix}}/{{.Box}}/line/{{.Line}}/status",
+		Call:       "home/phone/{{.Direction}}/{{if .MSN}}{{.MSN}}{{else}}unknown{{end}}/{{.Type}}",
+	})
+	if err != nil {
+		t.Fatalf("ParseTopics failed: %v", err)
+	}
+
+	event := types.CallEvent{
+		ID:        "abc",
+		Type:      types.CallTypeRing,
+		Direction: types.CallDirectionInbound,
+		Line:      1,
+		CalledMSN: "990133",
+		CallerMSN: "12345",
+	}
+	data := topicDataForEvent(event)
+	data.Prefix = "fritz"
+	data.Box = "fritz.box"
+
+	if got, _ := topics.LineStatus.Render(data); got != "fritz/fritz.box/line/1/status" {
+		t.Errorf("Unexpected line status topic %q", got)
+	}
+	if got, _ := topics.Call.Render(data); got != "home/phone/inbound/990133/ring" {
+		t.Errorf("Unexpected call topic %q", got)
+	}
+
+	// Unset templates keep the built-in layout
+	if got, _ := topics.Status.Render(data); got != "fritz/status" {
+		t.Errorf("Unexpected status topic %q", got)
+	}
+}
+
+func TestTopicsUsingMSN(t *testing.T) {
+	if names := DefaultTopicTemplates().UsingMSN(); len(names) != 0 {
+		t.Errorf("Expected no default topic to use the MSN, got %v", names)
+	}
+
+	templates := TopicTemplates{Call: "{{.Prefix}}/{{.MSN}}/call/{{.ID}}", Ringing: "{{.Prefix}}/ringing/{{.MSN}}"}
+	if names := templates.UsingMSN(); len(names) != 2 || names[0] != "ringing" || names[1] != "call" {
+		t.Errorf("Expected ringing and call to use the MSN, got %v", names)
+	}
+}
+
+func TestParseTopicsRejectsInvalidTemplates(t *testing.T) {
+	tests := []struct {
+		name      string
+		templates TopicTemplates
+	}{
+		{"syntax error", TopicTemplates{Status: "{{.Prefix/status"}},
+		{"unknown field", TopicTemplates{LineStatus: "{{.Prefix}}/{{.Extension}}"}},
+		{"wildcard", TopicTemplates{Call: "{{.Prefix}}/call/#"}},
+		{"empty result", TopicTemplates{MissedCall: "{{if false}}x{{end}}"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseTopics(tt.templates); err == nil {
+				t.Error("Expected ParseTopics to fail")
+			}
+		})
+	}
+}
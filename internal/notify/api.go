@@ -0,0 +1,154 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/database"
+)
+
+// RulesPath is the base path of the notification rules API
+const RulesPath = "/api/notification-rules"
+
+// Store provides read and write access to the notification rules
+type Store interface {
+	RuleStore
+	GetNotificationRule(ctx context.Context, id int64) (database.NotificationRule, error)
+	CreateNotificationRule(ctx context.Context, rule database.NotificationRule) (database.NotificationRule, error)
+	UpdateNotificationRule(ctx context.Context, rule database.NotificationRule) (database.NotificationRule, error)
+	DeleteNotificationRule(ctx context.Context, id int64) error
+}
+
+// errorResponse is the JSON body of failed requests
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// NewHandler returns the REST API for notification rules:
+//
+//	GET    /api/notification-rules       list all rules
+//	POST   /api/notification-rules       create a rule
+//	GET    /api/notification-rules/{id}  get a rule
+//	PUT    /api/notification-rules/{id}  replace a rule
+//	DELETE /api/notification-rules/{id}  delete a rule
+func NewHandler(store Store) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET "+RulesPath, func(w http.ResponseWriter, r *http.Request) {
+		rules, err := store.ListNotificationRules(r.Context())
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, rules)
+	})
+
+	mux.HandleFunc("POST "+RulesPath, func(w http.ResponseWriter, r *http.Request) {
+		rule, ok := decodeRule(w, r)
+		if !ok {
+			return
+		}
+		created, err := store.CreateNotificationRule(r.Context(), rule)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Location", RulesPath+"/"+strconv.FormatInt(created.ID, 10))
+		writeJSON(w, http.StatusCreated, created)
+	})
+
+	mux.HandleFunc("GET "+RulesPath+"/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, ok := ruleID(w, r)
+		if !ok {
+			return
+		}
+		rule, err := store.GetNotificationRule(r.Context(), id)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, rule)
+	})
+
+	mux.HandleFunc("PUT "+RulesPath+"/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, ok := ruleID(w, r)
+		if !ok {
+			return
+		}
+		rule, ok := decodeRule(w, r)
+		if !ok {
+			return
+		}
+		rule.ID = id
+		updated, err := store.UpdateNotificationRule(r.Context(), rule)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, updated)
+	})
+
+	mux.HandleFunc("DELETE "+RulesPath+"/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, ok := ruleID(w, r)
+		if !ok {
+			return
+		}
+		if err := store.DeleteNotificationRule(r.Context(), id); err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return mux
+}
+
+// ruleID parses the {id} path value, answering 400 if it is invalid
+func ruleID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid rule ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// decodeRule reads a rule from the request body and validates it, answering 400 if it is invalid.
+// Rules are enabled unless the body says otherwise.
+func decodeRule(w http.ResponseWriter, r *http.Request) (database.NotificationRule, bool) {
+	rule := database.NotificationRule{Enabled: true}
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&rule); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid JSON: " + err.Error()})
+		return database.NotificationRule{}, false
+	}
+	if err := rule.Validate(); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return database.NotificationRule{}, false
+	}
+	return rule, true
+}
+
+// writeError answers 404 for unknown rules and 500 otherwise
+func writeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, database.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+		return
+	}
+	log.Printf("Notification rules API error: %v", err)
+	writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "internal error"})
+}
+
+// writeJSON writes value as JSON with the given status code
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Printf("Failed to write notification rules response: %v", err)
+	}
+}
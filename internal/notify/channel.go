@@ -0,0 +1,58 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Message is the text sent through a channel
+type Message struct {
+	Title string
+	Text  string
+}
+
+// Channel delivers messages to a push service, e.g. Telegram or ntfy
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, msg Message) error
+}
+
+// defaultTimeout bounds a single request to a push service
+const defaultTimeout = 10 * time.Second
+
+// httpClientOrDefault returns client, or a client with the default timeout if it is nil
+func httpClientOrDefault(client *http.Client) *http.Client {
+	if client == nil {
+		return &http.Client{Timeout: defaultTimeout}
+	}
+	return client
+}
+
+// send performs the request and turns a non-2xx response into an error
+func send(client *http.Client, req *http.Request, service string) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send %s message: %w", service, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s message rejected with HTTP %d: %s", service, resp.StatusCode, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+// newRequest creates a POST request with the given body and content type
+func newRequest(ctx context.Context, url string, body io.Reader, contentType string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	return req, nil
+}
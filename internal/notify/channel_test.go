@@ -0,0 +1,89 @@
+package notify
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// capturedRequest is the last request received by a test server
+type capturedRequest struct {
+	path   string
+	header http.Header
+	body   string
+}
+
+// newServer returns a test server answering with status and the captured request
+func newServer(t *testing.T, status int) (*httptest.Server, *capturedRequest) {
+	t.Helper()
+
+	captured := &capturedRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		*captured = capturedRequest{path: r.URL.Path, header: r.Header, body: string(body)}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte("rejected"))
+	}))
+	t.Cleanup(server.Close)
+	return server, captured
+}
+
+func TestChannels(t *testing.T) {
+	msg := Message{Title: "Missed call", Text: "From +4930123456 at 12:15"}
+
+	t.Run("telegram", func(t *testing.T) {
+		server, captured := newServer(t, http.StatusOK)
+		channel := NewTelegram(TelegramOptions{Token: "123:abc", ChatID: "-10042", BaseURL: server.URL})
+		if err := channel.Send(context.Background(), msg); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+		form, _ := url.ParseQuery(captured.body)
+		if captured.path != "/bot123:abc/sendMessage" || form.Get("chat_id") != "-10042" {
+			t.Errorf("Unexpected request to %s: %v", captured.path, form)
+		}
+		if want := "Missed call\nFrom +4930123456 at 12:15"; form.Get("text") != want {
+			t.Errorf("Expected text %q, got %q", want, form.Get("text"))
+		}
+	})
+
+	t.Run("pushover", func(t *testing.T) {
+		server, captured := newServer(t, http.StatusOK)
+		channel := NewPushover(PushoverOptions{Token: "app", User: "user", BaseURL: server.URL})
+		if err := channel.Send(context.Background(), msg); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+		form, _ := url.ParseQuery(captured.body)
+		if captured.path != "/1/messages.json" || form.Get("token") != "app" || form.Get("user") != "user" {
+			t.Errorf("Unexpected request to %s: %v", captured.path, form)
+		}
+		if form.Get("title") != msg.Title || form.Get("message") != msg.Text {
+			t.Errorf("Expected title and message of %+v, got %v", msg, form)
+		}
+	})
+
+	t.Run("ntfy", func(t *testing.T) {
+		server, captured := newServer(t, http.StatusOK)
+		channel := NewNtfy(NtfyOptions{URL: server.URL + "/", Topic: "fritz-calls", Token: "tk_secret"})
+		if err := channel.Send(context.Background(), msg); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+		if captured.path != "/fritz-calls" || captured.body != msg.Text {
+			t.Errorf("Unexpected request to %s: %q", captured.path, captured.body)
+		}
+		if captured.header.Get("Title") != msg.Title || captured.header.Get("Authorization") != "Bearer tk_secret" {
+			t.Errorf("Unexpected headers %v", captured.header)
+		}
+	})
+
+	t.Run("rejected", func(t *testing.T) {
+		server, _ := newServer(t, http.StatusUnauthorized)
+		err := NewNtfy(NtfyOptions{URL: server.URL, Topic: "fritz-calls"}).Send(context.Background(), msg)
+		if err == nil || !strings.Contains(err.Error(), "HTTP 401: rejected") {
+			t.Errorf("Expected the rejection as error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,244 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// Trigger is a kind of call that is pushed to the channels
+type Trigger string
+
+const (
+	TriggerMissedCall Trigger = "missed_call" // Inbound call nobody answered
+	TriggerVIP        Trigger = "vip"         // Any inbound call from a VIP number
+	TriggerLongCall   Trigger = "long_call"   // Call that talked at least the long call duration
+)
+
+// ParseTriggers parses trigger names, e.g. from configuration
+func ParseTriggers(names []string) ([]Trigger, error) {
+	triggers := make([]Trigger, 0, len(names))
+	for _, name := range names {
+		trigger := Trigger(strings.TrimSpace(name))
+		switch trigger {
+		case TriggerMissedCall, TriggerVIP, TriggerLongCall:
+			triggers = append(triggers, trigger)
+		default:
+			return nil, fmt.Errorf("invalid notification trigger '%s'", name)
+		}
+	}
+	return triggers, nil
+}
+
+// DefaultTitleTemplate and DefaultMessageTemplate are used when no template is configured
+const (
+	DefaultTitleTemplate   = `{{if eq .Trigger "missed_call"}}Missed call{{else if eq .Trigger "vip"}}Call from {{.Contact}}{{else}}Long call{{end}}`
+	DefaultMessageTemplate = `{{if eq .Call.Direction "outbound"}}To{{else}}From{{end}} {{.Contact}} at {{.Time}}{{if .Duration}}, talked {{.Duration}}{{end}}`
+)
+
+// MessageData is passed to the title and message templates
+type MessageData struct {
+	Trigger  Trigger         // Trigger that matched the call
+	Number   string          // Number of the remote party
+	Contact  string          // VIP name of the number, the number itself, or "unknown number"
+	Time     string          // Start of the call as HH:MM in the configured time zone
+	Duration string          // Talk time, e.g. 12m5s; empty for calls that were not answered
+	Call     types.CallEvent // Disconnect event of the finished call
+}
+
+// Dispatcher is a call event sink that pushes finished calls matching one of
+// its triggers to all channels. A call matching several triggers is sent once,
+// for the first matching trigger in configured order.
+type Dispatcher struct {
+	channels []Channel
+	rules    atomic.Pointer[dispatchRules] // Replaced as a whole by UpdateRules
+}
+
+// dispatchRules decide which calls are pushed and how they are worded
+type dispatchRules struct {
+	triggers []Trigger
+	vips     map[string]string
+	longCall time.Duration
+	location *time.Location
+	title    *template.Template
+	message  *template.Template
+}
+
+// DispatcherOptions configures a dispatcher
+type DispatcherOptions struct {
+	Channels        []Channel
+	Triggers        []Trigger         // Calls that are pushed (default: missed calls)
+	VIPs            map[string]string // Names of VIP numbers, normalized as published
+	LongCall        time.Duration     // Minimum talk time of a long call (default: 30m)
+	Location        *time.Location    // Time zone of the call time (default: local)
+	TitleTemplate   string            // text/template of the title (default: DefaultTitleTemplate)
+	MessageTemplate string            // text/template of the message (default: DefaultMessageTemplate)
+}
+
+// DefaultDispatcherOptions returns the options used when nothing else is configured
+func DefaultDispatcherOptions() DispatcherOptions {
+	return DispatcherOptions{
+		Triggers:        []Trigger{TriggerMissedCall},
+		LongCall:        30 * time.Minute,
+		Location:        time.Local,
+		TitleTemplate:   DefaultTitleTemplate,
+		MessageTemplate: DefaultMessageTemplate,
+	}
+}
+
+// withDefaults fills unset fields from DefaultDispatcherOptions
+func (o DispatcherOptions) withDefaults() DispatcherOptions {
+	defaults := DefaultDispatcherOptions()
+	if len(o.Triggers) == 0 {
+		o.Triggers = defaults.Triggers
+	}
+	if o.LongCall <= 0 {
+		o.LongCall = defaults.LongCall
+	}
+	if o.Location == nil {
+		o.Location = defaults.Location
+	}
+	if o.TitleTemplate == "" {
+		o.TitleTemplate = defaults.TitleTemplate
+	}
+	if o.MessageTemplate == "" {
+		o.MessageTemplate = defaults.MessageTemplate
+	}
+	return o
+}
+
+// NewDispatcher creates a dispatcher; it fails if a template does not parse
+func NewDispatcher(opts DispatcherOptions) (*Dispatcher, error) {
+	d := &Dispatcher{channels: opts.Channels}
+	if err := d.UpdateRules(opts); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// UpdateRules replaces the triggers, VIPs, long call duration, time zone and
+// templates of the options at once; the channels stay those of NewDispatcher.
+// On error the previous rules are kept.
+func (d *Dispatcher) UpdateRules(opts DispatcherOptions) error {
+	opts = opts.withDefaults()
+
+	title, err := template.New("title").Parse(opts.TitleTemplate)
+	if err != nil {
+		return fmt.Errorf("invalid notification title template: %w", err)
+	}
+	message, err := template.New("message").Parse(opts.MessageTemplate)
+	if err != nil {
+		return fmt.Errorf("invalid notification message template: %w", err)
+	}
+
+	d.rules.Store(&dispatchRules{
+		triggers: opts.Triggers,
+		vips:     opts.VIPs,
+		longCall: opts.LongCall,
+		location: opts.Location,
+		title:    title,
+		message:  message,
+	})
+	return nil
+}
+
+// PublishCallEvent pushes finished calls matching a trigger to all channels.
+// Calls of opted-out MSNs are skipped, like missed call notifications.
+func (d *Dispatcher) PublishCallEvent(ctx context.Context, event types.CallEvent) error {
+	if event.Type != types.CallTypeDisconnect || event.DoNotRecord {
+		return nil
+	}
+	rules := d.rules.Load()
+	trigger, ok := rules.match(event)
+	if !ok {
+		return nil
+	}
+
+	msg, err := rules.render(trigger, event)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, channel := range d.channels {
+		if err := channel.Send(ctx, msg); err != nil {
+			errs = append(errs, fmt.Errorf("failed to notify via %s: %w", channel.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Match returns the first configured trigger matching the finished call
+func (d *Dispatcher) Match(event types.CallEvent) (Trigger, bool) {
+	return d.rules.Load().match(event)
+}
+
+// match returns the first trigger of the rules matching the finished call
+func (r *dispatchRules) match(event types.CallEvent) (Trigger, bool) {
+	inbound := event.Direction == types.CallDirectionInbound
+	for _, trigger := range r.triggers {
+		switch trigger {
+		case TriggerMissedCall:
+			if inbound && event.FinishState != nil && *event.FinishState == types.CallStatusMissedCall {
+				return trigger, true
+			}
+		case TriggerVIP:
+			if _, vip := r.vips[event.Caller]; inbound && vip {
+				return trigger, true
+			}
+		case TriggerLongCall:
+			if event.Duration > 0 && time.Duration(event.Duration)*time.Second >= r.longCall {
+				return trigger, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Render executes the templates for a call
+func (d *Dispatcher) Render(trigger Trigger, event types.CallEvent) (Message, error) {
+	return d.rules.Load().render(trigger, event)
+}
+
+// render executes the templates of the rules for a call
+func (r *dispatchRules) render(trigger Trigger, event types.CallEvent) (Message, error) {
+	number := event.Caller
+	if event.Direction == types.CallDirectionOutbound {
+		number = event.Called
+	}
+	contact := r.vips[number]
+	switch {
+	case contact != "":
+	case number != "":
+		contact = number
+	default:
+		contact = "unknown number"
+	}
+
+	data := MessageData{
+		Trigger: trigger,
+		Number:  number,
+		Contact: contact,
+		Call:    event,
+	}
+	if event.Duration > 0 {
+		data.Duration = (time.Duration(event.Duration) * time.Second).String()
+	}
+	start := event.Timestamp.Add(-time.Duration(event.Duration) * time.Second)
+	data.Time = start.In(r.location).Format("15:04")
+
+	var title, message strings.Builder
+	if err := r.title.Execute(&title, data); err != nil {
+		return Message{}, fmt.Errorf("failed to render notification title: %w", err)
+	}
+	if err := r.message.Execute(&message, data); err != nil {
+		return Message{}, fmt.Errorf("failed to render notification message: %w", err)
+	}
+	return Message{Title: strings.TrimSpace(title.String()), Text: strings.TrimSpace(message.String())}, nil
+}
@@ -0,0 +1,197 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// recordingChannel records the sent messages and fails if err is set
+type recordingChannel struct {
+	messages []Message
+	err      error
+}
+
+func (c *recordingChannel) Name() string { return "recording" }
+
+func (c *recordingChannel) Send(_ context.Context, msg Message) error {
+	c.messages = append(c.messages, msg)
+	return c.err
+}
+
+// disconnect returns the disconnect event of a call
+func disconnect(direction types.CallDirection, caller, called string, finish types.CallStatus, duration int) types.CallEvent {
+	return types.CallEvent{
+		ID:          "0199a8c4-0000-7000-8000-000000000001",
+		Timestamp:   time.Date(2025, 9, 20, 12, 15, 0, 0, time.UTC).Add(time.Duration(duration) * time.Second),
+		Type:        types.CallTypeDisconnect,
+		Direction:   direction,
+		Caller:      caller,
+		Called:      called,
+		Duration:    duration,
+		FinishState: &finish,
+	}
+}
+
+func TestParseTriggers(t *testing.T) {
+	triggers, err := ParseTriggers([]string{"missed_call", " vip", "long_call"})
+	if err != nil || len(triggers) != 3 || triggers[1] != TriggerVIP {
+		t.Errorf("Expected three triggers, got %v (%v)", triggers, err)
+	}
+	if _, err := ParseTriggers([]string{"missed"}); err == nil {
+		t.Error("Expected an error for an unknown trigger")
+	}
+}
+
+func TestDispatcherMatch(t *testing.T) {
+	dispatcher, err := NewDispatcher(DispatcherOptions{
+		Triggers: []Trigger{TriggerVIP, TriggerMissedCall, TriggerLongCall},
+		VIPs:     map[string]string{"+4930123456": "Mom"},
+		LongCall: 10 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create dispatcher: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		event    types.CallEvent
+		expected Trigger
+	}{
+		{"missed call", disconnect(types.CallDirectionInbound, "+4940654321", "990133", types.CallStatusMissedCall, 0), TriggerMissedCall},
+		{"missed VIP call matches first trigger", disconnect(types.CallDirectionInbound, "+4930123456", "990133", types.CallStatusMissedCall, 0), TriggerVIP},
+		{"answered VIP call", disconnect(types.CallDirectionInbound, "+4930123456", "990133", types.CallStatusFinished, 30), TriggerVIP},
+		{"long outbound call", disconnect(types.CallDirectionOutbound, "990133", "+4940654321", types.CallStatusFinished, 600), TriggerLongCall},
+		{"short call", disconnect(types.CallDirectionInbound, "+4940654321", "990133", types.CallStatusFinished, 599), ""},
+		{"outbound call to VIP", disconnect(types.CallDirectionOutbound, "990133", "+4930123456", types.CallStatusNotReached, 0), ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if trigger, _ := dispatcher.Match(tt.event); trigger != tt.expected {
+				t.Errorf("Expected trigger %q, got %q", tt.expected, trigger)
+			}
+		})
+	}
+}
+
+func TestDispatcherUpdateRules(t *testing.T) {
+	dispatcher, err := NewDispatcher(DispatcherOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create dispatcher: %v", err)
+	}
+	vipCall := disconnect(types.CallDirectionInbound, "+4930123456", "990133", types.CallStatusFinished, 30)
+	if _, ok := dispatcher.Match(vipCall); ok {
+		t.Fatal("Expected no trigger for an answered call by default")
+	}
+
+	if err := dispatcher.UpdateRules(DispatcherOptions{Triggers: []Trigger{TriggerVIP}, VIPs: map[string]string{"+4930123456": "Mom"}}); err != nil {
+		t.Fatalf("UpdateRules failed: %v", err)
+	}
+	if trigger, _ := dispatcher.Match(vipCall); trigger != TriggerVIP {
+		t.Errorf("Expected trigger vip after the update, got %q", trigger)
+	}
+
+	// A broken template keeps the previous rules
+	if err := dispatcher.UpdateRules(DispatcherOptions{TitleTemplate: "{{.Contact"}); err == nil {
+		t.Error("Expected an error for an invalid template")
+	}
+	if trigger, _ := dispatcher.Match(vipCall); trigger != TriggerVIP {
+		t.Errorf("Expected the previous rules after a failed update, got %q", trigger)
+	}
+}
+
+func TestDispatcherRender(t *testing.T) {
+	dispatcher, err := NewDispatcher(DispatcherOptions{
+		VIPs:     map[string]string{"+4930123456": "Mom"},
+		Location: time.FixedZone("CEST", 2*60*60),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create dispatcher: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		trigger Trigger
+		event   types.CallEvent
+		title   string
+		text    string
+	}{
+		{
+			name:    "missed call",
+			trigger: TriggerMissedCall,
+			event:   disconnect(types.CallDirectionInbound, "+4940654321", "990133", types.CallStatusMissedCall, 0),
+			title:   "Missed call",
+			text:    "From +4940654321 at 14:15",
+		},
+		{
+			name:    "VIP call",
+			trigger: TriggerVIP,
+			event:   disconnect(types.CallDirectionInbound, "+4930123456", "990133", types.CallStatusFinished, 125),
+			title:   "Call from Mom",
+			text:    "From Mom at 14:15, talked 2m5s",
+		},
+		{
+			name:    "long call to suppressed number",
+			trigger: TriggerLongCall,
+			event:   disconnect(types.CallDirectionOutbound, "990133", "", types.CallStatusFinished, 3600),
+			title:   "Long call",
+			text:    "To unknown number at 14:15, talked 1h0m0s",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := dispatcher.Render(tt.trigger, tt.event)
+			if err != nil {
+				t.Fatalf("Render failed: %v", err)
+			}
+			if msg.Title != tt.title || msg.Text != tt.text {
+				t.Errorf("Expected %q / %q, got %q / %q", tt.title, tt.text, msg.Title, msg.Text)
+			}
+		})
+	}
+
+	if _, err := NewDispatcher(DispatcherOptions{MessageTemplate: "{{.Unknown"}); err == nil {
+		t.Error("Expected an error for an invalid template")
+	}
+}
+
+func TestDispatcherPublishCallEvent(t *testing.T) {
+	ok, failing := &recordingChannel{}, &recordingChannel{err: errors.New("offline")}
+	dispatcher, err := NewDispatcher(DispatcherOptions{
+		Channels:        []Channel{ok, failing},
+		MessageTemplate: "{{.Number}} ({{.Trigger}})",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create dispatcher: %v", err)
+	}
+
+	missed := disconnect(types.CallDirectionInbound, "+4940654321", "990133", types.CallStatusMissedCall, 0)
+	err = dispatcher.PublishCallEvent(context.Background(), missed)
+	if err == nil || !strings.Contains(err.Error(), "via recording: offline") {
+		t.Errorf("Expected the failing channel as error, got %v", err)
+	}
+	if len(ok.messages) != 1 || ok.messages[0].Text != "+4940654321 (missed_call)" {
+		t.Errorf("Expected the missed call to be sent, got %+v", ok.messages)
+	}
+
+	// Opted-out calls, other events and calls matching no trigger are not sent
+	optedOut := missed
+	optedOut.DoNotRecord = true
+	ring := missed
+	ring.Type = types.CallTypeRing
+	answered := disconnect(types.CallDirectionInbound, "+4940654321", "990133", types.CallStatusFinished, 30)
+	for _, event := range []types.CallEvent{optedOut, ring, answered} {
+		if err := dispatcher.PublishCallEvent(context.Background(), event); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+	if len(ok.messages) != 1 {
+		t.Errorf("Expected no further messages, got %+v", ok.messages)
+	}
+}
@@ -0,0 +1,71 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/database"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// RuleStore provides the notification rules
+type RuleStore interface {
+	ListNotificationRules(ctx context.Context) ([]database.NotificationRule, error)
+}
+
+// Publisher delivers a notification to a recipient, e.g. via MQTT
+type Publisher interface {
+	PublishNotification(ctx context.Context, recipient string, payload []byte) error
+}
+
+// Notification is the payload sent to a recipient
+type Notification struct {
+	RuleID    int64           `json:"rule_id"`
+	Rule      string          `json:"rule"`
+	Recipient string          `json:"recipient"`
+	Call      types.CallEvent `json:"call"` // Disconnect event of the finished call
+}
+
+// Notifier is a call event sink that notifies the recipients of all rules
+// matching a finished call. Rules are read from the store for every call, so
+// changes made through the API apply immediately.
+type Notifier struct {
+	store     RuleStore
+	publisher Publisher
+}
+
+// NewNotifier creates a notifier
+func NewNotifier(store RuleStore, publisher Publisher) *Notifier {
+	return &Notifier{store: store, publisher: publisher}
+}
+
+// PublishCallEvent notifies the recipients of matching rules about finished calls.
+// Calls of opted-out MSNs are not published, like missed call notifications.
+func (n *Notifier) PublishCallEvent(ctx context.Context, event types.CallEvent) error {
+	if event.Type != types.CallTypeDisconnect || event.DoNotRecord {
+		return nil
+	}
+
+	rules, err := n.store.ListNotificationRules(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load notification rules: %w", err)
+	}
+
+	var errs []error
+	for _, rule := range rules {
+		if !rule.Matches(event) {
+			continue
+		}
+
+		payload, err := json.Marshal(Notification{RuleID: rule.ID, Rule: rule.Name, Recipient: rule.Recipient, Call: event})
+		if err != nil {
+			return fmt.Errorf("failed to marshal notification: %w", err)
+		}
+		if err := n.publisher.PublishNotification(ctx, rule.Recipient, payload); err != nil {
+			errs = append(errs, fmt.Errorf("failed to notify %s (rule %d): %w", rule.Recipient, rule.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,142 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/database"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// newStore creates a migrated database in a temporary directory
+func newStore(t *testing.T) *database.Client {
+	t.Helper()
+
+	client, err := database.NewClient(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+
+	if err := client.RunEmbeddedMigrations(context.Background()); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	return client
+}
+
+// recordingPublisher records the published notifications
+type recordingPublisher struct {
+	recipients []string
+	payloads   []Notification
+}
+
+func (p *recordingPublisher) PublishNotification(_ context.Context, recipient string, payload []byte) error {
+	var notification Notification
+	if err := json.Unmarshal(payload, &notification); err != nil {
+		return err
+	}
+	p.recipients = append(p.recipients, recipient)
+	p.payloads = append(p.payloads, notification)
+	return nil
+}
+
+func TestAPI(t *testing.T) {
+	handler := NewHandler(newStore(t))
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return recorder
+	}
+
+	created := do(http.MethodPost, RulesPath, `{"name":"Missed calls","recipient":"anna","msn":"990133","finish_states":["missedCall"]}`)
+	if created.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %d: %s", created.Code, created.Body)
+	}
+	var rule database.NotificationRule
+	if err := json.Unmarshal(created.Body.Bytes(), &rule); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if !rule.Enabled || created.Header().Get("Location") != RulesPath+"/1" {
+		t.Errorf("Expected enabled rule at %s/1, got %+v at %s", RulesPath, rule, created.Header().Get("Location"))
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		expected int
+	}{
+		{"list", http.MethodGet, RulesPath, "", http.StatusOK},
+		{"get", http.MethodGet, RulesPath + "/1", "", http.StatusOK},
+		{"update", http.MethodPut, RulesPath + "/1", `{"name":"Missed calls","recipient":"anna","enabled":false}`, http.StatusOK},
+		{"invalid rule", http.MethodPost, RulesPath, `{"name":"x","recipient":"anna","days":["monday"]}`, http.StatusBadRequest},
+		{"unknown field", http.MethodPost, RulesPath, `{"name":"x","recipient":"anna","topic":"x"}`, http.StatusBadRequest},
+		{"invalid ID", http.MethodGet, RulesPath + "/abc", "", http.StatusBadRequest},
+		{"unknown rule", http.MethodPut, RulesPath + "/42", `{"name":"x","recipient":"anna"}`, http.StatusNotFound},
+		{"delete", http.MethodDelete, RulesPath + "/1", "", http.StatusNoContent},
+		{"deleted", http.MethodGet, RulesPath + "/1", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if recorder := do(tt.method, tt.path, tt.body); recorder.Code != tt.expected {
+				t.Errorf("Expected %d, got %d: %s", tt.expected, recorder.Code, recorder.Body)
+			}
+		})
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	store := newStore(t)
+	ctx := context.Background()
+	for _, rule := range []database.NotificationRule{
+		{Name: "Anna's line", Recipient: "anna", MSN: "990133", FinishStates: []string{"missedCall"}, Enabled: true},
+		{Name: "Office hours", Recipient: "ben", StartTime: "08:00", EndTime: "12:00", Enabled: true},
+		{Name: "Disabled", Recipient: "carla", Enabled: false},
+	} {
+		if _, err := store.CreateNotificationRule(ctx, rule); err != nil {
+			t.Fatalf("CreateNotificationRule failed: %v", err)
+		}
+	}
+
+	publisher := &recordingPublisher{}
+	notifier := NewNotifier(store, publisher)
+
+	missed := types.CallStatusMissedCall
+	disconnect := types.CallEvent{
+		ID:          "call-1",
+		Type:        types.CallTypeDisconnect,
+		Timestamp:   time.Date(2025, 9, 22, 14, 0, 0, 0, time.UTC),
+		Direction:   types.CallDirectionInbound,
+		Caller:      "+4930123456",
+		CalledMSN:   "990133",
+		FinishState: &missed,
+	}
+	ring := disconnect
+	ring.Type = types.CallTypeRing
+	optedOut := disconnect
+	optedOut.DoNotRecord = true
+
+	for _, event := range []types.CallEvent{ring, optedOut, disconnect} {
+		if err := notifier.PublishCallEvent(ctx, event); err != nil {
+			t.Fatalf("PublishCallEvent failed: %v", err)
+		}
+	}
+
+	if len(publisher.recipients) != 1 || publisher.recipients[0] != "anna" {
+		t.Fatalf("Expected only anna to be notified, got %v", publisher.recipients)
+	}
+	if notification := publisher.payloads[0]; notification.Rule != "Anna's line" || notification.Call.Caller != "+4930123456" {
+		t.Errorf("Unexpected notification: %+v", notification)
+	}
+}
@@ -0,0 +1,54 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Ntfy publishes messages to a topic of ntfy.sh or a self-hosted ntfy server
+type Ntfy struct {
+	topicURL   string
+	token      string
+	httpClient *http.Client
+}
+
+// NtfyOptions configures an ntfy channel
+type NtfyOptions struct {
+	URL        string       // Server URL (default: https://ntfy.sh)
+	Topic      string       // Topic the app is subscribed to
+	Token      string       // Access token of protected topics (optional)
+	HTTPClient *http.Client // Overrides the client with the default timeout
+}
+
+// NewNtfy creates an ntfy channel
+func NewNtfy(opts NtfyOptions) *Ntfy {
+	if opts.URL == "" {
+		opts.URL = "https://ntfy.sh"
+	}
+	return &Ntfy{
+		topicURL:   strings.TrimSuffix(opts.URL, "/") + "/" + opts.Topic,
+		token:      opts.Token,
+		httpClient: httpClientOrDefault(opts.HTTPClient),
+	}
+}
+
+// Name returns the channel name
+func (n *Ntfy) Name() string {
+	return "ntfy"
+}
+
+// Send publishes the message text as body and the title as header
+func (n *Ntfy) Send(ctx context.Context, msg Message) error {
+	req, err := newRequest(ctx, n.topicURL, strings.NewReader(msg.Text), "text/plain; charset=utf-8")
+	if err != nil {
+		return err
+	}
+	if msg.Title != "" {
+		req.Header.Set("Title", msg.Title)
+	}
+	if n.token != "" {
+		req.Header.Set("Authorization", "Bearer "+n.token)
+	}
+	return send(n.httpClient, req, "ntfy")
+}
@@ -0,0 +1,56 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Pushover sends messages through the Pushover API
+type Pushover struct {
+	messagesURL string
+	token       string
+	user        string
+	httpClient  *http.Client
+}
+
+// PushoverOptions configures a Pushover channel
+type PushoverOptions struct {
+	Token      string       // Application API token
+	User       string       // User or group key of the recipients
+	BaseURL    string       // API server (default: https://api.pushover.net)
+	HTTPClient *http.Client // Overrides the client with the default timeout
+}
+
+// NewPushover creates a Pushover channel
+func NewPushover(opts PushoverOptions) *Pushover {
+	if opts.BaseURL == "" {
+		opts.BaseURL = "https://api.pushover.net"
+	}
+	return &Pushover{
+		messagesURL: strings.TrimSuffix(opts.BaseURL, "/") + "/1/messages.json",
+		token:       opts.Token,
+		user:        opts.User,
+		httpClient:  httpClientOrDefault(opts.HTTPClient),
+	}
+}
+
+// Name returns the channel name
+func (p *Pushover) Name() string {
+	return "pushover"
+}
+
+// Send posts the message; Pushover falls back to the app name without a title
+func (p *Pushover) Send(ctx context.Context, msg Message) error {
+	form := url.Values{"token": {p.token}, "user": {p.user}, "message": {msg.Text}}
+	if msg.Title != "" {
+		form.Set("title", msg.Title)
+	}
+
+	req, err := newRequest(ctx, p.messagesURL, strings.NewReader(form.Encode()), "application/x-www-form-urlencoded")
+	if err != nil {
+		return err
+	}
+	return send(p.httpClient, req, "Pushover")
+}
@@ -0,0 +1,55 @@
+package notify
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Telegram sends messages through a Telegram bot
+type Telegram struct {
+	sendURL    string
+	chatID     string
+	httpClient *http.Client
+}
+
+// TelegramOptions configures a Telegram channel
+type TelegramOptions struct {
+	Token      string       // Bot token issued by @BotFather
+	ChatID     string       // Chat, group or channel the bot posts to
+	BaseURL    string       // Bot API server (default: https://api.telegram.org)
+	HTTPClient *http.Client // Overrides the client with the default timeout
+}
+
+// NewTelegram creates a Telegram channel
+func NewTelegram(opts TelegramOptions) *Telegram {
+	if opts.BaseURL == "" {
+		opts.BaseURL = "https://api.telegram.org"
+	}
+	return &Telegram{
+		sendURL:    strings.TrimSuffix(opts.BaseURL, "/") + "/bot" + opts.Token + "/sendMessage",
+		chatID:     opts.ChatID,
+		httpClient: httpClientOrDefault(opts.HTTPClient),
+	}
+}
+
+// Name returns the channel name
+func (t *Telegram) Name() string {
+	return "telegram"
+}
+
+// Send posts the message as plain text, the title on the first line
+func (t *Telegram) Send(ctx context.Context, msg Message) error {
+	text := msg.Text
+	if msg.Title != "" {
+		text = msg.Title + "\n" + text
+	}
+	form := url.Values{"chat_id": {t.chatID}, "text": {text}}
+
+	req, err := newRequest(ctx, t.sendURL, strings.NewReader(form.Encode()), "application/x-www-form-urlencoded")
+	if err != nil {
+		return err
+	}
+	return send(t.httpClient, req, "Telegram")
+}
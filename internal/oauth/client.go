@@ -0,0 +1,198 @@
+package oauth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+)
+
+// Token is an access token, typically a JWT, with its expiry
+type Token struct {
+	AccessToken string
+	Expiry      time.Time // Zero if the token does not expire
+}
+
+// Client fetches access tokens with the OAuth2 client credentials grant and
+// caches them until shortly before they expire
+type Client struct {
+	tokenURL      string
+	clientID      string
+	clientSecret  string
+	scope         string
+	audience      string
+	refreshBefore time.Duration
+	clock         clock.Clock
+	httpClient    *http.Client
+
+	mu    sync.Mutex
+	token Token
+}
+
+// Options configures a token client
+type Options struct {
+	TokenURL      string
+	ClientID      string
+	ClientSecret  string
+	Scope         string        // Space separated scopes (optional)
+	Audience      string        // Audience of the token, required by some providers such as Auth0 (optional)
+	RefreshBefore time.Duration // A new token is fetched this long before the cached one expires
+	Timeout       time.Duration // Upper bound for a single token request
+	Clock         clock.Clock   // Source of the current time (default: real time)
+	HTTPClient    *http.Client  // Overrides the client built from Timeout
+}
+
+// DefaultOptions returns the options used when nothing else is configured
+func DefaultOptions() Options {
+	return Options{
+		RefreshBefore: 5 * time.Minute,
+		Timeout:       10 * time.Second,
+		Clock:         clock.Real(),
+	}
+}
+
+// withDefaults fills unset fields from DefaultOptions
+func (o Options) withDefaults() Options {
+	defaults := DefaultOptions()
+	if o.RefreshBefore <= 0 {
+		o.RefreshBefore = defaults.RefreshBefore
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = defaults.Timeout
+	}
+	if o.Clock == nil {
+		o.Clock = defaults.Clock
+	}
+	if o.HTTPClient == nil {
+		o.HTTPClient = &http.Client{Timeout: o.Timeout}
+	}
+	return o
+}
+
+// NewClient creates a new token client
+func NewClient(opts Options) *Client {
+	opts = opts.withDefaults()
+	return &Client{
+		tokenURL:      opts.TokenURL,
+		clientID:      opts.ClientID,
+		clientSecret:  opts.ClientSecret,
+		scope:         opts.Scope,
+		audience:      opts.Audience,
+		refreshBefore: opts.RefreshBefore,
+		clock:         opts.Clock,
+		httpClient:    opts.HTTPClient,
+	}
+}
+
+// Token returns the cached token, or fetches a new one if there is none yet
+// or the cached one expires within the refresh margin
+func (c *Client) Token(ctx context.Context) (Token, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.token.AccessToken != "" && (c.token.Expiry.IsZero() || c.clock.Now().Add(c.refreshBefore).Before(c.token.Expiry)) {
+		return c.token, nil
+	}
+
+	token, err := c.fetch(ctx)
+	if err != nil {
+		return Token{}, err
+	}
+	c.token = token
+	return token, nil
+}
+
+// tokenResponse is the successful response of the token endpoint (RFC 6749 section 5.1)
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// errorResponse is the error response of the token endpoint (RFC 6749 section 5.2)
+type errorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// fetch requests a new token with the client credentials grant
+func (c *Client) fetch(ctx context.Context) (Token, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if c.scope != "" {
+		form.Set("scope", c.scope)
+	}
+	if c.audience != "" {
+		form.Set("audience", c.audience)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Token{}, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(c.clientID), url.QueryEscape(c.clientSecret))
+
+	requested := c.clock.Now()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return Token{}, fmt.Errorf("failed to request token: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return Token{}, fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResp errorResponse
+		if json.Unmarshal(body, &errResp) == nil && errResp.Error != "" {
+			return Token{}, fmt.Errorf("token request rejected with HTTP %d: %s %s", resp.StatusCode, errResp.Error, errResp.ErrorDescription)
+		}
+		return Token{}, fmt.Errorf("token request rejected with HTTP %d", resp.StatusCode)
+	}
+
+	var tokenResp tokenResponse
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return Token{}, fmt.Errorf("invalid token response: %w", err)
+	}
+	if tokenResp.AccessToken == "" {
+		return Token{}, fmt.Errorf("token response contains no access token")
+	}
+
+	token := Token{AccessToken: tokenResp.AccessToken}
+	if tokenResp.ExpiresIn > 0 {
+		token.Expiry = requested.Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	} else if expiry, ok := jwtExpiry(tokenResp.AccessToken); ok {
+		token.Expiry = expiry
+	}
+	return token, nil
+}
+
+// jwtExpiry reads the exp claim of a JWT without verifying it; the broker does that
+func jwtExpiry(token string) (time.Time, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(claims.Exp, 0), true
+}
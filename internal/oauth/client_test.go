@@ -0,0 +1,100 @@
+package oauth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+)
+
+// fakeJWT builds an unsigned JWT with the given expiry
+func fakeJWT(exp time.Time) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"bridge","exp":%d}`, exp.Unix())))
+	return header + "." + payload + ".signature"
+}
+
+func TestToken(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 9, 21, 15, 35, 0, 0, time.UTC))
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		id, secret, _ := r.BasicAuth()
+		if id != "bridge" || secret != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid_client","error_description":"bad credentials"}`))
+			return
+		}
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "client_credentials" || r.PostForm.Get("audience") != "mqtt" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": fmt.Sprintf("token-%d", requests),
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+	defer server.Close()
+
+	client := NewClient(Options{TokenURL: server.URL, ClientID: "bridge", ClientSecret: "s3cret", Audience: "mqtt", Clock: clk})
+	ctx := context.Background()
+
+	steps := []struct {
+		advance  time.Duration
+		expected string
+	}{
+		{0, "token-1"},
+		{50 * time.Minute, "token-1"}, // Cached until the refresh margin
+		{6 * time.Minute, "token-2"},  // Expires within 5 minutes
+	}
+	for i, step := range steps {
+		clk.Advance(step.advance)
+		token, err := client.Token(ctx)
+		if err != nil {
+			t.Fatalf("Step %d: Token failed: %v", i, err)
+		}
+		if token.AccessToken != step.expected {
+			t.Errorf("Step %d: expected %s, got %s", i, step.expected, token.AccessToken)
+		}
+	}
+
+	t.Run("rejected client", func(t *testing.T) {
+		wrong := NewClient(Options{TokenURL: server.URL, ClientID: "bridge", ClientSecret: "wrong"})
+		if _, err := wrong.Token(ctx); err == nil || !strings.Contains(err.Error(), "invalid_client") {
+			t.Errorf("Expected invalid_client error, got %v", err)
+		}
+	})
+}
+
+func TestJWTExpiry(t *testing.T) {
+	exp := time.Date(2025, 9, 21, 16, 35, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"jwt", fakeJWT(exp), true},
+		{"opaque token", "2YotnFZFEjr1zCsicMWpAA", false},
+		{"invalid payload", "a.!!!.c", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expiry, ok := jwtExpiry(tt.token)
+			if ok != tt.ok {
+				t.Fatalf("Expected ok=%t, got %t", tt.ok, ok)
+			}
+			if ok && !expiry.Equal(exp) {
+				t.Errorf("Expected expiry %v, got %v", exp, expiry)
+			}
+		})
+	}
+}
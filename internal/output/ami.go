@@ -0,0 +1,344 @@
+package output
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// amiBanner greets AMI clients like Asterisk 13 and later
+const amiBanner = "Asterisk Call Manager/2.10.0\r\n"
+
+// AMIOptions configures the AMI event server
+type AMIOptions struct {
+	Address      string        // Listen address, e.g. :5038
+	Username     string        // Required login; any login is accepted if empty
+	Secret       string        // Secret of the login
+	WriteTimeout time.Duration // Clients not reading within this time are disconnected
+}
+
+// DefaultAMIOptions returns the options used when nothing else is configured
+func DefaultAMIOptions() AMIOptions {
+	return AMIOptions{
+		Address:      ":5038",
+		WriteTimeout: 5 * time.Second,
+	}
+}
+
+// withDefaults fills unset fields from DefaultAMIOptions
+func (o AMIOptions) withDefaults() AMIOptions {
+	defaults := DefaultAMIOptions()
+	if o.Address == "" {
+		o.Address = defaults.Address
+	}
+	if o.WriteTimeout <= 0 {
+		o.WriteTimeout = defaults.WriteTimeout
+	}
+	return o
+}
+
+// AMI is a TCP server speaking the Asterisk Manager Interface, so PBX tooling
+// like call loggers and CTI clients can follow the calls of the Fritz!Box as
+// if it were an Asterisk. Clients log in with "Action: Login" and then receive
+// Newchannel, Newstate and Hangup events of every call; Ping and Logoff are
+// answered, other actions are rejected. Events flagged as do-not-record are skipped.
+type AMI struct {
+	opts     AMIOptions
+	listener net.Listener
+
+	mu      sync.Mutex
+	clients map[*amiClient]bool // Connected clients, true once logged in
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// amiClient is a connection of an AMI client; mu serializes responses and events
+type amiClient struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewAMI starts listening for AMI clients
+func NewAMI(opts AMIOptions) (*AMI, error) {
+	opts = opts.withDefaults()
+	listener, err := net.Listen("tcp", opts.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for AMI clients: %w", err)
+	}
+
+	a := &AMI{
+		opts:     opts,
+		listener: listener,
+		clients:  make(map[*amiClient]bool),
+	}
+	a.wg.Add(1)
+	go a.acceptLoop()
+	return a, nil
+}
+
+// Addr returns the address the server listens on
+func (a *AMI) Addr() net.Addr {
+	return a.listener.Addr()
+}
+
+// PublishCallEvent sends the event to all logged in clients. A client that
+// cannot keep up is disconnected instead of delaying the other sinks.
+func (a *AMI) PublishCallEvent(_ context.Context, event types.CallEvent) error {
+	if event.DoNotRecord {
+		return nil
+	}
+	message := amiEvent(event)
+	if message == "" {
+		return nil
+	}
+
+	a.mu.Lock()
+	clients := make([]*amiClient, 0, len(a.clients))
+	for client, loggedIn := range a.clients {
+		if loggedIn {
+			clients = append(clients, client)
+		}
+	}
+	a.mu.Unlock()
+
+	for _, client := range clients {
+		if err := client.send(message, a.opts.WriteTimeout); err != nil {
+			log.Printf("Disconnecting AMI client %s: %v", client.conn.RemoteAddr(), err)
+			a.logoff(client)
+		}
+	}
+	return nil
+}
+
+// Close stops accepting clients and disconnects the connected ones
+func (a *AMI) Close() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	clients := a.clients
+	a.clients = make(map[*amiClient]bool)
+	a.mu.Unlock()
+
+	err := a.listener.Close()
+	for client := range clients {
+		_ = client.conn.Close()
+	}
+	a.wg.Wait()
+	return err
+}
+
+// acceptLoop serves every client in its own goroutine until the server is closed
+func (a *AMI) acceptLoop() {
+	defer a.wg.Done()
+
+	for {
+		conn, err := a.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("AMI server stopped accepting connections: %v", err)
+			}
+			return
+		}
+
+		client := &amiClient{conn: conn}
+		if !a.connect(client) {
+			_ = conn.Close()
+			return
+		}
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			a.serve(client)
+		}()
+	}
+}
+
+// serve answers the actions of a client until it logs off or disconnects
+func (a *AMI) serve(client *amiClient) {
+	defer a.logoff(client)
+
+	if err := client.send(amiBanner, a.opts.WriteTimeout); err != nil {
+		return
+	}
+	reader := textproto.NewReader(bufio.NewReader(client.conn))
+	loggedIn := false
+	for {
+		action, err := reader.ReadMIMEHeader()
+		if err != nil {
+			return
+		}
+		response := amiMessage{"Response", "Success"}
+		if id := action.Get("ActionID"); id != "" {
+			response = append(response, "ActionID", id)
+		}
+
+		switch name := strings.ToLower(action.Get("Action")); {
+		case name == "login":
+			if !a.authenticate(action.Get("Username"), action.Get("Secret")) {
+				_ = client.send(response.with("Response", "Error", "Message", "Authentication failed").String(), a.opts.WriteTimeout)
+				return
+			}
+			if err := client.send(response.with("Message", "Authentication accepted").String(), a.opts.WriteTimeout); err != nil {
+				return
+			}
+			loggedIn = a.login(client)
+			if !loggedIn {
+				return
+			}
+			_ = client.send(amiMessage{"Event", "FullyBooted", "Privilege", "system,all", "Status", "Fully Booted"}.String(), a.opts.WriteTimeout)
+			log.Printf("AMI client %s logged in", client.conn.RemoteAddr())
+		case name == "logoff":
+			_ = client.send(response.with("Response", "Goodbye", "Message", "Thanks for all the fish.").String(), a.opts.WriteTimeout)
+			return
+		case !loggedIn:
+			response = response.with("Response", "Error", "Message", "Authentication Required")
+			if err := client.send(response.String(), a.opts.WriteTimeout); err != nil {
+				return
+			}
+		case name == "ping":
+			timestamp := strconv.FormatFloat(float64(time.Now().UnixMicro())/1e6, 'f', 6, 64)
+			if err := client.send(response.with("Ping", "Pong", "Timestamp", timestamp).String(), a.opts.WriteTimeout); err != nil {
+				return
+			}
+		default:
+			response = response.with("Response", "Error", "Message", "Invalid/unknown command: "+action.Get("Action"))
+			if err := client.send(response.String(), a.opts.WriteTimeout); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// authenticate checks the login against the configured one
+func (a *AMI) authenticate(username, secret string) bool {
+	if a.opts.Username == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(username), []byte(a.opts.Username)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(secret), []byte(a.opts.Secret)) == 1
+}
+
+// connect tracks a new client, so Close disconnects it; false if the server is closed
+func (a *AMI) connect(client *amiClient) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return false
+	}
+	a.clients[client] = false
+	return true
+}
+
+// login adds the client to the receivers of events; false if it was disconnected meanwhile
+func (a *AMI) login(client *amiClient) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, connected := a.clients[client]; !connected {
+		return false
+	}
+	a.clients[client] = true
+	return true
+}
+
+// logoff removes the client and closes its connection
+func (a *AMI) logoff(client *amiClient) {
+	a.mu.Lock()
+	delete(a.clients, client)
+	a.mu.Unlock()
+	_ = client.conn.Close()
+}
+
+// send writes a message within the timeout
+func (c *amiClient) send(message string, timeout time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(timeout))
+	_, err := c.conn.Write([]byte(message))
+	return err
+}
+
+// amiMessage is an AMI message as key, value pairs in their order
+type amiMessage []string
+
+// with returns a copy of the message with the keys set to the values
+func (m amiMessage) with(pairs ...string) amiMessage {
+	result := append(amiMessage(nil), m...)
+	for i := 0; i < len(pairs); i += 2 {
+		replaced := false
+		for j := 0; j < len(result); j += 2 {
+			if result[j] == pairs[i] {
+				result[j+1] = pairs[i+1]
+				replaced = true
+			}
+		}
+		if !replaced {
+			result = append(result, pairs[i], pairs[i+1])
+		}
+	}
+	return result
+}
+
+// String encodes the message as "Key: Value" lines terminated by an empty line
+func (m amiMessage) String() string {
+	var b strings.Builder
+	for i := 0; i < len(m); i += 2 {
+		b.WriteString(m[i])
+		b.WriteString(": ")
+		// Values must not break out of their line
+		b.WriteString(strings.NewReplacer("\r", " ", "\n", " ").Replace(m[i+1]))
+		b.WriteString("\r\n")
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// amiEvent maps a call event to the AMI event of a channel: RING and CALL
+// create the channel, CONNECT brings it up and DISCONNECT hangs it up. The
+// channel is named after the trunk and line, its unique ID is the call ID.
+func amiEvent(event types.CallEvent) string {
+	var message amiMessage
+	switch event.Type {
+	case types.CallTypeRing, types.CallTypeCall:
+		message = amiMessage{"Event", "Newchannel", "Privilege", "call,all", "ChannelState", "4", "ChannelStateDesc", "Ring"}
+	case types.CallTypeConnect:
+		message = amiMessage{"Event", "Newstate", "Privilege", "call,all", "ChannelState", "6", "ChannelStateDesc", "Up"}
+	case types.CallTypeDisconnect:
+		message = amiMessage{"Event", "Hangup", "Privilege", "call,all", "Cause", "19", "Cause-txt", "User alerting, no answer"}
+		if event.Duration > 0 {
+			message = message.with("Cause", "16", "Cause-txt", "Normal Clearing")
+		}
+		message = message.with("Duration", strconv.Itoa(event.Duration))
+	default:
+		return ""
+	}
+
+	trunk := event.Trunk
+	if trunk == "" {
+		trunk = "internal"
+	}
+	return message.with(
+		"Channel", fmt.Sprintf("FRITZ/%s-%d", trunk, event.Line),
+		"CallerIDNum", event.Caller,
+		"ConnectedLineNum", event.Called,
+		"Exten", event.Called,
+		"Context", string(event.Direction),
+		"Extension", event.Extension,
+		"Line", strconv.Itoa(event.Line),
+		"Uniqueid", event.ID,
+		"Linkedid", event.ID,
+	).String()
+}
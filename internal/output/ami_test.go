@@ -0,0 +1,125 @@
+package output
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// dialAMI connects to the server and reads the banner
+func dialAMI(t *testing.T, ami *AMI) (net.Conn, *textproto.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", ami.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	reader := textproto.NewReader(bufio.NewReader(conn))
+	banner, err := reader.ReadLine()
+	if err != nil || !strings.HasPrefix(banner, "Asterisk Call Manager/") {
+		t.Fatalf("Expected the AMI banner, got %q (%v)", banner, err)
+	}
+	return conn, reader
+}
+
+// amiAction sends an action and returns the response
+func amiAction(t *testing.T, conn net.Conn, reader *textproto.Reader, action string) textproto.MIMEHeader {
+	t.Helper()
+	if _, err := conn.Write([]byte(strings.ReplaceAll(action, "\n", "\r\n") + "\r\n\r\n")); err != nil {
+		t.Fatalf("Failed to send action: %v", err)
+	}
+	response, err := reader.ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	return response
+}
+
+func TestAMI(t *testing.T) {
+	ami, err := NewAMI(AMIOptions{Address: "127.0.0.1:0", Username: "crm", Secret: "secret"})
+	if err != nil {
+		t.Fatalf("NewAMI failed: %v", err)
+	}
+	defer ami.Close()
+
+	conn, reader := dialAMI(t, ami)
+	if response := amiAction(t, conn, reader, "Action: Ping"); response.Get("Message") != "Authentication Required" {
+		t.Errorf("Expected Ping to require a login, got %v", response)
+	}
+	response := amiAction(t, conn, reader, "Action: Login\nActionID: 1\nUsername: crm\nSecret: secret")
+	if response.Get("Response") != "Success" || response.Get("ActionID") != "1" {
+		t.Fatalf("Expected a successful login, got %v", response)
+	}
+	if booted, err := reader.ReadMIMEHeader(); err != nil || booted.Get("Event") != "FullyBooted" {
+		t.Fatalf("Expected FullyBooted, got %v (%v)", booted, err)
+	}
+	if response := amiAction(t, conn, reader, "Action: Ping"); response.Get("Ping") != "Pong" {
+		t.Errorf("Expected Pong, got %v", response)
+	}
+	if response := amiAction(t, conn, reader, "Action: Originate"); response.Get("Response") != "Error" {
+		t.Errorf("Expected unknown actions to be rejected, got %v", response)
+	}
+
+	events := []types.CallEvent{
+		{ID: "private", Type: types.CallTypeRing, Line: 1, DoNotRecord: true},
+		{ID: "call-1", Type: types.CallTypeRing, Direction: types.CallDirectionInbound, Line: 1, Trunk: "SIP0", Caller: "+4930123456", Called: "990133"},
+		{ID: "call-1", Type: types.CallTypeConnect, Direction: types.CallDirectionInbound, Line: 1, Trunk: "SIP0", Extension: "1"},
+		{ID: "call-1", Type: types.CallTypeDisconnect, Direction: types.CallDirectionInbound, Line: 1, Trunk: "SIP0", Duration: 42},
+	}
+	for _, event := range events {
+		if err := ami.PublishCallEvent(context.Background(), event); err != nil {
+			t.Fatalf("PublishCallEvent failed: %v", err)
+		}
+	}
+
+	expected := []struct{ event, state string }{{"Newchannel", "Ring"}, {"Newstate", "Up"}, {"Hangup", ""}}
+	for _, e := range expected {
+		event, err := reader.ReadMIMEHeader()
+		if err != nil {
+			t.Fatalf("Failed to read event: %v", err)
+		}
+		if event.Get("Event") != e.event || event.Get("ChannelStateDesc") != e.state || event.Get("Uniqueid") != "call-1" {
+			t.Errorf("Expected %s event of call-1, got %v", e.event, event)
+		}
+		if event.Get("Channel") != "FRITZ/SIP0-1" || event.Get("Context") != "inbound" {
+			t.Errorf("Unexpected channel of %s: %v", e.event, event)
+		}
+		if e.event == "Hangup" && (event.Get("Cause") != "16" || event.Get("Duration") != "42") {
+			t.Errorf("Expected a normal clearing after 42 seconds, got %v", event)
+		}
+	}
+
+	if response := amiAction(t, conn, reader, "Action: Logoff"); response.Get("Response") != "Goodbye" {
+		t.Errorf("Expected Goodbye, got %v", response)
+	}
+}
+
+func TestAMIRejectsWrongSecret(t *testing.T) {
+	ami, err := NewAMI(AMIOptions{Address: "127.0.0.1:0", Username: "crm", Secret: "secret"})
+	if err != nil {
+		t.Fatalf("NewAMI failed: %v", err)
+	}
+	defer ami.Close()
+
+	conn, reader := dialAMI(t, ami)
+	if response := amiAction(t, conn, reader, "Action: Login\nUsername: crm\nSecret: guess"); response.Get("Message") != "Authentication failed" {
+		t.Errorf("Expected the login to fail, got %v", response)
+	}
+	if _, err := reader.ReadLine(); err == nil {
+		t.Error("Expected the connection to be closed")
+	}
+
+	// A client that never logs in does not keep Close waiting
+	dialAMI(t, ami)
+	if err := ami.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+}
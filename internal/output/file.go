@@ -0,0 +1,142 @@
+package output
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// File appends every call event as a line of JSON (NDJSON) to a file. Once
+// the file grows beyond the maximum size it is renamed to <path>.1, older
+// files move on to <path>.2 and so on, and the oldest beyond MaxFiles is
+// deleted. Events flagged as do-not-record are skipped.
+type File struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+// FileOptions configures a file sink
+type FileOptions struct {
+	Path     string
+	MaxSize  int64 // Size in bytes at which the file is rotated (default: 10 MiB)
+	MaxFiles int   // Rotated files kept, 0 keeps none
+}
+
+// DefaultFileOptions returns the options used when nothing else is configured
+func DefaultFileOptions() FileOptions {
+	return FileOptions{
+		MaxSize:  10 << 20,
+		MaxFiles: 5,
+	}
+}
+
+// withDefaults fills unset fields from DefaultFileOptions
+func (o FileOptions) withDefaults() FileOptions {
+	defaults := DefaultFileOptions()
+	if o.MaxSize <= 0 {
+		o.MaxSize = defaults.MaxSize
+	}
+	if o.MaxFiles < 0 {
+		o.MaxFiles = defaults.MaxFiles
+	}
+	return o
+}
+
+// NewFile opens the file of a file sink, appending to an existing file
+func NewFile(opts FileOptions) (*File, error) {
+	opts = opts.withDefaults()
+	f := &File{path: opts.Path, maxSize: opts.MaxSize, maxFiles: opts.MaxFiles}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// PublishCallEvent appends the event as a single line, rotating the file first if the line does not fit
+func (f *File) PublishCallEvent(_ context.Context, event types.CallEvent) error {
+	if event.DoNotRecord {
+		return nil
+	}
+	line, err := encodeLine(event)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return fmt.Errorf("output file %s is closed", f.path)
+	}
+	if f.size > 0 && f.size+int64(len(line)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := f.file.Write(line)
+	f.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write call event to %s: %w", f.path, err)
+	}
+	return nil
+}
+
+// Close closes the file; later events fail
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// open opens the file for appending; f.mu must be held or f not shared yet
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to open output file: %w", err)
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+// rotate moves the full file aside and starts a new one; f.mu must be held
+func (f *File) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return fmt.Errorf("failed to close output file %s: %w", f.path, err)
+	}
+	f.file = nil
+
+	if f.maxFiles == 0 {
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove output file %s: %w", f.path, err)
+		}
+		return f.open()
+	}
+	for i := f.maxFiles - 1; i >= 1; i-- {
+		err := os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to rotate output file %s: %w", f.path, err)
+		}
+	}
+	if err := os.Rename(f.path, f.path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate output file %s: %w", f.path, err)
+	}
+	return f.open()
+}
@@ -0,0 +1,86 @@
+package output
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// readEvents returns the call events of a NDJSON file
+func readEvents(t *testing.T, path string) []types.CallEvent {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", path, err)
+	}
+	defer file.Close()
+
+	var events []types.CallEvent
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event types.CallEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("Invalid line %q in %s: %v", scanner.Text(), path, err)
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestFileRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "calls.ndjson")
+	event := types.CallEvent{ID: "call", Timestamp: time.Date(2025, 9, 21, 15, 30, 0, 0, time.UTC), Type: types.CallTypeRing, Line: 1}
+	line, err := encodeLine(event)
+	if err != nil {
+		t.Fatalf("encodeLine failed: %v", err)
+	}
+
+	// Room for two lines per file, keeping one rotated file
+	file, err := NewFile(FileOptions{Path: path, MaxSize: int64(2 * len(line)), MaxFiles: 1})
+	if err != nil {
+		t.Fatalf("NewFile failed: %v", err)
+	}
+	for i, id := range []string{"a", "b", "c", "d", "e"} {
+		event.ID = id
+		event.DoNotRecord = i == 4
+		if err := file.PublishCallEvent(context.Background(), event); err != nil {
+			t.Fatalf("PublishCallEvent failed: %v", err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	if events := readEvents(t, path); len(events) != 2 || events[0].ID != "c" || events[1].ID != "d" {
+		t.Errorf("Expected the current file to hold c and d, got %+v", events)
+	}
+	if events := readEvents(t, path+".1"); len(events) != 2 || events[0].ID != "a" || events[1].ID != "b" {
+		t.Errorf("Expected the rotated file to hold a and b, got %+v", events)
+	}
+
+	// Reopening continues with the size of the existing file, the oldest file is dropped
+	file, err = NewFile(FileOptions{Path: path, MaxSize: int64(2 * len(line)), MaxFiles: 1})
+	if err != nil {
+		t.Fatalf("NewFile failed: %v", err)
+	}
+	event.ID, event.DoNotRecord = "f", false
+	if err := file.PublishCallEvent(context.Background(), event); err != nil {
+		t.Fatalf("PublishCallEvent failed: %v", err)
+	}
+	_ = file.Close()
+	if events := readEvents(t, path); len(events) != 1 || events[0].ID != "f" {
+		t.Errorf("Expected f in a new file, got %+v", events)
+	}
+	if events := readEvents(t, path+".1"); len(events) != 2 || events[0].ID != "c" {
+		t.Errorf("Expected c and d rotated, got %+v", events)
+	}
+	if _, err := os.Stat(path + ".2"); !os.IsNotExist(err) {
+		t.Errorf("Expected no second rotated file, got %v", err)
+	}
+}
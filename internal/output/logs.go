@@ -0,0 +1,372 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// Formats of the shipped logs
+const (
+	LogFormatLoki = "loki" // Loki push API, e.g. http://loki:3100/loki/api/v1/push
+	LogFormatJSON = "json" // JSON lines posted to a generic HTTP log collector
+)
+
+// ErrLogsClosed is returned for entries arriving after Close
+var ErrLogsClosed = errors.New("log shipper is closed")
+
+// LogEntry is a structured log line of a call or connection event
+type LogEntry struct {
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"` // info, or warn for connection failures
+	Message string            `json:"message"`
+	Labels  map[string]string `json:"labels"` // Low-cardinality values, the stream labels in Loki
+	Event   *types.CallEvent  `json:"event,omitempty"`
+	Error   string            `json:"error,omitempty"`
+}
+
+// LogsOptions configures the log shipper
+type LogsOptions struct {
+	URL           string
+	Format        string            // LogFormatLoki or LogFormatJSON (default: LogFormatLoki)
+	Labels        map[string]string // Added to every entry, e.g. job=fritz-callmonitor2mqtt
+	Token         string            // Sent as "Authorization: Bearer ..." if set
+	Tenant        string            // Sent as X-Scope-OrgID to multi-tenant Loki if set
+	QueueSize     int               // Entries buffered before new entries are dropped
+	BatchSize     int               // Maximum number of entries per request
+	FlushInterval time.Duration     // Maximum time an entry waits for its batch to fill up
+	Timeout       time.Duration     // Upper bound for a single request
+	Clock         clock.Clock       // Drives the flush interval (default: real time)
+	HTTPClient    *http.Client      // Overrides the client built from Timeout
+}
+
+// DefaultLogsOptions returns the options used when nothing else is configured
+func DefaultLogsOptions() LogsOptions {
+	return LogsOptions{
+		Format:        LogFormatLoki,
+		QueueSize:     1000,
+		BatchSize:     100,
+		FlushInterval: time.Second,
+		Timeout:       10 * time.Second,
+		Clock:         clock.Real(),
+	}
+}
+
+// withDefaults fills unset fields from DefaultLogsOptions
+func (o LogsOptions) withDefaults() LogsOptions {
+	defaults := DefaultLogsOptions()
+	if o.Format == "" {
+		o.Format = defaults.Format
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = defaults.QueueSize
+	}
+	if o.BatchSize <= 0 {
+		o.BatchSize = defaults.BatchSize
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = defaults.FlushInterval
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = defaults.Timeout
+	}
+	if o.Clock == nil {
+		o.Clock = defaults.Clock
+	}
+	if o.HTTPClient == nil {
+		o.HTTPClient = &http.Client{Timeout: o.Timeout}
+	}
+	return o
+}
+
+// LogsStats counts the shipped log entries
+type LogsStats struct {
+	Shipped uint64 `json:"shipped"` // Entries accepted by the collector
+	Dropped uint64 `json:"dropped"` // Entries rejected because the queue was full
+	Failed  uint64 `json:"failed"`  // Entries lost because the collector rejected or missed them
+}
+
+// Logs ships structured log entries of the call lifecycle and the
+// connections to Loki or a generic HTTP log collector, labelled by line,
+// trunk and direction. Entries are sent in batches by a background worker,
+// so an unreachable collector never delays the sinks; entries are dropped
+// and counted when the queue is full. Events flagged as do-not-record are skipped.
+type Logs struct {
+	opts  LogsOptions
+	queue chan LogEntry
+
+	mu     sync.RWMutex // Guards closed against concurrent enqueues
+	closed bool
+	done   chan struct{}
+
+	shipped atomic.Uint64
+	dropped atomic.Uint64
+	failed  atomic.Uint64
+}
+
+// NewLogs creates a log shipper and starts its worker
+func NewLogs(opts LogsOptions) (*Logs, error) {
+	opts = opts.withDefaults()
+	if u, err := url.Parse(opts.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid log URL '%s'", opts.URL)
+	}
+	if opts.Format != LogFormatLoki && opts.Format != LogFormatJSON {
+		return nil, fmt.Errorf("unsupported log format '%s', expected loki or json", opts.Format)
+	}
+
+	l := &Logs{
+		opts:  opts,
+		queue: make(chan LogEntry, opts.QueueSize),
+		done:  make(chan struct{}),
+	}
+	go l.run()
+	return l, nil
+}
+
+// PublishCallEvent queues a log entry of the event without blocking
+func (l *Logs) PublishCallEvent(_ context.Context, event types.CallEvent) error {
+	if event.DoNotRecord {
+		return nil
+	}
+	message := fmt.Sprintf("%s on line %d", event.Type, event.Line)
+	if event.Status != "" {
+		message += ": " + string(event.Status)
+	}
+	return l.enqueue(LogEntry{
+		Time:    event.Timestamp,
+		Level:   "info",
+		Message: message,
+		Labels: map[string]string{
+			"kind":      "call",
+			"line":      strconv.Itoa(event.Line),
+			"trunk":     event.Trunk,
+			"direction": string(event.Direction),
+			"type":      string(event.Type),
+		},
+		Event: &event,
+	})
+}
+
+// LogConnection queues a log entry of a connection, e.g. "callmonitor" or
+// "mqtt", that was established or lost; cause tells why it was lost
+func (l *Logs) LogConnection(connection string, online bool, cause error) {
+	entry := LogEntry{
+		Time:    l.opts.Clock.Now(),
+		Level:   "info",
+		Message: connection + " connected",
+		Labels:  map[string]string{"kind": "connection", "connection": connection, "state": "online"},
+	}
+	if !online {
+		entry.Level = "warn"
+		entry.Message = connection + " disconnected"
+		entry.Labels["state"] = "offline"
+		if cause != nil {
+			entry.Message += ": " + cause.Error()
+			entry.Error = cause.Error()
+		}
+	}
+	_ = l.enqueue(entry)
+}
+
+// enqueue adds the static labels and puts the entry on the queue, dropping it if the queue is full
+func (l *Logs) enqueue(entry LogEntry) error {
+	for name, value := range l.opts.Labels {
+		if _, exists := entry.Labels[name]; !exists {
+			entry.Labels[name] = value
+		}
+	}
+	// An empty label is the same as a missing one in Loki, e.g. the trunk of internal calls
+	maps.DeleteFunc(entry.Labels, func(_, value string) bool { return value == "" })
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.closed {
+		return ErrLogsClosed
+	}
+	select {
+	case l.queue <- entry:
+		return nil
+	default:
+		dropped := l.dropped.Add(1)
+		log.Printf("Log shipping queue full, dropped log entry (%d dropped in total)", dropped)
+		return fmt.Errorf("log shipping queue is full")
+	}
+}
+
+// Stats returns the counters of the shipped entries
+func (l *Logs) Stats() LogsStats {
+	return LogsStats{
+		Shipped: l.shipped.Load(),
+		Dropped: l.dropped.Load(),
+		Failed:  l.failed.Load(),
+	}
+}
+
+// Close stops accepting entries and waits until the queued entries are sent
+func (l *Logs) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.queue)
+	l.mu.Unlock()
+
+	<-l.done
+	return nil
+}
+
+// run collects entries into batches until the queue is closed
+func (l *Logs) run() {
+	defer close(l.done)
+
+	ticker := l.opts.Clock.NewTicker(l.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]LogEntry, 0, l.opts.BatchSize)
+	for {
+		select {
+		case entry, ok := <-l.queue:
+			if !ok {
+				l.flush(batch)
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= l.opts.BatchSize {
+				l.flush(batch)
+				batch = batch[:0]
+			}
+
+		case <-ticker.C():
+			if len(batch) > 0 {
+				l.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// flush sends a batch in one request; a failed batch is logged and dropped
+func (l *Logs) flush(batch []LogEntry) {
+	if len(batch) == 0 {
+		return
+	}
+	if err := l.send(batch); err != nil {
+		failed := l.failed.Add(uint64(len(batch)))
+		log.Printf("Failed to ship %d log entries (%d lost in total): %v", len(batch), failed, err)
+		return
+	}
+	l.shipped.Add(uint64(len(batch)))
+}
+
+// send posts a batch in the configured format; any status but 2xx is an error
+func (l *Logs) send(batch []LogEntry) error {
+	body, contentType, err := l.encode(batch)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create log request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if l.opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+l.opts.Token)
+	}
+	if l.opts.Tenant != "" {
+		req.Header.Set("X-Scope-OrgID", l.opts.Tenant)
+	}
+
+	resp, err := l.opts.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post log entries: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("log collector rejected entries with HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(message))
+	}
+	return nil
+}
+
+// lokiPush is the body of the Loki push API
+type lokiPush struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+// lokiStream holds the entries of one label set as [nanoseconds, line] pairs
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// encode returns the batch as Loki push request or as JSON lines
+func (l *Logs) encode(batch []LogEntry) ([]byte, string, error) {
+	if l.opts.Format == LogFormatJSON {
+		var body []byte
+		for _, entry := range batch {
+			line, err := json.Marshal(entry)
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to encode log entry: %w", err)
+			}
+			body = append(append(body, line...), '\n')
+		}
+		return body, "application/x-ndjson", nil
+	}
+
+	// Entries with the same labels form one stream, in the order of their first entry
+	var push lokiPush
+	streams := make(map[string]int)
+	for _, entry := range batch {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to encode log entry: %w", err)
+		}
+		key := streamKey(entry.Labels)
+		i, exists := streams[key]
+		if !exists {
+			i = len(push.Streams)
+			streams[key] = i
+			push.Streams = append(push.Streams, lokiStream{Stream: entry.Labels})
+		}
+		push.Streams[i].Values = append(push.Streams[i].Values, [2]string{strconv.FormatInt(entry.Time.UnixNano(), 10), string(line)})
+	}
+	body, err := json.Marshal(push)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode Loki push request: %w", err)
+	}
+	return body, "application/json", nil
+}
+
+// streamKey identifies a label set regardless of the order of its labels
+func streamKey(labels map[string]string) string {
+	var b strings.Builder
+	for _, name := range slices.Sorted(maps.Keys(labels)) {
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(labels[name])
+		b.WriteByte(',')
+	}
+	return b.String()
+}
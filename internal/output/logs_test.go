@@ -0,0 +1,165 @@
+package output
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+func TestLogsLoki(t *testing.T) {
+	var mu sync.Mutex
+	var pushes []lokiPush
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("X-Scope-OrgID") != "home" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var push lokiPush
+		if err := json.NewDecoder(r.Body).Decode(&push); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		pushes = append(pushes, push)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	logs, err := NewLogs(LogsOptions{
+		URL:    server.URL,
+		Token:  "secret",
+		Tenant: "home",
+		Labels: map[string]string{"job": "fritz"},
+	})
+	if err != nil {
+		t.Fatalf("NewLogs failed: %v", err)
+	}
+
+	timestamp := time.Date(2025, 9, 22, 8, 0, 0, 0, time.UTC)
+	events := []types.CallEvent{
+		{ID: "call-1", Timestamp: timestamp, Type: types.CallTypeRing, Direction: types.CallDirectionInbound, Line: 1, Trunk: "SIP0", Status: types.CallStatusRinging},
+		{ID: "call-2", Timestamp: timestamp, Type: types.CallTypeRing, Direction: types.CallDirectionInbound, Line: 1, Trunk: "SIP0", Status: types.CallStatusRinging},
+		{ID: "private", Timestamp: timestamp, Type: types.CallTypeRing, Line: 2, DoNotRecord: true},
+	}
+	for _, event := range events {
+		if err := logs.PublishCallEvent(context.Background(), event); err != nil {
+			t.Fatalf("PublishCallEvent failed: %v", err)
+		}
+	}
+	logs.LogConnection("mqtt", false, errors.New("broker gone"))
+	if err := logs.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(pushes) != 1 || len(pushes[0].Streams) != 2 {
+		t.Fatalf("Expected one push with a call and a connection stream, got %+v", pushes)
+	}
+
+	calls := pushes[0].Streams[0]
+	expected := map[string]string{"job": "fritz", "kind": "call", "line": "1", "trunk": "SIP0", "direction": "inbound", "type": "ring"}
+	if streamKey(calls.Stream) != streamKey(expected) {
+		t.Errorf("Expected call labels %v, got %v", expected, calls.Stream)
+	}
+	if len(calls.Values) != 2 || calls.Values[0][0] != "1758528000000000000" {
+		t.Fatalf("Expected both recorded calls at the event time, got %v", calls.Values)
+	}
+	var entry LogEntry
+	if err := json.Unmarshal([]byte(calls.Values[0][1]), &entry); err != nil {
+		t.Fatalf("Invalid log line: %v", err)
+	}
+	if entry.Event == nil || entry.Event.ID != "call-1" || entry.Message != "ring on line 1: ringing" {
+		t.Errorf("Unexpected log line %+v", entry)
+	}
+
+	connection := pushes[0].Streams[1]
+	if connection.Stream["connection"] != "mqtt" || connection.Stream["state"] != "offline" {
+		t.Errorf("Expected an offline mqtt connection stream, got %v", connection.Stream)
+	}
+
+	if stats := logs.Stats(); stats.Shipped != 3 || stats.Failed != 0 {
+		t.Errorf("Expected 3 shipped entries, got %+v", stats)
+	}
+	if err := logs.PublishCallEvent(context.Background(), events[0]); !errors.Is(err, ErrLogsClosed) {
+		t.Errorf("Expected ErrLogsClosed after Close, got %v", err)
+	}
+}
+
+func TestLogsJSON(t *testing.T) {
+	var mu sync.Mutex
+	var lines []LogEntry
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/x-ndjson" {
+			http.Error(w, "unexpected content type", http.StatusUnsupportedMediaType)
+			return
+		}
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var entry LogEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			mu.Lock()
+			lines = append(lines, entry)
+			mu.Unlock()
+		}
+	}))
+	defer server.Close()
+
+	logs, err := NewLogs(LogsOptions{URL: server.URL, Format: LogFormatJSON})
+	if err != nil {
+		t.Fatalf("NewLogs failed: %v", err)
+	}
+	logs.LogConnection("callmonitor", true, nil)
+	if err := logs.PublishCallEvent(context.Background(), types.CallEvent{ID: "call", Type: types.CallTypeCall, Line: 3}); err != nil {
+		t.Fatalf("PublishCallEvent failed: %v", err)
+	}
+	_ = logs.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 JSON lines, got %+v", lines)
+	}
+	if lines[0].Labels["state"] != "online" || lines[0].Level != "info" {
+		t.Errorf("Expected an online callmonitor entry, got %+v", lines[0])
+	}
+	if _, exists := lines[1].Labels["trunk"]; exists {
+		t.Errorf("Expected no empty trunk label, got %v", lines[1].Labels)
+	}
+}
+
+func TestLogsRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "entry too far behind", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	logs, err := NewLogs(LogsOptions{URL: server.URL})
+	if err != nil {
+		t.Fatalf("NewLogs failed: %v", err)
+	}
+	logs.LogConnection("mqtt", true, nil)
+	_ = logs.Close()
+	if stats := logs.Stats(); stats.Failed != 1 || stats.Shipped != 0 {
+		t.Errorf("Expected 1 failed entry, got %+v", stats)
+	}
+
+	if _, err := NewLogs(LogsOptions{URL: "loki:3100"}); err == nil {
+		t.Error("Expected an error for a URL without scheme")
+	}
+	if _, err := NewLogs(LogsOptions{URL: server.URL, Format: "syslog"}); err == nil {
+		t.Error("Expected an error for an unsupported format")
+	}
+}
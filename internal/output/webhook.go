@@ -0,0 +1,89 @@
+package output
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// Webhook posts every call event as JSON to a URL. Events flagged as
+// do-not-record are skipped.
+type Webhook struct {
+	url        string
+	token      string
+	httpClient *http.Client
+}
+
+// WebhookOptions configures a webhook sink
+type WebhookOptions struct {
+	URL        string
+	Token      string        // Sent as "Authorization: Bearer ..." if set
+	Timeout    time.Duration // Upper bound for a single request (default: 10s)
+	HTTPClient *http.Client  // Overrides the client built from Timeout
+}
+
+// DefaultWebhookOptions returns the options used when nothing else is configured
+func DefaultWebhookOptions() WebhookOptions {
+	return WebhookOptions{
+		Timeout: 10 * time.Second,
+	}
+}
+
+// withDefaults fills unset fields from DefaultWebhookOptions
+func (o WebhookOptions) withDefaults() WebhookOptions {
+	defaults := DefaultWebhookOptions()
+	if o.Timeout <= 0 {
+		o.Timeout = defaults.Timeout
+	}
+	if o.HTTPClient == nil {
+		o.HTTPClient = &http.Client{Timeout: o.Timeout}
+	}
+	return o
+}
+
+// NewWebhook creates a webhook sink
+func NewWebhook(opts WebhookOptions) (*Webhook, error) {
+	opts = opts.withDefaults()
+	if u, err := url.Parse(opts.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid webhook URL '%s'", opts.URL)
+	}
+	return &Webhook{url: opts.URL, token: opts.Token, httpClient: opts.HTTPClient}, nil
+}
+
+// PublishCallEvent posts the event; any status but 2xx is an error
+func (w *Webhook) PublishCallEvent(ctx context.Context, event types.CallEvent) error {
+	if event.DoNotRecord {
+		return nil
+	}
+	body, err := encodeLine(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if w.token != "" {
+		req.Header.Set("Authorization", "Bearer "+w.token)
+	}
+
+	resp, err := w.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post call event: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("webhook rejected call event with HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(message))
+	}
+	return nil
+}
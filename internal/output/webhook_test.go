@@ -0,0 +1,55 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+func TestWebhook(t *testing.T) {
+	var received []types.CallEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var event types.CallEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		received = append(received, event)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	webhook, err := NewWebhook(WebhookOptions{URL: server.URL, Token: "secret"})
+	if err != nil {
+		t.Fatalf("NewWebhook failed: %v", err)
+	}
+	if err := webhook.PublishCallEvent(context.Background(), types.CallEvent{ID: "call", Type: types.CallTypeRing}); err != nil {
+		t.Fatalf("PublishCallEvent failed: %v", err)
+	}
+	if err := webhook.PublishCallEvent(context.Background(), types.CallEvent{ID: "private", DoNotRecord: true}); err != nil {
+		t.Fatalf("PublishCallEvent failed: %v", err)
+	}
+	if len(received) != 1 || received[0].ID != "call" {
+		t.Errorf("Expected only the recorded call posted, got %+v", received)
+	}
+
+	unauthorized, err := NewWebhook(WebhookOptions{URL: server.URL})
+	if err != nil {
+		t.Fatalf("NewWebhook failed: %v", err)
+	}
+	if err := unauthorized.PublishCallEvent(context.Background(), types.CallEvent{ID: "call"}); err == nil {
+		t.Error("Expected an error for a rejected request")
+	}
+
+	if _, err := NewWebhook(WebhookOptions{URL: "example.com/hook"}); err == nil {
+		t.Error("Expected an error for a URL without scheme")
+	}
+}
@@ -0,0 +1,50 @@
+package output
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// Writer writes every call event as a line of JSON to an io.Writer, e.g.
+// standard output for a log collector. Events flagged as do-not-record are skipped.
+type Writer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriter creates a writer sink
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// PublishCallEvent writes the event as a single line
+func (w *Writer) PublishCallEvent(_ context.Context, event types.CallEvent) error {
+	if event.DoNotRecord {
+		return nil
+	}
+	line, err := encodeLine(event)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, err := w.w.Write(line); err != nil {
+		return fmt.Errorf("failed to write call event: %w", err)
+	}
+	return nil
+}
+
+// encodeLine returns the event as JSON terminated by a newline
+func encodeLine(event types.CallEvent) ([]byte, error) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode call event: %w", err)
+	}
+	return append(line, '\n'), nil
+}
@@ -0,0 +1,107 @@
+package phone
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+	"github.com/nyaruka/phonenumbers"
+)
+
+// Number formats of the call event payloads
+const (
+	FormatE164     = "e164"     // Normalized numbers, e.g. "+4930123456"
+	FormatNational = "national" // Numbers of the own country without country code, e.g. "030 123456"
+	FormatRaw      = "raw"      // Numbers as received from the Fritz!Box
+	FormatAll      = "all"      // E.164 numbers plus caller_numbers and called_numbers with all formats
+)
+
+// ParseFormat validates a payload number format; empty selects FormatE164
+func ParseFormat(format string) (string, error) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	switch format {
+	case "":
+		return FormatE164, nil
+	case FormatE164, FormatNational, FormatRaw, FormatAll:
+		return format, nil
+	}
+	return "", fmt.Errorf("unsupported number format '%s', expected e164, national, raw or all", format)
+}
+
+// Formatter rewrites the numbers of call events into the payload number
+// format. It is applied right before publishing, so the bridge matches MSNs,
+// VIPs and contacts on the E.164 numbers regardless of the format.
+type Formatter struct {
+	format string
+	region string // Region of national numbers, empty if unknown
+}
+
+// NewFormatter creates a formatter for the number format. The normalizer
+// provides the own region for national numbers; without one, national
+// numbers keep their E.164 format.
+func NewFormatter(format string, normalizer *Normalizer) (*Formatter, error) {
+	format, err := ParseFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	f := &Formatter{format: format}
+	if normalizer != nil {
+		f.region = normalizer.Region()
+	}
+	return f, nil
+}
+
+// Unchanged reports whether the numbers stay in E.164 format
+func (f *Formatter) Unchanged() bool {
+	return f.format == FormatE164
+}
+
+// Format returns the event with its numbers in the configured format
+func (f *Formatter) Format(event types.CallEvent) types.CallEvent {
+	switch f.format {
+	case FormatNational:
+		event.Caller = f.National(event.Caller)
+		event.Called = f.National(event.Called)
+	case FormatRaw:
+		event.Caller = raw(event.Caller, event.CallerRaw)
+		event.Called = raw(event.Called, event.CalledRaw)
+	case FormatAll:
+		event.CallerNumbers = f.numbers(event.Caller, event.CallerRaw)
+		event.CalledNumbers = f.numbers(event.Called, event.CalledRaw)
+	}
+	return event
+}
+
+// National returns the national format of an E.164 number of the own region,
+// e.g. "030 123456", and the international format of other countries. Numbers
+// that are not in E.164 format, like internal dial codes, are returned unchanged.
+func (f *Formatter) National(number string) string {
+	if f.region == "" || !strings.HasPrefix(number, "+") {
+		return number
+	}
+	parsed, err := phonenumbers.Parse(number, f.region)
+	if err != nil {
+		return number
+	}
+	if phonenumbers.GetRegionCodeForNumber(parsed) != f.region {
+		return phonenumbers.Format(parsed, phonenumbers.INTERNATIONAL)
+	}
+	return phonenumbers.Format(parsed, phonenumbers.NATIONAL)
+}
+
+// numbers returns a number in every format, nil for calls without number
+func (f *Formatter) numbers(number, received string) *types.NumberFormats {
+	if number == "" && received == "" {
+		return nil
+	}
+	return &types.NumberFormats{E164: number, National: f.National(number), Raw: raw(number, received)}
+}
+
+// raw returns the number as received, or the normalized one for events
+// without it, e.g. of the call list backfill
+func raw(number, received string) string {
+	if received == "" {
+		return number
+	}
+	return received
+}
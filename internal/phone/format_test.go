@@ -0,0 +1,103 @@
+package phone
+
+import (
+	"testing"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		format      string
+		expected    string
+		expectError bool
+	}{
+		{"", FormatE164, false},
+		{"E164", FormatE164, false},
+		{" national ", FormatNational, false},
+		{"raw", FormatRaw, false},
+		{"all", FormatAll, false},
+		{"international", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			format, err := ParseFormat(tt.format)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("ParseFormat() error = %v, expectError %v", err, tt.expectError)
+			}
+			if format != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, format)
+			}
+		})
+	}
+}
+
+func TestFormatterNational(t *testing.T) {
+	normalizer, err := NewNormalizer("DE", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create normalizer: %v", err)
+	}
+	formatter, err := NewFormatter(FormatNational, normalizer)
+	if err != nil {
+		t.Fatalf("Failed to create formatter: %v", err)
+	}
+
+	tests := []struct {
+		number   string
+		expected string
+	}{
+		{"+4930123456", "030 123456"},
+		{"+43123456789", "+43 1 23456789"},
+		{"**610", "**610"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := formatter.National(tt.number); got != tt.expected {
+			t.Errorf("National(%q): expected %q, got %q", tt.number, tt.expected, got)
+		}
+	}
+}
+
+func TestFormatterFormat(t *testing.T) {
+	normalizer, err := NewNormalizer("DE", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create normalizer: %v", err)
+	}
+	event := types.CallEvent{Caller: "+4930123456", CallerRaw: "030123456", Called: "+4989654321"}
+
+	tests := []struct {
+		format         string
+		expectedCaller string
+		expectedCalled string
+	}{
+		{FormatE164, "+4930123456", "+4989654321"},
+		{FormatNational, "030 123456", "089 654321"},
+		{FormatRaw, "030123456", "+4989654321"}, // Without the received number the normalized one is kept
+		{FormatAll, "+4930123456", "+4989654321"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			formatter, err := NewFormatter(tt.format, normalizer)
+			if err != nil {
+				t.Fatalf("Failed to create formatter: %v", err)
+			}
+			formatted := formatter.Format(event)
+			if formatted.Caller != tt.expectedCaller || formatted.Called != tt.expectedCalled {
+				t.Errorf("Expected %s -> %s, got %s -> %s", tt.expectedCaller, tt.expectedCalled, formatted.Caller, formatted.Called)
+			}
+			if (formatted.CallerNumbers != nil) != (tt.format == FormatAll) {
+				t.Errorf("Expected caller_numbers only with format all, got %+v", formatted.CallerNumbers)
+			}
+		})
+	}
+
+	formatter, _ := NewFormatter(FormatAll, normalizer)
+	numbers := formatter.Format(event).CallerNumbers
+	if numbers == nil || *numbers != (types.NumberFormats{E164: "+4930123456", National: "030 123456", Raw: "030123456"}) {
+		t.Errorf("Unexpected caller numbers %+v", numbers)
+	}
+	if event.CallerNumbers != nil {
+		t.Error("Format must not change the event it was given")
+	}
+}
@@ -0,0 +1,148 @@
+package phone
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+	"github.com/nyaruka/phonenumbers"
+)
+
+// Normalizer converts phone numbers as reported by the Fritz!Box into E.164 format
+type Normalizer struct {
+	region        string // ISO 3166-1 alpha-2 region code (e.g. "DE")
+	localAreaCode string // Local area code without national prefix (e.g. "30")
+}
+
+// NewNormalizer creates a new phone number normalizer.
+// If region is empty, it is derived from countryCode (e.g. "49" -> "DE").
+// localAreaCode is prepended to numbers dialed without area code; a leading
+// national prefix ("0") is accepted and stripped.
+func NewNormalizer(region, countryCode, localAreaCode string) (*Normalizer, error) {
+	region = strings.ToUpper(strings.TrimSpace(region))
+
+	if region == "" && countryCode != "" {
+		code, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(countryCode), "+"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid country code '%s': %w", countryCode, err)
+		}
+		region = phonenumbers.GetRegionCodeForCountryCode(code)
+	}
+
+	if region == "" || region == phonenumbers.UNKNOWN_REGION {
+		return nil, fmt.Errorf("unable to determine region (region '%s', country code '%s')", region, countryCode)
+	}
+
+	if phonenumbers.GetCountryCodeForRegion(region) == 0 {
+		return nil, fmt.Errorf("unsupported region '%s'", region)
+	}
+
+	return &Normalizer{
+		region:        region,
+		localAreaCode: strings.TrimLeft(strings.TrimSpace(localAreaCode), "0"),
+	}, nil
+}
+
+// Region returns the region used for parsing national numbers
+func (n *Normalizer) Region() string {
+	return n.region
+}
+
+// Normalize returns the E.164 representation of a phone number.
+// Numbers that cannot be parsed (e.g. internal "**" extensions) are returned
+// unchanged, like emergency numbers and short codes, which have no area or
+// country code. Premium rate numbers of the own country, which cannot be
+// called from abroad, are returned without spaces.
+func (n *Normalizer) Normalize(number string) string {
+	raw := strings.TrimSpace(number)
+	// Internal extensions and feature codes (e.g. "**610") are not dialable numbers
+	if raw == "" || strings.ContainsAny(raw, "*#") || n.isShortNumber(raw) {
+		return raw
+	}
+
+	candidate := raw
+
+	// Fritz!Box reports international numbers with "00" prefix
+	if strings.HasPrefix(candidate, "00") {
+		candidate = "+" + candidate[2:]
+	}
+
+	// Numbers without any prefix were dialed locally and lack the area code
+	if !strings.HasPrefix(candidate, "+") && !strings.HasPrefix(candidate, "0") && n.localAreaCode != "" && isDigits(candidate) {
+		candidate = "0" + n.localAreaCode + candidate
+	}
+
+	parsed, err := phonenumbers.Parse(candidate, n.region)
+	if err != nil {
+		return raw
+	}
+
+	if !strings.HasPrefix(candidate, "+") && phonenumbers.GetNumberType(parsed) == phonenumbers.PREMIUM_RATE {
+		return strings.Join(strings.Fields(raw), "")
+	}
+
+	return phonenumbers.Format(parsed, phonenumbers.E164)
+}
+
+// Classify returns the type of a number as returned by Normalize. Internal
+// dial codes, empty numbers of anonymous callers and numbers that are not
+// valid in any region have no type.
+func (n *Normalizer) Classify(number string) types.NumberType {
+	raw := strings.TrimSpace(number)
+	if raw == "" || strings.ContainsAny(raw, "*#") {
+		return ""
+	}
+	if phonenumbers.IsEmergencyNumber(raw, n.region) {
+		return types.NumberTypeEmergency
+	}
+	if n.isShortNumber(raw) {
+		return types.NumberTypeService
+	}
+
+	parsed, err := phonenumbers.Parse(raw, n.region)
+	if err != nil {
+		return ""
+	}
+	if int(parsed.GetCountryCode()) != phonenumbers.GetCountryCodeForRegion(n.region) {
+		return types.NumberTypeInternational
+	}
+
+	switch phonenumbers.GetNumberType(parsed) {
+	case phonenumbers.PREMIUM_RATE:
+		return types.NumberTypePremium
+	case phonenumbers.TOLL_FREE, phonenumbers.SHARED_COST, phonenumbers.UAN, phonenumbers.VOICEMAIL, phonenumbers.PERSONAL_NUMBER:
+		return types.NumberTypeService
+	case phonenumbers.MOBILE:
+		return types.NumberTypeMobile
+	case phonenumbers.FIXED_LINE, phonenumbers.FIXED_LINE_OR_MOBILE, phonenumbers.VOIP:
+		return types.NumberTypeLandline
+	}
+	return ""
+}
+
+// isShortNumber reports whether a number as dialed is an emergency number or
+// a short code of the region, e.g. "112" or "11833"
+func (n *Normalizer) isShortNumber(raw string) bool {
+	if !isDigits(raw) {
+		return false
+	}
+	if phonenumbers.IsEmergencyNumber(raw, n.region) {
+		return true
+	}
+	parsed, err := phonenumbers.Parse(raw, n.region)
+	return err == nil && phonenumbers.IsValidShortNumberForRegion(parsed, n.region)
+}
+
+// isDigits reports whether s only consists of ASCII digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,209 @@
+package phone
+
+import (
+	"testing"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+func TestNewNormalizer(t *testing.T) {
+	tests := []struct {
+		name           string
+		region         string
+		countryCode    string
+		expectedRegion string
+		expectError    bool
+	}{
+		{"region derived from DE country code", "", "49", "DE", false},
+		{"region derived from AT country code", "", "43", "AT", false},
+		{"region derived from CH country code", "", "41", "CH", false},
+		{"country code with plus", "", "+49", "DE", false},
+		{"explicit region wins", "at", "49", "AT", false},
+		{"invalid country code", "", "abc", "", true},
+		{"unknown country code", "", "999", "", true},
+		{"unsupported region", "XX", "", "", true},
+		{"no region and no country code", "", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n, err := NewNormalizer(tt.region, tt.countryCode, "")
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error, but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if n.Region() != tt.expectedRegion {
+				t.Errorf("Expected region %s, got %s", tt.expectedRegion, n.Region())
+			}
+		})
+	}
+}
+
+func TestNormalizeGermany(t *testing.T) {
+	n, err := NewNormalizer("", "49", "30")
+	if err != nil {
+		t.Fatalf("Failed to create normalizer: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"local number without area code", "123456789", "+4930123456789"},
+		{"short local number", "990134", "+4930990134"},
+		{"national landline", "030123456789", "+4930123456789"},
+		{"national landline other area", "0618112345", "+49618112345"},
+		{"national mobile", "01784567890", "+491784567890"},
+		{"long national mobile", "0178123456789", "+49178123456789"},
+		{"international with 00", "00493012345678", "+493012345678"},
+		{"international with plus", "+4961813698237", "+4961813698237"},
+		{"foreign number with 00", "0041441234567", "+41441234567"},
+		{"number with spaces", " 030 1234567 ", "+49301234567"},
+		{"service number", "08001234567", "+498001234567"},
+		{"police is not a local number", "110", "110"},
+		{"emergency number", "112", "112"},
+		{"short code", "11833", "11833"},
+		{"premium number stays national", "0900 1234567", "09001234567"},
+		{"foreign premium number", "00419001234567", "+419001234567"},
+		{"internal extension", "**610", "**610"},
+		{"empty number", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := n.Normalize(tt.input); got != tt.expected {
+				t.Errorf("Normalize(%q) = %q, expected %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNormalizeGermanyWithLeadingZeroAreaCode(t *testing.T) {
+	n, err := NewNormalizer("", "49", "06181")
+	if err != nil {
+		t.Fatalf("Failed to create normalizer: %v", err)
+	}
+
+	// Regression: the previous implementation dropped a digit when prepending the area code
+	if got := n.Normalize("3698237"); got != "+4961813698237" {
+		t.Errorf("Normalize(3698237) = %q, expected +4961813698237", got)
+	}
+}
+
+func TestNormalizeGermanyWithoutAreaCode(t *testing.T) {
+	n, err := NewNormalizer("DE", "", "")
+	if err != nil {
+		t.Fatalf("Failed to create normalizer: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"national landline", "030123456", "+4930123456"},
+		{"local number is kept in national form", "123456", "+49123456"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := n.Normalize(tt.input); got != tt.expected {
+				t.Errorf("Normalize(%q) = %q, expected %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNormalizeAustria(t *testing.T) {
+	n, err := NewNormalizer("", "43", "1")
+	if err != nil {
+		t.Fatalf("Failed to create normalizer: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"Vienna local number", "5123456", "+4315123456"},
+		{"national landline Graz", "0316123456", "+43316123456"},
+		{"national mobile", "06641234567", "+436641234567"},
+		{"international with 00", "00436641234567", "+436641234567"},
+		{"German number from Austria", "00493012345678", "+493012345678"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := n.Normalize(tt.input); got != tt.expected {
+				t.Errorf("Normalize(%q) = %q, expected %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNormalizeSwitzerland(t *testing.T) {
+	n, err := NewNormalizer("", "41", "44")
+	if err != nil {
+		t.Fatalf("Failed to create normalizer: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"Zurich local number", "2345678", "+41442345678"},
+		{"national landline Bern", "0311234567", "+41311234567"},
+		{"national mobile", "0791234567", "+41791234567"},
+		{"mobile with spaces", "079 123 45 67", "+41791234567"},
+		{"international with plus", "+41791234567", "+41791234567"},
+		{"Austrian number from Switzerland", "00436641234567", "+436641234567"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := n.Normalize(tt.input); got != tt.expected {
+				t.Errorf("Normalize(%q) = %q, expected %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	n, err := NewNormalizer("", "49", "30")
+	if err != nil {
+		t.Fatalf("Failed to create normalizer: %v", err)
+	}
+
+	tests := []struct {
+		input    string
+		expected types.NumberType
+	}{
+		{"110", types.NumberTypeEmergency},
+		{"112", types.NumberTypeEmergency},
+		{"0900 1234567", types.NumberTypePremium},
+		{"11833", types.NumberTypeService},
+		{"08001234567", types.NumberTypeService},
+		{"01801234567", types.NumberTypeService},
+		{"01784567890", types.NumberTypeMobile},
+		{"030123456789", types.NumberTypeLandline},
+		{"990134", types.NumberTypeLandline},
+		{"0041441234567", types.NumberTypeInternational},
+		{"+41791234567", types.NumberTypeInternational},
+		{"**610", ""},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		// Events carry the normalized numbers
+		if got := n.Classify(n.Normalize(tt.input)); got != tt.expected {
+			t.Errorf("Classify(%q) = %q, expected %q", tt.input, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package report
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/database"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// CallStore provides the answered calls of a period
+type CallStore interface {
+	ListAnsweredCalls(ctx context.Context, from, to time.Time) ([]database.AnsweredCall, error)
+}
+
+// Sender delivers a finished report, e.g. via mail
+type Sender interface {
+	Send(subject, body string, attachments []Attachment) error
+}
+
+// Generator creates the monthly call report once the month is over. It is
+// meant to run periodically; reports already in the directory are not created
+// again, reports whose mail failed are sent on the next run.
+type Generator struct {
+	store    CallStore
+	dir      string
+	location *time.Location
+	currency string
+	tariffs  types.Tariffs
+	contacts map[string]string
+	sender   Sender
+	clock    clock.Clock
+}
+
+// Options configures a generator
+type Options struct {
+	Dir      string            // Directory the CSV and HTML files are written to
+	Location *time.Location    // Timezone of the month boundaries and call times
+	Currency string            // Shown with the estimated costs
+	Tariffs  types.Tariffs     // Prices of outbound calls
+	Contacts map[string]string // Names of known numbers
+	Sender   Sender            // Sends new reports if set
+	Clock    clock.Clock       // Overrides the real clock, e.g. in tests
+}
+
+// DefaultOptions returns the options used when nothing else is configured
+func DefaultOptions() Options {
+	return Options{
+		Location: time.Local,
+		Currency: "EUR",
+		Clock:    clock.Real(),
+	}
+}
+
+// withDefaults fills unset fields from DefaultOptions
+func (o Options) withDefaults() Options {
+	defaults := DefaultOptions()
+	if o.Location == nil {
+		o.Location = defaults.Location
+	}
+	if o.Currency == "" {
+		o.Currency = defaults.Currency
+	}
+	if o.Clock == nil {
+		o.Clock = defaults.Clock
+	}
+	return o
+}
+
+// NewGenerator creates a generator for the calls of store
+func NewGenerator(store CallStore, opts Options) *Generator {
+	opts = opts.withDefaults()
+	return &Generator{
+		store:    store,
+		dir:      opts.Dir,
+		location: opts.Location,
+		currency: opts.Currency,
+		tariffs:  opts.Tariffs,
+		contacts: opts.Contacts,
+		sender:   opts.Sender,
+		clock:    opts.Clock,
+	}
+}
+
+// Run creates the report of the previous month unless it exists already, or
+// sends it again if the last mail failed
+func (g *Generator) Run(ctx context.Context) error {
+	now := g.clock.Now().In(g.location)
+	month := time.Date(now.Year(), now.Month()-1, 1, 0, 0, 0, 0, g.location)
+
+	created, err := exists(g.path(month, ".csv"))
+	if err != nil {
+		return fmt.Errorf("failed to check report: %w", err)
+	}
+	unsent, err := exists(g.path(month, unsentExt))
+	if err != nil {
+		return fmt.Errorf("failed to check report: %w", err)
+	}
+	if created && (!unsent || g.sender == nil) {
+		return nil
+	}
+
+	_, err = g.Generate(ctx, month)
+	return err
+}
+
+// unsentExt marks a report whose mail was not sent yet
+const unsentExt = ".unsent"
+
+// Generate creates the report of the month starting at month, writes it to
+// the directory and sends it. The CSV file is written last, so a report
+// counts as created once it exists; until the mail is sent, a marker file
+// keeps it pending.
+func (g *Generator) Generate(ctx context.Context, month time.Time) (Report, error) {
+	calls, err := g.store.ListAnsweredCalls(ctx, month, month.AddDate(0, 1, 0))
+	if err != nil {
+		return Report{}, err
+	}
+	report := Build(month, calls, g.contacts, g.tariffs, g.currency)
+
+	var csvData, htmlData bytes.Buffer
+	if err := report.WriteCSV(&csvData); err != nil {
+		return Report{}, fmt.Errorf("failed to render CSV report: %w", err)
+	}
+	if err := report.WriteHTML(&htmlData); err != nil {
+		return Report{}, fmt.Errorf("failed to render HTML report: %w", err)
+	}
+
+	if err := os.MkdirAll(g.dir, 0755); err != nil {
+		return Report{}, fmt.Errorf("failed to create report directory: %w", err)
+	}
+	if err := writeFile(g.path(month, ".html"), htmlData.Bytes()); err != nil {
+		return Report{}, err
+	}
+	if g.sender != nil {
+		if err := writeFile(g.path(month, unsentExt), nil); err != nil {
+			return Report{}, err
+		}
+	}
+	if err := writeFile(g.path(month, ".csv"), csvData.Bytes()); err != nil {
+		return Report{}, err
+	}
+	log.Printf("Created call report %s with %d calls", g.path(month, ".csv"), len(report.Items))
+
+	if g.sender == nil {
+		return report, nil
+	}
+	subject := "Call report " + month.Format("January 2006")
+	body := fmt.Sprintf("%d answered calls, %s total talk time, estimated cost %.2f %s.\n",
+		len(report.Items), formatDuration(report.TotalDuration), report.TotalCost, report.Currency)
+	err = g.sender.Send(subject, body, []Attachment{
+		{Name: report.Name() + ".csv", ContentType: "text/csv", Data: csvData.Bytes()},
+		{Name: report.Name() + ".html", ContentType: "text/html", Data: htmlData.Bytes()},
+	})
+	if err != nil {
+		return report, fmt.Errorf("failed to send call report: %w", err)
+	}
+	if err := os.Remove(g.path(month, unsentExt)); err != nil {
+		return report, fmt.Errorf("failed to mark call report as sent: %w", err)
+	}
+	return report, nil
+}
+
+// path returns the file of the report of a month with the given extension
+func (g *Generator) path(month time.Time, ext string) string {
+	return filepath.Join(g.dir, Report{Month: month}.Name()+ext)
+}
+
+// exists reports whether a file exists at path
+func exists(path string) (bool, error) {
+	_, err := os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// writeFile replaces the file at once, so readers never see a partial report
+func writeFile(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create report file: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write report file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write report file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to store report file: %w", err)
+	}
+	return nil
+}
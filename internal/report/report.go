@@ -0,0 +1,127 @@
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/database"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// Item is a single answered call of a report
+type Item struct {
+	Time      time.Time // Start of the conversation
+	Number    string    // Number of the remote party
+	Name      string    // Contact name of the number, if known
+	Direction types.CallDirection
+	Duration  int     // Talk time in seconds
+	Cost      float64 // Estimated cost, inbound calls are free
+}
+
+// Report lists the answered calls of a month
+type Report struct {
+	Month         time.Time // First day of the month in the report timezone
+	Currency      string
+	Items         []Item
+	TotalDuration int
+	TotalCost     float64
+}
+
+// Build creates the report of the calls of a month. Times are shown in the location of month.
+func Build(month time.Time, calls []database.AnsweredCall, contacts map[string]string, tariffs types.Tariffs, currency string) Report {
+	report := Report{Month: month, Currency: currency, Items: make([]Item, 0, len(calls))}
+	for _, call := range calls {
+		item := Item{
+			Time:      call.Ended.Add(-time.Duration(call.Duration) * time.Second).In(month.Location()),
+			Number:    call.Caller,
+			Direction: call.Direction,
+			Duration:  call.Duration,
+		}
+		if call.Direction == types.CallDirectionOutbound {
+			item.Number = call.Called
+			item.Cost = tariffs.Cost(call.Called, call.Duration)
+		}
+		item.Name = contacts[item.Number]
+
+		report.Items = append(report.Items, item)
+		report.TotalDuration += item.Duration
+		report.TotalCost += item.Cost
+	}
+	return report
+}
+
+// Name returns the file name of the report without extension, e.g. calls-2025-09
+func (r Report) Name() string {
+	return "calls-" + r.Month.Format("2006-01")
+}
+
+// WriteCSV writes the report as CSV with a header line
+func (r Report) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	_ = writer.Write([]string{"date", "number", "name", "direction", "duration", "cost"})
+	for _, item := range r.Items {
+		_ = writer.Write([]string{
+			item.Time.Format(time.DateTime),
+			item.Number,
+			item.Name,
+			string(item.Direction),
+			strconv.Itoa(item.Duration),
+			strconv.FormatFloat(item.Cost, 'f', 2, 64),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteHTML writes the report as print-ready HTML page, e.g. for saving as PDF from a browser
+func (r Report) WriteHTML(w io.Writer) error {
+	return htmlTemplate.Execute(w, r)
+}
+
+// formatDuration formats seconds as h:mm:ss
+func formatDuration(seconds int) string {
+	return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"duration": formatDuration,
+	"cost":     func(cost float64) string { return strconv.FormatFloat(cost, 'f', 2, 64) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Calls {{.Month.Format "January 2006"}}</title>
+<style>
+@page { size: A4; margin: 15mm; }
+body { font-family: sans-serif; font-size: 10pt; }
+table { width: 100%; border-collapse: collapse; }
+th, td { padding: 2pt 4pt; border-bottom: 1px solid #ccc; text-align: left; }
+th { border-bottom: 2px solid #000; }
+thead { display: table-header-group; }
+tr { page-break-inside: avoid; }
+.number { text-align: right; }
+tfoot td { font-weight: bold; border-top: 2px solid #000; border-bottom: none; }
+</style>
+</head>
+<body>
+<h1>Calls {{.Month.Format "January 2006"}}</h1>
+<table>
+<thead>
+<tr><th>Date</th><th>Number</th><th>Name</th><th>Direction</th><th class="number">Duration</th><th class="number">Cost ({{.Currency}})</th></tr>
+</thead>
+<tbody>
+{{- range .Items}}
+<tr><td>{{.Time.Format "2006-01-02 15:04"}}</td><td>{{.Number}}</td><td>{{.Name}}</td><td>{{.Direction}}</td><td class="number">{{duration .Duration}}</td><td class="number">{{cost .Cost}}</td></tr>
+{{- end}}
+</tbody>
+<tfoot>
+<tr><td colspan="4">{{len .Items}} calls</td><td class="number">{{duration .TotalDuration}}</td><td class="number">{{cost .TotalCost}}</td></tr>
+</tfoot>
+</table>
+</body>
+</html>
+`))
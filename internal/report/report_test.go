@@ -0,0 +1,177 @@
+package report
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/database"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+type fakeStore struct {
+	calls    []database.AnsweredCall
+	from, to time.Time
+}
+
+func (s *fakeStore) ListAnsweredCalls(ctx context.Context, from, to time.Time) ([]database.AnsweredCall, error) {
+	s.from, s.to = from, to
+	return s.calls, nil
+}
+
+type fakeSender struct {
+	subjects    []string
+	attachments []Attachment
+	err         error
+}
+
+func (s *fakeSender) Send(subject, body string, attachments []Attachment) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.subjects = append(s.subjects, subject)
+	s.attachments = attachments
+	return nil
+}
+
+func TestGenerator(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("Timezone data not available: %v", err)
+	}
+
+	store := &fakeStore{calls: []database.AnsweredCall{
+		{CallID: "in", Ended: time.Date(2025, 9, 1, 8, 1, 0, 0, time.UTC), Direction: types.CallDirectionInbound, Caller: "+4930123456", Called: "990133", Duration: 60},
+		{CallID: "out", Ended: time.Date(2025, 9, 2, 12, 0, 0, 0, time.UTC), Direction: types.CallDirectionOutbound, Caller: "990133", Called: "01701234567", Duration: 125},
+	}}
+	sender := &fakeSender{}
+	fake := clock.NewFake(time.Date(2025, 10, 1, 0, 30, 0, 0, berlin))
+	dir := filepath.Join(t.TempDir(), "reports")
+
+	generator := NewGenerator(store, Options{
+		Dir:      dir,
+		Location: berlin,
+		Tariffs:  types.Tariffs{{Prefix: "01", PerMinute: 0.09}},
+		Contacts: map[string]string{"+4930123456": "ACME, Inc."},
+		Sender:   sender,
+		Clock:    fake,
+	})
+
+	if err := generator.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if !store.from.Equal(time.Date(2025, 9, 1, 0, 0, 0, 0, berlin)) || !store.to.Equal(time.Date(2025, 10, 1, 0, 0, 0, 0, berlin)) {
+		t.Errorf("Expected calls of September in Berlin, got %v - %v", store.from, store.to)
+	}
+
+	csvData, err := os.ReadFile(filepath.Join(dir, "calls-2025-09.csv"))
+	if err != nil {
+		t.Fatalf("Expected CSV report: %v", err)
+	}
+	expected := "date,number,name,direction,duration,cost\n" +
+		"2025-09-01 10:00:00,+4930123456,\"ACME, Inc.\",inbound,60,0.00\n" +
+		"2025-09-02 13:57:55,01701234567,,outbound,125,0.27\n"
+	if string(csvData) != expected {
+		t.Errorf("Unexpected CSV report:\n%s", csvData)
+	}
+
+	htmlData, err := os.ReadFile(filepath.Join(dir, "calls-2025-09.html"))
+	if err != nil {
+		t.Fatalf("Expected HTML report: %v", err)
+	}
+	for _, expected := range []string{"<h1>Calls September 2025</h1>", "<td>ACME, Inc.</td>", "<td class=\"number\">0:03:05</td><td class=\"number\">0.27</td>"} {
+		if !strings.Contains(string(htmlData), expected) {
+			t.Errorf("Expected HTML report to contain %q:\n%s", expected, htmlData)
+		}
+	}
+
+	if len(sender.subjects) != 1 || sender.subjects[0] != "Call report September 2025" || len(sender.attachments) != 2 {
+		t.Fatalf("Expected report to be sent once with 2 attachments, got %v", sender.subjects)
+	}
+	if string(sender.attachments[0].Data) != expected {
+		t.Errorf("Expected CSV attachment to match the file")
+	}
+
+	// Later runs in the same month keep the existing report
+	fake.Advance(24 * time.Hour)
+	if err := generator.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(sender.subjects) != 1 {
+		t.Errorf("Expected report to be created only once, got %d mails", len(sender.subjects))
+	}
+}
+
+func TestGeneratorRetriesFailedMail(t *testing.T) {
+	store := &fakeStore{calls: []database.AnsweredCall{
+		{CallID: "in", Ended: time.Date(2025, 9, 1, 8, 1, 0, 0, time.UTC), Direction: types.CallDirectionInbound, Caller: "+4930123456", Called: "990133", Duration: 60},
+	}}
+	sender := &fakeSender{err: errors.New("connection refused")}
+	fake := clock.NewFake(time.Date(2025, 10, 1, 12, 0, 0, 0, time.UTC))
+	dir := t.TempDir()
+
+	generator := NewGenerator(store, Options{Dir: dir, Location: time.UTC, Sender: sender, Clock: fake})
+
+	if err := generator.Run(context.Background()); err == nil {
+		t.Fatal("Expected the failed mail to be reported")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "calls-2025-09.csv")); err != nil {
+		t.Fatalf("Expected CSV report despite the failed mail: %v", err)
+	}
+
+	// The next run sends the report that is still pending
+	sender.err = nil
+	fake.Advance(time.Hour)
+	if err := generator.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(sender.subjects) != 1 {
+		t.Fatalf("Expected the report to be sent on the next run, got %d mails", len(sender.subjects))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "calls-2025-09.unsent")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected the pending marker to be removed, got %v", err)
+	}
+
+	fake.Advance(time.Hour)
+	if err := generator.Run(context.Background()); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+	if len(sender.subjects) != 1 {
+		t.Errorf("Expected the report to be sent only once, got %d mails", len(sender.subjects))
+	}
+}
+
+func TestMessage(t *testing.T) {
+	message, err := Message("pbx@example.com", []string{"anna@example.com", "ben@example.com"}, "Call report September 2025", "2 calls\n",
+		[]Attachment{{Name: "calls-2025-09.csv", ContentType: "text/csv", Data: []byte(strings.Repeat("a", 100))}},
+		time.Date(2025, 10, 1, 0, 30, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Message failed: %v", err)
+	}
+
+	for _, expected := range []string{
+		"From: pbx@example.com\r\n",
+		"To: anna@example.com, ben@example.com\r\n",
+		"Subject: Call report September 2025\r\n",
+		"Date: Wed, 01 Oct 2025 00:30:00 +0000\r\n",
+		"Content-Type: multipart/mixed; boundary=",
+		"\r\n2 calls\r\n",
+		"Content-Disposition: attachment; filename=calls-2025-09.csv\r\n",
+	} {
+		if !strings.Contains(string(message), expected) {
+			t.Errorf("Expected message to contain %q:\n%s", expected, message)
+		}
+	}
+	_, body, _ := strings.Cut(string(message), "\r\n\r\n")
+	for _, line := range strings.Split(body, "\r\n") {
+		if len(line) > 76 {
+			t.Errorf("Line longer than 76 characters: %q", line)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+)
+
+// Job is a unit of work executed periodically by the scheduler
+type Job func(ctx context.Context) error
+
+// Scheduler runs registered jobs at fixed intervals
+type Scheduler struct {
+	mu      sync.Mutex
+	entries []entry
+	wg      sync.WaitGroup
+	started bool
+	clock   clock.Clock
+}
+
+type entry struct {
+	name     string
+	interval time.Duration
+	job      Job
+}
+
+// New creates a new scheduler without any jobs
+func New() *Scheduler {
+	return &Scheduler{clock: clock.Real()}
+}
+
+// SetClock sets the clock driving the job intervals; it must be called before Start
+func (s *Scheduler) SetClock(c clock.Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock = c
+}
+
+// Every registers a job that runs immediately on Start and then once per interval
+func (s *Scheduler) Every(name string, interval time.Duration, job Job) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = append(s.entries, entry{
+		name:     name,
+		interval: interval,
+		job:      job,
+	})
+}
+
+// Start launches all registered jobs in the background until ctx is cancelled
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return
+	}
+	s.started = true
+
+	for _, e := range s.entries {
+		s.wg.Add(1)
+		go s.run(ctx, s.clock, e)
+	}
+}
+
+// Wait blocks until all running jobs have stopped
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+// run executes a single job entry on its interval
+func (s *Scheduler) run(ctx context.Context, clk clock.Clock, e entry) {
+	defer s.wg.Done()
+
+	if e.interval <= 0 {
+		log.Printf("Scheduler: job %s has no valid interval, skipping", e.name)
+		return
+	}
+
+	ticker := clk.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := e.job(ctx); err != nil {
+			log.Printf("Scheduler: job %s failed: %v", e.name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+)
+
+func TestSchedulerRunsJobImmediatelyAndPeriodically(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 9, 21, 15, 35, 0, 0, time.UTC))
+	s := New()
+	s.SetClock(clk)
+
+	runs := make(chan time.Time, 1)
+	s.Every("counter", time.Hour, func(ctx context.Context) error {
+		runs <- clk.Now()
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+
+	start := <-runs
+	for i := 1; i <= 2; i++ {
+		clk.Advance(time.Hour)
+		if got := <-runs; got.Sub(start) != time.Duration(i)*time.Hour {
+			t.Errorf("Expected run %d after %d hours, got %v", i+1, i, got.Sub(start))
+		}
+	}
+
+	cancel()
+	s.Wait()
+}
+
+func TestSchedulerContinuesAfterJobError(t *testing.T) {
+	s := New()
+
+	var runs int32
+	s.Every("failing", 5*time.Millisecond, func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return errors.New("boom")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+
+	time.Sleep(30 * time.Millisecond)
+	cancel()
+	s.Wait()
+
+	if got := atomic.LoadInt32(&runs); got < 2 {
+		t.Errorf("Expected job to be retried after error, got %d runs", got)
+	}
+}
+
+func TestSchedulerSkipsInvalidInterval(t *testing.T) {
+	s := New()
+
+	var runs int32
+	s.Every("invalid", 0, func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.Start(ctx)
+	s.Wait()
+
+	if got := atomic.LoadInt32(&runs); got != 0 {
+		t.Errorf("Expected job with invalid interval not to run, got %d runs", got)
+	}
+}
@@ -0,0 +1,178 @@
+package simulator
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Server emulates the Fritz!Box callmonitor TCP interface and replays the
+// steps to the clients that connect. A client connecting again, e.g. after a
+// scripted disconnect, continues with the steps not sent yet.
+type Server struct {
+	steps    []Step
+	speed    float64 // Replay speed factor (2 = twice as fast, 0 = no delays)
+	listener net.Listener
+	done     chan struct{}
+	wg       sync.WaitGroup
+
+	mu   sync.Mutex
+	next int // Index of the next step to send
+}
+
+// NewServer creates a new simulation server
+func NewServer(steps []Step, speed float64) *Server {
+	return &Server{
+		steps: steps,
+		speed: speed,
+		done:  make(chan struct{}),
+	}
+}
+
+// Start listens on a random local port and returns host and port to connect to
+func (s *Server) Start() (string, int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to start simulation server: %w", err)
+	}
+	s.listener = listener
+
+	s.wg.Add(1)
+	go s.acceptLoop()
+
+	host, portStr, err := net.SplitHostPort(listener.Addr().String())
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to determine simulation address: %w", err)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to determine simulation port: %w", err)
+	}
+
+	return host, port, nil
+}
+
+// Close stops the server and all running replays
+func (s *Server) Close() error {
+	select {
+	case <-s.done:
+		return nil
+	default:
+		close(s.done)
+	}
+
+	var err error
+	if s.listener != nil {
+		err = s.listener.Close()
+	}
+	s.wg.Wait()
+	return err
+}
+
+// acceptLoop accepts callmonitor clients until the server is closed
+func (s *Server) acceptLoop() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.done:
+			default:
+				log.Printf("Simulation server stopped accepting connections: %v", err)
+			}
+			return
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() { _ = conn.Close() }()
+			if err := s.replay(conn); err != nil {
+				log.Printf("Simulation replay aborted: %v", err)
+			}
+		}()
+	}
+}
+
+// replay sends the remaining steps with current timestamps and keeps the
+// connection open afterwards, just like an idle Fritz!Box
+func (s *Server) replay(conn net.Conn) error {
+	step, ok := s.step()
+	if ok {
+		log.Printf("Simulation started: replaying %d callmonitor lines (speed %gx)", s.remaining(), s.speed)
+	}
+
+	for ; ok; step, ok = s.step() {
+		if !s.sleep(step.Delay) {
+			return nil
+		}
+
+		if step.Disconnect {
+			s.advance()
+			log.Println("Simulation: dropping the callmonitor connection")
+			return nil
+		}
+		line := fmt.Sprintf("%s;%s\n", time.Now().Format(timestampLayout), step.Message)
+		if step.Raw {
+			line = step.Message + "\n"
+		}
+		if _, err := conn.Write([]byte(line)); err != nil {
+			return fmt.Errorf("failed to send callmonitor line: %w", err)
+		}
+		s.advance()
+	}
+
+	log.Println("Simulation finished, all callmonitor lines sent")
+	<-s.done
+	return nil
+}
+
+// step returns the next step to send, false once all steps were sent
+func (s *Server) step() (Step, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next >= len(s.steps) {
+		return Step{}, false
+	}
+	return s.steps[s.next], true
+}
+
+// advance marks the next step as sent
+func (s *Server) advance() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next++
+}
+
+// remaining returns the number of steps not sent yet
+func (s *Server) remaining() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.steps) - s.next
+}
+
+// sleep waits for the scaled delay. It returns false if the server is closed.
+func (s *Server) sleep(delay time.Duration) bool {
+	if s.speed <= 0 || delay <= 0 {
+		select {
+		case <-s.done:
+			return false
+		default:
+			return true
+		}
+	}
+
+	timer := time.NewTimer(time.Duration(float64(delay) / s.speed))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-s.done:
+		return false
+	}
+}
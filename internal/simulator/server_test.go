@@ -0,0 +1,128 @@
+package simulator
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServerReplaysSteps(t *testing.T) {
+	steps := []Step{
+		{Delay: 0, Message: "RING;0;0178123456789;990133;SIP4;"},
+		{Delay: time.Hour, Message: "DISCONNECT;0;0;"}, // Skipped with speed 0
+	}
+
+	server := NewServer(steps, 0)
+	host, port, err := server.Start()
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	reader := bufio.NewReader(conn)
+	for _, step := range steps {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read line: %v", err)
+		}
+
+		timestamp, message, _ := strings.Cut(strings.TrimSpace(line), ";")
+		if message != step.Message {
+			t.Errorf("Expected message %q, got %q", step.Message, message)
+		}
+		if _, err := time.Parse(timestampLayout, timestamp); err != nil {
+			t.Errorf("Invalid timestamp %q: %v", timestamp, err)
+		}
+	}
+}
+
+func TestServerCloseStopsReplay(t *testing.T) {
+	server := NewServer([]Step{{Delay: time.Hour, Message: "DISCONNECT;0;0;"}}, 1)
+	host, port, err := server.Start()
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	closed := make(chan struct{})
+	go func() {
+		_ = server.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not stop the running replay")
+	}
+}
+
+func TestServerDisconnectResumes(t *testing.T) {
+	steps := []Step{
+		{Message: "RING;0;0178123456789;990133;SIP4;"},
+		{Message: "garbage", Raw: true},
+		{Disconnect: true},
+		{Message: "DISCONNECT;0;0;"},
+	}
+
+	server := NewServer(steps, 0)
+	host, port, err := server.Start()
+	if err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer server.Close()
+
+	connect := func() (net.Conn, *bufio.Reader) {
+		t.Helper()
+		conn, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		return conn, bufio.NewReader(conn)
+	}
+
+	conn, reader := connect()
+	defer conn.Close()
+	lines := make([]string, 0, 2)
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Expected the server to drop the connection, got %v", err)
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], ";RING;0;0178123456789;990133;SIP4;\n") || lines[1] != "garbage\n" {
+		t.Errorf("Expected the RING and the raw line before the disconnect, got %q", lines)
+	}
+
+	// The reconnected client gets the remaining lines only
+	conn2, reader2 := connect()
+	defer conn2.Close()
+	line, err := reader2.ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read line: %v", err)
+	}
+	if !strings.HasSuffix(line, ";DISCONNECT;0;0;\n") {
+		t.Errorf("Expected the DISCONNECT after the reconnect, got %q", line)
+	}
+}
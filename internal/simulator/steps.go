@@ -0,0 +1,164 @@
+package simulator
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// timestampLayout is the Fritz!Box callmonitor timestamp format
+const timestampLayout = "02.01.06 15:04:05"
+
+// Step is a single callmonitor line to be sent after a delay
+type Step struct {
+	Delay      time.Duration // Delay relative to the previous step
+	Message    string        // Callmonitor line without timestamp (e.g. "RING;0;0301234567;990133;SIP0;")
+	Raw        bool          // Message is sent as is, without timestamp, e.g. a malformed line
+	Disconnect bool          // The server drops the connection instead of sending a line
+}
+
+// LoadFile reads raw Fritz!Box callmonitor lines from a file
+func LoadFile(path string) ([]Step, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open simulation file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	return ParseSteps(file)
+}
+
+// ParseSteps parses raw callmonitor lines. Delays are derived from the
+// timestamps of consecutive lines; empty lines and '#' comments are skipped.
+// Lines starting with '!' script the connection:
+//
+//	!wait 5s      Wait before the next line, on top of its timestamp
+//	!raw TEXT     Send TEXT as is, e.g. a malformed line
+//	!disconnect   Drop the connection; the reconnected client gets the following lines
+func ParseSteps(r io.Reader) ([]Step, error) {
+	var steps []Step
+	var previous time.Time
+	var wait time.Duration
+
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if directive, ok := strings.CutPrefix(line, "!"); ok {
+			name, argument, _ := strings.Cut(directive, " ")
+			argument = strings.TrimSpace(argument)
+			switch name {
+			case "wait":
+				delay, err := time.ParseDuration(argument)
+				if err != nil || delay < 0 {
+					return nil, fmt.Errorf("line %d: invalid wait '%s'", lineNumber, argument)
+				}
+				wait += delay
+			case "raw":
+				steps = append(steps, Step{Delay: wait, Message: argument, Raw: true})
+				wait = 0
+			case "disconnect":
+				steps = append(steps, Step{Delay: wait, Disconnect: true})
+				wait = 0
+			default:
+				return nil, fmt.Errorf("line %d: unknown directive '!%s', expected !wait, !raw or !disconnect", lineNumber, name)
+			}
+			continue
+		}
+
+		timestampStr, message, found := strings.Cut(line, ";")
+		if !found || message == "" {
+			return nil, fmt.Errorf("line %d: invalid callmonitor format: %s", lineNumber, line)
+		}
+
+		timestamp, err := time.Parse(timestampLayout, timestampStr)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid timestamp '%s': %w", lineNumber, timestampStr, err)
+		}
+
+		var delay time.Duration
+		if !previous.IsZero() && timestamp.After(previous) {
+			delay = timestamp.Sub(previous)
+		}
+		previous = timestamp
+
+		steps = append(steps, Step{Delay: delay + wait, Message: message})
+		wait = 0
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read simulation input: %w", err)
+	}
+
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("simulation input contains no callmonitor lines")
+	}
+
+	return steps, nil
+}
+
+// Synthetic generates a set of typical calls: an answered and a missed inbound
+// call, followed by an answered and an unanswered outbound call.
+// ownNumber is used as the local MSN, defaulting to "990133" if empty.
+func Synthetic(ownNumber string) []Step {
+	if ownNumber == "" {
+		ownNumber = "990133"
+	}
+	const external = "01701234567"
+
+	return []Step{
+		// Inbound call, answered on extension 1 and talking for 12 seconds
+		{Delay: 0, Message: fmt.Sprintf("RING;0;%s;%s;SIP0;", external, ownNumber)},
+		{Delay: 4 * time.Second, Message: fmt.Sprintf("CONNECT;0;1;%s;", external)},
+		{Delay: 12 * time.Second, Message: "DISCONNECT;0;12;"},
+
+		// Inbound call, nobody answers
+		{Delay: 5 * time.Second, Message: fmt.Sprintf("RING;0;%s;%s;SIP0;", external, ownNumber)},
+		{Delay: 8 * time.Second, Message: "DISCONNECT;0;0;"},
+
+		// Outbound call from extension 2, answered
+		{Delay: 5 * time.Second, Message: fmt.Sprintf("CALL;1;2;%s;%s;SIP0;", ownNumber, external)},
+		{Delay: 3 * time.Second, Message: fmt.Sprintf("CONNECT;1;2;%s;", external)},
+		{Delay: 20 * time.Second, Message: "DISCONNECT;1;20;"},
+
+		// Outbound call, callee does not pick up
+		{Delay: 5 * time.Second, Message: fmt.Sprintf("CALL;1;2;%s;%s;SIP0;", ownNumber, external)},
+		{Delay: 10 * time.Second, Message: "DISCONNECT;1;0;"},
+	}
+}
+
+// Demo extends the synthetic calls with what a real Fritz!Box does now and
+// then: a garbled line, a connection dropped while a call rings, and a
+// second call arriving while the first one is talking.
+func Demo(ownNumber string) []Step {
+	if ownNumber == "" {
+		ownNumber = "990133"
+	}
+	const external, other = "01701234567", "030123456"
+
+	steps := Synthetic(ownNumber)
+	return append(steps,
+		// A line cut off in transmission
+		Step{Delay: 5 * time.Second, Message: "21.09.25 15:3", Raw: true},
+
+		// The connection drops while a call rings, its DISCONNECT arrives after the reconnect
+		Step{Delay: 5 * time.Second, Message: fmt.Sprintf("RING;2;%s;%s;SIP0;", other, ownNumber)},
+		Step{Delay: 2 * time.Second, Disconnect: true},
+		Step{Delay: 10 * time.Second, Message: "DISCONNECT;2;0;"},
+
+		// Call waiting: a second caller rings while the first call is talking
+		Step{Delay: 5 * time.Second, Message: fmt.Sprintf("RING;0;%s;%s;SIP0;", external, ownNumber)},
+		Step{Delay: 3 * time.Second, Message: fmt.Sprintf("CONNECT;0;1;%s;", external)},
+		Step{Delay: 5 * time.Second, Message: fmt.Sprintf("RING;1;%s;%s;SIP0;", other, ownNumber)},
+		Step{Delay: 6 * time.Second, Message: "DISCONNECT;1;0;"},
+		Step{Delay: 10 * time.Second, Message: "DISCONNECT;0;24;"},
+	)
+}
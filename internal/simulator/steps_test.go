@@ -0,0 +1,120 @@
+package simulator
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSteps(t *testing.T) {
+	input := `# Missed call
+09.09.25 17:33:01;RING;0;0178123456789;990133;SIP4;
+
+09.09.25 17:33:09;DISCONNECT;0;0;
+09.09.25 17:33:05;CALL;1;21;990133;0178123456789;SIP1;
+`
+
+	steps, err := ParseSteps(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseSteps failed: %v", err)
+	}
+
+	expected := []Step{
+		{Delay: 0, Message: "RING;0;0178123456789;990133;SIP4;"},
+		{Delay: 8 * time.Second, Message: "DISCONNECT;0;0;"},
+		{Delay: 0, Message: "CALL;1;21;990133;0178123456789;SIP1;"}, // Timestamp going backwards
+	}
+
+	if len(steps) != len(expected) {
+		t.Fatalf("Expected %d steps, got %d", len(expected), len(steps))
+	}
+	for i, step := range steps {
+		if step != expected[i] {
+			t.Errorf("Step %d = %+v, expected %+v", i, step, expected[i])
+		}
+	}
+}
+
+func TestParseStepsDirectives(t *testing.T) {
+	input := `09.09.25 17:33:01;RING;0;0178123456789;990133;SIP4;
+!wait 2s
+!raw 09.09.25 17:3
+!disconnect
+!wait 1s
+09.09.25 17:33:09;DISCONNECT;0;0;
+`
+
+	steps, err := ParseSteps(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseSteps failed: %v", err)
+	}
+
+	expected := []Step{
+		{Delay: 0, Message: "RING;0;0178123456789;990133;SIP4;"},
+		{Delay: 2 * time.Second, Message: "09.09.25 17:3", Raw: true},
+		{Disconnect: true},
+		{Delay: 9 * time.Second, Message: "DISCONNECT;0;0;"},
+	}
+
+	if len(steps) != len(expected) {
+		t.Fatalf("Expected %d steps, got %d", len(expected), len(steps))
+	}
+	for i, step := range steps {
+		if step != expected[i] {
+			t.Errorf("Step %d = %+v, expected %+v", i, step, expected[i])
+		}
+	}
+}
+
+func TestParseStepsErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"empty input", ""},
+		{"only comments", "# nothing to see\n"},
+		{"missing fields", "09.09.25 17:33:01\n"},
+		{"invalid timestamp", "yesterday;RING;0;0178123456789;990133;SIP4;\n"},
+		{"invalid wait", "!wait soon\n09.09.25 17:33:01;RING;0;0178123456789;990133;SIP4;\n"},
+		{"unknown directive", "!hangup\n09.09.25 17:33:01;RING;0;0178123456789;990133;SIP4;\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseSteps(strings.NewReader(tt.input)); err == nil {
+				t.Error("Expected error, but got none")
+			}
+		})
+	}
+}
+
+func TestSynthetic(t *testing.T) {
+	steps := Synthetic("3698237")
+	if len(steps) == 0 {
+		t.Fatal("Expected synthetic steps")
+	}
+
+	if !strings.HasPrefix(steps[0].Message, "RING;") || !strings.Contains(steps[0].Message, "3698237") {
+		t.Errorf("Expected first step to ring own number, got %q", steps[0].Message)
+	}
+
+	if !strings.Contains(Synthetic("")[0].Message, "990133") {
+		t.Error("Expected default own number to be used")
+	}
+}
+
+func TestDemo(t *testing.T) {
+	steps := Demo("3698237")
+	raw, disconnects := 0, 0
+	for _, step := range steps {
+		if step.Raw {
+			raw++
+		}
+		if step.Disconnect {
+			disconnects++
+		}
+	}
+	if len(steps) <= len(Synthetic("3698237")) || raw != 1 || disconnects != 1 {
+		t.Errorf("Expected the synthetic calls with a raw line and a disconnect, got %+v", steps)
+	}
+}
@@ -0,0 +1,93 @@
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Notifier sends service state notifications to systemd (sd_notify protocol)
+type Notifier struct {
+	socket           string        // Path of the notification socket ($NOTIFY_SOCKET)
+	watchdogInterval time.Duration // Interval in which systemd expects watchdog pings (0 = disabled)
+}
+
+// NewNotifier creates a notifier from the environment provided by systemd.
+// Outside of systemd all notifications are silently ignored.
+func NewNotifier() *Notifier {
+	n := &Notifier{
+		socket: os.Getenv("NOTIFY_SOCKET"),
+	}
+
+	// Watchdog is only meant for us if WATCHDOG_PID is unset or matches our PID
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return n
+	}
+
+	if usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64); err == nil && usec > 0 {
+		n.watchdogInterval = time.Duration(usec) * time.Microsecond
+	}
+
+	return n
+}
+
+// Enabled returns true if the process was started by systemd with Type=notify
+func (n *Notifier) Enabled() bool {
+	return n.socket != ""
+}
+
+// WatchdogInterval returns how often watchdog pings should be sent.
+// It is half of the configured WatchdogSec, or 0 if the watchdog is disabled.
+func (n *Notifier) WatchdogInterval() time.Duration {
+	if !n.Enabled() {
+		return 0
+	}
+	return n.watchdogInterval / 2
+}
+
+// Ready tells systemd that the service finished starting up
+func (n *Notifier) Ready() error {
+	return n.Notify("READY=1")
+}
+
+// Stopping tells systemd that the service is shutting down
+func (n *Notifier) Stopping() error {
+	return n.Notify("STOPPING=1")
+}
+
+// Watchdog sends a keep-alive ping to the systemd watchdog
+func (n *Notifier) Watchdog() error {
+	return n.Notify("WATCHDOG=1")
+}
+
+// Status sets the free-form status text shown by systemctl status
+func (n *Notifier) Status(status string) error {
+	return n.Notify("STATUS=" + status)
+}
+
+// Notify sends a raw state string to the notification socket
+func (n *Notifier) Notify(state string) error {
+	if !n.Enabled() {
+		return nil
+	}
+
+	socket := n.socket
+	// Abstract namespace sockets are announced with a leading '@'
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("failed to connect to notify socket: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNotifierDisabledOutsideSystemd(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	t.Setenv("WATCHDOG_USEC", "")
+
+	n := NewNotifier()
+	if n.Enabled() {
+		t.Error("Expected notifier to be disabled without NOTIFY_SOCKET")
+	}
+	if err := n.Ready(); err != nil {
+		t.Errorf("Expected no error when disabled, got: %v", err)
+	}
+	if n.WatchdogInterval() != 0 {
+		t.Errorf("Expected watchdog to be disabled, got %v", n.WatchdogInterval())
+	}
+}
+
+func TestNotifierWatchdogInterval(t *testing.T) {
+	tests := []struct {
+		name     string
+		usec     string
+		pid      string
+		expected time.Duration
+	}{
+		{"no watchdog", "", "", 0},
+		{"watchdog for us", "30000000", strconv.Itoa(os.Getpid()), 15 * time.Second},
+		{"watchdog without pid", "10000000", "", 5 * time.Second},
+		{"watchdog for other process", "30000000", "1", 0},
+		{"invalid value", "abc", "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("NOTIFY_SOCKET", "/run/systemd/notify")
+			t.Setenv("WATCHDOG_USEC", tt.usec)
+			t.Setenv("WATCHDOG_PID", tt.pid)
+
+			if got := NewNotifier().WatchdogInterval(); got != tt.expected {
+				t.Errorf("WatchdogInterval() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNotifierSendsState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("Failed to listen on socket: %v", err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", path)
+	n := NewNotifier()
+
+	if err := n.Ready(); err != nil {
+		t.Fatalf("Ready failed: %v", err)
+	}
+	if err := n.Watchdog(); err != nil {
+		t.Fatalf("Watchdog failed: %v", err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 64)
+	for _, expected := range []string{"READY=1", "WATCHDOG=1"} {
+		size, err := conn.Read(buf)
+		if err != nil {
+			t.Fatalf("Failed to read notification: %v", err)
+		}
+		if got := string(buf[:size]); got != expected {
+			t.Errorf("Expected %q, got %q", expected, got)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package tr064
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Types of call list entries
+const (
+	CallListIncoming       = 1
+	CallListMissed         = 2
+	CallListOutgoing       = 3
+	CallListActiveIncoming = 9
+	CallListRejected       = 10
+	CallListActiveOutgoing = 11
+)
+
+// CallListEntry is a call of the call list of the Fritz!Box
+type CallListEntry struct {
+	ID           int
+	Type         int    // One of the CallList* constants
+	Caller       string // Remote number of incoming calls, own number of outgoing calls
+	Called       string // Own number of incoming calls, remote number of outgoing calls
+	CallerNumber string // Own number of outgoing calls
+	CalledNumber string // Own number of incoming calls
+	Name         string // Phone book name of the remote party
+	Device       string // Name of the phone that took the call
+	Port         string // Internal number of the phone, same as the callmonitor extension
+	Date         time.Time
+	Duration     time.Duration // Talk time, the Fritz!Box reports whole minutes
+}
+
+// GetCallList returns the calls of the call list of the Fritz!Box, newest
+// first. Dates of the list carry no timezone and are read in location.
+func (c *Client) GetCallList(ctx context.Context, location *time.Location) ([]CallListEntry, error) {
+	result, err := c.Call(ctx, OnTelService, "GetCallList", nil)
+	if err != nil {
+		return nil, err
+	}
+	url := result["NewCallListURL"]
+	if url == "" {
+		return nil, fmt.Errorf("GetCallList returned no call list URL")
+	}
+
+	// The URL carries a session ID, so no further authentication is needed
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create call list request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch call list: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch call list: HTTP status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read call list: %w", err)
+	}
+	return parseCallList(data, location)
+}
+
+// parseCallList parses the call list XML
+func parseCallList(data []byte, location *time.Location) ([]CallListEntry, error) {
+	var list struct {
+		Calls []struct {
+			ID           int    `xml:"Id"`
+			Type         int    `xml:"Type"`
+			Caller       string `xml:"Caller"`
+			Called       string `xml:"Called"`
+			CallerNumber string `xml:"CallerNumber"`
+			CalledNumber string `xml:"CalledNumber"`
+			Name         string `xml:"Name"`
+			Device       string `xml:"Device"`
+			Port         string `xml:"Port"`
+			Date         string `xml:"Date"`
+			Duration     string `xml:"Duration"`
+		} `xml:"Call"`
+	}
+	if err := xml.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("invalid call list: %w", err)
+	}
+
+	entries := make([]CallListEntry, 0, len(list.Calls))
+	for _, call := range list.Calls {
+		date, err := time.ParseInLocation("02.01.06 15:04", strings.TrimSpace(call.Date), location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date of call %d: %w", call.ID, err)
+		}
+		duration, err := parseCallListDuration(call.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration of call %d: %w", call.ID, err)
+		}
+		entries = append(entries, CallListEntry{
+			ID:           call.ID,
+			Type:         call.Type,
+			Caller:       strings.TrimSpace(call.Caller),
+			Called:       strings.TrimSpace(call.Called),
+			CallerNumber: strings.TrimSpace(call.CallerNumber),
+			CalledNumber: strings.TrimSpace(call.CalledNumber),
+			Name:         call.Name,
+			Device:       call.Device,
+			Port:         strings.TrimSpace(call.Port),
+			Date:         date,
+			Duration:     duration,
+		})
+	}
+	return entries, nil
+}
+
+// parseCallListDuration parses durations like 0:05 (hours:minutes)
+func parseCallListDuration(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+	hours, minutes, found := strings.Cut(value, ":")
+	if !found {
+		return 0, fmt.Errorf("%q is not in the format h:mm", value)
+	}
+	h, err := strconv.Atoi(hours)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not in the format h:mm", value)
+	}
+	m, err := strconv.Atoi(minutes)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not in the format h:mm", value)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
@@ -0,0 +1,70 @@
+package tr064
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCallList = `<?xml version="1.0" encoding="UTF-8"?>
+<root>
+<timestamp>1758462000</timestamp>
+<Call><Id>3</Id><Type>3</Type><Caller>990133</Caller><Called>0178123456789</Called><CallerNumber>990133</CallerNumber><Name></Name><Numbertype>sip</Numbertype><Device>Office</Device><Port>11</Port><Date>21.09.25 15:40</Date><Duration>1:05</Duration><Count></Count><Path /></Call>
+<Call><Id>2</Id><Type>2</Type><Caller>030123456</Caller><Called>990133</Called><CalledNumber>990133</CalledNumber><Name>Anna</Name><Numbertype>sip</Numbertype><Device></Device><Port>-1</Port><Date>21.09.25 15:35</Date><Duration>0:00</Duration><Count></Count><Path /></Call>
+<Call><Id>1</Id><Type>1</Type><Caller>0178123456789</Caller><Called>990133</Called><CalledNumber>990133</CalledNumber><Name></Name><Numbertype>sip</Numbertype><Device>Kitchen</Device><Port>10</Port><Date>21.09.25 15:30</Date><Duration>0:02</Duration><Count></Count><Path /></Call>
+</root>`
+
+func TestGetCallList(t *testing.T) {
+	box := &fakeBox{username: "admin", password: "secret", callList: testCallList}
+	client := newTestClient(t, box, "secret")
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("Timezone data not available: %v", err)
+	}
+	entries, err := client.GetCallList(context.Background(), berlin)
+	if err != nil {
+		t.Fatalf("GetCallList failed: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 calls, got %d", len(entries))
+	}
+
+	outgoing := entries[0]
+	if outgoing.Type != CallListOutgoing || outgoing.Called != "0178123456789" || outgoing.CallerNumber != "990133" || outgoing.Port != "11" {
+		t.Errorf("Unexpected outgoing call: %+v", outgoing)
+	}
+	if outgoing.Duration != time.Hour+5*time.Minute {
+		t.Errorf("Expected duration 1h5m, got %v", outgoing.Duration)
+	}
+	if !outgoing.Date.Equal(time.Date(2025, 9, 21, 13, 40, 0, 0, time.UTC)) {
+		t.Errorf("Expected date in Berlin time, got %v", outgoing.Date.UTC())
+	}
+
+	missed := entries[1]
+	if missed.Type != CallListMissed || missed.Caller != "030123456" || missed.CalledNumber != "990133" || missed.Name != "Anna" || missed.Duration != 0 {
+		t.Errorf("Unexpected missed call: %+v", missed)
+	}
+}
+
+func TestParseCallListErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		xml  string
+		err  string
+	}{
+		{"invalid XML", "<root><Call>", "invalid call list"},
+		{"invalid date", "<root><Call><Id>1</Id><Date>yesterday</Date></Call></root>", "invalid date of call 1"},
+		{"invalid duration", "<root><Call><Id>2</Id><Date>21.09.25 15:30</Date><Duration>5</Duration></Call></root>", "invalid duration of call 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseCallList([]byte(tt.xml), time.UTC)
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
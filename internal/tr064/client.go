@@ -0,0 +1,265 @@
+package tr064
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Service identifies a TR-064 service by its type and control URL
+type Service struct {
+	Type       string // e.g. urn:dslforum-org:service:X_AVM-DE_OnTel:1
+	ControlURL string // e.g. /upnp/control/x_contact
+}
+
+// Client calls TR-064 actions on the Fritz!Box via SOAP
+type Client struct {
+	baseURL    string
+	username   string
+	password   string
+	httpClient *http.Client
+}
+
+// Options configures a TR-064 client
+type Options struct {
+	Host       string
+	Port       int
+	Username   string
+	Password   string
+	Timeout    time.Duration // Upper bound for a single action call
+	HTTPClient *http.Client  // Overrides the client built from Timeout
+}
+
+// DefaultOptions returns the options used when nothing else is configured
+func DefaultOptions() Options {
+	return Options{
+		Host:    "fritz.box",
+		Port:    49000,
+		Timeout: 10 * time.Second,
+	}
+}
+
+// withDefaults fills unset fields from DefaultOptions
+func (o Options) withDefaults() Options {
+	defaults := DefaultOptions()
+	if o.Host == "" {
+		o.Host = defaults.Host
+	}
+	if o.Port == 0 {
+		o.Port = defaults.Port
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = defaults.Timeout
+	}
+	if o.HTTPClient == nil {
+		o.HTTPClient = &http.Client{Timeout: o.Timeout}
+	}
+	return o
+}
+
+// NewClient creates a new TR-064 client
+func NewClient(opts Options) *Client {
+	opts = opts.withDefaults()
+	return &Client{
+		baseURL:    fmt.Sprintf("http://%s:%d", opts.Host, opts.Port),
+		username:   opts.Username,
+		password:   opts.Password,
+		httpClient: opts.HTTPClient,
+	}
+}
+
+// Error is a UPnP error returned by the Fritz!Box
+type Error struct {
+	Code        int
+	Description string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("UPnP error %d: %s", e.Code, e.Description)
+}
+
+// Call invokes an action and returns its output arguments by name
+func (c *Client) Call(ctx context.Context, service Service, action string, args map[string]string) (map[string]string, error) {
+	body := buildEnvelope(service.Type, action, args)
+
+	resp, err := c.post(ctx, service, action, body, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// The Fritz!Box requires digest authentication, answer the challenge once
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		_ = resp.Body.Close()
+
+		authorization, err := c.digestAuthorization(challenge, service.ControlURL)
+		if err != nil {
+			return nil, err
+		}
+		resp, err = c.post(ctx, service, action, body, authorization)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s response: %w", action, err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return parseResponse(data, action+"Response")
+	case http.StatusUnauthorized:
+		return nil, fmt.Errorf("%s: authentication failed, check username and password", action)
+	case http.StatusInternalServerError:
+		if fault := parseFault(data); fault != nil {
+			return nil, fmt.Errorf("%s failed: %w", action, fault)
+		}
+	}
+	return nil, fmt.Errorf("%s failed with HTTP status %s", action, resp.Status)
+}
+
+// post sends a SOAP request, optionally with an Authorization header
+func (c *Client) post(ctx context.Context, service Service, action string, body []byte, authorization string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+service.ControlURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s request: %w", action, err)
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", service.Type+"#"+action)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s: %w", action, err)
+	}
+	return resp, nil
+}
+
+// buildEnvelope creates the SOAP request body of an action
+func buildEnvelope(serviceType, action string, args map[string]string) []byte {
+	var sb strings.Builder
+	sb.WriteString(`<?xml version="1.0" encoding="utf-8"?>`)
+	sb.WriteString(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	fmt.Fprintf(&sb, `<u:%s xmlns:u="%s">`, action, serviceType)
+	for name, value := range args {
+		fmt.Fprintf(&sb, "<%s>", name)
+		_ = xml.EscapeText(&sb, []byte(value))
+		fmt.Fprintf(&sb, "</%s>", name)
+	}
+	fmt.Fprintf(&sb, `</u:%s></s:Body></s:Envelope>`, action)
+	return []byte(sb.String())
+}
+
+// parseResponse collects the child elements of the response element
+func parseResponse(data []byte, element string) (map[string]string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	result := make(map[string]string)
+	inResponse := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid SOAP response: %w", err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local == element {
+			inResponse = true
+			continue
+		}
+		if inResponse {
+			var value string
+			if err := decoder.DecodeElement(&value, &start); err != nil {
+				return nil, fmt.Errorf("invalid value of %s: %w", start.Name.Local, err)
+			}
+			result[start.Name.Local] = value
+		}
+	}
+
+	if !inResponse {
+		return nil, fmt.Errorf("SOAP response without %s", element)
+	}
+	return result, nil
+}
+
+// parseFault extracts the UPnP error of a SOAP fault, nil if there is none
+func parseFault(data []byte) *Error {
+	var envelope struct {
+		Fault struct {
+			Code        int    `xml:"detail>UPnPError>errorCode"`
+			Description string `xml:"detail>UPnPError>errorDescription"`
+		} `xml:"Body>Fault"`
+	}
+	if err := xml.Unmarshal(data, &envelope); err != nil || envelope.Fault.Code == 0 {
+		return nil
+	}
+	return &Error{Code: envelope.Fault.Code, Description: envelope.Fault.Description}
+}
+
+// digestAuthorization answers a digest challenge (RFC 2617, MD5 with qop=auth)
+func (c *Client) digestAuthorization(challenge, uri string) (string, error) {
+	params := parseChallenge(challenge)
+	if params == nil {
+		return "", fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+	realm, nonce := params["realm"], params["nonce"]
+
+	cnonceBytes := make([]byte, 8)
+	if _, err := rand.Read(cnonceBytes); err != nil {
+		return "", fmt.Errorf("failed to create client nonce: %w", err)
+	}
+	cnonce := hex.EncodeToString(cnonceBytes)
+	nc := "00000001"
+
+	ha1 := md5Hex(c.username + ":" + realm + ":" + c.password)
+	ha2 := md5Hex(http.MethodPost + ":" + uri)
+	response := md5Hex(ha1 + ":" + nonce + ":" + nc + ":" + cnonce + ":auth:" + ha2)
+
+	authorization := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", qop=auth, nc=%s, cnonce="%s", response="%s"`,
+		c.username, realm, nonce, uri, nc, cnonce, response)
+	if opaque, ok := params["opaque"]; ok {
+		authorization += fmt.Sprintf(`, opaque="%s"`, opaque)
+	}
+	return authorization, nil
+}
+
+// parseChallenge splits a "Digest key=value, ..." header, nil if it is not a digest challenge
+func parseChallenge(challenge string) map[string]string {
+	scheme, rest, found := strings.Cut(strings.TrimSpace(challenge), " ")
+	if !found || !strings.EqualFold(scheme, "Digest") {
+		return nil
+	}
+
+	params := make(map[string]string)
+	for _, part := range strings.Split(rest, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			continue
+		}
+		params[strings.ToLower(key)] = strings.Trim(value, `"`)
+	}
+	return params
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,194 @@
+package tr064
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeBox serves the OnTel deflection, call list and time actions behind digest authentication
+type fakeBox struct {
+	mu          sync.Mutex
+	username    string
+	password    string
+	deflections map[int]bool
+	timeInfo    map[string]string // Output arguments of Time GetInfo
+	callList    string            // XML served at the URL returned by GetCallList
+}
+
+func (b *fakeBox) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// The call list URL is authenticated by its session ID
+	if r.URL.Path == "/calllist.lua" {
+		if r.URL.Query().Get("sid") != "0123456789abcdef" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = io.WriteString(w, b.callList)
+		return
+	}
+
+	if !b.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Digest realm="HTTPS Access", nonce="ABC123", algorithm=MD5, qop="auth"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch r.Header.Get("SOAPAction") {
+	case OnTelService.Type + "#GetDeflections":
+		var items strings.Builder
+		for id := 0; id < len(b.deflections); id++ {
+			enable := 0
+			if b.deflections[id] {
+				enable = 1
+			}
+			fmt.Fprintf(&items, "<Item><DeflectionId>%d</DeflectionId><Enable>%d</Enable><Type>fromAll</Type><Number></Number><DeflectionToNumber></DeflectionToNumber><Mode>eImmediately</Mode></Item>", id, enable)
+		}
+		list := strings.NewReplacer("<", "&lt;", ">", "&gt;").Replace("<List>" + items.String() + "</List>")
+		writeEnvelope(w, http.StatusOK, "<u:GetDeflectionsResponse><NewDeflectionList>"+list+"</NewDeflectionList></u:GetDeflectionsResponse>")
+
+	case OnTelService.Type + "#SetDeflectionEnable":
+		id, _ := strconv.Atoi(between(string(body), "<NewDeflectionId>", "</NewDeflectionId>"))
+		if _, ok := b.deflections[id]; !ok {
+			writeEnvelope(w, http.StatusInternalServerError, "<s:Fault><detail><UPnPError><errorCode>713</errorCode><errorDescription>SpecifiedArrayIndexInvalid</errorDescription></UPnPError></detail></s:Fault>")
+			return
+		}
+		b.deflections[id] = between(string(body), "<NewEnable>", "</NewEnable>") == "1"
+		writeEnvelope(w, http.StatusOK, "<u:SetDeflectionEnableResponse></u:SetDeflectionEnableResponse>")
+
+	case OnTelService.Type + "#GetCallList":
+		writeEnvelope(w, http.StatusOK, "<u:GetCallListResponse><NewCallListURL>http://"+r.Host+"/calllist.lua?sid=0123456789abcdef</NewCallListURL></u:GetCallListResponse>")
+
+	case TimeService.Type + "#GetInfo":
+		var args strings.Builder
+		for name, value := range b.timeInfo {
+			fmt.Fprintf(&args, "<%s>%s</%s>", name, value, name)
+		}
+		writeEnvelope(w, http.StatusOK, "<u:GetInfoResponse>"+args.String()+"</u:GetInfoResponse>")
+
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// authorized checks the digest response the same way the Fritz!Box does
+func (b *fakeBox) authorized(r *http.Request) bool {
+	params := parseChallenge(r.Header.Get("Authorization"))
+	if params == nil || params["username"] != b.username {
+		return false
+	}
+	ha1 := md5Hex(b.username + ":HTTPS Access:" + b.password)
+	ha2 := md5Hex(r.Method + ":" + r.URL.Path)
+	expected := md5Hex(ha1 + ":ABC123:" + params["nc"] + ":" + params["cnonce"] + ":auth:" + ha2)
+	return params["response"] == expected
+}
+
+func writeEnvelope(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" xmlns:u="urn:dslforum-org:service:X_AVM-DE_OnTel:1"><s:Body>%s</s:Body></s:Envelope>`, body)
+}
+
+func between(s, start, end string) string {
+	_, rest, _ := strings.Cut(s, start)
+	value, _, _ := strings.Cut(rest, end)
+	return value
+}
+
+func newTestClient(t *testing.T, box *fakeBox, password string) *Client {
+	t.Helper()
+	server := httptest.NewServer(box)
+	t.Cleanup(server.Close)
+
+	host, portStr, err := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatalf("Invalid server address: %v", err)
+	}
+	port, _ := strconv.Atoi(portStr)
+	return NewClient(Options{Host: host, Port: port, Username: "admin", Password: password})
+}
+
+func TestDeflections(t *testing.T) {
+	box := &fakeBox{username: "admin", password: "secret", deflections: map[int]bool{0: false, 1: true}}
+	client := newTestClient(t, box, "secret")
+	ctx := context.Background()
+
+	deflections, err := client.GetDeflections(ctx)
+	if err != nil {
+		t.Fatalf("GetDeflections failed: %v", err)
+	}
+	if len(deflections) != 2 {
+		t.Fatalf("Expected 2 deflections, got %d", len(deflections))
+	}
+	if deflections[0].Enable || !deflections[1].Enable {
+		t.Errorf("Unexpected enable flags: %+v", deflections)
+	}
+	if deflections[1].ID != 1 || deflections[1].Type != "fromAll" || deflections[1].Mode != "eImmediately" {
+		t.Errorf("Unexpected deflection: %+v", deflections[1])
+	}
+
+	if err := client.SetDeflectionEnable(ctx, 0, true); err != nil {
+		t.Fatalf("SetDeflectionEnable failed: %v", err)
+	}
+	if !box.deflections[0] {
+		t.Error("Expected deflection 0 to be enabled")
+	}
+}
+
+func TestCallErrors(t *testing.T) {
+	box := &fakeBox{username: "admin", password: "secret", deflections: map[int]bool{0: false}}
+
+	t.Run("wrong password", func(t *testing.T) {
+		client := newTestClient(t, box, "wrong")
+		if _, err := client.GetDeflections(context.Background()); err == nil || !strings.Contains(err.Error(), "authentication failed") {
+			t.Errorf("Expected authentication error, got %v", err)
+		}
+	})
+
+	t.Run("UPnP fault", func(t *testing.T) {
+		client := newTestClient(t, box, "secret")
+		err := client.SetDeflectionEnable(context.Background(), 5, true)
+
+		var upnpErr *Error
+		if !errors.As(err, &upnpErr) || upnpErr.Code != 713 {
+			t.Errorf("Expected UPnP error 713, got %v", err)
+		}
+	})
+}
+
+func TestParseChallenge(t *testing.T) {
+	tests := []struct {
+		name      string
+		challenge string
+		expected  map[string]string
+	}{
+		{"digest", `Digest realm="HTTPS Access", nonce="ABC", qop="auth"`, map[string]string{"realm": "HTTPS Access", "nonce": "ABC", "qop": "auth"}},
+		{"basic", `Basic realm="box"`, nil},
+		{"empty", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := parseChallenge(tt.challenge)
+			if (params == nil) != (tt.expected == nil) {
+				t.Fatalf("parseChallenge() = %v, expected %v", params, tt.expected)
+			}
+			for key, value := range tt.expected {
+				if params[key] != value {
+					t.Errorf("Expected %s=%q, got %q", key, value, params[key])
+				}
+			}
+		})
+	}
+}
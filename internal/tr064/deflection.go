@@ -0,0 +1,71 @@
+package tr064
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// OnTelService is the AVM telephony service managing call deflections
+var OnTelService = Service{
+	Type:       "urn:dslforum-org:service:X_AVM-DE_OnTel:1",
+	ControlURL: "/upnp/control/x_contact",
+}
+
+// deflectionList is the XML document returned by GetDeflections
+type deflectionList struct {
+	Items []struct {
+		DeflectionID       int    `xml:"DeflectionId"`
+		Enable             string `xml:"Enable"`
+		Type               string `xml:"Type"`
+		Number             string `xml:"Number"`
+		DeflectionToNumber string `xml:"DeflectionToNumber"`
+		Mode               string `xml:"Mode"`
+		Outgoing           string `xml:"Outgoing"`
+		PhonebookID        string `xml:"PhonebookID"`
+	} `xml:"Item"`
+}
+
+// GetDeflections returns all call deflection rules
+func (c *Client) GetDeflections(ctx context.Context) ([]types.Deflection, error) {
+	result, err := c.Call(ctx, OnTelService, "GetDeflections", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var list deflectionList
+	if err := xml.Unmarshal([]byte(result["NewDeflectionList"]), &list); err != nil {
+		return nil, fmt.Errorf("invalid deflection list: %w", err)
+	}
+
+	deflections := make([]types.Deflection, 0, len(list.Items))
+	for _, item := range list.Items {
+		deflections = append(deflections, types.Deflection{
+			ID:                 item.DeflectionID,
+			Enable:             item.Enable == "1",
+			Type:               item.Type,
+			Number:             item.Number,
+			DeflectionToNumber: item.DeflectionToNumber,
+			Mode:               item.Mode,
+			Outgoing:           item.Outgoing,
+			PhonebookID:        item.PhonebookID,
+		})
+	}
+	return deflections, nil
+}
+
+// SetDeflectionEnable enables or disables a call deflection rule
+func (c *Client) SetDeflectionEnable(ctx context.Context, id int, enable bool) error {
+	value := "0"
+	if enable {
+		value = "1"
+	}
+	_, err := c.Call(ctx, OnTelService, "SetDeflectionEnable", map[string]string{
+		"NewDeflectionId": strconv.Itoa(id),
+		"NewEnable":       value,
+	})
+	return err
+}
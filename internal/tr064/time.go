@@ -0,0 +1,144 @@
+package tr064
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeService is the service reporting the clock and timezone of the Fritz!Box
+var TimeService = Service{
+	Type:       "urn:dslforum-org:service:Time:1",
+	ControlURL: "/upnp/control/time",
+}
+
+// offsetPattern matches fixed UTC offsets like +01:00
+var offsetPattern = regexp.MustCompile(`^([+-])(\d{2}):(\d{2})$`)
+
+// GetLocation returns the timezone configured on the Fritz!Box. The box
+// reports POSIX TZ rules like CET-1CEST-2,M3.5.0/02:00:00,M10.5.0/03:00:00,
+// which are turned into a location that follows the daylight saving rules.
+func (c *Client) GetLocation(ctx context.Context) (*time.Location, error) {
+	result, err := c.Call(ctx, TimeService, "GetInfo", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, value := range []string{result["NewLocalTimeZoneName"], result["NewLocalTimeZone"]} {
+		value = strings.TrimSpace(value)
+		if strings.Contains(value, "/") && !strings.Contains(value, ",") {
+			// IANA name, e.g. Europe/Berlin
+			if location, err := time.LoadLocation(value); err == nil {
+				return location, nil
+			}
+		}
+		if location, ok := posixLocation(value); ok {
+			return location, nil
+		}
+	}
+
+	// A plain offset is only correct all year if the box does not switch to daylight saving time
+	if result["NewDaylightSavingsUsed"] == "0" {
+		if m := offsetPattern.FindStringSubmatch(result["NewLocalTimeZone"]); m != nil {
+			hours, _ := strconv.Atoi(m[2])
+			minutes, _ := strconv.Atoi(m[3])
+			offset := hours*3600 + minutes*60
+			if m[1] == "-" {
+				offset = -offset
+			}
+			return time.FixedZone("UTC"+m[0], offset), nil
+		}
+	}
+
+	return nil, fmt.Errorf("unsupported timezone %q (%q)", result["NewLocalTimeZoneName"], result["NewLocalTimeZone"])
+}
+
+// posixLocation creates a location from a POSIX TZ string. It wraps the rules
+// in a minimal TZif file with a single transition, after which the time
+// package applies the rules of the file's footer.
+func posixLocation(tz string) (*time.Location, bool) {
+	name, offset, ok := posixStandardZone(tz)
+	if !ok {
+		return nil, false
+	}
+
+	var data []byte
+	header := func(version byte, timecnt, typecnt, charcnt uint32) {
+		data = append(data, "TZif"...)
+		data = append(data, version)
+		data = append(data, make([]byte, 15)...)
+		for _, n := range []uint32{0, 0, 0, timecnt, typecnt, charcnt} {
+			data = binary.BigEndian.AppendUint32(data, n)
+		}
+	}
+	header('2', 0, 1, 1)
+	data = append(data, 0, 0, 0, 0, 0, 0, 0) // Empty version 1 block: one type, one NUL abbreviation byte
+	header('2', 1, 1, uint32(len(name)+1))
+	data = binary.BigEndian.AppendUint64(data, 0) // Transition at the Unix epoch
+	data = append(data, 0)                        // ... to type 0
+	data = binary.BigEndian.AppendUint32(data, uint32(int32(offset)))
+	data = append(data, 0, 0) // Not DST, abbreviation index 0
+	data = append(data, name...)
+	data = append(data, 0)
+	data = append(data, '\n')
+	data = append(data, tz...)
+	data = append(data, '\n')
+
+	location, err := time.LoadLocationFromTZData(tz, data)
+	if err != nil {
+		return nil, false
+	}
+	return location, true
+}
+
+// posixStandardZone parses the name and UTC offset in seconds of the standard
+// time of a POSIX TZ string. POSIX offsets are west of UTC, so CET-1 is UTC+1.
+func posixStandardZone(tz string) (string, int, bool) {
+	i := 0
+	var name string
+	if strings.HasPrefix(tz, "<") {
+		end := strings.IndexByte(tz, '>')
+		if end < 0 {
+			return "", 0, false
+		}
+		name, i = tz[1:end], end+1
+	} else {
+		for i < len(tz) && (tz[i] >= 'A' && tz[i] <= 'Z' || tz[i] >= 'a' && tz[i] <= 'z') {
+			i++
+		}
+		name = tz[:i]
+	}
+	if len(name) < 3 || i >= len(tz) {
+		return "", 0, false
+	}
+
+	sign := -1
+	switch tz[i] {
+	case '-':
+		sign = 1
+		i++
+	case '+':
+		i++
+	}
+	end := i
+	for end < len(tz) && (tz[end] >= '0' && tz[end] <= '9' || tz[end] == ':') {
+		end++
+	}
+	parts := strings.Split(tz[i:end], ":")
+	if parts[0] == "" || len(parts) > 3 {
+		return "", 0, false
+	}
+	seconds := 0
+	for j, unit := range []int{3600, 60, 1}[:len(parts)] {
+		n, err := strconv.Atoi(parts[j])
+		if err != nil {
+			return "", 0, false
+		}
+		seconds += n * unit
+	}
+	return name, sign * seconds, true
+}
@@ -0,0 +1,75 @@
+package tr064
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGetLocation(t *testing.T) {
+	winter := time.Date(2025, 1, 15, 12, 0, 0, 0, time.UTC)
+	summer := time.Date(2025, 7, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		timeInfo     map[string]string
+		winterOffset int
+		summerOffset int
+		wantErr      bool
+	}{
+		{
+			name: "POSIX rules with daylight saving time",
+			timeInfo: map[string]string{
+				"NewLocalTimeZoneName":   "CET-1CEST-2,M3.5.0/02:00:00,M10.5.0/03:00:00",
+				"NewLocalTimeZone":       "+01:00",
+				"NewDaylightSavingsUsed": "1",
+			},
+			winterOffset: 3600,
+			summerOffset: 7200,
+		},
+		{
+			name:         "IANA name",
+			timeInfo:     map[string]string{"NewLocalTimeZoneName": "America/New_York"},
+			winterOffset: -5 * 3600,
+			summerOffset: -4 * 3600,
+		},
+		{
+			name:         "fixed offset without daylight saving time",
+			timeInfo:     map[string]string{"NewLocalTimeZone": "-03:30", "NewDaylightSavingsUsed": "0"},
+			winterOffset: -(3*3600 + 1800),
+			summerOffset: -(3*3600 + 1800),
+		},
+		{
+			name:     "fixed offset with daylight saving time",
+			timeInfo: map[string]string{"NewLocalTimeZone": "+01:00", "NewDaylightSavingsUsed": "1"},
+			wantErr:  true,
+		},
+		{
+			name:     "unknown",
+			timeInfo: map[string]string{"NewLocalTimeZoneName": "CET"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			box := &fakeBox{username: "admin", password: "secret", timeInfo: tt.timeInfo}
+			location, err := newTestClient(t, box, "secret").GetLocation(context.Background())
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %s", location)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetLocation failed: %v", err)
+			}
+			if _, offset := winter.In(location).Zone(); offset != tt.winterOffset {
+				t.Errorf("Winter offset = %d, expected %d", offset, tt.winterOffset)
+			}
+			if _, offset := summer.In(location).Zone(); offset != tt.summerOffset {
+				t.Errorf("Summer offset = %d, expected %d", offset, tt.summerOffset)
+			}
+		})
+	}
+}
@@ -0,0 +1,535 @@
+package web
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/database"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/export"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/cloudevents"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/codec"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+//go:embed static/index.html
+var static embed.FS
+
+// Paths are the routes served by the dashboard handler
+var Paths = []string{"GET /{$}", "GET /api/lines", "GET /api/events", "GET /api/calls", "GET /api/v1/calls/{id}/timeline", "DELETE /api/calls/{id}", "POST /api/calls/{id}/restore", "POST /api/calls/bulk", "GET /api/stats/lines"}
+
+// LineSource provides the current state of the phone lines
+type LineSource interface {
+	GetLineStatuses() map[string]*types.LineStatus
+}
+
+// CallStore provides the stored calls of a period and changes single calls
+// or the calls selected by a filter
+type CallStore interface {
+	ListCalls(ctx context.Context, from, to time.Time) ([]database.CallRecord, error)
+	ListDeletedCalls(ctx context.Context, from, to time.Time) ([]database.CallRecord, error)
+	CallTimeline(ctx context.Context, callID string) ([]database.TimelineEntry, error)
+	DeleteCall(ctx context.Context, callID string) error
+	RestoreCall(ctx context.Context, callID string) error
+	CountCalls(ctx context.Context, filter database.CallFilter) (int64, error)
+	DeleteCalls(ctx context.Context, filter database.CallFilter) (int64, error)
+	RestoreCalls(ctx context.Context, filter database.CallFilter) (int64, error)
+	TagCalls(ctx context.Context, filter database.CallFilter, tag string) (int64, error)
+	UntagCalls(ctx context.Context, filter database.CallFilter, tag string) (int64, error)
+	EnrichCalls(ctx context.Context, filter database.CallFilter, enrich func(event *types.CallEvent)) (int64, error)
+}
+
+// Dashboard is a call event sink serving a web UI with the line states, a
+// live event feed via server-sent events and a searchable call history
+type Dashboard struct {
+	lines     LineSource
+	calls     CallStore
+	stats     StatsStore
+	enrich    func(event *types.CallEvent)
+	location  *time.Location
+	maxCalls  int
+	heartbeat time.Duration
+	source    string
+
+	mu          sync.Mutex
+	subscribers map[chan types.CallEvent]struct{}
+}
+
+// Options configures a dashboard
+type Options struct {
+	Lines     LineSource
+	Calls     CallStore
+	Stats     StatsStore                   // Per-line statistics (default: not offered)
+	Enrich    func(event *types.CallEvent) // Normalization and MSN detection for bulk re-enrichment (default: not offered)
+	Location  *time.Location               // Timezone of the dates of history searches
+	MaxCalls  int                          // Upper bound for the calls returned by one history search
+	Heartbeat time.Duration                // Interval of keep-alive comments on idle event streams
+	Source    string                       // Source of the events streamed as CloudEvents (default: cloudevents.DefaultSource)
+}
+
+// DefaultOptions returns the options used when nothing else is configured
+func DefaultOptions() Options {
+	return Options{
+		Location:  time.Local,
+		MaxCalls:  500,
+		Heartbeat: 30 * time.Second,
+		Source:    cloudevents.DefaultSource,
+	}
+}
+
+// withDefaults fills unset fields from DefaultOptions
+func (o Options) withDefaults() Options {
+	defaults := DefaultOptions()
+	if o.Location == nil {
+		o.Location = defaults.Location
+	}
+	if o.MaxCalls <= 0 {
+		o.MaxCalls = defaults.MaxCalls
+	}
+	if o.Heartbeat <= 0 {
+		o.Heartbeat = defaults.Heartbeat
+	}
+	if o.Source == "" {
+		o.Source = defaults.Source
+	}
+	return o
+}
+
+// NewDashboard creates a dashboard
+func NewDashboard(opts Options) *Dashboard {
+	opts = opts.withDefaults()
+	return &Dashboard{
+		lines:       opts.Lines,
+		calls:       opts.Calls,
+		stats:       opts.Stats,
+		enrich:      opts.Enrich,
+		location:    opts.Location,
+		maxCalls:    opts.MaxCalls,
+		heartbeat:   opts.Heartbeat,
+		source:      opts.Source,
+		subscribers: make(map[chan types.CallEvent]struct{}),
+	}
+}
+
+// PublishCallEvent forwards the event to all open event streams. Streams that
+// cannot keep up miss events. Calls of opted-out MSNs are not shown.
+func (d *Dashboard) PublishCallEvent(ctx context.Context, event types.CallEvent) error {
+	if event.DoNotRecord {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for events := range d.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+	return nil
+}
+
+// subscribe registers a new event stream
+func (d *Dashboard) subscribe() chan types.CallEvent {
+	events := make(chan types.CallEvent, 32)
+	d.mu.Lock()
+	d.subscribers[events] = struct{}{}
+	d.mu.Unlock()
+	return events
+}
+
+// unsubscribe removes an event stream
+func (d *Dashboard) unsubscribe(events chan types.CallEvent) {
+	d.mu.Lock()
+	delete(d.subscribers, events)
+	d.mu.Unlock()
+}
+
+// Handler returns the HTTP handler of the routes in Paths:
+//
+//	GET /             the web UI
+//	GET /api/lines    current line states
+//	GET /api/events   call events as server-sent events
+//	GET /api/calls    stored calls, filtered by ?from, ?to and ?q, deleted calls with ?deleted=true
+//	GET /api/v1/calls/{id}/timeline  events of a call with the state transitions they caused
+//	DELETE /api/calls/{id}        deletes a call, it can be restored
+//	POST /api/calls/{id}/restore  restores a deleted call
+//	POST /api/calls/bulk          deletes, restores, tags, untags or re-enriches the calls selected by a filter
+//	GET /api/stats/lines          call statistics per line, filtered by ?from, ?to and ?trunk
+func (d *Dashboard) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFileFS(w, r, static, "static/index.html")
+	})
+	mux.HandleFunc("GET /api/lines", d.serveLines)
+	mux.HandleFunc("GET /api/events", d.serveEvents)
+	mux.HandleFunc("GET /api/calls", d.serveCalls)
+	mux.HandleFunc("GET /api/v1/calls/{id}/timeline", d.serveTimeline)
+	mux.HandleFunc("DELETE /api/calls/{id}", func(w http.ResponseWriter, r *http.Request) {
+		d.changeCall(w, r, d.calls.DeleteCall)
+	})
+	mux.HandleFunc("POST /api/calls/{id}/restore", func(w http.ResponseWriter, r *http.Request) {
+		d.changeCall(w, r, d.calls.RestoreCall)
+	})
+	mux.HandleFunc("POST /api/calls/bulk", d.serveBulk)
+	mux.HandleFunc("GET /api/stats/lines", d.serveLineStats)
+	return mux
+}
+
+// serveLines answers with the line states ordered by line
+func (d *Dashboard) serveLines(w http.ResponseWriter, r *http.Request) {
+	lines := make([]*types.LineStatus, 0)
+	for _, status := range d.lines.GetLineStatuses() {
+		lines = append(lines, status)
+	}
+	slices.SortFunc(lines, func(a, b *types.LineStatus) int {
+		if a.Line != b.Line {
+			return a.Line - b.Line
+		}
+		return strings.Compare(a.Trunk, b.Trunk)
+	})
+	writeJSON(w, http.StatusOK, lines)
+}
+
+// serveEvents streams call events until the client disconnects or the server
+// shuts down. With format=cloudevents, every event is a CloudEvents envelope.
+func (d *Dashboard) serveEvents(w http.ResponseWriter, r *http.Request) {
+	var encoder codec.Codec
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		encoder = codec.JSON
+	case "cloudevents":
+		encoder = codec.CloudEvents{Source: d.source}
+	default:
+		http.Error(w, fmt.Sprintf("unknown format '%s', expected json or cloudevents", format), http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events := d.subscribe()
+	defer d.unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(d.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			payload, err := codec.Marshal(encoder, codec.Message{Kind: "call." + string(event.Type), Subject: event.ID, Time: event.Timestamp, Value: event})
+			if err != nil {
+				log.Printf("Failed to marshal call event for dashboard: %v", err)
+				continue
+			}
+			_, _ = fmt.Fprintf(w, "event: call\ndata: %s\n\n", payload)
+		case <-heartbeat.C:
+			_, _ = fmt.Fprint(w, ": ping\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+// callView is a stored call as returned by /api/calls
+type callView struct {
+	ID        string              `json:"id"`
+	Start     time.Time           `json:"start"`
+	End       *time.Time          `json:"end,omitempty"`
+	Direction types.CallDirection `json:"direction"`
+	Caller    string              `json:"caller"`
+	Called    string              `json:"called"`
+	CallerMSN string              `json:"caller_msn,omitempty"`
+	CalledMSN string              `json:"called_msn,omitempty"`
+	Line      int                 `json:"line"`
+	Trunk     string              `json:"trunk"`
+	Duration  int                 `json:"duration"`
+	Answered  bool                `json:"answered"`
+	DeletedAt *time.Time          `json:"deleted_at,omitempty"`
+	Tags      []string            `json:"tags,omitempty"`
+}
+
+// period parses the from and to query values, by default the last 30 days
+func (d *Dashboard) period(fromValue, toValue string) (from, to time.Time, err error) {
+	to = time.Now()
+	from = to.AddDate(0, 0, -30)
+	if fromValue != "" {
+		if from, err = export.ParseTime(fromValue, d.location); err != nil {
+			return from, to, err
+		}
+	}
+	if toValue != "" {
+		if to, err = export.ParseTime(toValue, d.location); err != nil {
+			return from, to, err
+		}
+	}
+	return from, to, nil
+}
+
+// serveCalls answers with the newest stored calls of the period matching the
+// search term, by default of the last 30 days
+func (d *Dashboard) serveCalls(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	from, to, err := d.period(query.Get("from"), query.Get("to"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	limit := d.maxCalls
+	if value := query.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid limit"})
+			return
+		}
+		limit = min(limit, d.maxCalls)
+	}
+
+	list := d.calls.ListCalls
+	if query.Get("deleted") == "true" {
+		list = d.calls.ListDeletedCalls
+	}
+	records, err := list(r.Context(), from, to)
+	if err != nil {
+		log.Printf("Failed to list calls for dashboard: %v", err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to list calls"})
+		return
+	}
+
+	search := strings.ToLower(strings.TrimSpace(query.Get("q")))
+	calls := make([]callView, 0)
+	for i := len(records) - 1; i >= 0 && len(calls) < limit; i-- {
+		record := records[i]
+		if search != "" && !matches(record, search) {
+			continue
+		}
+		call := callView{
+			ID:        record.CallID,
+			Start:     record.Started,
+			Direction: record.Direction,
+			Caller:    record.Caller,
+			Called:    record.Called,
+			CallerMSN: record.CallerMSN,
+			CalledMSN: record.CalledMSN,
+			Line:      record.Line,
+			Trunk:     record.Trunk,
+			Duration:  record.Duration,
+			Answered:  record.Duration > 0,
+			Tags:      record.Tags,
+		}
+		if !record.Ended.IsZero() {
+			call.End = &record.Ended
+		}
+		if !record.DeletedAt.IsZero() {
+			call.DeletedAt = &record.DeletedAt
+		}
+		calls = append(calls, call)
+	}
+	writeJSON(w, http.StatusOK, calls)
+}
+
+// timelineView is an event of a call as returned by /api/v1/calls/{id}/timeline
+type timelineView struct {
+	Time     time.Time        `json:"time"`
+	Type     types.CallType   `json:"type"`
+	Line     int              `json:"line"`
+	Duration int              `json:"duration,omitempty"`
+	From     types.CallStatus `json:"from,omitempty"` // State before the event, empty for calls stored by older versions
+	To       types.CallStatus `json:"to,omitempty"`   // State after the event, equals From if the event was ignored
+	Reason   string           `json:"reason,omitempty"`
+}
+
+// serveTimeline answers with the events of the call of the {id} path value
+// and the state transitions they caused, oldest first
+func (d *Dashboard) serveTimeline(w http.ResponseWriter, r *http.Request) {
+	entries, err := d.calls.CallTimeline(r.Context(), r.PathValue("id"))
+	if errors.Is(err, database.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "call not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to read call timeline for dashboard: %v", err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to read call timeline"})
+		return
+	}
+
+	timeline := make([]timelineView, len(entries))
+	for i, entry := range entries {
+		timeline[i] = timelineView{Time: entry.Timestamp, Type: entry.Type, Line: entry.Line, Duration: entry.Duration}
+		if entry.Transition != nil {
+			timeline[i].From = entry.Transition.From
+			timeline[i].To = entry.Transition.To
+			timeline[i].Reason = entry.Transition.Reason
+		}
+	}
+	writeJSON(w, http.StatusOK, timeline)
+}
+
+// changeCall deletes or restores the call of the {id} path value
+func (d *Dashboard) changeCall(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, callID string) error) {
+	err := change(r.Context(), r.PathValue("id"))
+	if errors.Is(err, database.ErrNotFound) {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "call not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to change call for dashboard: %v", err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to change call"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// bulkRequest is the JSON body of /api/calls/bulk
+type bulkRequest struct {
+	Action  string `json:"action"`  // delete, restore, tag, untag or enrich
+	From    string `json:"from"`    // Calls started at or after, date or RFC 3339 time
+	To      string `json:"to"`      // Calls started before
+	Number  string `json:"number"`  // Caller or called number, * matches any digits
+	Tagged  string `json:"tagged"`  // Calls with this tag
+	Tag     string `json:"tag"`     // Tag to add or remove
+	Preview bool   `json:"preview"` // Only count the selected calls
+
+	// Expected is the number of calls the preview matched; the change is
+	// refused if the filter matches a different number of calls by now
+	Expected *int64 `json:"expected"`
+}
+
+// bulkResponse reports the selected calls and, unless previewed, the changed calls
+type bulkResponse struct {
+	Matched int64  `json:"matched"`
+	Changed *int64 `json:"changed,omitempty"`
+}
+
+// serveBulk applies the action of the request to the calls selected by its
+// filter. Changes require a filter and the number of calls of the preview.
+func (d *Dashboard) serveBulk(w http.ResponseWriter, r *http.Request) {
+	// Browsers send cross-site form posts without a preflight, but never as JSON
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		writeJSON(w, http.StatusUnsupportedMediaType, errorResponse{Error: "content type must be application/json"})
+		return
+	}
+	var req bulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid request body"})
+		return
+	}
+	filter := database.CallFilter{Number: strings.TrimSpace(req.Number), Tag: strings.TrimSpace(req.Tagged)}
+	var err error
+	if req.From != "" {
+		if filter.From, err = export.ParseTime(req.From, d.location); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+	}
+	if req.To != "" {
+		if filter.To, err = export.ParseTime(req.To, d.location); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+	}
+	if filter.IsEmpty() {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "a filter is required, select all calls with an explicit period"})
+		return
+	}
+	if !req.Preview && req.Expected == nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "expected number of calls is required, preview the request first"})
+		return
+	}
+
+	var apply func(ctx context.Context, filter database.CallFilter) (int64, error)
+	switch req.Action {
+	case "delete":
+		apply = d.calls.DeleteCalls
+	case "restore":
+		filter.Deleted = true
+		apply = d.calls.RestoreCalls
+	case "tag", "untag":
+		tag := strings.TrimSpace(req.Tag)
+		if tag == "" {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "tag is required"})
+			return
+		}
+		change := d.calls.TagCalls
+		if req.Action == "untag" {
+			change = d.calls.UntagCalls
+		}
+		apply = func(ctx context.Context, filter database.CallFilter) (int64, error) {
+			return change(ctx, filter, tag)
+		}
+	case "enrich":
+		if d.enrich == nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "re-enrichment is not configured"})
+			return
+		}
+		apply = func(ctx context.Context, filter database.CallFilter) (int64, error) {
+			return d.calls.EnrichCalls(ctx, filter, d.enrich)
+		}
+	default:
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("unknown action %q", req.Action)})
+		return
+	}
+
+	matched, err := d.calls.CountCalls(r.Context(), filter)
+	if err != nil {
+		log.Printf("Failed to count calls for dashboard: %v", err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to count calls"})
+		return
+	}
+	response := bulkResponse{Matched: matched}
+	if !req.Preview && *req.Expected != matched {
+		writeJSON(w, http.StatusConflict, errorResponse{Error: fmt.Sprintf("filter matches %d calls instead of the expected %d", matched, *req.Expected)})
+		return
+	}
+	if !req.Preview {
+		changed, err := apply(r.Context(), filter)
+		if err != nil {
+			log.Printf("Failed to %s calls for dashboard: %v", req.Action, err)
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to change calls"})
+			return
+		}
+		response.Changed = &changed
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// matches reports whether a number, MSN or trunk of the call contains the lower case search term
+func matches(record database.CallRecord, search string) bool {
+	for _, field := range []string{record.Caller, record.Called, record.CallerMSN, record.CalledMSN, record.Trunk} {
+		if strings.Contains(strings.ToLower(field), search) {
+			return true
+		}
+	}
+	return false
+}
+
+// errorResponse is the JSON body of failed requests
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write dashboard response: %v", err)
+	}
+}
@@ -0,0 +1,554 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/database"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/cloudevents"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+type fakeLines map[string]*types.LineStatus
+
+func (f fakeLines) GetLineStatuses() map[string]*types.LineStatus { return f }
+
+type fakeCalls []database.CallRecord
+
+func (f fakeCalls) ListCalls(ctx context.Context, from, to time.Time) ([]database.CallRecord, error) {
+	return f.list(from, to, false), nil
+}
+
+func (f fakeCalls) ListDeletedCalls(ctx context.Context, from, to time.Time) ([]database.CallRecord, error) {
+	return f.list(from, to, true), nil
+}
+
+func (f fakeCalls) list(from, to time.Time, deleted bool) []database.CallRecord {
+	var calls []database.CallRecord
+	for _, call := range f {
+		if !call.Started.Before(from) && call.Started.Before(to) && call.DeletedAt.IsZero() != deleted {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// CallTimeline returns the start of the call with a transition and its end without one, as stored by older versions
+func (f fakeCalls) CallTimeline(ctx context.Context, callID string) ([]database.TimelineEntry, error) {
+	for _, call := range f {
+		if call.CallID != callID {
+			continue
+		}
+		timeline := []database.TimelineEntry{{Timestamp: call.Started, Type: types.CallTypeRing, Line: call.Line,
+			Transition: &types.Transition{From: types.CallStatusIdle, To: types.CallStatusRinging, Reason: "incoming call rings"}}}
+		if !call.Ended.IsZero() {
+			timeline = append(timeline, database.TimelineEntry{Timestamp: call.Ended, Type: types.CallTypeDisconnect, Line: call.Line, Duration: call.Duration})
+		}
+		return timeline, nil
+	}
+	return nil, database.ErrNotFound
+}
+
+func (f fakeCalls) DeleteCall(ctx context.Context, callID string) error {
+	for i := range f {
+		if f[i].CallID == callID && f[i].DeletedAt.IsZero() {
+			f[i].DeletedAt = time.Now()
+			return nil
+		}
+	}
+	return database.ErrNotFound
+}
+
+func (f fakeCalls) RestoreCall(ctx context.Context, callID string) error {
+	for i := range f {
+		if f[i].CallID == callID && !f[i].DeletedAt.IsZero() {
+			f[i].DeletedAt = time.Time{}
+			return nil
+		}
+	}
+	return database.ErrNotFound
+}
+
+func (f fakeCalls) selected(filter database.CallFilter) []int {
+	var selected []int
+	for i, call := range f {
+		if (!filter.From.IsZero() && call.Started.Before(filter.From)) || (!filter.To.IsZero() && !call.Started.Before(filter.To)) ||
+			call.DeletedAt.IsZero() == filter.Deleted {
+			continue
+		}
+		number := strings.ReplaceAll(filter.Number, "*", "")
+		if !strings.Contains(call.Caller, number) && !strings.Contains(call.Called, number) {
+			continue
+		}
+		if filter.Tag != "" && !slices.Contains(call.Tags, filter.Tag) {
+			continue
+		}
+		selected = append(selected, i)
+	}
+	return selected
+}
+
+func (f fakeCalls) CountCalls(ctx context.Context, filter database.CallFilter) (int64, error) {
+	return int64(len(f.selected(filter))), nil
+}
+
+func (f fakeCalls) DeleteCalls(ctx context.Context, filter database.CallFilter) (int64, error) {
+	filter.Deleted = false
+	selected := f.selected(filter)
+	for _, i := range selected {
+		f[i].DeletedAt = time.Now()
+	}
+	return int64(len(selected)), nil
+}
+
+func (f fakeCalls) RestoreCalls(ctx context.Context, filter database.CallFilter) (int64, error) {
+	filter.Deleted = true
+	selected := f.selected(filter)
+	for _, i := range selected {
+		f[i].DeletedAt = time.Time{}
+	}
+	return int64(len(selected)), nil
+}
+
+func (f fakeCalls) TagCalls(ctx context.Context, filter database.CallFilter, tag string) (int64, error) {
+	var tagged int64
+	for _, i := range f.selected(filter) {
+		if !slices.Contains(f[i].Tags, tag) {
+			f[i].Tags = append(f[i].Tags, tag)
+			tagged++
+		}
+	}
+	return tagged, nil
+}
+
+func (f fakeCalls) UntagCalls(ctx context.Context, filter database.CallFilter, tag string) (int64, error) {
+	var untagged int64
+	for _, i := range f.selected(filter) {
+		if j := slices.Index(f[i].Tags, tag); j >= 0 {
+			f[i].Tags = slices.Delete(f[i].Tags, j, j+1)
+			untagged++
+		}
+	}
+	return untagged, nil
+}
+
+func (f fakeCalls) EnrichCalls(ctx context.Context, filter database.CallFilter, enrich func(event *types.CallEvent)) (int64, error) {
+	var changed int64
+	for _, i := range f.selected(filter) {
+		event := types.CallEvent{Caller: f[i].Caller, Called: f[i].Called}
+		enrich(&event)
+		if event.Caller != f[i].Caller || event.Called != f[i].Called {
+			f[i].Caller, f[i].Called = event.Caller, event.Called
+			changed++
+		}
+	}
+	return changed, nil
+}
+
+func TestServeIndex(t *testing.T) {
+	server := httptest.NewServer(NewDashboard(Options{}).Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("GET / = %d %s, want 200 text/html", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+}
+
+func TestServeLines(t *testing.T) {
+	dashboard := NewDashboard(Options{Lines: fakeLines{
+		"2": {Line: 2, Status: types.CallStatusIdle},
+		"0": {Line: 0, Status: types.CallStatusTalking},
+	}})
+
+	rec := httptest.NewRecorder()
+	dashboard.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/lines", nil))
+
+	var lines []types.LineStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &lines); err != nil {
+		t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+	}
+	if len(lines) != 2 || lines[0].Line != 0 || lines[1].Line != 2 {
+		t.Errorf("lines = %+v, want lines 0 and 2 in order", lines)
+	}
+}
+
+func TestServeCalls(t *testing.T) {
+	base := time.Date(2025, 9, 1, 10, 0, 0, 0, time.UTC)
+	dashboard := NewDashboard(Options{Location: time.UTC, MaxCalls: 2, Calls: fakeCalls{
+		{CallID: "a", Started: base, Ended: base.Add(time.Minute), Caller: "0301111", Duration: 60},
+		{CallID: "b", Started: base.Add(time.Hour), Caller: "0302222"},
+		{CallID: "c", Started: base.Add(2 * time.Hour), Called: "0891111", CalledMSN: "555"},
+		{CallID: "d", Started: base.AddDate(0, 0, 5), Caller: "0301111"},
+	}})
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		want   []string
+	}{
+		{"newest first within limit", "from=2025-09-01&to=2025-09-02", http.StatusOK, []string{"c", "b"}},
+		{"search", "from=2025-09-01&to=2025-09-02&q=1111", http.StatusOK, []string{"c", "a"}},
+		{"search msn", "from=2025-09-01&to=2025-09-02&q=555", http.StatusOK, []string{"c"}},
+		{"limit", "from=2025-09-01&to=2025-09-02&limit=1", http.StatusOK, []string{"c"}},
+		{"invalid from", "from=yesterday", http.StatusBadRequest, nil},
+		{"invalid limit", "limit=0", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			dashboard.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/calls?"+tt.query, nil))
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var calls []callView
+			if err := json.Unmarshal(rec.Body.Bytes(), &calls); err != nil {
+				t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+			}
+			var ids []string
+			for _, call := range calls {
+				ids = append(ids, call.ID)
+			}
+			if strings.Join(ids, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("calls = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestServeTimeline(t *testing.T) {
+	base := time.Date(2025, 9, 1, 10, 0, 0, 0, time.UTC)
+	dashboard := NewDashboard(Options{Location: time.UTC, Calls: fakeCalls{
+		{CallID: "a", Started: base, Ended: base.Add(time.Minute), Line: 2, Duration: 50},
+	}})
+
+	rec := httptest.NewRecorder()
+	dashboard.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/calls/a/timeline", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	var timeline []timelineView
+	if err := json.Unmarshal(rec.Body.Bytes(), &timeline); err != nil {
+		t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+	}
+	want := []timelineView{
+		{Time: base, Type: types.CallTypeRing, Line: 2, From: types.CallStatusIdle, To: types.CallStatusRinging, Reason: "incoming call rings"},
+		{Time: base.Add(time.Minute), Type: types.CallTypeDisconnect, Line: 2, Duration: 50},
+	}
+	if len(timeline) != len(want) || timeline[0] != want[0] || !timeline[1].Time.Equal(want[1].Time) || timeline[1].Reason != "" || timeline[1].Duration != 50 {
+		t.Errorf("timeline = %+v, want %+v", timeline, want)
+	}
+
+	rec = httptest.NewRecorder()
+	dashboard.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/calls/missing/timeline", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown call: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestDeleteAndRestoreCall(t *testing.T) {
+	base := time.Date(2025, 9, 1, 10, 0, 0, 0, time.UTC)
+	dashboard := NewDashboard(Options{Location: time.UTC, Calls: fakeCalls{
+		{CallID: "a", Started: base},
+		{CallID: "b", Started: base.Add(time.Hour)},
+	}})
+	handler := dashboard.Handler()
+
+	request := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+	listed := func(query string) string {
+		var calls []callView
+		rec := request(http.MethodGet, "/api/calls?from=2025-09-01&to=2025-09-02"+query)
+		if err := json.Unmarshal(rec.Body.Bytes(), &calls); err != nil {
+			t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+		}
+		var ids []string
+		for _, call := range calls {
+			ids = append(ids, call.ID)
+		}
+		return strings.Join(ids, ",")
+	}
+
+	if rec := request(http.MethodDelete, "/api/calls/a"); rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if rec := request(http.MethodDelete, "/api/calls/a"); rec.Code != http.StatusNotFound {
+		t.Errorf("second DELETE = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if got := listed(""); got != "b" {
+		t.Errorf("calls = %v, want b", got)
+	}
+	if got := listed("&deleted=true"); got != "a" {
+		t.Errorf("deleted calls = %v, want a", got)
+	}
+
+	if rec := request(http.MethodPost, "/api/calls/a/restore"); rec.Code != http.StatusNoContent {
+		t.Fatalf("restore = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if rec := request(http.MethodPost, "/api/calls/b/restore"); rec.Code != http.StatusNotFound {
+		t.Errorf("restore of a call that is not deleted = %d, want %d", rec.Code, http.StatusNotFound)
+	}
+	if got := listed(""); got != "b,a" {
+		t.Errorf("calls = %v, want b,a", got)
+	}
+}
+
+func TestServeBulk(t *testing.T) {
+	base := time.Date(2025, 9, 1, 10, 0, 0, 0, time.UTC)
+	calls := fakeCalls{
+		{CallID: "a", Started: base, Caller: "030123456"},
+		{CallID: "b", Started: base.Add(time.Hour), Caller: "+4930654321"},
+		{CallID: "c", Started: base.AddDate(0, 0, 1), Caller: "0170123456"},
+	}
+	dashboard := NewDashboard(Options{Location: time.UTC, Calls: calls, Enrich: func(event *types.CallEvent) {
+		if strings.HasPrefix(event.Caller, "0") {
+			event.Caller = "+49" + event.Caller[1:]
+		}
+	}})
+	handler := dashboard.Handler()
+
+	tests := []struct {
+		name    string
+		body    string
+		status  int
+		matched int64
+		changed int64 // -1 for a preview
+	}{
+		{"preview", `{"action":"delete","from":"2025-09-01","to":"2025-09-02","preview":true}`, http.StatusOK, 2, -1},
+		{"tag", `{"action":"tag","number":"*30*","tag":"berlin","expected":2}`, http.StatusOK, 2, 2},
+		{"delete tagged", `{"action":"delete","tagged":"berlin","to":"2025-09-01T10:30:00Z","expected":1}`, http.StatusOK, 1, 1},
+		{"restore", `{"action":"restore","from":"2025-09-01","expected":1}`, http.StatusOK, 1, 1},
+		{"untag", `{"action":"untag","tag":"berlin","number":"+49","expected":1}`, http.StatusOK, 1, 1},
+		{"enrich", `{"action":"enrich","from":"2025-01-01","expected":3}`, http.StatusOK, 3, 2},
+		{"changed selection", `{"action":"delete","from":"2025-09-01","expected":2}`, http.StatusConflict, 0, 0},
+		{"missing expected", `{"action":"delete","from":"2025-09-01"}`, http.StatusBadRequest, 0, 0},
+		{"missing filter", `{"action":"delete","preview":true}`, http.StatusBadRequest, 0, 0},
+		{"missing tag", `{"action":"tag","from":"2025-09-01"}`, http.StatusBadRequest, 0, 0},
+		{"unknown action", `{"action":"purge","from":"2025-09-01"}`, http.StatusBadRequest, 0, 0},
+		{"invalid date", `{"action":"delete","from":"yesterday"}`, http.StatusBadRequest, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, "/api/calls/bulk", strings.NewReader(tt.body))
+			request.Header.Set("Content-Type", "application/json")
+			handler.ServeHTTP(rec, request)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var got bulkResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+			}
+			if got.Matched != tt.matched {
+				t.Errorf("matched = %d, want %d", got.Matched, tt.matched)
+			}
+			if tt.changed < 0 && got.Changed != nil {
+				t.Errorf("Expected a preview to change nothing, got %d", *got.Changed)
+			}
+			if tt.changed >= 0 && (got.Changed == nil || *got.Changed != tt.changed) {
+				t.Errorf("changed = %v, want %d", got.Changed, tt.changed)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/calls/bulk", strings.NewReader(`{"action":"delete","from":"2025-09-01","expected":3}`)))
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected a form post to be rejected, got status %d", rec.Code)
+	}
+
+	if calls[0].Caller != "+4930123456" || !calls[0].DeletedAt.IsZero() {
+		t.Errorf("Expected call a to be restored and enriched, got %+v", calls[0])
+	}
+}
+
+func TestServeEvents(t *testing.T) {
+	dashboard := NewDashboard(Options{})
+	server := httptest.NewServer(dashboard.Handler())
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/events", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("Content-Type = %q, want text/event-stream", got)
+	}
+
+	// The stream is subscribed once the first comment arrives
+	reader := bufio.NewReader(resp.Body)
+	if _, err := reader.ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = dashboard.PublishCallEvent(ctx, types.CallEvent{ID: "hidden", DoNotRecord: true})
+	_ = dashboard.PublishCallEvent(ctx, types.CallEvent{ID: "shown", Type: types.CallTypeRing})
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var event types.CallEvent
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+			t.Fatal(err)
+		}
+		if event.ID != "shown" {
+			t.Errorf("event = %s, want shown (do-not-record events are skipped)", event.ID)
+		}
+		return
+	}
+}
+
+func TestServeEventsCloudEvents(t *testing.T) {
+	dashboard := NewDashboard(Options{Source: "/test"})
+	server := httptest.NewServer(dashboard.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/events?format=xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected an unknown format to be rejected, got status %d", resp.StatusCode)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/events?format=cloudevents", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	reader := bufio.NewReader(resp.Body)
+	if _, err := reader.ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+	_ = dashboard.PublishCallEvent(ctx, types.CallEvent{ID: "call-1", Type: types.CallTypeRing})
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		var envelope cloudevents.Event
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &envelope); err != nil {
+			t.Fatal(err)
+		}
+		if envelope.Type != cloudevents.Type("call.ring") || envelope.Source != "/test" || envelope.Subject != "call-1" {
+			t.Errorf("Expected a CloudEvent of the ring, got %+v", envelope)
+		}
+		var event types.CallEvent
+		if err := json.Unmarshal(envelope.Data, &event); err != nil || event.ID != "call-1" {
+			t.Errorf("Expected the call event as data, got %s", envelope.Data)
+		}
+		return
+	}
+}
+
+type fakeStats struct{}
+
+func (fakeStats) LineTotals(ctx context.Context, filter database.StatsFilter) ([]database.LineTotals, error) {
+	return []database.LineTotals{{Trunk: "SIP0", Calls: 4, Inbound: 3, Answered: 2, Missed: 1, TalkTime: 90}}, nil
+}
+
+func (fakeStats) HourlyCalls(ctx context.Context, filter database.StatsFilter) ([]database.HourlyCalls, error) {
+	// 21:00 and 22:00 UTC are on different days in Berlin
+	return []database.HourlyCalls{
+		{Trunk: "SIP0", Hour: time.Date(2025, 9, 21, 21, 0, 0, 0, time.UTC), Calls: 1},
+		{Trunk: "SIP0", Hour: time.Date(2025, 9, 21, 22, 0, 0, 0, time.UTC), Calls: 2, Missed: 1},
+		{Trunk: "SIP0", Hour: time.Date(2025, 9, 22, 22, 0, 0, 0, time.UTC), Calls: 1},
+	}, nil
+}
+
+func (fakeStats) TopCallers(ctx context.Context, filter database.StatsFilter, limit int) ([]database.CallerCount, error) {
+	if filter.Trunk != "SIP0" || limit != 1 {
+		return nil, fmt.Errorf("unexpected filter %+v and limit %d", filter, limit)
+	}
+	return []database.CallerCount{{Trunk: "SIP0", Number: "+4930111111", Calls: 2, TalkTime: 60}}, nil
+}
+
+func TestServeLineStats(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("Timezone data not available: %v", err)
+	}
+	dashboard := NewDashboard(Options{Location: berlin, Stats: fakeStats{}})
+
+	rec := httptest.NewRecorder()
+	dashboard.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/stats/lines?from=2025-09-21&to=2025-09-23&trunk=SIP0&top=1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	var lines []lineStatsView
+	if err := json.Unmarshal(rec.Body.Bytes(), &lines); err != nil {
+		t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+	}
+	if len(lines) != 1 {
+		t.Fatalf("lines = %+v, want SIP0 only", lines)
+	}
+	line := lines[0]
+	if line.Outbound != 1 || line.MissedRatio != 1.0/3 || line.AverageDuration != 45 {
+		t.Errorf("totals = %+v, want 1 outbound, missed ratio 1/3 and average duration 45", line)
+	}
+	wantDays := []dayStatsView{{Date: "2025-09-21", Calls: 1}, {Date: "2025-09-22", Calls: 2, Missed: 1}, {Date: "2025-09-23", Calls: 1}}
+	if !slices.Equal(line.Days, wantDays) {
+		t.Errorf("days = %+v, want %+v", line.Days, wantDays)
+	}
+	wantHours := []hourStatsView{{Hour: 0, Calls: 3}, {Hour: 23, Calls: 1}}
+	if !slices.Equal(line.BusiestHours, wantHours) {
+		t.Errorf("busiest hours = %+v, want %+v", line.BusiestHours, wantHours)
+	}
+	if len(line.TopCallers) != 1 || line.TopCallers[0].Number != "+4930111111" {
+		t.Errorf("top callers = %+v, want +4930111111", line.TopCallers)
+	}
+
+	rec = httptest.NewRecorder()
+	dashboard.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/stats/lines?top=-1", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid top: status = %d, want 400", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	NewDashboard(Options{}).Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/stats/lines", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("without statistics: status = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,170 @@
+package web
+
+import (
+	"cmp"
+	"context"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/database"
+)
+
+// maxTopCallers bounds the top callers returned per line
+const maxTopCallers = 100
+
+// StatsStore aggregates the stored calls per line
+type StatsStore interface {
+	LineTotals(ctx context.Context, filter database.StatsFilter) ([]database.LineTotals, error)
+	HourlyCalls(ctx context.Context, filter database.StatsFilter) ([]database.HourlyCalls, error)
+	TopCallers(ctx context.Context, filter database.StatsFilter, limit int) ([]database.CallerCount, error)
+}
+
+// lineStatsView is the statistics of a line as returned by /api/stats/lines
+type lineStatsView struct {
+	Trunk           string          `json:"trunk"`
+	Calls           int64           `json:"calls"`
+	Inbound         int64           `json:"inbound"`
+	Outbound        int64           `json:"outbound"`
+	Answered        int64           `json:"answered"`
+	Missed          int64           `json:"missed"`
+	MissedRatio     float64         `json:"missed_ratio"`     // Share of the inbound calls that were missed
+	AverageDuration float64         `json:"average_duration"` // Talk time of the answered calls in seconds
+	Days            []dayStatsView  `json:"days"`             // Days with calls, oldest first
+	BusiestHours    []hourStatsView `json:"busiest_hours"`    // Hours of the day with calls, busiest first
+	TopCallers      []callerView    `json:"top_callers"`
+}
+
+// dayStatsView counts the calls of a line on a day
+type dayStatsView struct {
+	Date   string `json:"date"`
+	Calls  int64  `json:"calls"`
+	Missed int64  `json:"missed"`
+}
+
+// hourStatsView counts the calls of a line in an hour of the day
+type hourStatsView struct {
+	Hour  int   `json:"hour"` // 0-23
+	Calls int64 `json:"calls"`
+}
+
+// callerView counts the inbound calls of a number
+type callerView struct {
+	Number   string `json:"number"`
+	Calls    int64  `json:"calls"`
+	TalkTime int64  `json:"talk_time"` // Seconds
+}
+
+// serveLineStats answers with the statistics of every line, or of the line
+// given by ?trunk, for the calls started in the period of ?from and ?to, by
+// default the last 30 days. ?top limits the top callers (default: 10).
+// Counting happens in the database; days and hours are grouped in the
+// timezone of the dashboard.
+func (d *Dashboard) serveLineStats(w http.ResponseWriter, r *http.Request) {
+	if d.stats == nil {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: "statistics are not available"})
+		return
+	}
+
+	query := r.URL.Query()
+	from, to, err := d.period(query.Get("from"), query.Get("to"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	top := 10
+	if value := query.Get("top"); value != "" {
+		if top, err = strconv.Atoi(value); err != nil || top < 0 {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: "invalid top"})
+			return
+		}
+		top = min(top, maxTopCallers)
+	}
+
+	filter := database.StatsFilter{From: from, To: to, Trunk: query.Get("trunk")}
+	totals, err := d.stats.LineTotals(r.Context(), filter)
+	if err != nil {
+		log.Printf("Failed to compute line statistics: %v", err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to compute statistics"})
+		return
+	}
+	hours, err := d.stats.HourlyCalls(r.Context(), filter)
+	if err != nil {
+		log.Printf("Failed to compute line statistics: %v", err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to compute statistics"})
+		return
+	}
+	var callers []database.CallerCount
+	if top > 0 {
+		if callers, err = d.stats.TopCallers(r.Context(), filter, top); err != nil {
+			log.Printf("Failed to compute line statistics: %v", err)
+			writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "failed to compute statistics"})
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, lineStats(totals, hours, callers, d.location))
+}
+
+// lineStats assembles the statistics of the lines from the database aggregates
+func lineStats(totals []database.LineTotals, hours []database.HourlyCalls, callers []database.CallerCount, location *time.Location) []lineStatsView {
+	lines := make([]lineStatsView, len(totals))
+	byTrunk := make(map[string]*lineStatsView, len(totals))
+	hourOfDay := make(map[string]*[24]int64, len(totals))
+	for i, total := range totals {
+		lines[i] = lineStatsView{
+			Trunk:        total.Trunk,
+			Calls:        total.Calls,
+			Inbound:      total.Inbound,
+			Outbound:     total.Calls - total.Inbound,
+			Answered:     total.Answered,
+			Missed:       total.Missed,
+			Days:         make([]dayStatsView, 0),
+			BusiestHours: make([]hourStatsView, 0),
+			TopCallers:   make([]callerView, 0),
+		}
+		if total.Inbound > 0 {
+			lines[i].MissedRatio = float64(total.Missed) / float64(total.Inbound)
+		}
+		if total.Answered > 0 {
+			lines[i].AverageDuration = float64(total.TalkTime) / float64(total.Answered)
+		}
+		byTrunk[total.Trunk] = &lines[i]
+		hourOfDay[total.Trunk] = &[24]int64{}
+	}
+
+	// The hours of a line are ordered, so its days are too
+	for _, hour := range hours {
+		line, ok := byTrunk[hour.Trunk]
+		if !ok {
+			continue
+		}
+		local := hour.Hour.In(location)
+		date := local.Format(time.DateOnly)
+		if n := len(line.Days); n == 0 || line.Days[n-1].Date != date {
+			line.Days = append(line.Days, dayStatsView{Date: date})
+		}
+		line.Days[len(line.Days)-1].Calls += hour.Calls
+		line.Days[len(line.Days)-1].Missed += hour.Missed
+		hourOfDay[hour.Trunk][local.Hour()] += hour.Calls
+	}
+	for trunk, counts := range hourOfDay {
+		line := byTrunk[trunk]
+		for hour, calls := range counts {
+			if calls > 0 {
+				line.BusiestHours = append(line.BusiestHours, hourStatsView{Hour: hour, Calls: calls})
+			}
+		}
+		slices.SortStableFunc(line.BusiestHours, func(a, b hourStatsView) int {
+			return cmp.Compare(b.Calls, a.Calls)
+		})
+	}
+
+	for _, caller := range callers {
+		if line, ok := byTrunk[caller.Trunk]; ok {
+			line.TopCallers = append(line.TopCallers, callerView{Number: caller.Number, Calls: caller.Calls, TalkTime: caller.TalkTime})
+		}
+	}
+	return lines
+}
@@ -2,19 +2,37 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"fritz-callmonitor2mqtt/internal/callmonitor"
-	"fritz-callmonitor2mqtt/internal/config"
-	"fritz-callmonitor2mqtt/internal/database"
-	"fritz-callmonitor2mqtt/internal/mqtt"
-	"fritz-callmonitor2mqtt/pkg/types"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/app"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/backfill"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/backup"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/caldav"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/callquery"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/callrecord"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/config"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/database"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/export"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/health"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/influx"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/mqtt"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/notify"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/report"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/scheduler"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/simulator"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/tr064"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/web"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/callmonitor"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
 )
 
 var (
@@ -24,10 +42,33 @@ var (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		os.Exit(runExport(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && (os.Args[1] == "delete-call" || os.Args[1] == "restore-call") {
+		os.Exit(runDeleteCalls(os.Args[1], os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bulk" {
+		os.Exit(runBulk(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "decrypt" {
+		os.Exit(runDecrypt(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "healthcheck" {
+		os.Exit(runHealthcheck(os.Args[2:]))
+	}
+
 	var (
 		showVersion = flag.Bool("version", false, "Show version information")
 		help        = flag.Bool("help", false, "Show help")
 		configTest  = flag.Bool("config-test", false, "Test configuration and exit")
+		simulate    = flag.String("simulate", "", "Replay raw callmonitor lines from file instead of connecting to the Fritz!Box ('synthetic' or 'demo' for generated calls)")
+		speed       = flag.Float64("simulate-speed", 1, "Replay speed factor for -simulate (0 = no delays)")
+		demo        = flag.Bool("demo", false, "Replay demo calls with a malformed line and a dropped connection, same as -simulate demo")
+		selftest    = flag.Bool("selftest", false, "Verify the pipeline against an embedded MQTT broker and exit")
 	)
 	flag.Parse()
 
@@ -57,7 +98,34 @@ func main() {
 		os.Exit(0)
 	}
 
+	if *selftest {
+		if err := runSelftest(cfg, 30*time.Second); err != nil {
+			fmt.Printf("Self-test failed: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Self-test passed")
+		os.Exit(0)
+	}
+
 	log.Printf("Starting fritz-callmonitor2mqtt %s...", version)
+
+	// Replace the Fritz!Box with a local simulation server
+	if *demo && *simulate == "" {
+		*simulate = "demo"
+	}
+	if *simulate != "" {
+		steps, err := loadSimulationSteps(*simulate, cfg)
+		if err != nil {
+			log.Fatalf("Failed to load simulation: %v", err)
+		}
+		log.Printf("Simulation mode: replaying %s instead of connecting to %s", *simulate, cfg.FritzBox.Host)
+		server, err := startSimulation(steps, *speed, cfg)
+		if err != nil {
+			log.Fatalf("Failed to start simulation: %v", err)
+		}
+		defer func() { _ = server.Close() }()
+	}
+
 	log.Printf("Fritz!Box: %s:%d", cfg.FritzBox.Host, cfg.FritzBox.Port)
 	log.Printf("MQTT Broker: %s:%d", cfg.MQTT.Broker, cfg.MQTT.Port)
 	log.Printf("Timezone: %s", cfg.App.Timezone)
@@ -66,209 +134,779 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Setup signal handling
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-	// Initialize MQTT client
-	mqttClient := mqtt.NewClient(
-		cfg.MQTT.Broker,
-		cfg.MQTT.Port,
-		cfg.MQTT.Username,
-		cfg.MQTT.Password,
-		cfg.MQTT.ClientID,
-		cfg.MQTT.TopicPrefix,
-		cfg.MQTT.QoS,
-		cfg.MQTT.Retain,
-		cfg.MQTT.KeepAlive,
-		cfg.MQTT.ConnectTimeout,
-		cfg.App.LogLevel,
-	)
-
-	// Initialize database client
-	dbClient, err := database.NewClient(cfg.Database.DataDir)
+	application, err := newApplication(ctx, cfg)
 	if err != nil {
-		log.Fatalf("Failed to create database client: %v", err)
+		log.Fatalf("Failed to initialize application: %v", err)
 	}
 
-	// Connect to database
-	if err := dbClient.Connect(); err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+	// Schedule background maintenance jobs; the retention jobs always run, as
+	// a reload can enable them, and read the reloaded retention settings
+	jobs := scheduler.New()
+	if cfg.Database.RedactAfterDays > 0 {
+		log.Printf("Redacting last %d digits of stored numbers after %d days", cfg.Database.RedactDigits, cfg.Database.RedactAfterDays)
 	}
-	log.Printf("Database: %s", dbClient.GetDatabasePath())
+	jobs.Every("redaction", cfg.Database.RedactInterval, func(ctx context.Context) error {
+		retention := application.retention.Load()
+		if retention.RedactAfterDays <= 0 {
+			return nil
+		}
+		ctx, cancel := context.WithTimeout(ctx, cfg.Database.QueryTimeout)
+		defer cancel()
 
-	// Run migrations
-	if err := dbClient.RunEmbeddedMigrations(); err != nil {
-		log.Fatalf("Failed to run database migrations: %v", err)
-	}
-	log.Println("Database migrations completed successfully")
+		cutoff := time.Now().AddDate(0, 0, -retention.RedactAfterDays)
+		count, err := application.dbClient.RedactCallsBefore(ctx, cutoff, retention.RedactDigits)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			log.Printf("Redacted phone numbers of %d calls older than %s", count, cutoff.Format(time.DateOnly))
+		}
+		return nil
+	})
+
+	// Unparsed lines are only kept for reporting new formats
+	jobs.Every("unparsed-retention", time.Hour, func(ctx context.Context) error {
+		retention := application.retention.Load()
+		if retention.UnparsedDays <= 0 {
+			return nil
+		}
+		ctx, cancel := context.WithTimeout(ctx, cfg.Database.QueryTimeout)
+		defer cancel()
 
-	// Initialize callmonitor client
-	timezone, err := cfg.GetLocation()
+		cutoff := time.Now().AddDate(0, 0, -retention.UnparsedDays)
+		count, err := application.dbClient.DeleteUnparsedLinesBefore(ctx, cutoff)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			log.Printf("Deleted %d unparsed callmonitor lines older than %s", count, cutoff.Format(time.DateOnly))
+		}
+		return nil
+	})
+
+	// Calls past retention are archived to monthly files first and only
+	// deleted if the archive was written
+	location, err := cfg.GetLocation()
 	if err != nil {
 		log.Fatalf("Failed to load timezone: %v", err)
 	}
-	callmonitorClient := callmonitor.NewClient(cfg.FritzBox.Host, cfg.FritzBox.Port, timezone, cfg.PBX.CountryCode, cfg.PBX.LocalAreaCode, cfg.PBX.MSN)
+	if cfg.Database.RetentionDays > 0 {
+		log.Printf("Deleting calls after %d days, archive format: %s", cfg.Database.RetentionDays, cfg.Database.ArchiveFormat)
+	}
+	jobs.Every("call-retention", time.Hour, func(ctx context.Context) error {
+		retention := application.retention.Load()
+		if retention.RetentionDays <= 0 {
+			return nil
+		}
+		ctx, cancel := context.WithTimeout(ctx, cfg.Database.QueryTimeout)
+		defer cancel()
 
-	// Initialize call manager with MQTT integration
-	callManager := types.NewCallManagerWithMQTT(mqttClient, func(line int, oldStatus, newStatus types.CallStatus, event *types.CallEvent) {
-		log.Printf("Line %d status changed: %s -> %s", line, oldStatus, newStatus)
+		cutoff := time.Now().AddDate(0, 0, -retention.RetentionDays)
+		if retention.ArchiveFormat != export.ArchiveFormatNone {
+			calls, err := application.dbClient.ListCalls(ctx, time.Time{}, cutoff)
+			if err != nil {
+				return err
+			}
+			if _, err := export.Archive(retention.GetArchiveDir(), calls, location); err != nil {
+				return err
+			}
+		}
+		count, err := application.dbClient.PurgeCallsBefore(ctx, cutoff)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			log.Printf("Deleted %d calls older than %s", count, cutoff.Format(time.DateOnly))
+		}
+		return nil
 	})
 
-	// Start the application
-	app := &Application{
-		config:            cfg,
-		mqttClient:        mqttClient,
-		callmonitorClient: callmonitorClient,
-		dbClient:          dbClient,
-		callManager:       callManager,
-		ctx:               ctx,
+	// Create the call report once a month is over
+	if cfg.Report.Enabled {
+		generator, err := newReportGenerator(cfg, application.dbClient)
+		if err != nil {
+			log.Fatalf("Failed to initialize call reports: %v", err)
+		}
+		log.Printf("Creating monthly call reports in %s", cfg.GetReportDir())
+		jobs.Every("report", cfg.Report.Interval, func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, cfg.Database.QueryTimeout)
+			defer cancel()
+			return generator.Run(ctx)
+		})
+	}
+
+	// Pick up deflection changes made in the Fritz!Box UI
+	if cfg.FritzBox.DNDControl {
+		jobs.Every("dnd", cfg.FritzBox.DNDRefreshInterval, application.MQTTClient().RefreshDND)
+	}
+
+	// Switch the publishing profile on its schedule, e.g. no ringing at night
+	if len(cfg.MQTT.ProfileSchedule) > 0 {
+		jobs.Every("profile", time.Minute, application.MQTTClient().ApplyProfileSchedule)
+	}
+
+	// Pick up rotated MQTT credentials, e.g. short-lived tokens written by a secrets agent or renewed via OAuth
+	if (cfg.HasMQTTCredentialFiles() || cfg.HasMQTTOAuth()) && cfg.MQTT.CredentialsCheckInterval > 0 {
+		jobs.Every("mqtt-credentials", cfg.MQTT.CredentialsCheckInterval, application.ReloadMQTTCredentials)
+	}
+
+	// Push the stats to the broker for dashboards without access to /healthz
+	if cfg.MQTT.MetricsInterval > 0 {
+		log.Printf("Publishing metrics every %v", cfg.MQTT.MetricsInterval)
+		jobs.Every("metrics", cfg.MQTT.MetricsInterval, func(ctx context.Context) error {
+			metrics, err := application.healthServer.Metrics(cfg.MQTT.Metrics)
+			if err != nil {
+				return err
+			}
+			return application.MQTTClient().PublishMetrics(ctx, metrics)
+		})
 	}
 
+	// Watch the database size, so runaway growth is noticed before the disk fills
+	if cfg.Database.HealthInterval > 0 {
+		jobs.Every("database-health", cfg.Database.HealthInterval, func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, cfg.Database.QueryTimeout)
+			defer cancel()
+
+			snapshot, err := application.dbClient.Health(ctx)
+			if err != nil {
+				return err
+			}
+			application.dbHealth.Store(&snapshot)
+			return application.MQTTClient().PublishDatabaseHealth(ctx, snapshot)
+		})
+	}
+
+	// Copy the database off the box, e.g. to the Fritz!Box NAS; the first backup is taken at startup
+	if cfg.BackupEnabled() {
+		backupJob, err := newBackupJob(cfg, application.dbClient)
+		if err != nil {
+			log.Fatalf("Failed to initialize database backups: %v", err)
+		}
+		application.healthServer.AddStats("backup", func() any { return backupJob.Stats() })
+		jobs.Every("backup", cfg.Backup.Interval, func(ctx context.Context) error {
+			ctx, cancel := context.WithTimeout(ctx, cfg.Backup.Timeout)
+			defer cancel()
+			return backupJob.Run(ctx)
+		})
+	}
+
+	// Detect retained topics overwritten or cleared by other clients
+	if cfg.MQTT.RetainedCheckInterval > 0 {
+		log.Printf("Checking retained topics every %v (repair: %t)", cfg.MQTT.RetainedCheckInterval, cfg.MQTT.RetainedRepair)
+		jobs.Every("retained-check", cfg.MQTT.RetainedCheckInterval, func(ctx context.Context) error {
+			_, err := application.MQTTClient().CheckRetained(ctx, cfg.MQTT.RetainedRepair)
+			return err
+		})
+	}
+
+	// Start background jobs
+	jobs.Start(ctx)
+
 	// Run application in background
 	go func() {
-		if err := app.Run(); err != nil {
+		if err := application.Run(); err != nil {
 			log.Printf("Application error: %v", err)
 			cancel()
 		}
 	}()
 
-	// Wait for shutdown signal
-	select {
-	case sig := <-sigChan:
-		log.Printf("Received signal %v, shutting down gracefully...", sig)
-	case <-ctx.Done():
-		log.Println("Context cancelled, shutting down...")
-	}
+	// Wait for shutdown signal, SIGHUP reloads the configuration and re-reads the MQTT credential files
+	application.WaitForShutdown(ctx)
 
 	// Shutdown
-	app.Shutdown()
+	cancel()
+	jobs.Wait()
+	application.Shutdown()
 	log.Println("fritz-callmonitor2mqtt stopped")
 }
 
-// Application holds all application components
-type Application struct {
-	config            *config.Config
-	mqttClient        *mqtt.Client
-	callmonitorClient *callmonitor.Client
-	dbClient          *database.Client
-	callManager       *types.CallManager
-	ctx               context.Context
+// loadSimulationSteps reads the simulation file or generates synthetic or demo calls
+func loadSimulationSteps(source string, cfg *config.Config) ([]simulator.Step, error) {
+	if source != "synthetic" && source != "demo" {
+		return simulator.LoadFile(source)
+	}
+	ownNumber := ""
+	if msns, _, err := cfg.GetMSNs(); err == nil && len(msns) > 0 {
+		ownNumber = msns[0]
+	}
+	if source == "demo" {
+		return simulator.Demo(ownNumber), nil
+	}
+	return simulator.Synthetic(ownNumber), nil
 }
 
-// Run starts the main application loop
-func (app *Application) Run() error {
-	// Connect to MQTT broker
-	log.Println("Connecting to MQTT broker...")
-	if err := app.mqttClient.Connect(); err != nil {
-		return fmt.Errorf("failed to connect to MQTT broker: %w", err)
+// startSimulation starts a simulated callmonitor and points the Fritz!Box settings to it
+func startSimulation(steps []simulator.Step, speed float64, cfg *config.Config) (*simulator.Server, error) {
+	server := simulator.NewServer(steps, speed)
+	host, port, err := server.Start()
+	if err != nil {
+		return nil, err
 	}
-	log.Println("Connected to MQTT broker")
 
-	// Main connection loop with retry logic
-	for {
-		select {
-		case <-app.ctx.Done():
-			return nil
-		default:
-		}
+	cfg.FritzBox.Host = host
+	cfg.FritzBox.Port = port
+	return server, nil
+}
 
-		log.Println("Connecting to Fritz!Box callmonitor...")
-		if err := app.callmonitorClient.Connect(); err != nil {
-			log.Printf("Failed to connect to Fritz!Box: %v", err)
-			log.Printf("Retrying in %v...", app.config.App.ReconnectDelay)
+// newApplication wires up the shared event loop and extends it with database,
+// health check server, web UI and the further sinks of the full build
+func newApplication(ctx context.Context, cfg *config.Config) (*Application, error) {
+	databaseFilter, err := cfg.GetDatabaseFilter()
+	if err != nil {
+		return nil, fmt.Errorf("invalid database filter: %w", err)
+	}
 
-			select {
-			case <-time.After(app.config.App.ReconnectDelay):
-				continue
-			case <-app.ctx.Done():
-				return nil
-			}
+	// Deflection rules are switched via TR-064, which needs a Fritz!Box user
+	opts := app.Options{Version: version}
+	if cfg.FritzBox.DNDControl {
+		opts.DND = tr064.NewClient(tr064.Options{
+			Host:     cfg.FritzBox.Host,
+			Port:     cfg.FritzBox.TR064Port,
+			Username: cfg.FritzBox.Username,
+			Password: cfg.FritzBox.Password,
+			Timeout:  cfg.FritzBox.ConnectTimeout,
+		})
+		log.Printf("DND control enabled via TR-064 on %s:%d", cfg.FritzBox.Host, cfg.FritzBox.TR064Port)
+	}
+	if cfg.FritzBox.DetectTimezone {
+		opts.Timezone = func(configured *time.Location) *time.Location {
+			return detectTimezone(cfg, configured)
 		}
+	}
 
-		log.Println("Connected to Fritz!Box callmonitor")
+	// Export finished calls for time-series dashboards
+	var sinks []types.CallEventSink
+	if cfg.Influx.URL != "" {
+		influxFilter, err := cfg.GetInfluxFilter()
+		if err != nil {
+			return nil, fmt.Errorf("invalid influx filter: %w", err)
+		}
+		exporter, err := influx.NewExporter(influx.Options{
+			URL:         cfg.Influx.URL,
+			Token:       cfg.Influx.Token,
+			Org:         cfg.Influx.Org,
+			Bucket:      cfg.Influx.Bucket,
+			Measurement: cfg.Influx.Measurement,
+			Timeout:     cfg.Influx.Timeout,
+			Filter:      influxFilter,
+		})
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, exporter)
+		log.Printf("Exporting finished calls as line protocol to %s", cfg.Influx.URL)
+	}
 
-		// Process events until connection is lost
-		if err := app.processEvents(); err != nil {
-			log.Printf("Event processing error: %v", err)
+	// Log answered calls in a calendar
+	if cfg.CalDAV.URL != "" {
+		password, err := cfg.GetCalDAVPassword()
+		if err != nil {
+			return nil, err
+		}
+		contacts, err := cfg.GetCalDAVContacts()
+		if err != nil {
+			return nil, err
 		}
+		calendar, err := caldav.NewCalendar(caldav.Options{
+			URL:         cfg.CalDAV.URL,
+			Username:    cfg.CalDAV.Username,
+			Password:    password,
+			MinDuration: cfg.CalDAV.MinDuration,
+			Timeout:     cfg.CalDAV.Timeout,
+			Contacts:    contacts,
+		})
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, calendar)
+		log.Printf("Creating calendar entries for answered calls in %s", cfg.CalDAV.URL)
+	}
 
-		// Clean up connection
-		if err := app.callmonitorClient.Disconnect(); err != nil {
-			log.Printf("Error disconnecting callmonitor: %v", err)
+	// Push selected calls to phones via Telegram, Pushover or ntfy
+	var dispatcher *notify.Dispatcher
+	if cfg.NotifyEnabled() {
+		dispatcher, err = newNotifyDispatcher(cfg)
+		if err != nil {
+			return nil, err
 		}
+		sinks = append(sinks, app.SkipRepeatCalls(dispatcher, cfg))
+	}
 
-		if app.ctx.Err() != nil {
-			return nil
+	shared, err := app.New(ctx, cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+	mqttClient := shared.MQTTClient()
+
+	// Initialize database client
+	dbClient, err := newDatabaseClient(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database client: %w", err)
+	}
+
+	// Connect to database and run migrations; a locked database must not block startup forever
+	dbCtx, cancel := context.WithTimeout(ctx, cfg.Database.QueryTimeout)
+	defer cancel()
+
+	if err := dbClient.Connect(dbCtx); err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	if path := dbClient.GetDatabasePath(); path != "" {
+		log.Printf("Database: %s", path)
+	} else {
+		log.Printf("Database: %s", dbClient.Driver())
+	}
+
+	if err := dbClient.RunEmbeddedMigrations(dbCtx); err != nil {
+		_ = dbClient.Close()
+		return nil, fmt.Errorf("failed to run database migrations: %w", err)
+	}
+	log.Println("Database migrations completed successfully")
+
+	// Line status sequence numbers continue across restarts
+	if err := mqttClient.RestoreSequences(dbCtx, dbClient); err != nil {
+		log.Printf("Line status sequence numbers restart at 1: %v", err)
+	}
+
+	// Missed calls still waiting for an acknowledgement are escalated after a restart
+	if err := mqttClient.RestoreMissedCallAcks(dbCtx, dbClient); err != nil {
+		log.Printf("Pending missed call acknowledgements are lost: %v", err)
+	}
+
+	// Dashboards without access to the HTTP API read the call log via MQTT
+	if cfg.MQTT.CallQuery {
+		mqttClient.ServeCallQueries(callquery.NewService(dbClient, callquery.Options{MaxCalls: cfg.MQTT.CallQueryLimit, Timeout: cfg.Database.QueryTimeout}))
+	}
+
+	// Calls running during the restart are completed with their call ID
+	if err := shared.RestoreCalls(dbCtx, dbClient); err != nil {
+		log.Printf("Calls active before the restart are lost: %v", err)
+	}
+
+	var backfiller *backfill.Backfiller
+	if cfg.FritzBox.BackfillCallList {
+		backfiller, err = newBackfiller(cfg, dbClient, mqttClient, shared.Timezone(), databaseFilter)
+		if err != nil {
+			_ = dbClient.Close()
+			return nil, err
 		}
+	}
 
-		log.Printf("Connection lost, reconnecting in %v...", app.config.App.ReconnectDelay)
-		select {
-		case <-time.After(app.config.App.ReconnectDelay):
-		case <-app.ctx.Done():
-			return nil
+	// Expose liveness and readiness endpoints for Docker/Kubernetes, together with the notification rules API
+	healthServer := newHealthServer(cfg, mqttClient, shared.CallmonitorClient(), dbClient)
+	healthServer.AddStats("reconnects", func() any { return shared.ReconnectStats() })
+	healthServer.AddStats("restarts", func() any { return shared.Restarts() })
+	healthServer.AddStats("sinks", func() any { return shared.SinkStats() })
+	healthServer.SetAPIToken(cfg.App.APIToken)
+	healthServer.SetStartupGrace(time.Now().Add(shared.GraceRemaining()))
+	rulesAPI := notify.NewHandler(dbClient)
+	healthServer.Handle(notify.RulesPath, rulesAPI)
+	healthServer.Handle(notify.RulesPath+"/", rulesAPI)
+	if cfg.App.WebUI {
+		dashboard := web.NewDashboard(web.Options{Lines: mqttClient, Calls: dbClient, Stats: dbClient, Enrich: newEnricher(cfg), Location: shared.Timezone(), Source: cfg.App.CloudEventsSource})
+		for _, path := range web.Paths {
+			healthServer.Handle(path, dashboard.Handler())
+		}
+		sinks = append(sinks, dashboard)
+	}
+	if cfg.App.HealthCheckPort > 0 {
+		if err := healthServer.Start(); err != nil {
+			_ = dbClient.Close()
+			return nil, err
 		}
 	}
-}
 
-// processEvents handles incoming call events
-func (app *Application) processEvents() error {
-	for {
-		select {
-		case <-app.ctx.Done():
-			return nil
+	// Publish a consolidated record of every finished call once it is stored
+	contacts, err := cfg.GetReportContacts()
+	if err != nil {
+		_ = dbClient.Close()
+		return nil, err
+	}
+	records := callrecord.NewPublisher(dbClient, mqttClient, callrecord.Options{Contacts: contacts, Timeout: cfg.MQTT.PublishTimeout})
+
+	// Persist call events in the background so database writes never delay the state machine
+	dbWriter := database.NewWriter(dbClient, database.WriterOptions{
+		QueueSize:     cfg.Database.QueueSize,
+		BatchSize:     cfg.Database.BatchSize,
+		FlushInterval: cfg.Database.FlushInterval,
+		Timeout:       cfg.Database.QueryTimeout,
+		Filter:        databaseFilter,
+		OnFlush:       records.Stored,
+	})
+	dbWriter.Start()
+	healthServer.AddStats("database_writer", func() any { return dbWriter.Stats() })
+
+	// Counting rows is too slow for every health check, the database health job collects a snapshot
+	dbHealth := new(atomic.Pointer[database.Health])
+	healthServer.AddStats("database", func() any { return dbHealth.Load() })
+
+	// Only stats known to the health server can be pushed as metrics
+	if _, err := healthServer.Metrics(cfg.MQTT.Metrics); err != nil {
+		_ = dbClient.Close()
+		return nil, fmt.Errorf("invalid metrics: %w", err)
+	}
 
-		case event := <-app.callmonitorClient.Events():
-			log.Printf("Received call event: %s - %s -> %s (ID: %s,Type: %s, Line: %d, Trunk: %s)",
-				event.Timestamp.Format("15:04:05"),
-				event.Caller,
-				event.Called,
-				event.ID,
-				event.Type,
-				event.Line,
-				event.Trunk)
-
-			// Process through FSM and publish event to MQTT
-			processedEvent := app.callManager.ProcessEvent(&event)
-			if err := app.mqttClient.PublishCallEvent(*processedEvent); err != nil {
-				log.Printf("Failed to publish call event: %v", err)
+	// The backfill runs in the background once the callmonitor connected,
+	// the database must stay open until it finished
+	var backfillDone sync.WaitGroup
+
+	application := &Application{Application: shared, dbClient: dbClient, healthServer: healthServer, dbHealth: dbHealth}
+	application.retention.Store(&cfg.Database)
+
+	ext := app.Extensions{
+		Sinks: append([]types.CallEventSink{dbWriter, app.SkipRepeatCalls(notify.NewNotifier(dbClient, mqttClient), cfg)}, sinks...),
+		OnEvent: func(types.CallEvent) {
+			healthServer.RecordEvent(time.Now())
+		},
+		OnUnparsed: func(unparsed callmonitor.Unparsed) {
+			if err := dbWriter.QueueUnparsedLine(unparsed.Line, unparsed.Reason, unparsed.Time); err != nil {
+				log.Printf("Failed to store unparsed callmonitor line: %v", err)
+			}
+		},
+		OnStop: func(ctx context.Context) {
+			if err := healthServer.Shutdown(ctx); err != nil {
+				log.Printf("Error stopping health check server: %v", err)
 			}
+		},
+		OnClose: func(ctx context.Context) {
+			backfillDone.Wait()
 
-		case err := <-app.callmonitorClient.Errors():
-			return fmt.Errorf("callmonitor error: %w", err)
+			// Flush queued call events before the database is closed
+			if err := dbWriter.Shutdown(ctx); err != nil {
+				log.Printf("Database writer did not finish within the shutdown timeout: %v", err)
+			}
+			stats := dbWriter.Stats()
+			log.Printf("Stored %d call events in %d batches (%d dropped, %d failed, %d writes retried)", stats.Written, stats.Batches, stats.Dropped, stats.Failed, stats.Retried)
+
+			if err := dbClient.Close(); err != nil {
+				log.Printf("Error closing database: %v", err)
+			}
+		},
+		OnReload: func(_ context.Context, reloaded *config.Config) {
+			// Notification channels need a restart, their rules do not
+			if dispatcher != nil {
+				if err := updateNotifyRules(dispatcher, reloaded); err != nil {
+					log.Printf("Keeping the previous notification rules: %v", err)
+				}
+			}
+			application.retention.Store(&reloaded.Database)
+		},
+	}
+	if backfiller != nil {
+		ext.OnReady = func(ctx context.Context) {
+			connected := time.Now()
+			backfillDone.Add(1)
+			go func() {
+				defer backfillDone.Done()
+				backfillCallList(ctx, backfiller, connected)
+			}()
 		}
 	}
+	shared.Extend(ext)
+
+	return application, nil
+}
+
+// newDatabaseClient creates the client of the configured database driver
+func newDatabaseClient(cfg *config.Config) (*database.Client, error) {
+	if cfg.Database.Driver != database.DriverPostgres {
+		return database.NewClient(cfg.Database.DataDir)
+	}
+	dsn, err := cfg.GetDatabaseDSN()
+	if err != nil {
+		return nil, err
+	}
+	return database.NewPostgresClient(dsn)
+}
+
+// notifyRules returns the dispatcher options deciding which calls are pushed and how, without channels
+func notifyRules(cfg *config.Config) (notify.DispatcherOptions, error) {
+	triggers, err := notify.ParseTriggers(cfg.Notify.Triggers)
+	if err != nil {
+		return notify.DispatcherOptions{}, err
+	}
+	vips, err := cfg.GetNotifyVIPs()
+	if err != nil {
+		return notify.DispatcherOptions{}, err
+	}
+	location, err := cfg.GetLocation()
+	if err != nil {
+		return notify.DispatcherOptions{}, err
+	}
+	return notify.DispatcherOptions{
+		Triggers:        triggers,
+		VIPs:            vips,
+		LongCall:        cfg.Notify.LongCall,
+		Location:        location,
+		TitleTemplate:   cfg.Notify.TitleTemplate,
+		MessageTemplate: cfg.Notify.MessageTemplate,
+	}, nil
 }
 
-// Shutdown gracefully shuts down the application
-func (app *Application) Shutdown() {
-	log.Println("Shutting down application...")
+// updateNotifyRules applies the notification rules of a reloaded configuration
+func updateNotifyRules(dispatcher *notify.Dispatcher, cfg *config.Config) error {
+	rules, err := notifyRules(cfg)
+	if err != nil {
+		return err
+	}
+	return dispatcher.UpdateRules(rules)
+}
 
-	if app.callManager != nil {
-		app.callManager.Cleanup()
+// newNotifyDispatcher creates the dispatcher of push notifications with all configured channels
+func newNotifyDispatcher(cfg *config.Config) (*notify.Dispatcher, error) {
+	opts, err := notifyRules(cfg)
+	if err != nil {
+		return nil, err
 	}
 
-	if app.callmonitorClient != nil {
-		if err := app.callmonitorClient.Disconnect(); err != nil {
-			log.Printf("Error disconnecting callmonitor: %v", err)
-		}
+	httpClient := &http.Client{Timeout: cfg.Notify.Timeout}
+	var channels []notify.Channel
+	if cfg.Notify.TelegramToken != "" {
+		channels = append(channels, notify.NewTelegram(notify.TelegramOptions{
+			Token:      cfg.Notify.TelegramToken,
+			ChatID:     cfg.Notify.TelegramChatID,
+			HTTPClient: httpClient,
+		}))
+	}
+	if cfg.Notify.PushoverToken != "" {
+		channels = append(channels, notify.NewPushover(notify.PushoverOptions{
+			Token:      cfg.Notify.PushoverToken,
+			User:       cfg.Notify.PushoverUser,
+			HTTPClient: httpClient,
+		}))
+	}
+	if cfg.Notify.NtfyTopic != "" {
+		channels = append(channels, notify.NewNtfy(notify.NtfyOptions{
+			URL:        cfg.Notify.NtfyURL,
+			Topic:      cfg.Notify.NtfyTopic,
+			Token:      cfg.Notify.NtfyToken,
+			HTTPClient: httpClient,
+		}))
 	}
 
-	if app.mqttClient != nil {
-		if err := app.mqttClient.Disconnect(); err != nil {
-			log.Printf("Error disconnecting MQTT: %v", err)
+	opts.Channels = channels
+	dispatcher, err := notify.NewDispatcher(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(channels))
+	for _, channel := range channels {
+		names = append(names, channel.Name())
+	}
+	log.Printf("Sending push notifications for %s via %s", strings.Join(cfg.Notify.Triggers, ", "), strings.Join(names, ", "))
+	return dispatcher, nil
+}
+
+// newReportGenerator creates the generator of the monthly call reports, mailing them if an SMTP host is set
+func newReportGenerator(cfg *config.Config, store report.CallStore) (*report.Generator, error) {
+	location, err := cfg.GetLocation()
+	if err != nil {
+		return nil, err
+	}
+	tariffs, err := cfg.GetReportTariffs()
+	if err != nil {
+		return nil, err
+	}
+	contacts, err := cfg.GetReportContacts()
+	if err != nil {
+		return nil, err
+	}
+
+	opts := report.Options{
+		Dir:      cfg.GetReportDir(),
+		Location: location,
+		Currency: cfg.Report.Currency,
+		Tariffs:  tariffs,
+		Contacts: contacts,
+	}
+	if cfg.Report.SMTPHost != "" {
+		password, err := cfg.GetReportSMTPPassword()
+		if err != nil {
+			return nil, err
+		}
+		opts.Sender = &report.Mailer{
+			Host:     cfg.Report.SMTPHost,
+			Port:     cfg.Report.SMTPPort,
+			Username: cfg.Report.SMTPUsername,
+			Password: password,
+			From:     cfg.Report.MailFrom,
+			To:       cfg.Report.MailTo,
 		}
 	}
+	return report.NewGenerator(store, opts), nil
+}
 
-	if app.dbClient != nil {
-		if err := app.dbClient.Close(); err != nil {
-			log.Printf("Error closing database: %v", err)
+// newBackupJob creates the database backup to S3 or WebDAV, whichever is configured
+func newBackupJob(cfg *config.Config, db backup.Snapshotter) (*backup.Job, error) {
+	var target backup.Target
+	if cfg.Backup.S3Bucket != "" {
+		secretKey, err := cfg.GetBackupS3SecretKey()
+		if err != nil {
+			return nil, err
+		}
+		if target, err = backup.NewS3(backup.S3Options{
+			Endpoint:  cfg.Backup.S3Endpoint,
+			Region:    cfg.Backup.S3Region,
+			Bucket:    cfg.Backup.S3Bucket,
+			Prefix:    cfg.Backup.S3Prefix,
+			AccessKey: cfg.Backup.S3AccessKey,
+			SecretKey: secretKey,
+			PathStyle: cfg.Backup.S3PathStyle,
+			Timeout:   cfg.Backup.Timeout,
+		}); err != nil {
+			return nil, err
+		}
+	} else {
+		password, err := cfg.GetBackupWebDAVPassword()
+		if err != nil {
+			return nil, err
+		}
+		if target, err = backup.NewWebDAV(backup.WebDAVOptions{
+			URL:      cfg.Backup.WebDAVURL,
+			Username: cfg.Backup.WebDAVUsername,
+			Password: password,
+			Timeout:  cfg.Backup.Timeout,
+		}); err != nil {
+			return nil, err
 		}
 	}
+
+	log.Printf("Backing up the database every %v to %s, keeping the last %d", cfg.Backup.Interval, target, cfg.Backup.Keep)
+	// The snapshot is compressed next to the database, as /tmp is often a small tmpfs
+	return backup.NewJob(db, target, backup.Options{Keep: cfg.Backup.Keep, TempDir: cfg.Database.DataDir}), nil
+}
+
+// newBackfiller creates the import of the Fritz!Box call list
+func newBackfiller(cfg *config.Config, store database.Store, mqttClient *mqtt.Client, timezone *time.Location, filter types.HistoryFilter) (*backfill.Backfiller, error) {
+	extensionFilter, err := cfg.GetExtensionFilter()
+	if err != nil {
+		return nil, err
+	}
+	msns, msnNames, err := cfg.GetMSNs()
+	if err != nil {
+		return nil, err
+	}
+	client := tr064.NewClient(tr064.Options{
+		Host:     cfg.FritzBox.Host,
+		Port:     cfg.FritzBox.TR064Port,
+		Username: cfg.FritzBox.Username,
+		Password: cfg.FritzBox.Password,
+		Timeout:  cfg.FritzBox.ConnectTimeout,
+	})
+	backfiller, err := backfill.New(backfill.Options{
+		CallList:        client,
+		Store:           store,
+		History:         mqttClient,
+		Location:        timezone,
+		CountryCode:     cfg.PBX.CountryCode,
+		LocalAreaCode:   cfg.PBX.LocalAreaCode,
+		Region:          cfg.PBX.Region,
+		MSNs:            msns,
+		MSNNames:        msnNames,
+		DoNotRecord:     cfg.PBX.DoNotRecord,
+		ExtensionFilter: extensionFilter,
+		TrunkFilter:     cfg.GetTrunkFilter(),
+		Filter:          filter,
+		TAMExtensions:   cfg.PBX.TAMExtensions,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure call list backfill: %w", err)
+	}
+	return backfiller, nil
+}
+
+// backfillCallList imports the calls of the Fritz!Box call list before the
+// callmonitor connected. A failure is only logged, the import is retried on
+// the next start.
+func backfillCallList(ctx context.Context, backfiller *backfill.Backfiller, connected time.Time) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	count, err := backfiller.Run(ctx, connected)
+	if errors.Is(err, backfill.ErrTrunkFilter) {
+		log.Printf("Warning: Not backfilling the call history: %v", err)
+		return
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to backfill the call history from the Fritz!Box call list: %v", err)
+		return
+	}
+	if count > 0 {
+		log.Printf("Backfilled %d calls from the Fritz!Box call list", count)
+	}
+}
+
+// detectTimezone reads the timezone configured on the Fritz!Box via TR-064,
+// keeping the configured one if the box cannot be queried
+func detectTimezone(cfg *config.Config, fallback *time.Location) *time.Location {
+	client := tr064.NewClient(tr064.Options{
+		Host:     cfg.FritzBox.Host,
+		Port:     cfg.FritzBox.TR064Port,
+		Username: cfg.FritzBox.Username,
+		Password: cfg.FritzBox.Password,
+		Timeout:  cfg.FritzBox.ConnectTimeout,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.FritzBox.ConnectTimeout)
+	defer cancel()
+
+	location, err := client.GetLocation(ctx)
+	if err != nil {
+		log.Printf("Warning: Failed to detect Fritz!Box timezone, using %s: %v", fallback, err)
+		return fallback
+	}
+	now := time.Now()
+	_, detectedOffset := now.In(location).Zone()
+	_, configuredOffset := now.In(fallback).Zone()
+	if detectedOffset != configuredOffset {
+		log.Printf("Fritz!Box timezone %s differs from configured timezone %s", location, fallback)
+	}
+	log.Printf("Using Fritz!Box timezone %s for callmonitor timestamps", location)
+	return location
+}
+
+// newHealthServer registers the dependency checks. A lost MQTT or database connection
+// requires a restart, while the callmonitor reconnects by itself and only affects readiness.
+func newHealthServer(cfg *config.Config, mqttClient *mqtt.Client, callmonitorClient *callmonitor.Client, dbClient database.Store) *health.Server {
+	server := health.NewServer(cfg.App.HealthCheckPort)
+	server.AddLivenessCheck("mqtt", func(ctx context.Context) error {
+		if !mqttClient.IsConnected() {
+			return fmt.Errorf("not connected to %s", strings.Join(mqttClient.BrokerStats().Brokers, " or "))
+		}
+		return nil
+	})
+	server.AddLivenessCheck("database", dbClient.Ping)
+	server.AddStats("mqtt_publish", func() any { return mqttClient.PublishStats() })
+	server.AddStats("mqtt_retained", func() any { return mqttClient.RetainedStats() })
+	server.AddStats("mqtt_brokers", func() any { return mqttClient.BrokerStats() })
+	server.AddStats("mqtt_acl", func() any { return mqttClient.ACLCheck() })
+	server.AddReadinessCheck("callmonitor", func(ctx context.Context) error {
+		if !callmonitorClient.IsConnected() {
+			return fmt.Errorf("not connected to %s:%d", cfg.FritzBox.Host, cfg.FritzBox.Port)
+		}
+		return nil
+	})
+	return server
+}
+
+// Application is the shared event loop extended by database, health check server and web UI
+type Application struct {
+	*app.Application
+	dbClient     database.Store
+	healthServer *health.Server
+	retention    atomic.Pointer[config.DatabaseConfig] // Retention settings, replaced on reload
+	dbHealth     *atomic.Pointer[database.Health]      // Last snapshot of the database health job, nil before
 }
 
 func printUsage() {
 	fmt.Printf(`Usage: fritz-callmonitor2mqtt [OPTIONS]
+       fritz-callmonitor2mqtt export [-from DATE] [-to DATE] [-format csv|json] [-columns LIST] [-timezone TZ] [-output FILE]
+       fritz-callmonitor2mqtt delete-call|restore-call ID...
+       fritz-callmonitor2mqtt bulk delete|restore|tag|untag|enrich [-from DATE] [-to DATE] [-number PATTERN] [-tagged TAG] [-tag TAG] [-yes]
+       fritz-callmonitor2mqtt migrate status|up|down|redo [-to VERSION] [-dry-run]
+       fritz-callmonitor2mqtt decrypt [-key KEY] [-raw] | -generate
+       fritz-callmonitor2mqtt healthcheck [-live] [-url URL] [-timeout DURATION]
 
 Fritz!Box Callmonitor to MQTT Bridge - Monitors Fritz!Box call events and publishes them to MQTT.
 
@@ -276,32 +914,248 @@ Options:
   -version       Show version information
   -help          Show this help message
   -config-test   Test configuration and exit
+  -selftest      Verify the pipeline against an embedded MQTT broker and exit
+  -simulate FILE Replay raw callmonitor lines from FILE ('synthetic' or 'demo' for generated calls)
+  -simulate-speed N  Replay speed factor for -simulate (default: 1, 0 = no delays)
+  -demo          Replay demo calls with a malformed line and a dropped connection, same as -simulate demo
+
+Commands:
+  export         Write the stored calls as CSV or JSON, see 'fritz-callmonitor2mqtt export -help'
+  delete-call    Delete stored calls by ID, they are kept and can be restored
+  restore-call   Restore deleted calls by ID
+  bulk           Delete, restore, tag, untag or re-enrich the calls selected by date and number, see 'fritz-callmonitor2mqtt bulk -help'
+  migrate        Show, apply or revert database schema migrations, see 'fritz-callmonitor2mqtt migrate -help'
+  decrypt        Decrypt payloads encrypted with FRITZ_CALLMONITOR_MQTT_ENCRYPTION_KEY, or generate a key with -generate
+  healthcheck    Exit with 0 if the running instance is ready (-live: alive), e.g. as Docker HEALTHCHECK
 
 Configuration via Environment Variables:
+  FRITZ_CALLMONITOR_CONFIG_FILE              File with KEY=VALUE settings overriding the environment,
+                                             reloaded on SIGHUP and {prefix}/command/reload (optional)
   FRITZ_CALLMONITOR_FRITZBOX_HOST            Fritz!Box hostname (default: fritz.box)
   FRITZ_CALLMONITOR_FRITZBOX_PORT            Fritz!Box callmonitor port (default: 1012)
+  FRITZ_CALLMONITOR_FRITZBOX_CONNECT_TIMEOUT Fritz!Box connect timeout (default: 10s)
+  FRITZ_CALLMONITOR_FRITZBOX_USERNAME        Fritz!Box user for TR-064 (optional)
+  FRITZ_CALLMONITOR_FRITZBOX_PASSWORD        Fritz!Box password for TR-064 (optional)
+  FRITZ_CALLMONITOR_FRITZBOX_TR064_PORT      Fritz!Box TR-064 port (default: 49000)
+  FRITZ_CALLMONITOR_FRITZBOX_DND_CONTROL     Switch call deflections via {prefix}/command/dnd (default: false)
+  FRITZ_CALLMONITOR_FRITZBOX_DND_DEFLECTIONS Deflection rule IDs switched by ON/OFF (default: all)
+  FRITZ_CALLMONITOR_FRITZBOX_DND_REFRESH_INTERVAL How often the DND state is re-read (default: 5m)
+  FRITZ_CALLMONITOR_FRITZBOX_DETECT_TIMEZONE Use the timezone of the Fritz!Box for timestamps (default: false)
+  FRITZ_CALLMONITOR_FRITZBOX_BACKFILL_CALL_LIST Import the Fritz!Box call list on the first start (default: false)
+  FRITZ_CALLMONITOR_FRITZBOX_TIMESTAMP_PIVOT_YEAR First year of the window of two-digit years (default: 0 = sliding)
+  FRITZ_CALLMONITOR_FRITZBOX_STRICT_TIMESTAMPS Reject lines with implausible timestamps to {prefix}/error (default: false)
+  FRITZ_CALLMONITOR_FRITZBOX_MAX_TIMESTAMP_SKEW Tolerated clock difference in strict mode (default: 24h)
+  FRITZ_CALLMONITOR_FRITZBOX_RING_GROUP_WINDOW Group parallel RINGs of one call within this window (default: 2s)
+  FRITZ_CALLMONITOR_FRITZBOX_FORWARD_WINDOW  Link a CALL forwarding a RING within this window (default: 5s)
+  FRITZ_CALLMONITOR_FRITZBOX_FORWARD_EXTENSIONS Extensions of forwarding CALLs presenting the own number (default: none)
   FRITZ_CALLMONITOR_MQTT_BROKER              MQTT broker hostname (default: localhost)
   FRITZ_CALLMONITOR_MQTT_PORT                MQTT broker port (default: 1883)
+  FRITZ_CALLMONITOR_MQTT_BROKERS             Further brokers as host[:port], tried in order (optional)
+  FRITZ_CALLMONITOR_MQTT_BROKER_MODE         failover or mirror to all brokers (default: failover)
   FRITZ_CALLMONITOR_MQTT_USERNAME            MQTT username (optional)
   FRITZ_CALLMONITOR_MQTT_PASSWORD            MQTT password (optional)
+  FRITZ_CALLMONITOR_MQTT_USERNAME_FILE       File with the MQTT username, re-read when rotated (optional)
+  FRITZ_CALLMONITOR_MQTT_PASSWORD_FILE       File with the MQTT password, re-read when rotated (optional)
+  FRITZ_CALLMONITOR_MQTT_CREDENTIALS_CHECK_INTERVAL  Interval for re-reading the credential files (default: 30s, 0 = only on SIGHUP)
+  FRITZ_CALLMONITOR_MQTT_OAUTH_TOKEN_URL     OAuth2 token endpoint, the access token is used as password (optional)
+  FRITZ_CALLMONITOR_MQTT_OAUTH_CLIENT_ID     OAuth2 client ID
+  FRITZ_CALLMONITOR_MQTT_OAUTH_CLIENT_SECRET OAuth2 client secret
+  FRITZ_CALLMONITOR_MQTT_OAUTH_SCOPE         OAuth2 scope (optional)
+  FRITZ_CALLMONITOR_MQTT_OAUTH_AUDIENCE      OAuth2 audience (optional)
+  FRITZ_CALLMONITOR_MQTT_OAUTH_REFRESH_BEFORE  Fetch a new token this long before expiry (default: 5m)
   FRITZ_CALLMONITOR_MQTT_CLIENT_ID           MQTT client ID (default: fritz-callmonitor2mqtt)
+  FRITZ_CALLMONITOR_MQTT_CLIENT_ID_SUFFIX    Append hostname or random to the client ID (optional)
   FRITZ_CALLMONITOR_MQTT_TOPIC_PREFIX        MQTT topic prefix (default: fritz/callmonitor)
   FRITZ_CALLMONITOR_MQTT_QOS                 MQTT QoS level (default: 1)
   FRITZ_CALLMONITOR_MQTT_RETAIN              MQTT retain messages (default: true)
+  FRITZ_CALLMONITOR_MQTT_PUBLISH_TIMEOUT     Max wait for a single MQTT publish (default: 10s)
+  FRITZ_CALLMONITOR_MQTT_PUBLISH_RATE        Max MQTT messages per second (default: 0 = unlimited)
+  FRITZ_CALLMONITOR_MQTT_PUBLISH_BURST       MQTT messages sent at once before the rate applies (default: 20)
+  FRITZ_CALLMONITOR_MQTT_PUBLISH_QUEUE_SIZE  Topics held back while the rate is exceeded (default: 100)
+  FRITZ_CALLMONITOR_MQTT_CALL_TOPIC_TTL      Remove retained call topics after a finished call (default: 0 = keep)
+  FRITZ_CALLMONITOR_MQTT_ELAPSED_INTERVAL    Interval of the elapsed time of talking calls (default: 15s, 0 = disabled)
+  FRITZ_CALLMONITOR_MQTT_CLOUDEVENTS         Wrap event topic payloads in CloudEvents envelopes (default: false)
+  FRITZ_CALLMONITOR_MQTT_PAYLOAD_FORMAT      Payload format: json, msgpack, cloudevents or template:<file> (default: json)
+  FRITZ_CALLMONITOR_MQTT_PAYLOAD_FORMATS     Payload formats of single topics as topic=format (default: none)
+  FRITZ_CALLMONITOR_MQTT_SCHEMA_VERSION      Layout of the payloads, 1 omits schema_version (default: 2)
+  FRITZ_CALLMONITOR_MQTT_ENCRYPTION_KEY      Base64 key encrypting the payloads for untrusted brokers (default: plain)
+  FRITZ_CALLMONITOR_MQTT_ENCRYPTION_KEY_FILE File containing the encryption key (optional)
+  FRITZ_CALLMONITOR_MQTT_METRICS_INTERVAL    Interval of the metrics topic (default: 0 = disabled)
+  FRITZ_CALLMONITOR_MQTT_METRICS             Stats published as metrics (default: all)
+  FRITZ_CALLMONITOR_MQTT_RETAINED_CHECK_INTERVAL Compare the retained topics on the broker with the published ones (default: 0 = disabled)
+  FRITZ_CALLMONITOR_MQTT_RETAINED_REPAIR     Publish retained topics changed by other clients again (default: false)
+  FRITZ_CALLMONITOR_MQTT_ACL_SELF_TEST       Check on connect that the broker delivers messages below the prefix (default: true)
+  FRITZ_CALLMONITOR_MQTT_TENANTS             MSNs published below {prefix}/{tenant} as tenant=msn|msn (default: none)
+  FRITZ_CALLMONITOR_MQTT_TENANT_CREDENTIALS  Broker credentials of tenants as tenant=username:password (default: main credentials)
+  FRITZ_CALLMONITOR_MQTT_CALL_QUERY          Answer queries of the stored calls on {prefix}/query/calls (default: false)
+  FRITZ_CALLMONITOR_MQTT_CALL_QUERY_LIMIT    Upper bound for the calls returned by one query (default: 100)
+  FRITZ_CALLMONITOR_MQTT_PROFILES            Publishing profiles muting event topics as profile=topic|topic (default: none)
+  FRITZ_CALLMONITOR_MQTT_PROFILE_SCHEDULE    Crontab schedules of the profiles as profile=0 22 * * * (default: none)
+  FRITZ_CALLMONITOR_MQTT_MISSED_CALL_ACK_TIMEOUT Escalate missed calls not acknowledged within this time (default: 0 = disabled)
+  FRITZ_CALLMONITOR_MQTT_MISSED_CALL_ACK_RECIPIENT Notification recipient of escalations (default: escalation)
+  FRITZ_CALLMONITOR_MQTT_BOX_NAME            Value of {{.Box}} in topic templates (default: Fritz!Box host)
+  FRITZ_CALLMONITOR_MQTT_TOPIC_<NAME>        Topic template, NAME is one of STATUS, LINE_STATUS,
+                                             LINE_LAST_EVENT, RINGING, VIP_RING, CALL, CALL_COMPLETED, MISSED_CALL, MISSED_CALLS, HISTORY,
+                                             SUMMARY_LAST_CALLER, SUMMARY_LAST_MISSED, SUMMARY_ACTIVE_CALLS,
+                                             FSM_STATUS, FSM_STATUS_CHANGE, DND, DND_COMMAND, MISSED_CALL_ACK,
+                                             RELOAD_COMMAND, CALL_QUERY, CALL_QUERY_RESPONSE, PROFILE, PROFILE_COMMAND, NOTIFICATION, ERROR, UNPARSED, DATABASE_HEALTH, ACL_TEST, INCIDENT, METRICS (see docs/MQTT.md)
+  FRITZ_CALLMONITOR_MQTT_RETAIN_<NAME>       Retain override per topic, NAME as for FRITZ_CALLMONITOR_MQTT_TOPIC_<NAME>
+                                             (default: FRITZ_CALLMONITOR_MQTT_RETAIN, MISSED_CALL: false)
+  FRITZ_CALLMONITOR_MQTT_PUBLISH_<NAME>      Switch a topic off or on, NAME is one of LINE_STATUS, LINE_LAST_EVENT,
+                                             CALL, HISTORY, SUMMARY, FSM (default: true, FSM: only at debug log level)
+  FRITZ_CALLMONITOR_PBX_MSN                  Own MSNs, optionally named, e.g. 990133=Office,990134 (optional)
+  FRITZ_CALLMONITOR_PBX_COUNTRY_CODE         Country code for number normalization (default: 49)
+  FRITZ_CALLMONITOR_PBX_REGION               Region code, e.g. DE/AT/CH (default: derived from country code)
+  FRITZ_CALLMONITOR_PBX_LOCAL_AREA_CODE      Local area code for numbers dialed without it (optional)
+  FRITZ_CALLMONITOR_PBX_NUMBER_FORMAT        Published numbers as e164, national, raw or all (default: e164)
+  FRITZ_CALLMONITOR_PBX_DO_NOT_RECORD        MSNs/extensions whose calls are never logged (optional)
+  FRITZ_CALLMONITOR_PBX_TAM_EXTENSIONS       Extensions of the answering machines (default: 40,41,42,43,44)
+  FRITZ_CALLMONITOR_PBX_EXTENSIONS           Extension names, e.g. 1=Kitchen,**620=Office (optional)
+  FRITZ_CALLMONITOR_PBX_TRUNKS               SIP line names, e.g. SIP0=Vodafone,SIP1=Business line (optional)
+  FRITZ_CALLMONITOR_PBX_TRUNK_ALLOW          Process only calls on these SIP lines (default: all)
+  FRITZ_CALLMONITOR_PBX_TRUNK_DENY           Ignore calls on these SIP lines, e.g. a fax line (optional)
+  FRITZ_CALLMONITOR_PBX_EXTENSION_ALLOW      Process only calls of these MSNs/extensions (default: all)
+  FRITZ_CALLMONITOR_PBX_EXTENSION_DENY       Ignore calls of these MSNs/extensions (optional)
+  FRITZ_CALLMONITOR_PBX_IGNORE_INTERNAL      Ignore internal calls between extensions (default: false)
+  FRITZ_CALLMONITOR_PBX_TAG_RULES            Tag rules, e.g. work:msn=990133;time=08:00-18:00 (optional)
+  FRITZ_CALLMONITOR_PBX_CONTACT_GROUPS       Contact groups for tag rules as number=group list (optional)
+  FRITZ_CALLMONITOR_PBX_VIP_NUMBERS          Callers flagged as priority (optional)
+  FRITZ_CALLMONITOR_PBX_VIP_GROUPS           Contact groups of callers flagged as priority (optional)
+  FRITZ_CALLMONITOR_PBX_REPEAT_CALL_WINDOW   Flag calls of callers who called within this window before (default: 0 = disabled)
+  FRITZ_CALLMONITOR_PBX_SUPPRESS_REPEAT_CALLS Do not ring or notify for repeat calls, except VIPs (default: false)
   FRITZ_CALLMONITOR_APP_LOG_LEVEL            Log level (default: info)
   FRITZ_CALLMONITOR_APP_CALL_HISTORY_SIZE    Call history size (default: 50)
+  FRITZ_CALLMONITOR_APP_RECONNECT_DELAY      First delay between reconnects, doubling per attempt (default: 10s)
+  FRITZ_CALLMONITOR_APP_RECONNECT_MAX_DELAY  Cap of the reconnect delay (default: 5m)
+  FRITZ_CALLMONITOR_APP_RECONNECT_JITTER     Percentage of the reconnect delay that is randomized (default: 20)
+  FRITZ_CALLMONITOR_APP_RECONNECT_MAX_ATTEMPTS Reconnect attempts before giving up (default: 0 = forever)
+  FRITZ_CALLMONITOR_APP_STALL_TIMEOUT        Restart the connections when events wait or publishes fail this long (default: 5m, 0 = disabled)
+  FRITZ_CALLMONITOR_APP_STARTUP_GRACE        Keep /readyz ready and only log errors this long after the start (default: 0 = disabled)
+  FRITZ_CALLMONITOR_APP_STRICT               Stop on inconsistent configuration or call events (default: false)
+  FRITZ_CALLMONITOR_APP_ENRICH_HOOK          Command or URL adding fields to the call events (optional)
+  FRITZ_CALLMONITOR_APP_ENRICH_TIMEOUT       Upper bound for a single run of the enrichment hook (default: 2s)
+  FRITZ_CALLMONITOR_APP_HISTORY_FINISH_STATES Keep only calls ending in these states in the history (default: all)
+  FRITZ_CALLMONITOR_APP_HISTORY_DIRECTIONS   Keep only calls of these directions in the history (default: all)
+  FRITZ_CALLMONITOR_APP_MISSED_CALL_MERGE_WINDOW Merge redials of a missed caller within this time, e.g. 10m (default: 0 = disabled)
+  FRITZ_CALLMONITOR_APP_FINISH_TIMEOUT       How long finish states are shown before idle (default: 1s, 0 = until the next call)
+  FRITZ_CALLMONITOR_APP_LINE_FINISH_TIMEOUTS Finish timeouts of single lines, e.g. 0=0,3=30s (optional)
+  FRITZ_CALLMONITOR_APP_HEALTH_CHECK_PORT    Port for /healthz, /readyz, /metrics, /api/notification-rules and the web UI (default: 8080, 0 = disabled)
+  FRITZ_CALLMONITOR_APP_WEB_UI               Serve the web dashboard on the health check port (default: true)
+  FRITZ_CALLMONITOR_APP_API_TOKEN            Bearer token for changes through the dashboard and rules API (default: localhost only)
+  FRITZ_CALLMONITOR_APP_SHUTDOWN_TIMEOUT     Time to flush queued events on shutdown (default: 10s)
+  FRITZ_CALLMONITOR_APP_CLOUDEVENTS_SOURCE   Source of CloudEvents (default: /fritz-callmonitor2mqtt)
+  FRITZ_CALLMONITOR_DATABASE_DRIVER          Database driver: sqlite or postgres (default: sqlite)
+  FRITZ_CALLMONITOR_DATABASE_DSN             PostgreSQL connection string (required for postgres)
+  FRITZ_CALLMONITOR_DATABASE_DSN_FILE        File containing the PostgreSQL connection string (optional)
   FRITZ_CALLMONITOR_DATABASE_DATA_DIR        Database data directory (default: ./data)
+  FRITZ_CALLMONITOR_DATABASE_REDACT_AFTER_DAYS  Redact stored numbers after N days (default: 0 = disabled)
+  FRITZ_CALLMONITOR_DATABASE_REDACT_DIGITS   Number of trailing digits to redact (default: 3)
+  FRITZ_CALLMONITOR_DATABASE_REDACT_INTERVAL How often the redaction job runs (default: 1h)
+  FRITZ_CALLMONITOR_DATABASE_UNPARSED_DAYS   Delete unparsed callmonitor lines after N days (default: 30, 0 = forever)
+  FRITZ_CALLMONITOR_DATABASE_RETENTION_DAYS  Delete calls after N days (default: 0 = forever)
+  FRITZ_CALLMONITOR_DATABASE_ARCHIVE_FORMAT  Archive calls before deleting them: csv or none (default: csv)
+  FRITZ_CALLMONITOR_DATABASE_ARCHIVE_DIR     Directory of the monthly call archives (default: {data_dir}/archive)
+  FRITZ_CALLMONITOR_DATABASE_QUERY_TIMEOUT   Max duration of a single database operation (default: 30s)
+  FRITZ_CALLMONITOR_DATABASE_QUEUE_SIZE      Call events buffered for asynchronous writes (default: 1000)
+  FRITZ_CALLMONITOR_DATABASE_BATCH_SIZE      Maximum call events per write transaction (default: 50)
+  FRITZ_CALLMONITOR_DATABASE_FLUSH_INTERVAL  Maximum delay before queued events are written (default: 1s)
+  FRITZ_CALLMONITOR_DATABASE_HEALTH_INTERVAL Interval of the database size and health metrics (default: 5m, 0 = disabled)
+  FRITZ_CALLMONITOR_DATABASE_FINISH_STATES   Store only calls ending in these states, e.g. missedCall,finished (default: all)
+  FRITZ_CALLMONITOR_DATABASE_DIRECTIONS      Store only calls of these directions, inbound/outbound (default: all)
+  FRITZ_CALLMONITOR_BACKUP_INTERVAL          How often the SQLite database is backed up (default: 24h)
+  FRITZ_CALLMONITOR_BACKUP_KEEP              Backups kept on the target (default: 7, 0 = all)
+  FRITZ_CALLMONITOR_BACKUP_TIMEOUT           Max duration of a single backup including the upload (default: 5m)
+  FRITZ_CALLMONITOR_BACKUP_S3_ENDPOINT       URL of an S3 compatible storage (default: AWS)
+  FRITZ_CALLMONITOR_BACKUP_S3_REGION         Region of the bucket (default: us-east-1)
+  FRITZ_CALLMONITOR_BACKUP_S3_BUCKET         Back up to this S3 bucket (default: disabled)
+  FRITZ_CALLMONITOR_BACKUP_S3_PREFIX         Prefix of the backup file names, e.g. fritz/ (optional)
+  FRITZ_CALLMONITOR_BACKUP_S3_ACCESS_KEY     S3 access key ID
+  FRITZ_CALLMONITOR_BACKUP_S3_SECRET_KEY     S3 secret access key
+  FRITZ_CALLMONITOR_BACKUP_S3_SECRET_KEY_FILE File containing the S3 secret access key (optional)
+  FRITZ_CALLMONITOR_BACKUP_S3_PATH_STYLE     Address the bucket in the path, as MinIO needs (default: false)
+  FRITZ_CALLMONITOR_BACKUP_WEBDAV_URL        Back up to this WebDAV folder, e.g. of the Fritz!Box NAS (default: disabled)
+  FRITZ_CALLMONITOR_BACKUP_WEBDAV_USERNAME   WebDAV username (optional)
+  FRITZ_CALLMONITOR_BACKUP_WEBDAV_PASSWORD   WebDAV password (optional)
+  FRITZ_CALLMONITOR_BACKUP_WEBDAV_PASSWORD_FILE File containing the WebDAV password (optional)
+  FRITZ_CALLMONITOR_OUTPUT_STDOUT            Write call events as JSON lines to standard output (default: false)
+  FRITZ_CALLMONITOR_OUTPUT_FILE              Append call events as JSON lines to this file (default: disabled)
+  FRITZ_CALLMONITOR_OUTPUT_FILE_MAX_SIZE     Size in MB at which the output file is rotated (default: 10)
+  FRITZ_CALLMONITOR_OUTPUT_FILE_MAX_FILES    Rotated output files kept (default: 5)
+  FRITZ_CALLMONITOR_OUTPUT_WEBHOOK_URL       Post call events as JSON to this URL (default: disabled)
+  FRITZ_CALLMONITOR_OUTPUT_WEBHOOK_TOKEN     Bearer token of the webhook (optional)
+  FRITZ_CALLMONITOR_OUTPUT_WEBHOOK_TIMEOUT   Max duration of a single webhook request (default: 10s)
+  FRITZ_CALLMONITOR_OUTPUT_LOG_URL           Ship call and connection event logs to this Loki push or collector URL (default: disabled)
+  FRITZ_CALLMONITOR_OUTPUT_LOG_FORMAT        Format of the shipped logs, loki or json (default: loki)
+  FRITZ_CALLMONITOR_OUTPUT_LOG_TOKEN         Bearer token of the log collector (optional)
+  FRITZ_CALLMONITOR_OUTPUT_LOG_TENANT        Loki tenant sent as X-Scope-OrgID (optional)
+  FRITZ_CALLMONITOR_OUTPUT_LOG_LABELS        Labels of every log entry as name=value (default: job=fritz-callmonitor2mqtt)
+  FRITZ_CALLMONITOR_OUTPUT_LOG_TIMEOUT       Max duration of a single log shipping request (default: 10s)
+  FRITZ_CALLMONITOR_OUTPUT_AMI_PORT          Serve call events to Asterisk Manager Interface clients on this port (default: 0 = disabled)
+  FRITZ_CALLMONITOR_OUTPUT_AMI_USERNAME      Login of AMI clients (default: any login is accepted)
+  FRITZ_CALLMONITOR_OUTPUT_AMI_SECRET        Secret of the AMI login
+  FRITZ_CALLMONITOR_INFLUX_URL               InfluxDB URL or line protocol write URL (default: disabled)
+  FRITZ_CALLMONITOR_INFLUX_TOKEN             InfluxDB API token (optional)
+  FRITZ_CALLMONITOR_INFLUX_ORG               InfluxDB v2 organization
+  FRITZ_CALLMONITOR_INFLUX_BUCKET            InfluxDB v2 bucket (default: empty = post to the URL as is)
+  FRITZ_CALLMONITOR_INFLUX_MEASUREMENT       Measurement name (default: calls)
+  FRITZ_CALLMONITOR_INFLUX_TIMEOUT           Max duration of a single write (default: 10s)
+  FRITZ_CALLMONITOR_INFLUX_FINISH_STATES     Export only calls ending in these states (default: all)
+  FRITZ_CALLMONITOR_INFLUX_DIRECTIONS        Export only calls of these directions (default: all)
+  FRITZ_CALLMONITOR_CALDAV_URL               CalDAV calendar URL for entries of answered calls (default: disabled)
+  FRITZ_CALLMONITOR_CALDAV_USERNAME          CalDAV username (optional)
+  FRITZ_CALLMONITOR_CALDAV_PASSWORD          CalDAV password (optional)
+  FRITZ_CALLMONITOR_CALDAV_PASSWORD_FILE     File containing the CalDAV password (optional)
+  FRITZ_CALLMONITOR_CALDAV_MIN_DURATION      Minimum talk time for an entry (default: 1m)
+  FRITZ_CALLMONITOR_CALDAV_TIMEOUT           Max duration of creating a single entry (default: 10s)
+  FRITZ_CALLMONITOR_CALDAV_CONTACTS          Names for entry titles as number=name list (optional)
+  FRITZ_CALLMONITOR_REPORT_ENABLED           Create monthly reports of answered calls (default: false)
+  FRITZ_CALLMONITOR_REPORT_DIR               Report directory (default: {data_dir}/reports)
+  FRITZ_CALLMONITOR_REPORT_INTERVAL          How often to check for a finished month (default: 1h)
+  FRITZ_CALLMONITOR_REPORT_CURRENCY          Currency of the estimated costs (default: EUR)
+  FRITZ_CALLMONITOR_REPORT_TARIFFS           Prices per started minute as prefix=price list (optional)
+  FRITZ_CALLMONITOR_REPORT_CONTACTS          Names as number=name list (default: CalDAV contacts)
+  FRITZ_CALLMONITOR_REPORT_SMTP_HOST         Mail server for sending reports (default: not mailed)
+  FRITZ_CALLMONITOR_REPORT_SMTP_PORT         Mail server port (default: 587)
+  FRITZ_CALLMONITOR_REPORT_SMTP_USERNAME     Mail server username (optional)
+  FRITZ_CALLMONITOR_REPORT_SMTP_PASSWORD     Mail server password (optional)
+  FRITZ_CALLMONITOR_REPORT_SMTP_PASSWORD_FILE File containing the mail server password (optional)
+  FRITZ_CALLMONITOR_REPORT_MAIL_FROM         Sender address of report mails
+  FRITZ_CALLMONITOR_REPORT_MAIL_TO           Recipients of report mails (comma-separated)
+  FRITZ_CALLMONITOR_NOTIFY_TRIGGERS          Pushed calls: missed_call, vip, long_call (default: missed_call)
+  FRITZ_CALLMONITOR_NOTIFY_VIPS              VIP numbers as number=name list (optional)
+  FRITZ_CALLMONITOR_NOTIFY_LONG_CALL         Minimum talk time of a long call (default: 30m)
+  FRITZ_CALLMONITOR_NOTIFY_TITLE_TEMPLATE    Go template of the notification title (default: built-in)
+  FRITZ_CALLMONITOR_NOTIFY_MESSAGE_TEMPLATE  Go template of the notification text (default: built-in)
+  FRITZ_CALLMONITOR_NOTIFY_TIMEOUT           Max duration of sending a single notification (default: 10s)
+  FRITZ_CALLMONITOR_NOTIFY_TELEGRAM_TOKEN    Telegram bot token (default: disabled)
+  FRITZ_CALLMONITOR_NOTIFY_TELEGRAM_CHAT_ID  Telegram chat the bot posts to
+  FRITZ_CALLMONITOR_NOTIFY_PUSHOVER_TOKEN    Pushover application token (default: disabled)
+  FRITZ_CALLMONITOR_NOTIFY_PUSHOVER_USER     Pushover user or group key
+  FRITZ_CALLMONITOR_NOTIFY_NTFY_URL          ntfy server URL (default: https://ntfy.sh)
+  FRITZ_CALLMONITOR_NOTIFY_NTFY_TOPIC        ntfy topic (default: disabled)
+  FRITZ_CALLMONITOR_NOTIFY_NTFY_TOKEN        ntfy access token (optional)
 
 MQTT Topics:
+  {prefix}/fritzbox/status         - Connection state of the Fritz!Box callmonitor (retained)
   {prefix}/line/{line_id}/status   - Current status of each phone line (retained)
+  {prefix}/line/{line_id}/elapsed  - Elapsed time of the talking call, every 15s
   {prefix}/history                 - Last 50 calls as JSON array (retained)  
+  {prefix}/missed_call             - Missed call notification with ring count
+  {prefix}/missed_calls            - Last 50 missed calls and today's count (retained)
   {prefix}/events/{call_type}      - Individual call events (incoming/outgoing/connect/end)
+  {prefix}/dnd                     - Call deflection (DND) state, if DND control is enabled (retained)
+  {prefix}/command/dnd             - ON/OFF or {"id": N, "enable": true} to switch call deflections
+  {prefix}/error                   - Callmonitor lines rejected because of implausible timestamps
+  {prefix}/debug/unparsed          - Callmonitor lines that could not be parsed, numbers masked
 
 Examples:
   fritz-callmonitor2mqtt                                    # Run with defaults
   fritz-callmonitor2mqtt -version                           # Show version
   fritz-callmonitor2mqtt -config-test                       # Test configuration
   
+  fritz-callmonitor2mqtt -simulate synthetic -simulate-speed 4  # Test automations without real calls
+  fritz-callmonitor2mqtt -demo -simulate-speed 4                # Also exercise reconnects and unparsed lines
+
   # With custom Fritz!Box
   FRITZ_CALLMONITOR_FRITZBOX_HOST=192.168.1.1 fritz-callmonitor2mqtt
   
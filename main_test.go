@@ -1,8 +1,22 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/config"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/database"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/health"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/seal"
 )
 
 func TestMain(t *testing.T) {
@@ -66,3 +80,126 @@ func BenchmarkExample(b *testing.B) {
 		_ = "example"
 	}
 }
+
+func TestSelftest(t *testing.T) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if err := runSelftest(cfg, 20*time.Second); err != nil {
+		t.Fatalf("Self-test failed: %v", err)
+	}
+}
+
+func TestDecryptPayloads(t *testing.T) {
+	key, err := seal.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	first, _ := seal.Seal(key, []byte(`{"line":1}`))
+	second, _ := seal.Seal(key, []byte(`{"line":2}`))
+
+	var out strings.Builder
+	input := hex.EncodeToString(first) + "\n\n" + hex.EncodeToString(second) + "\n"
+	if err := decryptPayloads(key.String(), false, strings.NewReader(input), &out); err != nil {
+		t.Fatalf("decryptPayloads failed: %v", err)
+	}
+	if out.String() != "{\"line\":1}\n{\"line\":2}\n" {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+
+	out.Reset()
+	if err := decryptPayloads(key.String(), true, bytes.NewReader(first), &out); err != nil {
+		t.Fatalf("decryptPayloads failed for a raw payload: %v", err)
+	}
+	if out.String() != `{"line":1}` {
+		t.Errorf("Unexpected raw output %q", out.String())
+	}
+
+	other, _ := seal.GenerateKey()
+	if err := decryptPayloads(other.String(), false, strings.NewReader(input), io.Discard); !errors.Is(err, seal.ErrInvalid) {
+		t.Errorf("Expected ErrInvalid for another key, got %v", err)
+	}
+}
+
+func TestRunMigration(t *testing.T) {
+	client, err := database.NewClient(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create database client: %v", err)
+	}
+	ctx := context.Background()
+	if err := client.Connect(ctx); err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer func() { _ = client.Close() }()
+	migrator := client.GetMigrator()
+	if err := migrator.LoadEmbeddedMigrations(); err != nil {
+		t.Fatalf("Failed to load migrations: %v", err)
+	}
+
+	var out strings.Builder
+	if err := runMigration(ctx, migrator, "up", migrateOptions{to: 2, dryRun: true}, &out); err != nil {
+		t.Fatalf("up -dry-run failed: %v", err)
+	}
+	if out.String() != "Would apply migration 1 initial_schema\nWould apply migration 2 add_msn_fields\n" {
+		t.Errorf("Unexpected dry run output %q", out.String())
+	}
+	if version, _ := migrator.GetCurrentVersion(ctx); version != 0 {
+		t.Errorf("Expected the dry run not to apply migrations, got version %d", version)
+	}
+
+	steps := []struct {
+		action string
+		opts   migrateOptions
+		want   string
+	}{
+		{"up", migrateOptions{to: -1}, "Applied migration 11 add_call_forwarding"},
+		{"down", migrateOptions{to: -1, dryRun: true}, "Would revert migration 11 add_call_forwarding\n"},
+		{"down", migrateOptions{to: 8}, "Reverted migration 11 add_call_forwarding\nReverted migration 10 normalize_timestamps\nReverted migration 9 add_call_transitions\n"},
+		{"redo", migrateOptions{to: -1}, "Reverted and applied again migration 8 add_stats_indexes\n"},
+		{"status", migrateOptions{to: -1}, "Schema version 8, 3 pending"},
+		{"up", migrateOptions{to: -1}, "Applied migration 9 add_call_transitions\nApplied migration 10 normalize_timestamps\nApplied migration 11 add_call_forwarding\n"},
+		{"up", migrateOptions{to: -1}, "No migrations to run\n"},
+	}
+	for _, step := range steps {
+		out.Reset()
+		if err := runMigration(ctx, migrator, step.action, step.opts, &out); err != nil {
+			t.Fatalf("%s failed: %v", step.action, err)
+		}
+		if !strings.Contains(out.String(), step.want) {
+			t.Errorf("Expected %s to report %q, got %q", step.action, step.want, out.String())
+		}
+	}
+}
+
+func TestProbeHealth(t *testing.T) {
+	server := health.NewServer(0)
+	var connected atomic.Bool
+	server.AddReadinessCheck("callmonitor", func(ctx context.Context) error {
+		if !connected.Load() {
+			return errors.New("not connected to fritz.box:1012")
+		}
+		return nil
+	})
+	httpServer := httptest.NewServer(server.Handler())
+	defer httpServer.Close()
+
+	_, err := probeHealth(context.Background(), httpServer.URL+"/readyz")
+	if err == nil || !strings.Contains(err.Error(), "callmonitor: not connected to fritz.box:1012") {
+		t.Errorf("Expected the failed callmonitor check, got %v", err)
+	}
+	if _, err := probeHealth(context.Background(), httpServer.URL+"/healthz"); err != nil {
+		t.Errorf("Expected liveness without liveness checks, got %v", err)
+	}
+
+	connected.Store(true)
+	if response, err := probeHealth(context.Background(), httpServer.URL+"/readyz"); err != nil || response.Status != "ok" {
+		t.Errorf("Expected ready, got %+v, %v", response, err)
+	}
+
+	httpServer.Close()
+	if _, err := probeHealth(context.Background(), httpServer.URL+"/readyz"); err == nil {
+		t.Error("Expected an error for an unreachable endpoint")
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/config"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/database"
+)
+
+// migrateActions are the actions of the migrate subcommand
+var migrateActions = []string{"status", "up", "down", "redo"}
+
+// migrateOptions are the flags of the migrate subcommand
+type migrateOptions struct {
+	to     int
+	dryRun bool
+}
+
+// runMigrate implements the migrate subcommand, which shows the schema
+// migrations of the configured database, applies or reverts them, and returns
+// the exit code. With -dry-run it only shows what would be done.
+func runMigrate(args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	var opts migrateOptions
+	flags.IntVar(&opts.to, "to", -1, "Target version: up applies the migrations up to it, down reverts the ones above it (default: up all, down the latest)")
+	flags.BoolVar(&opts.dryRun, "dry-run", false, "Only show the migrations that would be applied or reverted")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: fritz-callmonitor2mqtt migrate %s [flags]\n\n", strings.Join(migrateActions, "|"))
+		fmt.Fprintf(flags.Output(), "Shows, applies or reverts the schema migrations of the configured database; the bridge applies pending ones on startup.\n")
+		fmt.Fprintf(flags.Output(), "Reverting drops the tables and columns of a migration together with their data, stop the bridge first.\n")
+		fmt.Fprintf(flags.Output(), "redo reverts the latest migration and applies it again.\n\nFlags:\n")
+		flags.PrintDefaults()
+	}
+	if len(args) > 0 && (args[0] == "-help" || args[0] == "-h") {
+		flags.Usage()
+		return 0
+	}
+	if len(args) == 0 || !slices.Contains(migrateActions, args[0]) {
+		flags.Usage()
+		return 2
+	}
+	action := args[0]
+	if err := flags.Parse(args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+	if opts.to != -1 && action != "up" && action != "down" {
+		fmt.Fprintf(os.Stderr, "migrate %s does not take -to\n", action)
+		return 2
+	}
+	if opts.to < -1 {
+		fmt.Fprintf(os.Stderr, "migrate %s: invalid target version %d\n", action, opts.to)
+		return 2
+	}
+
+	if err := migrate(action, opts); err != nil {
+		fmt.Fprintf(os.Stderr, "migrate %s failed: %v\n", action, err)
+		return 1
+	}
+	return 0
+}
+
+// migrate runs the action against the configured database
+func migrate(action string, opts migrateOptions) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	dbClient, err := newDatabaseClient(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to create database client: %w", err)
+	}
+	ctx := context.Background()
+	if err := dbClient.Connect(ctx); err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer func() { _ = dbClient.Close() }()
+	migrator := dbClient.GetMigrator()
+	if err := migrator.LoadEmbeddedMigrations(); err != nil {
+		return fmt.Errorf("failed to load embedded migrations: %w", err)
+	}
+
+	return runMigration(ctx, migrator, action, opts, os.Stdout)
+}
+
+// runMigration runs the action with the migrator and writes the result to w
+func runMigration(ctx context.Context, migrator *database.Migrator, action string, opts migrateOptions, w io.Writer) error {
+	switch action {
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		printMigrationStatus(w, statuses)
+		return nil
+
+	case "up":
+		target := max(opts.to, 0)
+		if opts.dryRun {
+			pending, err := migrator.UpPlan(ctx, target)
+			if err != nil {
+				return err
+			}
+			printMigrations(w, "Would apply", pending)
+			return nil
+		}
+		applied, err := migrator.Up(ctx, target)
+		if err != nil {
+			return err
+		}
+		printMigrations(w, "Applied", applied)
+		return nil
+
+	case "down":
+		target := opts.to
+		if target == -1 {
+			current, err := currentVersion(ctx, migrator)
+			if err != nil {
+				return err
+			}
+			target = max(current-1, 0)
+		}
+		if opts.dryRun {
+			revert, err := migrator.DownPlan(ctx, target)
+			if err != nil {
+				return err
+			}
+			printMigrations(w, "Would revert", revert)
+			return nil
+		}
+		reverted, err := migrator.Down(ctx, target)
+		if err != nil {
+			return err
+		}
+		printMigrations(w, "Reverted", reverted)
+		return nil
+
+	case "redo":
+		if opts.dryRun {
+			latest, err := migrator.RedoPlan(ctx)
+			if err != nil {
+				return err
+			}
+			printMigrations(w, "Would revert and apply again", []database.Migration{latest})
+			return nil
+		}
+		redone, err := migrator.Redo(ctx)
+		if err != nil {
+			return err
+		}
+		printMigrations(w, "Reverted and applied again", []database.Migration{redone})
+		return nil
+	}
+	return fmt.Errorf("unknown action %q", action)
+}
+
+// currentVersion returns the schema version, creating the migration table of an empty database
+func currentVersion(ctx context.Context, migrator *database.Migrator) (int, error) {
+	if err := migrator.InitSchema(ctx); err != nil {
+		return 0, err
+	}
+	return migrator.GetCurrentVersion(ctx)
+}
+
+// printMigrations writes one line per migration, or that there was nothing to do
+func printMigrations(w io.Writer, done string, migrations []database.Migration) {
+	if len(migrations) == 0 {
+		fmt.Fprintln(w, "No migrations to run")
+		return
+	}
+	for _, migration := range migrations {
+		fmt.Fprintf(w, "%s migration %d %s\n", done, migration.Version, migration.Name)
+	}
+}
+
+// printMigrationStatus writes a table of the migrations and the schema version
+func printMigrationStatus(w io.Writer, statuses []database.MigrationStatus) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+	var version, pending int
+	for _, status := range statuses {
+		state := "pending"
+		switch {
+		case status.Unknown:
+			state = "applied, unknown"
+		case status.Applied:
+			state = "applied"
+		default:
+			pending++
+		}
+		if status.Applied {
+			version = status.Version
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", status.Version, status.Name, state, status.AppliedAt)
+	}
+	_ = tw.Flush()
+	fmt.Fprintf(w, "\nSchema version %d, %d pending\n", version, pending)
+}
@@ -20,5 +20,6 @@ CREATE INDEX IF NOT EXISTS idx_calls_called_msn ON calls(called_msn);
 DROP INDEX IF EXISTS idx_calls_called_msn;
 DROP INDEX IF EXISTS idx_calls_caller_msn;
 
--- Note: SQLite doesn't support DROP COLUMN, so we can't easily remove the columns
--- In a real rollback scenario, you'd need to recreate the table without these columns
+-- Remove columns, supported since SQLite 3.35
+ALTER TABLE calls DROP COLUMN called_msn;
+ALTER TABLE calls DROP COLUMN caller_msn;
@@ -0,0 +1,19 @@
+-- Description: Add redaction marker to calls table
+-- Add redacted_at column to track which call records had their phone numbers redacted
+-- Redaction keeps the rows (and therefore all aggregates) but masks the last digits
+
+-- +migrate Up
+
+-- Add redacted_at column to calls table
+ALTER TABLE calls ADD COLUMN redacted_at DATETIME;
+
+-- Index for faster lookups of rows that still need redaction
+CREATE INDEX IF NOT EXISTS idx_calls_redacted_at ON calls(redacted_at);
+
+-- +migrate Down
+
+-- Remove index
+DROP INDEX IF EXISTS idx_calls_redacted_at;
+
+-- Remove column, supported since SQLite 3.35
+ALTER TABLE calls DROP COLUMN redacted_at;
@@ -0,0 +1,25 @@
+-- Description: Add notification rules table
+-- Notification rules decide who gets notified about which finished calls and when
+-- They are maintained through the REST API, so they live in the database instead of the environment
+
+-- +migrate Up
+
+-- Table for storing notification rules
+CREATE TABLE IF NOT EXISTS notification_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    recipient TEXT NOT NULL,
+    msn TEXT, -- NULL matches all MSNs
+    directions TEXT, -- Comma separated, NULL matches all directions
+    finish_states TEXT, -- Comma separated, NULL matches all finish states
+    days TEXT, -- Comma separated weekdays (mon..sun), NULL matches every day
+    start_time TEXT, -- HH:MM, NULL together with end_time matches the whole day
+    end_time TEXT,
+    enabled INTEGER NOT NULL DEFAULT 1,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +migrate Down
+
+DROP TABLE IF EXISTS notification_rules;
@@ -0,0 +1,18 @@
+-- Description: Add unparsed lines table
+-- Callmonitor lines that could not be parsed are kept with their numbers masked, so new formats can be reported
+-- Lines older than the configured retention are deleted
+
+-- +migrate Up
+
+-- Table for storing unparsable callmonitor lines
+CREATE TABLE IF NOT EXISTS unparsed_lines (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    line TEXT NOT NULL,
+    reason TEXT,
+    received_at DATETIME NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +migrate Down
+
+DROP TABLE IF EXISTS unparsed_lines;
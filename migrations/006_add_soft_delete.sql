@@ -0,0 +1,19 @@
+-- Description: Add soft delete to calls table
+-- Add deleted_at column, so calls deleted through the API can be restored
+-- Deleted calls are excluded from queries and statistics
+
+-- +migrate Up
+
+-- Add deleted_at column to calls table
+ALTER TABLE calls ADD COLUMN deleted_at DATETIME;
+
+-- Index for excluding deleted calls
+CREATE INDEX IF NOT EXISTS idx_calls_deleted_at ON calls(deleted_at);
+
+-- +migrate Down
+
+-- Remove index
+DROP INDEX IF EXISTS idx_calls_deleted_at;
+
+-- Remove column, supported since SQLite 3.35
+ALTER TABLE calls DROP COLUMN deleted_at;
@@ -0,0 +1,17 @@
+-- Description: Add call FSM transitions
+-- Every event row stores the FSM transition it caused and its reason
+-- Rows stored before have no transition
+
+-- +migrate Up
+
+-- Add FSM transition columns to calls table
+ALTER TABLE calls ADD COLUMN status_from TEXT;
+ALTER TABLE calls ADD COLUMN status_to TEXT;
+ALTER TABLE calls ADD COLUMN transition_reason TEXT;
+
+-- +migrate Down
+
+-- Remove FSM transition columns, supported since SQLite 3.35
+ALTER TABLE calls DROP COLUMN transition_reason;
+ALTER TABLE calls DROP COLUMN status_to;
+ALTER TABLE calls DROP COLUMN status_from;
@@ -0,0 +1,17 @@
+-- Description: Normalize stored timestamps
+-- Timestamps were stored in the Go time format, e.g. "2025-09-21 07:15:00 +0000 UTC"
+-- They are rewritten to UTC text the SQLite date functions understand
+
+-- +migrate Up
+
+-- Timestamps were bound in UTC but stored as "2025-09-21 07:15:00 +0000 UTC"
+UPDATE calls SET timestamp = substr(timestamp, 1, length(timestamp) - 10) || '+00:00'
+WHERE timestamp LIKE '% +0000 UTC';
+UPDATE calls SET deleted_at = substr(deleted_at, 1, length(deleted_at) - 10) || '+00:00'
+WHERE deleted_at LIKE '% +0000 UTC';
+UPDATE unparsed_lines SET received_at = substr(received_at, 1, length(received_at) - 10) || '+00:00'
+WHERE received_at LIKE '% +0000 UTC';
+
+-- +migrate Down
+
+-- Note: the normalized timestamps are read the same way, nothing to undo
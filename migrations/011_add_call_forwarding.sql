@@ -0,0 +1,21 @@
+-- Description: Add call forwarding
+-- Calls the Fritz!Box forwards show up as an inbound and an outbound call
+-- The outbound leg is flagged as forwarded and links the inbound call as its parent
+
+-- +migrate Up
+
+-- Add call forwarding columns to calls table
+ALTER TABLE calls ADD COLUMN forwarded INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE calls ADD COLUMN parent_call_id TEXT;
+
+-- Index for finding the outbound legs of a forwarded call
+CREATE INDEX IF NOT EXISTS idx_calls_parent_call_id ON calls(parent_call_id);
+
+-- +migrate Down
+
+-- Remove index
+DROP INDEX IF EXISTS idx_calls_parent_call_id;
+
+-- Remove columns, supported since SQLite 3.35
+ALTER TABLE calls DROP COLUMN parent_call_id;
+ALTER TABLE calls DROP COLUMN forwarded;
@@ -0,0 +1,16 @@
+-- Description: Add redaction marker to calls table
+-- Add redacted_at column to track which call records had their phone numbers redacted
+-- Redaction keeps the rows (and therefore all aggregates) but masks the last digits
+
+-- +migrate Up
+
+-- Add redacted_at column to calls table
+ALTER TABLE calls ADD COLUMN IF NOT EXISTS redacted_at TIMESTAMPTZ;
+
+-- Index for faster lookups of rows that still need redaction
+CREATE INDEX IF NOT EXISTS idx_calls_redacted_at ON calls(redacted_at);
+
+-- +migrate Down
+
+DROP INDEX IF EXISTS idx_calls_redacted_at;
+ALTER TABLE calls DROP COLUMN IF EXISTS redacted_at;
@@ -0,0 +1,18 @@
+-- Description: Add unparsed lines table
+-- Callmonitor lines that could not be parsed are kept with their numbers masked, so new formats can be reported
+-- Lines older than the configured retention are deleted
+
+-- +migrate Up
+
+-- Table for storing unparsable callmonitor lines
+CREATE TABLE IF NOT EXISTS unparsed_lines (
+    id BIGSERIAL PRIMARY KEY,
+    line TEXT NOT NULL,
+    reason TEXT,
+    received_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +migrate Down
+
+DROP TABLE IF EXISTS unparsed_lines;
@@ -0,0 +1,16 @@
+-- Description: Add soft delete to calls table
+-- Add deleted_at column, so calls deleted through the API can be restored
+-- Deleted calls are excluded from queries and statistics
+
+-- +migrate Up
+
+-- Add deleted_at column to calls table
+ALTER TABLE calls ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+-- Index for excluding deleted calls
+CREATE INDEX IF NOT EXISTS idx_calls_deleted_at ON calls(deleted_at);
+
+-- +migrate Down
+
+DROP INDEX IF EXISTS idx_calls_deleted_at;
+ALTER TABLE calls DROP COLUMN IF EXISTS deleted_at;
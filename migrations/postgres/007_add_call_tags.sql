@@ -0,0 +1,21 @@
+-- Description: Add call tags table
+-- Calls can be tagged, e.g. through the bulk API, and selected by tag
+-- A tag is stored once per call
+
+-- +migrate Up
+
+-- Table for storing tags of calls
+CREATE TABLE IF NOT EXISTS call_tags (
+    id BIGSERIAL PRIMARY KEY,
+    call_id TEXT NOT NULL,
+    tag TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (call_id, tag)
+);
+
+-- Index for selecting calls by tag
+CREATE INDEX IF NOT EXISTS idx_call_tags_tag ON call_tags(tag);
+
+-- +migrate Down
+
+DROP TABLE IF EXISTS call_tags;
@@ -0,0 +1,16 @@
+-- Description: Add indexes for the line statistics
+-- The statistics select the start rows of a period and join their disconnect rows
+-- Both are aggregated in SQL instead of scanning all rows
+
+-- +migrate Up
+
+-- Index for selecting the start rows of a period
+CREATE INDEX IF NOT EXISTS idx_calls_event_type_timestamp ON calls(event_type, timestamp);
+
+-- Index for joining the disconnect row of a call
+CREATE INDEX IF NOT EXISTS idx_calls_call_id_event_type ON calls(call_id, event_type);
+
+-- +migrate Down
+
+DROP INDEX IF EXISTS idx_calls_call_id_event_type;
+DROP INDEX IF EXISTS idx_calls_event_type_timestamp;
@@ -0,0 +1,16 @@
+-- Description: Add call FSM transitions
+-- Every event row stores the FSM transition it caused and its reason
+-- Rows stored before have no transition
+
+-- +migrate Up
+
+-- Add FSM transition columns to calls table
+ALTER TABLE calls ADD COLUMN IF NOT EXISTS status_from TEXT;
+ALTER TABLE calls ADD COLUMN IF NOT EXISTS status_to TEXT;
+ALTER TABLE calls ADD COLUMN IF NOT EXISTS transition_reason TEXT;
+
+-- +migrate Down
+
+ALTER TABLE calls DROP COLUMN IF EXISTS transition_reason;
+ALTER TABLE calls DROP COLUMN IF EXISTS status_to;
+ALTER TABLE calls DROP COLUMN IF EXISTS status_from;
@@ -0,0 +1,12 @@
+-- Description: Normalize stored timestamps
+-- TIMESTAMPTZ columns are stored in UTC already
+-- The version keeps the SQLite and PostgreSQL schemas in step
+
+-- +migrate Up
+
+-- Nothing to rewrite, the version keeps both schemas in step
+SELECT 1;
+
+-- +migrate Down
+
+SELECT 1;
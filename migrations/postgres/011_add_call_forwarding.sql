@@ -0,0 +1,18 @@
+-- Description: Add call forwarding
+-- Calls the Fritz!Box forwards show up as an inbound and an outbound call
+-- The outbound leg is flagged as forwarded and links the inbound call as its parent
+
+-- +migrate Up
+
+-- Add call forwarding columns to calls table
+ALTER TABLE calls ADD COLUMN IF NOT EXISTS forwarded BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE calls ADD COLUMN IF NOT EXISTS parent_call_id TEXT;
+
+-- Index for finding the outbound legs of a forwarded call
+CREATE INDEX IF NOT EXISTS idx_calls_parent_call_id ON calls(parent_call_id);
+
+-- +migrate Down
+
+DROP INDEX IF EXISTS idx_calls_parent_call_id;
+ALTER TABLE calls DROP COLUMN IF EXISTS parent_call_id;
+ALTER TABLE calls DROP COLUMN IF EXISTS forwarded;
@@ -0,0 +1,87 @@
+package backoff
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// Policy describes the delays between attempts
+type Policy struct {
+	Initial     time.Duration // Delay before the first retry
+	Max         time.Duration // Cap of the delay before jitter is applied
+	Multiplier  float64       // Growth of the delay per attempt (default: 2)
+	Jitter      float64       // Fraction of the delay that is randomized, from 0 to 1
+	MaxAttempts int           // Retries before giving up, 0 retries forever
+}
+
+// DefaultPolicy returns the policy used when nothing else is configured
+func DefaultPolicy() Policy {
+	return Policy{
+		Initial:    time.Second,
+		Max:        2 * time.Minute,
+		Multiplier: 2,
+		Jitter:     0.2,
+	}
+}
+
+// Validate checks that the policy describes sensible delays
+func (p Policy) Validate() error {
+	if p.Initial <= 0 {
+		return fmt.Errorf("initial delay must be greater than 0")
+	}
+	if p.Max < p.Initial {
+		return fmt.Errorf("maximum delay %v must not be less than the initial delay %v", p.Max, p.Initial)
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("jitter must be between 0 and 1, got %v", p.Jitter)
+	}
+	if p.MaxAttempts < 0 {
+		return fmt.Errorf("maximum attempts must not be negative")
+	}
+	return nil
+}
+
+// Backoff hands out the delays of consecutive attempts. It is not safe for
+// concurrent use; every reconnect loop has its own.
+type Backoff struct {
+	policy   Policy
+	attempts int
+	random   func() float64 // Returns values in [0, 1)
+}
+
+// New creates a backoff at its first attempt. A zero Multiplier doubles the delay.
+func New(policy Policy) *Backoff {
+	if policy.Multiplier < 1 {
+		policy.Multiplier = 2
+	}
+	return &Backoff{policy: policy, random: rand.Float64}
+}
+
+// Next returns the delay before the next attempt. It reports false once the
+// maximum number of attempts is used up.
+func (b *Backoff) Next() (time.Duration, bool) {
+	if b.policy.MaxAttempts > 0 && b.attempts >= b.policy.MaxAttempts {
+		return 0, false
+	}
+	delay := float64(b.policy.Initial) * math.Pow(b.policy.Multiplier, float64(b.attempts))
+	if b.policy.Max > 0 {
+		delay = math.Min(delay, float64(b.policy.Max))
+	}
+	b.attempts++
+
+	// The jitter only shortens the delay, so Max stays an upper bound
+	delay -= delay * b.policy.Jitter * b.random()
+	return time.Duration(delay), true
+}
+
+// Reset starts over with the initial delay, e.g. after a successful connect
+func (b *Backoff) Reset() {
+	b.attempts = 0
+}
+
+// Attempts returns the number of delays handed out since the last reset
+func (b *Backoff) Attempts() int {
+	return b.attempts
+}
@@ -0,0 +1,61 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	b := New(Policy{Initial: time.Second, Max: 5 * time.Second, MaxAttempts: 5})
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, want := range expected {
+		delay, ok := b.Next()
+		if !ok || delay != want {
+			t.Errorf("Attempt %d: expected %v, got %v (ok=%v)", i+1, want, delay, ok)
+		}
+	}
+	if _, ok := b.Next(); ok {
+		t.Error("Expected to give up after 5 attempts")
+	}
+	if b.Attempts() != 5 {
+		t.Errorf("Expected 5 attempts, got %d", b.Attempts())
+	}
+
+	b.Reset()
+	if delay, ok := b.Next(); !ok || delay != time.Second {
+		t.Errorf("Expected the initial delay after a reset, got %v (ok=%v)", delay, ok)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	b := New(Policy{Initial: 10 * time.Second, Max: time.Minute, Multiplier: 3, Jitter: 0.5})
+
+	b.random = func() float64 { return 0.5 }
+	if delay, _ := b.Next(); delay != 7500*time.Millisecond {
+		t.Errorf("Expected 10s shortened by a quarter, got %v", delay)
+	}
+	b.random = func() float64 { return 0.999999 }
+	if delay, _ := b.Next(); delay <= 15*time.Second || delay > 30*time.Second {
+		t.Errorf("Expected at most 30s and more than half of it, got %v", delay)
+	}
+	b.random = func() float64 { return 0 }
+	if delay, _ := b.Next(); delay != time.Minute {
+		t.Errorf("Expected the cap of 1m, got %v", delay)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := DefaultPolicy().Validate(); err != nil {
+		t.Errorf("Expected the default policy to be valid, got %v", err)
+	}
+	for _, p := range []Policy{
+		{Max: time.Second},
+		{Initial: time.Minute, Max: time.Second},
+		{Initial: time.Second, Max: time.Second, Jitter: 1.5},
+		{Initial: time.Second, Max: time.Second, MaxAttempts: -1},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", p)
+		}
+	}
+}
@@ -0,0 +1,14 @@
+// Package backoff computes the delays between reconnect attempts: they grow
+// exponentially up to a cap, are randomized by a jitter so that many clients
+// losing the same server do not reconnect in lockstep, and can be limited to
+// a number of attempts:
+//
+//	b := backoff.New(backoff.DefaultPolicy())
+//	for connect() != nil {
+//		delay, ok := b.Next()
+//		if !ok {
+//			return errGaveUp
+//		}
+//		time.Sleep(delay)
+//	}
+package backoff
@@ -0,0 +1,97 @@
+package callmonitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCallWaitingOnSameLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages []string
+		calls    []int // Index of the call (in order of RING/CALL) each message belongs to
+	}{
+		{
+			name: "waiting call rejected",
+			messages: []string{
+				"09.09.25 15:30:00;RING;0;+49123456789;+496181990133;SIP0",
+				"09.09.25 15:30:05;CONNECT;0;1;+49123456789",
+				"09.09.25 15:30:40;RING;0;+49987654321;+496181990133;SIP0",
+				"09.09.25 15:30:50;DISCONNECT;0;0",
+				"09.09.25 15:31:05;DISCONNECT;0;60",
+			},
+			calls: []int{0, 0, 1, 1, 0},
+		},
+		{
+			name: "waiting call answered after first call ended",
+			messages: []string{
+				"09.09.25 15:30:00;RING;0;+49123456789;+496181990133;SIP0",
+				"09.09.25 15:30:05;CONNECT;0;1;+49123456789",
+				"09.09.25 15:30:40;RING;0;+49987654321;+496181990133;SIP0",
+				"09.09.25 15:30:45;DISCONNECT;0;40",
+				"09.09.25 15:30:47;CONNECT;0;1;+49987654321",
+				"09.09.25 15:31:47;DISCONNECT;0;60",
+			},
+			calls: []int{0, 0, 1, 0, 1, 1},
+		},
+		{
+			name: "both calls connected, first one ends last",
+			messages: []string{
+				"09.09.25 15:30:00;RING;0;+49123456789;+496181990133;SIP0",
+				"09.09.25 15:30:05;CONNECT;0;1;+49123456789",
+				"09.09.25 15:30:40;RING;0;+49987654321;+496181990133;SIP0",
+				"09.09.25 15:30:45;CONNECT;0;1;+49987654321",
+				"09.09.25 15:31:05;DISCONNECT;0;20",
+				"09.09.25 15:32:05;DISCONNECT;0;120",
+			},
+			calls: []int{0, 0, 1, 1, 1, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "6181", Timezone: time.UTC})
+
+			var ids, callers []string
+			for i, message := range tt.messages {
+				event, err := client.parseEvent(message)
+				if err != nil {
+					t.Fatalf("Failed to parse %q: %v", message, err)
+				}
+				if tt.calls[i] == len(ids) {
+					ids = append(ids, event.ID)
+					callers = append(callers, event.Caller)
+					continue
+				}
+				if event.ID != ids[tt.calls[i]] || event.Caller != callers[tt.calls[i]] {
+					t.Errorf("%s: expected call %d (%s from %s), got %s from %s", message, tt.calls[i], ids[tt.calls[i]], callers[tt.calls[i]], event.ID, event.Caller)
+				}
+			}
+
+			if ids[0] == ids[1] {
+				t.Error("Expected parallel calls to get separate call IDs")
+			}
+			if client.calls.count() != 0 {
+				t.Errorf("Expected no active calls after all DISCONNECTs, got %d", client.calls.count())
+			}
+		})
+	}
+}
+
+func TestStaleCallsAreDropped(t *testing.T) {
+	client := newTestClient(t, Options{Host: "test.host", Timezone: time.UTC})
+
+	// The DISCONNECT of the first call was never received
+	for _, message := range []string{
+		"09.09.25 15:30:00;RING;0;+49123456789;+496181990133;SIP0",
+		"10.09.25 15:30:00;RING;0;+49987654321;+496181990133;SIP0",
+	} {
+		if _, err := client.parseEvent(message); err != nil {
+			t.Fatalf("Failed to parse %q: %v", message, err)
+		}
+	}
+
+	if client.calls.count() != 1 {
+		t.Errorf("Expected the stale call to be dropped, got %d active calls", client.calls.count())
+	}
+}
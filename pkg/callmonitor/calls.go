@@ -0,0 +1,203 @@
+package callmonitor
+
+import (
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// staleCallTimeout bounds how long a call without DISCONNECT is tracked
+const staleCallTimeout = 24 * time.Hour
+
+// durationTolerance is the difference between the reported and the measured
+// duration of a call up to which both are considered equal. The Fritz!Box
+// reports whole seconds and lines arrive with some delay.
+const durationTolerance = 2 * time.Second
+
+// activeCall is the state of a call between RING/CALL and DISCONNECT
+type activeCall struct {
+	id          string // UUID v7 for tracking the call across states
+	line        int    // Connection ID of the RING or CALL
+	started     time.Time
+	trunk       string
+	direction   types.CallDirection
+	caller      string
+	called      string
+	callerRaw   string // Caller as received, before normalization
+	calledRaw   string
+	noRecord    bool       // Call involves an opted-out MSN/extension
+	filtered    bool       // Call is dropped by the extension filter or as an internal call
+	tam         bool       // Call was answered by an answering machine
+	connectedAt time.Time  // Zero until CONNECT
+	connectedOn time.Time  // Local clock at CONNECT, with a monotonic reading for real clocks
+	group       *ringGroup // Set if the call rang on several connection IDs
+	tags        []string   // Tags attached at RING or CALL
+	priority    bool       // Inbound call of a VIP
+	repeats     int        // Attempts of the caller in a row, more than 1 for a repeat call
+	internal    bool       // Call between extensions
+	numberType  types.NumberType
+	parentID    string // Inbound call an outbound call forwards
+	forwardedTo string // Number an inbound call was forwarded to
+}
+
+// ringGroup is one inbound call the Fritz!Box signals with a RING per
+// connection ID, e.g. when several devices ring in parallel. Its events are
+// delivered on the line of the first RING.
+type ringGroup struct {
+	line      int    // Connection ID of the first RING
+	lines     []int  // Connection IDs of all RINGs, in order of arrival
+	active    int    // Number of lines not disconnected yet
+	extension string // Extension that answered the call
+	duration  int    // Longest duration reported by a DISCONNECT
+	measured  int    // Longest duration measured for a DISCONNECT
+}
+
+// callTracker keeps the active calls per connection ID. The Fritz!Box usually
+// assigns a free connection ID to each concurrent call, but with call waiting
+// a second call may arrive on an ID whose call is still running, so every ID
+// holds a list of calls, oldest first.
+type callTracker struct {
+	calls map[int][]*activeCall
+}
+
+// newCallTracker creates an empty tracker
+func newCallTracker() *callTracker {
+	return &callTracker{calls: make(map[int][]*activeCall)}
+}
+
+// start adds a new call on the connection ID, forgetting calls whose DISCONNECT never arrived
+func (t *callTracker) start(line int, call *activeCall) {
+	calls := t.calls[line][:0]
+	for _, c := range t.calls[line] {
+		if call.started.Sub(c.started) < staleCallTimeout {
+			calls = append(calls, c)
+		}
+	}
+	t.calls[line] = append(calls, call)
+}
+
+// connect returns the call a CONNECT belongs to: the newest call on the
+// connection ID that is not connected yet, i.e. the waiting call being
+// answered. Without such a call, the newest call is used.
+func (t *callTracker) connect(line int) *activeCall {
+	calls := t.calls[line]
+	for i := len(calls) - 1; i >= 0; i-- {
+		if calls[i].connectedAt.IsZero() {
+			return calls[i]
+		}
+	}
+	if len(calls) > 0 {
+		return calls[len(calls)-1]
+	}
+	return nil
+}
+
+// disconnect removes and returns the call a DISCONNECT belongs to. A call
+// without talk time was never connected, so the newest unconnected call is
+// ended. Otherwise the connected call whose talk time matches the reported
+// duration best is ended.
+func (t *callTracker) disconnect(line int, at time.Time, duration int) *activeCall {
+	calls := t.calls[line]
+	if len(calls) == 0 {
+		return nil
+	}
+
+	index := -1
+	if duration == 0 {
+		for i := len(calls) - 1; i >= 0; i-- {
+			if calls[i].connectedAt.IsZero() {
+				index = i
+				break
+			}
+		}
+	} else {
+		var best time.Duration
+		for i, c := range calls {
+			if c.connectedAt.IsZero() {
+				continue
+			}
+			diff := at.Sub(c.connectedAt) - time.Duration(duration)*time.Second
+			if diff < 0 {
+				diff = -diff
+			}
+			if index < 0 || diff < best {
+				index, best = i, diff
+			}
+		}
+	}
+	if index < 0 {
+		// No call fits, end the oldest one
+		index = 0
+	}
+
+	call := calls[index]
+	calls = append(calls[:index], calls[index+1:]...)
+	if len(calls) == 0 {
+		delete(t.calls, line)
+	} else {
+		t.calls[line] = calls
+	}
+	return call
+}
+
+// ringing returns an unconnected inbound call of the same caller, called
+// number and trunk on another connection ID that started at most window
+// before the given time, or nil
+func (t *callTracker) ringing(line int, caller, called, trunk string, at time.Time, window time.Duration) *activeCall {
+	for l, calls := range t.calls {
+		if l == line {
+			continue
+		}
+		for _, c := range calls {
+			if c.direction == types.CallDirectionInbound && c.connectedAt.IsZero() &&
+				c.caller == caller && c.called == called && c.trunk == trunk &&
+				at.Sub(c.started) >= 0 && at.Sub(c.started) <= window {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+// forwarding returns the newest unconnected inbound call on another
+// connection ID that was called from the number, or with fromCalled called
+// on it, and started at most window before the given time, or nil
+func (t *callTracker) forwarding(line int, number string, fromCalled bool, at time.Time, window time.Duration) *activeCall {
+	var newest *activeCall
+	for l, calls := range t.calls {
+		if l == line {
+			continue
+		}
+		for _, c := range calls {
+			if c.direction == types.CallDirectionInbound && c.connectedAt.IsZero() &&
+				(c.caller == number || (fromCalled && c.called == number)) &&
+				at.Sub(c.started) >= 0 && at.Sub(c.started) <= window &&
+				(newest == nil || c.started.After(newest.started)) {
+				newest = c
+			}
+		}
+	}
+	return newest
+}
+
+// byID returns the active calls with the call ID, one per line of a ring group
+func (t *callTracker) byID(id string) []*activeCall {
+	var legs []*activeCall
+	for _, calls := range t.calls {
+		for _, c := range calls {
+			if c.id == id {
+				legs = append(legs, c)
+			}
+		}
+	}
+	return legs
+}
+
+// count returns the number of active calls on all connection IDs
+func (t *callTracker) count() int {
+	n := 0
+	for _, calls := range t.calls {
+		n += len(calls)
+	}
+	return n
+}
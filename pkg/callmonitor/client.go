@@ -0,0 +1,903 @@
+package callmonitor
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/phone"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// DefaultDuplicateWindow is how long received lines are remembered for de-duplication
+const DefaultDuplicateWindow = 10 * time.Minute
+
+// DefaultRingGroupWindow is how long after a RING further RINGs of the same
+// call on other connection IDs are grouped into it
+const DefaultRingGroupWindow = 2 * time.Second
+
+// DefaultForwardWindow is how long after a RING a CALL placed by the
+// Fritz!Box to forward it is linked to the call
+const DefaultForwardWindow = 5 * time.Second
+
+// ErrUnknownCall marks a DISCONNECT on a line without a known call in strict
+// mode, e.g. after the bridge missed the RING or CALL
+var ErrUnknownCall = errors.New("no call known on the line")
+
+// DefaultTAMExtensions are the internal numbers of the Fritz!Box answering machines (TAM 1-5)
+var DefaultTAMExtensions = []string{"40", "41", "42", "43", "44"}
+
+// Client represents a Fritz!Box callmonitor client
+type Client struct {
+	host            string
+	port            int
+	mu              sync.Mutex // Guards conn, stopChan and connected, which the read loop of a connection also touches
+	conn            net.Conn
+	eventChan       chan types.CallEvent
+	errorChan       chan error
+	stopChan        chan struct{}
+	connected       bool
+	timezone        *time.Location
+	countryCode     string
+	localAreaCode   string
+	normalizer      *phone.Normalizer        // E.164 normalizer (nil if region is unknown)
+	settings        atomic.Pointer[Settings] // Replaced as a whole by Reload
+	doNotRecord     []string                 // MSNs/extensions whose calls must not be logged
+	tamExtensions   []string                 // Extensions of the answering machines
+	trunkNames      map[string]string        // Names of the SIP lines
+	trunkFilter     types.TrunkFilter        // Trunks whose calls are delivered
+	extensionFilter types.ExtensionFilter    // MSNs/extensions whose calls are delivered
+	calls           *callTracker             // Active calls per line (connection ID)
+	ringGroup       time.Duration            // Window for grouping parallel RINGs, zero disables
+	forwardWindow   time.Duration            // Window for linking forwarding CALLs to a RING, zero disables
+	forwardExts     []string                 // Extensions the Fritz!Box places forwarding CALLs from
+	dedup           *deduplicator            // Drops lines delivered twice
+	repeats         *repeatTracker           // Flags callers calling again shortly after
+	timestamps      *timestampParser         // Resolves the two-digit years of the timestamps
+	rejectChan      chan Rejection
+	unparsedChan    chan Unparsed
+	onRing          func(types.CallEvent)
+	strict          bool       // DISCONNECTs without a known call are reported instead of delivered
+	ignoreInternal  bool       // Calls between extensions are tracked, but not delivered
+	saver           *callSaver // Saves the active calls after every change, nil keeps them in memory only
+}
+
+// Rejection is a callmonitor line dropped because of an implausible timestamp.
+// Numbers of the line are left out, they may belong to do-not-record MSNs.
+type Rejection struct {
+	Timestamp string    `json:"timestamp"` // Timestamp as sent by the Fritz!Box
+	Type      string    `json:"type"`      // RING, CALL, CONNECT or DISCONNECT
+	Reason    string    `json:"reason"`
+	Time      time.Time `json:"time"` // Local time of the rejection
+}
+
+// Unparsed is a callmonitor line that could not be parsed, e.g. of a call
+// type introduced by a newer Fritz!OS. The format of the line is kept, so it
+// can be reported, but numbers are masked with MaskNumbers: the line cannot be
+// checked against do-not-record, the extension filter or the redaction.
+type Unparsed struct {
+	Line   string    `json:"line"`
+	Reason string    `json:"reason"`
+	Time   time.Time `json:"time"` // Local time of reception
+}
+
+// Settings are the options of a client that can be replaced while it runs, see Reload
+type Settings struct {
+	MSNs           []string          // Own MSNs for detection
+	MSNNames       map[string]string // Names of the MSNs, see types.ParseMSNs
+	ExtensionNames map[string]string // Names of the extensions by callmonitor ID
+	Tagger         *types.Tagger     // Attaches tags to the events of a call, nil for none
+	VIPs           *types.VIPList    // Callers whose calls are flagged as priority, nil for none
+}
+
+// Options configures a callmonitor client
+type Options struct {
+	Host            string
+	Port            int
+	Timezone        *time.Location        // Timezone of the Fritz!Box timestamps (default: time.Local)
+	CountryCode     string                // Own country calling code without prefix, e.g. "49"
+	LocalAreaCode   string                // Own area code without trunk prefix, e.g. "30"
+	Region          string                // Region for number normalization (default: derived from CountryCode)
+	MSNs            []string              // Own MSNs for detection
+	MSNNames        map[string]string     // Names of the MSNs, see types.ParseMSNs
+	DoNotRecord     []string              // MSNs/extensions whose calls are flagged as do-not-record
+	TAMExtensions   []string              // Extensions of the answering machines (default: DefaultTAMExtensions)
+	ExtensionNames  map[string]string     // Names of the extensions by callmonitor ID, see types.ParseExtensionNames
+	TrunkNames      map[string]string     // Names of the SIP lines, e.g. SIP0=Vodafone
+	TrunkFilter     types.TrunkFilter     // Events of calls on other trunks are dropped (default: all trunks)
+	ExtensionFilter types.ExtensionFilter // Events of calls of other MSNs/extensions are dropped by the parser (default: all calls)
+	IgnoreInternal  bool                  // Events of calls between extensions, dialed with **, are dropped by the parser
+	Tagger          *types.Tagger         // Attaches tags to the events of a call (default: none)
+	VIPs            *types.VIPList        // Callers whose calls are flagged as priority (default: none)
+
+	// OnRing is called by the read loop with every RING event before it is
+	// delivered, for publishing it with the least delay. It must not block.
+	OnRing func(types.CallEvent)
+
+	// Lines received again within this window are dropped as duplicates, e.g.
+	// resent by the Fritz!Box after a reconnect (default: DefaultDuplicateWindow, negative disables)
+	DuplicateWindow time.Duration
+	// RINGs of the same caller, called number and trunk on other connection
+	// IDs within this window are grouped into one call delivered on the line
+	// of the first RING (default: DefaultRingGroupWindow, negative disables)
+	RingGroupWindow time.Duration
+	// A CALL with the number of the caller of a call still ringing on another
+	// connection ID within this window after its RING is the Fritz!Box
+	// forwarding it, as is a CALL from the called number on one of
+	// ForwardExtensions. Both calls are flagged as forwarded and linked by the
+	// parent call ID (default: DefaultForwardWindow, negative disables)
+	ForwardWindow time.Duration
+	// Extensions the Fritz!Box reports on the CALLs it places for forwardings
+	// that present the own number. CALLs on other extensions from the called
+	// number are dialed by hand and never linked (default: none).
+	ForwardExtensions []string
+	// Inbound calls of a caller who called within this window before are
+	// flagged as repeat calls with the attempts in a row (default: 0 = disabled)
+	RepeatCallWindow time.Duration
+	Clock            clock.Clock // Drives the duplicate window and the timestamp checks (default: real time)
+
+	// Two-digit years of timestamps are mapped into the 100 years starting at
+	// this year (default: 0 = the window from 90 years ago to 9 years ahead)
+	TimestampPivotYear int
+	// Lines with unparsable timestamps or timestamps off the local clock by more
+	// than MaxTimestampSkew are rejected instead of being processed
+	StrictTimestamps bool
+	MaxTimestampSkew time.Duration // Default: DefaultMaxTimestampSkew, negative disables the check
+
+	// A DISCONNECT on a line without a known call is reported on Errors as
+	// ErrUnknownCall instead of being delivered without call ID and trunk
+	Strict bool
+}
+
+// DefaultOptions returns the options used when nothing else is configured
+func DefaultOptions() Options {
+	return Options{
+		Host:          "fritz.box",
+		Port:          1012,
+		Timezone:      time.Local,
+		CountryCode:   "49",
+		TAMExtensions: DefaultTAMExtensions,
+
+		DuplicateWindow: DefaultDuplicateWindow,
+		RingGroupWindow: DefaultRingGroupWindow,
+		ForwardWindow:   DefaultForwardWindow,
+		Clock:           clock.Real(),
+
+		MaxTimestampSkew: DefaultMaxTimestampSkew,
+	}
+}
+
+// withDefaults fills unset fields from DefaultOptions
+func (o Options) withDefaults() Options {
+	defaults := DefaultOptions()
+	if o.Host == "" {
+		o.Host = defaults.Host
+	}
+	if o.Port == 0 {
+		o.Port = defaults.Port
+	}
+	if o.Timezone == nil {
+		o.Timezone = defaults.Timezone
+	}
+	if o.TAMExtensions == nil {
+		o.TAMExtensions = defaults.TAMExtensions
+	}
+	if o.DuplicateWindow == 0 {
+		o.DuplicateWindow = defaults.DuplicateWindow
+	}
+	if o.RingGroupWindow == 0 {
+		o.RingGroupWindow = defaults.RingGroupWindow
+	}
+	if o.ForwardWindow == 0 {
+		o.ForwardWindow = defaults.ForwardWindow
+	}
+	if o.Clock == nil {
+		o.Clock = defaults.Clock
+	}
+	if o.MaxTimestampSkew == 0 {
+		o.MaxTimestampSkew = defaults.MaxTimestampSkew
+	}
+	return o
+}
+
+// NewClient creates a new callmonitor client. It fails only if an explicitly
+// configured region is unknown.
+func NewClient(opts Options) (*Client, error) {
+	opts = opts.withDefaults()
+
+	normalizer, err := phone.NewNormalizer(opts.Region, opts.CountryCode, opts.LocalAreaCode)
+	if err != nil {
+		if opts.Region != "" {
+			return nil, fmt.Errorf("failed to configure phone number normalization: %w", err)
+		}
+		log.Printf("Phone number normalization disabled: %v", err)
+	}
+
+	client := &Client{
+		host:            opts.Host,
+		port:            opts.Port,
+		eventChan:       make(chan types.CallEvent, 100),
+		errorChan:       make(chan error, 10),
+		stopChan:        make(chan struct{}),
+		timezone:        opts.Timezone,
+		countryCode:     opts.CountryCode,
+		localAreaCode:   opts.LocalAreaCode,
+		normalizer:      normalizer,
+		doNotRecord:     opts.DoNotRecord,
+		tamExtensions:   opts.TAMExtensions,
+		trunkNames:      opts.TrunkNames,
+		trunkFilter:     opts.TrunkFilter,
+		extensionFilter: opts.ExtensionFilter,
+		calls:           newCallTracker(),
+		ringGroup:       max(opts.RingGroupWindow, 0),
+		forwardWindow:   max(opts.ForwardWindow, 0),
+		forwardExts:     opts.ForwardExtensions,
+		dedup:           newDeduplicator(opts.DuplicateWindow, opts.Clock),
+		repeats:         newRepeatTracker(opts.RepeatCallWindow),
+		timestamps: &timestampParser{
+			location:  opts.Timezone,
+			pivotYear: opts.TimestampPivotYear,
+			strict:    opts.StrictTimestamps,
+			maxSkew:   opts.MaxTimestampSkew,
+			clock:     opts.Clock,
+		},
+		rejectChan:     make(chan Rejection, 10),
+		unparsedChan:   make(chan Unparsed, 10),
+		onRing:         opts.OnRing,
+		strict:         opts.Strict,
+		ignoreInternal: opts.IgnoreInternal,
+	}
+	client.Reload(Settings{MSNs: opts.MSNs, MSNNames: opts.MSNNames, ExtensionNames: opts.ExtensionNames, Tagger: opts.Tagger, VIPs: opts.VIPs})
+	return client, nil
+}
+
+// Reload replaces the settings of the client. Lines received afterwards are
+// parsed with the new settings; calls already running keep their tags and priority.
+func (c *Client) Reload(settings Settings) {
+	c.settings.Store(&settings)
+}
+
+// Connect establishes connection to Fritz!Box callmonitor. The context bounds
+// only the dial; the established connection outlives it.
+func (c *Client) Connect(ctx context.Context) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(c.host, strconv.Itoa(c.port)))
+	if err != nil {
+		return fmt.Errorf("failed to connect to Fritz!Box callmonitor: %w", err)
+	}
+
+	// Every connection gets its own stop channel
+	stop := make(chan struct{})
+	c.mu.Lock()
+	c.conn = conn
+	c.stopChan = stop
+	c.connected = true
+	c.mu.Unlock()
+
+	// Start reading in background
+	go c.readLoop(conn, stop)
+
+	return nil
+}
+
+// Disconnect closes the connection and waits until the active calls are saved
+func (c *Client) Disconnect() error {
+	if c.saver != nil {
+		c.saver.wait()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.connected {
+		return nil
+	}
+
+	c.connected = false
+	close(c.stopChan)
+	return c.conn.Close()
+}
+
+// Events returns the channel for call events
+func (c *Client) Events() <-chan types.CallEvent {
+	return c.eventChan
+}
+
+// Pending returns the number of events waiting to be read from Events
+func (c *Client) Pending() int {
+	return len(c.eventChan)
+}
+
+// Errors returns the channel for errors. Read errors end the connection,
+// ErrUnknownCall does not.
+func (c *Client) Errors() <-chan error {
+	return c.errorChan
+}
+
+// Rejected returns the channel of lines rejected because of implausible
+// timestamps, only used with Options.StrictTimestamps
+func (c *Client) Rejected() <-chan Rejection {
+	return c.rejectChan
+}
+
+// Unparsed returns the channel of lines that could not be parsed
+func (c *Client) Unparsed() <-chan Unparsed {
+	return c.unparsedChan
+}
+
+// IsConnected returns the connection status
+func (c *Client) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+// readLoop continuously reads from the Fritz!Box connection until it is closed or stop is closed
+func (c *Client) readLoop(conn net.Conn, stop chan struct{}) {
+	defer func() {
+		// A newer connection may already be established
+		c.mu.Lock()
+		if c.conn == conn {
+			c.connected = false
+		}
+		c.mu.Unlock()
+		_ = conn.Close() // Ignore error in cleanup
+	}()
+
+	scanner := bufio.NewScanner(conn)
+
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+			if !scanner.Scan() {
+				if err := scanner.Err(); err != nil {
+					c.errorChan <- fmt.Errorf("error reading from connection: %w", err)
+				} else {
+					c.errorChan <- fmt.Errorf("connection closed by remote")
+				}
+				return
+			}
+
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+
+			// Checked before parsing, which would start a new call ID for a repeated RING or CALL
+			if c.dedup.Duplicate(line) {
+				log.Printf("Dropping duplicate callmonitor line: %s", line)
+				continue
+			}
+
+			event, err := c.parseEvent(line)
+			if errors.Is(err, ErrImplausibleTimestamp) {
+				log.Printf("Rejecting callmonitor line %q: %v", line, err)
+				parts := strings.SplitN(line, ";", 3)
+				rejection := Rejection{Timestamp: parts[0], Type: strings.ToUpper(parts[1]), Reason: err.Error(), Time: c.timestamps.clock.Now()}
+				select {
+				case c.rejectChan <- rejection:
+				default:
+					// Nobody is listening, the line is logged anyway
+				}
+				continue
+			}
+			if errors.Is(err, ErrUnknownCall) {
+				log.Printf("Inconsistent callmonitor line %q: %v", line, err)
+				select {
+				case c.errorChan <- err:
+				default:
+					// An error ending the connection is pending anyway
+				}
+				continue
+			}
+			if err != nil {
+				log.Printf("Failed to parse callmonitor line %q: %v", line, err)
+				select {
+				case c.unparsedChan <- Unparsed{Line: MaskNumbers(line), Reason: MaskNumbers(err.Error()), Time: c.timestamps.clock.Now()}:
+				default:
+					// Nobody is listening, the line is logged anyway
+				}
+				continue
+			}
+			if c.saver != nil {
+				c.saver.set(c.calls.snapshot())
+			}
+			// Lines of a ring group other than its final DISCONNECT and filtered calls are not delivered
+			if event == nil {
+				continue
+			}
+			// Calls on ignored trunks are still tracked, so their later events are recognized
+			if !c.trunkFilter.Allows(event.Trunk) {
+				continue
+			}
+			if event.Type == types.CallTypeRing && c.onRing != nil {
+				c.onRing(*event)
+			}
+
+			select {
+			case c.eventChan <- *event:
+			case <-stop:
+				return
+			default:
+				// Channel is full, skip this event
+			}
+		}
+	}
+}
+
+// parseEvent parses a Fritz!Box callmonitor line into a CallEvent. It returns
+// no event and no error for lines merged into a call of a ring group and for
+// calls dropped by the extension filter.
+func (c *Client) parseEvent(rawMessage string) (*types.CallEvent, error) {
+	// Split the message into parts
+	parts := strings.Split(rawMessage, ";")
+	if len(parts) < 4 {
+		return nil, fmt.Errorf("invalid callmonitor format (too few parts): %s", rawMessage)
+	}
+
+	// Parse timestamp
+	timestamp, err := c.parseTimestamp(parts[0])
+	if errors.Is(err, ErrImplausibleTimestamp) {
+		return nil, err
+	}
+	if err != nil {
+		log.Printf("%v, using the current time", err)
+		timestamp = c.timestamps.clock.Now().In(c.timezone)
+	} else if !c.timestamps.Plausible(timestamp) {
+		log.Printf("Callmonitor timestamp %s is far off the local clock, check the time settings of the Fritz!Box", timestamp.Format(time.DateTime))
+	}
+
+	// Parse call type and delegate to specific parser
+	callTypeStr := strings.ToUpper(parts[1])
+
+	lineID, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid LineID (not an int): %v", err)
+	}
+
+	// The whole line is parsed with the same settings, even during a Reload
+	settings := c.settings.Load()
+
+	var event *types.CallEvent
+	switch callTypeStr {
+	case "RING":
+		event, err = c.parseEventRing(settings, parts, timestamp, lineID, rawMessage)
+	case "CALL":
+		event, err = c.parseEventCall(settings, parts, timestamp, lineID, rawMessage)
+	case "CONNECT":
+		event, err = c.parseEventConnect(settings, parts, timestamp, lineID, rawMessage)
+	case "DISCONNECT":
+		event, err = c.parseEventDisconnect(settings, parts, timestamp, lineID, rawMessage)
+	default:
+		return nil, fmt.Errorf("unknown call type: %s", callTypeStr)
+	}
+	if err != nil || event == nil {
+		return nil, err
+	}
+
+	event.TrunkName = c.trunkNames[event.Trunk]
+	return event, nil
+}
+
+// parseEventRing parses RING events
+// Format: timestamp;RING;line;caller;called;trunk;
+// Example: 09.09.25 17:33:01;RING;0;0178123456789;0119876543;SIP4;
+func (c *Client) parseEventRing(settings *Settings, parts []string, timestamp time.Time, lineID int, rawMessage string) (*types.CallEvent, error) {
+	if len(parts) < 5 {
+		return nil, fmt.Errorf("invalid RING format: need at least 5 parts, got %d", len(parts))
+	}
+
+	event := &types.CallEvent{
+		ID:         types.NewCallID(),
+		Timestamp:  timestamp,
+		Type:       types.CallTypeRing,
+		Direction:  types.CallDirectionInbound,
+		Line:       lineID,
+		Trunk:      parts[5],
+		Caller:     c.normalizePhoneNumber(parts[3]),
+		Called:     c.normalizePhoneNumber(parts[4]),
+		RawMessage: rawMessage,
+		CallerRaw:  strings.TrimSpace(parts[3]),
+		CalledRaw:  strings.TrimSpace(parts[4]),
+	}
+
+	// Enrich with MSN information
+	event.EnrichWithMSNs(settings.MSNs, settings.MSNNames)
+
+	// A RING of a call already ringing on another line joins its ring group
+	if c.ringGroup > 0 {
+		if first := c.calls.ringing(lineID, event.Caller, event.Called, event.Trunk, timestamp, c.ringGroup); first != nil {
+			c.joinRingGroup(first, event)
+			return nil, nil
+		}
+	}
+
+	// Track the call for later CONNECT and DISCONNECT events; calls already
+	// running on this line, e.g. with call waiting, are kept
+	call := c.startCall(event, settings)
+	c.flagRepeatCall(event, call)
+	c.applyDoNotRecord(event, call)
+	if c.filterCall(event, call) {
+		return nil, nil
+	}
+
+	return event, nil
+}
+
+// parseEventCall parses CALL events
+// Format: timestamp;CALL;line;extension;caller;called;trunk;
+// Example: 09.09.25 17:33:34;CALL;1;21;9876543;0178123456789;SIP1;
+func (c *Client) parseEventCall(settings *Settings, parts []string, timestamp time.Time, line int, rawMessage string) (*types.CallEvent, error) {
+	if len(parts) < 6 {
+		return nil, fmt.Errorf("invalid CALL format: need at least 6 parts, got %d", len(parts))
+	}
+
+	event := &types.CallEvent{
+		ID:            types.NewCallID(),
+		Timestamp:     timestamp,
+		Type:          types.CallTypeCall,
+		Direction:     types.CallDirectionOutbound,
+		Line:          line,
+		Trunk:         parts[6],
+		Extension:     parts[3],
+		ExtensionName: settings.ExtensionNames[parts[3]],
+		Caller:        c.normalizePhoneNumber(parts[4]),
+		Called:        c.normalizePhoneNumber(parts[5]),
+		RawMessage:    rawMessage,
+		CallerRaw:     strings.TrimSpace(parts[4]),
+		CalledRaw:     strings.TrimSpace(parts[5]),
+	}
+
+	// Enrich with MSN information
+	event.EnrichWithMSNs(settings.MSNs, settings.MSNNames)
+
+	// Track the call for later CONNECT and DISCONNECT events
+	call := c.startCall(event, settings)
+	c.linkForward(event, call)
+	c.applyDoNotRecord(event, call)
+	if c.filterCall(event, call) {
+		return nil, nil
+	}
+
+	return event, nil
+}
+
+// parseConnectEvent parses CONNECT events
+// caller_or_called depends on direction, it's always the number on the external
+// Format: timestamp;CONNECT;line;extension;caller_or_called;
+// Example 09.09.25 17:33:07;CONNECT;0;23;0178123456789;
+func (c *Client) parseEventConnect(settings *Settings, parts []string, timestamp time.Time, line int, rawMessage string) (*types.CallEvent, error) {
+	if len(parts) < 4 {
+		return nil, fmt.Errorf("invalid CONNECT format: need at least 4 parts, got %d", len(parts))
+	}
+
+	event := &types.CallEvent{
+		Timestamp:     timestamp,
+		Type:          types.CallTypeConnect,
+		Line:          line,
+		Extension:     parts[3],
+		ExtensionName: settings.ExtensionNames[parts[3]],
+		RawMessage:    rawMessage,
+	}
+
+	// Look up the call from RING/CALL; with call waiting this is the call being answered
+	call := c.calls.connect(event.Line)
+	if call == nil {
+		// A call that started before the bridge, e.g. while it was down, is
+		// tracked from now on, so its DISCONNECT and a restart keep its ID
+		call = &activeCall{id: types.NewCallID(), line: event.Line, started: timestamp}
+		c.calls.start(event.Line, call)
+	}
+	call.connectedAt = timestamp
+	call.connectedOn = c.timestamps.clock.Now()
+	c.fillFromCall(event, call)
+
+	// Answered by an answering machine instead of a phone
+	if c.isTAMExtension(event.Extension) {
+		call.tam = true
+	}
+	event.MessageBox = call.tam
+
+	if group := call.group; group != nil {
+		event.Line = group.line
+		event.RingGroup = group.lines
+		if group.extension == "" {
+			group.extension = event.Extension
+		}
+	}
+
+	// Enrich with MSN information
+	event.EnrichWithMSNs(settings.MSNs, settings.MSNNames)
+	c.applyDoNotRecord(event, call)
+	if call.filtered {
+		return nil, nil
+	}
+
+	return event, nil
+}
+
+// parseEventDisconnect parses DISCONNECT events
+// Format: timestamp;DISCONNECT;id;duration
+// Example: 09.09.25 17:33:34;DISCONNECT;1;30;
+func (c *Client) parseEventDisconnect(settings *Settings, parts []string, timestamp time.Time, line int, rawMessage string) (*types.CallEvent, error) {
+	if len(parts) < 3 {
+		return nil, fmt.Errorf("invalid DISCONNECT format: need at least 3 parts, got %d", len(parts))
+	}
+
+	event := &types.CallEvent{
+		Timestamp:  timestamp,
+		Type:       types.CallTypeDisconnect,
+		Line:       line,
+		RawMessage: rawMessage,
+	}
+
+	// parse duration
+	if duration, err := strconv.Atoi(parts[3]); err == nil {
+		event.Duration = duration
+	}
+
+	// Look up and stop tracking the call from RING/CALL; with several calls
+	// on the line, the duration tells which one ended
+	call := c.calls.disconnect(event.Line, timestamp, event.Duration)
+	if call != nil {
+		c.fillFromCall(event, call)
+		event.MessageBox = call.tam
+		c.measureDuration(event, call)
+
+		// A ring group ends with the DISCONNECT of its last line
+		if group := call.group; group != nil {
+			group.active--
+			group.duration = max(group.duration, event.Duration)
+			group.measured = max(group.measured, event.MeasuredDuration)
+			if group.active > 0 {
+				return nil, nil
+			}
+			event.Line = group.line
+			event.Duration = group.duration
+			event.MeasuredDuration = group.measured
+			event.DurationMismatch = group.measured > 0 && mismatch(group.duration, group.measured)
+			event.Extension = group.extension
+			event.ExtensionName = settings.ExtensionNames[group.extension]
+			event.RingGroup = group.lines
+		}
+	} else if c.strict {
+		return nil, fmt.Errorf("%w: DISCONNECT on line %d, its trunk and parties are unknown", ErrUnknownCall, line)
+	} else {
+		event.ID = types.NewCallID()
+	}
+
+	// Enrich with MSN information
+	event.EnrichWithMSNs(settings.MSNs, settings.MSNNames)
+	c.applyDoNotRecord(event, call)
+	if call != nil && call.filtered {
+		return nil, nil
+	}
+
+	return event, nil
+}
+
+// startCall tracks the call started by a RING or CALL event, tags it and
+// flags calls of VIPs. Without settings, the call is neither tagged nor flagged.
+func (c *Client) startCall(event *types.CallEvent, settings *Settings) *activeCall {
+	call := &activeCall{
+		id:        event.ID,
+		line:      event.Line,
+		started:   event.Timestamp,
+		trunk:     event.Trunk,
+		direction: event.Direction,
+		caller:    event.Caller,
+		called:    event.Called,
+		callerRaw: event.CallerRaw,
+		calledRaw: event.CalledRaw,
+	}
+	event.Internal = types.IsInternalNumber(event.Caller) || types.IsInternalNumber(event.Called)
+	call.internal = event.Internal
+	event.NumberType = c.classifyNumber(event)
+	call.numberType = event.NumberType
+	if settings != nil {
+		event.Tags = settings.Tagger.Tags(event)
+		event.Priority = settings.VIPs.Matches(event)
+	}
+	call.tags = event.Tags
+	call.priority = event.Priority
+	c.calls.start(event.Line, call)
+	return call
+}
+
+// measureDuration sets the talk time of a connected call as measured by the
+// local clock since CONNECT and flags a mismatch with the reported duration.
+// Unlike the difference of the timestamps, the measurement is not confused
+// by clock or DST changes during the call.
+func (c *Client) measureDuration(event *types.CallEvent, call *activeCall) {
+	if call.connectedOn.IsZero() {
+		return
+	}
+	measured := c.timestamps.clock.Now().Sub(call.connectedOn).Round(time.Second)
+	event.MeasuredDuration = int(measured.Seconds())
+	event.DurationMismatch = mismatch(event.Duration, event.MeasuredDuration)
+	if event.DurationMismatch {
+		log.Printf("Call %s reported %ds talk time, measured %ds", call.id, event.Duration, event.MeasuredDuration)
+	}
+}
+
+// mismatch reports whether the reported and measured durations differ by more than durationTolerance
+func mismatch(reported, measured int) bool {
+	diff := time.Duration(reported-measured) * time.Second
+	return diff > durationTolerance || diff < -durationTolerance
+}
+
+// joinRingGroup tracks the RING event as a further line of the call first rang
+func (c *Client) joinRingGroup(first *activeCall, event *types.CallEvent) {
+	if first.group == nil {
+		first.group = &ringGroup{line: first.line, lines: []int{first.line}, active: 1}
+	}
+	group := first.group
+	group.lines = append(group.lines, event.Line)
+	group.active++
+
+	call := c.startCall(event, nil) // Tagged and flagged like the first call below
+	call.id = first.id
+	call.noRecord = first.noRecord
+	call.filtered = first.filtered
+	call.tags = first.tags
+	call.priority = first.priority
+	call.repeats = first.repeats
+	call.forwardedTo = first.forwardedTo
+	call.group = group
+	log.Printf("Grouping RING on line %d into call %s ringing on line %d", event.Line, first.id, group.line)
+}
+
+// fillFromCall copies the values known since RING/CALL into a CONNECT or DISCONNECT event
+func (c *Client) fillFromCall(event *types.CallEvent, call *activeCall) {
+	event.ID = call.id
+	event.Trunk = call.trunk
+	event.Direction = call.direction
+	event.Caller = call.caller
+	event.Called = call.called
+	event.CallerRaw = call.callerRaw
+	event.CalledRaw = call.calledRaw
+	event.Tags = call.tags
+	event.Priority = call.priority
+	event.Internal = call.internal
+	event.NumberType = call.numberType
+	if call.repeats > 1 {
+		event.RepeatCall, event.RepeatCount = true, call.repeats
+	}
+	event.ParentCallID = call.parentID
+	event.ForwardedTo = call.forwardedTo
+	event.Forwarded = call.parentID != "" || call.forwardedTo != ""
+}
+
+// linkForward links an outbound call the Fritz!Box placed to forward an
+// inbound call: the CALL follows the RING within the forward window and
+// presents the number of the caller, or calls from the number that was called
+// on a forwarding extension. A CALL a user dials from the ringing MSN on
+// another handset is not linked. The inbound call is flagged with the number
+// it was forwarded to from its next event on.
+func (c *Client) linkForward(event *types.CallEvent, call *activeCall) {
+	if c.forwardWindow <= 0 || event.Internal || event.Caller == "" {
+		return
+	}
+	fromCalled := slices.Contains(c.forwardExts, event.Extension)
+	parent := c.calls.forwarding(event.Line, event.Caller, fromCalled, event.Timestamp, c.forwardWindow)
+	if parent == nil {
+		return
+	}
+
+	// Every line of a ring group delivers the events of the inbound call
+	for _, leg := range c.calls.byID(parent.id) {
+		if leg.forwardedTo == "" {
+			leg.forwardedTo = event.Called
+		}
+	}
+	call.parentID = parent.id
+	event.Forwarded, event.ParentCallID = true, parent.id
+	log.Printf("Linking CALL on line %d to %s as forward of call %s ringing on line %d", event.Line, event.Called, parent.id, parent.line)
+}
+
+// flagRepeatCall flags an inbound call whose caller called within the repeat
+// call window before; calls between extensions are not tracked
+func (c *Client) flagRepeatCall(event *types.CallEvent, call *activeCall) {
+	if event.Internal {
+		return
+	}
+	call.repeats = c.repeats.Record(event.Caller, event.Timestamp)
+	if call.repeats > 1 {
+		event.RepeatCall, event.RepeatCount = true, call.repeats
+		log.Printf("Call %s is attempt %d of the caller in a row", event.ID, call.repeats)
+	}
+}
+
+// applyDoNotRecord flags events of opted-out MSNs/extensions.
+// Once set, the flag sticks to the call until it is disconnected.
+func (c *Client) applyDoNotRecord(event *types.CallEvent, call *activeCall) {
+	if (call != nil && call.noRecord) || event.MatchesDoNotRecord(c.doNotRecord) {
+		event.DoNotRecord = true
+		if call != nil {
+			call.noRecord = true
+		}
+	}
+}
+
+// filterCall decides at RING or CALL whether the call is dropped by the
+// extension filter. The call stays tracked, so its later events are recognized
+// and dropped as well.
+func (c *Client) filterCall(event *types.CallEvent, call *activeCall) bool {
+	call.filtered = !c.extensionFilter.Allows(event) || (c.ignoreInternal && event.Internal)
+	return call.filtered
+}
+
+// isTAMExtension checks if the extension belongs to an answering machine
+func (c *Client) isTAMExtension(extension string) bool {
+	for _, tam := range c.tamExtensions {
+		if tam != "" && tam == extension {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizePhoneNumber converts a phone number into E.164 format; internal
+// dial codes like **610 are kept
+func (c *Client) normalizePhoneNumber(phoneNumber string) string {
+	if types.IsInternalNumber(phoneNumber) {
+		return strings.TrimSpace(phoneNumber)
+	}
+	if c.normalizer == nil {
+		return phoneNumber
+	}
+	return c.normalizer.Normalize(phoneNumber)
+}
+
+// classifyNumber returns the type of the number of the other party: the
+// caller of inbound calls, the called number of outbound calls
+func (c *Client) classifyNumber(event *types.CallEvent) types.NumberType {
+	if c.normalizer == nil || event.Internal {
+		return ""
+	}
+	if event.Direction == types.CallDirectionOutbound {
+		return c.normalizer.Classify(event.Called)
+	}
+	return c.normalizer.Classify(event.Caller)
+}
+
+// parseTimestamp parses a Fritz!Box timestamp, e.g. "21.09.25 15:30:45"
+func (c *Client) parseTimestamp(timestampStr string) (time.Time, error) {
+	return c.timestamps.Parse(timestampStr)
+}
+
+// MaskNumbers replaces every digit of runs of three or more digits with 'x',
+// so phone numbers and MSNs are hidden while timestamps, connection IDs and
+// extensions stay readable
+func MaskNumbers(s string) string {
+	runes := []rune(s)
+	for start := 0; start < len(runes); {
+		if runes[start] < '0' || runes[start] > '9' {
+			start++
+			continue
+		}
+		end := start
+		for end < len(runes) && runes[end] >= '0' && runes[end] <= '9' {
+			end++
+		}
+		if end-start >= 3 {
+			for i := start; i < end; i++ {
+				runes[i] = 'x'
+			}
+		}
+		start = end
+	}
+	return string(runes)
+}
@@ -0,0 +1,1022 @@
+package callmonitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// newTestClient creates a client or fails the test
+func newTestClient(t *testing.T, opts Options) *Client {
+	t.Helper()
+	client, err := NewClient(opts)
+	if err != nil {
+		t.Fatalf("Failed to create client: %v", err)
+	}
+	return client
+}
+
+func TestNewClientDefaults(t *testing.T) {
+	client := newTestClient(t, Options{})
+
+	if client.host != "fritz.box" || client.port != 1012 {
+		t.Errorf("Expected default address fritz.box:1012, got %s:%d", client.host, client.port)
+	}
+	if client.timezone != time.Local {
+		t.Errorf("Expected local timezone, got %v", client.timezone)
+	}
+	if len(client.tamExtensions) != len(DefaultTAMExtensions) {
+		t.Errorf("Expected default TAM extensions, got %v", client.tamExtensions)
+	}
+}
+
+func TestNewClientInvalidRegion(t *testing.T) {
+	if _, err := NewClient(Options{CountryCode: "49", Region: "XX"}); err == nil {
+		t.Error("Expected error for unknown region")
+	}
+}
+
+func TestParseCallEvent(t *testing.T) {
+
+	tests := []struct {
+		name        string
+		input       string
+		expectError bool
+		expected    *types.CallEvent
+	}{
+		{
+			name:  "incoming call",
+			input: "21.09.25 15:30:45;RING;0;123456789;987654321;SIP0",
+			expected: &types.CallEvent{
+				Type:   types.CallTypeRing,
+				Line:   0,
+				Caller: "+4930123456789",
+				Called: "+4930987654321",
+				Trunk:  "SIP0",
+			},
+		},
+		{
+			name:  "outgoing call",
+			input: "21.09.25 15:31:00;CALL;1;2;987654321;123456789;SIP1",
+			expected: &types.CallEvent{
+				Type:      types.CallTypeCall,
+				Line:      1,
+				Extension: "2",
+				Caller:    "+4930987654321",
+				Called:    "+4930123456789",
+				Trunk:     "SIP1",
+			},
+		},
+		{
+			name:  "connect",
+			input: "21.09.25 15:31:05;CONNECT;1;2;987654321;123456789",
+			expected: &types.CallEvent{
+				Type:      types.CallTypeConnect,
+				Line:      1,
+				Extension: "2",
+				Caller:    "", // Will be set from stored state in real lifecycle
+				Called:    "", // Will be set from stored state in real lifecycle
+			},
+		},
+		{
+			name:  "disconnect with id and duration",
+			input: "21.09.25 15:35:00;DISCONNECT;1;235;",
+			expected: &types.CallEvent{
+				Type:      types.CallTypeDisconnect,
+				Line:      1,
+				Extension: "",
+				Caller:    "",
+				Called:    "",
+				Trunk:     "", // Empty without prior call setup
+				Duration:  235,
+			},
+		},
+		{
+			name:        "invalid format - too few parts",
+			input:       "21.09.25 15:30:45;RING;0",
+			expectError: true,
+		},
+		{
+			name:        "invalid call type",
+			input:       "21.09.25 15:30:45;UNKNOWN;0;1;123456789;987654321;SIP0",
+			expectError: true,
+		},
+		{
+			name:  "disconnect with minimal fields (real world case)",
+			input: "09.09.25 12:50:15;DISCONNECT;1;0;",
+			expected: &types.CallEvent{
+				Type:      types.CallTypeDisconnect,
+				Line:      1,
+				Extension: "",
+				Caller:    "",
+				Called:    "",
+				Trunk:     "", // Will be empty without prior call setup
+				Duration:  0,
+			},
+		},
+		{
+			name:  "disconnect with id and duration (user reported case)",
+			input: "09.09.25 13:51:39;DISCONNECT;0;7;",
+			expected: &types.CallEvent{
+				Type:      types.CallTypeDisconnect,
+				Line:      0,
+				Extension: "",
+				Caller:    "",
+				Called:    "",
+				Trunk:     "", // Will be empty without prior call setup
+				Duration:  7,
+			},
+		},
+		{
+			name:  "incoming call with SIP field (real Fritz!Box format)",
+			input: "09.09.25 16:27:15;RING;0;01784567890;990134;SIP1;",
+			expected: &types.CallEvent{
+				Type:   types.CallTypeRing,
+				Line:   0,
+				Caller: "+491784567890", // 01784567890 normalized
+				Called: "+4930990134",   // 990134 normalized with area code
+				Trunk:  "SIP1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "30", MSNs: []string{"990133", "990134"}}) // Fresh client for each test
+			result, err := client.parseEvent(tt.input)
+
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error, but got none")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+
+			if result == nil {
+				t.Error("Expected result, but got nil")
+				return
+			}
+
+			// Check main fields
+			if result.Type != tt.expected.Type {
+				t.Errorf("Type: expected %s, got %s", tt.expected.Type, result.Type)
+			}
+			if result.Line != tt.expected.Line {
+				t.Errorf("Line: expected %d, got %d", tt.expected.Line, result.Line)
+			}
+			if result.Extension != tt.expected.Extension {
+				t.Errorf("Extension: expected %s, got %s", tt.expected.Extension, result.Extension)
+			}
+			if result.Caller != tt.expected.Caller {
+				t.Errorf("Caller: expected %s, got %s", tt.expected.Caller, result.Caller)
+			}
+			if result.Called != tt.expected.Called {
+				t.Errorf("Called: expected %s, got %s", tt.expected.Called, result.Called)
+			}
+			if result.Trunk != tt.expected.Trunk {
+				t.Errorf("Trunk: expected %s, got %s", tt.expected.Trunk, result.Trunk)
+			}
+			if result.Duration != tt.expected.Duration {
+				t.Errorf("Duration: expected %d, got %d", tt.expected.Duration, result.Duration)
+			}
+			if result.RawMessage != tt.input {
+				t.Errorf("RawMessage: expected %s, got %s", tt.input, result.RawMessage)
+			}
+		})
+	}
+}
+
+func TestCallLifecycleIDMapping(t *testing.T) {
+	client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "30", MSNs: []string{"990133", "990134"}})
+
+	// Test full call lifecycle: RING -> CONNECT -> DISCONNECT
+	// This tests that the ID to LineID mapping works correctly
+
+	// 1. Incoming call - should store ID->LineID mapping
+	ringEvent, err := client.parseEvent("21.09.25 15:30:45;RING;0;123456789;987654321;SIP0")
+	if err != nil {
+		t.Fatalf("Failed to parse RING event: %v", err)
+	}
+
+	if ringEvent.Line != 0 {
+		t.Errorf("RING: Expected ID '0', got '%d'", ringEvent.Line)
+	}
+	if ringEvent.Trunk != "SIP0" {
+		t.Errorf("RING: Expected Trunk 'SIP0', got '%s'", ringEvent.Trunk)
+	}
+
+	// 2. Call connected - should also maintain the mapping
+	connectEvent, err := client.parseEvent("21.09.25 15:30:50;CONNECT;0;1;123456789;987654321")
+	if err != nil {
+		t.Fatalf("Failed to parse CONNECT event: %v", err)
+	}
+
+	if connectEvent.Line != 0 {
+		t.Errorf("CONNECT: Expected ID '0', got '%d'", connectEvent.Line)
+	}
+
+	// 3. Call disconnected - should use stored LineID based on ID
+	disconnectEvent, err := client.parseEvent("21.09.25 15:35:00;DISCONNECT;0;235;")
+	if err != nil {
+		t.Fatalf("Failed to parse DISCONNECT event: %v", err)
+	}
+
+	if disconnectEvent.Line != 0 {
+		t.Errorf("DISCONNECT: Expected ID '0', got '%d'", disconnectEvent.Line)
+	}
+	if disconnectEvent.Trunk != "SIP0" {
+		t.Errorf("DISCONNECT: Expected Trunk 'SIP0' (from stored mapping), got '%s'", disconnectEvent.Trunk)
+	}
+	if disconnectEvent.Duration != 235 {
+		t.Errorf("DISCONNECT: Expected Duration 235, got %d", disconnectEvent.Duration)
+	}
+
+	// 4. Verify mapping was cleaned up
+	if client.calls.count() != 0 {
+		t.Errorf("Expected no active calls after disconnect, but has %d entries", client.calls.count())
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "30", MSNs: []string{"990133", "990134"}})
+
+	tests := []struct {
+		name        string
+		input       string
+		expectError bool
+	}{
+		{
+			name:  "valid timestamp",
+			input: "21.09.25 15:30:45",
+		},
+		{
+			name:  "valid timestamp with different time",
+			input: "21.12.31 23:59:59",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := client.parseTimestamp(tt.input)
+
+			if tt.expectError && err == nil {
+				t.Error("Expected error, but got none")
+				return
+			}
+
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+				return
+			}
+
+			if !tt.expectError {
+				// Check that we got a reasonable timestamp
+				if result.IsZero() {
+					t.Error("Expected non-zero timestamp")
+				}
+
+				// Should be within reasonable bounds (not too far in future/past)
+				now := time.Now()
+				// Allow for a wider range since we're dealing with Fritz!Box timestamp format
+				if result.After(now.Add(10*365*24*time.Hour)) || result.Before(now.Add(-50*365*24*time.Hour)) {
+					t.Errorf("Timestamp seems unreasonable: %v", result)
+				}
+			}
+		})
+	}
+}
+
+func TestCallIDToLineIDMapping(t *testing.T) {
+	client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "30", MSNs: []string{"990133", "990134"}})
+
+	// First, simulate an incoming call (RING) that establishes the ID-to-LineID mapping
+	ringEvent, err := client.parseEvent("09.09.25 13:50:00;RING;0;123456789;987654321;SIP0")
+	if err != nil {
+		t.Fatalf("Failed to parse RING event: %v", err)
+	}
+
+	// Verify the RING event has the correct data
+	if ringEvent.Line != 0 {
+		t.Errorf("RING: Expected ID '0', got '%d'", ringEvent.Line)
+	}
+	if ringEvent.Trunk != "SIP0" {
+		t.Errorf("RING: Expected Trunk 'SIP0', got '%s'", ringEvent.Trunk)
+	}
+
+	// Now simulate the corresponding DISCONNECT with the same ID
+	disconnectEvent, err := client.parseEvent("09.09.25 13:51:39;DISCONNECT;0;7;")
+	if err != nil {
+		t.Fatalf("Failed to parse DISCONNECT event: %v", err)
+	}
+
+	// Verify the DISCONNECT event now has the LineID from the RING event
+	if disconnectEvent.Line != 0 {
+		t.Errorf("DISCONNECT: Expected ID '0', got '%d'", disconnectEvent.Line)
+	}
+	if disconnectEvent.Trunk != "SIP0" {
+		t.Errorf("DISCONNECT: Expected Trunk 'SIP0' (from RING), got '%s'", disconnectEvent.Trunk)
+	}
+	if disconnectEvent.Duration != 7 {
+		t.Errorf("DISCONNECT: Expected Duration 7, got %d", disconnectEvent.Duration)
+	}
+
+	// Verify the mapping has been cleaned up after DISCONNECT
+	if client.calls.count() != 0 {
+		t.Errorf("Expected no active calls after DISCONNECT, but has %d entries", client.calls.count())
+	}
+}
+
+func TestMultipleCallIDMappings(t *testing.T) {
+	client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "30", MSNs: []string{"990133", "990134"}})
+
+	// Simulate multiple concurrent calls
+	// Call 1: RING
+	_, err := client.parseEvent("09.09.25 13:50:00;RING;0;111111111;222222222;SIP0")
+	if err != nil {
+		t.Fatalf("Failed to parse RING event for call 0: %v", err)
+	}
+
+	// Call 2: CALL (outgoing)
+	_, err = client.parseEvent("09.09.25 13:50:30;CALL;1;2;333333333;444444444;SIP1")
+	if err != nil {
+		t.Fatalf("Failed to parse CALL event for call 1: %v", err)
+	}
+
+	// Verify both mappings are stored
+	if client.calls.count() != 2 {
+		t.Errorf("Expected 2 active calls, got %d", client.calls.count())
+	}
+
+	// End call 0
+	disconnect0, err := client.parseEvent("09.09.25 13:51:00;DISCONNECT;0;60;")
+	if err != nil {
+		t.Fatalf("Failed to parse DISCONNECT event for call 0: %v", err)
+	}
+
+	if disconnect0.Trunk != "SIP0" {
+		t.Errorf("DISCONNECT call 0: Expected Trunk 'SIP0', got '%s'", disconnect0.Trunk)
+	}
+
+	// Verify only one mapping remains
+	if client.calls.count() != 1 {
+		t.Errorf("Expected 1 active call after first DISCONNECT, got %d", client.calls.count())
+	}
+
+	// End call 1
+	disconnect1, err := client.parseEvent("09.09.25 13:52:00;DISCONNECT;1;90;")
+	if err != nil {
+		t.Fatalf("Failed to parse DISCONNECT event for call 1: %v", err)
+	}
+
+	if disconnect1.Trunk != "SIP1" {
+		t.Errorf("DISCONNECT call 1: Expected Trunk 'SIP1', got '%s'", disconnect1.Trunk)
+	}
+
+	// Verify all mappings are cleaned up
+	if client.calls.count() != 0 {
+		t.Errorf("Expected 0 active calls after all DISCONNECTs, got %d", client.calls.count())
+	}
+}
+
+func TestTimezoneHandling(t *testing.T) {
+	// Create client with Berlin timezone
+	berlinTZ, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("Failed to load Berlin timezone: %v", err)
+	}
+
+	client := newTestClient(t, Options{Host: "test.host", Timezone: berlinTZ, CountryCode: "49", LocalAreaCode: "30", MSNs: []string{"990133", "990134"}})
+
+	// Test parsing timestamp with Berlin timezone
+	result, err := client.parseTimestamp("21.09.25 15:30:45")
+	if err != nil {
+		t.Fatalf("Failed to parse timestamp: %v", err)
+	}
+
+	// Check that the timestamp was parsed with the correct timezone
+	expectedLocation := berlinTZ
+	if result.Location() != expectedLocation {
+		t.Errorf("Expected timezone %v, got %v", expectedLocation, result.Location())
+	}
+
+	// Test with UTC timezone
+	utcClient := newTestClient(t, Options{Host: "test.host", Timezone: time.UTC, CountryCode: "49", LocalAreaCode: "30", MSNs: []string{"990133", "990134"}})
+	utcResult, err := utcClient.parseTimestamp("21.09.25 15:30:45")
+	if err != nil {
+		t.Fatalf("Failed to parse timestamp with UTC: %v", err)
+	}
+
+	if utcResult.Location() != time.UTC {
+		t.Errorf("Expected UTC timezone, got %v", utcResult.Location())
+	}
+}
+
+func TestCallIDTracking(t *testing.T) {
+	client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "30", MSNs: []string{"990133", "990134"}})
+
+	// Test RING event generates UUID v7
+	ringEvent, err := client.parseEvent("21.09.25 15:30:45;RING;0;123456789;987654321;SIP0")
+	if err != nil {
+		t.Fatalf("Failed to parse RING event: %v", err)
+	}
+
+	// Verify UUID is generated and valid
+	if ringEvent.ID == "" {
+		t.Error("Expected UUID to be generated for RING event")
+	}
+
+	if len(ringEvent.ID) != 36 { // UUID format: xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx
+		t.Errorf("Expected UUID format, got ID length %d: %s", len(ringEvent.ID), ringEvent.ID)
+	}
+
+	// Store the UUID for comparison
+	originalID := ringEvent.ID
+
+	// Test CONNECT event reuses the same UUID
+	connectEvent, err := client.parseEvent("21.09.25 15:30:50;CONNECT;0;1;123456789;987654321")
+	if err != nil {
+		t.Fatalf("Failed to parse CONNECT event: %v", err)
+	}
+
+	if connectEvent.ID != originalID {
+		t.Errorf("Expected CONNECT event to reuse UUID %s, got %s", originalID, connectEvent.ID)
+	}
+
+	// Test DISCONNECT event reuses the same UUID
+	disconnectEvent, err := client.parseEvent("21.09.25 15:35:00;DISCONNECT;0;235;")
+	if err != nil {
+		t.Fatalf("Failed to parse DISCONNECT event: %v", err)
+	}
+
+	if disconnectEvent.ID != originalID {
+		t.Errorf("Expected DISCONNECT event to reuse UUID %s, got %s", originalID, disconnectEvent.ID)
+	}
+
+	// Verify mapping was cleaned up after DISCONNECT
+	if client.calls.count() != 0 {
+		t.Errorf("Expected no active calls after DISCONNECT, but has %d entries", client.calls.count())
+	}
+}
+
+func TestUniqueCallIDs(t *testing.T) {
+	client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "30", MSNs: []string{"990133", "990134"}})
+
+	// Generate multiple RING events to verify unique IDs
+	var callIDs []string
+	for i := 0; i < 5; i++ {
+		lineID := i
+		event, err := client.parseEvent(fmt.Sprintf("21.09.25 15:30:45;RING;%d;123456789;987654321;SIP%d", lineID, lineID))
+		if err != nil {
+			t.Fatalf("Failed to parse RING event %d: %v", i, err)
+		}
+
+		callIDs = append(callIDs, event.ID)
+
+		// Verify UUID v7 format (starts with time-based component)
+		if event.ID == "" {
+			t.Errorf("Call %d: Expected UUID to be generated", i)
+		}
+
+		// Verify UUID v7 format (36 characters with dashes)
+		if len(event.ID) != 36 {
+			t.Errorf("Call %d: Expected UUID format (36 chars), got %d chars: %s", i, len(event.ID), event.ID)
+		}
+	}
+
+	// Verify all IDs are unique
+	uniqueIDs := make(map[string]bool)
+	for i, id := range callIDs {
+		if uniqueIDs[id] {
+			t.Errorf("Duplicate UUID found: %s (call %d)", id, i)
+		}
+		uniqueIDs[id] = true
+	}
+
+	if len(uniqueIDs) != 5 {
+		t.Errorf("Expected 5 unique UUIDs, got %d", len(uniqueIDs))
+	}
+}
+
+func TestUUIDv7Ordering(t *testing.T) {
+	client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "30", MSNs: []string{"990133", "990134"}})
+
+	// Generate UUIDs with small time delays to test temporal ordering
+	var events []types.CallEvent
+	for i := 0; i < 3; i++ {
+		event, err := client.parseEvent(fmt.Sprintf("21.09.25 15:30:45;RING;%d;123456789;987654321;SIP%d", i, i))
+		if err != nil {
+			t.Fatalf("Failed to parse RING event %d: %v", i, err)
+		}
+		events = append(events, *event)
+
+		// Small delay to ensure different timestamps in UUID v7
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	// UUIDs should be lexicographically sortable due to time-based prefix in UUID v7
+	// This means UUID[0] < UUID[1] < UUID[2] lexicographically
+	for i := 1; i < len(events); i++ {
+		if events[i-1].ID >= events[i].ID {
+			// Note: This might occasionally fail due to system clock precision,
+			// but generally UUID v7 should provide temporal ordering
+			t.Logf("UUID ordering note: %s >= %s (this is acceptable for UUID v7 in rapid succession)",
+				events[i-1].ID, events[i].ID)
+		}
+	}
+
+	// Just verify they're all different
+	for i := 0; i < len(events); i++ {
+		for j := i + 1; j < len(events); j++ {
+			if events[i].ID == events[j].ID {
+				t.Errorf("UUIDs should be unique: %s == %s", events[i].ID, events[j].ID)
+			}
+		}
+	}
+}
+
+func TestExtensionNames(t *testing.T) {
+	client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "6181", ExtensionNames: map[string]string{"1": "Kitchen", "20": "Office"}})
+
+	tests := []struct {
+		message  string
+		expected string
+	}{
+		{"09.09.25 15:30:45;CALL;0;20;6181990133;0123456789;SIP0", "Office"},
+		{"09.09.25 15:31:00;RING;1;+49123456789;+496181990133;SIP0", ""},
+		{"09.09.25 15:31:05;CONNECT;1;1;+49123456789", "Kitchen"},
+		{"09.09.25 15:31:10;CALL;2;3;6181990133;0123456789;SIP0", ""},
+	}
+
+	for _, tt := range tests {
+		event, err := client.parseEvent(tt.message)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", tt.message, err)
+		}
+		if event.ExtensionName != tt.expected {
+			t.Errorf("%q: ExtensionName = %q, expected %q", tt.message, event.ExtensionName, tt.expected)
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	rules, err := types.ParseTagRules([]string{"spam:prefix=+49900", "office:msn=990133"})
+	if err != nil {
+		t.Fatalf("ParseTagRules failed: %v", err)
+	}
+	client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "6181", MSNs: []string{"990133"}, Tagger: types.NewTagger(rules, nil)})
+
+	// Tags are decided at RING and carried by the later events of the call
+	for _, message := range []string{
+		"09.09.25 15:31:00;RING;1;0900123456;6181990133;SIP0",
+		"09.09.25 15:31:05;CONNECT;1;1;0900123456",
+		"09.09.25 15:31:10;DISCONNECT;1;5",
+	} {
+		event, err := client.parseEvent(message)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", message, err)
+		}
+		if len(event.Tags) != 2 || event.Tags[0] != "office" || event.Tags[1] != "spam" {
+			t.Errorf("%q: Tags = %v, expected [office spam]", message, event.Tags)
+		}
+	}
+
+	event, err := client.parseEvent("09.09.25 15:32:00;CALL;2;1;6181111111;030123456;SIP0")
+	if err != nil {
+		t.Fatalf("Failed to parse CALL: %v", err)
+	}
+	if len(event.Tags) != 0 {
+		t.Errorf("Expected no tags of an untagged call, got %v", event.Tags)
+	}
+}
+
+func TestVIPPriority(t *testing.T) {
+	groups := map[string][]string{"+4930222222": {"family"}}
+	vips := types.NewVIPList([]string{"+4930123456"}, []string{"family"}, groups)
+	client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "6181", VIPs: vips})
+
+	// Priority is decided at RING and carried by the later events of the call
+	for _, message := range []string{
+		"09.09.25 15:31:00;RING;1;030123456;6181990133;SIP0",
+		"09.09.25 15:31:05;CONNECT;1;1;030123456",
+		"09.09.25 15:31:10;DISCONNECT;1;5",
+		"09.09.25 15:32:00;RING;2;030222222;6181990133;SIP0",
+	} {
+		event, err := client.parseEvent(message)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", message, err)
+		}
+		if !event.Priority {
+			t.Errorf("%q: expected priority", message)
+		}
+	}
+
+	for _, message := range []string{
+		"09.09.25 15:33:00;RING;3;030333333;6181990133;SIP0",
+		"09.09.25 15:34:00;CALL;4;1;6181990133;030123456;SIP0",
+	} {
+		event, err := client.parseEvent(message)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", message, err)
+		}
+		if event.Priority {
+			t.Errorf("%q: expected no priority", message)
+		}
+	}
+}
+
+func TestNumberType(t *testing.T) {
+	client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "6181"})
+
+	// The type of the other party is decided at RING or CALL and carried by the later events
+	tests := []struct {
+		message    string
+		called     string
+		numberType types.NumberType
+	}{
+		{"09.09.25 15:31:00;RING;1;01784567890;990133;SIP0", "+496181990133", types.NumberTypeMobile},
+		{"09.09.25 15:31:05;CONNECT;1;1;01784567890", "+496181990133", types.NumberTypeMobile},
+		{"09.09.25 15:32:00;CALL;2;1;990133;112;SIP0", "112", types.NumberTypeEmergency},
+		{"09.09.25 15:32:10;DISCONNECT;2;0", "112", types.NumberTypeEmergency},
+		{"09.09.25 15:33:00;CALL;3;1;990133;09001234567;SIP0", "09001234567", types.NumberTypePremium},
+		{"09.09.25 15:34:00;CALL;4;1;990133;**610;SIP0", "**610", ""},
+	}
+	for _, tt := range tests {
+		event, err := client.parseEvent(tt.message)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", tt.message, err)
+		}
+		if event.Called != tt.called || event.NumberType != tt.numberType {
+			t.Errorf("%q: expected %s of type %q, got %s of type %q", tt.message, tt.called, tt.numberType, event.Called, event.NumberType)
+		}
+	}
+}
+
+func TestCallForwarding(t *testing.T) {
+	client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "6181", Timezone: time.UTC, ForwardExtensions: []string{"99"}})
+
+	messages := []string{
+		"09.09.25 15:30:00;RING;0;0301234567;990133;SIP0",
+		"09.09.25 15:30:02;CALL;1;99;990133;01784567890;SIP0", // Fritz!Box forwarding the RING
+		"09.09.25 15:30:05;CONNECT;1;99;01784567890",
+		"09.09.25 15:30:30;DISCONNECT;0;0",
+		"09.09.25 15:30:30;DISCONNECT;1;25",
+		"09.09.25 15:31:00;RING;0;0301234567;990133;SIP0",
+		"09.09.25 15:31:10;CALL;1;99;990133;01784567890;SIP0", // Outside the forward window
+		"09.09.25 15:31:20;DISCONNECT;0;0",
+		"09.09.25 15:31:20;DISCONNECT;1;0",
+		"09.09.25 15:32:00;RING;0;0301234567;990133;SIP0",
+		"09.09.25 15:32:02;CALL;1;1;0301234567;01784567890;SIP0", // Forwarding presenting the caller's number
+	}
+	var events []*types.CallEvent
+	for _, message := range messages {
+		event, err := client.parseEvent(message)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", message, err)
+		}
+		events = append(events, event)
+	}
+
+	ring := events[0]
+	if ring.Forwarded || ring.ForwardedTo != "" {
+		t.Errorf("Expected the RING not to be forwarded yet, got %t, %q", ring.Forwarded, ring.ForwardedTo)
+	}
+	for _, event := range events[1:3] {
+		if !event.Forwarded || event.ParentCallID != ring.ID || event.ID == ring.ID {
+			t.Errorf("Expected %s to be the forward of call %s, got %t, %q", event.Type, ring.ID, event.Forwarded, event.ParentCallID)
+		}
+	}
+	if inbound := events[3]; !inbound.Forwarded || inbound.ForwardedTo != "+491784567890" || inbound.ParentCallID != "" {
+		t.Errorf("Expected the inbound call forwarded to +491784567890, got %t, %q, %q", inbound.Forwarded, inbound.ForwardedTo, inbound.ParentCallID)
+	}
+	if late := events[6]; late.Forwarded || late.ParentCallID != "" {
+		t.Errorf("Expected a CALL after the forward window not to be linked, got %t, %q", late.Forwarded, late.ParentCallID)
+	}
+	if clip := events[10]; !clip.Forwarded || clip.ParentCallID != events[9].ID {
+		t.Errorf("Expected a CALL with the number of the caller to be the forward of call %s, got %t, %q", events[9].ID, clip.Forwarded, clip.ParentCallID)
+	}
+
+	disabled := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "6181", Timezone: time.UTC, ForwardWindow: -1, ForwardExtensions: []string{"99"}})
+	for _, message := range messages[:2] {
+		event, err := disabled.parseEvent(message)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", message, err)
+		}
+		if event.Forwarded {
+			t.Errorf("%q: expected no forwarding while disabled", message)
+		}
+	}
+}
+
+func TestCallForwardingIgnoresDialedCalls(t *testing.T) {
+	client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "6181", Timezone: time.UTC, ForwardExtensions: []string{"99"}})
+
+	// Someone dials out on another handset from the MSN that is ringing
+	var events []*types.CallEvent
+	for _, message := range []string{
+		"09.09.25 15:30:00;RING;0;0301234567;990133;SIP0",
+		"09.09.25 15:30:02;CALL;1;1;990133;01784567890;SIP0",
+		"09.09.25 15:30:05;CONNECT;1;1;01784567890",
+		"09.09.25 15:30:20;DISCONNECT;0;0",
+	} {
+		event, err := client.parseEvent(message)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", message, err)
+		}
+		events = append(events, event)
+	}
+
+	for _, event := range events[1:3] {
+		if event.Forwarded || event.ParentCallID != "" {
+			t.Errorf("Expected the dialed %s not to be linked, got %t, %q", event.Type, event.Forwarded, event.ParentCallID)
+		}
+	}
+	if inbound := events[3]; inbound.Forwarded || inbound.ForwardedTo != "" {
+		t.Errorf("Expected the ringing call not to be forwarded, got %t, %q", inbound.Forwarded, inbound.ForwardedTo)
+	}
+}
+
+func TestReload(t *testing.T) {
+	client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "6181", MSNs: []string{"990133"}, ExtensionNames: map[string]string{"1": "Kitchen"}})
+
+	event, err := client.parseEvent("09.09.25 15:31:00;RING;1;0900123456;6181990134;SIP0")
+	if err != nil {
+		t.Fatalf("Failed to parse RING: %v", err)
+	}
+	if event.CalledMSN != "" {
+		t.Errorf("Expected no MSN before the reload, got %q", event.CalledMSN)
+	}
+
+	rules, err := types.ParseTagRules([]string{"spam:prefix=+49900"})
+	if err != nil {
+		t.Fatalf("ParseTagRules failed: %v", err)
+	}
+	client.Reload(Settings{MSNs: []string{"990134"}, ExtensionNames: map[string]string{"1": "Office"}, Tagger: types.NewTagger(rules, nil)})
+
+	// The running call keeps its tags, but later lines use the new names
+	event, err = client.parseEvent("09.09.25 15:31:05;CONNECT;1;1;0900123456")
+	if err != nil {
+		t.Fatalf("Failed to parse CONNECT: %v", err)
+	}
+	if event.CalledMSN != "990134" || event.ExtensionName != "Office" || len(event.Tags) != 0 {
+		t.Errorf("Expected MSN 990134, extension Office and no tags, got %q, %q and %v", event.CalledMSN, event.ExtensionName, event.Tags)
+	}
+
+	event, err = client.parseEvent("09.09.25 15:32:00;RING;2;0900123456;6181990134;SIP0")
+	if err != nil {
+		t.Fatalf("Failed to parse RING: %v", err)
+	}
+	if len(event.Tags) != 1 || event.Tags[0] != "spam" {
+		t.Errorf("Expected the new call tagged spam, got %v", event.Tags)
+	}
+}
+
+func TestTrunkNamesAndFilter(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		// A fax call on the ignored trunk, then a call on the named trunk
+		_, _ = conn.Write([]byte("21.09.25 15:30:45;RING;0;0178123456789;990133;SIP3;\n"))
+		_, _ = conn.Write([]byte("21.09.25 15:30:50;CONNECT;0;5;0178123456789;\n"))
+		_, _ = conn.Write([]byte("21.09.25 15:30:55;RING;1;0178123456789;990133;SIP0;\n"))
+		<-done
+		_ = conn.Close()
+	}()
+
+	_, portStr, _ := net.SplitHostPort(listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	client := newTestClient(t, Options{
+		Host:        "127.0.0.1",
+		Port:        port,
+		CountryCode: "49",
+		TrunkNames:  map[string]string{"SIP0": "Vodafone"},
+		TrunkFilter: types.NewTrunkFilter(nil, []string{"SIP3"}),
+		Clock:       clock.NewFake(time.Date(2025, 9, 21, 15, 31, 0, 0, time.Local)),
+	})
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Disconnect()
+
+	select {
+	case event := <-client.Events():
+		if event.Line != 1 || event.TrunkName != "Vodafone" {
+			t.Errorf("Expected the call on SIP0 named Vodafone, got %+v", event)
+		}
+	case err := <-client.Errors():
+		t.Fatalf("Expected event, got error %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for event")
+	}
+}
+
+func TestMaskNumbers(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"21.09.25 15:30:45;TRANSFER;0;11;0301234567;", "21.09.25 15:30:45;TRANSFER;0;11;xxxxxxxxxx;"},
+		{"invalid callmonitor format (too few parts): 21.09.25 15:30:45;RING;+49301234567", "invalid callmonitor format (too few parts): 21.09.25 15:30:45;RING;+xxxxxxxxxxx"},
+		{"need at least 5 parts, got 3", "need at least 5 parts, got 3"},
+		{"990133", "xxxxxx"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := MaskNumbers(tt.input); got != tt.want {
+			t.Errorf("MaskNumbers(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestUnparsedLines(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		// A call type of a newer Fritz!OS, followed by a known line
+		_, _ = conn.Write([]byte("21.09.25 15:30:45;TRANSFER;0;11;0301234567;\n"))
+		_, _ = conn.Write([]byte("21.09.25 15:30:50;RING;1;0178123456789;990133;SIP0;\n"))
+		<-done
+		_ = conn.Close()
+	}()
+
+	_, portStr, _ := net.SplitHostPort(listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	now := time.Date(2025, 9, 21, 15, 31, 0, 0, time.Local)
+	client := newTestClient(t, Options{Host: "127.0.0.1", Port: port, CountryCode: "49", Clock: clock.NewFake(now)})
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Disconnect()
+
+	select {
+	case unparsed := <-client.Unparsed():
+		if unparsed.Line != "21.09.25 15:30:45;TRANSFER;0;11;xxxxxxxxxx;" || !unparsed.Time.Equal(now) || unparsed.Reason == "" {
+			t.Errorf("Unexpected unparsed line %+v", unparsed)
+		}
+	case err := <-client.Errors():
+		t.Fatalf("Expected unparsed line, got error %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for unparsed line")
+	}
+
+	// The connection is kept and later lines are processed
+	select {
+	case event := <-client.Events():
+		if event.Line != 1 {
+			t.Errorf("Expected the RING on line 1, got %+v", event)
+		}
+	case err := <-client.Errors():
+		t.Fatalf("Expected event, got error %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for event")
+	}
+}
+
+func TestExtensionFilter(t *testing.T) {
+	filter, err := types.NewExtensionFilter([]string{"990133", "**620"}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create filter: %v", err)
+	}
+	client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "6181", Timezone: time.UTC, ExtensionFilter: filter})
+
+	tests := []struct {
+		message   string
+		delivered bool
+	}{
+		{"09.09.25 15:30:00;RING;0;+49123456789;+496181990133;SIP0", true},
+		{"09.09.25 15:30:00;RING;1;+49123456789;+496181990134;SIP0", false},
+		{"09.09.25 15:30:05;CONNECT;1;11;+49123456789", false},
+		{"09.09.25 15:30:06;CALL;2;20;+496181990134;+49987654321;SIP0", true},
+		{"09.09.25 15:30:07;CALL;3;21;+496181990134;+49987654321;SIP0", false},
+		{"09.09.25 15:30:40;DISCONNECT;1;35", false},
+		{"09.09.25 15:30:41;DISCONNECT;0;0", true},
+		{"09.09.25 15:30:42;DISCONNECT;3;0", false},
+	}
+
+	for _, tt := range tests {
+		event, err := client.parseEvent(tt.message)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", tt.message, err)
+		}
+		if (event != nil) != tt.delivered {
+			t.Errorf("Expected %q delivered=%v, got %v", tt.message, tt.delivered, event != nil)
+		}
+	}
+	if client.calls.count() != 1 {
+		t.Errorf("Expected only the allowed CALL to remain active, got %d calls", client.calls.count())
+	}
+}
+
+func TestOnRingBeforeDelivery(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		_, _ = conn.Write([]byte("21.09.25 15:30:45;CALL;1;21;990133;0178123456789;SIP0;\n"))
+		_, _ = conn.Write([]byte("21.09.25 15:30:50;RING;0;0178123456789;990133;SIP0;\n"))
+		<-done
+		_ = conn.Close()
+	}()
+
+	_, portStr, _ := net.SplitHostPort(listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	rings := make(chan types.CallEvent, 2)
+	client := newTestClient(t, Options{
+		Host:        "127.0.0.1",
+		Port:        port,
+		CountryCode: "49",
+		Clock:       clock.NewFake(time.Date(2025, 9, 21, 15, 31, 0, 0, time.Local)),
+		OnRing:      func(event types.CallEvent) { rings <- event },
+	})
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Disconnect()
+
+	for _, expected := range []types.CallType{types.CallTypeCall, types.CallTypeRing} {
+		select {
+		case event := <-client.Events():
+			if event.Type != expected {
+				t.Fatalf("Expected %s event, got %s", expected, event.Type)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for event")
+		}
+	}
+
+	// The callback ran before the RING was delivered, so it is already queued
+	select {
+	case ring := <-rings:
+		if ring.Type != types.CallTypeRing || ring.Line != 0 {
+			t.Errorf("Expected the RING on line 0, got %+v", ring)
+		}
+	default:
+		t.Fatal("Expected OnRing to be called")
+	}
+	if len(rings) != 0 {
+		t.Errorf("Expected OnRing to be called for RING events only, got %d more calls", len(rings))
+	}
+}
+
+func TestStrictUnknownDisconnect(t *testing.T) {
+	client := newTestClient(t, Options{Host: "test.host", Timezone: time.UTC, Strict: true})
+
+	events := parseAll(t, client,
+		"09.09.25 15:30:00;RING;0;+49123456789;+496181990133;SIP0",
+		"09.09.25 15:30:10;DISCONNECT;0;0",
+	)
+	if len(events) != 2 || events[1].Trunk != "SIP0" {
+		t.Fatalf("Expected the known call to be completed, got %+v", events)
+	}
+
+	if _, err := client.parseEvent("09.09.25 15:30:20;DISCONNECT;1;0"); !errors.Is(err, ErrUnknownCall) {
+		t.Errorf("Expected ErrUnknownCall in strict mode, got %v", err)
+	}
+
+	lenient := newTestClient(t, Options{Host: "test.host", Timezone: time.UTC})
+	event, err := lenient.parseEvent("09.09.25 15:30:20;DISCONNECT;1;0")
+	if err != nil || event == nil || event.Trunk != "" {
+		t.Errorf("Expected the DISCONNECT delivered without trunk, got %+v, %v", event, err)
+	}
+}
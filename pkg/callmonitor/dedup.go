@@ -0,0 +1,50 @@
+package callmonitor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+)
+
+// deduplicator remembers recently received callmonitor lines. A line carries
+// the Fritz!Box timestamp of the event, so a line seen twice is the same event
+// delivered again, e.g. resent by the box after a reconnect.
+type deduplicator struct {
+	mu     sync.Mutex
+	window time.Duration
+	clock  clock.Clock
+	seen   map[string]time.Time // Raw line -> time it was first received
+}
+
+// newDeduplicator creates a deduplicator; a window <= 0 disables it
+func newDeduplicator(window time.Duration, clk clock.Clock) *deduplicator {
+	return &deduplicator{
+		window: window,
+		clock:  clk,
+		seen:   make(map[string]time.Time),
+	}
+}
+
+// Duplicate records the line and reports whether it was already received within the window
+func (d *deduplicator) Duplicate(line string) bool {
+	if d.window <= 0 {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	now := d.clock.Now()
+	for key, received := range d.seen {
+		if now.Sub(received) >= d.window {
+			delete(d.seen, key)
+		}
+	}
+
+	if _, ok := d.seen[line]; ok {
+		return true
+	}
+	d.seen[line] = now
+	return false
+}
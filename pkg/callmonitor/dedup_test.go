@@ -0,0 +1,104 @@
+package callmonitor
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+func TestDeduplicator(t *testing.T) {
+	clk := clock.NewFake(time.Date(2025, 9, 21, 15, 35, 0, 0, time.UTC))
+	dedup := newDeduplicator(time.Minute, clk)
+
+	ring := "21.09.25 15:35:00;RING;0;0178123456789;990133;SIP0;"
+	steps := []struct {
+		advance   time.Duration
+		line      string
+		duplicate bool
+	}{
+		{0, ring, false},
+		{0, "21.09.25 15:35:04;CONNECT;0;1;0178123456789;", false},
+		{10 * time.Second, ring, true},
+		{time.Minute, ring, false}, // Forgotten after the window
+		{0, "21.09.25 15:36:10;RING;0;0178123456789;990133;SIP0;", false},
+	}
+
+	for i, step := range steps {
+		clk.Advance(step.advance)
+		if duplicate := dedup.Duplicate(step.line); duplicate != step.duplicate {
+			t.Errorf("Step %d: expected duplicate=%t, got %t", i, step.duplicate, duplicate)
+		}
+	}
+
+	if disabled := newDeduplicator(-1, clk); disabled.Duplicate(ring) || disabled.Duplicate(ring) {
+		t.Error("Expected disabled deduplicator to pass all lines")
+	}
+}
+
+func TestDuplicateLinesAcrossReconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	// The box resends the CONNECT line on the second connection
+	sessions := [][]string{
+		{"21.09.25 15:35:00;RING;0;0178123456789;990133;SIP0;", "21.09.25 15:35:04;CONNECT;0;1;0178123456789;"},
+		{"21.09.25 15:35:04;CONNECT;0;1;0178123456789;", "21.09.25 15:35:16;DISCONNECT;0;12;"},
+	}
+	go func() {
+		for _, lines := range sessions {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			for _, line := range lines {
+				_, _ = conn.Write([]byte(line + "\n"))
+			}
+			_ = conn.Close()
+		}
+	}()
+
+	_, portStr, _ := net.SplitHostPort(listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	client := newTestClient(t, Options{Host: "127.0.0.1", Port: port, Timezone: time.UTC})
+
+	var events []types.CallEvent
+	for range sessions {
+		if err := client.Connect(context.Background()); err != nil {
+			t.Fatalf("Connect failed: %v", err)
+		}
+	collect:
+		for {
+			select {
+			case event := <-client.Events():
+				events = append(events, event)
+			case <-client.Errors():
+				// Connection closed by the fake box
+				break collect
+			case <-time.After(5 * time.Second):
+				t.Fatal("Timed out waiting for events")
+			}
+		}
+		_ = client.Disconnect()
+	}
+
+	expected := []types.CallType{types.CallTypeRing, types.CallTypeConnect, types.CallTypeDisconnect}
+	if len(events) != len(expected) {
+		t.Fatalf("Expected %d events, got %d: %+v", len(expected), len(events), events)
+	}
+	for i, event := range events {
+		if event.Type != expected[i] {
+			t.Errorf("Event %d: expected %s, got %s", i, expected[i], event.Type)
+		}
+		if event.ID != events[0].ID {
+			t.Errorf("Event %d: expected call ID %s, got %s", i, events[0].ID, event.ID)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package callmonitor
+
+import (
+	"testing"
+)
+
+func TestDoNotRecordFlagIsKeptForWholeCall(t *testing.T) {
+	client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "6181", MSNs: []string{"990133", "990134"}, DoNotRecord: []string{"990133"}})
+
+	messages := []string{
+		"09.09.25 15:30:45;RING;0;+49123456789;+496181990133;SIP0",
+		"09.09.25 15:30:50;CONNECT;0;23;+49123456789",
+		"09.09.25 15:33:45;DISCONNECT;0;175",
+	}
+
+	for _, message := range messages {
+		event, err := client.parseEvent(message)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", message, err)
+		}
+		if !event.DoNotRecord {
+			t.Errorf("Expected %s event to be flagged as do-not-record", event.Type)
+		}
+	}
+
+	// The next call on the same line involves a consenting MSN
+	event, err := client.parseEvent("09.09.25 15:40:00;RING;0;+49123456789;+496181990134;SIP0")
+	if err != nil {
+		t.Fatalf("Failed to parse RING event: %v", err)
+	}
+	if event.DoNotRecord {
+		t.Error("Expected flag of the previous call to be cleared")
+	}
+}
+
+func TestDoNotRecordByExtension(t *testing.T) {
+	client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "6181", DoNotRecord: []string{"23"}})
+
+	ring, err := client.parseEvent("09.09.25 15:30:45;RING;1;+49123456789;+496181990133;SIP0")
+	if err != nil {
+		t.Fatalf("Failed to parse RING event: %v", err)
+	}
+	if ring.DoNotRecord {
+		t.Error("RING is not yet bound to an extension and must not be flagged")
+	}
+
+	// Answered by the opted-out extension
+	connect, err := client.parseEvent("09.09.25 15:30:50;CONNECT;1;23;+49123456789")
+	if err != nil {
+		t.Fatalf("Failed to parse CONNECT event: %v", err)
+	}
+	if !connect.DoNotRecord {
+		t.Error("Expected CONNECT on opted-out extension to be flagged")
+	}
+
+	disconnect, err := client.parseEvent("09.09.25 15:31:50;DISCONNECT;1;60")
+	if err != nil {
+		t.Fatalf("Failed to parse DISCONNECT event: %v", err)
+	}
+	if !disconnect.DoNotRecord {
+		t.Error("Expected DISCONNECT to inherit the flag from CONNECT")
+	}
+}
+
+func TestDoNotRecordDisabledByDefault(t *testing.T) {
+	client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "6181", MSNs: []string{"990133"}})
+
+	event, err := client.parseEvent("09.09.25 15:30:45;CALL;2;21;+496181990133;+49123456789;SIP2")
+	if err != nil {
+		t.Fatalf("Failed to parse CALL event: %v", err)
+	}
+	if event.DoNotRecord {
+		t.Error("Expected no do-not-record flag without configuration")
+	}
+}
@@ -0,0 +1,23 @@
+// Package callmonitor connects to the Fritz!Box callmonitor (TCP port 1012)
+// and parses its RING/CALL/CONNECT/DISCONNECT lines into types.CallEvent.
+//
+// Phone numbers are normalized to E.164 and calls on the same connection ID
+// share a UUID v7, so events of one call can be correlated. Lines received
+// twice within Options.DuplicateWindow, e.g. resent by the box after a
+// reconnect, are dropped before parsing:
+//
+//	client, err := callmonitor.NewClient(callmonitor.Options{
+//		Host:          "fritz.box",
+//		CountryCode:   "49",
+//		LocalAreaCode: "30",
+//	})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	if err := client.Connect(ctx); err != nil {
+//		log.Fatal(err)
+//	}
+//	for event := range client.Events() {
+//		fmt.Println(event.Type, event.Caller, event.Called)
+//	}
+package callmonitor
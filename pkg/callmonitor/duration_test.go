@@ -0,0 +1,49 @@
+package callmonitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+)
+
+func TestMeasuredDuration(t *testing.T) {
+	tests := []struct {
+		name       string
+		talk       time.Duration // Local time between CONNECT and DISCONNECT
+		disconnect string
+		measured   int
+		mismatch   bool
+	}{
+		{"matching", 35 * time.Second, "09.09.25 15:30:40;DISCONNECT;0;35", 35, false},
+		{"within tolerance", 37 * time.Second, "09.09.25 15:30:40;DISCONNECT;0;35", 37, false},
+		{"off by an hour", 35 * time.Second, "09.09.25 15:30:40;DISCONNECT;0;3635", 35, true},
+		{"never connected", 0, "09.09.25 15:30:40;DISCONNECT;0;0", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := clock.NewFake(time.Date(2025, 9, 9, 15, 30, 0, 0, time.UTC))
+			client := newTestClient(t, Options{Host: "test.host", Timezone: time.UTC, Clock: fake})
+
+			messages := []string{"09.09.25 15:30:00;RING;0;+49123456789;+496181990133;SIP0"}
+			if tt.talk > 0 {
+				messages = append(messages, "09.09.25 15:30:05;CONNECT;0;1;+49123456789")
+			}
+			for _, message := range messages {
+				if _, err := client.parseEvent(message); err != nil {
+					t.Fatalf("Failed to parse %q: %v", message, err)
+				}
+			}
+
+			fake.Advance(tt.talk)
+			event, err := client.parseEvent(tt.disconnect)
+			if err != nil {
+				t.Fatalf("Failed to parse %q: %v", tt.disconnect, err)
+			}
+			if event.MeasuredDuration != tt.measured || event.DurationMismatch != tt.mismatch {
+				t.Errorf("Expected measured %ds (mismatch %v), got %ds (mismatch %v)", tt.measured, tt.mismatch, event.MeasuredDuration, event.DurationMismatch)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package callmonitor
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"time"
+)
+
+// FailureKind classifies why connecting to the callmonitor failed
+type FailureKind string
+
+const (
+	FailureRefused FailureKind = "refused" // The Fritz!Box is up, but its callmonitor port is closed
+	FailureTimeout FailureKind = "timeout" // No answer in time, e.g. while the Fritz!Box reboots
+	FailureDNS     FailureKind = "dns"     // The host name could not be resolved
+	FailureOther   FailureKind = "other"
+)
+
+// ConnectFailure describes a failed connect to the callmonitor
+type ConnectFailure struct {
+	Kind  FailureKind `json:"kind"`
+	Error string      `json:"error"`
+	Hint  string      `json:"hint,omitempty"`
+	Time  time.Time   `json:"time"`
+}
+
+// NewConnectFailure classifies a connect error
+func NewConnectFailure(err error, at time.Time) ConnectFailure {
+	kind := ClassifyConnectError(err)
+	return ConnectFailure{Kind: kind, Error: err.Error(), Hint: kind.Hint(), Time: at}
+}
+
+// ClassifyConnectError tells why connecting to the callmonitor failed
+func ClassifyConnectError(err error) FailureKind {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &dnsErr):
+		return FailureDNS
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return FailureRefused
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded),
+		errors.As(err, &netErr) && netErr.Timeout():
+		return FailureTimeout
+	default:
+		return FailureOther
+	}
+}
+
+// Hint returns what the user can do about a failure of the kind
+func (k FailureKind) Hint() string {
+	switch k {
+	case FailureRefused:
+		return "the Fritz!Box refused the connection, enable the callmonitor by dialing #96*5* on a phone connected to it"
+	case FailureTimeout:
+		return "the Fritz!Box did not answer in time, check that it is running and reachable"
+	case FailureDNS:
+		return "the host name of the Fritz!Box could not be resolved, it is resolved again on every attempt"
+	default:
+		return ""
+	}
+}
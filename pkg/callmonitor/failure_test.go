@@ -0,0 +1,41 @@
+package callmonitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestClassifyConnectError(t *testing.T) {
+	// A port nobody listens on refuses the connection
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	address := listener.Addr().String()
+	_ = listener.Close()
+	_, refused := net.Dial("tcp", address)
+	if refused == nil {
+		t.Fatalf("Expected the connection to %s to be refused", address)
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want FailureKind
+	}{
+		{"refused", fmt.Errorf("failed to connect to Fritz!Box callmonitor: %w", refused), FailureRefused},
+		{"dns", &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "fritz.box", IsNotFound: true}}, FailureDNS},
+		{"timeout", fmt.Errorf("failed to connect to Fritz!Box callmonitor: %w", context.DeadlineExceeded), FailureTimeout},
+		{"other", errors.New("network is unreachable"), FailureOther},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyConnectError(tt.err); got != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
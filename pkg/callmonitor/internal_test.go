@@ -0,0 +1,47 @@
+package callmonitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInternalCalls(t *testing.T) {
+	client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "6181", Timezone: time.UTC, MSNs: []string{"610", "990133"}})
+
+	events := parseAll(t, client,
+		"09.09.25 15:30:00;RING;0;**610;**611;;",
+		"09.09.25 15:30:05;CONNECT;0;11;**610;",
+		"09.09.25 15:30:20;DISCONNECT;0;15;",
+		"09.09.25 15:31:00;RING;1;0178123456789;990133;SIP0;",
+	)
+	if len(events) != 4 {
+		t.Fatalf("Expected 4 events, got %d", len(events))
+	}
+
+	ring := events[0]
+	if ring.Caller != "**610" || ring.Called != "**611" {
+		t.Errorf("Expected the dial codes to be kept, got caller %q and called %q", ring.Caller, ring.Called)
+	}
+	if ring.CallerMSN != "" {
+		t.Errorf("Expected no MSN for an internal number, got %q", ring.CallerMSN)
+	}
+	for _, event := range events[:3] {
+		if !event.Internal {
+			t.Errorf("Expected %s of the internal call to be flagged", event.Type)
+		}
+	}
+	if events[3].Internal || events[3].Caller != "+49178123456789" || events[3].CalledMSN != "990133" {
+		t.Errorf("Expected an external call, got %+v", events[3])
+	}
+
+	ignoring := newTestClient(t, Options{Host: "test.host", CountryCode: "49", Timezone: time.UTC, IgnoreInternal: true})
+	events = parseAll(t, ignoring,
+		"09.09.25 15:30:00;RING;0;**610;**611;;",
+		"09.09.25 15:30:05;CONNECT;0;11;**610;",
+		"09.09.25 15:30:20;DISCONNECT;0;15;",
+		"09.09.25 15:31:00;RING;1;0178123456789;990133;SIP0;",
+	)
+	if len(events) != 1 || events[0].Line != 1 {
+		t.Errorf("Expected only the external call to be delivered, got %+v", events)
+	}
+}
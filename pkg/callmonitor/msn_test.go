@@ -6,7 +6,7 @@ import (
 
 func TestMSNDetectionInCallEvents(t *testing.T) {
 	msns := []string{"990133", "990134", "3698237"}
-	client := NewClient("test.host", 1012, nil, "49", "6181", msns)
+	client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "6181", MSNs: msns})
 
 	tests := []struct {
 		name           string
@@ -66,7 +66,7 @@ func TestMSNDetectionInCallEvents(t *testing.T) {
 
 func TestMSNDetectionInConnectEvents(t *testing.T) {
 	msns := []string{"990133", "990134", "3698237"}
-	client := NewClient("test.host", 1012, nil, "49", "6181", msns)
+	client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "6181", MSNs: msns})
 
 	// First simulate a RING event to set up the line mapping
 	ringEvent, err := client.parseEvent("09.09.25 15:30:45;RING;1;+49123456789;+4961813698237;SIP1")
@@ -93,7 +93,7 @@ func TestMSNDetectionInConnectEvents(t *testing.T) {
 
 func TestMSNDetectionInDisconnectEvents(t *testing.T) {
 	msns := []string{"990133", "990134", "3698237"}
-	client := NewClient("test.host", 1012, nil, "49", "6181", msns)
+	client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "6181", MSNs: msns})
 
 	// First simulate a CALL event to set up the line mapping
 	callEvent, err := client.parseEvent("09.09.25 15:30:45;CALL;2;1;+496181990133;+49123456789;SIP2")
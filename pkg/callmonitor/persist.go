@@ -0,0 +1,189 @@
+package callmonitor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// saveTimeout bounds a single save of the active calls
+const saveTimeout = 5 * time.Second
+
+// CallStore persists the active calls, so calls running while the bridge
+// restarts are still completed with their call ID, numbers and trunk
+type CallStore interface {
+	ActiveCalls(ctx context.Context) ([]types.ActiveCall, error)
+	SaveActiveCalls(ctx context.Context, calls []types.ActiveCall) error
+}
+
+// callSaver saves the active calls in the background, so reading from the
+// Fritz!Box never waits for the store. Only the latest snapshot is kept until
+// it is saved.
+type callSaver struct {
+	store   CallStore
+	mu      sync.Mutex
+	pending []types.ActiveCall
+	dirty   bool
+	idle    chan struct{} // Closed when no save is running
+}
+
+// newCallSaver creates an idle saver
+func newCallSaver(store CallStore) *callSaver {
+	idle := make(chan struct{})
+	close(idle)
+	return &callSaver{store: store, idle: idle}
+}
+
+// set schedules saving calls, replacing a snapshot that was not saved yet
+func (s *callSaver) set(calls []types.ActiveCall) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending, s.dirty = calls, true
+	select {
+	case <-s.idle:
+		s.idle = make(chan struct{})
+		go s.run(s.idle)
+	default:
+	}
+}
+
+// run saves snapshots until none is left
+func (s *callSaver) run(idle chan struct{}) {
+	for {
+		s.mu.Lock()
+		if !s.dirty {
+			close(idle)
+			s.mu.Unlock()
+			return
+		}
+		calls := s.pending
+		s.pending, s.dirty = nil, false
+		s.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), saveTimeout)
+		if err := s.store.SaveActiveCalls(ctx, calls); err != nil {
+			log.Printf("Failed to save active calls: %v", err)
+		}
+		cancel()
+	}
+}
+
+// wait blocks until all snapshots scheduled so far are saved
+func (s *callSaver) wait() {
+	s.mu.Lock()
+	idle := s.idle
+	s.mu.Unlock()
+	<-idle
+}
+
+// RestoreCalls tracks the calls that were active when the bridge stopped and
+// saves every further change of the active calls in the store. Calls older
+// than a day are dropped. It returns the restored calls, e.g. to restore the
+// FSMs, and must be called before Connect.
+func (c *Client) RestoreCalls(ctx context.Context, store CallStore) ([]types.ActiveCall, error) {
+	calls, err := store.ActiveCalls(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load active calls: %w", err)
+	}
+
+	now := c.timestamps.clock.Now()
+	restored := calls[:0]
+	groups := make(map[string]*ringGroup)
+	for _, saved := range calls {
+		if now.Sub(saved.Started) >= staleCallTimeout {
+			continue
+		}
+		call := &activeCall{
+			id:          saved.ID,
+			line:        saved.Line,
+			started:     saved.Started,
+			trunk:       saved.Trunk,
+			direction:   saved.Direction,
+			caller:      saved.Caller,
+			called:      saved.Called,
+			callerRaw:   saved.CallerRaw,
+			calledRaw:   saved.CalledRaw,
+			noRecord:    saved.DoNotRecord,
+			filtered:    saved.Filtered,
+			tam:         saved.MessageBox,
+			tags:        saved.Tags,
+			priority:    saved.Priority,
+			repeats:     saved.RepeatCount,
+			internal:    saved.Internal,
+			numberType:  saved.NumberType,
+			parentID:    saved.ParentCallID,
+			forwardedTo: saved.ForwardedTo,
+		}
+		if saved.ConnectedAt != nil {
+			call.connectedAt = *saved.ConnectedAt
+		}
+		if saved.ConnectedOn != nil {
+			call.connectedOn = *saved.ConnectedOn
+		}
+
+		// Lines of a ring group share its state again
+		if len(saved.RingGroup) > 0 {
+			group, ok := groups[saved.ID]
+			if !ok {
+				group = &ringGroup{line: saved.RingGroup[0], lines: saved.RingGroup, extension: saved.Extension}
+				groups[saved.ID] = group
+			}
+			group.active++
+			call.group = group
+		}
+		c.calls.start(call.line, call)
+		restored = append(restored, saved)
+	}
+
+	c.saver = newCallSaver(store)
+	if len(restored) > 0 {
+		log.Printf("Restored %d active calls", len(restored))
+	}
+	return restored, nil
+}
+
+// snapshot returns the active calls as saved for a restart
+func (t *callTracker) snapshot() []types.ActiveCall {
+	calls := make([]types.ActiveCall, 0, t.count())
+	for _, active := range t.calls {
+		for _, call := range active {
+			saved := types.ActiveCall{
+				ID:           call.id,
+				Line:         call.line,
+				Started:      call.started,
+				Trunk:        call.trunk,
+				Direction:    call.direction,
+				Caller:       call.caller,
+				Called:       call.called,
+				CallerRaw:    call.callerRaw,
+				CalledRaw:    call.calledRaw,
+				DoNotRecord:  call.noRecord,
+				Filtered:     call.filtered,
+				MessageBox:   call.tam,
+				Tags:         call.tags,
+				Priority:     call.priority,
+				RepeatCount:  call.repeats,
+				Internal:     call.internal,
+				NumberType:   call.numberType,
+				ParentCallID: call.parentID,
+				ForwardedTo:  call.forwardedTo,
+			}
+			if !call.connectedAt.IsZero() {
+				connectedAt, connectedOn := call.connectedAt, call.connectedOn.Round(0)
+				saved.ConnectedAt, saved.ConnectedOn = &connectedAt, &connectedOn
+			}
+			if call.group != nil {
+				saved.RingGroup = slices.Clone(call.group.lines)
+				saved.Extension = call.group.extension
+			}
+			calls = append(calls, saved)
+		}
+	}
+	return calls
+}
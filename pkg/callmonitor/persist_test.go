@@ -0,0 +1,164 @@
+package callmonitor
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// memoryCallStore keeps the saved active calls in memory
+type memoryCallStore struct {
+	mu    sync.Mutex
+	calls []types.ActiveCall
+}
+
+func (s *memoryCallStore) ActiveCalls(context.Context) ([]types.ActiveCall, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.calls), nil
+}
+
+func (s *memoryCallStore) SaveActiveCalls(_ context.Context, calls []types.ActiveCall) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls = calls
+	return nil
+}
+
+func TestRestoreCallsAfterRestart(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 9, 9, 15, 30, 0, 0, time.UTC))
+	opts := Options{Host: "test.host", Timezone: time.UTC, Clock: fake}
+	store := &memoryCallStore{}
+
+	before := newTestClient(t, opts)
+	if _, err := before.RestoreCalls(context.Background(), store); err != nil {
+		t.Fatalf("RestoreCalls failed: %v", err)
+	}
+	var ring *types.CallEvent
+	for _, message := range []string{
+		"09.09.25 15:30:00;RING;0;+49123456789;+496181990133;SIP0",
+		"09.09.25 15:30:01;RING;1;+49123456789;+496181990133;SIP0",
+		"09.09.25 15:30:05;CONNECT;1;11;+49123456789",
+		"09.09.25 15:30:06;CALL;2;12;+496181990133;+49987654321;SIP1",
+	} {
+		event, err := before.parseEvent(message)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", message, err)
+		}
+		if ring == nil {
+			ring = event
+		}
+		before.saver.set(before.calls.snapshot())
+	}
+	before.saver.wait()
+	if len(store.calls) != 3 {
+		t.Fatalf("Expected 3 tracked lines saved, got %+v", store.calls)
+	}
+
+	// The bridge restarts while both calls are running
+	fake.Advance(30 * time.Second)
+	after := newTestClient(t, opts)
+	restored, err := after.RestoreCalls(context.Background(), store)
+	if err != nil {
+		t.Fatalf("RestoreCalls failed: %v", err)
+	}
+	if len(restored) != 3 {
+		t.Fatalf("Expected 3 restored calls, got %+v", restored)
+	}
+
+	events := parseAll(t, after,
+		"09.09.25 15:30:05;DISCONNECT;0;0",
+		"09.09.25 15:30:40;DISCONNECT;1;35",
+		"09.09.25 15:30:46;DISCONNECT;2;0",
+	)
+	if len(events) != 2 {
+		t.Fatalf("Expected the DISCONNECTs of both calls, got %d events", len(events))
+	}
+	disconnect := events[0]
+	if disconnect.ID != ring.ID || disconnect.Caller != "+49123456789" || disconnect.Trunk != "SIP0" {
+		t.Errorf("Expected the DISCONNECT to complete call %s, got %+v", ring.ID, disconnect)
+	}
+	if disconnect.Extension != "11" || !slices.Equal(disconnect.RingGroup, []int{0, 1}) || disconnect.Line != 0 {
+		t.Errorf("Expected the ring group answered by 11, got extension %q, group %v on line %d", disconnect.Extension, disconnect.RingGroup, disconnect.Line)
+	}
+	if disconnect.MeasuredDuration != 30 {
+		t.Errorf("Expected 30s measured across the restart, got %d", disconnect.MeasuredDuration)
+	}
+	if events[1].Direction != types.CallDirectionOutbound || events[1].Called != "+49987654321" {
+		t.Errorf("Expected the outbound call to be completed, got %+v", events[1])
+	}
+}
+
+func TestRestoreCallsDropsStaleCalls(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 9, 10, 15, 30, 0, 0, time.UTC))
+	store := &memoryCallStore{calls: []types.ActiveCall{
+		{ID: "stale", Line: 0, Started: fake.Now().Add(-25 * time.Hour), Direction: types.CallDirectionInbound},
+		{ID: "running", Line: 1, Started: fake.Now().Add(-time.Minute), Direction: types.CallDirectionInbound},
+	}}
+
+	client := newTestClient(t, Options{Host: "test.host", Timezone: time.UTC, Clock: fake})
+	restored, err := client.RestoreCalls(context.Background(), store)
+	if err != nil {
+		t.Fatalf("RestoreCalls failed: %v", err)
+	}
+	if len(restored) != 1 || restored[0].ID != "running" || client.calls.count() != 1 {
+		t.Errorf("Expected only the running call restored, got %+v", restored)
+	}
+}
+
+func TestUnknownCallKeepsItsID(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 9, 9, 15, 30, 0, 0, time.UTC))
+	opts := Options{Host: "test.host", Timezone: time.UTC, Clock: fake}
+	store := &memoryCallStore{}
+
+	// The call rang before the bridge started
+	before := newTestClient(t, opts)
+	if _, err := before.RestoreCalls(context.Background(), store); err != nil {
+		t.Fatalf("RestoreCalls failed: %v", err)
+	}
+	connect := parseAll(t, before, "09.09.25 15:30:05;CONNECT;3;11;+49123456789")[0]
+	if connect.ID == "" {
+		t.Fatal("Expected a call ID for the CONNECT of an unknown call")
+	}
+	before.saver.set(before.calls.snapshot())
+	before.saver.wait()
+	if len(store.calls) != 1 || store.calls[0].ID != connect.ID {
+		t.Fatalf("Expected the unknown call saved with its ID, got %+v", store.calls)
+	}
+
+	after := newTestClient(t, opts)
+	if _, err := after.RestoreCalls(context.Background(), store); err != nil {
+		t.Fatalf("RestoreCalls failed: %v", err)
+	}
+	events := parseAll(t, after,
+		"09.09.25 15:31:00;DISCONNECT;3;55",
+		"09.09.25 15:31:01;DISCONNECT;4;0",
+	)
+	if events[0].ID != connect.ID {
+		t.Errorf("Expected the DISCONNECT to keep call ID %s, got %s", connect.ID, events[0].ID)
+	}
+	if events[1].ID == "" || events[1].ID == connect.ID {
+		t.Errorf("Expected a new call ID for the DISCONNECT of an unknown call, got %q", events[1].ID)
+	}
+}
+
+// parseAll parses the messages and returns the delivered events
+func parseAll(t *testing.T, client *Client, messages ...string) []*types.CallEvent {
+	t.Helper()
+	var events []*types.CallEvent
+	for _, message := range messages {
+		event, err := client.parseEvent(message)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", message, err)
+		}
+		if event != nil {
+			events = append(events, event)
+		}
+	}
+	return events
+}
@@ -0,0 +1,49 @@
+package callmonitor
+
+import (
+	"sync"
+	"time"
+)
+
+// repeatTracker remembers the last inbound call of every caller, so a caller
+// calling again shortly after, e.g. an aggressive robocaller, is recognized.
+// Calls are compared by their Fritz!Box timestamps, like the ring groups.
+type repeatTracker struct {
+	mu      sync.Mutex
+	window  time.Duration
+	callers map[string]repeatedCaller
+}
+
+// repeatedCaller is the last call of a caller and the attempts in a row up to it
+type repeatedCaller struct {
+	last     time.Time
+	attempts int
+}
+
+// newRepeatTracker creates a tracker; a window <= 0 disables it
+func newRepeatTracker(window time.Duration) *repeatTracker {
+	return &repeatTracker{window: window, callers: make(map[string]repeatedCaller)}
+}
+
+// Record records a call of the caller at the timestamp and returns the
+// attempts of the caller in a row, each within the window of the one before.
+// It returns 1 for a first attempt and 0 if the call is not tracked: while
+// disabled and for calls without a caller number.
+func (t *repeatTracker) Record(caller string, timestamp time.Time) int {
+	if t.window <= 0 || caller == "" {
+		return 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for number, previous := range t.callers {
+		if timestamp.Sub(previous.last) > t.window {
+			delete(t.callers, number)
+		}
+	}
+
+	attempts := t.callers[caller].attempts + 1
+	t.callers[caller] = repeatedCaller{last: timestamp, attempts: attempts}
+	return attempts
+}
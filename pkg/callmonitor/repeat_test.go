@@ -0,0 +1,104 @@
+package callmonitor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+func TestRepeatTracker(t *testing.T) {
+	tracker := newRepeatTracker(time.Minute)
+	start := time.Date(2025, 9, 21, 15, 35, 0, 0, time.UTC)
+
+	steps := []struct {
+		after    time.Duration
+		caller   string
+		attempts int
+	}{
+		{0, "+49178123456789", 1},
+		{30 * time.Second, "+49178123456789", 2},
+		{80 * time.Second, "+49178123456789", 3}, // Within the window of the attempt before
+		{90 * time.Second, "+4930123456", 1},
+		{3 * time.Minute, "+49178123456789", 1}, // Forgotten after the window
+		{3 * time.Minute, "", 0},
+	}
+	for i, step := range steps {
+		if attempts := tracker.Record(step.caller, start.Add(step.after)); attempts != step.attempts {
+			t.Errorf("Step %d: expected %d attempts, got %d", i, step.attempts, attempts)
+		}
+	}
+
+	if disabled := newRepeatTracker(0); disabled.Record("+4930123456", start) != 0 || disabled.Record("+4930123456", start) != 0 {
+		t.Error("Expected disabled tracker to track no calls")
+	}
+}
+
+func TestRepeatCall(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 9, 9, 15, 31, 30, 0, time.UTC))
+	opts := Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "6181", Timezone: time.UTC, RepeatCallWindow: time.Minute, Clock: fake}
+	client := newTestClient(t, opts)
+
+	messages := []string{
+		"09.09.25 15:30:00;RING;0;0178123456789;990133;SIP0",
+		"09.09.25 15:30:10;DISCONNECT;0;0",
+		"09.09.25 15:30:40;RING;0;0178123456789;990133;SIP0",
+		"09.09.25 15:30:41;RING;1;0178123456789;990133;SIP0", // Same call ringing on a second line
+		"09.09.25 15:30:50;DISCONNECT;0;0",
+		"09.09.25 15:30:50;DISCONNECT;1;0",
+		"09.09.25 15:31:00;RING;0;**610;990133;SIP0",
+		"09.09.25 15:31:01;DISCONNECT;0;0",
+		"09.09.25 15:31:02;RING;0;**610;990133;SIP0",
+	}
+	var events []*types.CallEvent
+	for _, message := range messages {
+		event, err := client.parseEvent(message)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", message, err)
+		}
+		if event != nil {
+			events = append(events, event)
+		}
+	}
+	if len(events) != 7 {
+		t.Fatalf("Expected 7 events, got %d", len(events))
+	}
+
+	if first := events[0]; first.RepeatCall || first.RepeatCount != 0 {
+		t.Errorf("Expected the first call not to be a repeat call, got %t, %d", first.RepeatCall, first.RepeatCount)
+	}
+	// The second call is attempt 2 from RING to DISCONNECT, its ring group does not count
+	for _, event := range events[2:4] {
+		if !event.RepeatCall || event.RepeatCount != 2 {
+			t.Errorf("Expected %s event of attempt 2, got %t, %d", event.Type, event.RepeatCall, event.RepeatCount)
+		}
+	}
+	if internal := events[6]; internal.RepeatCall {
+		t.Error("Expected calls between extensions not to be repeat calls")
+	}
+
+	// The attempts of a running call survive a restart of the bridge
+	store := &memoryCallStore{}
+	if _, err := client.RestoreCalls(context.Background(), store); err != nil {
+		t.Fatalf("RestoreCalls failed: %v", err)
+	}
+	if _, err := client.parseEvent("09.09.25 15:31:30;RING;2;0178123456789;990133;SIP0"); err != nil {
+		t.Fatalf("Failed to parse RING: %v", err)
+	}
+	client.saver.set(client.calls.snapshot())
+	client.saver.wait()
+
+	restarted := newTestClient(t, opts)
+	if _, err := restarted.RestoreCalls(context.Background(), store); err != nil {
+		t.Fatalf("RestoreCalls failed: %v", err)
+	}
+	event, err := restarted.parseEvent("09.09.25 15:31:40;DISCONNECT;2;0")
+	if err != nil {
+		t.Fatalf("Failed to parse DISCONNECT: %v", err)
+	}
+	if !event.RepeatCall || event.RepeatCount != 3 {
+		t.Errorf("Expected the restored call to be attempt 3, got %t, %d", event.RepeatCall, event.RepeatCount)
+	}
+}
@@ -0,0 +1,142 @@
+package callmonitor
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+func TestRingGroup(t *testing.T) {
+	tests := []struct {
+		name      string
+		messages  []string
+		delivered []types.CallType // Events delivered for the messages, in order
+		extension string           // Extension of the final DISCONNECT
+		duration  int
+		group     []int // Ring group of the final DISCONNECT
+	}{
+		{
+			name: "answered on second line",
+			messages: []string{
+				"09.09.25 15:30:00;RING;0;+49123456789;+496181990133;SIP0",
+				"09.09.25 15:30:01;RING;1;+49123456789;+496181990133;SIP0",
+				"09.09.25 15:30:05;CONNECT;1;11;+49123456789",
+				"09.09.25 15:30:05;DISCONNECT;0;0",
+				"09.09.25 15:30:40;DISCONNECT;1;35",
+			},
+			delivered: []types.CallType{types.CallTypeRing, types.CallTypeConnect, types.CallTypeDisconnect},
+			extension: "11",
+			duration:  35,
+			group:     []int{0, 1},
+		},
+		{
+			name: "missed on all lines",
+			messages: []string{
+				"09.09.25 15:30:00;RING;0;+49123456789;+496181990133;SIP0",
+				"09.09.25 15:30:00;RING;1;+49123456789;+496181990133;SIP0",
+				"09.09.25 15:30:00;RING;2;+49123456789;+496181990133;SIP0",
+				"09.09.25 15:30:20;DISCONNECT;2;0",
+				"09.09.25 15:30:20;DISCONNECT;0;0",
+				"09.09.25 15:30:20;DISCONNECT;1;0",
+			},
+			delivered: []types.CallType{types.CallTypeRing, types.CallTypeDisconnect},
+			group:     []int{0, 1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "6181", Timezone: time.UTC})
+
+			var events []*types.CallEvent
+			for _, message := range tt.messages {
+				event, err := client.parseEvent(message)
+				if err != nil {
+					t.Fatalf("Failed to parse %q: %v", message, err)
+				}
+				if event != nil {
+					events = append(events, event)
+				}
+			}
+
+			var got []types.CallType
+			for _, event := range events {
+				got = append(got, event.Type)
+				if event.ID != events[0].ID {
+					t.Errorf("Expected %s event to have call ID %s, got %s", event.Type, events[0].ID, event.ID)
+				}
+				if event.Line != 0 {
+					t.Errorf("Expected %s event on line 0, got %d", event.Type, event.Line)
+				}
+			}
+			if !slices.Equal(got, tt.delivered) {
+				t.Fatalf("Expected events %v, got %v", tt.delivered, got)
+			}
+
+			last := events[len(events)-1]
+			if last.Extension != tt.extension || last.Duration != tt.duration {
+				t.Errorf("Expected DISCONNECT of extension %q after %ds, got %q after %ds", tt.extension, tt.duration, last.Extension, last.Duration)
+			}
+			if !slices.Equal(last.RingGroup, tt.group) {
+				t.Errorf("Expected ring group %v, got %v", tt.group, last.RingGroup)
+			}
+			if client.calls.count() != 0 {
+				t.Errorf("Expected no active calls after all DISCONNECTs, got %d", client.calls.count())
+			}
+		})
+	}
+}
+
+func TestRingGroupSeparatesCalls(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  time.Duration
+		message string
+	}{
+		{"other caller", 0, "09.09.25 15:30:01;RING;1;+49987654321;+496181990133;SIP0"},
+		{"other trunk", 0, "09.09.25 15:30:01;RING;1;+49123456789;+496181990133;SIP1"},
+		{"after window", 0, "09.09.25 15:30:05;RING;1;+49123456789;+496181990133;SIP0"},
+		{"disabled", -1, "09.09.25 15:30:01;RING;1;+49123456789;+496181990133;SIP0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "6181", Timezone: time.UTC, RingGroupWindow: tt.window})
+
+			first, err := client.parseEvent("09.09.25 15:30:00;RING;0;+49123456789;+496181990133;SIP0")
+			if err != nil {
+				t.Fatalf("Failed to parse first RING: %v", err)
+			}
+			second, err := client.parseEvent(tt.message)
+			if err != nil {
+				t.Fatalf("Failed to parse %q: %v", tt.message, err)
+			}
+			if second == nil || second.ID == first.ID {
+				t.Errorf("Expected %q to start a separate call", tt.message)
+			}
+		})
+	}
+}
+
+func TestRingGroupIgnoresConnectedCalls(t *testing.T) {
+	client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "6181", Timezone: time.UTC})
+
+	for _, message := range []string{
+		"09.09.25 15:30:00;RING;0;+49123456789;+496181990133;SIP0",
+		"09.09.25 15:30:01;CONNECT;0;1;+49123456789",
+	} {
+		if _, err := client.parseEvent(message); err != nil {
+			t.Fatalf("Failed to parse %q: %v", message, err)
+		}
+	}
+
+	event, err := client.parseEvent("09.09.25 15:30:02;RING;1;+49123456789;+496181990133;SIP0")
+	if err != nil {
+		t.Fatalf("Failed to parse RING: %v", err)
+	}
+	if event == nil {
+		t.Error("Expected a RING after the call was answered to start a new call")
+	}
+}
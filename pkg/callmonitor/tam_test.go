@@ -0,0 +1,76 @@
+package callmonitor
+
+import (
+	"testing"
+)
+
+func TestMessageBoxDetection(t *testing.T) {
+	client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "6181"})
+
+	tests := []struct {
+		name       string
+		messages   []string
+		messageBox []bool
+	}{
+		{
+			name: "answered by TAM 1",
+			messages: []string{
+				"09.09.25 15:30:45;RING;0;+49123456789;+496181990133;SIP0",
+				"09.09.25 15:30:55;CONNECT;0;40;+49123456789",
+				"09.09.25 15:31:25;DISCONNECT;0;30",
+			},
+			messageBox: []bool{false, true, true},
+		},
+		{
+			name: "answered by phone",
+			messages: []string{
+				"09.09.25 15:32:45;RING;0;+49123456789;+496181990133;SIP0",
+				"09.09.25 15:32:50;CONNECT;0;1;+49123456789",
+				"09.09.25 15:33:25;DISCONNECT;0;35",
+			},
+			messageBox: []bool{false, false, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, message := range tt.messages {
+				event, err := client.parseEvent(message)
+				if err != nil {
+					t.Fatalf("Failed to parse %q: %v", message, err)
+				}
+				if event.MessageBox != tt.messageBox[i] {
+					t.Errorf("%s: MessageBox = %v, expected %v", event.Type, event.MessageBox, tt.messageBox[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCustomTAMExtensions(t *testing.T) {
+	client := newTestClient(t, Options{Host: "test.host", CountryCode: "49", LocalAreaCode: "6181", TAMExtensions: []string{"600"}})
+
+	if _, err := client.parseEvent("09.09.25 15:30:45;RING;1;+49123456789;+496181990133;SIP0"); err != nil {
+		t.Fatalf("Failed to parse RING event: %v", err)
+	}
+
+	event, err := client.parseEvent("09.09.25 15:30:55;CONNECT;1;600;+49123456789")
+	if err != nil {
+		t.Fatalf("Failed to parse CONNECT event: %v", err)
+	}
+	if !event.MessageBox {
+		t.Error("Expected custom TAM extension to be detected")
+	}
+
+	// Default TAM extensions are no longer treated as answering machine
+	if _, err := client.parseEvent("09.09.25 15:31:45;RING;2;+49123456789;+496181990133;SIP0"); err != nil {
+		t.Fatalf("Failed to parse RING event: %v", err)
+	}
+	event, err = client.parseEvent("09.09.25 15:31:55;CONNECT;2;40;+49123456789")
+	if err != nil {
+		t.Fatalf("Failed to parse CONNECT event: %v", err)
+	}
+	if event.MessageBox {
+		t.Error("Expected extension 40 not to be a TAM after reconfiguration")
+	}
+}
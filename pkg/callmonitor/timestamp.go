@@ -0,0 +1,109 @@
+package callmonitor
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+)
+
+// DefaultMaxTimestampSkew is how far a timestamp may be off the local clock before it counts as implausible
+const DefaultMaxTimestampSkew = 24 * time.Hour
+
+// ErrImplausibleTimestamp marks lines rejected in strict timestamp mode
+var ErrImplausibleTimestamp = errors.New("implausible timestamp")
+
+// timestampLayout is the callmonitor timestamp format, e.g. "21.09.25 15:30:45"
+const timestampLayout = "02.01.06 15:04:05"
+
+// timestampParser resolves the two-digit years of callmonitor timestamps.
+// A year yy is mapped to the single year ending in yy within the 100 year
+// window starting at the pivot year.
+type timestampParser struct {
+	location  *time.Location
+	pivotYear int           // First year of the window, 0 for a window sliding with the clock
+	strict    bool          // Reject unparsable timestamps and timestamps off by more than maxSkew
+	maxSkew   time.Duration // Tolerated difference to the local clock
+	clock     clock.Clock
+}
+
+// window returns the first year of the century window
+func (p *timestampParser) window(now time.Time) int {
+	if p.pivotYear != 0 {
+		return p.pivotYear
+	}
+	// The callmonitor reports calls as they happen, so dates far in the future are less likely than old ones
+	return now.Year() - 90
+}
+
+// Parse converts a timestamp in the parser's location. In strict mode errors
+// wrap ErrImplausibleTimestamp; otherwise only unparsable timestamps fail and
+// implausible ones are logged by the caller.
+func (p *timestampParser) Parse(value string) (time.Time, error) {
+	now := p.clock.Now()
+
+	t, err := time.ParseInLocation(timestampLayout, value, p.location)
+	if err != nil {
+		return time.Time{}, p.reject("%q is not in the format DD.MM.YY hh:mm:ss", value)
+	}
+
+	pivot := p.window(now)
+	year := pivot - pivot%100 + t.Year()%100
+	if year < pivot {
+		year += 100
+	}
+	resolved := time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, p.location)
+	if resolved.Day() != t.Day() {
+		// 29 February of a year that is not a leap year in the resolved century
+		return time.Time{}, p.reject("%q does not exist in %d", value, year)
+	}
+	resolved = nearestRepeat(resolved, now)
+
+	if p.strict && p.maxSkew > 0 {
+		if skew := resolved.Sub(now).Abs(); skew > p.maxSkew {
+			return time.Time{}, p.reject("%q is %s off the local clock", value, skew.Round(time.Second))
+		}
+	}
+	return resolved, nil
+}
+
+// nearestRepeat picks the occurrence of a wall clock time closest to now if
+// the time occurs twice, in the hour repeated when daylight saving time ends.
+// time.Date may return either one, which would put a call an hour off.
+func nearestRepeat(t, now time.Time) time.Time {
+	start, end := t.ZoneBounds()
+	_, offset := t.Zone()
+	other := t
+	if !end.IsZero() {
+		// The same wall clock time once more after the clocks were set back
+		_, after := end.Zone()
+		if repeat := t.Add(time.Duration(offset-after) * time.Second); offset > after && !repeat.Before(end) {
+			other = repeat
+		}
+	}
+	if !start.IsZero() {
+		// The same wall clock time before the clocks were set back
+		_, before := start.Add(-time.Nanosecond).Zone()
+		if first := t.Add(-time.Duration(before-offset) * time.Second); before > offset && first.Before(start) {
+			other = first
+		}
+	}
+	if other.Sub(now).Abs() < t.Sub(now).Abs() {
+		return other
+	}
+	return t
+}
+
+// reject returns the error of an unusable timestamp, wrapping ErrImplausibleTimestamp in strict mode
+func (p *timestampParser) reject(format string, args ...any) error {
+	if p.strict {
+		return fmt.Errorf("%w: %s", ErrImplausibleTimestamp, fmt.Sprintf(format, args...))
+	}
+	return fmt.Errorf("invalid timestamp: %s", fmt.Sprintf(format, args...))
+}
+
+// Plausible reports whether t is within the tolerated skew of the local clock
+func (p *timestampParser) Plausible(t time.Time) bool {
+	return p.maxSkew <= 0 || t.Sub(p.clock.Now()).Abs() <= p.maxSkew
+}
@@ -0,0 +1,181 @@
+package callmonitor
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
+)
+
+func TestTimestampParser(t *testing.T) {
+	now := time.Date(2025, 9, 21, 15, 31, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		opts        Options
+		input       string
+		expected    time.Time
+		expectError bool
+		implausible bool
+	}{
+		{"current year", Options{}, "21.09.25 15:30:45", time.Date(2025, 9, 21, 15, 30, 45, 0, time.UTC), false, false},
+		{"last century within sliding window", Options{}, "01.01.99 00:00:00", time.Date(1999, 1, 1, 0, 0, 0, 0, time.UTC), false, false},
+		{"ahead within sliding window", Options{}, "01.01.34 00:00:00", time.Date(2034, 1, 1, 0, 0, 0, 0, time.UTC), false, false},
+		{"beyond sliding window", Options{}, "01.01.35 00:00:00", time.Date(1935, 1, 1, 0, 0, 0, 0, time.UTC), false, false},
+		{"pivot year", Options{TimestampPivotYear: 2000}, "01.01.99 00:00:00", time.Date(2099, 1, 1, 0, 0, 0, 0, time.UTC), false, false},
+		{"pivot year in mid century", Options{TimestampPivotYear: 1970}, "01.01.69 00:00:00", time.Date(2069, 1, 1, 0, 0, 0, 0, time.UTC), false, false},
+		{"leap day missing in resolved century", Options{TimestampPivotYear: 1900}, "29.02.00 12:00:00", time.Time{}, true, false},
+		{"unparsable", Options{}, "2025-09-21 15:30:45", time.Time{}, true, false},
+		{"strict within skew", Options{StrictTimestamps: true}, "21.09.25 15:30:45", time.Date(2025, 9, 21, 15, 30, 45, 0, time.UTC), false, false},
+		{"strict off by a century", Options{StrictTimestamps: true, TimestampPivotYear: 1900}, "21.09.25 15:30:45", time.Time{}, true, true},
+		{"strict off by more than skew", Options{StrictTimestamps: true, MaxTimestampSkew: time.Hour}, "21.09.25 13:30:45", time.Time{}, true, true},
+		{"strict without skew check", Options{StrictTimestamps: true, MaxTimestampSkew: -1}, "21.09.24 13:30:45", time.Date(2024, 9, 21, 13, 30, 45, 0, time.UTC), false, false},
+		{"strict unparsable", Options{StrictTimestamps: true}, "21/09/25 15:30:45", time.Time{}, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Timezone = time.UTC
+			tt.opts.CountryCode = "49"
+			tt.opts.Clock = clock.NewFake(now)
+			client := newTestClient(t, tt.opts)
+
+			result, err := client.parseTimestamp(tt.input)
+			if tt.expectError {
+				if err == nil {
+					t.Fatalf("Expected error, got %v", result)
+				}
+				if errors.Is(err, ErrImplausibleTimestamp) != tt.implausible {
+					t.Errorf("Expected implausible=%v, got %v", tt.implausible, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !result.Equal(tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestTimestampParserDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("Timezone data not available: %v", err)
+	}
+
+	// The clocks went back from 03:00 CEST to 02:00 CET on 26 October 2025
+	tests := []struct {
+		name     string
+		now      time.Time
+		input    string
+		expected time.Time
+	}{
+		{"before the change", time.Date(2025, 10, 26, 0, 31, 0, 0, time.UTC), "26.10.25 02:30:00", time.Date(2025, 10, 26, 0, 30, 0, 0, time.UTC)},
+		{"repeated hour", time.Date(2025, 10, 26, 1, 31, 0, 0, time.UTC), "26.10.25 02:30:00", time.Date(2025, 10, 26, 1, 30, 0, 0, time.UTC)},
+		{"after the change", time.Date(2025, 10, 26, 2, 31, 0, 0, time.UTC), "26.10.25 03:30:00", time.Date(2025, 10, 26, 2, 30, 0, 0, time.UTC)},
+		{"repeated hour of an old call", time.Date(2025, 12, 1, 12, 0, 0, 0, time.UTC), "26.10.25 02:30:00", time.Date(2025, 10, 26, 1, 30, 0, 0, time.UTC)},
+		// 02:30 does not exist on 30 March 2025, the clocks jumped from 02:00 CET to 03:00 CEST
+		{"skipped hour", time.Date(2025, 3, 30, 1, 0, 0, 0, time.UTC), "30.03.25 03:30:00", time.Date(2025, 3, 30, 1, 30, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, Options{Timezone: berlin, CountryCode: "49", Clock: clock.NewFake(tt.now)})
+			result, err := client.parseTimestamp(tt.input)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !result.Equal(tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected.In(berlin), result.In(berlin))
+			}
+		})
+	}
+}
+
+func TestStrictTimestampsRejectLine(t *testing.T) {
+	now := time.Date(2025, 9, 21, 15, 31, 0, 0, time.UTC)
+	client := newTestClient(t, Options{Timezone: time.UTC, Clock: clock.NewFake(now), StrictTimestamps: true})
+
+	if _, err := client.parseEvent("21.09.25 15:30:45;RING;0;+4930123456;990133;SIP0;"); err != nil {
+		t.Fatalf("Expected plausible line to be parsed, got %v", err)
+	}
+
+	if _, err := client.parseEvent("21.09.15 15:30:45;RING;1;+4930123456;990133;SIP0;"); !errors.Is(err, ErrImplausibleTimestamp) {
+		t.Errorf("Expected line to be rejected, got %v", err)
+	}
+	if client.calls.count() != 1 {
+		t.Errorf("Expected rejected RING not to start a call, got %d active calls", client.calls.count())
+	}
+
+	lenient := newTestClient(t, Options{Timezone: time.UTC, Clock: clock.NewFake(now)})
+	event, err := lenient.parseEvent("garbage;RING;0;+4930123456;990133;SIP0;")
+	if err != nil {
+		t.Fatalf("Expected lenient mode to fall back to the current time, got %v", err)
+	}
+	if !event.Timestamp.Equal(now) {
+		t.Errorf("Expected current time %v, got %v", now, event.Timestamp)
+	}
+}
+
+func TestRejectedLinesKeepConnection(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		// Firmware sending the wrong year, followed by a correct line
+		_, _ = conn.Write([]byte("21.09.15 15:30:45;RING;0;0178123456789;990133;SIP0;\n"))
+		_, _ = conn.Write([]byte("21.09.25 15:30:50;RING;1;0178123456789;990133;SIP0;\n"))
+		<-done
+		_ = conn.Close()
+	}()
+
+	_, portStr, _ := net.SplitHostPort(listener.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+	now := time.Date(2025, 9, 21, 15, 31, 0, 0, time.UTC)
+	client := newTestClient(t, Options{Host: "127.0.0.1", Port: port, Timezone: time.UTC, CountryCode: "49", Clock: clock.NewFake(now), StrictTimestamps: true})
+	if err := client.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer client.Disconnect()
+
+	select {
+	case rejection := <-client.Rejected():
+		if rejection.Timestamp != "21.09.15 15:30:45" || rejection.Type != "RING" || !rejection.Time.Equal(now) {
+			t.Errorf("Unexpected rejection %+v", rejection)
+		}
+		if strings.Contains(rejection.Reason, "0178123456789") {
+			t.Errorf("Expected rejection without numbers, got %q", rejection.Reason)
+		}
+	case err := <-client.Errors():
+		t.Fatalf("Expected rejection, got error %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for rejection")
+	}
+
+	select {
+	case event := <-client.Events():
+		if event.Line != 1 {
+			t.Errorf("Expected the correct line to be processed, got %+v", event)
+		}
+	case err := <-client.Errors():
+		t.Fatalf("Expected event, got error %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for event")
+	}
+}
@@ -0,0 +1,163 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is a manually driven clock for tests. Time only moves on Advance or
+// Set; timers and tickers that become due fire in the calling goroutine.
+type Fake struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeTimer
+}
+
+// fakeTimer is a pending AfterFunc call or ticker
+type fakeTimer struct {
+	fake   *Fake
+	at     time.Time
+	f      func()         // Set for AfterFunc
+	ch     chan time.Time // Set for tickers
+	period time.Duration  // Set for tickers
+}
+
+// NewFake creates a fake clock starting at the given time
+func NewFake(start time.Time) *Fake {
+	f := &Fake{now: start}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+// Now returns the current fake time
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// AfterFunc calls fn once the fake time has advanced by d
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t := &fakeTimer{fake: f, at: f.now.Add(d), f: fn}
+	f.add(t)
+	return t
+}
+
+// NewTicker creates a ticker that ticks every d of fake time. Like a real
+// ticker, ticks are dropped while the channel is full.
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	t := &fakeTimer{fake: f, at: f.now.Add(d), ch: make(chan time.Time, 1), period: d}
+	f.add(t)
+	return fakeTicker{t}
+}
+
+// Advance moves the time forward by d and fires everything that becomes due,
+// in order of due time
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set moves the time forward to t and fires everything that becomes due.
+// Setting an earlier time only changes Now.
+func (f *Fake) Set(t time.Time) {
+	for {
+		f.mu.Lock()
+		if len(f.waiters) == 0 || f.waiters[0].at.After(t) {
+			f.now = t
+			f.mu.Unlock()
+			return
+		}
+
+		next := f.waiters[0]
+		f.waiters = f.waiters[1:]
+		if next.at.After(f.now) {
+			f.now = next.at
+		}
+		if next.period > 0 {
+			next.at = next.at.Add(next.period)
+			f.add(next)
+		}
+		now := f.now
+		f.mu.Unlock()
+
+		// Fire outside the lock, callbacks may use the clock themselves
+		if next.f != nil {
+			next.f()
+		} else {
+			select {
+			case next.ch <- now:
+			default:
+			}
+		}
+	}
+}
+
+// Pending returns the number of timers and tickers that have not fired or been stopped
+func (f *Fake) Pending() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+// BlockUntil waits until at least n timers or tickers are pending. It lets
+// tests wait for a goroutine to register its ticker before advancing.
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
+
+// add inserts a timer sorted by due time; f.mu must be held
+func (f *Fake) add(t *fakeTimer) {
+	i := sort.Search(len(f.waiters), func(i int) bool {
+		return f.waiters[i].at.After(t.at)
+	})
+	f.waiters = append(f.waiters, nil)
+	copy(f.waiters[i+1:], f.waiters[i:])
+	f.waiters[i] = t
+	f.cond.Broadcast()
+}
+
+// remove deletes a timer and reports whether it was pending; f.mu must be held
+func (f *Fake) remove(t *fakeTimer) bool {
+	for i, w := range f.waiters {
+		if w == t {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.fake.mu.Lock()
+	defer t.fake.mu.Unlock()
+	return t.fake.remove(t)
+}
+
+// fakeTicker exposes a periodic fakeTimer as Ticker
+type fakeTicker struct {
+	timer *fakeTimer
+}
+
+func (t fakeTicker) C() <-chan time.Time {
+	return t.timer.ch
+}
+
+func (t fakeTicker) Stop() {
+	t.timer.Stop()
+}
@@ -0,0 +1,84 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var start = time.Date(2025, 9, 21, 15, 35, 0, 0, time.UTC)
+
+func TestFakeAfterFunc(t *testing.T) {
+	clk := NewFake(start)
+
+	var fired []string
+	clk.AfterFunc(2*time.Second, func() { fired = append(fired, "second") })
+	clk.AfterFunc(time.Second, func() { fired = append(fired, "first") })
+	stopped := clk.AfterFunc(1500*time.Millisecond, func() { fired = append(fired, "stopped") })
+
+	if !stopped.Stop() {
+		t.Error("Expected Stop to report a pending timer")
+	}
+
+	clk.Advance(999 * time.Millisecond)
+	if len(fired) != 0 {
+		t.Fatalf("Expected no timer before it is due, got %v", fired)
+	}
+
+	clk.Advance(5 * time.Second)
+	if len(fired) != 2 || fired[0] != "first" || fired[1] != "second" {
+		t.Errorf("Expected timers to fire in order of due time, got %v", fired)
+	}
+	if stopped.Stop() {
+		t.Error("Expected Stop to report false for a stopped timer")
+	}
+	if got := clk.Now(); !got.Equal(start.Add(5999 * time.Millisecond)) {
+		t.Errorf("Unexpected time after Advance: %v", got)
+	}
+	if clk.Pending() != 0 {
+		t.Errorf("Expected no pending timers, got %d", clk.Pending())
+	}
+}
+
+func TestFakeAfterFuncSeesDueTime(t *testing.T) {
+	clk := NewFake(start)
+
+	var at time.Time
+	clk.AfterFunc(time.Minute, func() { at = clk.Now() })
+	clk.Advance(time.Hour)
+
+	if !at.Equal(start.Add(time.Minute)) {
+		t.Errorf("Expected callback to run at its due time, got %v", at)
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	clk := NewFake(start)
+	ticker := clk.NewTicker(time.Minute)
+
+	clk.Advance(time.Minute)
+	select {
+	case tick := <-ticker.C():
+		if !tick.Equal(start.Add(time.Minute)) {
+			t.Errorf("Unexpected tick time %v", tick)
+		}
+	default:
+		t.Fatal("Expected a tick after one interval")
+	}
+
+	// Like time.Ticker, ticks are dropped while the channel is full
+	clk.Advance(3 * time.Minute)
+	<-ticker.C()
+	select {
+	case tick := <-ticker.C():
+		t.Errorf("Expected missed ticks to be dropped, got %v", tick)
+	default:
+	}
+
+	ticker.Stop()
+	clk.Advance(time.Hour)
+	select {
+	case tick := <-ticker.C():
+		t.Errorf("Expected no tick after Stop, got %v", tick)
+	default:
+	}
+}
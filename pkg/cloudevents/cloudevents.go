@@ -0,0 +1,61 @@
+package cloudevents
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SpecVersion is the CloudEvents version of the envelope
+const SpecVersion = "1.0"
+
+// DefaultSource identifies the bridge as the source of its events
+const DefaultSource = "/fritz-callmonitor2mqtt"
+
+// typePrefix is the reverse-DNS namespace of the event types
+const typePrefix = "io.github.akentner.fritz-callmonitor2mqtt."
+
+// Event is the structured JSON envelope of a CloudEvent
+type Event struct {
+	SpecVersion     string          `json:"specversion"`
+	ID              string          `json:"id"`
+	Source          string          `json:"source"`
+	Type            string          `json:"type"`
+	Subject         string          `json:"subject,omitempty"`
+	Time            time.Time       `json:"time"`
+	DataContentType string          `json:"datacontenttype"`
+	Data            json.RawMessage `json:"data"`
+}
+
+// Type returns the event type of a kind of payload, e.g. "call.ring"
+func Type(kind string) string {
+	return typePrefix + kind
+}
+
+// Wrap puts a JSON payload into an envelope with a new UUID v7 as its id.
+// The subject names what the event is about, e.g. a call ID, and may be empty.
+func Wrap(source, eventType, subject string, at time.Time, data []byte) ([]byte, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate event ID: %w", err)
+	}
+	if source == "" {
+		source = DefaultSource
+	}
+	payload, err := json.Marshal(Event{
+		SpecVersion:     SpecVersion,
+		ID:              id.String(),
+		Source:          source,
+		Type:            eventType,
+		Subject:         subject,
+		Time:            at,
+		DataContentType: "application/json",
+		Data:            data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal CloudEvent: %w", err)
+	}
+	return payload, nil
+}
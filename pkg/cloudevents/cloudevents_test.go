@@ -0,0 +1,41 @@
+package cloudevents
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestWrap(t *testing.T) {
+	at := time.Date(2025, 9, 21, 15, 35, 0, 0, time.UTC)
+	payload, err := Wrap("", Type("call.ring"), "call-1", at, []byte(`{"id":"call-1"}`))
+	if err != nil {
+		t.Fatalf("Wrap failed: %v", err)
+	}
+
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		t.Fatalf("Failed to parse envelope: %v", err)
+	}
+	if event.SpecVersion != "1.0" || event.Source != DefaultSource || event.Type != "io.github.akentner.fritz-callmonitor2mqtt.call.ring" {
+		t.Errorf("Unexpected envelope attributes: %+v", event)
+	}
+	if event.ID == "" || event.Subject != "call-1" || !event.Time.Equal(at) || event.DataContentType != "application/json" {
+		t.Errorf("Unexpected envelope attributes: %+v", event)
+	}
+	if string(event.Data) != `{"id":"call-1"}` {
+		t.Errorf("Expected the payload as data, got %s", event.Data)
+	}
+
+	other, err := Wrap("", Type("call.ring"), "call-1", at, []byte(`{}`))
+	if err != nil {
+		t.Fatalf("Wrap failed: %v", err)
+	}
+	var second Event
+	if err := json.Unmarshal(other, &second); err != nil {
+		t.Fatalf("Failed to parse envelope: %v", err)
+	}
+	if second.ID == event.ID {
+		t.Error("Expected every event to get its own ID")
+	}
+}
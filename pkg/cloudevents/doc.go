@@ -0,0 +1,6 @@
+// Package cloudevents wraps the JSON payloads of the bridge in the
+// CloudEvents 1.0 structured JSON envelope, so event routers like Knative can
+// consume them without knowing the bridge:
+//
+//	payload, err := cloudevents.Wrap(cloudevents.DefaultSource, cloudevents.Type("call.ring"), event.ID, event.Timestamp, data)
+package cloudevents
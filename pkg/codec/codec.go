@@ -0,0 +1,204 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/cloudevents"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/seal"
+)
+
+// Message is a payload to encode
+type Message struct {
+	Kind    string    // What the payload is, e.g. call.ring or line.status
+	Subject string    // What the payload is about, e.g. a call ID, may be empty
+	Time    time.Time // When it happened
+	Value   any       // The payload itself
+}
+
+// Codec encodes messages in a payload format
+type Codec interface {
+	// ContentType is the media type of the encoded payloads
+	ContentType() string
+	// Encode writes the encoded message to w
+	Encode(w io.Writer, msg Message) error
+}
+
+// Marshal encodes a message into a byte slice
+func Marshal(c Codec, msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := c.Encode(&buf, msg); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Parse returns the codec of a payload format: json, msgpack, cloudevents or
+// template:<file>. CloudEvents carry source as their source attribute.
+func Parse(format, source string) (Codec, error) {
+	switch format = strings.TrimSpace(format); format {
+	case "", "json":
+		return JSON, nil
+	case "msgpack":
+		return MessagePack, nil
+	case "cloudevents":
+		return CloudEvents{Source: source}, nil
+	}
+	if path, ok := strings.CutPrefix(format, "template:"); ok {
+		text, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read payload template: %w", err)
+		}
+		return NewTemplate(string(text))
+	}
+	return nil, fmt.Errorf("unknown payload format '%s', expected json, msgpack, cloudevents or template:<file>", format)
+}
+
+// JSON encodes the value of a message as JSON, the default of the bridge
+var JSON Codec = jsonCodec{}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return "application/json" }
+
+func (jsonCodec) Encode(w io.Writer, msg Message) error {
+	// The encoder terminates every value with a newline, which payloads don't have
+	tw := &trimWriter{w: w}
+	if err := json.NewEncoder(tw).Encode(msg.Value); err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	return tw.err
+}
+
+// trimWriter passes everything but the last byte written, a trailing newline, to w
+type trimWriter struct {
+	w       io.Writer
+	last    []byte
+	err     error
+	started bool
+}
+
+func (t *trimWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 || t.err != nil {
+		return len(p), t.err
+	}
+	if t.started {
+		if _, t.err = t.w.Write(t.last); t.err != nil {
+			return 0, t.err
+		}
+	}
+	if _, t.err = t.w.Write(p[:len(p)-1]); t.err != nil {
+		return 0, t.err
+	}
+	t.last, t.started = append(t.last[:0], p[len(p)-1]), true
+	return len(p), nil
+}
+
+// CloudEvents encodes a message as CloudEvents structured JSON envelope with
+// the value as JSON data. The kind of the message becomes the event type.
+type CloudEvents struct {
+	Source string // Source attribute (default: cloudevents.DefaultSource)
+}
+
+func (CloudEvents) ContentType() string { return "application/cloudevents+json" }
+
+func (c CloudEvents) Encode(w io.Writer, msg Message) error {
+	data, err := json.Marshal(msg.Value)
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	payload, err := cloudevents.Wrap(c.Source, cloudevents.Type(msg.Kind), msg.Subject, msg.Time, data)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(payload)
+	return err
+}
+
+// Versioned adds the version of the payload layout as schema_version to the
+// JSON objects of the messages before another codec encodes them, so
+// consumers can tell which fields to expect. Other values are passed as is.
+type Versioned struct {
+	Codec   Codec
+	Version int
+}
+
+func (v Versioned) ContentType() string { return v.Codec.ContentType() }
+
+func (v Versioned) Encode(w io.Writer, msg Message) error {
+	data, err := json.Marshal(msg.Value)
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	// Marshal writes compact JSON, an object starts with { and is empty if } follows
+	if data[0] == '{' {
+		field := fmt.Sprintf(`{"schema_version":%d`, v.Version)
+		if data[1] != '}' {
+			field += ","
+		}
+		data = append([]byte(field), data[1:]...)
+	}
+	msg.Value = json.RawMessage(data)
+	return v.Codec.Encode(w, msg)
+}
+
+// Sealed encrypts the payloads of another codec with a shared key, see
+// seal.Seal, so they can pass a broker that is not trusted
+type Sealed struct {
+	Codec Codec
+	Key   seal.Key
+}
+
+func (Sealed) ContentType() string { return "application/octet-stream" }
+
+func (s Sealed) Encode(w io.Writer, msg Message) error {
+	plaintext, err := Marshal(s.Codec, msg)
+	if err != nil {
+		return err
+	}
+	payload, err := seal.Seal(s.Key, plaintext)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(payload)
+	return err
+}
+
+// Template renders a message with a text/template, e.g. for displays that
+// expect plain text. The template sees the Message, so {{.Value.Caller}}
+// is the caller of a call event. Values that are already JSON are decoded,
+// so their fields are accessed by their JSON names.
+type Template struct {
+	tmpl *template.Template
+}
+
+// NewTemplate parses a payload template
+func NewTemplate(text string) (*Template, error) {
+	tmpl, err := template.New("payload").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload template: %w", err)
+	}
+	return &Template{tmpl: tmpl}, nil
+}
+
+func (*Template) ContentType() string { return "text/plain; charset=utf-8" }
+
+func (t *Template) Encode(w io.Writer, msg Message) error {
+	if raw, ok := msg.Value.(json.RawMessage); ok {
+		var value any
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return fmt.Errorf("failed to decode JSON: %w", err)
+		}
+		msg.Value = value
+	}
+	if err := t.tmpl.Execute(w, msg); err != nil {
+		return fmt.Errorf("failed to render payload template: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/cloudevents"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/seal"
+)
+
+type call struct {
+	ID     string `json:"id"`
+	Caller string `json:"caller,omitempty"`
+	Line   int    `json:"line"`
+}
+
+func TestJSON(t *testing.T) {
+	value := map[string]any{"caller": "<anonymous>", "line": 1}
+	payload, err := Marshal(JSON, Message{Value: value})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	expected, _ := json.Marshal(value)
+	if !bytes.Equal(payload, expected) {
+		t.Errorf("Expected %s like json.Marshal, got %s", expected, payload)
+	}
+}
+
+func TestMessagePack(t *testing.T) {
+	payload, err := Marshal(MessagePack, Message{Value: map[string]any{"c": "x", "a": 1, "b": []any{true, nil, -1, 300, 1.5}}})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	expected := []byte{
+		0x83,
+		0xa1, 'a', 0x01,
+		0xa1, 'b', 0x95, 0xc3, 0xc0, 0xff, 0xcd, 0x01, 0x2c, 0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0,
+		0xa1, 'c', 0xa1, 'x',
+	}
+	if !bytes.Equal(payload, expected) {
+		t.Errorf("Expected % x, got % x", expected, payload)
+	}
+
+	// Fields are named and omitted like in JSON
+	payload, err = Marshal(MessagePack, Message{Value: call{ID: "1"}})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	expected = []byte{0x82, 0xa2, 'i', 'd', 0xa1, '1', 0xa4, 'l', 'i', 'n', 'e', 0x00}
+	if !bytes.Equal(payload, expected) {
+		t.Errorf("Expected % x, got % x", expected, payload)
+	}
+}
+
+func TestCloudEvents(t *testing.T) {
+	at := time.Date(2025, 9, 1, 10, 0, 0, 0, time.UTC)
+	payload, err := Marshal(CloudEvents{Source: "/test"}, Message{Kind: "call.ring", Subject: "1", Time: at, Value: call{ID: "1", Line: 2}})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var event cloudevents.Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		t.Fatalf("Expected a CloudEvent, got %s", payload)
+	}
+	if event.Type != cloudevents.Type("call.ring") || event.Source != "/test" || event.Subject != "1" || !event.Time.Equal(at) {
+		t.Errorf("Unexpected envelope %+v", event)
+	}
+	if string(event.Data) != `{"id":"1","line":2}` {
+		t.Errorf("Expected the value as data, got %s", event.Data)
+	}
+}
+
+func TestSealed(t *testing.T) {
+	key := seal.Key{1, 2, 3}
+	payload, err := Marshal(Sealed{Codec: JSON, Key: key}, Message{Value: call{ID: "1", Caller: "+4930123456", Line: 2}})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if bytes.Contains(payload, []byte("4930123456")) {
+		t.Errorf("Expected an encrypted payload, got %s", payload)
+	}
+	plaintext, err := seal.Open(key, payload)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if string(plaintext) != `{"id":"1","caller":"+4930123456","line":2}` {
+		t.Errorf("Expected the JSON payload, got %s", plaintext)
+	}
+}
+
+func TestVersioned(t *testing.T) {
+	tests := []struct {
+		value    any
+		expected string
+	}{
+		{call{ID: "1", Line: 2}, `{"schema_version":2,"id":"1","line":2}`},
+		{json.RawMessage(` { "id": "1" }`), `{"schema_version":2,"id":"1"}`},
+		{struct{}{}, `{"schema_version":2}`},
+		{[]call{{ID: "1"}}, `[{"id":"1","line":0}]`},
+		{"online", `"online"`},
+	}
+	for _, tt := range tests {
+		payload, err := Marshal(Versioned{Codec: JSON, Version: 2}, Message{Value: tt.value})
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		if string(payload) != tt.expected {
+			t.Errorf("Expected %s, got %s", tt.expected, payload)
+		}
+	}
+
+	// The version is part of the data of CloudEvents
+	payload, err := Marshal(Versioned{Codec: CloudEvents{Source: "/test"}, Version: 2}, Message{Kind: "call.ring", Value: call{ID: "1"}})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var event cloudevents.Event
+	if err := json.Unmarshal(payload, &event); err != nil || string(event.Data) != `{"schema_version":2,"id":"1","line":0}` {
+		t.Errorf("Expected the versioned value as data, got %s", payload)
+	}
+}
+
+func TestTemplate(t *testing.T) {
+	tmpl, err := NewTemplate("{{.Kind}}: {{.Value.Caller}} on line {{.Value.Line}}")
+	if err != nil {
+		t.Fatalf("NewTemplate failed: %v", err)
+	}
+	payload, err := Marshal(tmpl, Message{Kind: "call.ring", Value: call{Caller: "+4930123456", Line: 1}})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if string(payload) != "call.ring: +4930123456 on line 1" {
+		t.Errorf("Unexpected payload %q", payload)
+	}
+
+	if _, err := NewTemplate("{{.Value"); err == nil {
+		t.Error("Expected an invalid template to be rejected")
+	}
+}
+
+func TestParse(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ring.tmpl")
+	if err := os.WriteFile(path, []byte("{{.Value}}"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for format, contentType := range map[string]string{
+		"":                 "application/json",
+		"json":             "application/json",
+		"msgpack":          "application/msgpack",
+		"cloudevents":      "application/cloudevents+json",
+		"template:" + path: "text/plain; charset=utf-8",
+	} {
+		c, err := Parse(format, "")
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", format, err)
+			continue
+		}
+		if c.ContentType() != contentType {
+			t.Errorf("Expected %s for %q, got %s", contentType, format, c.ContentType())
+		}
+	}
+
+	for _, format := range []string{"xml", "template:" + filepath.Join(t.TempDir(), "missing.tmpl")} {
+		if _, err := Parse(format, ""); err == nil {
+			t.Errorf("Expected format %q to be rejected", format)
+		}
+	}
+}
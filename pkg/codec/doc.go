@@ -0,0 +1,10 @@
+// Package codec serializes the payloads of the bridge. A Codec encodes a
+// Message, the value of a payload together with what it is about, so formats
+// like CloudEvents can use the metadata while plain formats ignore it:
+//
+//	c, err := codec.Parse("msgpack", cloudevents.DefaultSource)
+//	payload, err := codec.Marshal(c, codec.Message{Kind: "call.ring", Subject: event.ID, Time: event.Timestamp, Value: event})
+//
+// Codecs write to an io.Writer, so large payloads like the call history can be
+// streamed to their destination without an intermediate copy.
+package codec
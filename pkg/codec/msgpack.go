@@ -0,0 +1,142 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+)
+
+// MessagePack encodes the value of a message as MessagePack. The value is
+// mapped like its JSON encoding, so field names and omitted fields are the
+// same in both formats; map keys are sorted.
+var MessagePack Codec = msgpackCodec{}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) ContentType() string { return "application/msgpack" }
+
+func (msgpackCodec) Encode(w io.Writer, msg Message) error {
+	data, err := json.Marshal(msg.Value)
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("failed to decode JSON: %w", err)
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := writeMsgpack(bw, value); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// writeMsgpack writes a decoded JSON value
+func writeMsgpack(w *bufio.Writer, value any) error {
+	switch v := value.(type) {
+	case nil:
+		return w.WriteByte(0xc0)
+	case bool:
+		if v {
+			return w.WriteByte(0xc3)
+		}
+		return w.WriteByte(0xc2)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return writeMsgpackInt(w, n)
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return fmt.Errorf("invalid number '%s': %w", v, err)
+		}
+		_ = w.WriteByte(0xcb)
+		return binary.Write(w, binary.BigEndian, math.Float64bits(f))
+	case string:
+		writeMsgpackHeader(w, len(v), 0xa0, 31, 0xd9, 0xda, 0xdb)
+		_, err := w.WriteString(v)
+		return err
+	case []any:
+		writeMsgpackHeader(w, len(v), 0x90, 15, 0, 0xdc, 0xdd)
+		for _, item := range v {
+			if err := writeMsgpack(w, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[string]any:
+		writeMsgpackHeader(w, len(v), 0x80, 15, 0, 0xde, 0xdf)
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			if err := writeMsgpack(w, key); err != nil {
+				return err
+			}
+			if err := writeMsgpack(w, v[key]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported MessagePack value of type %T", value)
+}
+
+// writeMsgpackHeader writes the type and length of a string, array or map:
+// the fix type up to fixMax, then 8 (if the type has one), 16 or 32 bit lengths
+func writeMsgpackHeader(w *bufio.Writer, n int, fix byte, fixMax int, len8, len16, len32 byte) {
+	switch {
+	case n <= fixMax:
+		_ = w.WriteByte(fix | byte(n))
+	case len8 != 0 && n <= math.MaxUint8:
+		_ = w.WriteByte(len8)
+		_ = w.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		_ = w.WriteByte(len16)
+		_ = binary.Write(w, binary.BigEndian, uint16(n))
+	default:
+		_ = w.WriteByte(len32)
+		_ = binary.Write(w, binary.BigEndian, uint32(n))
+	}
+}
+
+// writeMsgpackInt writes an integer in its smallest representation
+func writeMsgpackInt(w *bufio.Writer, n int64) error {
+	switch {
+	case n >= 0 && n <= 127, n < 0 && n >= -32:
+		return w.WriteByte(byte(n))
+	case n > 0 && n <= math.MaxUint8:
+		_ = w.WriteByte(0xcc)
+		return w.WriteByte(byte(n))
+	case n > 0 && n <= math.MaxUint16:
+		_ = w.WriteByte(0xcd)
+		return binary.Write(w, binary.BigEndian, uint16(n))
+	case n > 0 && n <= math.MaxUint32:
+		_ = w.WriteByte(0xce)
+		return binary.Write(w, binary.BigEndian, uint32(n))
+	case n > 0:
+		_ = w.WriteByte(0xcf)
+		return binary.Write(w, binary.BigEndian, uint64(n))
+	case n >= math.MinInt8:
+		_ = w.WriteByte(0xd0)
+		return w.WriteByte(byte(int8(n)))
+	case n >= math.MinInt16:
+		_ = w.WriteByte(0xd1)
+		return binary.Write(w, binary.BigEndian, int16(n))
+	case n >= math.MinInt32:
+		_ = w.WriteByte(0xd2)
+		return binary.Write(w, binary.BigEndian, int32(n))
+	default:
+		_ = w.WriteByte(0xd3)
+		return binary.Write(w, binary.BigEndian, n)
+	}
+}
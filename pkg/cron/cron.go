@@ -0,0 +1,183 @@
+package cron
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchLimit bounds the search of Prev; every valid schedule fires within it
+const searchLimit = 5 * 366 * 24 * time.Hour
+
+// dayNames are the names accepted for the days of the week
+var dayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+// Schedule is a parsed crontab schedule; each field is a bit set of the matching values
+type Schedule struct {
+	expr   string
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	anyDOM bool // Day of month is *, the day of week alone decides
+	anyDOW bool // Day of week is *, the day of month alone decides
+}
+
+// field describes the values allowed in a field
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var fields = []field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	{name: "day of week", min: 0, max: 7, names: dayNames},
+}
+
+// Parse parses a schedule like "30 7 * * mon-fri"
+func Parse(expr string) (Schedule, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return Schedule{}, fmt.Errorf("invalid schedule '%s', expected minute hour day-of-month month day-of-week", expr)
+	}
+
+	sets := make([]uint64, len(fields))
+	for i, f := range fields {
+		set, err := f.parse(parts[i])
+		if err != nil {
+			return Schedule{}, fmt.Errorf("invalid schedule '%s': %w", expr, err)
+		}
+		sets[i] = set
+	}
+
+	// 7 is another name of Sunday
+	dow := sets[4]
+	if dow&(1<<7) != 0 {
+		dow = dow&^(1<<7) | 1
+	}
+	return Schedule{
+		expr:   strings.Join(parts, " "),
+		minute: sets[0],
+		hour:   sets[1],
+		dom:    sets[2],
+		month:  sets[3],
+		dow:    dow,
+		anyDOM: parts[2] == "*",
+		anyDOW: parts[4] == "*",
+	}, nil
+}
+
+// parse returns the bit set of the values of a field
+func (f field) parse(value string) (uint64, error) {
+	var set uint64
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '|' }) {
+		rng, stepValue, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepValue); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step '%s' of %s", stepValue, f.name)
+			}
+		}
+
+		from, to := f.min, f.max
+		if rng != "*" {
+			start, end, isRange := strings.Cut(rng, "-")
+			var err error
+			if from, err = f.value(start); err != nil {
+				return 0, err
+			}
+			to = from
+			if isRange {
+				if to, err = f.value(end); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				to = f.max
+			}
+			if to < from {
+				return 0, fmt.Errorf("invalid range '%s' of %s", rng, f.name)
+			}
+		}
+		for v := from; v <= to; v += step {
+			set |= 1 << v
+		}
+	}
+	if set == 0 {
+		return 0, fmt.Errorf("empty %s", f.name)
+	}
+	return set, nil
+}
+
+// value parses a single value of the field
+func (f field) value(value string) (int, error) {
+	if v, ok := f.names[strings.ToLower(value)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("invalid %s '%s', expected %d-%d", f.name, value, f.min, f.max)
+	}
+	return v, nil
+}
+
+// String returns the schedule as parsed
+func (s Schedule) String() string {
+	return s.expr
+}
+
+// Matches reports whether the schedule fires in the minute of t
+func (s Schedule) Matches(t time.Time) bool {
+	return s.matchesDay(t) && s.hour&(1<<t.Hour()) != 0 && s.minute&(1<<t.Minute()) != 0
+}
+
+// matchesDay reports whether the schedule fires on the day of t
+func (s Schedule) matchesDay(t time.Time) bool {
+	if s.month&(1<<int(t.Month())) == 0 {
+		return false
+	}
+	dom := s.dom&(1<<t.Day()) != 0
+	dow := s.dow&(1<<int(t.Weekday())) != 0
+	switch {
+	case s.anyDOM && s.anyDOW:
+		return true
+	case s.anyDOM:
+		return dow
+	case s.anyDOW:
+		return dom
+	default:
+		return dom || dow
+	}
+}
+
+// Prev returns the last minute at or before t in which the schedule fires,
+// in the location of t. It reports false for schedules that never fire, like
+// on February 30th.
+func (s Schedule) Prev(t time.Time) (time.Time, bool) {
+	t = t.Truncate(time.Minute)
+	limit := t.Add(-searchLimit)
+	for !t.Before(limit) {
+		if !s.matchesDay(t) {
+			// Last minute of the day before
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location()).Add(-time.Minute)
+			continue
+		}
+		if s.hour&(1<<t.Hour()) == 0 {
+			t = t.Add(-time.Duration(t.Minute()+1) * time.Minute)
+			continue
+		}
+		// The last matching minute of the hour up to the current one
+		if below := s.minute & (1<<(t.Minute()+1) - 1); below != 0 {
+			return t.Add(-time.Duration(t.Minute()-(63-bits.LeadingZeros64(below))) * time.Minute), true
+		}
+		t = t.Add(-time.Duration(t.Minute()+1) * time.Minute)
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,87 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	valid := []string{"* * * * *", "0 22 * * *", "30 7 * * mon-fri", "0 9 * * sat|sun", "*/15 8-18/2 1,15 * 0-7"}
+	for _, expr := range valid {
+		if _, err := Parse(expr); err != nil {
+			t.Errorf("Parse(%q) failed: %v", expr, err)
+		}
+	}
+
+	invalid := []string{"", "0 22 * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "* * * * fri-mon", "x * * * *"}
+	for _, expr := range invalid {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Expected an error for %q", expr)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	// Sunday, 21 September 2025
+	sunday := time.Date(2025, 9, 21, 22, 0, 0, 0, time.UTC)
+	tests := []struct {
+		expr     string
+		t        time.Time
+		expected bool
+	}{
+		{"0 22 * * *", sunday, true},
+		{"0 22 * * *", sunday.Add(time.Minute), false},
+		{"0 22 * * mon-fri", sunday, false},
+		{"0 22 * * sat|sun", sunday, true},
+		{"0 22 * * 7", sunday, true},
+		{"*/15 * * * *", sunday.Add(45 * time.Minute), true},
+		{"*/15 * * * *", sunday.Add(50 * time.Minute), false},
+		// Day of month or day of week, as in crontab
+		{"0 22 1 * mon", sunday, false},
+		{"0 22 21 * mon", sunday, true},
+		{"0 22 1 * sun", sunday, true},
+		{"0 22 * 10 *", sunday, false},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", tt.expr, err)
+		}
+		if got := s.Matches(tt.t); got != tt.expected {
+			t.Errorf("Expected %q to match %v: %v, got %v", tt.expr, tt.t, tt.expected, got)
+		}
+	}
+}
+
+func TestPrev(t *testing.T) {
+	// Sunday, 21 September 2025
+	now := time.Date(2025, 9, 21, 15, 30, 42, 0, time.UTC)
+	tests := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2025, 9, 21, 15, 30, 0, 0, time.UTC)},
+		{"30 15 * * *", time.Date(2025, 9, 21, 15, 30, 0, 0, time.UTC)},
+		{"0 22 * * *", time.Date(2025, 9, 20, 22, 0, 0, 0, time.UTC)},
+		{"0 7 * * *", time.Date(2025, 9, 21, 7, 0, 0, 0, time.UTC)},
+		{"45 7-9 * * *", time.Date(2025, 9, 21, 9, 45, 0, 0, time.UTC)},
+		{"0 7 * * mon-fri", time.Date(2025, 9, 19, 7, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", tt.expr, err)
+		}
+		prev, ok := s.Prev(now)
+		if !ok || !prev.Equal(tt.expected) {
+			t.Errorf("Expected %q to fire last at %v, got %v (%v)", tt.expr, tt.expected, prev, ok)
+		}
+	}
+
+	s, _ := Parse("0 0 30 2 *")
+	if _, ok := s.Prev(now); ok {
+		t.Error("Expected February 30th never to fire")
+	}
+}
@@ -0,0 +1,14 @@
+// Package cron parses schedules in the five field crontab syntax, minute,
+// hour, day of month, month and day of week, and finds the times they fire:
+//
+//	s, err := cron.Parse("0 22 * * mon-fri")
+//	if err != nil {
+//		return err
+//	}
+//	last, ok := s.Prev(time.Now()) // Last weekday at 22:00
+//
+// Fields are *, a value, a range like 1-5, a step like */15 or 8-18/2, or a
+// list of these separated by , or |. Days of the week are 0-7 (0 and 7 are
+// Sunday) or mon..sun. As in crontab, a schedule restricting both the day of
+// month and the day of week fires on the days matching either.
+package cron
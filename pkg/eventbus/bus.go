@@ -0,0 +1,154 @@
+package eventbus
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+)
+
+// Stats reports the queue usage of a single subscription
+type Stats struct {
+	Name      string `json:"name"`
+	Queued    int    `json:"queued"`    // Events waiting to be consumed
+	Capacity  int    `json:"capacity"`  // Size of the subscription queue
+	Delivered uint64 `json:"delivered"` // Events put on the queue
+	Dropped   uint64 `json:"dropped"`   // Events lost because the queue was full
+}
+
+// Bus fans out published events to all subscriptions. Every subscription has
+// its own bounded queue, so a slow consumer only loses its own events and never
+// blocks the publisher or other consumers.
+type Bus[T any] struct {
+	mu     sync.RWMutex
+	subs   []*Subscription[T]
+	closed bool
+}
+
+// Subscription receives the events published on a bus
+type Subscription[T any] struct {
+	name      string
+	ch        chan T
+	bus       *Bus[T]
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+// New creates an empty bus
+func New[T any]() *Bus[T] {
+	return &Bus[T]{}
+}
+
+// Subscribe adds a consumer with a queue of the given size. The name is used in
+// stats and log messages.
+func (b *Bus[T]) Subscribe(name string, buffer int) *Subscription[T] {
+	if buffer < 0 {
+		buffer = 0
+	}
+
+	sub := &Subscription[T]{
+		name: name,
+		ch:   make(chan T, buffer),
+		bus:  b,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		close(sub.ch)
+		return sub
+	}
+	b.subs = append(b.subs, sub)
+	return sub
+}
+
+// Publish hands the event to every subscription without blocking.
+// Subscriptions with a full queue drop the event.
+func (b *Bus[T]) Publish(event T) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if b.closed {
+		return
+	}
+
+	for _, sub := range b.subs {
+		select {
+		case sub.ch <- event:
+			sub.delivered.Add(1)
+		default:
+			dropped := sub.dropped.Add(1)
+			log.Printf("Event bus: queue of %s is full, dropped event (%d dropped in total)", sub.name, dropped)
+		}
+	}
+}
+
+// Close closes all subscription channels; consumers drain what is left in their queue
+func (b *Bus[T]) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+
+	// Subscriptions are kept so their stats remain available
+	for _, sub := range b.subs {
+		close(sub.ch)
+	}
+}
+
+// Stats returns the stats of all subscriptions that were not unsubscribed
+func (b *Bus[T]) Stats() []Stats {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	stats := make([]Stats, 0, len(b.subs))
+	for _, sub := range b.subs {
+		stats = append(stats, sub.Stats())
+	}
+	return stats
+}
+
+// Name returns the name given on Subscribe
+func (s *Subscription[T]) Name() string {
+	return s.name
+}
+
+// Events returns the queue of the subscription. It is closed on Unsubscribe or
+// when the bus is closed.
+func (s *Subscription[T]) Events() <-chan T {
+	return s.ch
+}
+
+// Unsubscribe removes the subscription from the bus and closes its channel
+func (s *Subscription[T]) Unsubscribe() {
+	b := s.bus
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Close already closed the channel
+	if b.closed {
+		return
+	}
+
+	for i, sub := range b.subs {
+		if sub == s {
+			b.subs = append(b.subs[:i], b.subs[i+1:]...)
+			close(s.ch)
+			return
+		}
+	}
+}
+
+// Stats returns a snapshot of the subscription counters
+func (s *Subscription[T]) Stats() Stats {
+	return Stats{
+		Name:      s.name,
+		Queued:    len(s.ch),
+		Capacity:  cap(s.ch),
+		Delivered: s.delivered.Load(),
+		Dropped:   s.dropped.Load(),
+	}
+}
@@ -0,0 +1,69 @@
+package eventbus
+
+import "testing"
+
+func TestPublishFansOut(t *testing.T) {
+	bus := New[int]()
+	first := bus.Subscribe("first", 2)
+	second := bus.Subscribe("second", 2)
+
+	bus.Publish(1)
+
+	for _, sub := range []*Subscription[int]{first, second} {
+		if got := <-sub.Events(); got != 1 {
+			t.Errorf("%s: expected 1, got %d", sub.Name(), got)
+		}
+	}
+}
+
+func TestFullQueueDropsOnlyForThatSubscriber(t *testing.T) {
+	bus := New[int]()
+	slow := bus.Subscribe("slow", 1)
+	fast := bus.Subscribe("fast", 3)
+
+	for i := 1; i <= 3; i++ {
+		bus.Publish(i)
+	}
+
+	if stats := slow.Stats(); stats.Delivered != 1 || stats.Dropped != 2 || stats.Queued != 1 {
+		t.Errorf("Unexpected stats of slow subscriber: %+v", stats)
+	}
+	if stats := fast.Stats(); stats.Delivered != 3 || stats.Dropped != 0 {
+		t.Errorf("Unexpected stats of fast subscriber: %+v", stats)
+	}
+	if len(bus.Stats()) != 2 {
+		t.Errorf("Expected stats of 2 subscriptions, got %d", len(bus.Stats()))
+	}
+}
+
+func TestUnsubscribeAndClose(t *testing.T) {
+	bus := New[int]()
+	sub := bus.Subscribe("sub", 1)
+	other := bus.Subscribe("other", 1)
+
+	sub.Unsubscribe()
+	if _, ok := <-sub.Events(); ok {
+		t.Error("Expected channel to be closed after Unsubscribe")
+	}
+
+	bus.Publish(1)
+	bus.Close()
+	bus.Publish(2) // Must not panic after Close
+
+	if got, ok := <-other.Events(); !ok || got != 1 {
+		t.Errorf("Expected queued event to survive Close, got %d (ok=%v)", got, ok)
+	}
+	if _, ok := <-other.Events(); ok {
+		t.Error("Expected channel to be closed after Close")
+	}
+
+	if len(bus.Stats()) != 1 {
+		t.Errorf("Expected stats to remain available after Close, got %v", bus.Stats())
+	}
+	other.Unsubscribe() // Must not panic after Close
+
+	late := bus.Subscribe("late", 1)
+	if _, ok := <-late.Events(); ok {
+		t.Error("Expected subscription on closed bus to be closed")
+	}
+}
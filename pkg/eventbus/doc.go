@@ -0,0 +1,5 @@
+// Package eventbus is a small in-process publish/subscribe bus. Every
+// subscription has its own bounded queue; publishing never blocks and events
+// for a full queue are dropped and counted, so consumers apply backpressure
+// independently of each other.
+package eventbus
@@ -0,0 +1,18 @@
+// Package pipeline wires a call event source, the call state machine and any
+// number of sinks together. It is the entry point for embedding the bridge
+// logic into other Go programs:
+//
+//	client, err := callmonitor.NewClient(callmonitor.Options{Host: "fritz.box", CountryCode: "49"})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	p := pipeline.New(pipeline.WithSink(types.CallEventSinkFunc(func(ctx context.Context, event types.CallEvent) error {
+//		log.Printf("%s on line %d: %s", event.Type, event.Line, event.Status)
+//		return nil
+//	})))
+//	if err := client.Connect(ctx); err != nil {
+//		log.Fatal(err)
+//	}
+//	defer p.Close()
+//	err = p.Run(ctx, client)
+package pipeline
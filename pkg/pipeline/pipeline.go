@@ -0,0 +1,193 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/eventbus"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// DefaultSinkBuffer is the number of processed events queued per sink
+const DefaultSinkBuffer = 100
+
+// Source produces call events, e.g. a *callmonitor.Client
+type Source interface {
+	Events() <-chan types.CallEvent
+	Errors() <-chan error
+}
+
+// Pipeline runs call events through the call state machine and publishes the
+// processed events on an event bus. Every sink consumes the bus in its own
+// goroutine, so a slow sink never delays the state machine or other sinks.
+type Pipeline struct {
+	manager    *types.CallManager
+	bus        *eventbus.Bus[types.CallEvent]
+	sinks      []types.CallEventSink
+	sinkBuffer int
+
+	startOnce sync.Once
+	workers   []sinkWorker
+	wg        sync.WaitGroup
+}
+
+// sinkWorker delivers the events of one subscription to one sink
+type sinkWorker struct {
+	sink types.CallEventSink
+	sub  *eventbus.Subscription[types.CallEvent]
+}
+
+// Option configures a Pipeline
+type Option func(*Pipeline)
+
+// WithCallManager uses the given call manager instead of a plain one without MQTT publishing
+func WithCallManager(manager *types.CallManager) Option {
+	return func(p *Pipeline) {
+		p.manager = manager
+	}
+}
+
+// WithSink adds a sink that receives every processed event
+func WithSink(sink types.CallEventSink) Option {
+	return func(p *Pipeline) {
+		p.sinks = append(p.sinks, sink)
+	}
+}
+
+// WithSinkBuffer sets the number of events queued per sink (default: DefaultSinkBuffer)
+func WithSinkBuffer(size int) Option {
+	return func(p *Pipeline) {
+		p.sinkBuffer = size
+	}
+}
+
+// New creates a new pipeline. Sinks are subscribed right away, so events
+// processed before Start are queued and not lost.
+func New(opts ...Option) *Pipeline {
+	p := &Pipeline{
+		bus:        eventbus.New[types.CallEvent](),
+		sinkBuffer: DefaultSinkBuffer,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	if p.manager == nil {
+		p.manager = types.NewCallManager(nil)
+	}
+
+	for _, sink := range p.sinks {
+		p.workers = append(p.workers, sinkWorker{
+			sink: sink,
+			sub:  p.bus.Subscribe(sinkName(sink), p.sinkBuffer),
+		})
+	}
+
+	return p
+}
+
+// sinkName names the queue of a sink by its type; sinks wrapping another one
+// with an Unwrap method are named by the sink they wrap
+func sinkName(sink types.CallEventSink) string {
+	if wrapper, ok := sink.(interface{ Unwrap() types.CallEventSink }); ok {
+		return sinkName(wrapper.Unwrap())
+	}
+	return fmt.Sprintf("%T", sink)
+}
+
+// CallManager returns the call manager holding the line states
+func (p *Pipeline) CallManager() *types.CallManager {
+	return p.manager
+}
+
+// Subscribe adds a consumer of processed events next to the sinks, e.g. for
+// notifications. The subscription is closed by Close.
+func (p *Pipeline) Subscribe(name string, buffer int) *eventbus.Subscription[types.CallEvent] {
+	return p.bus.Subscribe(name, buffer)
+}
+
+// Stats returns the queue stats of all sinks and subscribers
+func (p *Pipeline) Stats() []eventbus.Stats {
+	return p.bus.Stats()
+}
+
+// Start launches one goroutine per sink. Sinks receive ctx with every event.
+// Calling Start more than once has no effect.
+func (p *Pipeline) Start(ctx context.Context) {
+	p.startOnce.Do(func() {
+		for _, w := range p.workers {
+			p.wg.Add(1)
+			go p.runSink(ctx, w)
+		}
+	})
+}
+
+// Close stops accepting events and waits until the sinks have drained their queues
+func (p *Pipeline) Close() {
+	_ = p.Shutdown(context.Background())
+}
+
+// Shutdown stops accepting events and waits until the sinks have drained their
+// queues or ctx is done. It returns an error if events were left undelivered;
+// sinks keep running until the context passed to Start is cancelled.
+func (p *Pipeline) Shutdown(ctx context.Context) error {
+	p.bus.Close()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		queued := 0
+		for _, stats := range p.bus.Stats() {
+			queued += stats.Queued
+		}
+		return fmt.Errorf("%d events left in sink queues: %w", queued, ctx.Err())
+	}
+}
+
+// runSink delivers queued events to a sink until its subscription is closed
+func (p *Pipeline) runSink(ctx context.Context, w sinkWorker) {
+	defer p.wg.Done()
+
+	for event := range w.sub.Events() {
+		if err := w.sink.PublishCallEvent(ctx, event); err != nil {
+			log.Printf("Sink %s failed to handle call event %s: %v", w.sub.Name(), event.ID, err)
+		}
+	}
+}
+
+// Process runs a single event through the state machine and publishes the
+// processed event to all sinks and subscribers. It never waits for sinks.
+func (p *Pipeline) Process(event types.CallEvent) *types.CallEvent {
+	processed := p.manager.ProcessEvent(&event)
+	p.bus.Publish(*processed)
+	return processed
+}
+
+// Run starts the sinks and processes events from the source until the context
+// is cancelled or the source reports an error. Call Close afterwards to drain
+// the sinks.
+func (p *Pipeline) Run(ctx context.Context, source Source) error {
+	p.Start(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event := <-source.Events():
+			p.Process(event)
+
+		case err := <-source.Errors():
+			return fmt.Errorf("callmonitor error: %w", err)
+		}
+	}
+}
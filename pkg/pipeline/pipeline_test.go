@@ -0,0 +1,270 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// fakeSource is an in-memory event source
+type fakeSource struct {
+	events chan types.CallEvent
+	errors chan error
+}
+
+func newFakeSource() *fakeSource {
+	return &fakeSource{
+		events: make(chan types.CallEvent, 10),
+		errors: make(chan error, 1),
+	}
+}
+
+func (s *fakeSource) Events() <-chan types.CallEvent { return s.events }
+func (s *fakeSource) Errors() <-chan error           { return s.errors }
+
+func TestProcessUpdatesStatusAndNotifiesSinks(t *testing.T) {
+	var mu sync.Mutex
+	var received []types.CallEvent
+	failing := types.CallEventSinkFunc(func(_ context.Context, event types.CallEvent) error {
+		return errors.New("sink down")
+	})
+	recording := types.CallEventSinkFunc(func(_ context.Context, event types.CallEvent) error {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, event)
+		return nil
+	})
+
+	p := New(WithSink(failing), WithSink(recording))
+	defer p.CallManager().Cleanup()
+	p.Start(context.Background())
+
+	processed := p.Process(types.CallEvent{Type: types.CallTypeRing, Line: 0})
+	if processed.Status != types.CallStatusRinging {
+		t.Errorf("Expected status ringing, got %s", processed.Status)
+	}
+
+	// Close drains the sink queues
+	p.Close()
+
+	// The failing sink must not keep the event from other sinks
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 1 || received[0].Status != types.CallStatusRinging {
+		t.Errorf("Expected recording sink to receive processed event, got %+v", received)
+	}
+}
+
+func TestSlowSinkDoesNotBlockProcessing(t *testing.T) {
+	release := make(chan struct{})
+	blocking := types.CallEventSinkFunc(func(_ context.Context, event types.CallEvent) error {
+		<-release
+		return nil
+	})
+	delivered := make(chan types.CallEvent, 10)
+	fast := types.CallEventSinkFunc(func(_ context.Context, event types.CallEvent) error {
+		delivered <- event
+		return nil
+	})
+
+	p := New(WithSink(blocking), WithSink(fast), WithSinkBuffer(1))
+	defer p.CallManager().Cleanup()
+	p.Start(context.Background())
+
+	// More events than the blocking sink can queue
+	done := make(chan struct{})
+	go func() {
+		for line := 0; line < 5; line++ {
+			p.Process(types.CallEvent{Type: types.CallTypeCall, Line: line})
+			// Give the fast sink time to drain its single slot
+			select {
+			case <-delivered:
+			case <-time.After(time.Second):
+			}
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Processing was blocked by a slow sink")
+	}
+
+	var dropped uint64
+	for _, stats := range p.Stats() {
+		dropped += stats.Dropped
+	}
+	if dropped == 0 {
+		t.Error("Expected events of the blocked sink to be dropped")
+	}
+
+	close(release)
+	p.Close()
+}
+
+func TestSubscribe(t *testing.T) {
+	p := New()
+	defer p.CallManager().Cleanup()
+
+	sub := p.Subscribe("notifier", 1)
+	p.Process(types.CallEvent{Type: types.CallTypeRing, Line: 3})
+
+	select {
+	case event := <-sub.Events():
+		if event.Line != 3 || event.Status != types.CallStatusRinging {
+			t.Errorf("Unexpected event %+v", event)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Subscriber did not receive event")
+	}
+
+	p.Close()
+	if _, ok := <-sub.Events(); ok {
+		t.Error("Expected subscription to be closed by Close")
+	}
+}
+
+func TestRunStopsOnSourceError(t *testing.T) {
+	source := newFakeSource()
+	processed := make(chan types.CallEvent, 1)
+	p := New(WithSink(types.CallEventSinkFunc(func(_ context.Context, event types.CallEvent) error {
+		processed <- event
+		return nil
+	})))
+	defer p.CallManager().Cleanup()
+	defer p.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- p.Run(context.Background(), source) }()
+
+	source.events <- types.CallEvent{Type: types.CallTypeCall, Line: 1}
+	select {
+	case event := <-processed:
+		if event.Status != types.CallStatusCalling {
+			t.Errorf("Expected status calling, got %s", event.Status)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Event was not processed")
+	}
+
+	source.errors <- errors.New("connection closed by remote")
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Expected source error to be returned")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run did not stop on source error")
+	}
+}
+
+func TestRunStopsOnContextCancel(t *testing.T) {
+	p := New()
+	defer p.CallManager().Cleanup()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- p.Run(ctx, newFakeSource()) }()
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Expected nil error on cancel, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run did not stop on context cancel")
+	}
+}
+
+func TestWithCallManager(t *testing.T) {
+	manager := types.NewCallManager(nil)
+	defer manager.Cleanup()
+
+	if got := New(WithCallManager(manager)).CallManager(); got != manager {
+		t.Error("Expected pipeline to use the given call manager")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	t.Run("drains queues", func(t *testing.T) {
+		var mu sync.Mutex
+		delivered := 0
+		slow := types.CallEventSinkFunc(func(_ context.Context, event types.CallEvent) error {
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			defer mu.Unlock()
+			delivered++
+			return nil
+		})
+
+		p := New(WithSink(slow))
+		defer p.CallManager().Cleanup()
+		p.Start(context.Background())
+
+		for line := 0; line < 5; line++ {
+			p.Process(types.CallEvent{Type: types.CallTypeRing, Line: line})
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := p.Shutdown(ctx); err != nil {
+			t.Fatalf("Shutdown failed: %v", err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if delivered != 5 {
+			t.Errorf("Expected all 5 events to be delivered, got %d", delivered)
+		}
+	})
+
+	t.Run("gives up on timeout", func(t *testing.T) {
+		sinkCtx, stopSinks := context.WithCancel(context.Background())
+		blocking := types.CallEventSinkFunc(func(ctx context.Context, event types.CallEvent) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+		p := New(WithSink(blocking))
+		defer p.CallManager().Cleanup()
+		p.Start(sinkCtx)
+
+		p.Process(types.CallEvent{Type: types.CallTypeRing, Line: 0})
+		p.Process(types.CallEvent{Type: types.CallTypeRing, Line: 1})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := p.Shutdown(ctx)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected deadline error, got %v", err)
+		}
+
+		// Cancelling the sink context releases the blocked sink
+		stopSinks()
+		p.Close()
+	})
+}
+
+// wrappingSink passes events on to another sink
+type wrappingSink struct {
+	types.CallEventSink
+}
+
+func (s wrappingSink) Unwrap() types.CallEventSink { return s.CallEventSink }
+
+func TestSinkNameOfWrappedSink(t *testing.T) {
+	inner := types.CallEventSinkFunc(func(context.Context, types.CallEvent) error { return nil })
+	p := New(WithSink(wrappingSink{inner}))
+	defer p.Close()
+
+	stats := p.Stats()
+	if len(stats) != 1 || stats[0].Name != "types.CallEventSinkFunc" {
+		t.Errorf("Expected the queue to be named after the wrapped sink, got %+v", stats)
+	}
+}
@@ -0,0 +1,11 @@
+// Package seal encrypts payloads with a shared symmetric key, so call
+// metadata can pass a broker that is not trusted. Consumers holding the key
+// open the payloads again:
+//
+//	key, err := seal.ParseKey(os.Getenv("FRITZ_CALLMONITOR_MQTT_ENCRYPTION_KEY"))
+//	payload, err := seal.Open(key, msg.Payload())
+//
+// Payloads are encrypted with AES-256-GCM and a random nonce. A sealed
+// payload is a version byte, the nonce and the ciphertext including the
+// authentication tag, 29 bytes more than the plaintext.
+package seal
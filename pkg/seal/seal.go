@@ -0,0 +1,94 @@
+package seal
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// KeySize is the length of a key in bytes
+const KeySize = 32
+
+// version is the first byte of every sealed payload
+const version byte = 1
+
+// ErrInvalid is returned for payloads that were not sealed with the key
+var ErrInvalid = errors.New("invalid sealed payload")
+
+// Key is a shared key, written as base64 in the configuration
+type Key [KeySize]byte
+
+// GenerateKey returns a new random key
+func GenerateKey() (Key, error) {
+	var key Key
+	if _, err := rand.Read(key[:]); err != nil {
+		return Key{}, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return key, nil
+}
+
+// ParseKey parses a base64 encoded key, with or without padding
+func ParseKey(s string) (Key, error) {
+	data, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(strings.TrimSpace(s), "="))
+	if err != nil {
+		return Key{}, fmt.Errorf("invalid key: %w", err)
+	}
+	if len(data) != KeySize {
+		return Key{}, fmt.Errorf("invalid key: expected %d bytes, got %d", KeySize, len(data))
+	}
+	return Key(data), nil
+}
+
+// String returns the key as base64
+func (k Key) String() string {
+	return base64.StdEncoding.EncodeToString(k[:])
+}
+
+// Seal encrypts plaintext with the key
+func Seal(key Key, plaintext []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	sealed := make([]byte, 1+aead.NonceSize(), 1+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	sealed[0] = version
+	if _, err := rand.Read(sealed[1:]); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(sealed, sealed[1:], plaintext, nil), nil
+}
+
+// Open decrypts a payload sealed with the key. It returns ErrInvalid if the
+// payload was not sealed with the key or was altered.
+func Open(key Key, payload []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) < 1+aead.NonceSize()+aead.Overhead() || payload[0] != version {
+		return nil, ErrInvalid
+	}
+	nonce, ciphertext := payload[1:1+aead.NonceSize()], payload[1+aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, ErrInvalid
+	}
+	return plaintext, nil
+}
+
+// newAEAD returns the AES-256-GCM cipher of the key
+func newAEAD(key Key) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return aead, nil
+}
@@ -0,0 +1,66 @@
+package seal
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSealAndOpen(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	plaintext := []byte(`{"caller":"+4930123456","line":1}`)
+
+	sealed, err := Seal(key, plaintext)
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	if len(sealed) != len(plaintext)+29 || sealed[0] != version || bytes.Contains(sealed, []byte("4930123456")) {
+		t.Errorf("Unexpected sealed payload %x", sealed)
+	}
+	again, _ := Seal(key, plaintext)
+	if bytes.Equal(sealed, again) {
+		t.Error("Expected a new nonce for every payload")
+	}
+
+	opened, err := Open(key, sealed)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if !bytes.Equal(opened, plaintext) {
+		t.Errorf("Expected %s, got %s", plaintext, opened)
+	}
+
+	altered := bytes.Clone(sealed)
+	altered[len(altered)-1] ^= 1
+	other, _ := GenerateKey()
+	for name, payload := range map[string][]byte{"altered": altered, "short": sealed[:20], "plain": plaintext} {
+		if _, err := Open(key, payload); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Expected ErrInvalid for %s payload, got %v", name, err)
+		}
+	}
+	if _, err := Open(other, sealed); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Expected ErrInvalid for another key, got %v", err)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	key, _ := GenerateKey()
+	for _, text := range []string{key.String(), " " + key.String() + "\n"} {
+		parsed, err := ParseKey(text)
+		if err != nil {
+			t.Fatalf("ParseKey failed: %v", err)
+		}
+		if parsed != key {
+			t.Errorf("Expected %s, got %s", key, parsed)
+		}
+	}
+
+	for _, text := range []string{"", "not base64!", "c2hvcnQ="} {
+		if _, err := ParseKey(text); err == nil {
+			t.Errorf("Expected '%s' to be rejected", text)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package types
+
+import "time"
+
+// ActiveCall is a call between RING/CALL and DISCONNECT as saved for a
+// restart, so its CONNECT and DISCONNECT events keep their call after the
+// bridge came back. A call ringing on several connection IDs is saved once
+// per connection ID.
+type ActiveCall struct {
+	ID           string        `json:"id"`
+	Line         int           `json:"line"` // Connection ID of the RING or CALL
+	Started      time.Time     `json:"started"`
+	Trunk        string        `json:"trunk"`
+	Direction    CallDirection `json:"direction"`
+	Caller       string        `json:"caller"`
+	Called       string        `json:"called"`
+	CallerRaw    string        `json:"caller_raw,omitempty"` // Caller as received, before normalization
+	CalledRaw    string        `json:"called_raw,omitempty"`
+	Extension    string        `json:"extension,omitempty"`    // Extension that answered a ring group
+	ConnectedAt  *time.Time    `json:"connected_at,omitempty"` // Timestamp of the CONNECT
+	ConnectedOn  *time.Time    `json:"connected_on,omitempty"` // Local clock at CONNECT
+	DoNotRecord  bool          `json:"do_not_record,omitempty"`
+	Filtered     bool          `json:"filtered,omitempty"`
+	MessageBox   bool          `json:"message_box,omitempty"`
+	RingGroup    []int         `json:"ring_group,omitempty"` // Connection IDs of the ring group, first RING first
+	Tags         []string      `json:"tags,omitempty"`
+	Priority     bool          `json:"priority,omitempty"`
+	RepeatCount  int           `json:"repeat_count,omitempty"` // Attempts of the caller in a row, see CallEvent.RepeatCount
+	Internal     bool          `json:"internal,omitempty"`
+	NumberType   NumberType    `json:"number_type,omitempty"`
+	ParentCallID string        `json:"parent_call_id,omitempty"` // Inbound call an outbound forwarding call belongs to
+	ForwardedTo  string        `json:"forwarded_to,omitempty"`   // Number an inbound call was forwarded to
+}
+
+// EventLine returns the line the events of the call are delivered on
+func (c ActiveCall) EventLine() int {
+	if len(c.RingGroup) > 0 {
+		return c.RingGroup[0]
+	}
+	return c.Line
+}
+
+// State returns the FSM state the call is in
+func (c ActiveCall) State() CallStatus {
+	switch {
+	case c.ConnectedAt != nil && c.MessageBox:
+		return CallStatusMessageBox
+	case c.ConnectedAt != nil:
+		return CallStatusTalking
+	case c.Direction == CallDirectionOutbound:
+		return CallStatusCalling
+	default:
+		return CallStatusRinging
+	}
+}
@@ -1,8 +1,11 @@
 package types
 
 import (
+	"slices"
 	"strings"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // CallType represents the type of call event
@@ -37,23 +40,79 @@ const (
 	CallDirectionOutbound CallDirection = "outbound"
 )
 
+// NumberType classifies the number of the other party of a call
+type NumberType string
+
+const (
+	NumberTypeEmergency     NumberType = "emergency"     // Emergency numbers, e.g. 110 or 112
+	NumberTypePremium       NumberType = "premium"       // Premium rate numbers, e.g. 0900
+	NumberTypeService       NumberType = "service"       // Short codes, toll-free and shared cost numbers, e.g. 11833 or 0800
+	NumberTypeMobile        NumberType = "mobile"        // Mobile numbers of the own country
+	NumberTypeLandline      NumberType = "landline"      // Landline and VoIP numbers of the own country
+	NumberTypeInternational NumberType = "international" // Numbers of other countries
+)
+
+// NewCallID returns the ID of a new call, a UUID v7 ordered by the start of
+// the call. All call IDs are generated here, so the topics, the FSM and the
+// database rows of a call always share one ID.
+func NewCallID() string {
+	id, err := uuid.NewV7()
+	if err != nil {
+		// Fails only without a random source, which NewString panics on
+		return uuid.NewString()
+	}
+	return id.String()
+}
+
 // CallEvent represents a single call monitor event from Fritz!Box
 type CallEvent struct {
-	ID          string        `json:"id"` // UUID v7 for tracking calls across states
-	Timestamp   time.Time     `json:"timestamp"`
-	Type        CallType      `json:"type"`
-	Direction   CallDirection `json:"direction"`              // Call direction (inbound/outbound)
-	Line        int           `json:"line"`                   // Line ID
-	Trunk       string        `json:"trunk,omitempty"`        // SIP line ID
-	Extension   string        `json:"extension,omitempty"`    // Internal extension (e.g., "1", "2")
-	Caller      string        `json:"caller,omitempty"`       // Calling number
-	Called      string        `json:"called,omitempty"`       // Called number
-	CallerMSN   string        `json:"caller_msn,omitempty"`   // MSN if caller matches configured MSNs
-	CalledMSN   string        `json:"called_msn,omitempty"`   // MSN if called matches configured MSNs
-	Duration    int           `json:"duration,omitempty"`     // Duration in seconds (for end events)
-	Status      CallStatus    `json:"status"`                 // Current FSM status
-	FinishState *CallStatus   `json:"finish_state,omitempty"` // Final status before idle (missedCall, notReached, finished)
-	RawMessage  string        `json:"raw_message,omitempty"`  // Original Fritz!Box message
+	ID               string         `json:"id"` // UUID v7 for tracking calls across states
+	Timestamp        time.Time      `json:"timestamp"`
+	Type             CallType       `json:"type"`
+	Direction        CallDirection  `json:"direction"`                   // Call direction (inbound/outbound)
+	Line             int            `json:"line"`                        // Line ID
+	Trunk            string         `json:"trunk,omitempty"`             // SIP line ID
+	TrunkName        string         `json:"trunk_name,omitempty"`        // Configured name of the SIP line
+	Extension        string         `json:"extension,omitempty"`         // Internal extension (e.g., "1", "2")
+	ExtensionName    string         `json:"extension_name,omitempty"`    // Configured name of the extension
+	Caller           string         `json:"caller,omitempty"`            // Calling number
+	Called           string         `json:"called,omitempty"`            // Called number
+	CallerMSN        string         `json:"caller_msn,omitempty"`        // MSN if caller matches configured MSNs
+	CalledMSN        string         `json:"called_msn,omitempty"`        // MSN if called matches configured MSNs
+	CallerMSNName    string         `json:"caller_msn_name,omitempty"`   // Configured name of the caller MSN
+	CalledMSNName    string         `json:"called_msn_name,omitempty"`   // Configured name of the called MSN
+	Duration         int            `json:"duration,omitempty"`          // Duration in seconds (for end events)
+	MeasuredDuration int            `json:"measured_duration,omitempty"` // Talk time measured by the bridge since CONNECT
+	DurationMismatch bool           `json:"duration_mismatch,omitempty"` // Reported and measured duration differ by more than a few seconds
+	Status           CallStatus     `json:"status"`                      // Current FSM status
+	FinishState      *CallStatus    `json:"finish_state,omitempty"`      // Final status before idle (missedCall, notReached, finished)
+	RawMessage       string         `json:"raw_message,omitempty"`       // Original Fritz!Box message
+	DoNotRecord      bool           `json:"do_not_record,omitempty"`     // Call involves an opted-out MSN/extension and must not be logged
+	MessageBox       bool           `json:"message_box,omitempty"`       // Call was answered by the answering machine (TAM)
+	RingGroup        []int          `json:"ring_group,omitempty"`        // Connection IDs of an inbound call that rang on several lines
+	Tags             []string       `json:"tags,omitempty"`              // Tags of the matching tag rules, e.g. "work"
+	Priority         bool           `json:"priority,omitempty"`          // Inbound call of a caller on the VIP list
+	RepeatCall       bool           `json:"repeat_call,omitempty"`       // Caller called again within the repeat call window of the previous attempt
+	RepeatCount      int            `json:"repeat_count,omitempty"`      // Attempts of the caller in a row, including this one; set with RepeatCall
+	Internal         bool           `json:"is_internal,omitempty"`       // Call between extensions of the Fritz!Box, dialed with **
+	NumberType       NumberType     `json:"number_type,omitempty"`       // Type of the caller's number on inbound calls, of the called number on outbound calls
+	Forwarded        bool           `json:"forwarded,omitempty"`         // Inbound call forwarded by the Fritz!Box, or the outbound call forwarding it
+	ParentCallID     string         `json:"parent_call_id,omitempty"`    // Inbound call an outbound forwarding call belongs to
+	ForwardedTo      string         `json:"forwarded_to,omitempty"`      // Number an inbound call was forwarded to
+	Enrichment       map[string]any `json:"enrichment,omitempty"`        // Fields added by the enrichment hook, e.g. a CRM lookup
+	Transition       *Transition    `json:"-"`                           // FSM transition caused by the event, stored with the call
+
+	CallerRaw     string         `json:"-"`                        // Caller as received from the Fritz!Box, before normalization
+	CalledRaw     string         `json:"-"`                        // Called as received from the Fritz!Box, before normalization
+	CallerNumbers *NumberFormats `json:"caller_numbers,omitempty"` // Caller in every number format, only with the number format all
+	CalledNumbers *NumberFormats `json:"called_numbers,omitempty"` // Called in every number format, only with the number format all
+}
+
+// NumberFormats is a phone number in every payload number format
+type NumberFormats struct {
+	E164     string `json:"e164"`     // Normalized, e.g. "+4930123456"
+	National string `json:"national"` // National format of the own country, e.g. "030 123456"; international format otherwise
+	Raw      string `json:"raw"`      // As received from the Fritz!Box
 }
 
 // LineStatus represents the current status of a phone line
@@ -61,6 +120,7 @@ type LineStatus struct {
 	ID          string                `json:"id"`
 	Line        int                   `json:"line"`
 	Trunk       string                `json:"trunk"`
+	TrunkName   string                `json:"trunk_name,omitempty"`
 	Direction   CallDirection         `json:"direction"`
 	Extension   LineStatusExtension   `json:"extension"`
 	Status      CallStatus            `json:"status"`
@@ -70,6 +130,7 @@ type LineStatus struct {
 	Duration    *int                  `json:"duration,omitempty"`
 	LastEvent   string                `json:"last_event"`
 	LastUpdated time.Time             `json:"last_updated"`
+	Sequence    uint64                `json:"sequence,omitempty"` // Increases with every publish of the line status, also across restarts
 }
 
 type LineStatusParticipant struct {
@@ -91,17 +152,45 @@ type CallHistory struct {
 
 // ServiceStatus represents the online/offline status of the service
 type ServiceStatus struct {
-	State       string    `json:"state"`        // "online" or "offline"
-	LastChanged time.Time `json:"last_changed"` // When the state changed
+	State       string    `json:"state"`               // "online" or "offline"
+	LastChanged time.Time `json:"last_changed"`        // When the state changed
+	Broker      string    `json:"broker,omitempty"`    // Broker the bridge is connected to as host:port, only while online
+	ACLCheck    *ACLCheck `json:"acl_check,omitempty"` // Result of the ACL self-test of the connection, only while online
+}
+
+// ACLCheck is the result of the self-test checking that the broker delivers
+// messages published below the topic prefix
+type ACLCheck struct {
+	Result    string    `json:"result"`          // passed or failed
+	Topic     string    `json:"topic"`           // Topic of the test message
+	Error     string    `json:"error,omitempty"` // Why the test failed
+	CheckedAt time.Time `json:"checked_at"`
 }
 
 // AddCall adds a new call to the history, maintaining the maximum size
 func (ch *CallHistory) AddCall(event CallEvent) {
+	ch.AddCallAt(event, time.Now())
+}
+
+// AddCallAt is AddCall with the given time as update time
+func (ch *CallHistory) AddCallAt(event CallEvent, now time.Time) {
 	ch.Calls = append([]CallEvent{event}, ch.Calls...)
 	if len(ch.Calls) > ch.MaxSize {
 		ch.Calls = ch.Calls[:ch.MaxSize]
 	}
-	ch.UpdatedAt = time.Now()
+	ch.UpdatedAt = now
+}
+
+// AddOlderCallsAt adds calls from before all calls of the history, e.g.
+// imported ones, behind them. events must be ordered oldest first.
+func (ch *CallHistory) AddOlderCallsAt(events []CallEvent, now time.Time) {
+	for _, event := range slices.Backward(events) {
+		if len(ch.Calls) >= ch.MaxSize {
+			break
+		}
+		ch.Calls = append(ch.Calls, event)
+	}
+	ch.UpdatedAt = now
 }
 
 // DetectMSN checks if a phone number ends with one of the configured MSNs
@@ -120,7 +209,32 @@ func DetectMSN(phoneNumber string, msns []string) string {
 }
 
 // EnrichWithMSNs adds MSN information to a CallEvent based on configured MSNs
-func (ce *CallEvent) EnrichWithMSNs(msns []string) {
-	ce.CallerMSN = DetectMSN(ce.Caller, msns)
-	ce.CalledMSN = DetectMSN(ce.Called, msns)
+// and their names, see ParseMSNs
+func (ce *CallEvent) EnrichWithMSNs(msns []string, names map[string]string) {
+	ce.CallerMSN, ce.CalledMSN = "", ""
+	// An internal dial code like **610 would match the MSN 610 by its suffix
+	if !IsInternalNumber(ce.Caller) {
+		ce.CallerMSN = DetectMSN(ce.Caller, msns)
+	}
+	if !IsInternalNumber(ce.Called) {
+		ce.CalledMSN = DetectMSN(ce.Called, msns)
+	}
+	ce.CallerMSNName, ce.CalledMSNName = names[ce.CallerMSN], names[ce.CalledMSN]
+}
+
+// MatchesDoNotRecord checks if the call involves one of the given opted-out MSNs or extensions
+func (ce *CallEvent) MatchesDoNotRecord(entries []string) bool {
+	if DetectMSN(ce.Caller, entries) != "" || DetectMSN(ce.Called, entries) != "" {
+		return true
+	}
+
+	if ce.Extension == "" {
+		return false
+	}
+	for _, entry := range entries {
+		if entry == ce.Extension {
+			return true
+		}
+	}
+	return false
 }
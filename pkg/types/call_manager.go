@@ -1,16 +1,24 @@
 package types
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
 )
 
+// ErrInvalidTransition marks an event the FSM of its call does not accept,
+// e.g. a CONNECT on an idle line
+var ErrInvalidTransition = errors.New("invalid transition")
+
 // CallManager demonstrates how to use the LineStateMachine for call management
 type CallManager struct {
 	lineStateMachine *LineStateMachine
 	onStatusChange   func(line int, oldStatus, newStatus CallStatus, event *CallEvent)
 	mqttPublisher    MQTTPublisher
+	onInvalidEvent   func(event *CallEvent, err error)
 }
 
 // NewCallManager creates a new call manager with FSM
@@ -57,16 +65,19 @@ func (cm *CallManager) ProcessEvent(event *CallEvent) *CallEvent {
 	// Validate event
 	if err := cm.validateEvent(event); err != nil {
 		log.Printf("Invalid event: %v", err)
+		if cm.onInvalidEvent != nil {
+			cm.onInvalidEvent(event, err)
+		}
 		return event
 	}
 
-	// Process through FSM
-	oldStatus := cm.lineStateMachine.GetLineState(event.Line)
+	// Process through the FSM of the call
+	oldStatus := cm.lineStateMachine.GetCallState(event)
 	newStatus := cm.lineStateMachine.ProcessCallEvent(event)
 
 	// Update event with current FSM status and finish state
 	event.Status = newStatus
-	event.FinishState = cm.lineStateMachine.GetLineFinishState(event.Line)
+	event.FinishState = cm.lineStateMachine.GetCallFinishState(event)
 
 	// Log transition if status changed
 	if oldStatus != newStatus {
@@ -95,11 +106,11 @@ func (cm *CallManager) validateEvent(event *CallEvent) error {
 		return fmt.Errorf("event type cannot be empty")
 	}
 
-	// Check if transition is valid
-	if !cm.lineStateMachine.IsValidTransition(event.Line, event.Type) {
-		currentState := cm.lineStateMachine.GetLineState(event.Line)
-		return fmt.Errorf("invalid transition: %s event not allowed in %s state for line %d",
-			event.Type, currentState, event.Line)
+	// Check if transition is valid for the call
+	if !cm.lineStateMachine.IsValidCallTransition(event) {
+		currentState := cm.lineStateMachine.GetCallState(event)
+		return fmt.Errorf("%w: %s event not allowed in %s state for line %d",
+			ErrInvalidTransition, event.Type, currentState, event.Line)
 	}
 
 	return nil
@@ -120,12 +131,34 @@ func (cm *CallManager) ResetLine(line int) {
 	cm.lineStateMachine.ResetLine(line)
 }
 
+// RestoreCall continues a call that was active before a restart in its state
+func (cm *CallManager) RestoreCall(call ActiveCall) {
+	cm.lineStateMachine.RestoreCall(call)
+}
+
 // SetMQTTPublisher sets the MQTT publisher for status changes
 func (cm *CallManager) SetMQTTPublisher(publisher MQTTPublisher) {
 	cm.mqttPublisher = publisher
 	cm.lineStateMachine.SetMQTTPublisher(publisher)
 }
 
+// SetInvalidEventHandler sets the function called with events that are
+// passed on unprocessed because they failed validation
+func (cm *CallManager) SetInvalidEventHandler(handler func(event *CallEvent, err error)) {
+	cm.onInvalidEvent = handler
+}
+
+// SetClock sets the clock used by the line state machines for timeouts
+func (cm *CallManager) SetClock(c clock.Clock) {
+	cm.lineStateMachine.SetClock(c)
+}
+
+// SetFinishTimeouts sets how long finish states are shown, for all lines and
+// by line; 0 keeps the finish state until the next call on the line
+func (cm *CallManager) SetFinishTimeouts(timeout time.Duration, lines map[int]time.Duration) {
+	cm.lineStateMachine.SetFinishTimeouts(timeout, lines)
+}
+
 // GetActiveLines returns all lines that have active state machines
 func (cm *CallManager) GetActiveLines() []int {
 	return cm.lineStateMachine.GetActiveLines()
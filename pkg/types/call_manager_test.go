@@ -1,6 +1,7 @@
 package types
 
 import (
+	"errors"
 	"testing"
 	"time"
 )
@@ -129,6 +130,23 @@ func TestCallManagerValidation(t *testing.T) {
 	}
 }
 
+func TestCallManagerInvalidEventHandler(t *testing.T) {
+	cm := NewCallManager(nil)
+	defer cm.Cleanup()
+
+	var invalid []error
+	cm.SetInvalidEventHandler(func(event *CallEvent, err error) {
+		invalid = append(invalid, err)
+	})
+
+	cm.ProcessEvent(&CallEvent{ID: "call-1", Line: 1, Type: CallTypeRing})
+	cm.ProcessEvent(&CallEvent{ID: "call-2", Line: 2, Type: CallTypeConnect})
+
+	if len(invalid) != 1 || !errors.Is(invalid[0], ErrInvalidTransition) {
+		t.Errorf("Expected one invalid transition, got %v", invalid)
+	}
+}
+
 func TestCallManagerGetAllLineStatuses(t *testing.T) {
 	cm := NewCallManager(nil)
 	defer cm.Cleanup()
@@ -384,3 +402,44 @@ func TestCallManagerInvalidTransitionHandling(t *testing.T) {
 		t.Errorf("Expected line to remain ringing, got %v", cm.GetLineStatus(1))
 	}
 }
+
+func TestCallManagerCallWaiting(t *testing.T) {
+	clk := newFakeClock()
+	cm := NewCallManager(nil)
+	cm.SetClock(clk)
+	defer cm.Cleanup()
+
+	// A second call rings on line 0 while the first one is talking and is rejected
+	steps := []struct {
+		event       *CallEvent
+		status      CallStatus
+		lineStatus  CallStatus
+		finishState CallStatus
+	}{
+		{&CallEvent{ID: "first", Line: 0, Type: CallTypeRing}, CallStatusRinging, CallStatusRinging, ""},
+		{&CallEvent{ID: "first", Line: 0, Type: CallTypeConnect}, CallStatusTalking, CallStatusTalking, ""},
+		{&CallEvent{ID: "second", Line: 0, Type: CallTypeRing}, CallStatusRinging, CallStatusRinging, ""},
+		{&CallEvent{ID: "second", Line: 0, Type: CallTypeDisconnect}, CallStatusMissedCall, CallStatusMissedCall, CallStatusMissedCall},
+		{&CallEvent{ID: "first", Line: 0, Type: CallTypeDisconnect, Duration: 60}, CallStatusFinished, CallStatusFinished, CallStatusFinished},
+	}
+
+	for i, step := range steps {
+		event := cm.ProcessEvent(step.event)
+		if event.Status != step.status {
+			t.Errorf("Step %d: expected status %s, got %s", i, step.status, event.Status)
+		}
+		if lineStatus := cm.GetLineStatus(0); lineStatus != step.lineStatus {
+			t.Errorf("Step %d: expected line status %s, got %s", i, step.lineStatus, lineStatus)
+		}
+		if step.finishState != "" && (event.FinishState == nil || *event.FinishState != step.finishState) {
+			t.Errorf("Step %d: expected finish state %s, got %v", i, step.finishState, event.FinishState)
+		}
+	}
+
+	// Finished calls are dropped once the next call starts on the line
+	clk.Advance(finishTimeout)
+	cm.ProcessEvent(&CallEvent{ID: "third", Line: 0, Type: CallTypeCall})
+	if count := cm.lineStateMachine.GetCallCount(); count != 1 {
+		t.Errorf("Expected only the new call to be tracked, got %d calls", count)
+	}
+}
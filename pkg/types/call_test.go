@@ -201,6 +201,7 @@ func TestDetectMSN(t *testing.T) {
 
 func TestCallEvent_EnrichWithMSNs(t *testing.T) {
 	msns := []string{"990133", "990134", "3698237"}
+	names := map[string]string{"990133": "Office"}
 
 	tests := []struct {
 		name           string
@@ -265,7 +266,7 @@ func TestCallEvent_EnrichWithMSNs(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			// Make a copy to avoid modifying the original
 			event := tt.event
-			event.EnrichWithMSNs(tt.msns)
+			event.EnrichWithMSNs(tt.msns, names)
 
 			if event.CallerMSN != tt.expectedCaller {
 				t.Errorf("CallerMSN = %s, expected %s", event.CallerMSN, tt.expectedCaller)
@@ -273,19 +274,47 @@ func TestCallEvent_EnrichWithMSNs(t *testing.T) {
 			if event.CalledMSN != tt.expectedCalled {
 				t.Errorf("CalledMSN = %s, expected %s", event.CalledMSN, tt.expectedCalled)
 			}
+			if event.CallerMSNName != names[tt.expectedCaller] || event.CalledMSNName != names[tt.expectedCalled] {
+				t.Errorf("MSN names = %q, %q, expected the names of %q, %q", event.CallerMSNName, event.CalledMSNName, tt.expectedCaller, tt.expectedCalled)
+			}
+		})
+	}
+}
+
+func TestCallEvent_MatchesDoNotRecord(t *testing.T) {
+	entries := []string{"990133", "21"}
+
+	tests := []struct {
+		name     string
+		event    CallEvent
+		expected bool
+	}{
+		{"called MSN opted out", CallEvent{Caller: "+49123456789", Called: "+496181990133"}, true},
+		{"caller MSN opted out", CallEvent{Caller: "+496181990133", Called: "+49123456789", Extension: "22"}, true},
+		{"extension opted out", CallEvent{Caller: "+496181990134", Called: "+49123456789", Extension: "21"}, true},
+		{"no match", CallEvent{Caller: "+496181990134", Called: "+49123456789", Extension: "22"}, false},
+		{"empty event", CallEvent{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.event.MatchesDoNotRecord(entries); got != tt.expected {
+				t.Errorf("MatchesDoNotRecord() = %v, expected %v", got, tt.expected)
+			}
 		})
 	}
 }
 
 func TestFinishStateTracking(t *testing.T) {
+	clk := newFakeClock()
 	fsm := NewCallStateMachine(nil)
+	fsm.SetClock(clk)
 
 	// Test sequence: Ring -> Disconnect (missed call) -> timeout to Idle
 	fsm.ProcessEvent(CallTypeRing)
 	fsm.ProcessEvent(CallTypeDisconnect) // This triggers MissedCall
 
-	// Wait for timeout transition to idle
-	time.Sleep(1100 * time.Millisecond)
+	clk.Advance(finishTimeout)
 
 	finishState := fsm.GetFinishState()
 	if finishState == nil || *finishState != "missedCall" {
@@ -294,11 +323,11 @@ func TestFinishStateTracking(t *testing.T) {
 
 	// Test sequence: Call -> Disconnect (not reached) -> timeout to Idle
 	fsm2 := NewCallStateMachine(nil)
+	fsm2.SetClock(clk)
 	fsm2.ProcessEvent(CallTypeCall)
 	fsm2.ProcessEvent(CallTypeDisconnect) // This triggers NotReached
 
-	// Wait for timeout transition to idle
-	time.Sleep(1100 * time.Millisecond)
+	clk.Advance(finishTimeout)
 
 	finishState2 := fsm2.GetFinishState()
 	if finishState2 == nil || *finishState2 != "notReached" {
@@ -307,15 +336,31 @@ func TestFinishStateTracking(t *testing.T) {
 
 	// Test sequence: Ring -> Connect -> Disconnect (finished) -> timeout to Idle
 	fsm3 := NewCallStateMachine(nil)
+	fsm3.SetClock(clk)
 	fsm3.ProcessEvent(CallTypeRing)
 	fsm3.ProcessEvent(CallTypeConnect)
 	fsm3.ProcessEvent(CallTypeDisconnect) // This triggers Finished
 
-	// Wait for timeout transition to idle
-	time.Sleep(1100 * time.Millisecond)
+	clk.Advance(finishTimeout)
 
 	finishState3 := fsm3.GetFinishState()
 	if finishState3 == nil || *finishState3 != "finished" {
 		t.Errorf("Expected finish state 'finished', got %v", finishState3)
 	}
 }
+
+func TestCallHistoryAddOlderCalls(t *testing.T) {
+	now := time.Date(2025, 9, 20, 12, 0, 0, 0, time.UTC)
+	history := &CallHistory{MaxSize: 3}
+	history.AddCallAt(CallEvent{Line: 3}, now)
+
+	history.AddOlderCallsAt([]CallEvent{{Line: 0}, {Line: 1}, {Line: 2}}, now)
+
+	var lines []int
+	for _, call := range history.Calls {
+		lines = append(lines, call.Line)
+	}
+	if len(lines) != 3 || lines[0] != 3 || lines[1] != 2 || lines[2] != 1 {
+		t.Errorf("Expected the newest older calls behind the existing call, got lines %v", lines)
+	}
+}
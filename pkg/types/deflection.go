@@ -0,0 +1,13 @@
+package types
+
+// Deflection is a call deflection rule of the Fritz!Box
+type Deflection struct {
+	ID                 int    `json:"id"`
+	Enable             bool   `json:"enable"`
+	Type               string `json:"type"`                 // e.g. fromAll, fromNumber, toMSN
+	Number             string `json:"number,omitempty"`     // Number the rule applies to
+	DeflectionToNumber string `json:"deflection_to_number"` // Target number, empty to reject the call
+	Mode               string `json:"mode"`                 // e.g. eImmediately, eShortDelayed, eVIP
+	Outgoing           string `json:"outgoing,omitempty"`   // Outgoing MSN
+	PhonebookID        string `json:"phonebook_id,omitempty"`
+}
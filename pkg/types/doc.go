@@ -0,0 +1,6 @@
+// Package types contains the call event model and the call state machine.
+//
+// A CallManager runs every CallEvent through a per-line finite state machine
+// (idle, ringing, calling, talking, ...) and reports status changes to an
+// optional MQTTPublisher. Processed events can be handed to any CallEventSink.
+package types
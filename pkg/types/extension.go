@@ -0,0 +1,112 @@
+package types
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ParseExtensionNames parses extension name entries, e.g. "1=Kitchen". The
+// extension is the ID reported by the callmonitor or the internal dial code
+// of the Fritz!Box, e.g. "**620" for the first IP phone (callmonitor ID 20).
+func ParseExtensionNames(entries []string) (map[string]string, error) {
+	names := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		extension, name, ok := strings.Cut(entry, "=")
+		extension, name = strings.TrimSpace(extension), strings.TrimSpace(name)
+		if !ok || extension == "" || name == "" {
+			return nil, fmt.Errorf("invalid extension name '%s', expected extension=name", entry)
+		}
+		id, err := ExtensionID(extension)
+		if err != nil {
+			return nil, err
+		}
+		names[id] = name
+	}
+	return names, nil
+}
+
+// ExtensionID converts an internal dial code to the extension ID of the
+// callmonitor: **1-**3 are the analog ports 0-2, **600-**604 the answering
+// machines 40-44, and **610-**629 the DECT and IP phones 10-29. Other values
+// are returned unchanged.
+func ExtensionID(extension string) (string, error) {
+	code, ok := strings.CutPrefix(extension, "**")
+	if !ok {
+		return extension, nil
+	}
+	n, err := strconv.Atoi(code)
+	switch {
+	case err != nil:
+	case n >= 1 && n <= 3:
+		return strconv.Itoa(n - 1), nil
+	case n >= 600 && n <= 604:
+		return strconv.Itoa(n - 560), nil
+	case n >= 610 && n <= 629:
+		return strconv.Itoa(n - 600), nil
+	}
+	return "", fmt.Errorf("unsupported dial code '%s', expected **1-**3 or **600-**629", extension)
+}
+
+// IsInternalNumber reports whether the number is an internal dial code of
+// the Fritz!Box, e.g. "**610" of a call between two extensions
+func IsInternalNumber(number string) bool {
+	return strings.HasPrefix(strings.TrimSpace(number), "**")
+}
+
+// ExtensionFilter selects the calls that are processed by the MSNs and
+// extensions involved. The zero value allows all calls.
+type ExtensionFilter struct {
+	Allow []string // Process only calls of these MSNs/extensions (empty = all)
+	Deny  []string // Never process calls of these MSNs/extensions
+}
+
+// NewExtensionFilter builds a filter from configuration lists, ignoring empty
+// entries. Dial codes like **620 are converted to extension IDs.
+func NewExtensionFilter(allow, deny []string) (ExtensionFilter, error) {
+	clean := func(values []string) ([]string, error) {
+		var entries []string
+		for _, value := range values {
+			if value = strings.TrimSpace(value); value == "" {
+				continue
+			}
+			id, err := ExtensionID(value)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, id)
+		}
+		return entries, nil
+	}
+	allowed, err := clean(allow)
+	if err != nil {
+		return ExtensionFilter{}, err
+	}
+	denied, err := clean(deny)
+	if err != nil {
+		return ExtensionFilter{}, err
+	}
+	return ExtensionFilter{Allow: allowed, Deny: denied}, nil
+}
+
+// Allows reports whether the call of the event is processed. An inbound RING
+// only carries the called MSN, an outbound CALL the extension and the calling MSN.
+func (f ExtensionFilter) Allows(event *CallEvent) bool {
+	if f.matches(event, f.Deny) {
+		return false
+	}
+	return len(f.Allow) == 0 || f.matches(event, f.Allow)
+}
+
+// matches checks if the own number or the extension of the event is one of the entries
+func (f ExtensionFilter) matches(event *CallEvent, entries []string) bool {
+	own := event.Caller
+	if event.Direction == CallDirectionInbound {
+		own = event.Called
+	}
+	return DetectMSN(own, entries) != "" || (event.Extension != "" && slices.Contains(entries, event.Extension))
+}
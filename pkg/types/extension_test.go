@@ -0,0 +1,74 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseExtensionNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		entries  []string
+		expected map[string]string
+		wantErr  bool
+	}{
+		{"empty", nil, map[string]string{}, false},
+		{"extension IDs", []string{"1=Kitchen", " 2 = Office "}, map[string]string{"1": "Kitchen", "2": "Office"}, false},
+		{"dial codes", []string{"**1=Hall", "**600=Voicemail", "**620=DECT Living Room"}, map[string]string{"0": "Hall", "40": "Voicemail", "20": "DECT Living Room"}, false},
+		{"missing name", []string{"1="}, nil, true},
+		{"missing separator", []string{"Kitchen"}, nil, true},
+		{"unsupported dial code", []string{"**9=Door"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			names, err := ParseExtensionNames(tt.entries)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseExtensionNames() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("ParseExtensionNames() = %v, expected %v", names, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExtensionFilter(t *testing.T) {
+	ring := &CallEvent{Type: CallTypeRing, Direction: CallDirectionInbound, Caller: "+4930123456", Called: "+4930990133"}
+	call := &CallEvent{Type: CallTypeCall, Direction: CallDirectionOutbound, Extension: "20", Caller: "+4930990134", Called: "+4930123456"}
+
+	tests := []struct {
+		name     string
+		allow    []string
+		deny     []string
+		event    *CallEvent
+		expected bool
+	}{
+		{"zero value allows all", nil, nil, ring, true},
+		{"allowed MSN", []string{"990133"}, nil, ring, true},
+		{"other MSN", []string{"990134"}, nil, ring, false},
+		{"remote number is not matched", []string{"123456"}, nil, ring, false},
+		{"allowed extension", []string{"20"}, nil, call, true},
+		{"allowed dial code", []string{"**620"}, nil, call, true},
+		{"allowed calling MSN", []string{"990134"}, nil, call, true},
+		{"denied extension", nil, []string{"20"}, call, false},
+		{"deny wins", []string{"990133"}, []string{"990133"}, ring, false},
+		{"empty entries", []string{""}, []string{" "}, ring, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := NewExtensionFilter(tt.allow, tt.deny)
+			if err != nil {
+				t.Fatalf("NewExtensionFilter failed: %v", err)
+			}
+			if got := filter.Allows(tt.event); got != tt.expected {
+				t.Errorf("Allows() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+
+	if _, err := NewExtensionFilter([]string{"**99"}, nil); err == nil {
+		t.Error("Expected error for unsupported dial code")
+	}
+}
@@ -2,18 +2,35 @@ package types
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
 )
 
+// finishTimeout is how long finish states are shown before returning to idle by default
+const finishTimeout = 1 * time.Second
+
+// Transition is the change of the FSM state caused by an event. From equals
+// To if the event is not expected in the state and was ignored.
+type Transition struct {
+	From   CallStatus `json:"from"`
+	To     CallStatus `json:"to"`
+	Reason string     `json:"reason"`
+}
+
 // CallStateMachine manages the state transitions for call events
 type CallStateMachine struct {
 	mu            sync.RWMutex
 	currentState  CallStatus
 	finishState   *CallStatus // Last meaningful state before idle
-	timeoutTimer  *time.Timer
+	clock         clock.Clock
+	timeoutTimer  clock.Timer
 	timeoutCtx    context.Context
 	timeoutCancel context.CancelFunc
+	finishDelay   time.Duration // How long finish states are shown, 0 keeps them until the next call
 	onStateChange func(oldState, newState CallStatus)
 	mqttPublisher MQTTPublisher
 	line          int
@@ -26,7 +43,9 @@ type CallStateMachine struct {
 func NewCallStateMachine(onStateChange func(oldState, newState CallStatus)) *CallStateMachine {
 	return &CallStateMachine{
 		currentState:  CallStatusIdle,
+		finishDelay:   finishTimeout,
 		onStateChange: onStateChange,
+		clock:         clock.Real(),
 	}
 }
 
@@ -34,9 +53,11 @@ func NewCallStateMachine(onStateChange func(oldState, newState CallStatus)) *Cal
 func NewCallStateMachineWithMQTT(line int, mqttPublisher MQTTPublisher, onStateChange func(oldState, newState CallStatus)) *CallStateMachine {
 	return &CallStateMachine{
 		currentState:  CallStatusIdle,
+		finishDelay:   finishTimeout,
 		onStateChange: onStateChange,
 		mqttPublisher: mqttPublisher,
 		line:          line,
+		clock:         clock.Real(),
 	}
 }
 
@@ -63,12 +84,20 @@ func (fsm *CallStateMachine) processEventInternal(eventType CallType, event *Cal
 	defer fsm.mu.Unlock()
 
 	oldState := fsm.currentState
-	newState := fsm.getNextState(fsm.currentState, eventType)
+	newState, reason := fsm.nextState(fsm.currentState, eventType)
+
+	// Calls answered by the answering machine go to the message box instead of talking
+	if newState == CallStatusTalking && oldState == CallStatusRinging && event != nil && event.MessageBox {
+		newState, reason = CallStatusMessageBox, "answered by the answering machine"
+	}
+	if event != nil && !isTimeout {
+		event.Transition = &Transition{From: oldState, To: newState, Reason: reason}
+	}
 
 	// Store event context
 	if !isTimeout {
 		fsm.lastEventType = eventType
-		fsm.lastEventTime = time.Now()
+		fsm.lastEventTime = fsm.clock.Now()
 		if event != nil {
 			fsm.lastEvent = event
 		}
@@ -106,40 +135,53 @@ func (fsm *CallStateMachine) processEventInternal(eventType CallType, event *Cal
 
 // getNextState determines the next state based on current state and event type
 func (fsm *CallStateMachine) getNextState(currentState CallStatus, eventType CallType) CallStatus {
+	state, _ := fsm.nextState(currentState, eventType)
+	return state
+}
+
+// nextState determines the next state and the reason of the transition
+func (fsm *CallStateMachine) nextState(currentState CallStatus, eventType CallType) (CallStatus, string) {
 	switch currentState {
 	case CallStatusIdle:
 		switch eventType {
 		case CallTypeRing:
-			return CallStatusRinging
+			return CallStatusRinging, "incoming call rings"
 		case CallTypeCall:
-			return CallStatusCalling
+			return CallStatusCalling, "outgoing call dialed"
 		}
 
 	case CallStatusRinging:
 		switch eventType {
 		case CallTypeConnect:
-			return CallStatusTalking
+			return CallStatusTalking, "answered"
 		case CallTypeDisconnect:
-			return CallStatusMissedCall
+			return CallStatusMissedCall, "disconnected while ringing, nobody answered"
 		}
 
 	case CallStatusCalling:
 		switch eventType {
 		case CallTypeConnect:
-			return CallStatusTalking
+			return CallStatusTalking, "callee answered"
 		case CallTypeDisconnect:
-			return CallStatusNotReached
+			return CallStatusNotReached, "disconnected before the callee answered"
 		}
 
 	case CallStatusTalking:
 		switch eventType {
 		case CallTypeDisconnect:
-			return CallStatusFinished
+			return CallStatusFinished, "disconnected after talking"
+		}
+
+	case CallStatusMessageBox:
+		switch eventType {
+		case CallTypeDisconnect:
+			// Nobody talked to the caller, the message box is kept as finish state
+			return CallStatusMissedCall, "disconnected at the answering machine"
 		}
 	}
 
 	// No valid transition found, stay in current state
-	return currentState
+	return currentState, fmt.Sprintf("%s not expected while %s, ignored", strings.ToUpper(string(eventType)), currentState)
 }
 
 // setState updates the current state and handles cleanup
@@ -148,7 +190,10 @@ func (fsm *CallStateMachine) setState(newState CallStatus) {
 	fsm.cancelTimeout()
 
 	// Track finish states (final meaningful states before idle)
-	if newState == CallStatusMissedCall || newState == CallStatusNotReached || newState == CallStatusFinished {
+	if newState == CallStatusMissedCall && fsm.currentState == CallStatusMessageBox {
+		messageBox := CallStatusMessageBox
+		fsm.finishState = &messageBox
+	} else if newState == CallStatusMissedCall || newState == CallStatusNotReached || newState == CallStatusFinished {
 		fsm.finishState = &newState
 	} else if newState == CallStatusIdle {
 		// When returning to idle, keep the finish state for history
@@ -165,15 +210,29 @@ func (fsm *CallStateMachine) setState(newState CallStatus) {
 func (fsm *CallStateMachine) handleTimeouts(state CallStatus) {
 	switch state {
 	case CallStatusNotReached, CallStatusMissedCall, CallStatusFinished:
-		fsm.startTimeout(1 * time.Second)
+		if fsm.finishDelay > 0 {
+			fsm.startTimeout(fsm.finishDelay)
+		}
+	}
+}
+
+// held reports whether the FSM shows a finish state that does not time out,
+// so it is kept until the next call on its line
+func (fsm *CallStateMachine) held() bool {
+	fsm.mu.RLock()
+	defer fsm.mu.RUnlock()
+	switch fsm.currentState {
+	case CallStatusNotReached, CallStatusMissedCall, CallStatusFinished:
+		return fsm.timeoutTimer == nil
 	}
+	return false
 }
 
 // startTimeout starts a timeout that will transition to idle state
 func (fsm *CallStateMachine) startTimeout(duration time.Duration) {
 	fsm.timeoutCtx, fsm.timeoutCancel = context.WithCancel(context.Background())
 
-	fsm.timeoutTimer = time.AfterFunc(duration, func() {
+	fsm.timeoutTimer = fsm.clock.AfterFunc(duration, func() {
 		select {
 		case <-fsm.timeoutCtx.Done():
 			// Timeout was cancelled
@@ -190,8 +249,10 @@ func (fsm *CallStateMachine) executeTimeoutTransition() {
 	fsm.mu.Lock()
 	oldState := fsm.currentState
 	if oldState == CallStatusNotReached || oldState == CallStatusMissedCall || oldState == CallStatusFinished {
-		// Set finishState before transitioning to idle
-		fsm.finishState = &oldState
+		// Set finishState before transitioning to idle, unless it is already known (e.g. messageBox)
+		if fsm.finishState == nil {
+			fsm.finishState = &oldState
+		}
 		// Use setState to properly handle the idle transition
 		fsm.setState(CallStatusIdle)
 
@@ -239,6 +300,16 @@ func (fsm *CallStateMachine) Reset() {
 	}
 }
 
+// restore puts the FSM into the state of a call that was active before a
+// restart, without publishing or reporting a state change
+func (fsm *CallStateMachine) restore(state CallStatus) {
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+	fsm.cancelTimeout()
+	fsm.currentState = state
+	fsm.finishState = nil
+}
+
 // GetFinishState returns the last meaningful state before idle
 func (fsm *CallStateMachine) GetFinishState() *CallStatus {
 	fsm.mu.RLock()
@@ -280,6 +351,22 @@ func (fsm *CallStateMachine) SetMQTTPublisher(publisher MQTTPublisher, line int)
 	fsm.line = line
 }
 
+// SetClock sets the clock used for timestamps and timeouts; timeouts already
+// running keep their clock
+func (fsm *CallStateMachine) SetClock(c clock.Clock) {
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+	fsm.clock = c
+}
+
+// SetFinishTimeout sets how long finish states are shown before returning to
+// idle; 0 keeps them until the next call. Timeouts already running are kept.
+func (fsm *CallStateMachine) SetFinishTimeout(timeout time.Duration) {
+	fsm.mu.Lock()
+	defer fsm.mu.Unlock()
+	fsm.finishDelay = timeout
+}
+
 // GetFSMStatus returns the current FSM status for MQTT publishing
 func (fsm *CallStateMachine) GetFSMStatus() FSMStatusMessage {
 	fsm.mu.RLock()
@@ -288,7 +375,7 @@ func (fsm *CallStateMachine) GetFSMStatus() FSMStatusMessage {
 	msg := FSMStatusMessage{
 		Line:             fsm.line,
 		Status:           fsm.currentState,
-		Timestamp:        time.Now().Format(time.RFC3339),
+		Timestamp:        fsm.clock.Now().Format(time.RFC3339),
 		ValidTransitions: fsm.getValidTransitionsUnsafe(),
 		IsTimeoutActive:  fsm.timeoutTimer != nil,
 		LastEventType:    fsm.lastEventType,
@@ -4,8 +4,28 @@ import (
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
 )
 
+// newFakeClock returns a fake clock for driving FSM timeouts without sleeping
+func newFakeClock() *clock.Fake {
+	return clock.NewFake(time.Date(2025, 9, 21, 15, 35, 0, 0, time.UTC))
+}
+
+// eventually polls cond until it holds, for callbacks the FSM runs in goroutines
+func eventually(t *testing.T, cond func() bool) bool {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return cond()
+}
+
 func TestNewCallStateMachine(t *testing.T) {
 	fsm := NewCallStateMachine(nil)
 	if fsm.GetState() != CallStatusIdle {
@@ -90,6 +110,8 @@ func TestTimeoutTransitions(t *testing.T) {
 				stateChanges = append(stateChanges, newState)
 				mu.Unlock()
 			})
+			clk := newFakeClock()
+			fsm.SetClock(clk)
 
 			// Set initial state
 			fsm.mu.Lock()
@@ -97,26 +119,39 @@ func TestTimeoutTransitions(t *testing.T) {
 			fsm.mu.Unlock()
 			fsm.handleTimeouts(tt.initialState)
 
+			// Just before the timeout nothing happens
+			clk.Advance(finishTimeout - time.Millisecond)
+			if fsm.GetState() != tt.initialState {
+				t.Fatalf("FSM should still be in %v state before the timeout, got %v", tt.initialState, fsm.GetState())
+			}
+
+			clk.Advance(time.Millisecond)
+
 			if tt.hasTimeout {
-				// Wait for timeout + some buffer
-				time.Sleep(1200 * time.Millisecond)
+				if fsm.GetState() != CallStatusIdle {
+					t.Errorf("FSM should be in idle state after timeout, got %v", fsm.GetState())
+				}
+
+				// The state change callback of timeouts runs in its own goroutine
+				ok := eventually(t, func() bool {
+					mu.Lock()
+					defer mu.Unlock()
+					return len(stateChanges) > 0
+				})
 
 				mu.Lock()
 				changes := stateChanges
 				mu.Unlock()
 
-				if len(changes) == 0 {
+				if !ok {
 					t.Errorf("Expected timeout transition, but no state changes occurred")
 				} else if changes[len(changes)-1] != CallStatusIdle {
 					t.Errorf("Expected timeout to transition to idle, got %v", changes[len(changes)-1])
 				}
-
-				if fsm.GetState() != CallStatusIdle {
-					t.Errorf("FSM should be in idle state after timeout, got %v", fsm.GetState())
-				}
 			} else {
-				// Wait a bit to ensure no timeout occurs
-				time.Sleep(100 * time.Millisecond)
+				if pending := clk.Pending(); pending != 0 {
+					t.Errorf("Expected no pending timeout, got %d", pending)
+				}
 
 				mu.Lock()
 				changes := stateChanges
@@ -136,6 +171,44 @@ func TestTimeoutTransitions(t *testing.T) {
 	}
 }
 
+func TestMessageBoxTransitions(t *testing.T) {
+	fsm := NewCallStateMachine(nil)
+	defer fsm.Cleanup()
+	clk := newFakeClock()
+	fsm.SetClock(clk)
+
+	fsm.ProcessEventWithContext(CallTypeRing, &CallEvent{Type: CallTypeRing})
+	if state := fsm.ProcessEventWithContext(CallTypeConnect, &CallEvent{Type: CallTypeConnect, MessageBox: true}); state != CallStatusMessageBox {
+		t.Fatalf("Expected messageBox after TAM connect, got %v", state)
+	}
+
+	if state := fsm.ProcessEventWithContext(CallTypeDisconnect, &CallEvent{Type: CallTypeDisconnect, MessageBox: true}); state != CallStatusMissedCall {
+		t.Errorf("Expected missedCall after disconnect, got %v", state)
+	}
+	if finish := fsm.GetFinishState(); finish == nil || *finish != CallStatusMessageBox {
+		t.Errorf("Expected finish state messageBox, got %v", finish)
+	}
+
+	clk.Advance(finishTimeout)
+	if fsm.GetState() != CallStatusIdle {
+		t.Errorf("Expected idle after timeout, got %v", fsm.GetState())
+	}
+	if finish := fsm.GetFinishState(); finish == nil || *finish != CallStatusMessageBox {
+		t.Errorf("Expected finish state messageBox to be kept in idle, got %v", finish)
+	}
+}
+
+func TestMessageBoxOnlyFromRinging(t *testing.T) {
+	fsm := NewCallStateMachine(nil)
+	defer fsm.Cleanup()
+
+	// Outgoing calls reaching a remote voicemail are regular talks
+	fsm.ProcessEvent(CallTypeCall)
+	if state := fsm.ProcessEventWithContext(CallTypeConnect, &CallEvent{Type: CallTypeConnect, MessageBox: true}); state != CallStatusTalking {
+		t.Errorf("Expected talking for outgoing call, got %v", state)
+	}
+}
+
 func TestStateChangeCallback(t *testing.T) {
 	var lastOldState, lastNewState CallStatus
 	var callbackCount int
@@ -315,6 +388,8 @@ func TestTimeoutCancellation(t *testing.T) {
 		stateChanges = append(stateChanges, newState)
 		mu.Unlock()
 	})
+	clk := newFakeClock()
+	fsm.SetClock(clk)
 
 	// Transition to notReached (which has timeout)
 	fsm.mu.Lock()
@@ -322,12 +397,16 @@ func TestTimeoutCancellation(t *testing.T) {
 	fsm.mu.Unlock()
 	fsm.ProcessEvent(CallTypeDisconnect) // Should go to notReached
 
-	// Immediately reset before timeout
-	time.Sleep(100 * time.Millisecond)
+	// Reset before timeout
+	clk.Advance(100 * time.Millisecond)
 	fsm.Reset()
 
-	// Wait past the original timeout period
-	time.Sleep(1200 * time.Millisecond)
+	if pending := clk.Pending(); pending != 0 {
+		t.Errorf("Expected reset to stop the timeout, %d timers pending", pending)
+	}
+
+	// Move past the original timeout period
+	clk.Advance(2 * finishTimeout)
 
 	mu.Lock()
 	changes := stateChanges
@@ -348,3 +427,29 @@ func TestTimeoutCancellation(t *testing.T) {
 
 	fsm.Cleanup()
 }
+
+func TestTransitionIsRecordedOnEvent(t *testing.T) {
+	fsm := NewCallStateMachine(nil)
+
+	ring := &CallEvent{Type: CallTypeRing}
+	fsm.ProcessEventWithContext(ring.Type, ring)
+	if ring.Transition == nil || ring.Transition.From != CallStatusIdle || ring.Transition.To != CallStatusRinging {
+		t.Fatalf("Expected idle -> ringing, got %+v", ring.Transition)
+	}
+
+	call := &CallEvent{Type: CallTypeCall}
+	fsm.ProcessEventWithContext(call.Type, call)
+	if call.Transition == nil || call.Transition.From != CallStatusRinging || call.Transition.To != CallStatusRinging {
+		t.Fatalf("Expected an ignored CALL while ringing, got %+v", call.Transition)
+	}
+	if call.Transition.Reason != "CALL not expected while ringing, ignored" {
+		t.Errorf("Unexpected reason %q", call.Transition.Reason)
+	}
+
+	connect := &CallEvent{Type: CallTypeConnect, MessageBox: true}
+	fsm.ProcessEventWithContext(connect.Type, connect)
+	if connect.Transition == nil || connect.Transition.To != CallStatusMessageBox || connect.Transition.Reason != "answered by the answering machine" {
+		t.Errorf("Expected ringing -> messageBox by the answering machine, got %+v", connect.Transition)
+	}
+	fsm.Cleanup()
+}
@@ -0,0 +1,162 @@
+package types
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pendingCallTimeout bounds how long events of a call without disconnect are kept
+const pendingCallTimeout = 24 * time.Hour
+
+// HistoryFilter selects the calls that are kept in a history, e.g. the call
+// history topic or the database. The zero value keeps all calls.
+type HistoryFilter struct {
+	FinishStates []CallStatus    // Keep only calls ending in one of these states
+	Directions   []CallDirection // Keep only calls of these directions
+}
+
+// ParseHistoryFilter builds a filter from configuration values such as
+// "missedCall,finished" and "inbound"
+func ParseHistoryFilter(finishStates, directions []string) (HistoryFilter, error) {
+	var filter HistoryFilter
+
+	for _, value := range finishStates {
+		state := CallStatus(strings.TrimSpace(value))
+		switch state {
+		case "":
+			continue
+		case CallStatusNotReached, CallStatusMissedCall, CallStatusFinished, CallStatusMessageBox:
+			filter.FinishStates = append(filter.FinishStates, state)
+		default:
+			return HistoryFilter{}, fmt.Errorf("invalid finish state '%s', expected notReached, missedCall, finished or messageBox", value)
+		}
+	}
+
+	for _, value := range directions {
+		direction := CallDirection(strings.TrimSpace(value))
+		switch direction {
+		case "":
+			continue
+		case CallDirectionInbound, CallDirectionOutbound:
+			filter.Directions = append(filter.Directions, direction)
+		default:
+			return HistoryFilter{}, fmt.Errorf("invalid call direction '%s', expected inbound or outbound", value)
+		}
+	}
+
+	return filter, nil
+}
+
+// IsEmpty reports whether the filter keeps all calls
+func (f HistoryFilter) IsEmpty() bool {
+	return len(f.FinishStates) == 0 && len(f.Directions) == 0
+}
+
+// Matches reports whether a finished call passes the filter. event is the
+// disconnect event carrying the finish state.
+func (f HistoryFilter) Matches(event CallEvent) bool {
+	if len(f.Directions) > 0 && !containsValue(f.Directions, event.Direction) {
+		return false
+	}
+	if len(f.FinishStates) > 0 && (event.FinishState == nil || !containsValue(f.FinishStates, *event.FinishState)) {
+		return false
+	}
+	return true
+}
+
+func containsValue[T comparable](values []T, value T) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// HistoryGate applies a HistoryFilter to a stream of call events. The finish
+// state of a call is only known on disconnect, so events of running calls are
+// held back until then and released together if the call matches.
+type HistoryGate struct {
+	filter HistoryFilter
+
+	mu      sync.Mutex
+	pending map[string][]CallEvent // Events of running calls by call ID
+}
+
+// NewHistoryGate creates a gate for the given filter
+func NewHistoryGate(filter HistoryFilter) *HistoryGate {
+	return &HistoryGate{
+		filter:  filter,
+		pending: make(map[string][]CallEvent),
+	}
+}
+
+// Add takes the next event and returns the events that pass the filter, in
+// order. It returns nil while the call is still running or when it was
+// filtered out. With an empty filter every event passes immediately.
+func (g *HistoryGate) Add(event CallEvent) []CallEvent {
+	if g == nil || g.filter.IsEmpty() {
+		return []CallEvent{event}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if event.Type != CallTypeDisconnect {
+		g.dropStale(event.Timestamp)
+		g.pending[event.ID] = append(g.pending[event.ID], event)
+		return nil
+	}
+
+	events := append(g.pending[event.ID], event)
+	delete(g.pending, event.ID)
+
+	if !g.filter.Matches(event) {
+		return nil
+	}
+	return events
+}
+
+// Pending returns the number of running calls whose events are held back
+func (g *HistoryGate) Pending() int {
+	if g == nil {
+		return 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.pending)
+}
+
+// Drain returns the held back events of the running calls that may still
+// match the filter, oldest call first, and forgets all running calls. It is
+// meant for shutdown, when the disconnects will not arrive anymore.
+func (g *HistoryGate) Drain() []CallEvent {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	calls := make([][]CallEvent, 0, len(g.pending))
+	for id, events := range g.pending {
+		delete(g.pending, id)
+		if len(g.filter.Directions) > 0 && !containsValue(g.filter.Directions, events[0].Direction) {
+			continue
+		}
+		calls = append(calls, events)
+	}
+	slices.SortFunc(calls, func(a, b []CallEvent) int { return a[0].Timestamp.Compare(b[0].Timestamp) })
+	return slices.Concat(calls...)
+}
+
+// dropStale forgets calls whose disconnect never arrived; g.mu must be held
+func (g *HistoryGate) dropStale(now time.Time) {
+	for id, events := range g.pending {
+		if now.Sub(events[0].Timestamp) > pendingCallTimeout {
+			delete(g.pending, id)
+		}
+	}
+}
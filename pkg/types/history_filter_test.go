@@ -0,0 +1,135 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseHistoryFilter(t *testing.T) {
+	tests := []struct {
+		name         string
+		finishStates []string
+		directions   []string
+		expectError  bool
+		expectEmpty  bool
+	}{
+		{"empty", nil, nil, false, true},
+		{"blank entries", []string{""}, []string{" "}, false, true},
+		{"finish states", []string{"missedCall", " finished"}, nil, false, false},
+		{"directions", nil, []string{"inbound"}, false, false},
+		{"non-final state", []string{"talking"}, nil, true, false},
+		{"unknown direction", nil, []string{"internal"}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := ParseHistoryFilter(tt.finishStates, tt.directions)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("ParseHistoryFilter() error = %v, expectError %v", err, tt.expectError)
+			}
+			if err == nil && filter.IsEmpty() != tt.expectEmpty {
+				t.Errorf("IsEmpty() = %v, expected %v", filter.IsEmpty(), tt.expectEmpty)
+			}
+		})
+	}
+}
+
+// callEvents returns the events of a call ending in the given finish state
+func callEvents(id string, direction CallDirection, finish CallStatus) []CallEvent {
+	start := time.Date(2025, 9, 21, 15, 35, 0, 0, time.UTC)
+	first := CallTypeRing
+	if direction == CallDirectionOutbound {
+		first = CallTypeCall
+	}
+	return []CallEvent{
+		{ID: id, Type: first, Direction: direction, Timestamp: start},
+		{ID: id, Type: CallTypeDisconnect, Direction: direction, Timestamp: start.Add(time.Minute), FinishState: &finish},
+	}
+}
+
+func TestHistoryGate(t *testing.T) {
+	filter, err := ParseHistoryFilter([]string{"missedCall", "finished"}, []string{"inbound"})
+	if err != nil {
+		t.Fatalf("ParseHistoryFilter failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		events   []CallEvent
+		expected int
+	}{
+		{"missed inbound call", callEvents("a", CallDirectionInbound, CallStatusMissedCall), 2},
+		{"finished inbound call", callEvents("b", CallDirectionInbound, CallStatusFinished), 2},
+		{"inbound call on the answering machine", callEvents("c", CallDirectionInbound, CallStatusMessageBox), 0},
+		{"finished outbound call", callEvents("d", CallDirectionOutbound, CallStatusFinished), 0},
+	}
+
+	gate := NewHistoryGate(filter)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if released := gate.Add(tt.events[0]); released != nil {
+				t.Fatalf("Expected events of a running call to be held back, got %v", released)
+			}
+
+			released := gate.Add(tt.events[1])
+			if len(released) != tt.expected {
+				t.Fatalf("Expected %d events, got %d", tt.expected, len(released))
+			}
+			if tt.expected > 0 && (released[0].Type == CallTypeDisconnect || released[1].Type != CallTypeDisconnect) {
+				t.Errorf("Expected events in order, got %s then %s", released[0].Type, released[1].Type)
+			}
+		})
+	}
+
+	if len(gate.pending) != 0 {
+		t.Errorf("Expected no pending calls, got %d", len(gate.pending))
+	}
+}
+
+func TestHistoryGateWithoutFilter(t *testing.T) {
+	gate := NewHistoryGate(HistoryFilter{})
+
+	for _, event := range callEvents("a", CallDirectionInbound, CallStatusMissedCall) {
+		if released := gate.Add(event); len(released) != 1 {
+			t.Errorf("Expected every event to pass immediately, got %v", released)
+		}
+	}
+}
+
+func TestHistoryGateDropsStaleCalls(t *testing.T) {
+	filter := HistoryFilter{FinishStates: []CallStatus{CallStatusFinished}}
+	gate := NewHistoryGate(filter)
+
+	stale := callEvents("stale", CallDirectionInbound, CallStatusFinished)
+	gate.Add(stale[0])
+
+	next := callEvents("next", CallDirectionInbound, CallStatusFinished)
+	next[0].Timestamp = stale[0].Timestamp.Add(25 * time.Hour)
+	gate.Add(next[0])
+
+	if _, ok := gate.pending["stale"]; ok {
+		t.Error("Expected the call without disconnect to be dropped")
+	}
+	if _, ok := gate.pending["next"]; !ok {
+		t.Error("Expected the running call to be kept")
+	}
+}
+
+func TestHistoryGateDrain(t *testing.T) {
+	filter := HistoryFilter{Directions: []CallDirection{CallDirectionInbound}, FinishStates: []CallStatus{CallStatusFinished}}
+	gate := NewHistoryGate(filter)
+
+	later := callEvents("later", CallDirectionInbound, CallStatusFinished)
+	later[0].Timestamp = later[0].Timestamp.Add(time.Minute)
+	gate.Add(later[0])
+	gate.Add(callEvents("earlier", CallDirectionInbound, CallStatusFinished)[0])
+	gate.Add(callEvents("outbound", CallDirectionOutbound, CallStatusFinished)[0])
+
+	events := gate.Drain()
+	if len(events) != 2 || events[0].ID != "earlier" || events[1].ID != "later" {
+		t.Errorf("Expected the inbound calls oldest first, got %+v", events)
+	}
+	if gate.Pending() != 0 {
+		t.Errorf("Expected no running calls after Drain, got %d", gate.Pending())
+	}
+}
@@ -3,67 +3,219 @@ package types
 import (
 	"fmt"
 	"sync"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/clock"
 )
 
-// LineStateMachine manages FSMs for multiple phone lines
+// LineStateMachine manages FSMs for multiple phone lines. Every call gets its
+// own FSM keyed by its call ID, so calls running in parallel on the same line
+// (call waiting) do not disturb each other. Per-line queries report the call
+// that currently occupies the line.
 type LineStateMachine struct {
 	mu            sync.RWMutex
-	machines      map[int]*CallStateMachine
+	machines      map[string]*CallStateMachine // FSM per call
+	lines         map[int][]string             // Call keys per line, most recently active last
 	onStateChange func(line int, oldState, newState CallStatus)
 	mqttPublisher MQTTPublisher
+	clock         clock.Clock
+
+	finishTimeout      time.Duration         // Finish timeout of lines without their own
+	lineFinishTimeouts map[int]time.Duration // Finish timeouts by line, 0 keeps finish states until the next call
 }
 
 // NewLineStateMachine creates a new line state machine manager
 func NewLineStateMachine(onStateChange func(line int, oldState, newState CallStatus)) *LineStateMachine {
 	return &LineStateMachine{
-		machines:      make(map[int]*CallStateMachine),
+		machines:      make(map[string]*CallStateMachine),
+		lines:         make(map[int][]string),
 		onStateChange: onStateChange,
+		clock:         clock.Real(),
+		finishTimeout: finishTimeout,
 	}
 }
 
 // NewLineStateMachineWithMQTT creates a new line state machine with MQTT publishing
 func NewLineStateMachineWithMQTT(mqttPublisher MQTTPublisher, onStateChange func(line int, oldState, newState CallStatus)) *LineStateMachine {
 	return &LineStateMachine{
-		machines:      make(map[int]*CallStateMachine),
+		machines:      make(map[string]*CallStateMachine),
+		lines:         make(map[int][]string),
 		onStateChange: onStateChange,
 		mqttPublisher: mqttPublisher,
+		clock:         clock.Real(),
+		finishTimeout: finishTimeout,
 	}
 }
 
-// ProcessCallEvent processes a call event and updates the appropriate line FSM
+// ProcessCallEvent processes a call event and updates the FSM of its call
 func (lsm *LineStateMachine) ProcessCallEvent(event *CallEvent) CallStatus {
 	lsm.mu.Lock()
 	defer lsm.mu.Unlock()
 
-	// Get or create FSM for this line
-	fsm, exists := lsm.machines[event.Line]
+	// Get or create FSM for this call; an event without call ID takes the ID
+	// of the FSM, so its topics and database rows match those of the call
+	key, ok := lsm.callKey(event)
+	if !ok {
+		key = NewCallID()
+	}
+	event.ID = key
+	fsm, exists := lsm.machines[key]
 	if !exists {
-		if lsm.mqttPublisher != nil {
-			fsm = NewCallStateMachineWithMQTT(event.Line, lsm.mqttPublisher, func(oldState, newState CallStatus) {
-				if lsm.onStateChange != nil {
-					lsm.onStateChange(event.Line, oldState, newState)
-				}
-			})
-		} else {
-			fsm = NewCallStateMachine(func(oldState, newState CallStatus) {
-				if lsm.onStateChange != nil {
-					lsm.onStateChange(event.Line, oldState, newState)
-				}
-			})
-		}
-		lsm.machines[event.Line] = fsm
+		lsm.removeIdleCalls(event.Line)
+		fsm = lsm.newMachine(event.Line)
+		lsm.machines[key] = fsm
 	}
+	lsm.touch(event.Line, key)
 
 	// Process event and update call event with new status
-	var newStatus CallStatus
+	newStatus := fsm.ProcessEventWithContext(event.Type, event)
+	event.Status = newStatus
+
+	return newStatus
+}
+
+// RestoreCall recreates the FSM of a call that was active before a restart
+// in the state of the call, so its further events continue the call. Nothing
+// is published, the retained line status is still current. Known calls are
+// left alone.
+func (lsm *LineStateMachine) RestoreCall(call ActiveCall) {
+	lsm.mu.Lock()
+	defer lsm.mu.Unlock()
+
+	if _, exists := lsm.machines[call.ID]; exists {
+		return
+	}
+	line := call.EventLine()
+	fsm := lsm.newMachine(line)
+	fsm.restore(call.State())
+	lsm.machines[call.ID] = fsm
+	lsm.touch(line, call.ID)
+}
+
+// newMachine creates the FSM of a call on a line; lsm.mu must be held
+func (lsm *LineStateMachine) newMachine(line int) *CallStateMachine {
+	var fsm *CallStateMachine
 	if lsm.mqttPublisher != nil {
-		newStatus = fsm.ProcessEventWithContext(event.Type, event)
+		fsm = NewCallStateMachineWithMQTT(line, lsm.mqttPublisher, func(oldState, newState CallStatus) {
+			if lsm.onStateChange != nil {
+				lsm.onStateChange(line, oldState, newState)
+			}
+		})
 	} else {
-		newStatus = fsm.ProcessEvent(event.Type)
+		fsm = NewCallStateMachine(func(oldState, newState CallStatus) {
+			if lsm.onStateChange != nil {
+				lsm.onStateChange(line, oldState, newState)
+			}
+		})
 	}
-	event.Status = newStatus
+	fsm.SetClock(lsm.clock)
+	fsm.SetFinishTimeout(lsm.finishTimeout)
+	if timeout, exists := lsm.lineFinishTimeouts[line]; exists {
+		fsm.SetFinishTimeout(timeout)
+	}
+	return fsm
+}
 
-	return newStatus
+// callKey returns the call ID of the FSM an event belongs to; lsm.mu must be held.
+// Events without call ID belong to the most recently active call on their
+// line; on an empty line they have no call yet and false is returned.
+func (lsm *LineStateMachine) callKey(event *CallEvent) (string, bool) {
+	if event.ID != "" {
+		return event.ID, true
+	}
+	if keys := lsm.lines[event.Line]; len(keys) > 0 {
+		return keys[len(keys)-1], true
+	}
+	return "", false
+}
+
+// touch moves a call to the end of its line, so the line reports the call
+// that changed last; lsm.mu must be held
+func (lsm *LineStateMachine) touch(line int, key string) {
+	keys := lsm.lines[line]
+	for i, k := range keys {
+		if k == key {
+			keys = append(keys[:i], keys[i+1:]...)
+			break
+		}
+	}
+	lsm.lines[line] = append(keys, key)
+}
+
+// removeIdleCalls drops the FSMs of finished calls on a line before a new
+// call is added, including those held in their finish state; lsm.mu must be held
+func (lsm *LineStateMachine) removeIdleCalls(line int) {
+	keys := lsm.lines[line][:0]
+	for _, key := range lsm.lines[line] {
+		if fsm := lsm.machines[key]; fsm.GetState() == CallStatusIdle || fsm.held() {
+			fsm.Cleanup()
+			delete(lsm.machines, key)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	lsm.lines[line] = keys
+}
+
+// lineMachine returns the FSM of the call occupying a line: the most recently
+// active call that is not idle, or the most recently active call if all are
+// idle; lsm.mu must be held
+func (lsm *LineStateMachine) lineMachine(line int) (*CallStateMachine, bool) {
+	keys := lsm.lines[line]
+	for i := len(keys) - 1; i >= 0; i-- {
+		if fsm := lsm.machines[keys[i]]; fsm.GetState() != CallStatusIdle {
+			return fsm, true
+		}
+	}
+	if len(keys) > 0 {
+		return lsm.machines[keys[len(keys)-1]], true
+	}
+	return nil, false
+}
+
+// callMachine returns the FSM of the call an event belongs to; lsm.mu must be held
+func (lsm *LineStateMachine) callMachine(event *CallEvent) (*CallStateMachine, bool) {
+	key, ok := lsm.callKey(event)
+	if !ok {
+		return nil, false
+	}
+	fsm, exists := lsm.machines[key]
+	return fsm, exists
+}
+
+// GetCallState returns the current state of the call an event belongs to
+func (lsm *LineStateMachine) GetCallState(event *CallEvent) CallStatus {
+	lsm.mu.RLock()
+	defer lsm.mu.RUnlock()
+
+	if fsm, exists := lsm.callMachine(event); exists {
+		return fsm.GetState()
+	}
+	return CallStatusIdle
+}
+
+// GetCallFinishState returns the finish state of the call an event belongs to
+func (lsm *LineStateMachine) GetCallFinishState(event *CallEvent) *CallStatus {
+	lsm.mu.RLock()
+	defer lsm.mu.RUnlock()
+
+	if fsm, exists := lsm.callMachine(event); exists {
+		return fsm.GetFinishState()
+	}
+	return nil
+}
+
+// IsValidCallTransition checks if an event is a valid transition for its call
+func (lsm *LineStateMachine) IsValidCallTransition(event *CallEvent) bool {
+	lsm.mu.RLock()
+	defer lsm.mu.RUnlock()
+
+	if fsm, exists := lsm.callMachine(event); exists {
+		return fsm.IsValidTransition(event.Type)
+	}
+
+	// For new calls, only RING and CALL are valid from idle state
+	return event.Type == CallTypeRing || event.Type == CallTypeCall
 }
 
 // GetLineState returns the current state of a specific line
@@ -71,7 +223,7 @@ func (lsm *LineStateMachine) GetLineState(line int) CallStatus {
 	lsm.mu.RLock()
 	defer lsm.mu.RUnlock()
 
-	if fsm, exists := lsm.machines[line]; exists {
+	if fsm, exists := lsm.lineMachine(line); exists {
 		return fsm.GetState()
 	}
 	return CallStatusIdle
@@ -83,8 +235,10 @@ func (lsm *LineStateMachine) GetAllLineStates() map[int]CallStatus {
 	defer lsm.mu.RUnlock()
 
 	states := make(map[int]CallStatus)
-	for line, fsm := range lsm.machines {
-		states[line] = fsm.GetState()
+	for line := range lsm.lines {
+		if fsm, exists := lsm.lineMachine(line); exists {
+			states[line] = fsm.GetState()
+		}
 	}
 	return states
 }
@@ -94,19 +248,19 @@ func (lsm *LineStateMachine) GetLineFinishState(line int) *CallStatus {
 	lsm.mu.RLock()
 	defer lsm.mu.RUnlock()
 
-	if fsm, exists := lsm.machines[line]; exists {
+	if fsm, exists := lsm.lineMachine(line); exists {
 		return fsm.GetFinishState()
 	}
 	return nil
 }
 
-// ResetLine resets a specific line to idle state
+// ResetLine resets all calls of a specific line to idle state
 func (lsm *LineStateMachine) ResetLine(line int) {
 	lsm.mu.Lock()
 	defer lsm.mu.Unlock()
 
-	if fsm, exists := lsm.machines[line]; exists {
-		fsm.Reset()
+	for _, key := range lsm.lines[line] {
+		lsm.machines[key].Reset()
 	}
 }
 
@@ -120,12 +274,12 @@ func (lsm *LineStateMachine) ResetAllLines() {
 	}
 }
 
-// IsValidTransition checks if a transition is valid for a specific line
+// IsValidTransition checks if a transition is valid for the call occupying a line
 func (lsm *LineStateMachine) IsValidTransition(line int, eventType CallType) bool {
 	lsm.mu.RLock()
 	defer lsm.mu.RUnlock()
 
-	if fsm, exists := lsm.machines[line]; exists {
+	if fsm, exists := lsm.lineMachine(line); exists {
 		return fsm.IsValidTransition(eventType)
 	}
 
@@ -133,12 +287,12 @@ func (lsm *LineStateMachine) IsValidTransition(line int, eventType CallType) boo
 	return eventType == CallTypeRing || eventType == CallTypeCall
 }
 
-// GetValidTransitions returns valid transitions for a specific line
+// GetValidTransitions returns valid transitions for the call occupying a line
 func (lsm *LineStateMachine) GetValidTransitions(line int) []CallType {
 	lsm.mu.RLock()
 	defer lsm.mu.RUnlock()
 
-	if fsm, exists := lsm.machines[line]; exists {
+	if fsm, exists := lsm.lineMachine(line); exists {
 		return fsm.GetValidTransitions()
 	}
 
@@ -146,19 +300,27 @@ func (lsm *LineStateMachine) GetValidTransitions(line int) []CallType {
 	return []CallType{CallTypeRing, CallTypeCall}
 }
 
-// RemoveLine removes a line's FSM (useful for cleanup)
+// RemoveLine removes the FSMs of all calls of a line (useful for cleanup)
 func (lsm *LineStateMachine) RemoveLine(line int) {
 	lsm.mu.Lock()
 	defer lsm.mu.Unlock()
 
-	if fsm, exists := lsm.machines[line]; exists {
-		fsm.Cleanup()
-		delete(lsm.machines, line)
+	for _, key := range lsm.lines[line] {
+		lsm.machines[key].Cleanup()
+		delete(lsm.machines, key)
 	}
+	delete(lsm.lines, line)
 }
 
 // GetLineCount returns the number of active lines
 func (lsm *LineStateMachine) GetLineCount() int {
+	lsm.mu.RLock()
+	defer lsm.mu.RUnlock()
+	return len(lsm.lines)
+}
+
+// GetCallCount returns the number of calls with an FSM, including finished calls not yet dropped
+func (lsm *LineStateMachine) GetCallCount() int {
 	lsm.mu.RLock()
 	defer lsm.mu.RUnlock()
 	return len(lsm.machines)
@@ -169,8 +331,8 @@ func (lsm *LineStateMachine) GetActiveLines() []int {
 	lsm.mu.RLock()
 	defer lsm.mu.RUnlock()
 
-	lines := make([]int, 0, len(lsm.machines))
-	for line := range lsm.machines {
+	lines := make([]int, 0, len(lsm.lines))
+	for line := range lsm.lines {
 		lines = append(lines, line)
 	}
 	return lines
@@ -184,7 +346,8 @@ func (lsm *LineStateMachine) Cleanup() {
 	for _, fsm := range lsm.machines {
 		fsm.Cleanup()
 	}
-	lsm.machines = make(map[int]*CallStateMachine)
+	lsm.machines = make(map[string]*CallStateMachine)
+	lsm.lines = make(map[int][]string)
 }
 
 // SetMQTTPublisher sets the MQTT publisher for all existing and future FSMs
@@ -195,18 +358,45 @@ func (lsm *LineStateMachine) SetMQTTPublisher(publisher MQTTPublisher) {
 	lsm.mqttPublisher = publisher
 
 	// Update existing FSMs
-	for line, fsm := range lsm.machines {
-		fsm.SetMQTTPublisher(publisher, line)
+	for line, keys := range lsm.lines {
+		for _, key := range keys {
+			lsm.machines[key].SetMQTTPublisher(publisher, line)
+		}
+	}
+}
+
+// SetClock sets the clock for all existing and future FSMs
+func (lsm *LineStateMachine) SetClock(c clock.Clock) {
+	lsm.mu.Lock()
+	defer lsm.mu.Unlock()
+
+	lsm.clock = c
+	for _, fsm := range lsm.machines {
+		fsm.SetClock(c)
 	}
 }
 
+// SetFinishTimeouts sets how long finish states are shown before returning to
+// idle, for all lines and overridden by line; a timeout of 0 keeps the finish
+// state until the next call on the line. It applies to calls started afterwards.
+func (lsm *LineStateMachine) SetFinishTimeouts(timeout time.Duration, lines map[int]time.Duration) {
+	lsm.mu.Lock()
+	defer lsm.mu.Unlock()
+	lsm.finishTimeout = timeout
+	lsm.lineFinishTimeouts = lines
+}
+
 // GetAllFSMStatuses returns FSM status messages for all active lines
 func (lsm *LineStateMachine) GetAllFSMStatuses() []FSMStatusMessage {
 	lsm.mu.RLock()
 	defer lsm.mu.RUnlock()
 
-	statuses := make([]FSMStatusMessage, 0, len(lsm.machines))
-	for lineNum, fsm := range lsm.machines {
+	statuses := make([]FSMStatusMessage, 0, len(lsm.lines))
+	for lineNum := range lsm.lines {
+		fsm, exists := lsm.lineMachine(lineNum)
+		if !exists {
+			continue
+		}
 		status := fsm.GetFSMStatus()
 		// Ensure line number is set correctly
 		status.Line = lineNum
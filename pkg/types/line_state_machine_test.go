@@ -1,6 +1,7 @@
 package types
 
 import (
+	"fmt"
 	"sync"
 	"testing"
 	"time"
@@ -69,6 +70,30 @@ func TestProcessCallEvent(t *testing.T) {
 	lsm.Cleanup()
 }
 
+func TestProcessCallEventAssignsCallID(t *testing.T) {
+	lsm := NewLineStateMachine(nil)
+	defer lsm.Cleanup()
+
+	ring := &CallEvent{Line: 1, Type: CallTypeRing}
+	lsm.ProcessCallEvent(ring)
+	if ring.ID == "" {
+		t.Fatal("Expected the FSM to assign a call ID to an event without one")
+	}
+
+	// Further events without ID continue the call of their line with its ID
+	connect := &CallEvent{Line: 1, Type: CallTypeConnect}
+	lsm.ProcessCallEvent(connect)
+	if connect.ID != ring.ID || connect.Status != CallStatusTalking {
+		t.Errorf("Expected CONNECT to continue call %s, got %s in %s", ring.ID, connect.ID, connect.Status)
+	}
+
+	call := &CallEvent{ID: "known", Line: 2, Type: CallTypeCall}
+	lsm.ProcessCallEvent(call)
+	if call.ID != "known" {
+		t.Errorf("Expected the call ID of the event to be kept, got %s", call.ID)
+	}
+}
+
 func TestMultipleLines(t *testing.T) {
 	lsm := NewLineStateMachine(nil)
 
@@ -411,6 +436,8 @@ func TestTimeoutIntegration(t *testing.T) {
 		}{line, newState})
 		mu.Unlock()
 	})
+	clk := newFakeClock()
+	lsm.SetClock(clk)
 
 	// Create call that will result in notReached (calling -> disconnect)
 	event := &CallEvent{Line: 1, Type: CallTypeCall}
@@ -423,8 +450,7 @@ func TestTimeoutIntegration(t *testing.T) {
 		t.Errorf("Expected line 1 to be notReached, got %v", lsm.GetLineState(1))
 	}
 
-	// Wait for timeout
-	time.Sleep(1200 * time.Millisecond)
+	clk.Advance(finishTimeout)
 
 	// Should be back to idle
 	if lsm.GetLineState(1) != CallStatusIdle {
@@ -432,17 +458,22 @@ func TestTimeoutIntegration(t *testing.T) {
 	}
 
 	// Check state changes include timeout transition
-	mu.Lock()
-	changes := stateChanges
-	mu.Unlock()
-
 	// Should have: idle -> calling -> notReached -> idle
 	idleCount := 0
-	for _, change := range changes {
-		if change.newState == CallStatusIdle {
-			idleCount++
+	eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		idleCount = 0
+		for _, change := range stateChanges {
+			if change.newState == CallStatusIdle {
+				idleCount++
+			}
 		}
-	}
+		return idleCount > 0
+	})
+	mu.Lock()
+	changes := stateChanges
+	mu.Unlock()
 
 	if idleCount == 0 {
 		t.Errorf("Expected timeout transition to idle, but no idle transitions found: %v", changes)
@@ -451,6 +482,40 @@ func TestTimeoutIntegration(t *testing.T) {
 	lsm.Cleanup()
 }
 
+func TestFinishTimeoutByLine(t *testing.T) {
+	lsm := NewLineStateMachine(nil)
+	clk := newFakeClock()
+	lsm.SetClock(clk)
+	lsm.SetFinishTimeouts(5*time.Second, map[int]time.Duration{1: 0})
+	defer lsm.Cleanup()
+
+	for _, line := range []int{1, 2} {
+		lsm.ProcessCallEvent(&CallEvent{ID: fmt.Sprintf("missed-%d", line), Line: line, Type: CallTypeRing})
+		lsm.ProcessCallEvent(&CallEvent{ID: fmt.Sprintf("missed-%d", line), Line: line, Type: CallTypeDisconnect})
+	}
+
+	clk.Advance(finishTimeout)
+	if lsm.GetLineState(2) != CallStatusMissedCall {
+		t.Errorf("Expected line 2 to show missedCall for 5 seconds, got %v", lsm.GetLineState(2))
+	}
+	clk.Advance(time.Hour)
+	if lsm.GetLineState(2) != CallStatusIdle {
+		t.Errorf("Expected line 2 to be idle after its timeout, got %v", lsm.GetLineState(2))
+	}
+	if lsm.GetLineState(1) != CallStatusMissedCall {
+		t.Errorf("Expected line 1 to keep missedCall until the next call, got %v", lsm.GetLineState(1))
+	}
+
+	// The next call replaces the held call
+	lsm.ProcessCallEvent(&CallEvent{ID: "next", Line: 1, Type: CallTypeCall})
+	if lsm.GetLineState(1) != CallStatusCalling {
+		t.Errorf("Expected line 1 to be calling, got %v", lsm.GetLineState(1))
+	}
+	if state := lsm.GetCallState(&CallEvent{ID: "missed-1", Line: 1}); state != CallStatusIdle {
+		t.Errorf("Expected the held call to be dropped, got %v", state)
+	}
+}
+
 // Helper function to check if a string contains a substring
 func contains(s, substr string) bool {
 	return len(s) >= len(substr) &&
@@ -469,3 +534,32 @@ func findInString(s, substr string) bool {
 	}
 	return false
 }
+
+func TestRestoreCall(t *testing.T) {
+	var changes int
+	lsm := NewLineStateMachine(func(line int, oldState, newState CallStatus) {
+		changes++
+	})
+
+	connected := time.Date(2025, 9, 9, 17, 33, 7, 0, time.UTC)
+	lsm.RestoreCall(ActiveCall{ID: "talking", Line: 2, RingGroup: []int{0, 2}, Direction: CallDirectionInbound, ConnectedAt: &connected})
+	lsm.RestoreCall(ActiveCall{ID: "calling", Line: 1, Direction: CallDirectionOutbound})
+	if changes != 0 {
+		t.Errorf("Expected no state change reported for restored calls, got %d", changes)
+	}
+	if state := lsm.GetLineState(0); state != CallStatusTalking {
+		t.Errorf("Expected line 0 of the ring group to be talking, got %s", state)
+	}
+	if state := lsm.GetLineState(1); state != CallStatusCalling {
+		t.Errorf("Expected line 1 to be calling, got %s", state)
+	}
+
+	// The DISCONNECT finishes the restored call instead of being ignored
+	event := &CallEvent{ID: "talking", Line: 0, Type: CallTypeDisconnect, Duration: 30}
+	if status := lsm.ProcessCallEvent(event); status != CallStatusFinished {
+		t.Errorf("Expected the restored call to finish, got %s", status)
+	}
+	if event.Transition == nil || event.Transition.From != CallStatusTalking {
+		t.Errorf("Expected a transition from talking, got %+v", event.Transition)
+	}
+}
@@ -0,0 +1,167 @@
+package types
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// RingCadence is the interval of one ring (1s tone, 4s pause) used to estimate the ring count
+const RingCadence = 5 * time.Second
+
+// MissedCall represents an unanswered incoming call
+type MissedCall struct {
+	ID           string                `json:"id"`
+	Timestamp    time.Time             `json:"timestamp"` // Start of ringing
+	Line         int                   `json:"line"`
+	Trunk        string                `json:"trunk,omitempty"`
+	Caller       LineStatusParticipant `json:"caller"`
+	Called       LineStatusParticipant `json:"called"`
+	CalledMSN    string                `json:"called_msn,omitempty"`
+	RingDuration int                   `json:"ring_duration"` // Seconds from RING to DISCONNECT
+	RingCount    int                   `json:"ring_count"`    // Estimated number of rings
+	MessageBox   bool                  `json:"message_box"`   // Caller reached the answering machine
+	Attempts     int                   `json:"attempts"`      // Number of merged attempts of the caller
+	LastAttempt  time.Time             `json:"last_attempt"`  // Start of ringing of the latest attempt
+}
+
+// PendingAck is a missed call waiting for an acknowledgement until the deadline
+type PendingAck struct {
+	Call     MissedCall `json:"call"`
+	Deadline time.Time  `json:"deadline"`
+}
+
+// MissedCallList represents the list of recent missed calls
+type MissedCallList struct {
+	Calls     []MissedCall `json:"calls"`
+	Today     int          `json:"today"` // Number of missed calls since midnight
+	MaxSize   int          `json:"max_size"`
+	UpdatedAt time.Time    `json:"updated_at"`
+
+	// MergeWindow merges a missed call into the previous one if the same
+	// caller tried again within this time (0 = disabled)
+	MergeWindow time.Duration `json:"-"`
+}
+
+// NewMissedCall creates a missed call from the DISCONNECT event and the time ringing started
+func NewMissedCall(event CallEvent, ringStart time.Time) MissedCall {
+	if ringStart.IsZero() || ringStart.After(event.Timestamp) {
+		ringStart = event.Timestamp
+	}
+	ringDuration := event.Timestamp.Sub(ringStart)
+
+	return MissedCall{
+		ID:           event.ID,
+		Timestamp:    ringStart,
+		Line:         event.Line,
+		Trunk:        event.Trunk,
+		Caller:       LineStatusParticipant{PhoneNumber: event.Caller},
+		Called:       LineStatusParticipant{PhoneNumber: event.Called, Name: event.CalledMSNName},
+		CalledMSN:    event.CalledMSN,
+		RingDuration: int(ringDuration.Seconds()),
+		RingCount:    EstimateRingCount(ringDuration),
+		MessageBox:   event.MessageBox,
+		Attempts:     1,
+		LastAttempt:  ringStart,
+	}
+}
+
+// EstimateRingCount estimates how often the phone rang; the callmonitor does not report it
+func EstimateRingCount(duration time.Duration) int {
+	if duration <= 0 {
+		return 1
+	}
+	return int(math.Ceil(float64(duration) / float64(RingCadence)))
+}
+
+// AddCall adds a missed call to the list, maintaining the maximum size
+func (l *MissedCallList) AddCall(call MissedCall) {
+	l.AddCallAt(call, time.Now())
+}
+
+// AddCallAt is AddCall with the given time as update time; Today counts the
+// missed calls since midnight of that day. It returns the list entry, which is
+// the previous entry with one more attempt if the call was merged into it.
+func (l *MissedCallList) AddCallAt(call MissedCall, now time.Time) MissedCall {
+	if l.mergeable(call) {
+		l.Calls[0] = l.Calls[0].merge(call)
+	} else {
+		l.Calls = append([]MissedCall{call}, l.Calls...)
+		if len(l.Calls) > l.MaxSize {
+			l.Calls = l.Calls[:l.MaxSize]
+		}
+	}
+	l.UpdatedAt = now
+	l.Today = l.CountSince(startOfDay(l.UpdatedAt))
+	return l.Calls[0]
+}
+
+// AddOlderCallsAt adds missed calls from before all calls of the list, e.g.
+// imported ones, behind them without merging. calls must be ordered oldest first.
+func (l *MissedCallList) AddOlderCallsAt(calls []MissedCall, now time.Time) {
+	for _, call := range slices.Backward(calls) {
+		if len(l.Calls) >= l.MaxSize {
+			break
+		}
+		l.Calls = append(l.Calls, call)
+	}
+	l.UpdatedAt = now
+	l.Today = l.CountSince(startOfDay(l.UpdatedAt))
+}
+
+// CountSince returns the number of missed calls since the given time; merged attempts count separately
+func (l *MissedCallList) CountSince(since time.Time) int {
+	count := 0
+	for _, call := range l.Calls {
+		if !call.Timestamp.Before(since) {
+			count += call.attempts()
+		}
+	}
+	return count
+}
+
+// mergeable reports whether call is a redial of the newest missed call within the merge window.
+// Anonymous calls are never merged, they may come from different callers.
+func (l *MissedCallList) mergeable(call MissedCall) bool {
+	if l.MergeWindow <= 0 || len(l.Calls) == 0 || call.Caller.PhoneNumber == "" {
+		return false
+	}
+	previous := l.Calls[0]
+	if previous.Caller.PhoneNumber != call.Caller.PhoneNumber {
+		return false
+	}
+	gap := call.Timestamp.Sub(previous.lastAttempt())
+	return gap >= 0 && gap <= l.MergeWindow
+}
+
+// merge adds the attempt of call to the missed call c
+func (c MissedCall) merge(call MissedCall) MissedCall {
+	c.Attempts = c.attempts() + call.attempts()
+	c.LastAttempt = call.lastAttempt()
+	c.RingDuration += call.RingDuration
+	c.RingCount += call.RingCount
+	c.MessageBox = c.MessageBox || call.MessageBox
+	return c
+}
+
+// attempts returns the number of attempts, entries created before merging count as one
+func (c MissedCall) attempts() int {
+	if c.Attempts < 1 {
+		return 1
+	}
+	return c.Attempts
+}
+
+// lastAttempt returns the start of the latest attempt
+func (c MissedCall) lastAttempt() time.Time {
+	if c.LastAttempt.IsZero() {
+		return c.Timestamp
+	}
+	return c.LastAttempt
+}
+
+// startOfDay returns midnight of the given day in its location
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
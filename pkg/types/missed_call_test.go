@@ -0,0 +1,140 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEstimateRingCount(t *testing.T) {
+	tests := []struct {
+		name     string
+		duration time.Duration
+		expected int
+	}{
+		{"hung up immediately", 0, 1},
+		{"one ring", 3 * time.Second, 1},
+		{"exactly two rings", 10 * time.Second, 2},
+		{"three rings", 12 * time.Second, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EstimateRingCount(tt.duration); got != tt.expected {
+				t.Errorf("EstimateRingCount(%v) = %d, expected %d", tt.duration, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestNewMissedCall(t *testing.T) {
+	ringStart := time.Date(2025, 9, 9, 15, 30, 45, 0, time.UTC)
+	event := CallEvent{
+		ID:         "call-1",
+		Timestamp:  ringStart.Add(17 * time.Second),
+		Type:       CallTypeDisconnect,
+		Line:       0,
+		Trunk:      "SIP0",
+		Caller:     "+49123456789",
+		Called:     "+496181990133",
+		CalledMSN:  "990133",
+		MessageBox: true,
+	}
+
+	call := NewMissedCall(event, ringStart)
+
+	if call.RingDuration != 17 || call.RingCount != 4 {
+		t.Errorf("Expected 17s and 4 rings, got %ds and %d rings", call.RingDuration, call.RingCount)
+	}
+	if !call.Timestamp.Equal(ringStart) {
+		t.Errorf("Expected timestamp of ring start, got %v", call.Timestamp)
+	}
+	if call.Caller.PhoneNumber != "+49123456789" || call.CalledMSN != "990133" || !call.MessageBox {
+		t.Errorf("Unexpected missed call: %+v", call)
+	}
+
+	// Unknown ring start falls back to the disconnect time
+	if call := NewMissedCall(event, time.Time{}); call.RingDuration != 0 || call.RingCount != 1 {
+		t.Errorf("Expected zero duration without ring start, got %+v", call)
+	}
+}
+
+func TestMissedCallListToday(t *testing.T) {
+	list := &MissedCallList{MaxSize: 3}
+	now := time.Now()
+
+	list.AddCall(MissedCall{ID: "yesterday", Timestamp: now.AddDate(0, 0, -1)})
+	list.AddCall(MissedCall{ID: "today-1", Timestamp: now})
+	list.AddCall(MissedCall{ID: "today-2", Timestamp: now})
+	list.AddCall(MissedCall{ID: "today-3", Timestamp: now})
+
+	if len(list.Calls) != 3 {
+		t.Errorf("Expected list to be limited to 3 calls, got %d", len(list.Calls))
+	}
+	if list.Calls[0].ID != "today-3" {
+		t.Errorf("Expected newest call first, got %s", list.Calls[0].ID)
+	}
+	if list.Today != 3 {
+		t.Errorf("Expected 3 missed calls today, got %d", list.Today)
+	}
+}
+
+func TestMissedCallListTodayAfterMidnight(t *testing.T) {
+	list := &MissedCallList{MaxSize: 10}
+	evening := time.Date(2025, 9, 21, 23, 59, 0, 0, time.UTC)
+
+	list.AddCallAt(MissedCall{ID: "evening", Timestamp: evening}, evening)
+	if list.Today != 1 {
+		t.Errorf("Expected 1 missed call before midnight, got %d", list.Today)
+	}
+
+	morning := evening.Add(2 * time.Minute)
+	list.AddCallAt(MissedCall{ID: "morning", Timestamp: morning}, morning)
+	if list.Today != 1 {
+		t.Errorf("Expected the counter to restart at midnight, got %d", list.Today)
+	}
+	if !list.UpdatedAt.Equal(morning) {
+		t.Errorf("Expected UpdatedAt %v, got %v", morning, list.UpdatedAt)
+	}
+}
+
+func TestMissedCallListMerge(t *testing.T) {
+	start := time.Date(2025, 9, 22, 10, 0, 0, 0, time.UTC)
+	missed := func(id, caller string, offset time.Duration) MissedCall {
+		ringStart := start.Add(offset)
+		return NewMissedCall(CallEvent{ID: id, Caller: caller, Timestamp: ringStart.Add(10 * time.Second)}, ringStart)
+	}
+
+	list := &MissedCallList{MaxSize: 10, MergeWindow: 5 * time.Minute}
+	for _, call := range []MissedCall{
+		missed("first", "+4930123456", 0),
+		missed("redial", "+4930123456", time.Minute),
+		missed("redial-2", "+4930123456", 5*time.Minute), // Within the window of the previous redial
+		missed("other", "+4940987654", 6*time.Minute),    // Different caller
+		missed("late", "+4940987654", 12*time.Minute),    // Outside the window
+		missed("anonymous-1", "", 13*time.Minute),        // Anonymous calls are not merged
+		missed("anonymous-2", "", 14*time.Minute),
+	} {
+		list.AddCallAt(call, start)
+	}
+
+	if len(list.Calls) != 5 {
+		t.Fatalf("Expected 5 entries, got %d: %+v", len(list.Calls), list.Calls)
+	}
+	first := list.Calls[4]
+	if first.ID != "first" || first.Attempts != 3 || first.RingDuration != 30 || first.RingCount != 6 {
+		t.Errorf("Expected 3 merged attempts with summed ring time, got %+v", first)
+	}
+	if !first.Timestamp.Equal(start) || !first.LastAttempt.Equal(start.Add(5*time.Minute)) {
+		t.Errorf("Expected first and last attempt to be kept, got %v and %v", first.Timestamp, first.LastAttempt)
+	}
+	if list.Today != 7 {
+		t.Errorf("Expected every attempt to count for today, got %d", list.Today)
+	}
+
+	// Without a merge window every call gets its own entry
+	list = &MissedCallList{MaxSize: 10}
+	list.AddCallAt(missed("first", "+4930123456", 0), start)
+	if merged := list.AddCallAt(missed("redial", "+4930123456", time.Minute), start); merged.ID != "redial" || len(list.Calls) != 2 {
+		t.Errorf("Expected no merging without window, got %+v", list.Calls)
+	}
+}
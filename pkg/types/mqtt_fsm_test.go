@@ -92,6 +92,8 @@ func TestCallStateMachineWithMQTTTimeout(t *testing.T) {
 
 	fsm := NewCallStateMachineWithMQTT(1, mockPublisher, nil)
 	defer fsm.Cleanup()
+	clk := newFakeClock()
+	fsm.SetClock(clk)
 
 	// Create transition to finished state (which has timeout)
 	fsm.ProcessEvent(CallTypeRing)
@@ -99,13 +101,13 @@ func TestCallStateMachineWithMQTTTimeout(t *testing.T) {
 	fsm.ProcessEvent(CallTypeDisconnect) // Should go to finished
 
 	// Reset published changes to focus on timeout
+	eventually(t, func() bool { return len(mockPublisher.PublishedChanges) == 3 })
 	mockPublisher.PublishedChanges = nil
 
-	// Wait for timeout
-	time.Sleep(1200 * time.Millisecond)
+	clk.Advance(finishTimeout)
 
 	// Should have timeout transition published
-	if len(mockPublisher.PublishedChanges) == 0 {
+	if !eventually(t, func() bool { return len(mockPublisher.PublishedChanges) > 0 }) {
 		t.Error("Expected timeout transition to be published")
 		return
 	}
@@ -0,0 +1,60 @@
+package types
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ParseMSNs parses the own numbers of the Fritz!Box, optionally with a name,
+// e.g. "990133=Office". Spaces and leading zeros are removed, as MSNs are
+// matched as suffix of the numbers of a call. It returns the MSNs in the
+// configured order without duplicates and their names.
+func ParseMSNs(entries []string) ([]string, map[string]string, error) {
+	msns := make([]string, 0, len(entries))
+	names := make(map[string]string)
+	for _, entry := range entries {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		value, name, hasName := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		if hasName && name == "" {
+			return nil, nil, fmt.Errorf("invalid MSN '%s', expected msn or msn=name", entry)
+		}
+		msn, err := NormalizeMSN(value)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if known, exists := names[msn]; exists && name != "" && known != name {
+			return nil, nil, fmt.Errorf("MSN '%s' is named '%s' and '%s'", msn, known, name)
+		}
+		if name != "" {
+			names[msn] = name
+		}
+		if !slices.Contains(msns, msn) {
+			msns = append(msns, msn)
+		}
+	}
+	return msns, names, nil
+}
+
+// NormalizeMSN removes spaces and leading zeros from an MSN, e.g. "0 990 133"
+// becomes "990133". MSNs with other characters than digits are rejected.
+func NormalizeMSN(value string) (string, error) {
+	msn := strings.Join(strings.Fields(value), "")
+	if msn == "" {
+		return "", fmt.Errorf("empty MSN")
+	}
+	for _, r := range msn {
+		if r < '0' || r > '9' {
+			return "", fmt.Errorf("invalid MSN '%s', expected digits only", strings.TrimSpace(value))
+		}
+	}
+	msn = strings.TrimLeft(msn, "0")
+	if msn == "" {
+		return "", fmt.Errorf("invalid MSN '%s', expected digits other than zeros", strings.TrimSpace(value))
+	}
+	return msn, nil
+}
@@ -0,0 +1,45 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMSNs(t *testing.T) {
+	tests := []struct {
+		name          string
+		entries       []string
+		expectedMSNs  []string
+		expectedNames map[string]string
+		wantErr       bool
+	}{
+		{"empty", nil, []string{}, map[string]string{}, false},
+		{"plain", []string{"990133", "990134"}, []string{"990133", "990134"}, map[string]string{}, false},
+		{"normalized", []string{" 990 133 ", "0990134", ""}, []string{"990133", "990134"}, map[string]string{}, false},
+		{"names", []string{"990133=Office", "990134 = Fax"}, []string{"990133", "990134"}, map[string]string{"990133": "Office", "990134": "Fax"}, false},
+		{"duplicates", []string{"990133", "0990133=Office", "990 133"}, []string{"990133"}, map[string]string{"990133": "Office"}, false},
+		{"conflicting names", []string{"990133=Office", "990133=Fax"}, nil, nil, true},
+		{"non-digits", []string{"+4930990133"}, nil, nil, true},
+		{"zeros only", []string{"000"}, nil, nil, true},
+		{"missing name", []string{"990133="}, nil, nil, true},
+		{"missing MSN", []string{"=Office"}, nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msns, names, err := ParseMSNs(tt.entries)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMSNs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(msns, tt.expectedMSNs) {
+				t.Errorf("ParseMSNs() MSNs = %v, expected %v", msns, tt.expectedMSNs)
+			}
+			if !reflect.DeepEqual(names, tt.expectedNames) {
+				t.Errorf("ParseMSNs() names = %v, expected %v", names, tt.expectedNames)
+			}
+		})
+	}
+}
@@ -0,0 +1,10 @@
+package types
+
+// SchemaVersion is the version of the layout of the published payloads,
+// carried in their schema_version field. It increases whenever fields are
+// renamed or removed, so consumers can tell which fields to expect.
+const SchemaVersion = 2
+
+// SchemaVersionLegacy is the layout before payloads carried their version,
+// the same fields without schema_version
+const SchemaVersionLegacy = 1
@@ -0,0 +1,17 @@
+package types
+
+import "context"
+
+// CallEventSink receives call events after they have been processed by the FSM.
+// Implementations should give up when ctx is cancelled.
+type CallEventSink interface {
+	PublishCallEvent(ctx context.Context, event CallEvent) error
+}
+
+// CallEventSinkFunc adapts a plain function to the CallEventSink interface
+type CallEventSinkFunc func(ctx context.Context, event CallEvent) error
+
+// PublishCallEvent calls f(ctx, event)
+func (f CallEventSinkFunc) PublishCallEvent(ctx context.Context, event CallEvent) error {
+	return f(ctx, event)
+}
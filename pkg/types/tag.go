@@ -0,0 +1,191 @@
+package types
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// TimeRange is a time of day range, e.g. 08:00-18:00. A range ending before
+// it starts wraps around midnight, e.g. 22:00-06:00.
+type TimeRange struct {
+	From time.Duration // Since midnight, inclusive
+	To   time.Duration // Since midnight, exclusive
+}
+
+// ParseTimeRange parses a range like "08:00-18:00"
+func ParseTimeRange(value string) (TimeRange, error) {
+	from, to, ok := strings.Cut(value, "-")
+	if !ok {
+		return TimeRange{}, fmt.Errorf("invalid time range '%s', expected HH:MM-HH:MM", value)
+	}
+	start, err := parseTimeOfDay(from)
+	if err != nil {
+		return TimeRange{}, fmt.Errorf("invalid time range '%s', expected HH:MM-HH:MM", value)
+	}
+	end, err := parseTimeOfDay(to)
+	if err != nil {
+		return TimeRange{}, fmt.Errorf("invalid time range '%s', expected HH:MM-HH:MM", value)
+	}
+	return TimeRange{From: start, To: end}, nil
+}
+
+// parseTimeOfDay parses "HH:MM" into the time since midnight; "24:00" is the end of the day
+func parseTimeOfDay(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if value == "24:00" {
+		return 24 * time.Hour, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains reports whether the time of day of t lies in the range
+func (r TimeRange) Contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if r.From <= r.To {
+		return offset >= r.From && offset < r.To
+	}
+	return offset >= r.From || offset < r.To
+}
+
+// TagRule attaches a tag to the calls matching all of its conditions. A
+// condition with several values matches if one of them does.
+type TagRule struct {
+	Tag      string
+	Prefixes []string    // Number of the other party starts with one of these
+	MSNs     []string    // Own number of the call
+	Groups   []string    // Contact group of the other party
+	Times    []TimeRange // Time of day the call started
+}
+
+// ParseTagRules parses rule entries like "work:msn=990133;time=08:00-18:00"
+// or "spam:prefix=+49900|+49137". Conditions are separated by ';', values by
+// '|'; the conditions are prefix, msn, group and time.
+func ParseTagRules(entries []string) ([]TagRule, error) {
+	rules := make([]TagRule, 0, len(entries))
+	for _, entry := range entries {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		tag, conditions, ok := strings.Cut(entry, ":")
+		rule := TagRule{Tag: strings.TrimSpace(tag)}
+		if !ok || rule.Tag == "" || strings.TrimSpace(conditions) == "" {
+			return nil, fmt.Errorf("invalid tag rule '%s', expected tag:condition=value;...", entry)
+		}
+
+		for _, condition := range strings.Split(conditions, ";") {
+			if strings.TrimSpace(condition) == "" {
+				continue
+			}
+			key, value, ok := strings.Cut(condition, "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid condition '%s' of tag rule '%s', expected name=value", condition, rule.Tag)
+			}
+			var values []string
+			for _, v := range strings.Split(value, "|") {
+				if v = strings.TrimSpace(v); v != "" {
+					values = append(values, v)
+				}
+			}
+			if len(values) == 0 {
+				return nil, fmt.Errorf("condition '%s' of tag rule '%s' has no value", condition, rule.Tag)
+			}
+
+			switch strings.TrimSpace(key) {
+			case "prefix":
+				rule.Prefixes = append(rule.Prefixes, values...)
+			case "msn":
+				rule.MSNs = append(rule.MSNs, values...)
+			case "group":
+				rule.Groups = append(rule.Groups, values...)
+			case "time":
+				for _, v := range values {
+					r, err := ParseTimeRange(v)
+					if err != nil {
+						return nil, fmt.Errorf("tag rule '%s': %w", rule.Tag, err)
+					}
+					rule.Times = append(rule.Times, r)
+				}
+			default:
+				return nil, fmt.Errorf("unknown condition '%s' of tag rule '%s', expected prefix, msn, group or time", key, rule.Tag)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// ParseContactGroups parses group entries like "+4930123456=family" into the
+// groups by number. A number can be listed once per group.
+func ParseContactGroups(entries []string) (map[string][]string, error) {
+	groups := make(map[string][]string, len(entries))
+	for _, entry := range entries {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		number, group, ok := strings.Cut(entry, "=")
+		number, group = strings.TrimSpace(number), strings.TrimSpace(group)
+		if !ok || number == "" || group == "" {
+			return nil, fmt.Errorf("invalid contact group '%s', expected number=group", entry)
+		}
+		groups[number] = append(groups[number], group)
+	}
+	return groups, nil
+}
+
+// Tagger attaches the tags of the matching rules to calls. A nil Tagger
+// attaches no tags.
+type Tagger struct {
+	rules  []TagRule
+	groups map[string][]string // Contact groups by number
+}
+
+// NewTagger creates a tagger for the rules and the contact groups by number
+func NewTagger(rules []TagRule, groups map[string][]string) *Tagger {
+	return &Tagger{rules: rules, groups: groups}
+}
+
+// Tags returns the sorted tags of the call started by a RING or CALL event.
+// Times are compared in the location of the event timestamp.
+func (t *Tagger) Tags(event *CallEvent) []string {
+	if t == nil {
+		return nil
+	}
+
+	own, other := event.Caller, event.Called
+	if event.Direction == CallDirectionInbound {
+		own, other = event.Called, event.Caller
+	}
+
+	var tags []string
+	for _, rule := range t.rules {
+		if slices.Contains(tags, rule.Tag) || !t.matches(rule, own, other, event.Timestamp) {
+			continue
+		}
+		tags = append(tags, rule.Tag)
+	}
+	slices.Sort(tags)
+	return tags
+}
+
+// matches checks the conditions of the rule against a call
+func (t *Tagger) matches(rule TagRule, own, other string, started time.Time) bool {
+	if len(rule.Prefixes) > 0 && !slices.ContainsFunc(rule.Prefixes, func(prefix string) bool { return strings.HasPrefix(other, prefix) }) {
+		return false
+	}
+	if len(rule.MSNs) > 0 && DetectMSN(own, rule.MSNs) == "" {
+		return false
+	}
+	if len(rule.Groups) > 0 && !slices.ContainsFunc(t.groups[other], func(group string) bool { return slices.Contains(rule.Groups, group) }) {
+		return false
+	}
+	if len(rule.Times) > 0 && !slices.ContainsFunc(rule.Times, func(r TimeRange) bool { return r.Contains(started) }) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package types
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseTagRules(t *testing.T) {
+	rules, err := ParseTagRules([]string{"work:msn=990133;time=08:00-18:00", "", "spam: prefix=+49900|+49137 "})
+	if err != nil {
+		t.Fatalf("ParseTagRules failed: %v", err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("Expected 2 rules, got %d", len(rules))
+	}
+	if rules[0].Tag != "work" || len(rules[0].MSNs) != 1 || len(rules[0].Times) != 1 || rules[0].Times[0].To != 18*time.Hour {
+		t.Errorf("Unexpected work rule: %+v", rules[0])
+	}
+	if !slices.Equal(rules[1].Prefixes, []string{"+49900", "+49137"}) {
+		t.Errorf("Expected both prefixes of the spam rule, got %v", rules[1].Prefixes)
+	}
+
+	for _, entry := range []string{"work", ":msn=1", "work:", "work:msn", "work:msn=", "work:day=monday", "work:time=8-18", "work:time=08:00"} {
+		if _, err := ParseTagRules([]string{entry}); err == nil {
+			t.Errorf("Expected error for tag rule %q", entry)
+		}
+	}
+}
+
+func TestTimeRangeContains(t *testing.T) {
+	day := time.Date(2025, 9, 22, 0, 0, 0, 0, time.UTC)
+	office := TimeRange{From: 8 * time.Hour, To: 18 * time.Hour}
+	night := TimeRange{From: 22 * time.Hour, To: 6 * time.Hour}
+
+	tests := []struct {
+		r        TimeRange
+		at       time.Duration
+		expected bool
+	}{
+		{office, 8 * time.Hour, true},
+		{office, 18 * time.Hour, false},
+		{office, 7*time.Hour + 59*time.Minute, false},
+		{night, 23 * time.Hour, true},
+		{night, 5 * time.Hour, true},
+		{night, 12 * time.Hour, false},
+	}
+	for _, tt := range tests {
+		if got := tt.r.Contains(day.Add(tt.at)); got != tt.expected {
+			t.Errorf("%+v.Contains(%v) = %v, expected %v", tt.r, tt.at, got, tt.expected)
+		}
+	}
+}
+
+func TestTaggerTags(t *testing.T) {
+	rules, err := ParseTagRules([]string{
+		"work:msn=990133;time=08:00-18:00",
+		"family:group=family",
+		"spam:prefix=+49900|+49137",
+		"known:group=family|work",
+	})
+	if err != nil {
+		t.Fatalf("ParseTagRules failed: %v", err)
+	}
+	groups, err := ParseContactGroups([]string{"+4930123456=family", "+4930654321=work"})
+	if err != nil {
+		t.Fatalf("ParseContactGroups failed: %v", err)
+	}
+	tagger := NewTagger(rules, groups)
+	morning := time.Date(2025, 9, 22, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		event    CallEvent
+		expected []string
+	}{
+		{
+			name:     "inbound family call to the office MSN",
+			event:    CallEvent{Direction: CallDirectionInbound, Caller: "+4930123456", Called: "+4930990133", Timestamp: morning},
+			expected: []string{"family", "known", "work"},
+		},
+		{
+			name:     "office MSN after hours",
+			event:    CallEvent{Direction: CallDirectionInbound, Caller: "+4930654321", Called: "+4930990133", Timestamp: morning.Add(10 * time.Hour)},
+			expected: []string{"known"},
+		},
+		{
+			name:     "outbound call matches the called number",
+			event:    CallEvent{Direction: CallDirectionOutbound, Caller: "+4930990133", Called: "+49900123", Timestamp: morning},
+			expected: []string{"spam", "work"},
+		},
+		{
+			name:  "no rule matches",
+			event: CallEvent{Direction: CallDirectionInbound, Caller: "+4940111111", Called: "+4930111111", Timestamp: morning},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tags := tagger.Tags(&tt.event); !slices.Equal(tags, tt.expected) {
+				t.Errorf("Expected tags %v, got %v", tt.expected, tags)
+			}
+		})
+	}
+
+	var none *Tagger
+	if tags := none.Tags(&tests[0].event); tags != nil {
+		t.Errorf("Expected no tags of a nil tagger, got %v", tags)
+	}
+}
@@ -0,0 +1,49 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Tariff is the price per started minute of outbound calls to numbers with a prefix
+type Tariff struct {
+	Prefix    string
+	PerMinute float64
+}
+
+// Tariffs estimates call costs by the longest matching prefix
+type Tariffs []Tariff
+
+// ParseTariffs parses tariff entries, e.g. "017=0.09" or "+=0.19". The empty
+// prefix "=0.029" matches all numbers without a more specific tariff.
+func ParseTariffs(entries []string) (Tariffs, error) {
+	tariffs := make(Tariffs, 0, len(entries))
+	for _, entry := range entries {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		prefix, price, ok := strings.Cut(entry, "=")
+		perMinute, err := strconv.ParseFloat(strings.TrimSpace(price), 64)
+		if !ok || err != nil || perMinute < 0 {
+			return nil, fmt.Errorf("invalid tariff '%s', expected prefix=price per minute", entry)
+		}
+		tariffs = append(tariffs, Tariff{Prefix: strings.TrimSpace(prefix), PerMinute: perMinute})
+	}
+	return tariffs, nil
+}
+
+// Cost returns the estimated cost of an outbound call, billed per started minute.
+// Numbers without a matching tariff cost nothing.
+func (t Tariffs) Cost(number string, duration int) float64 {
+	match := -1
+	for i, tariff := range t {
+		if strings.HasPrefix(number, tariff.Prefix) && (match < 0 || len(tariff.Prefix) > len(t[match].Prefix)) {
+			match = i
+		}
+	}
+	if match < 0 || duration <= 0 {
+		return 0
+	}
+	return float64((duration+59)/60) * t[match].PerMinute
+}
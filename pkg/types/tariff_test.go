@@ -0,0 +1,38 @@
+package types
+
+import "testing"
+
+func TestTariffsCost(t *testing.T) {
+	tariffs, err := ParseTariffs([]string{"=0.02", "01=0.09", "+=0.19", "0800=0"})
+	if err != nil {
+		t.Fatalf("ParseTariffs failed: %v", err)
+	}
+
+	tests := []struct {
+		number   string
+		duration int
+		expected float64
+	}{
+		{"030123456", 60, 0.02},
+		{"01701234567", 61, 0.18},
+		{"+4930123456", 1, 0.19},
+		{"08001234567", 600, 0},
+		{"030123456", 0, 0},
+	}
+
+	for _, tt := range tests {
+		if cost := tariffs.Cost(tt.number, tt.duration); cost < tt.expected-1e-9 || cost > tt.expected+1e-9 {
+			t.Errorf("Cost(%s, %d) = %f, expected %f", tt.number, tt.duration, cost, tt.expected)
+		}
+	}
+
+	if cost := (Tariffs{{Prefix: "01", PerMinute: 0.09}}).Cost("030123456", 60); cost != 0 {
+		t.Errorf("Expected numbers without tariff to be free, got %f", cost)
+	}
+
+	for _, entry := range []string{"01", "01=abc", "01=-1"} {
+		if _, err := ParseTariffs([]string{entry}); err == nil {
+			t.Errorf("Expected error for tariff %q", entry)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package types
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ParseTrunkNames parses trunk name entries, e.g. "SIP0=Vodafone"
+func ParseTrunkNames(entries []string) (map[string]string, error) {
+	names := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		trunk, name, ok := strings.Cut(entry, "=")
+		trunk, name = strings.TrimSpace(trunk), strings.TrimSpace(name)
+		if !ok || trunk == "" || name == "" {
+			return nil, fmt.Errorf("invalid trunk name '%s', expected trunk=name", entry)
+		}
+		names[trunk] = name
+	}
+	return names, nil
+}
+
+// TrunkFilter selects the trunks whose calls are processed. The zero value allows all trunks.
+type TrunkFilter struct {
+	Allow []string // Process only calls on these trunks (empty = all)
+	Deny  []string // Never process calls on these trunks, e.g. a fax line
+}
+
+// NewTrunkFilter builds a filter from configuration lists, ignoring empty entries
+func NewTrunkFilter(allow, deny []string) TrunkFilter {
+	clean := func(values []string) []string {
+		var trunks []string
+		for _, value := range values {
+			if value = strings.TrimSpace(value); value != "" {
+				trunks = append(trunks, value)
+			}
+		}
+		return trunks
+	}
+	return TrunkFilter{Allow: clean(allow), Deny: clean(deny)}
+}
+
+// IsEmpty reports whether the filter allows all trunks
+func (f TrunkFilter) IsEmpty() bool {
+	return len(f.Allow) == 0 && len(f.Deny) == 0
+}
+
+// Allows reports whether calls on the trunk are processed. Events without
+// trunk, e.g. of calls started before the bridge, are always allowed.
+func (f TrunkFilter) Allows(trunk string) bool {
+	if trunk == "" {
+		return true
+	}
+	if slices.Contains(f.Deny, trunk) {
+		return false
+	}
+	return len(f.Allow) == 0 || slices.Contains(f.Allow, trunk)
+}
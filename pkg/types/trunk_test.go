@@ -0,0 +1,49 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTrunkNames(t *testing.T) {
+	names, err := ParseTrunkNames([]string{"SIP0=Vodafone", " SIP1 = Business line ", ""})
+	if err != nil {
+		t.Fatalf("ParseTrunkNames failed: %v", err)
+	}
+	expected := map[string]string{"SIP0": "Vodafone", "SIP1": "Business line"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("ParseTrunkNames() = %v, expected %v", names, expected)
+	}
+
+	for _, entry := range []string{"SIP0", "=Vodafone", "SIP0="} {
+		if _, err := ParseTrunkNames([]string{entry}); err == nil {
+			t.Errorf("Expected error for %q", entry)
+		}
+	}
+}
+
+func TestTrunkFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   TrunkFilter
+		trunk    string
+		expected bool
+	}{
+		{"zero value allows all", TrunkFilter{}, "SIP3", true},
+		{"denied", NewTrunkFilter(nil, []string{"SIP3"}), "SIP3", false},
+		{"not denied", NewTrunkFilter(nil, []string{"SIP3"}), "SIP0", true},
+		{"allowed", NewTrunkFilter([]string{"SIP0", " SIP1"}, nil), "SIP1", true},
+		{"not allowed", NewTrunkFilter([]string{"SIP0"}, nil), "SIP1", false},
+		{"deny wins", NewTrunkFilter([]string{"SIP0"}, []string{"SIP0"}), "SIP0", false},
+		{"unknown trunk", NewTrunkFilter([]string{"SIP0"}, nil), "", true},
+		{"empty entries", NewTrunkFilter([]string{""}, []string{""}), "SIP1", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Allows(tt.trunk); got != tt.expected {
+				t.Errorf("Allows(%q) = %v, expected %v", tt.trunk, got, tt.expected)
+			}
+		})
+	}
+}
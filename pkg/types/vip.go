@@ -0,0 +1,31 @@
+package types
+
+import "slices"
+
+// VIPList holds the callers whose calls get priority, e.g. family members,
+// listed by number or by contact group. A nil VIPList holds nobody.
+type VIPList struct {
+	numbers       []string
+	groups        []string
+	contactGroups map[string][]string // Contact groups by number, see ParseContactGroups
+}
+
+// NewVIPList creates a list of the numbers and the members of the contact groups.
+// Numbers are compared with the normalized caller, e.g. +4930123456.
+func NewVIPList(numbers, groups []string, contactGroups map[string][]string) *VIPList {
+	if len(numbers) == 0 && len(groups) == 0 {
+		return nil
+	}
+	return &VIPList{numbers: numbers, groups: groups, contactGroups: contactGroups}
+}
+
+// Matches reports whether the event belongs to an inbound call of a VIP
+func (l *VIPList) Matches(event *CallEvent) bool {
+	if l == nil || event.Direction != CallDirectionInbound || event.Caller == "" {
+		return false
+	}
+	if slices.Contains(l.numbers, event.Caller) {
+		return true
+	}
+	return slices.ContainsFunc(l.contactGroups[event.Caller], func(group string) bool { return slices.Contains(l.groups, group) })
+}
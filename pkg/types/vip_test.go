@@ -0,0 +1,38 @@
+package types
+
+import "testing"
+
+func TestVIPListMatches(t *testing.T) {
+	groups, err := ParseContactGroups([]string{"+4930123456=family", "+4930654321=work"})
+	if err != nil {
+		t.Fatalf("ParseContactGroups failed: %v", err)
+	}
+	vips := NewVIPList([]string{"+4940111111"}, []string{"family"}, groups)
+
+	tests := []struct {
+		name     string
+		event    CallEvent
+		expected bool
+	}{
+		{"listed number", CallEvent{Direction: CallDirectionInbound, Caller: "+4940111111"}, true},
+		{"member of a VIP group", CallEvent{Direction: CallDirectionInbound, Caller: "+4930123456"}, true},
+		{"member of another group", CallEvent{Direction: CallDirectionInbound, Caller: "+4930654321"}, false},
+		{"outbound call to a VIP", CallEvent{Direction: CallDirectionOutbound, Called: "+4940111111"}, false},
+		{"anonymous caller", CallEvent{Direction: CallDirectionInbound}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := vips.Matches(&tt.event); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	if NewVIPList(nil, nil, groups) != nil {
+		t.Error("Expected no list without numbers and groups")
+	}
+	var none *VIPList
+	if none.Matches(&CallEvent{Direction: CallDirectionInbound, Caller: "+4940111111"}) {
+		t.Error("Expected a nil list to match nobody")
+	}
+}
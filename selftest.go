@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/broker"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/config"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/mqtt"
+	"github.com/akentner/fritz-callmonitor2mqtt/internal/simulator"
+	"github.com/akentner/fritz-callmonitor2mqtt/pkg/types"
+)
+
+// selftestSteps simulates an answered inbound call on line 0 and an
+// unanswered outbound call on line 1
+var selftestSteps = []simulator.Step{
+	{Delay: 0, Message: "RING;0;01701234567;990133;SIP0;"},
+	{Delay: 100 * time.Millisecond, Message: "CALL;1;2;990134;01707654321;SIP1;"},
+	{Delay: 100 * time.Millisecond, Message: "CONNECT;0;1;01701234567;"},
+	{Delay: 100 * time.Millisecond, Message: "DISCONNECT;0;5;"},
+	{Delay: 100 * time.Millisecond, Message: "DISCONNECT;1;0;"},
+}
+
+// selftestExpected maps lines to the finish state their call must end in
+var selftestExpected = map[int]types.CallStatus{
+	0: types.CallStatusFinished,
+	1: types.CallStatusNotReached,
+}
+
+// runSelftest runs the whole pipeline against an embedded MQTT broker and a
+// simulated Fritz!Box and verifies the published messages
+func runSelftest(cfg *config.Config, timeout time.Duration) error {
+	mqttBroker, err := broker.New()
+	if err != nil {
+		return err
+	}
+	host, port, err := mqttBroker.Start()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = mqttBroker.Close() }()
+
+	cfg.MQTT.Broker = host
+	cfg.MQTT.Port = port
+	cfg.MQTT.Username = ""
+	cfg.MQTT.Password = ""
+	cfg.MQTT.UsernameFile = ""
+	cfg.MQTT.PasswordFile = ""
+	cfg.MQTT.OAuth = config.MQTTOAuthConfig{}
+
+	// Keep test calls out of real dashboards
+	cfg.Influx.URL = ""
+
+	// The checks below expect the built-in topic layout
+	cfg.MQTT.Topics = config.TopicsConfig{}
+
+	// Avoid clashing with a running instance
+	cfg.App.HealthCheckPort = 0
+
+	// Never switch deflections of a real Fritz!Box
+	cfg.FritzBox.DNDControl = false
+
+	// Keep the real database untouched
+	dataDir, err := os.MkdirTemp("", "fritz-callmonitor2mqtt-selftest")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary data directory: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(dataDir) }()
+	cfg.Database.DataDir = dataDir
+
+	// Record what the bridge publishes, matched against the built-in topic layout
+	topics := mqtt.DefaultTopics()
+	filters := make(map[*mqtt.Topic]string)
+	for _, topic := range []*mqtt.Topic{topics.Status, topics.Call, topics.LineLastEvent} {
+		if filters[topic], err = topic.Filter(cfg.MQTT.TopicPrefix, ""); err != nil {
+			return err
+		}
+	}
+	var mu sync.Mutex
+	online := false
+	finishStates := make(map[int]types.CallStatus)
+	callTopics := 0
+	err = mqttBroker.Subscribe(cfg.MQTT.TopicPrefix+"/#", func(msg broker.Message) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch {
+		case mqtt.MatchFilter(filters[topics.Status], msg.Topic):
+			var status types.ServiceStatus
+			if json.Unmarshal(msg.Payload, &status) == nil && status.State == "online" {
+				online = true
+			}
+		case mqtt.MatchFilter(filters[topics.Call], msg.Topic):
+			callTopics++
+		case mqtt.MatchFilter(filters[topics.LineLastEvent], msg.Topic):
+			var event types.CallEvent
+			if json.Unmarshal(msg.Payload, &event) == nil && event.Type == types.CallTypeDisconnect && event.FinishState != nil {
+				finishStates[event.Line] = *event.FinishState
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	server, err := startSimulation(selftestSteps, 1, cfg)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = server.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	application, err := newApplication(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer application.Shutdown()
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- application.Run() }()
+
+	// check reports nil once all expected messages were seen
+	check := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if !online {
+			return fmt.Errorf("no online status published")
+		}
+		if callTopics == 0 {
+			return fmt.Errorf("no call status published")
+		}
+		for line, expected := range selftestExpected {
+			if got, ok := finishStates[line]; !ok || got != expected {
+				return fmt.Errorf("line %d: expected finish state %s, got %q", line, expected, got)
+			}
+		}
+		return nil
+	}
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if check() == nil {
+				log.Println("Self-test: all expected MQTT messages received")
+				return nil
+			}
+		case err := <-runErr:
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("application stopped unexpectedly")
+		case <-ctx.Done():
+			if err := check(); err != nil {
+				return fmt.Errorf("timeout after %v: %w", timeout, err)
+			}
+			return nil
+		}
+	}
+}